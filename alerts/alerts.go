@@ -0,0 +1,268 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// TYPES
+// -----------------------------------------------------------------------------
+
+// Kind distinguishes outage transitions.
+type Kind string
+
+const (
+	KindOffline Kind = "offline"
+	KindOnline  Kind = "online"
+
+	// Cluster health transitions raised by the NATS quorum watchdog.
+	KindQuorumLost     Kind = "quorum_lost"
+	KindQuorumRestored Kind = "quorum_restored"
+	KindClusterChanged Kind = "cluster_changed"
+
+	// Service redundancy transitions raised by the Alerts.Redundancy rules.
+	KindRedundancyLost     Kind = "redundancy_lost"
+	KindRedundancyRestored Kind = "redundancy_restored"
+
+	// Clock skew of a node, raised from heartbeat timestamps.
+	KindClockSkew   Kind = "clock_skew"
+	KindClockSynced Kind = "clock_synced"
+
+	// Abnormal usage spike of an ASN or country, raised by collators.
+	KindUsageAnomaly Kind = "usage_anomaly"
+)
+
+// CheckTypeCluster marks events about the monitoring cluster itself rather
+// than a member.
+const CheckTypeCluster = "cluster"
+
+// CheckTypeService marks events about a service as a whole rather than one
+// of its providers.
+const CheckTypeService = "service"
+
+// CheckTypeUsage marks events about DNS usage patterns.
+const CheckTypeUsage = "usage"
+
+// IsProblem reports whether k opens an incident (as opposed to resolving one
+// or being informational).
+func (k Kind) IsProblem() bool {
+	return k == KindOffline || k == KindQuorumLost || k == KindRedundancyLost || k == KindClockSkew ||
+		k == KindUsageAnomaly
+}
+
+// Severity ranks events so destinations can drop the less important ones.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+var severityNames = [...]string{"info", "warning", "critical"}
+
+func (s Severity) String() string {
+	if s < SeverityInfo || s > SeverityCritical {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity parses "info", "warning" or "critical"; empty is info.
+func ParseSeverity(s string) (Severity, error) {
+	if s == "" {
+		return SeverityInfo, nil
+	}
+	for i, name := range severityNames {
+		if strings.EqualFold(s, name) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityInfo, fmt.Errorf("unknown severity %q", s)
+}
+
+// Severity returns the severity of events of kind k. Resolutions share the
+// severity of the problem they resolve, so a destination that got the
+// problem also gets its resolution.
+func (k Kind) Severity() Severity {
+	switch k {
+	case KindOffline, KindOnline, KindQuorumLost, KindQuorumRestored,
+		KindRedundancyLost, KindRedundancyRestored:
+		return SeverityCritical
+	case KindClockSkew, KindClockSynced, KindUsageAnomaly:
+		return SeverityWarning
+	}
+	return SeverityInfo
+}
+
+// Event describes a single outage transition delivered to every sink.
+type Event struct {
+	Kind      Kind      `json:"kind"`
+	Member    string    `json:"member"`
+	CheckType string    `json:"check_type"`
+	CheckName string    `json:"check_name"`
+	Domain    string    `json:"domain"`
+	Endpoint  string    `json:"endpoint"`
+	IPv6      bool      `json:"ipv6"`
+	Error     string    `json:"error,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Time      time.Time `json:"time"`
+
+	// Started is when the problem of a resolution, or of a repeated problem
+	// event, was first raised in this process; Dispatch fills it in.
+	Started time.Time `json:"started,omitempty"`
+
+	// Votes are the monitor votes behind an offline event, node ID → agrees
+	// the member is offline. They are operational detail for operators and
+	// are not passed on to member routes.
+	Votes map[string]bool `json:"votes,omitempty"`
+}
+
+// Key identifies the outage an event belongs to; open and close events for
+// the same outage share a key.
+func (e Event) Key() string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s|%v",
+		e.Member, e.CheckType, e.CheckName, e.Domain, e.Endpoint, e.IPv6)
+}
+
+// Sink delivers alert events to an external system.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, ev Event) error
+}
+
+// -----------------------------------------------------------------------------
+// REGISTRY
+// -----------------------------------------------------------------------------
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = map[string]Sink{}
+)
+
+func init() {
+	RegisterSink(webhookSink{})
+	RegisterSink(memberRouteSink{})
+	RegisterSink(emailSink{})
+}
+
+// RegisterSink adds (or replaces) a sink under its name.
+func RegisterSink(s Sink) {
+	if s == nil {
+		return
+	}
+	sinksMu.Lock()
+	sinks[s.Name()] = s
+	sinksMu.Unlock()
+}
+
+// UnregisterSink removes a previously registered sink.
+func UnregisterSink(name string) {
+	sinksMu.Lock()
+	delete(sinks, name)
+	sinksMu.Unlock()
+}
+
+func registeredSinks() []Sink {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	out := make([]Sink, 0, len(sinks))
+	for _, s := range sinks {
+		out = append(out, s)
+	}
+	return out
+}
+
+// -----------------------------------------------------------------------------
+// DISPATCH
+// -----------------------------------------------------------------------------
+
+// Dispatch delivers ev to every registered sink. Sink failures are logged and
+// never propagated to the caller.
+func Dispatch(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	trackStart(&ev)
+
+	for _, s := range registeredSinks() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := s.Send(ctx, ev); err != nil {
+			log.Log(log.Error, "[alerts] sink %s failed for %s: %v", s.Name(), ev.Key(), err)
+		}
+		cancel()
+	}
+}
+
+// MemberOffline announces a newly opened outage.
+func MemberOffline(member, checkType, checkName, domain, endpoint string, ipv6 bool, errText string) {
+	Dispatch(Event{
+		Kind:      KindOffline,
+		Member:    member,
+		CheckType: checkType,
+		CheckName: checkName,
+		Domain:    domain,
+		Endpoint:  endpoint,
+		IPv6:      ipv6,
+		Error:     errText,
+	})
+}
+
+// MemberOnline announces that an outage has been resolved.
+func MemberOnline(member, checkType, checkName, domain, endpoint string, ipv6 bool) {
+	Dispatch(Event{
+		Kind:      KindOnline,
+		Member:    member,
+		CheckType: checkType,
+		CheckName: checkName,
+		Domain:    domain,
+		Endpoint:  endpoint,
+		IPv6:      ipv6,
+	})
+}
+
+// ClusterHealth announces a change in the monitoring cluster's health.
+// cluster is the configured cluster name and check names the condition, so
+// the lost and restored events of one condition share a key.
+func ClusterHealth(kind Kind, cluster, check, message string) {
+	Dispatch(Event{
+		Kind:      kind,
+		CheckType: CheckTypeCluster,
+		CheckName: check,
+		Domain:    cluster,
+		Message:   message,
+	})
+}
+
+// ServiceRedundancy announces that a service lost or regained its required
+// number of healthy providers, in region when it is set. Lost and restored
+// events of one service and region share a key.
+func ServiceRedundancy(kind Kind, service, region, message string) {
+	Dispatch(Event{
+		Kind:      kind,
+		CheckType: CheckTypeService,
+		CheckName: "redundancy",
+		Domain:    service,
+		Endpoint:  region,
+		Message:   message,
+	})
+}
+
+// UsageAnomaly announces an abnormal spike of hits from one ASN or country
+// (dimension) in hour. Each spike has its own key; there is no resolution.
+func UsageAnomaly(dimension, value string, hour time.Time, message string) {
+	Dispatch(Event{
+		Kind:      KindUsageAnomaly,
+		CheckType: CheckTypeUsage,
+		CheckName: dimension,
+		Domain:    value,
+		Endpoint:  hour.UTC().Format("2006-01-02T15"),
+		Message:   message,
+	})
+}
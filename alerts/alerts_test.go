@@ -0,0 +1,187 @@
+package alerts
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func testEvent() Event {
+	return Event{
+		Kind:      KindOffline,
+		Member:    "provider1",
+		CheckType: "endpoint",
+		CheckName: "wss",
+		Domain:    "rpc.example.com",
+		Endpoint:  "wss://rpc.example.com",
+		Error:     "timeout",
+		Time:      time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestMatchesFilter(t *testing.T) {
+	ev := testEvent()
+
+	if !matchesFilter(cfg.AlertFilter{}, ev) {
+		t.Fatal("expected empty filter to match every event")
+	}
+	if !matchesFilter(cfg.AlertFilter{Members: []string{"PROVIDER1"}, Events: []string{"offline"}}, ev) {
+		t.Fatal("expected case-insensitive member and event match")
+	}
+	if matchesFilter(cfg.AlertFilter{CheckTypes: []string{"site"}}, ev) {
+		t.Fatal("expected check type filter to exclude endpoint events")
+	}
+}
+
+func TestBuildWebhookPayloadFormats(t *testing.T) {
+	ev := testEvent()
+
+	raw, err := buildWebhookPayload(cfg.WebhookConfig{Format: "pagerduty", RoutingKey: "rk"}, ev)
+	if err != nil {
+		t.Fatalf("pagerduty payload: %v", err)
+	}
+	var pd map[string]interface{}
+	if err := json.Unmarshal(raw, &pd); err != nil {
+		t.Fatalf("decode pagerduty payload: %v", err)
+	}
+	if pd["event_action"] != "trigger" || pd["dedup_key"] != ev.Key() || pd["routing_key"] != "rk" {
+		t.Fatalf("unexpected pagerduty payload: %s", raw)
+	}
+
+	raw, err = buildWebhookPayload(cfg.WebhookConfig{Template: `{"msg":"{{.Member}} {{.Kind}}"}`}, ev)
+	if err != nil {
+		t.Fatalf("templated payload: %v", err)
+	}
+	if string(raw) != `{"msg":"provider1 offline"}` {
+		t.Fatalf("unexpected templated payload: %s", raw)
+	}
+
+	if _, err := buildWebhookPayload(cfg.WebhookConfig{Format: "carrier-pigeon"}, ev); err == nil {
+		t.Fatal("expected unsupported format to fail")
+	}
+}
+
+func TestDeliverWebhookSignsAndRetries(t *testing.T) {
+	prevBackoff := webhookBackoff
+	webhookBackoff = time.Millisecond
+	t.Cleanup(func() { webhookBackoff = prevBackoff })
+
+	var calls atomic.Int32
+	var gotSig atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		gotSig.Store(r.Header.Get(SignatureHeader))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	payload := []byte(`{"ok":true}`)
+	deliverWebhook(webhookClient, cfg.WebhookConfig{URL: srv.URL, Secret: "s3cret", MaxRetries: 2}, payload)
+
+	if calls.Load() != 2 {
+		t.Fatalf("expected one retry after a 502, got %d call(s)", calls.Load())
+	}
+	sig, _ := gotSig.Load().(string)
+	if !strings.HasPrefix(sig, "sha256=") || sig[len("sha256="):] != signPayload("s3cret", payload) {
+		t.Fatalf("unexpected signature header %q", sig)
+	}
+}
+
+func TestDeliverWebhookDoesNotRetryClientErrors(t *testing.T) {
+	prevBackoff := webhookBackoff
+	webhookBackoff = time.Millisecond
+	t.Cleanup(func() { webhookBackoff = prevBackoff })
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	deliverWebhook(webhookClient, cfg.WebhookConfig{URL: srv.URL, MaxRetries: 3}, []byte(`{}`))
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected a single attempt for a 400, got %d", calls.Load())
+	}
+}
+
+func TestClusterHealthSummaryAndPagerDutyAction(t *testing.T) {
+	ev := Event{
+		Kind:      KindQuorumLost,
+		CheckType: CheckTypeCluster,
+		CheckName: "monitor-quorum",
+		Domain:    "prod",
+		Message:   "1 active monitors, quorum requires 2",
+	}
+	if got := summary(ev); got != "QUORUM LOST (prod): 1 active monitors, quorum requires 2" {
+		t.Fatalf("unexpected summary %q", got)
+	}
+
+	raw, err := buildWebhookPayload(cfg.WebhookConfig{Format: "pagerduty"}, ev)
+	if err != nil {
+		t.Fatalf("pagerduty payload: %v", err)
+	}
+	if !strings.Contains(string(raw), `"event_action":"trigger"`) {
+		t.Fatalf("expected quorum loss to trigger, got %s", raw)
+	}
+
+	ev.Kind = KindQuorumRestored
+	raw, _ = buildWebhookPayload(cfg.WebhookConfig{Format: "pagerduty"}, ev)
+	if !strings.Contains(string(raw), `"event_action":"resolve"`) {
+		t.Fatalf("expected quorum restore to resolve, got %s", raw)
+	}
+}
+
+func TestServiceRedundancySummary(t *testing.T) {
+	ev := Event{
+		Kind:      KindRedundancyLost,
+		CheckType: CheckTypeService,
+		CheckName: "redundancy",
+		Domain:    "polkadot",
+		Endpoint:  "eu",
+		Message:   "1 healthy providers of polkadot in eu, 2 required",
+	}
+	if got := summary(ev); got != "REDUNDANCY LOST (polkadot/eu): 1 healthy providers of polkadot in eu, 2 required" {
+		t.Fatalf("unexpected summary %q", got)
+	}
+	if !ev.Kind.IsProblem() || KindRedundancyRestored.IsProblem() {
+		t.Fatal("expected only the loss to open an incident")
+	}
+}
+
+func TestKindSeverity(t *testing.T) {
+	for kind, want := range map[Kind]Severity{
+		KindOffline:        SeverityCritical,
+		KindOnline:         SeverityCritical,
+		KindQuorumRestored: SeverityCritical,
+		KindClockSkew:      SeverityWarning,
+		KindUsageAnomaly:   SeverityWarning,
+		KindClusterChanged: SeverityInfo,
+	} {
+		if got := kind.Severity(); got != want {
+			t.Errorf("%s: expected %s, got %s", kind, want, got)
+		}
+	}
+
+	if s, err := ParseSeverity("Warning"); err != nil || s != SeverityWarning {
+		t.Fatalf("expected warning, got %v, %v", s, err)
+	}
+	if s, err := ParseSeverity(""); err != nil || s != SeverityInfo {
+		t.Fatalf("expected empty to be info, got %v, %v", s, err)
+	}
+	if _, err := ParseSeverity("urgent"); err == nil {
+		t.Fatal("expected an error for an unknown severity")
+	}
+}
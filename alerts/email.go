@@ -0,0 +1,366 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// EMAIL SINK
+// -----------------------------------------------------------------------------
+//
+// The email sink mails alerts through the SMTP relay of Alerts.email, for
+// deployments and members that do not follow the Matrix rooms. Recipients
+// are the deployment addresses in To, the addresses listed for the member in
+// Members and the email routes the member stored (see RoutesFor). Each
+// recipient gets its own messages, so members never see each other's
+// addresses. An outage flapping or a node losing many checks at once raises
+// alerts in quick succession, so the first alert for a recipient opens a
+// batch that collects everything for that recipient during BatchSeconds and
+// is then sent as one message.
+
+const (
+	defaultSMTPPort     = 587
+	defaultSMTPSPort    = 465
+	defaultEmailBatch   = 60 * time.Second
+	maxEmailBatchEvents = 100
+	smtpTimeout         = 30 * time.Second
+	defaultEmailSubject = `{{if eq .Count 1}}{{with index .Events 0}}{{or .Subject (printf "[IBP] %s" .Summary)}}{{end}}{{else}}[IBP] {{.Count}} alerts{{with .Member}} for {{.}}{{end}}{{end}}`
+	defaultEmailBody    = `{{range $i, $e := .Events}}{{if $i}}
+{{end}}{{if $e.Text}}{{$e.Text}}
+{{else}}{{$e.Summary}}
+
+{{with $e.Member}}Member:   {{.}}
+{{end}}Check:    {{$e.CheckType}} / {{$e.CheckName}}
+{{with $e.Domain}}Domain:   {{.}}
+{{end}}{{with $e.Endpoint}}Endpoint: {{.}}
+{{end}}{{if $e.Member}}IPv6:     {{$e.IPv6}}
+{{end}}{{with $e.Error}}Error:    {{.}}
+{{end}}{{with $e.Message}}Message:  {{.}}
+{{end}}{{with $e.Downtime}}Downtime: {{.}}
+{{end}}Time:     {{$e.Time.UTC.Format "2006-01-02T15:04:05Z07:00"}}
+{{end}}{{end}}`
+)
+
+// Supported values of EmailConfig.TLS.
+const (
+	EmailTLSOpportunistic = ""
+	EmailTLSStartTLS      = "starttls"
+	EmailTLSImplicit      = "tls"
+	EmailTLSNone          = "none"
+)
+
+// errNoStartTLS is returned when TLS is "starttls" and the relay does not
+// offer it.
+var errNoStartTLS = errors.New("relay does not offer STARTTLS")
+
+// sendMail sends one message through the relay of c; tests replace it.
+var sendMail = sendSMTP
+
+var headerReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// emailSink mails events to the recipients of EmailConfig and of the
+// members' routes.
+type emailSink struct{}
+
+func (emailSink) Name() string { return "email" }
+
+func (emailSink) Send(_ context.Context, ev Event) error {
+	c := cfg.GetConfig().Alerts.Email
+	if c.Host == "" {
+		return nil
+	}
+	for _, to := range emailRecipients(c, ev) {
+		emailBatches.add(to, ev, emailBatchWindow(c))
+	}
+	return nil
+}
+
+// emailRecipients returns the distinct addresses ev is mailed to.
+func emailRecipients(c cfg.EmailConfig, ev Event) []string {
+	var out []string
+	seen := make(map[string]bool)
+	add := func(list []string) {
+		for _, a := range list {
+			a = strings.TrimSpace(a)
+			if a == "" || seen[strings.ToLower(a)] {
+				continue
+			}
+			seen[strings.ToLower(a)] = true
+			out = append(out, a)
+		}
+	}
+	if matchesFilter(c.Filter, ev) {
+		add(c.To)
+	}
+	if isMemberEvent(ev) {
+		add(RoutesFor(ev.Member).Emails)
+	}
+	return out
+}
+
+func emailBatchWindow(c cfg.EmailConfig) time.Duration {
+	switch {
+	case c.BatchSeconds < 0:
+		return 0
+	case c.BatchSeconds == 0:
+		return defaultEmailBatch
+	}
+	return time.Duration(c.BatchSeconds) * time.Second
+}
+
+// -----------------------------------------------------------------------------
+// BATCHING
+// -----------------------------------------------------------------------------
+
+type emailBatcher struct {
+	mu      sync.Mutex
+	pending map[string]*emailBatch // recipient → open batch
+}
+
+type emailBatch struct {
+	events []Event
+	timer  *time.Timer
+}
+
+var emailBatches = &emailBatcher{pending: make(map[string]*emailBatch)}
+
+// add queues ev for to, opening a batch that is sent after window. A batch
+// that reaches maxEmailBatchEvents is sent at once.
+func (b *emailBatcher) add(to string, ev Event, window time.Duration) {
+	if window <= 0 {
+		go sendEmailBatch(to, []Event{ev})
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	batch, ok := b.pending[to]
+	if !ok {
+		batch = &emailBatch{}
+		b.pending[to] = batch
+		batch.timer = time.AfterFunc(window, func() { b.flush(to, batch) })
+	}
+	batch.events = append(batch.events, ev)
+	if len(batch.events) >= maxEmailBatchEvents {
+		batch.timer.Stop()
+		delete(b.pending, to)
+		go sendEmailBatch(to, batch.events)
+	}
+}
+
+// flush sends batch if it is still the open batch of to.
+func (b *emailBatcher) flush(to string, batch *emailBatch) {
+	b.mu.Lock()
+	if b.pending[to] != batch {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, to)
+	b.mu.Unlock()
+	sendEmailBatch(to, batch.events)
+}
+
+// FlushEmail sends all open email batches now and waits for them, e.g.
+// before shutting down.
+func FlushEmail() {
+	b := emailBatches
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[string]*emailBatch)
+	b.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for to, batch := range pending {
+		batch.timer.Stop()
+		wg.Add(1)
+		go func(to string, events []Event) {
+			defer wg.Done()
+			sendEmailBatch(to, events)
+		}(to, batch.events)
+	}
+	wg.Wait()
+}
+
+// sendEmailBatch mails events to to with the relay configured at the time
+// of sending.
+func sendEmailBatch(to string, events []Event) {
+	c := cfg.GetConfig().Alerts.Email
+	if c.Host == "" {
+		log.Log(log.Warn, "[alerts] email relay removed; %d alerts for %s dropped", len(events), to)
+		return
+	}
+	msg := emailMessage(c, to, events)
+	if err := sendMail(c, []string{to}, msg); err != nil {
+		log.Log(log.Error, "[alerts] email of %d alerts to %s failed: %v", len(events), to, err)
+		return
+	}
+	log.Log(log.Debug, "[alerts] emailed %d alerts to %s", len(events), to)
+}
+
+// -----------------------------------------------------------------------------
+// MESSAGES
+// -----------------------------------------------------------------------------
+
+// emailEvent is an event as seen by the subject and body templates, with
+// the subject and text of the shared alert templates when configured.
+type emailEvent struct {
+	TemplateData
+	Subject string
+	Text    string
+}
+
+// emailData is what the subject and body templates are rendered against.
+type emailData struct {
+	Recipient string
+	Member    string // the member of all events, if they share one
+	Count     int
+	Events    []emailEvent
+}
+
+func newEmailData(to string, events []Event) emailData {
+	d := emailData{Recipient: to, Count: len(events), Member: events[0].Member}
+	links := cfg.GetConfig().Alerts.Templates.Links
+	for _, ev := range events {
+		if ev.Member != d.Member {
+			d.Member = ""
+		}
+		e := emailEvent{TemplateData: NewTemplateData(ev, links)}
+		if msg, ok := Render(ev); ok {
+			e.Subject, e.Text = msg.Subject, msg.Text
+		}
+		d.Events = append(d.Events, e)
+	}
+	return d
+}
+
+// renderEmail renders text against d, falling back to fallback when text is
+// empty or fails, so a broken template never loses an alert.
+func renderEmail(name, text, fallback string, d emailData) string {
+	if text != "" {
+		var buf bytes.Buffer
+		tmpl, err := template.New(name).Parse(text)
+		if err == nil {
+			err = tmpl.Execute(&buf, d)
+		}
+		if err == nil {
+			return buf.String()
+		}
+		log.Log(log.Error, "[alerts] email %s template: %v; using the default", name, err)
+	}
+	var buf bytes.Buffer
+	_ = template.Must(template.New(name).Parse(fallback)).Execute(&buf, d)
+	return buf.String()
+}
+
+// emailMessage renders events for to as a plain text message.
+func emailMessage(c cfg.EmailConfig, to string, events []Event) []byte {
+	d := newEmailData(to, events)
+	subject := renderEmail("subject", c.Subject, defaultEmailSubject, d)
+	body := renderEmail("body", c.Body, defaultEmailBody, d)
+	date := events[len(events)-1].Time
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", headerReplacer.Replace(c.From))
+	fmt.Fprintf(&b, "To: %s\r\n", headerReplacer.Replace(to))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerReplacer.Replace(strings.TrimSpace(subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// -----------------------------------------------------------------------------
+// SMTP
+// -----------------------------------------------------------------------------
+
+// sendSMTP delivers msg to the recipients in to through the relay of c.
+func sendSMTP(c cfg.EmailConfig, to []string, msg []byte) error {
+	mode := strings.ToLower(c.TLS)
+	port := c.Port
+	if port <= 0 {
+		port = defaultSMTPPort
+		if mode == EmailTLSImplicit {
+			port = defaultSMTPSPort
+		}
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: c.Host, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch mode {
+	case EmailTLSImplicit:
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	case EmailTLSOpportunistic, EmailTLSStartTLS, EmailTLSNone:
+		conn, err = dialer.Dial("tcp", addr)
+	default:
+		return fmt.Errorf("unsupported tls mode %q", c.TLS)
+	}
+	if err != nil {
+		return fmt.Errorf("connect %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("greeting from %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if mode == EmailTLSOpportunistic || mode == EmailTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("starttls: %w", err)
+			}
+		} else if mode == EmailTLSStartTLS {
+			return errNoStartTLS
+		}
+	}
+	if c.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := client.Mail(c.From); err != nil {
+		return fmt.Errorf("mail from: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("rcpt %s: %w", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		w.Close()
+		return fmt.Errorf("data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("data: %w", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,200 @@
+package alerts
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+type sentEmail struct {
+	to  []string
+	msg string
+}
+
+func captureEmail(t *testing.T) func() []sentEmail {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		sent []sentEmail
+	)
+	orig := sendMail
+	sendMail = func(_ cfg.EmailConfig, to []string, msg []byte) error {
+		mu.Lock()
+		sent = append(sent, sentEmail{to, string(msg)})
+		mu.Unlock()
+		return nil
+	}
+	t.Cleanup(func() { sendMail = orig })
+	return func() []sentEmail {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]sentEmail(nil), sent...)
+	}
+}
+
+func TestEmailSinkBatchesPerRecipient(t *testing.T) {
+	sent := captureEmail(t)
+	c := cfg.Config{}
+	c.Alerts.Email = cfg.EmailConfig{Host: "smtp.example.org", From: "alerts@example.org", To: []string{"ops@example.org"}}
+	prev := cfg.SetConfig(c)
+	t.Cleanup(func() {
+		cfg.SetConfig(prev)
+		SetRouteSource(nil)
+	})
+	SetRouteSource(func(member string) (MemberRoutes, bool) {
+		return MemberRoutes{Emails: []string{"noc@example.org", "OPS@example.org"}}, member == "provider1"
+	})
+
+	first, second := testEvent(), testEvent()
+	second.CheckName = "https"
+	cluster := Event{Kind: KindQuorumLost, CheckType: CheckTypeCluster, CheckName: "quorum", Message: "2 of 5 nodes"}
+	for _, ev := range []Event{first, second, cluster} {
+		if err := (emailSink{}).Send(context.Background(), ev); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	if got := sent(); len(got) != 0 {
+		t.Fatalf("expected alerts to wait for the batch window, got %d emails", len(got))
+	}
+
+	FlushEmail()
+	byRecipient := make(map[string]string)
+	for _, e := range sent() {
+		byRecipient[strings.Join(e.to, ",")] = e.msg
+	}
+	if len(byRecipient) != 2 {
+		t.Fatalf("expected one email per recipient, got %v", byRecipient)
+	}
+	if msg := byRecipient["ops@example.org"]; !strings.Contains(msg, "Subject: [IBP] 3 alerts\r\n") ||
+		!strings.Contains(msg, "QUORUM LOST: 2 of 5 nodes") {
+		t.Fatalf("unexpected operator email:\n%s", msg)
+	}
+	if msg := byRecipient["noc@example.org"]; !strings.Contains(msg, "Subject: [IBP] 2 alerts for provider1\r\n") ||
+		strings.Contains(msg, "QUORUM") || !strings.Contains(msg, "Check:    endpoint / https\r\n") {
+		t.Fatalf("unexpected member email:\n%s", msg)
+	}
+}
+
+func TestEmailSinkSendsAtOnceWithoutBatching(t *testing.T) {
+	sent := captureEmail(t)
+	c := cfg.Config{}
+	c.Alerts.Email = cfg.EmailConfig{Host: "smtp.example.org", BatchSeconds: -1, Members: map[string][]string{"provider1": {"noc@example.org"}}}
+	prev := cfg.SetConfig(c)
+	t.Cleanup(func() { cfg.SetConfig(prev) })
+
+	if err := (emailSink{}).Send(context.Background(), testEvent()); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := sent()
+	if len(got) != 1 || !strings.Contains(got[0].msg, "Subject: [IBP] OFFLINE: provider1 endpoint/wss") {
+		t.Fatalf("expected one email for the configured member address, got %+v", got)
+	}
+}
+
+func TestEmailMessageTemplates(t *testing.T) {
+	c := cfg.EmailConfig{
+		From:    "alerts@example.org",
+		Subject: "{{.Count}} x {{(index .Events 0).Kind}}\nBcc: x@example.org",
+		Body:    "{{.Missing",
+	}
+	msg := string(emailMessage(c, "noc@example.org", []Event{testEvent()}))
+	if !strings.Contains(msg, "Subject: 1 x offline Bcc: x@example.org\r\n") {
+		t.Fatalf("expected the rendered subject on one header line:\n%s", msg)
+	}
+	if !strings.Contains(msg, "Error:    timeout\r\n") || strings.Contains(msg, "\r\r") {
+		t.Fatalf("expected the default body after a broken template:\n%s", msg)
+	}
+}
+
+// fakeSMTP serves one SMTP session, offering STARTTLS when starttls is set,
+// and returns the listener address and the received DATA.
+func fakeSMTP(t *testing.T, starttls bool) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	data := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				if starttls {
+					reply("250-fake\r\n250 STARTTLS")
+				} else {
+					reply("250 fake")
+				}
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var b strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					b.WriteString(l)
+				}
+				data <- b.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), data
+}
+
+func TestSendSMTP(t *testing.T) {
+	addr, data := fakeSMTP(t, false)
+	host, port, _ := net.SplitHostPort(addr)
+	c := cfg.EmailConfig{Host: host, TLS: EmailTLSNone, From: "alerts@example.org"}
+	c.Port, _ = strconv.Atoi(port)
+
+	if err := sendSMTP(c, []string{"noc@example.org"}, []byte("Subject: hi\r\n\r\nbody\r\n")); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	select {
+	case got := <-data:
+		if got != "Subject: hi\r\n\r\nbody\r\n" {
+			t.Fatalf("unexpected data %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no data received")
+	}
+
+	addr, _ = fakeSMTP(t, false)
+	host, port, _ = net.SplitHostPort(addr)
+	c = cfg.EmailConfig{Host: host, TLS: EmailTLSStartTLS, From: "alerts@example.org"}
+	c.Port, _ = strconv.Atoi(port)
+	if err := sendSMTP(c, []string{"noc@example.org"}, []byte("x")); !errors.Is(err, errNoStartTLS) {
+		t.Fatalf("expected errNoStartTLS from a relay without STARTTLS, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+// -----------------------------------------------------------------------------
+// MEMBER ROUTES
+// -----------------------------------------------------------------------------
+//
+// Alerts about a member mention its people in Matrix and, when the member
+// asked for it, also go to its own webhooks and email addresses. Members
+// keep these routes themselves in a preferences store, which registers with
+// SetRouteSource; members without stored routes fall back to the Matrix
+// mentions of Alerts.matrix.members and the addresses of
+// Alerts.email.members.
+
+// Limits of MemberRoutes.Validate.
+const (
+	maxRoutesPerKind = 10
+	maxRouteLength   = 512
+)
+
+// ErrInvalidRoutes is returned by MemberRoutes.Validate.
+var ErrInvalidRoutes = errors.New("invalid notification routes")
+
+// MemberRoutes are where the alerts of one member go.
+type MemberRoutes struct {
+	Matrix   []string `json:"matrix"`   // user IDs mentioned in the alert room, e.g. @ops:example.org
+	Webhooks []string `json:"webhooks"` // https URLs receiving the json payload
+	Emails   []string `json:"emails"`
+}
+
+// Validate checks that r has at most ten routes of each kind, Matrix user
+// IDs of the form @user:server, https webhook URLs with a host name and
+// plain email addresses. Webhook hosts may not be IP literals or localhost,
+// since the collator posts to them from inside the operator network.
+func (r MemberRoutes) Validate() error {
+	for kind, list := range map[string][]string{"matrix": r.Matrix, "webhooks": r.Webhooks, "emails": r.Emails} {
+		if len(list) > maxRoutesPerKind {
+			return fmt.Errorf("%w: more than %d %s", ErrInvalidRoutes, maxRoutesPerKind, kind)
+		}
+		for _, v := range list {
+			if len(v) > maxRouteLength {
+				return fmt.Errorf("%w: %s entry longer than %d characters", ErrInvalidRoutes, kind, maxRouteLength)
+			}
+		}
+	}
+	for _, id := range r.Matrix {
+		user, server, ok := strings.Cut(strings.TrimPrefix(id, "@"), ":")
+		if !strings.HasPrefix(id, "@") || !ok || user == "" || server == "" || strings.ContainsAny(id, " \t\r\n") {
+			return fmt.Errorf("%w: %q is not a Matrix user ID", ErrInvalidRoutes, id)
+		}
+	}
+	for _, raw := range r.Webhooks {
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+			return fmt.Errorf("%w: %q is not an https URL", ErrInvalidRoutes, raw)
+		}
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		if _, err := netip.ParseAddr(host); err == nil || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return fmt.Errorf("%w: %q must name a public host", ErrInvalidRoutes, raw)
+		}
+	}
+	for _, e := range r.Emails {
+		a, err := mail.ParseAddress(e)
+		if err != nil || a.Name != "" || a.Address != e {
+			return fmt.Errorf("%w: %q is not an email address", ErrInvalidRoutes, e)
+		}
+	}
+	return nil
+}
+
+// RouteSource returns the stored routes of member; ok is false when the
+// member has none.
+type RouteSource func(member string) (routes MemberRoutes, ok bool)
+
+var routeSource atomic.Pointer[RouteSource]
+
+// SetRouteSource makes RoutesFor consult src before the config; nil
+// removes it.
+func SetRouteSource(src RouteSource) {
+	if src == nil {
+		routeSource.Store(nil)
+		return
+	}
+	routeSource.Store(&src)
+}
+
+// RoutesFor returns where the alerts of member go: its stored routes when it
+// has any, otherwise its Alerts.matrix.members mentions and
+// Alerts.email.members addresses.
+func RoutesFor(member string) MemberRoutes {
+	if src := routeSource.Load(); src != nil {
+		if r, ok := (*src)(member); ok {
+			return r
+		}
+	}
+	c := cfg.GetConfig().Alerts
+	return MemberRoutes{
+		Matrix: c.Matrix.Members[strings.ToLower(member)],
+		Emails: c.Email.Members[strings.ToLower(member)],
+	}
+}
+
+// isMemberEvent reports whether ev concerns a member rather than the
+// cluster, a service or usage.
+func isMemberEvent(ev Event) bool {
+	switch ev.CheckType {
+	case CheckTypeCluster, CheckTypeService, CheckTypeUsage:
+		return false
+	}
+	return ev.Member != ""
+}
+
+// memberRouteSink delivers member events to the webhooks of the member's
+// routes. Matrix mentions are added by the Matrix sink and emails sent by
+// emailSink. Deliveries run in the background like those of webhookSink,
+// but through memberWebhookClient.
+type memberRouteSink struct{}
+
+func (memberRouteSink) Name() string { return "member-routes" }
+
+func (memberRouteSink) Send(_ context.Context, ev Event) error {
+	if !isMemberEvent(ev) {
+		return nil
+	}
+	routes := RoutesFor(ev.Member)
+	if len(routes.Webhooks) > 0 {
+		ev.Votes = nil
+		payload, err := buildWebhookPayload(cfg.WebhookConfig{}, ev)
+		if err != nil {
+			return err
+		}
+		for _, u := range routes.Webhooks {
+			go deliverWebhook(memberWebhookClient, cfg.WebhookConfig{Name: "member " + ev.Member, URL: u}, payload)
+		}
+	}
+	return nil
+}
+
+// errNonPublicAddr is returned when a member webhook resolves to an address
+// inside the operator network.
+var errNonPublicAddr = errors.New("webhook host resolves to a non-public address")
+
+// memberWebhookClient posts member webhooks. Members choose those URLs, so
+// its dialer refuses loopback, private, link-local and other non-public
+// addresses after DNS resolution, for redirects too, and it never uses a
+// proxy, which would resolve the host instead.
+var memberWebhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: refuseNonPublic,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// refuseNonPublic is a net.Dialer Control function that fails for
+// addresses isPublicAddr rejects.
+func refuseNonPublic(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errNonPublicAddr, address)
+	}
+	if !isPublicAddr(ap.Addr()) {
+		return fmt.Errorf("%w: %s", errNonPublicAddr, ap.Addr())
+	}
+	return nil
+}
+
+// sharedAddrSpace is the carrier-grade NAT range of RFC 6598.
+var sharedAddrSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// isPublicAddr reports whether a is a globally routable unicast address.
+func isPublicAddr(a netip.Addr) bool {
+	a = a.Unmap()
+	return a.IsGlobalUnicast() && !a.IsPrivate() && !sharedAddrSpace.Contains(a)
+}
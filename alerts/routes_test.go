@@ -0,0 +1,149 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func TestMemberRoutesValidate(t *testing.T) {
+	ok := MemberRoutes{
+		Matrix:   []string{"@ops:example.org"},
+		Webhooks: []string{"https://hooks.example.org/ibp"},
+		Emails:   []string{"noc@example.org"},
+	}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("expected valid routes, got %v", err)
+	}
+	for _, bad := range []MemberRoutes{
+		{Matrix: []string{"ops"}},
+		{Matrix: []string{"@ops"}},
+		{Webhooks: []string{"http://hooks.example.org"}},
+		{Webhooks: []string{"https:///path"}},
+		{Webhooks: []string{"https://127.0.0.1/hook"}},
+		{Webhooks: []string{"https://[::1]:8443/hook"}},
+		{Webhooks: []string{"https://10.0.0.5/hook"}},
+		{Webhooks: []string{"https://169.254.169.254/latest/meta-data"}},
+		{Webhooks: []string{"https://8.8.8.8/hook"}},
+		{Webhooks: []string{"https://localhost/hook"}},
+		{Webhooks: []string{"https://admin.localhost./hook"}},
+		{Emails: []string{"Ops <noc@example.org>"}},
+		{Emails: []string{"noc@example.org\r\nBcc: x@example.org"}},
+		{Emails: make([]string, maxRoutesPerKind+1)},
+	} {
+		if err := bad.Validate(); !errors.Is(err, ErrInvalidRoutes) {
+			t.Errorf("%+v: expected ErrInvalidRoutes, got %v", bad, err)
+		}
+	}
+}
+
+func TestRoutesForPrefersStoredRoutes(t *testing.T) {
+	c := cfg.Config{}
+	c.Alerts.Matrix.Members = map[string][]string{"provider1": {"@config:example.org"}}
+	c.Alerts.Email.Members = map[string][]string{"provider1": {"config@example.org"}}
+	prev := cfg.SetConfig(c)
+	t.Cleanup(func() {
+		cfg.SetConfig(prev)
+		SetRouteSource(nil)
+	})
+
+	if got := RoutesFor("Provider1"); len(got.Matrix) != 1 || got.Matrix[0] != "@config:example.org" ||
+		len(got.Emails) != 1 || got.Emails[0] != "config@example.org" {
+		t.Fatalf("expected the config routes without stored routes, got %+v", got)
+	}
+
+	SetRouteSource(func(member string) (MemberRoutes, bool) {
+		return MemberRoutes{Emails: []string{"noc@example.org"}}, member == "provider1"
+	})
+	if got := RoutesFor("provider1"); len(got.Matrix) != 0 || len(got.Emails) != 1 {
+		t.Fatalf("expected stored routes to replace the config, got %+v", got)
+	}
+	if got := RoutesFor("provider2"); got.Matrix != nil {
+		t.Fatalf("expected no routes for provider2, got %+v", got)
+	}
+}
+
+func TestMemberRouteSinkDeliversWebhooks(t *testing.T) {
+	hits := make(chan string, 1)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits <- r.URL.Path
+	}))
+	defer srv.Close()
+
+	origClient := memberWebhookClient
+	memberWebhookClient = srv.Client()
+	memberWebhookClient.Timeout = 5 * time.Second
+	t.Cleanup(func() {
+		memberWebhookClient = origClient
+		SetRouteSource(nil)
+	})
+	SetRouteSource(func(string) (MemberRoutes, bool) {
+		return MemberRoutes{Webhooks: []string{srv.URL + "/member"}}, true
+	})
+
+	ev := testEvent()
+	if err := (memberRouteSink{}).Send(context.Background(), ev); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	select {
+	case path := <-hits:
+		if path != "/member" {
+			t.Fatalf("unexpected webhook path %q", path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+
+	// Cluster events are not member events.
+	ev.CheckType = CheckTypeCluster
+	if err := (memberRouteSink{}).Send(context.Background(), ev); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	select {
+	case path := <-hits:
+		t.Fatalf("unexpected delivery of a cluster event to %q", path)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMemberWebhookClientRefusesNonPublicAddresses(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("expected no request to reach a loopback server")
+	}))
+	defer srv.Close()
+
+	// A host name resolving to loopback passes Validate; the dialer stops it.
+	u := strings.Replace(srv.URL, "127.0.0.1", "localtest.invalid", 1)
+	client := *memberWebhookClient
+	transport := memberWebhookClient.Transport.(*http.Transport).Clone()
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, port, _ := net.SplitHostPort(addr)
+		return dial(ctx, network, net.JoinHostPort("127.0.0.1", port))
+	}
+	client.Transport = transport
+
+	_, err := postWebhook(&client, cfg.WebhookConfig{URL: u}, []byte(`{}`))
+	if !errors.Is(err, errNonPublicAddr) {
+		t.Fatalf("expected errNonPublicAddr, got %v", err)
+	}
+
+	for addr, want := range map[string]bool{
+		"93.184.216.34": true, "2606:2800:220:1::1": true,
+		"127.0.0.1": false, "10.1.2.3": false, "172.16.0.1": false, "192.168.1.1": false,
+		"169.254.169.254": false, "100.64.0.1": false, "::1": false, "fe80::1": false,
+		"fd00::1": false, "::ffff:10.0.0.1": false, "0.0.0.0": false,
+	} {
+		if got := isPublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package alerts
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// MESSAGE TEMPLATES
+// -----------------------------------------------------------------------------
+//
+// Alerts.templates replaces the built-in wording of every sink: Matrix,
+// email, and the slack, telegram and pagerduty webhook formats. A template
+// is chosen by event kind, falling back to "default", and each of its parts
+// (subject, text, HTML) is optional, so a deployment can restyle one kind
+// of alert or one part without rewriting the rest. Templates see the event,
+// how long its outage lasted and the configured dashboard links.
+
+// TemplateDefault is the name of the template used for kinds without one.
+const TemplateDefault = "default"
+
+// Message is an alert rendered by the configured templates. Empty parts have
+// no template; sinks use their built-in format for them.
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// TemplateData is what alert templates are rendered against.
+type TemplateData struct {
+	Event
+	Summary  string            // the one-line built-in description
+	Severity string            // info, warning or critical
+	Duration time.Duration     // time since the outage started, zero if unknown
+	Downtime string            // Duration as e.g. "1d 4h 12m", empty if unknown
+	Links    map[string]string // rendered Alerts.templates.links
+}
+
+var templateFuncs = map[string]any{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"join":     strings.Join,
+	"duration": FormatDuration,
+	"utc": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+}
+
+// Render renders ev with the template configured for its kind, or the
+// default template; ok is false when neither exists.
+func Render(ev Event) (msg Message, ok bool) {
+	t := cfg.GetConfig().Alerts.Templates
+	tmpl, ok := t.Messages[string(ev.Kind)]
+	if !ok {
+		tmpl, ok = t.Messages[TemplateDefault]
+	}
+	if !ok {
+		return Message{}, false
+	}
+
+	data := NewTemplateData(ev, t.Links)
+	name := string(ev.Kind)
+	return Message{
+		Subject: strings.TrimSpace(renderText(name+" subject", tmpl.Subject, data)),
+		Text:    renderText(name+" text", tmpl.Text, data),
+		HTML:    renderHTML(name+" html", tmpl.HTML, data),
+	}, true
+}
+
+// renderedText returns the templated text of ev, or its summary.
+func renderedText(ev Event) string {
+	if msg, ok := Render(ev); ok && msg.Text != "" {
+		return msg.Text
+	}
+	return summary(ev)
+}
+
+// renderedSubject returns the templated subject of ev, or its summary.
+func renderedSubject(ev Event) string {
+	if msg, ok := Render(ev); ok && msg.Subject != "" {
+		return msg.Subject
+	}
+	return summary(ev)
+}
+
+// NewTemplateData returns the template data of ev, with links rendered
+// from the URL templates in links.
+func NewTemplateData(ev Event, links map[string]string) TemplateData {
+	d := TemplateData{Event: ev, Summary: summary(ev), Severity: ev.Kind.Severity().String()}
+	if !ev.Started.IsZero() {
+		end := ev.Time
+		if end.IsZero() {
+			end = time.Now()
+		}
+		if d.Duration = end.Sub(ev.Started); d.Duration < 0 {
+			d.Duration = 0
+		}
+		d.Downtime = FormatDuration(d.Duration)
+	}
+	if len(links) > 0 {
+		d.Links = make(map[string]string, len(links))
+		for name, link := range links {
+			d.Links[name] = renderText("link "+name, link, d)
+		}
+	}
+	return d
+}
+
+// renderText renders a text/template; a failing template is logged and
+// renders empty, so the sink falls back to its built-in format.
+func renderText(name, text string, data any) string {
+	if text == "" {
+		return ""
+	}
+	var buf bytes.Buffer
+	tmpl, err := parsedText(text)
+	if err == nil {
+		err = tmpl.Execute(&buf, data)
+	}
+	if err != nil {
+		log.Log(log.Error, "[alerts] template %s: %v", name, err)
+		return ""
+	}
+	return buf.String()
+}
+
+// renderHTML is renderText for html/templates, which escape the event
+// fields.
+func renderHTML(name, text string, data any) string {
+	if text == "" {
+		return ""
+	}
+	var buf bytes.Buffer
+	tmpl, err := parsedHTML(text)
+	if err == nil {
+		err = tmpl.Execute(&buf, data)
+	}
+	if err != nil {
+		log.Log(log.Error, "[alerts] template %s: %v", name, err)
+		return ""
+	}
+	return buf.String()
+}
+
+// Parsed templates by source, since the same few are rendered for every
+// alert; a config reload only adds entries for changed sources.
+var (
+	parsedMu    sync.Mutex
+	parsedTexts = make(map[string]*template.Template)
+	parsedHTMLs = make(map[string]*htmltemplate.Template)
+)
+
+func parsedText(text string) (*template.Template, error) {
+	parsedMu.Lock()
+	defer parsedMu.Unlock()
+	if t, ok := parsedTexts[text]; ok {
+		return t, nil
+	}
+	t, err := template.New("alert").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	parsedTexts[text] = t
+	return t, nil
+}
+
+func parsedHTML(text string) (*htmltemplate.Template, error) {
+	parsedMu.Lock()
+	defer parsedMu.Unlock()
+	if t, ok := parsedHTMLs[text]; ok {
+		return t, nil
+	}
+	t, err := htmltemplate.New("alert").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	parsedHTMLs[text] = t
+	return t, nil
+}
+
+// FormatDuration renders d as e.g. "1d 4h 12m", or "<1m".
+func FormatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return "<1m"
+	}
+	d = d.Truncate(time.Minute)
+	days := int(d / (24 * time.Hour))
+	d -= time.Duration(days) * 24 * time.Hour
+	hours := int(d / time.Hour)
+	d -= time.Duration(hours) * time.Hour
+	minutes := int(d / time.Minute)
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// OUTAGE START TIMES
+// -----------------------------------------------------------------------------
+
+var (
+	startedMu sync.Mutex
+	started   = make(map[string]time.Time) // Event.Key → time the problem was raised
+)
+
+// trackStart sets ev.Started, unless the caller did: problems remember when
+// they were first raised, and repeats and resolutions carry that time.
+// Usage anomalies and cluster changes have no resolution and are not
+// tracked.
+func trackStart(ev *Event) {
+	if !ev.Started.IsZero() || ev.Kind == KindUsageAnomaly || ev.Kind == KindClusterChanged {
+		return
+	}
+	key := ev.Key()
+	startedMu.Lock()
+	defer startedMu.Unlock()
+	if ev.Kind.IsProblem() {
+		if t, ok := started[key]; ok {
+			ev.Started = t
+			return
+		}
+		started[key] = ev.Time
+		return
+	}
+	if t, ok := started[key]; ok {
+		ev.Started = t
+		delete(started, key)
+	}
+}
@@ -0,0 +1,143 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func withTemplates(t *testing.T, tmpl cfg.AlertTemplates) {
+	t.Helper()
+	c := cfg.Config{}
+	c.Alerts.Templates = tmpl
+	prev := cfg.SetConfig(c)
+	t.Cleanup(func() { cfg.SetConfig(prev) })
+}
+
+func TestRenderChoosesKindThenDefault(t *testing.T) {
+	withTemplates(t, cfg.AlertTemplates{
+		Messages: map[string]cfg.AlertTemplate{
+			"offline": {
+				Subject: "{{.Member | upper}} down",
+				Text:    "{{.Member}} {{.CheckName}}: {{.Error}}\n{{.Links.dashboard}}",
+				HTML:    "<b>{{.Member}}</b> {{.Error}}",
+			},
+			TemplateDefault: {Text: "{{.Severity}}: {{.Summary}}"},
+		},
+		Links: map[string]string{"dashboard": "https://dash.example.org/members/{{.Member | urlquery}}"},
+	})
+
+	ev := testEvent()
+	ev.Error = "<timeout>"
+	msg, ok := Render(ev)
+	if !ok {
+		t.Fatal("expected a template for offline events")
+	}
+	if msg.Subject != "PROVIDER1 down" {
+		t.Fatalf("unexpected subject %q", msg.Subject)
+	}
+	if msg.Text != "provider1 wss: <timeout>\nhttps://dash.example.org/members/provider1" {
+		t.Fatalf("unexpected text %q", msg.Text)
+	}
+	if msg.HTML != "<b>provider1</b> &lt;timeout&gt;" {
+		t.Fatalf("expected escaped HTML, got %q", msg.HTML)
+	}
+
+	msg, _ = Render(Event{Kind: KindClockSkew, CheckType: CheckTypeCluster, Message: "node-b 3s ahead"})
+	if msg.Text != "warning: CLOCK SKEW: node-b 3s ahead" || msg.Subject != "" || msg.HTML != "" {
+		t.Fatalf("expected the default template, got %+v", msg)
+	}
+
+	withTemplates(t, cfg.AlertTemplates{})
+	if _, ok := Render(ev); ok {
+		t.Fatal("expected no template without configuration")
+	}
+}
+
+func TestRenderFallsBackOnBrokenTemplate(t *testing.T) {
+	withTemplates(t, cfg.AlertTemplates{Messages: map[string]cfg.AlertTemplate{
+		"offline": {Text: "{{.Nope}}", Subject: "{{.Member"},
+	}})
+	msg, ok := Render(testEvent())
+	if !ok || msg.Text != "" || msg.Subject != "" {
+		t.Fatalf("expected broken parts to render empty, got %+v", msg)
+	}
+	if got := renderedText(testEvent()); got != summary(testEvent()) {
+		t.Fatalf("expected the summary for a broken text template, got %q", got)
+	}
+}
+
+func TestWebhookFormatsUseTemplates(t *testing.T) {
+	withTemplates(t, cfg.AlertTemplates{Messages: map[string]cfg.AlertTemplate{
+		TemplateDefault: {Subject: "short {{.Member}}", Text: "long {{.Member}}"},
+	}})
+	raw, err := buildWebhookPayload(cfg.WebhookConfig{Format: "slack"}, testEvent())
+	if err != nil || string(raw) != `{"text":"long provider1"}` {
+		t.Fatalf("unexpected slack payload %s (%v)", raw, err)
+	}
+	raw, err = buildWebhookPayload(cfg.WebhookConfig{Format: "pagerduty"}, testEvent())
+	if err != nil {
+		t.Fatalf("pagerduty payload: %v", err)
+	}
+	var pd struct {
+		Payload struct {
+			Summary string `json:"summary"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(raw, &pd); err != nil || pd.Payload.Summary != "short provider1" {
+		t.Fatalf("expected the subject as PagerDuty summary, got %s", raw)
+	}
+}
+
+type captureSink struct{ events chan Event }
+
+func (captureSink) Name() string { return "capture" }
+
+func (s captureSink) Send(_ context.Context, ev Event) error {
+	s.events <- ev
+	return nil
+}
+
+func TestDispatchTracksOutageStart(t *testing.T) {
+	sink := captureSink{events: make(chan Event, 3)}
+	RegisterSink(sink)
+	t.Cleanup(func() { UnregisterSink(sink.Name()) })
+
+	down := testEvent()
+	up := down
+	up.Kind, up.Time = KindOnline, down.Time.Add(90*time.Minute)
+	for _, ev := range []Event{down, up, up} {
+		Dispatch(ev)
+	}
+
+	if ev := <-sink.events; !ev.Started.IsZero() {
+		t.Fatalf("expected no start on the first offline event, got %v", ev.Started)
+	}
+	ev := <-sink.events
+	if !ev.Started.Equal(down.Time) {
+		t.Fatalf("expected the online event to carry the outage start, got %v", ev.Started)
+	}
+	if d := NewTemplateData(ev, nil); d.Downtime != "1h 30m" || d.Duration != 90*time.Minute {
+		t.Fatalf("unexpected downtime %q (%v)", d.Downtime, d.Duration)
+	}
+	if ev := <-sink.events; !ev.Started.IsZero() {
+		t.Fatalf("expected the start to be released by the resolution, got %v", ev.Started)
+	}
+}
+
+func TestEmailUsesTemplates(t *testing.T) {
+	withTemplates(t, cfg.AlertTemplates{Messages: map[string]cfg.AlertTemplate{
+		"offline": {Subject: "{{.Member}} is down", Text: "{{.Member}} lost {{.CheckName}}"},
+	}})
+	msg := string(emailMessage(cfg.EmailConfig{From: "alerts@example.org"}, "noc@example.org", []Event{testEvent()}))
+	if !strings.Contains(msg, "Subject: provider1 is down\r\n") || !strings.Contains(msg, "\r\n\r\nprovider1 lost wss\r\n") {
+		t.Fatalf("expected the templated subject and text:\n%s", msg)
+	}
+	if strings.Contains(msg, "Check:") {
+		t.Fatalf("expected the templated text to replace the default block:\n%s", msg)
+	}
+}
@@ -0,0 +1,240 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+const (
+	defaultWebhookRetries = 3
+
+	// SignatureHeader carries the hex HMAC-SHA256 of the request body when a
+	// webhook secret is configured.
+	SignatureHeader = "X-IBP-Signature-256"
+)
+
+var (
+	webhookClient  = &http.Client{Timeout: 10 * time.Second}
+	webhookBackoff = 2 * time.Second
+)
+
+// webhookSink fans events out to every webhook listed in AlertsConfig.
+// Deliveries run in the background so retries never block the dispatcher.
+type webhookSink struct{}
+
+func (webhookSink) Name() string { return "webhook" }
+
+func (webhookSink) Send(_ context.Context, ev Event) error {
+	hooks := cfg.GetConfig().Alerts.Webhooks
+	for _, hook := range hooks {
+		if hook.URL == "" || !matchesFilter(hook.Filter, ev) {
+			continue
+		}
+		payload, err := buildWebhookPayload(hook, ev)
+		if err != nil {
+			log.Log(log.Error, "[alerts] webhook %s: %v", webhookName(hook), err)
+			continue
+		}
+		go deliverWebhook(webhookClient, hook, payload)
+	}
+	return nil
+}
+
+func webhookName(hook cfg.WebhookConfig) string {
+	if hook.Name != "" {
+		return hook.Name
+	}
+	return hook.URL
+}
+
+// matchesFilter reports whether ev passes every non-empty filter list.
+func matchesFilter(f cfg.AlertFilter, ev Event) bool {
+	return matchesAny(f.Members, ev.Member) &&
+		matchesAny(f.CheckTypes, ev.CheckType) &&
+		matchesAny(f.Events, string(ev.Kind))
+}
+
+func matchesAny(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
+// PAYLOADS
+// -----------------------------------------------------------------------------
+
+// summary renders a one-line human readable description of ev.
+func summary(ev Event) string {
+	if ev.CheckType == CheckTypeCluster || ev.CheckType == CheckTypeService || ev.CheckType == CheckTypeUsage {
+		s := strings.ToUpper(strings.ReplaceAll(string(ev.Kind), "_", " "))
+		if ev.Domain != "" {
+			scope := ev.Domain
+			if ev.Endpoint != "" {
+				scope += "/" + ev.Endpoint
+			}
+			s += " (" + scope + ")"
+		}
+		return s + ": " + ev.Message
+	}
+
+	status := "ONLINE"
+	if ev.Kind == KindOffline {
+		status = "OFFLINE"
+	}
+	s := fmt.Sprintf("%s: %s %s/%s", status, ev.Member, ev.CheckType, ev.CheckName)
+	if ev.Domain != "" {
+		s += " " + ev.Domain
+	}
+	if ev.Endpoint != "" {
+		s += " " + ev.Endpoint
+	}
+	if ev.IPv6 {
+		s += " (IPv6)"
+	}
+	if ev.Error != "" {
+		s += " – " + ev.Error
+	}
+	return s
+}
+
+func buildWebhookPayload(hook cfg.WebhookConfig, ev Event) ([]byte, error) {
+	if hook.Template != "" {
+		tmpl, err := template.New(webhookName(hook)).Parse(hook.Template)
+		if err != nil {
+			return nil, fmt.Errorf("parse template: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, struct {
+			Event
+			Summary string
+		}{ev, summary(ev)}); err != nil {
+			return nil, fmt.Errorf("render template: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	var body interface{}
+	switch strings.ToLower(hook.Format) {
+	case "", "json":
+		body = ev
+	case "slack":
+		body = map[string]string{"text": renderedText(ev)}
+	case "telegram":
+		body = map[string]string{"chat_id": hook.ChatID, "text": renderedText(ev)}
+	case "pagerduty":
+		action := "resolve"
+		if ev.Kind.IsProblem() {
+			action = "trigger"
+		}
+		body = map[string]interface{}{
+			"routing_key":  hook.RoutingKey,
+			"event_action": action,
+			"dedup_key":    ev.Key(),
+			"payload": map[string]interface{}{
+				"summary":        renderedSubject(ev),
+				"source":         ev.Member,
+				"severity":       "error",
+				"timestamp":      ev.Time.Format(time.RFC3339),
+				"custom_details": ev,
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported webhook format %q", hook.Format)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal payload: %w", err)
+	}
+	return data, nil
+}
+
+// signPayload returns the hex HMAC-SHA256 of payload under secret.
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// -----------------------------------------------------------------------------
+// DELIVERY
+// -----------------------------------------------------------------------------
+
+// deliverWebhook posts payload to hook with client, retrying failures worth
+// another try with exponential backoff.
+func deliverWebhook(client *http.Client, hook cfg.WebhookConfig, payload []byte) {
+	retries := hook.MaxRetries
+	if retries <= 0 {
+		retries = defaultWebhookRetries
+	}
+
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(webhookBackoff * time.Duration(1<<uint(attempt-1)))
+		}
+
+		var retryable bool
+		retryable, err = postWebhook(client, hook, payload)
+		if err == nil {
+			return
+		}
+		if !retryable {
+			break
+		}
+		log.Log(log.Debug, "[alerts] webhook %s attempt %d failed: %v", webhookName(hook), attempt+1, err)
+	}
+	log.Log(log.Error, "[alerts] webhook %s delivery failed: %v", webhookName(hook), err)
+}
+
+// postWebhook performs a single delivery attempt. retryable reports whether a
+// failure is worth retrying (network errors, 429 and 5xx responses).
+func postWebhook(client *http.Client, hook cfg.WebhookConfig, payload []byte) (retryable bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+signPayload(hook.Secret, payload))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("unexpected status %s", resp.Status)
+}
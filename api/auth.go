@@ -0,0 +1,211 @@
+// Package api holds the HTTP middleware shared by the REST APIs of the GeoDNS
+// daemons: API key authentication against an ApiConfig, role checks and
+// audit logging of mutating calls.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// Role is a permission granted to an API key.
+type Role string
+
+const (
+	// RoleReadOnly may call read-only endpoints.
+	RoleReadOnly Role = "read-only"
+	// RoleMemberAdmin may also change members, e.g. overrides and
+	// maintenance.
+	RoleMemberAdmin Role = "member-admin"
+	// RoleBilling may also read and change billing data.
+	RoleBilling Role = "billing"
+	// RoleAdmin may call everything.
+	RoleAdmin Role = "admin"
+	// RoleMember is held by member keys (ApiConfig.MemberKeys) only and
+	// may call the member self-service endpoints for its own member, e.g.
+	// declaring maintenance. It cannot be granted through AuthKeyRoles.
+	RoleMember Role = "member"
+)
+
+// implied lists the roles each role includes besides itself.
+var implied = map[Role][]Role{
+	RoleAdmin:       {RoleReadOnly, RoleMemberAdmin, RoleBilling, RoleMember},
+	RoleMemberAdmin: {RoleReadOnly, RoleMember},
+	RoleBilling:     {RoleReadOnly},
+	RoleReadOnly:    nil,
+}
+
+// KeySource returns the ApiConfig whose keys a handler accepts. It is called
+// per request, so key changes apply on config reload.
+type KeySource func() cfg.ApiConfig
+
+// Principal is the API key a request authenticated with. Member is set
+// for member keys, which act for that member only.
+type Principal struct {
+	Name   string
+	Roles  []Role
+	Member string
+}
+
+// Has reports whether p was granted role, directly or through a role that
+// includes it.
+func (p Principal) Has(role Role) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+		for _, inc := range implied[r] {
+			if inc == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the principal stored by Require.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticate matches the key of r, sent as "Authorization: Bearer <key>"
+// or "X-API-Key: <key>", against the AuthKeys of c (name → key). Keys
+// without an AuthKeyRoles entry are admins, as every key was before roles
+// existed. Keys of c.MemberKeys (member → key) authenticate as
+// "member:<member>" with RoleMember.
+func Authenticate(c cfg.ApiConfig, r *http.Request) (Principal, bool) {
+	key := requestKey(r)
+	if key == "" {
+		return Principal{}, false
+	}
+	for name, want := range c.AuthKeys {
+		if want == "" || subtle.ConstantTimeCompare([]byte(key), []byte(want)) != 1 {
+			continue
+		}
+		names, ok := c.AuthKeyRoles[name]
+		if !ok {
+			return Principal{Name: name, Roles: []Role{RoleAdmin}}, true
+		}
+		p := Principal{Name: name}
+		for _, n := range names {
+			role := Role(strings.ToLower(strings.TrimSpace(n)))
+			if _, known := implied[role]; !known {
+				log.Log(log.Warn, "[api] ignoring unknown role %q of key %s", n, name)
+				continue
+			}
+			p.Roles = append(p.Roles, role)
+		}
+		return p, true
+	}
+	for member, want := range c.MemberKeys {
+		if want != "" && subtle.ConstantTimeCompare([]byte(key), []byte(want)) == 1 {
+			return Principal{Name: "member:" + member, Roles: []Role{RoleMember}, Member: member}, true
+		}
+	}
+	return Principal{}, false
+}
+
+func requestKey(r *http.Request) string {
+	if v := r.Header.Get("Authorization"); v != "" {
+		if scheme, token, ok := strings.Cut(v, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// Require serves next only to keys holding role; other requests get 401
+// (no or unknown key) or 403 (missing role). Mutating calls are audit
+// logged.
+func Require(keys KeySource, role Role, next http.Handler) http.Handler {
+	return ReadWrite(keys, role, role, next)
+}
+
+// ReadWrite is Require with read for GET, HEAD and OPTIONS requests and
+// write for all other methods, for handlers that serve both.
+func ReadWrite(keys KeySource, read, write Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutating := isMutating(r.Method)
+		role := read
+		if mutating {
+			role = write
+		}
+
+		p, ok := Authenticate(keys(), r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ibp-geodns"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !p.Has(role) {
+			if mutating {
+				log.Log(log.Warn, "[api] audit: denied %s %s for key %s (needs %s) from %s", r.Method, r.URL.Path, p.Name, role, clientAddr(r))
+			}
+			http.Error(w, "forbidden: requires role "+string(role), http.StatusForbidden)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), principalKey{}, p))
+		if !mutating {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		log.Log(log.Info, "[api] audit: %s %s by key %s from %s: %d in %s",
+			r.Method, r.URL.RequestURI(), p.Name, clientAddr(r), rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// clientAddr is the remote IP, preceded by the first X-Forwarded-For entry
+// when a proxy set one.
+func clientAddr(r *http.Request) string {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		first, _, _ := strings.Cut(fwd, ",")
+		return strings.TrimSpace(first) + " via " + addr
+	}
+	return addr
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
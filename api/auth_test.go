@@ -0,0 +1,143 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func testKeys() cfg.ApiConfig {
+	return cfg.ApiConfig{
+		AuthKeys: map[string]string{
+			"legacy":  "k-legacy",
+			"viewer":  "k-viewer",
+			"ops":     "k-ops",
+			"finance": "k-finance",
+			"empty":   "",
+		},
+		AuthKeyRoles: map[string][]string{
+			"viewer":  {"read-only"},
+			"ops":     {"Member-Admin", "bogus"},
+			"finance": {"billing"},
+			"empty":   {"admin"},
+		},
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	for _, tc := range []struct {
+		header, value string
+		name          string
+		ok            bool
+	}{
+		{"Authorization", "Bearer k-ops", "ops", true},
+		{"Authorization", "bearer  k-viewer", "viewer", true},
+		{"X-API-Key", "k-legacy", "legacy", true},
+		{"Authorization", "Basic k-ops", "", false},
+		{"X-API-Key", "wrong", "", false},
+		{"X-API-Key", "", "", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(tc.header, tc.value)
+		p, ok := Authenticate(testKeys(), r)
+		if ok != tc.ok || p.Name != tc.name {
+			t.Fatalf("%s %q: expected %q/%v, got %q/%v", tc.header, tc.value, tc.name, tc.ok, p.Name, ok)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-API-Key", "k-ops")
+	p, _ := Authenticate(testKeys(), r)
+	if len(p.Roles) != 1 || !p.Has(RoleMemberAdmin) || !p.Has(RoleReadOnly) || p.Has(RoleBilling) {
+		t.Fatalf("expected member-admin with read access only, got %+v", p.Roles)
+	}
+	r.Header.Set("X-API-Key", "k-legacy")
+	if p, _ := Authenticate(testKeys(), r); !p.Has(RoleBilling) || !p.Has(RoleMemberAdmin) {
+		t.Fatalf("expected a key without roles to be an admin, got %+v", p.Roles)
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	var seen Principal
+	h := ReadWrite(testKeys, RoleReadOnly, RoleMemberAdmin, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = PrincipalFromContext(r.Context())
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+
+	for _, tc := range []struct {
+		method, key string
+		want        int
+	}{
+		{http.MethodGet, "", http.StatusUnauthorized},
+		{http.MethodGet, "k-viewer", http.StatusOK},
+		{http.MethodPost, "k-viewer", http.StatusForbidden},
+		{http.MethodPost, "k-ops", http.StatusCreated},
+		{http.MethodPost, "k-finance", http.StatusForbidden},
+		{http.MethodGet, "k-finance", http.StatusOK},
+	} {
+		seen = Principal{}
+		r := httptest.NewRequest(tc.method, "/members/m1/override", nil)
+		if tc.key != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tc.want {
+			t.Fatalf("%s with %q: expected %d, got %d", tc.method, tc.key, tc.want, rec.Code)
+		}
+		if rec.Code < 300 && seen.Name == "" {
+			t.Fatalf("%s with %q: expected the principal in the request context", tc.method, tc.key)
+		}
+	}
+}
+
+func TestRequireBilling(t *testing.T) {
+	h := Require(testKeys, RoleBilling, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	for key, want := range map[string]int{"k-finance": http.StatusOK, "k-legacy": http.StatusOK, "k-ops": http.StatusForbidden} {
+		r := httptest.NewRequest(http.MethodGet, "/billing", nil)
+		r.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != want {
+			t.Fatalf("%s: expected %d, got %d", key, want, rec.Code)
+		}
+	}
+}
+
+func TestClientAddr(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:5555"
+	if got := clientAddr(r); got != "10.0.0.1" {
+		t.Fatalf("expected the remote IP, got %q", got)
+	}
+	r.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.2")
+	if got := clientAddr(r); got != "203.0.113.9 via 10.0.0.1" {
+		t.Fatalf("expected the forwarded client, got %q", got)
+	}
+}
+
+func TestMemberKeysActForTheirMemberOnly(t *testing.T) {
+	keys := testKeys()
+	keys.MemberKeys = map[string]string{"provider1": "k-provider1", "provider2": ""}
+	keys.AuthKeyRoles["viewer"] = append(keys.AuthKeyRoles["viewer"], "member")
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-API-Key", "k-provider1")
+	p, ok := Authenticate(keys, r)
+	if !ok || p.Name != "member:provider1" || p.Member != "provider1" || !p.Has(RoleMember) || p.Has(RoleReadOnly) {
+		t.Fatalf("expected a member principal for provider1, got %+v (ok=%v)", p, ok)
+	}
+
+	r.Header.Set("X-API-Key", "k-viewer")
+	if p, _ := Authenticate(keys, r); p.Has(RoleMember) {
+		t.Fatalf("expected the member role not to be grantable through AuthKeyRoles, got %+v", p.Roles)
+	}
+	r.Header.Set("X-API-Key", "k-ops")
+	if p, _ := Authenticate(keys, r); !p.Has(RoleMember) || p.Member != "" {
+		t.Fatalf("expected member-admin keys to act for any member, got %+v", p)
+	}
+}
@@ -5,11 +5,16 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"reflect"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ibp-network/ibp-geodns-libs/crashreport"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/querylog"
+	"github.com/ibp-network/ibp-geodns-libs/tracing"
 )
 
 var (
@@ -20,6 +25,11 @@ var (
 	configClient   = &http.Client{Timeout: 15 * time.Second}
 	reloadHooksMu  sync.RWMutex
 	reloadHooks    map[string]func()
+
+	// lastRefresh is the UnixNano time of the last load without a failed
+	// download; downloadFailures counts failed downloads since start-up.
+	lastRefresh      atomic.Int64
+	downloadFailures atomic.Int64
 )
 
 func Init(cfgFile string) {
@@ -50,17 +60,52 @@ func loadConfig(cfgFile string, initialLoad bool) {
 		return
 	}
 
+	failures := downloadFailures.Load()
 	cfg.mu.Lock()
 	loadSystemConfig(cfgFile, initialLoad)
 
+	staging := !initialLoad && cfg.data.Local.System.StagedReload.Enabled
+	pinned := !initialLoad && cfg.pinned != nil
+	var live remoteConfig
+	if staging || pinned {
+		live = remoteOf(&cfg.data)
+	}
 	loadStaticDNSConfig(cfg.data.Local.System.ConfigUrls.StaticDNSConfig, initialLoad)
 	loadMembersConfig(cfg.data.Local.System.ConfigUrls.MembersConfig, initialLoad)
 	loadServicesConfig(cfg.data.Local.System.ConfigUrls.ServicesConfig, initialLoad)
 	loadIaasPricing(cfg.data.Local.System.ConfigUrls.IaasPricingConfig, initialLoad)
 	loadServiceRequestsConfig(cfg.data.Local.System.ConfigUrls.ServicesRequestsConfig, initialLoad)
 	loadAlertsConfig(cfg.data.Local.System.ConfigUrls.AlertsConfig, initialLoad)
+	reason := SnapshotLoad
+	if pinned {
+		// Keep a rolled back config until the upstream one changes.
+		if candidate := remoteOf(&cfg.data); sameRemote(*cfg.pinned, candidate) || sameRemote(live, candidate) {
+			live.applyTo(&cfg.data)
+		} else {
+			log.Log(log.Info, "Remote config changed upstream; releasing the rolled back config")
+			cfg.pinned = nil
+		}
+	}
+	switch {
+	case cfg.pinned != nil:
+	case staging:
+		candidate := remoteOf(&cfg.data)
+		live.applyTo(&cfg.data)
+		if stageRemoteLocked(candidate, time.Now().UTC()) {
+			reason = SnapshotStaged
+		}
+	default:
+		cfg.staged, cfg.rejected = nil, nil
+	}
+	rebuildIndexLocked()
 	cfg.mu.Unlock()
 
+	if downloadFailures.Load() == failures {
+		lastRefresh.Store(time.Now().UTC().UnixNano())
+	}
+
+	recordHistory(reason)
+	validateLoaded(initialLoad)
 	runReloadHooks()
 }
 
@@ -85,12 +130,46 @@ func loadAlertsConfig(url string, initialLoad bool) {
 		return
 	}
 
+	loadAlertTemplates(&alerts.Templates, cfg.data.Alerts.Templates)
 	cfg.data.Alerts = alerts
 	log.Log(log.Debug, "Alerts configuration loaded from %s", url)
 }
 
+// loadAlertTemplates merges the templates at t.URL into t.Messages. The
+// defaults of the sinks cover missing templates, so a failed download never
+// stops the program; the messages loaded before, prev, are kept instead.
+func loadAlertTemplates(t *AlertTemplates, prev AlertTemplates) {
+	if t.URL == "" {
+		return
+	}
+	var remote map[string]AlertTemplate
+	if data := downloadConfig(t.URL, false); data != nil {
+		if err := json.Unmarshal(data, &remote); err != nil {
+			log.Log(log.Error, "Failed to unmarshal alert templates from %s: %v", t.URL, err)
+			remote = nil
+		}
+	}
+	if remote == nil {
+		if prev.URL != t.URL {
+			return
+		}
+		remote = prev.Messages
+	}
+	if t.Messages == nil {
+		t.Messages = make(map[string]AlertTemplate, len(remote))
+	}
+	for name, tmpl := range remote {
+		if _, ok := t.Messages[name]; !ok {
+			t.Messages[name] = tmpl
+		}
+	}
+}
+
 func loadSystemConfig(configPath string, initialLoad bool) {
-	file, err := os.Open(configPath)
+	raw, err := os.ReadFile(configPath)
+	if err == nil && isSopsEncrypted(raw) {
+		raw, err = sopsDecrypt(configPath)
+	}
 	if err != nil {
 		log.Log(log.Error, "Failed to open system config file: %v", err)
 		if initialLoad {
@@ -99,11 +178,9 @@ func loadSystemConfig(configPath string, initialLoad bool) {
 		}
 		return
 	}
-	defer file.Close()
 
 	var systemConfig LocalConfig
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&systemConfig); err != nil {
+	if err := json.Unmarshal(raw, &systemConfig); err != nil {
 		log.Log(log.Error, "Failed to decode system config: %v", err)
 		if initialLoad {
 			log.Log(log.Fatal, "Terminating program due to critical error on initial load.")
@@ -112,10 +189,154 @@ func loadSystemConfig(configPath string, initialLoad bool) {
 		return
 	}
 
+	if err := applyOverrides(&systemConfig); err != nil {
+		log.Log(log.Error, "Rejecting system config: %v", err)
+		if initialLoad {
+			log.Log(log.Fatal, "Terminating program due to critical error on initial load.")
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := validateChecks(systemConfig.Checks); err != nil {
+		log.Log(log.Error, "Rejecting system config: %v", err)
+		if initialLoad {
+			log.Log(log.Fatal, "Terminating program due to critical error on initial load.")
+			os.Exit(1)
+		}
+		return
+	}
+
+	prevSystem := cfg.data.Local.System
 	cfg.data.Local = systemConfig
+	if initialLoad || !reflect.DeepEqual(prevSystem.ModuleLogLevels, systemConfig.System.ModuleLogLevels) {
+		applyModuleLogLevels(systemConfig.System.ModuleLogLevels)
+	}
+	if logOutputsChanged(prevSystem, systemConfig.System) || (initialLoad && len(systemConfig.System.LogOutputs) > 0) {
+		applyLogOutputs(systemConfig.System)
+	}
+	if !reflect.DeepEqual(prevSystem.Tracing, systemConfig.System.Tracing) {
+		applyTracing(systemConfig.System.Tracing)
+	}
+	if prevSystem.CrashReporting != systemConfig.System.CrashReporting {
+		applyCrashReporting(systemConfig.System.CrashReporting)
+	}
+	if prevSystem.QueryLog != systemConfig.System.QueryLog ||
+		prevSystem.Usage.ClientPrefixV4 != systemConfig.System.Usage.ClientPrefixV4 ||
+		prevSystem.Usage.ClientPrefixV6 != systemConfig.System.Usage.ClientPrefixV6 {
+		applyQueryLog(systemConfig.System)
+	}
 	log.Log(log.Debug, "System configuration loaded from %s", configPath)
 }
 
+// applyModuleLogLevels installs per-module log level overrides. It only runs
+// when the configured set changes so runtime adjustments survive reloads.
+func applyModuleLogLevels(raw map[string]string) {
+	levels := make(map[string]log.LogLevel, len(raw))
+	for module, name := range raw {
+		level, err := log.LookupLogLevel(name)
+		if err != nil {
+			log.Log(log.Warn, "Ignoring log level override for %s: %v", module, err)
+			continue
+		}
+		levels[module] = level
+	}
+	log.SetModuleLevels(levels)
+}
+
+func logOutputsChanged(prev, next SystemConfig) bool {
+	return prev.LogAsync != next.LogAsync ||
+		prev.LogBufferSize != next.LogBufferSize ||
+		!reflect.DeepEqual(prev.LogOutputs, next.LogOutputs)
+}
+
+// applyLogOutputs reconfigures log destinations; on failure the previous
+// outputs stay active.
+func applyLogOutputs(sc SystemConfig) {
+	opts := log.Options{
+		Async:      sc.LogAsync,
+		BufferSize: sc.LogBufferSize,
+	}
+	for _, o := range sc.LogOutputs {
+		oc := log.OutputConfig{
+			Type:       o.Type,
+			Path:       o.Path,
+			MaxSizeMB:  o.MaxSizeMB,
+			MaxBackups: o.MaxBackups,
+			Network:    o.Network,
+			Address:    o.Address,
+			Tag:        o.Tag,
+		}
+		if o.RotateEvery != "" {
+			every, err := time.ParseDuration(o.RotateEvery)
+			if err != nil {
+				log.Log(log.Warn, "Ignoring invalid RotateEvery %q for %s log output: %v", o.RotateEvery, o.Type, err)
+			} else {
+				oc.RotateEvery = every
+			}
+		}
+		opts.Outputs = append(opts.Outputs, oc)
+	}
+
+	if err := log.Configure(opts); err != nil {
+		log.Log(log.Error, "Failed to configure log outputs: %v", err)
+	}
+}
+
+func applyTracing(tc TracingConfig) {
+	err := tracing.Configure(tracing.Config{
+		Enabled:     tc.Enabled,
+		Endpoint:    tc.Endpoint,
+		ServiceName: tc.ServiceName,
+		SampleRatio: tc.SampleRatio,
+		Headers:     cloneStringMap(tc.Headers),
+	})
+	if err != nil {
+		log.Log(log.Error, "Failed to configure tracing: %v", err)
+	}
+}
+
+func applyCrashReporting(cr CrashReportingConfig) {
+	err := crashreport.Configure(crashreport.Config{
+		DSN:         cr.SentryDSN,
+		Environment: cr.Environment,
+		Release:     GetVersion(),
+	})
+	if err != nil {
+		log.Log(log.Error, "Failed to configure crash reporting: %v", err)
+	}
+}
+
+// applyQueryLog reconfigures the query log; on failure it stays disabled.
+func applyQueryLog(sc SystemConfig) {
+	ql := sc.QueryLog
+	qc := querylog.Config{
+		Enabled:            ql.Enabled,
+		SampleRate:         ql.SampleRate,
+		Sink:               ql.Sink,
+		Path:               ql.Path,
+		MaxSizeMB:          ql.MaxSizeMB,
+		MaxBackups:         ql.MaxBackups,
+		ClickHouseURL:      ql.ClickHouse.URL,
+		ClickHouseTable:    ql.ClickHouse.Table,
+		ClickHouseUser:     ql.ClickHouse.User,
+		ClickHousePassword: ql.ClickHouse.Password,
+		ClientPrefixV4:     sc.Usage.ClientPrefixV4,
+		ClientPrefixV6:     sc.Usage.ClientPrefixV6,
+	}
+	if ql.RotateEvery != "" {
+		every, err := time.ParseDuration(ql.RotateEvery)
+		if err != nil {
+			log.Log(log.Warn, "Ignoring invalid QueryLog.RotateEvery %q: %v", ql.RotateEvery, err)
+		} else {
+			qc.RotateEvery = every
+		}
+	}
+	if err := querylog.Configure(qc); err != nil {
+		log.Log(log.Error, "Failed to configure query log: %v", err)
+	}
+}
+
 func loadStaticDNSConfig(url string, initialLoad bool) {
 	data := downloadConfig(url, initialLoad)
 	if data == nil {
@@ -152,7 +373,14 @@ func loadMembersConfig(url string, initialLoad bool) {
 		return
 	}
 
-	for name, existingMember := range cfg.data.Members {
+	cfg.data.Members = preserveOverrides(cfg.data.Members, newMembers)
+	log.Log(log.Debug, "Members configuration loaded from %s", url)
+}
+
+// preserveOverrides carries the Override flags of existing members over to
+// newMembers, so manual overrides survive reloads.
+func preserveOverrides(existing, newMembers map[string]Member) map[string]Member {
+	for name, existingMember := range existing {
 		if existingMember.Override {
 			if newMember, exists := newMembers[name]; exists {
 				newMember.Override = true
@@ -161,9 +389,7 @@ func loadMembersConfig(url string, initialLoad bool) {
 			}
 		}
 	}
-
-	cfg.data.Members = newMembers
-	log.Log(log.Debug, "Members configuration loaded from %s", url)
+	return newMembers
 }
 
 func loadServicesConfig(url string, initialLoad bool) {
@@ -229,6 +455,7 @@ func downloadConfig(url string, initialLoad bool) []byte {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		log.Log(log.Error, "Failed to create HTTP request for config from %s: %v", url, err)
+		downloadFailures.Add(1)
 		if initialLoad {
 			_, _, line, _ := runtime.Caller(2)
 			log.Log(log.Fatal, "Terminating program due to critical error on initial load. Line: %d", line)
@@ -240,6 +467,7 @@ func downloadConfig(url string, initialLoad bool) []byte {
 	resp, err := configClient.Do(req)
 	if err != nil {
 		log.Log(log.Error, "Failed to download config from %s: %v", url, err)
+		downloadFailures.Add(1)
 		if initialLoad {
 			_, _, line, _ := runtime.Caller(2)
 			log.Log(log.Fatal, "Terminating program due to critical error on initial load. Line: %d", line)
@@ -251,6 +479,7 @@ func downloadConfig(url string, initialLoad bool) []byte {
 
 	if resp.StatusCode != http.StatusOK {
 		log.Log(log.Error, "Non-OK HTTP status while downloading config from %s: %s", url, resp.Status)
+		downloadFailures.Add(1)
 		if initialLoad {
 			_, _, line, _ := runtime.Caller(2)
 			log.Log(log.Fatal, "Terminating program due to critical error on initial load. Line: %d", line)
@@ -262,6 +491,7 @@ func downloadConfig(url string, initialLoad bool) []byte {
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Log(log.Error, "Failed to read response body from %s: %v", url, err)
+		downloadFailures.Add(1)
 		if initialLoad {
 			_, _, line, _ := runtime.Caller(2)
 			log.Log(log.Fatal, "Terminating program due to critical error on initial load. Line: %d", line)
@@ -298,6 +528,16 @@ func configUpdater(cfgFile string, stop <-chan struct{}) {
 	}
 }
 
+// LastRefresh returns when the config was last loaded with every remote
+// config downloaded, or the zero time if that has not happened yet.
+func LastRefresh() time.Time {
+	ns := lastRefresh.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns).UTC()
+}
+
 func RegisterReloadHook(name string, hook func()) {
 	if name == "" || hook == nil {
 		return
@@ -435,13 +675,73 @@ func cloneLocalConfig(src LocalConfig) LocalConfig {
 	dst.CollatorApi.AuthKeys = cloneStringMap(src.CollatorApi.AuthKeys)
 	dst.MonitorApi.AuthKeys = cloneStringMap(src.MonitorApi.AuthKeys)
 	dst.MgmtApi.AuthKeys = cloneStringMap(src.MgmtApi.AuthKeys)
+	dst.DnsApi.AuthKeyRoles = cloneStringSliceMap(src.DnsApi.AuthKeyRoles)
+	dst.CollatorApi.AuthKeyRoles = cloneStringSliceMap(src.CollatorApi.AuthKeyRoles)
+	dst.MonitorApi.AuthKeyRoles = cloneStringSliceMap(src.MonitorApi.AuthKeyRoles)
+	dst.MgmtApi.AuthKeyRoles = cloneStringSliceMap(src.MgmtApi.AuthKeyRoles)
+	dst.DnsApi.MemberKeys = cloneStringMap(src.DnsApi.MemberKeys)
+	dst.CollatorApi.MemberKeys = cloneStringMap(src.CollatorApi.MemberKeys)
+	dst.MonitorApi.MemberKeys = cloneStringMap(src.MonitorApi.MemberKeys)
+	dst.MgmtApi.MemberKeys = cloneStringMap(src.MgmtApi.MemberKeys)
 	dst.Checks = cloneChecks(src.Checks)
+	dst.System.ModuleLogLevels = cloneStringMap(src.System.ModuleLogLevels)
+	dst.System.Tracing.Headers = cloneStringMap(src.System.Tracing.Headers)
+	if src.System.LogOutputs != nil {
+		dst.System.LogOutputs = append([]LogOutputConfig(nil), src.System.LogOutputs...)
+	}
+	if src.System.Usage.OmitDimensions != nil {
+		dst.System.Usage.OmitDimensions = append([]string(nil), src.System.Usage.OmitDimensions...)
+	}
+	if src.System.DNS.Zones != nil {
+		dst.System.DNS.Zones = append([]string(nil), src.System.DNS.Zones...)
+	}
+	if src.System.DNS.Nameservers != nil {
+		dst.System.DNS.Nameservers = append([]string(nil), src.System.DNS.Nameservers...)
+	}
+	if src.Nats.RateLimits != nil {
+		dst.Nats.RateLimits = make(map[string]RateLimitConfig, len(src.Nats.RateLimits))
+		for k, v := range src.Nats.RateLimits {
+			dst.Nats.RateLimits[k] = v
+		}
+	}
+	if src.Nats.ProposalLanes != nil {
+		dst.Nats.ProposalLanes = make(map[string]int, len(src.Nats.ProposalLanes))
+		for k, v := range src.Nats.ProposalLanes {
+			dst.Nats.ProposalLanes[k] = v
+		}
+	}
+	if src.Nats.AdaptiveProposalTimeout != nil {
+		adaptive := *src.Nats.AdaptiveProposalTimeout
+		dst.Nats.AdaptiveProposalTimeout = &adaptive
+	}
+	if src.Nats.Chaos != nil {
+		chaos := *src.Nats.Chaos
+		chaos.Rules = append([]ChaosRule(nil), src.Nats.Chaos.Rules...)
+		dst.Nats.Chaos = &chaos
+	}
+	if src.Maxmind.AnycastPrefixes != nil {
+		dst.Maxmind.AnycastPrefixes = append([]string(nil), src.Maxmind.AnycastPrefixes...)
+	}
+	dst.System.Routing.RegionCountries = cloneStringSliceMap(src.System.Routing.RegionCountries)
 	return dst
 }
 
 func cloneMember(src Member) Member {
 	dst := src
 	dst.ServiceAssignments = cloneStringSliceMap(src.ServiceAssignments)
+	dst.DNSEndpoints = cloneDNSEndpoints(src.DNSEndpoints)
+	return dst
+}
+
+func cloneDNSEndpoints(src []DNSEndpoint) []DNSEndpoint {
+	if src == nil {
+		return nil
+	}
+	dst := make([]DNSEndpoint, len(src))
+	for i, ep := range src {
+		ep.ALPN = append([]string(nil), ep.ALPN...)
+		dst[i] = ep
+	}
 	return dst
 }
 
@@ -485,12 +785,32 @@ func cloneServices(src map[string]Service) map[string]Service {
 	for k, service := range src {
 		cp := service
 		cp.Providers = cloneServiceProviders(service.Providers)
+		cp.Configuration.Access.Allow = cloneAccessList(service.Configuration.Access.Allow)
+		cp.Configuration.Access.Deny = cloneAccessList(service.Configuration.Access.Deny)
+		if w := service.Configuration.Routing.LatencyWeight; w != nil {
+			weight := *w
+			cp.Configuration.Routing.LatencyWeight = &weight
+		}
 		dst[k] = cp
 	}
 
 	return dst
 }
 
+func cloneAccessList(src AccessList) AccessList {
+	dst := src
+	if src.Countries != nil {
+		dst.Countries = append([]string(nil), src.Countries...)
+	}
+	if src.ASNs != nil {
+		dst.ASNs = append([]string(nil), src.ASNs...)
+	}
+	if src.CIDRs != nil {
+		dst.CIDRs = append([]string(nil), src.CIDRs...)
+	}
+	return dst
+}
+
 func clonePricing(src map[string]IaasPricing) map[string]IaasPricing {
 	if src == nil {
 		return nil
@@ -530,6 +850,60 @@ func cloneServiceRequests(src ServiceRequests) ServiceRequests {
 func cloneAlertsConfig(src AlertsConfig) AlertsConfig {
 	dst := src
 	dst.Matrix.Members = cloneStringSliceMap(src.Matrix.Members)
+	if src.Escalation.IntervalMinutes != nil {
+		dst.Escalation.IntervalMinutes = append([]int(nil), src.Escalation.IntervalMinutes...)
+	}
+	if src.Digest.MatrixRooms != nil {
+		dst.Digest.MatrixRooms = append([]string(nil), src.Digest.MatrixRooms...)
+	}
+	if src.Digest.DiscordChannels != nil {
+		dst.Digest.DiscordChannels = append([]string(nil), src.Digest.DiscordChannels...)
+	}
+	if src.Redundancy != nil {
+		dst.Redundancy = append([]RedundancyRule(nil), src.Redundancy...)
+	}
+	if src.UsageAnomaly.Dimensions != nil {
+		dst.UsageAnomaly.Dimensions = append([]string(nil), src.UsageAnomaly.Dimensions...)
+	}
+	if src.Email.To != nil {
+		dst.Email.To = append([]string(nil), src.Email.To...)
+	}
+	dst.Email.Filter = cloneAlertFilter(src.Email.Filter)
+	dst.Email.Members = cloneStringSliceMap(src.Email.Members)
+	if src.Templates.Messages != nil {
+		dst.Templates.Messages = make(map[string]AlertTemplate, len(src.Templates.Messages))
+		for name, tmpl := range src.Templates.Messages {
+			dst.Templates.Messages[name] = tmpl
+		}
+	}
+	dst.Templates.Links = cloneStringMap(src.Templates.Links)
+	if src.Webhooks != nil {
+		dst.Webhooks = make([]WebhookConfig, len(src.Webhooks))
+		for i, hook := range src.Webhooks {
+			dst.Webhooks[i] = cloneWebhookConfig(hook)
+		}
+	}
+	return dst
+}
+
+func cloneWebhookConfig(src WebhookConfig) WebhookConfig {
+	dst := src
+	dst.Headers = cloneStringMap(src.Headers)
+	dst.Filter = cloneAlertFilter(src.Filter)
+	return dst
+}
+
+func cloneAlertFilter(src AlertFilter) AlertFilter {
+	dst := src
+	if src.Members != nil {
+		dst.Members = append([]string(nil), src.Members...)
+	}
+	if src.CheckTypes != nil {
+		dst.CheckTypes = append([]string(nil), src.CheckTypes...)
+	}
+	if src.Events != nil {
+		dst.Events = append([]string(nil), src.Events...)
+	}
 	return dst
 }
 
@@ -548,6 +922,24 @@ func cloneConfigData(src Config) Config {
 	return dst
 }
 
+// SetConfig replaces the whole configuration with c and returns the one it
+// replaced. Nothing is loaded or downloaded and no reload hooks run; it is
+// meant for tests and tools that build their configuration in code.
+func SetConfig(c Config) Config {
+	cfgInitMu.Lock()
+	if cfg == nil {
+		cfg = &ConfigInit{}
+	}
+	cfgInitMu.Unlock()
+
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	prev := cfg.data
+	cfg.data = cloneConfigData(c)
+	rebuildIndexLocked()
+	return prev
+}
+
 func GetConfig() Config {
 	if cfg == nil {
 		return Config{}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"sync"
 	"testing"
@@ -228,3 +230,46 @@ func TestUnregisterReloadHookPreventsFurtherCalls(t *testing.T) {
 		t.Fatalf("expected unregistered hook to remain idle, got %d calls", calls)
 	}
 }
+
+func TestSetConfigReturnsPrevious(t *testing.T) {
+	first := Config{Local: LocalConfig{Nats: NatsConfig{NodeID: "first"}}}
+	orig := SetConfig(first)
+	defer SetConfig(orig)
+
+	prev := SetConfig(Config{Local: LocalConfig{Nats: NatsConfig{NodeID: "second"}}})
+	if prev.Local.Nats.NodeID != "first" {
+		t.Fatalf("expected previous config, got %q", prev.Local.Nats.NodeID)
+	}
+	if got := GetConfig().Local.Nats.NodeID; got != "second" {
+		t.Fatalf("expected new config, got %q", got)
+	}
+}
+
+func TestLoadAlertTemplatesMergesURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/templates.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"offline": {"text": "remote offline"}, "online": {"text": "remote online"}}`))
+	}))
+	defer srv.Close()
+
+	tmpl := AlertTemplates{
+		URL:      srv.URL + "/templates.json",
+		Messages: map[string]AlertTemplate{"offline": {Text: "inline offline"}},
+	}
+	loadAlertTemplates(&tmpl, AlertTemplates{})
+	if tmpl.Messages["offline"].Text != "inline offline" || tmpl.Messages["online"].Text != "remote online" {
+		t.Fatalf("expected inline templates to win over remote ones, got %+v", tmpl.Messages)
+	}
+
+	// A failed download keeps the templates loaded before from the same URL.
+	prev := tmpl
+	broken := AlertTemplates{URL: srv.URL + "/templates.json"}
+	srv.Config.Handler = http.NotFoundHandler()
+	loadAlertTemplates(&broken, prev)
+	if broken.Messages["online"].Text != "remote online" {
+		t.Fatalf("expected the previous templates after a failed download, got %+v", broken.Messages)
+	}
+}
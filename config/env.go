@@ -0,0 +1,109 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// -----------------------------------------------------------------------------
+// ENVIRONMENT AND FLAG OVERRIDES
+// -----------------------------------------------------------------------------
+//
+// Credentials and per-host settings need not live in the JSON file. Each
+// field in localOverrides can be set by an IBP_* environment variable or a
+// command line flag bound with BindFlags; a flag beats the variable, which
+// beats the file. A value of the form "file:/path" is a secret reference:
+// the file's content, without trailing newlines, is used instead (see
+// secrets.go for the other schemes). For every variable, NAME_FILE=/path
+// is shorthand for NAME=file:/path.
+// Overrides and references are resolved on every load of the file.
+
+// ErrSecretRef is returned when a secret reference cannot be resolved.
+var ErrSecretRef = errors.New("unresolvable secret reference")
+
+const secretFilePrefix = "file:"
+
+type localOverride struct {
+	env   string
+	flag  string
+	usage string
+	field func(*LocalConfig) *string
+}
+
+var localOverrides = []localOverride{
+	{"IBP_WORKDIR", "workdir", "working directory", func(c *LocalConfig) *string { return &c.System.WorkDir }},
+	{"IBP_LOG_LEVEL", "log-level", "log level", func(c *LocalConfig) *string { return &c.System.LogLevel }},
+	{"IBP_MYSQL_HOST", "mysql-host", "MySQL host", func(c *LocalConfig) *string { return &c.Mysql.Host }},
+	{"IBP_MYSQL_PORT", "mysql-port", "MySQL port", func(c *LocalConfig) *string { return &c.Mysql.Port }},
+	{"IBP_MYSQL_USER", "mysql-user", "MySQL user", func(c *LocalConfig) *string { return &c.Mysql.User }},
+	{"IBP_MYSQL_PASS", "mysql-pass", "MySQL password", func(c *LocalConfig) *string { return &c.Mysql.Pass }},
+	{"IBP_MYSQL_DB", "mysql-db", "MySQL database", func(c *LocalConfig) *string { return &c.Mysql.DB }},
+	{"IBP_NATS_NODE_ID", "nats-node-id", "NATS node ID", func(c *LocalConfig) *string { return &c.Nats.NodeID }},
+	{"IBP_NATS_URL", "nats-url", "NATS server URLs", func(c *LocalConfig) *string { return &c.Nats.Url }},
+	{"IBP_NATS_USER", "nats-user", "NATS user", func(c *LocalConfig) *string { return &c.Nats.User }},
+	{"IBP_NATS_PASS", "nats-pass", "NATS password", func(c *LocalConfig) *string { return &c.Nats.Pass }},
+	{"IBP_MAXMIND_ACCOUNT_ID", "maxmind-account-id", "MaxMind account ID", func(c *LocalConfig) *string { return &c.Maxmind.AccountID }},
+	{"IBP_MAXMIND_LICENSE_KEY", "maxmind-license-key", "MaxMind license key", func(c *LocalConfig) *string { return &c.Maxmind.LicenseKey }},
+	{"IBP_MATRIX_USERNAME", "matrix-username", "Matrix username", func(c *LocalConfig) *string { return &c.Matrix.Username }},
+	{"IBP_MATRIX_PASSWORD", "matrix-password", "Matrix password", func(c *LocalConfig) *string { return &c.Matrix.Password }},
+	{"IBP_MATRIX_PICKLE_KEY", "matrix-pickle-key", "Matrix crypto store pickle key", func(c *LocalConfig) *string { return &c.Matrix.PickleKey }},
+	{"IBP_DISCORD_TOKEN", "discord-token", "Discord bot token", func(c *LocalConfig) *string { return &c.Discord.Token }},
+	{"IBP_QUERYLOG_CLICKHOUSE_PASSWORD", "querylog-clickhouse-password", "query log ClickHouse password", func(c *LocalConfig) *string { return &c.System.QueryLog.ClickHouse.Password }},
+}
+
+var (
+	flagMu     sync.Mutex
+	flagValues = make(map[string]string)
+)
+
+// BindFlags registers a flag for every overridable field on fs, e.g.
+// -mysql-pass. Call it before fs.Parse and Init; flags that are not given
+// leave the environment and the file in charge.
+func BindFlags(fs *flag.FlagSet) {
+	for _, o := range localOverrides {
+		name := o.flag
+		fs.Func(name, o.usage+" (overrides "+o.env+")", func(v string) error {
+			flagMu.Lock()
+			defer flagMu.Unlock()
+			flagValues[name] = v
+			return nil
+		})
+	}
+}
+
+// applyOverrides sets the overridden fields of c and resolves secret
+// references in all of them.
+func applyOverrides(c *LocalConfig) error {
+	flagMu.Lock()
+	flags := make(map[string]string, len(flagValues))
+	for k, v := range flagValues {
+		flags[k] = v
+	}
+	flagMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	resolvers := resolversFor(c)
+	var errs []error
+	for _, o := range localOverrides {
+		field := o.field(c)
+		if v, ok := flags[o.flag]; ok {
+			*field = v
+		} else if v, ok := os.LookupEnv(o.env); ok {
+			*field = v
+		} else if path, ok := os.LookupEnv(o.env + "_FILE"); ok {
+			*field = secretFilePrefix + path
+		}
+		v, err := resolveSecret(ctx, resolvers, *field)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", o.env, err))
+			continue
+		}
+		*field = v
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyOverridesPrecedenceAndSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "nats_pass")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("IBP_MYSQL_USER", "env-user")
+	t.Setenv("IBP_MYSQL_PASS", "env-pass")
+	t.Setenv("IBP_NATS_PASS_FILE", secret)
+
+	flagMu.Lock()
+	prev := flagValues
+	flagValues = make(map[string]string)
+	flagMu.Unlock()
+	t.Cleanup(func() {
+		flagMu.Lock()
+		flagValues = prev
+		flagMu.Unlock()
+	})
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	BindFlags(fs)
+	if err := fs.Parse([]string{"-mysql-pass", "flag-pass"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var c LocalConfig
+	c.Mysql = MysqlConfig{Host: "db.example.org", User: "file-user", Pass: "file-pass"}
+	c.Matrix.Password = secretFilePrefix + secret
+	if err := applyOverrides(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Mysql.Host != "db.example.org" || c.Mysql.User != "env-user" || c.Mysql.Pass != "flag-pass" {
+		t.Fatalf("unexpected MySQL config %+v", c.Mysql)
+	}
+	if c.Nats.Pass != "s3cret" || c.Matrix.Password != "s3cret" {
+		t.Fatalf("expected secret files to resolve, got nats=%q matrix=%q", c.Nats.Pass, c.Matrix.Password)
+	}
+
+	c.Discord.Token = secretFilePrefix + filepath.Join(dir, "missing")
+	if err := applyOverrides(&c); !errors.Is(err, ErrSecretRef) {
+		t.Fatalf("expected ErrSecretRef, got %v", err)
+	}
+}
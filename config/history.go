@@ -0,0 +1,310 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// SNAPSHOT HISTORY
+// -----------------------------------------------------------------------------
+//
+// Every time the live remote config changes, a snapshot of it is written to
+// WorkDir/config-history together with the source URLs and its hash; the
+// last System.ConfigHistorySize (default 10) are kept. Rollback(n) makes the
+// snapshot n changes back live again and pins it: reloads keep it for as
+// long as the upstream config is the one rolled back from, and the first
+// upstream change after that applies as usual. The pin is not persisted,
+// so a restart loads the upstream config again.
+
+const (
+	DefaultConfigHistorySize = 10
+
+	historyDirName = "config-history"
+)
+
+// Snapshot reasons.
+const (
+	SnapshotLoad     = "load"
+	SnapshotStaged   = "staged"
+	SnapshotApproved = "approved"
+	SnapshotRollback = "rollback"
+)
+
+// ErrSnapshotNotFound is returned by Rollback for a snapshot that is not in
+// the history.
+var ErrSnapshotNotFound = errors.New("config snapshot not found")
+
+// ConfigSnapshot describes one stored remote config. Hash is the SHA-256 of
+// the config without member overrides.
+type ConfigSnapshot struct {
+	ID      string     `json:"id"`
+	Time    time.Time  `json:"time"`
+	Hash    string     `json:"hash"`
+	Reason  string     `json:"reason"`
+	Sources ConfigUrls `json:"sources"`
+}
+
+type snapshotFile struct {
+	ConfigSnapshot
+	Remote remoteConfig `json:"remote"`
+}
+
+var (
+	historyMu sync.Mutex
+	// lastSnapshot is the directory and hash of the last stored snapshot.
+	lastSnapshot struct{ dir, hash string }
+)
+
+func historyDir(sys SystemConfig) string {
+	if strings.TrimSpace(sys.WorkDir) == "" || sys.ConfigHistorySize < 0 {
+		return ""
+	}
+	return filepath.Join(sys.WorkDir, historyDirName)
+}
+
+func historySize(sys SystemConfig) int {
+	if sys.ConfigHistorySize > 0 {
+		return sys.ConfigHistorySize
+	}
+	return DefaultConfigHistorySize
+}
+
+func remoteHash(r remoteConfig) string {
+	raw, _ := json.Marshal(r.withoutOverrides())
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordHistory stores the live remote config when it differs from the
+// last snapshot.
+func recordHistory(reason string) {
+	if cfg == nil {
+		return
+	}
+	cfg.mu.RLock()
+	r := remoteOf(&cfg.data)
+	sys := cfg.data.Local.System
+	cfg.mu.RUnlock()
+	dir := historyDir(sys)
+	if dir == "" {
+		return
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	hash := remoteHash(r)
+	if lastSnapshot.dir != dir {
+		lastSnapshot.dir, lastSnapshot.hash = dir, ""
+		if snaps, err := readHistory(dir); err == nil && len(snaps) > 0 {
+			lastSnapshot.hash = snaps[0].Hash
+		}
+	}
+	if hash == lastSnapshot.hash {
+		return
+	}
+	now := time.Now().UTC()
+	snap := snapshotFile{
+		ConfigSnapshot: ConfigSnapshot{
+			ID:      now.Format("20060102T150405.000000000Z") + "-" + hash[:12],
+			Time:    now,
+			Hash:    hash,
+			Reason:  reason,
+			Sources: sys.ConfigUrls,
+		},
+		Remote: r,
+	}
+	if err := writeSnapshot(dir, snap); err != nil {
+		log.Log(log.Error, "Failed to store config snapshot: %v", err)
+		return
+	}
+	lastSnapshot.hash = hash
+	pruneHistory(dir, historySize(sys))
+}
+
+func writeSnapshot(dir string, snap snapshotFile) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+	raw, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+	path := filepath.Join(dir, snap.ID+".json")
+	tmp, err := os.CreateTemp(dir, ".snapshot-*")
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("store snapshot: %w", err)
+	}
+	return nil
+}
+
+// snapshotFiles lists the snapshot files of dir, newest first.
+func snapshotFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	// IDs start with the UTC time, so names sort by age.
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+func readSnapshot(path string) (snapshotFile, error) {
+	var snap snapshotFile
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return snap, err
+	}
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return snap, fmt.Errorf("decode %s: %w", filepath.Base(path), err)
+	}
+	return snap, nil
+}
+
+func readHistory(dir string) ([]ConfigSnapshot, error) {
+	names, err := snapshotFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ConfigSnapshot, 0, len(names))
+	for _, name := range names {
+		snap, err := readSnapshot(filepath.Join(dir, name))
+		if err != nil {
+			log.Log(log.Warn, "Skipping config snapshot %s: %v", name, err)
+			continue
+		}
+		out = append(out, snap.ConfigSnapshot)
+	}
+	return out, nil
+}
+
+func pruneHistory(dir string, keep int) {
+	names, err := snapshotFiles(dir)
+	if err != nil {
+		return
+	}
+	for i := keep; i < len(names); i++ {
+		if err := os.Remove(filepath.Join(dir, names[i])); err != nil {
+			log.Log(log.Warn, "Failed to prune config snapshot %s: %v", names[i], err)
+		}
+	}
+}
+
+// History returns the stored snapshots, newest first; the first is the
+// live remote config. It is empty without a WorkDir.
+func History() ([]ConfigSnapshot, error) {
+	dir := historyDir(GetConfig().Local.System)
+	if dir == "" {
+		return []ConfigSnapshot{}, nil
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	return readHistory(dir)
+}
+
+// Rollback makes the snapshot n changes back (1 is the previous one) the
+// live remote config, pins it against the current upstream config and runs
+// the reload hooks. A staged config is dropped.
+func Rollback(n int) error {
+	if cfg == nil {
+		return ErrSnapshotNotFound
+	}
+	snaps, err := History()
+	if err != nil {
+		return fmt.Errorf("read config history: %w", err)
+	}
+	if n < 1 || n >= len(snaps) {
+		return fmt.Errorf("%w: %d of %d", ErrSnapshotNotFound, n, len(snaps))
+	}
+	target := snaps[n]
+	snap, err := readSnapshot(filepath.Join(historyDir(GetConfig().Local.System), target.ID+".json"))
+	if err != nil {
+		return fmt.Errorf("read snapshot %s: %w", target.ID, err)
+	}
+
+	cfg.mu.Lock()
+	upstream := remoteOf(&cfg.data)
+	r := snap.Remote
+	r.Members = preserveOverrides(cfg.data.Members, r.Members)
+	r.applyTo(&cfg.data)
+	cfg.pinned, cfg.staged = &upstream, nil
+	rebuildIndexLocked()
+	cfg.mu.Unlock()
+
+	log.Log(log.Warn, "Config rolled back to snapshot %s of %s", target.ID, target.Time.Format(time.RFC3339))
+	recordHistory(SnapshotRollback)
+	validateLoaded(false)
+	runReloadHooks()
+	return nil
+}
+
+// HistoryHandler exposes the history for the management API: GET lists
+// it, POST {"rollback": n} calls Rollback(n).
+func HistoryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req struct {
+				Rollback int `json:"rollback"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			if err := Rollback(req.Rollback); err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, ErrSnapshotNotFound) {
+					status = http.StatusNotFound
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		snaps, err := History()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(snaps)
+	})
+}
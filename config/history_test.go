@@ -0,0 +1,80 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHistoryRecordsChangesAndRollsBack(t *testing.T) {
+	c := stagedTestConfig(StagedReloadConfig{})
+	c.Local.System.WorkDir = t.TempDir()
+	c.Local.System.ConfigUrls.MembersConfig = "https://example.org/members.json"
+	withTestConfig(t, c)
+	withTestReloadHooks(t)
+
+	recordHistory(SnapshotLoad)
+	recordHistory(SnapshotLoad)
+	cfg.mu.Lock()
+	candidateWith("a", "b").applyTo(&cfg.data)
+	cfg.mu.Unlock()
+	recordHistory(SnapshotLoad)
+
+	snaps, err := History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 {
+		t.Fatalf("expected 2 snapshots for 2 distinct configs, got %d", len(snaps))
+	}
+	if snaps[1].Sources.MembersConfig != "https://example.org/members.json" || snaps[0].Hash == snaps[1].Hash {
+		t.Fatalf("unexpected snapshots %+v", snaps)
+	}
+
+	if err := Rollback(2); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Fatalf("expected ErrSnapshotNotFound, got %v", err)
+	}
+	if err := Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := GetMember("b"); ok {
+		t.Fatal("expected member b to be gone after the rollback")
+	}
+	if a, _ := GetMember("a"); !a.Override {
+		t.Fatal("expected the live override of member a to survive the rollback")
+	}
+	if cfg.pinned == nil || len(cfg.pinned.Members) != 2 {
+		t.Fatalf("expected the upstream config to be pinned, got %+v", cfg.pinned)
+	}
+
+	snaps, _ = History()
+	if len(snaps) != 3 || snaps[0].Reason != SnapshotRollback || snaps[0].Hash != snaps[2].Hash {
+		t.Fatalf("expected the rollback to be recorded, got %+v", snaps)
+	}
+}
+
+func TestHistoryPrunesToSize(t *testing.T) {
+	c := stagedTestConfig(StagedReloadConfig{})
+	c.Local.System.WorkDir = t.TempDir()
+	c.Local.System.ConfigHistorySize = 2
+	withTestConfig(t, c)
+
+	for _, members := range [][]string{{"a"}, {"a", "b"}, {"a", "c"}} {
+		cfg.mu.Lock()
+		candidateWith(members...).applyTo(&cfg.data)
+		cfg.mu.Unlock()
+		recordHistory(SnapshotLoad)
+	}
+	snaps, err := History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 {
+		t.Fatalf("expected 2 snapshots kept, got %d", len(snaps))
+	}
+	if err := Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := GetMember("b"); !ok {
+		t.Fatal("expected the rollback to restore member b")
+	}
+}
@@ -0,0 +1,408 @@
+package config
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// MEMBER INDEX AND TOPOLOGY
+// -----------------------------------------------------------------------------
+//
+// The index answers the common member lookups without walking the Members
+// map, and resolves the topology once instead of parsing RPC URLs on every
+// lookup: which service a domain belongs to, which member endpoints serve a
+// service, which domains a member is assigned and which members run DoH or
+// DoT resolvers, with defaults filled in. It is rebuilt under
+// cfg.mu whenever members or services change: on every load, SetConfig,
+// SetMember and DeleteMember.
+
+// Domain is a resolved service domain.
+type Domain struct {
+	Name      string   `json:"name"`      // lower-case host
+	Service   string   `json:"service"`   // service key
+	Members   []string `json:"members"`   // keys of the members assigned the domain
+	Endpoints []string `json:"endpoints"` // provider RPC URLs on the domain
+}
+
+// MemberEndpoint is one provider's RPC URLs of a service.
+type MemberEndpoint struct {
+	Member  string   `json:"member"` // provider key, the member key
+	RpcUrls []string `json:"rpcUrls"`
+}
+
+// MemberDNSEndpoint is a member's DoH or DoT resolver with its defaults
+// filled in.
+type MemberDNSEndpoint struct {
+	Member   string   `json:"member"` // member key
+	Protocol string   `json:"protocol"`
+	URL      string   `json:"url,omitempty"`
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	ALPN     []string `json:"alpn"`
+}
+
+type memberIndex struct {
+	byService      map[string][]string // service → assigned member keys, sorted
+	byLevel        []string            // member keys, highest level first
+	levels         []int               // level of byLevel[i]
+	serviceDomains map[string][]string // service → domains, sorted
+	byName         map[string]string   // Details.Name → member key
+
+	domains          map[string]*Domain             // domain → resolved domain
+	serviceEndpoints map[string][]MemberEndpoint    // service → providers, by member key
+	memberDomains    map[string][]string            // member key → assigned domains, sorted
+	dnsEndpoints     map[string][]MemberDNSEndpoint // protocol → resolvers, by member key
+}
+
+func buildMemberIndex(c *Config) memberIndex {
+	idx := memberIndex{
+		byService:        make(map[string][]string),
+		serviceDomains:   make(map[string][]string),
+		byName:           make(map[string]string),
+		domains:          make(map[string]*Domain),
+		serviceEndpoints: make(map[string][]MemberEndpoint),
+		memberDomains:    make(map[string][]string),
+		dnsEndpoints:     make(map[string][]MemberDNSEndpoint),
+	}
+	domains := make(map[string]map[string]bool)
+	addDomain := func(service, s string) {
+		d := indexDomain(s)
+		if d == "" {
+			return
+		}
+		if domains[service] == nil {
+			domains[service] = make(map[string]bool)
+		}
+		domains[service][d] = true
+	}
+
+	// A domain belongs to the service whose provider RPC URLs use it; the
+	// first service by key wins should two claim it.
+	serviceKeys := make([]string, 0, len(c.Services))
+	for service := range c.Services {
+		serviceKeys = append(serviceKeys, service)
+	}
+	sort.Strings(serviceKeys)
+	for _, service := range serviceKeys {
+		svc := c.Services[service]
+		for member, p := range svc.Providers {
+			if len(p.RpcUrls) > 0 {
+				idx.serviceEndpoints[service] = append(idx.serviceEndpoints[service],
+					MemberEndpoint{Member: member, RpcUrls: append([]string(nil), p.RpcUrls...)})
+			}
+			for _, u := range p.RpcUrls {
+				addDomain(service, u)
+				d := indexDomain(u)
+				if d == "" {
+					continue
+				}
+				dom := idx.domains[d]
+				if dom == nil {
+					dom = &Domain{Name: d, Service: service}
+					idx.domains[d] = dom
+				}
+				if dom.Service == service {
+					dom.Endpoints = append(dom.Endpoints, u)
+				}
+			}
+		}
+		sort.Slice(idx.serviceEndpoints[service], func(i, j int) bool {
+			return idx.serviceEndpoints[service][i].Member < idx.serviceEndpoints[service][j].Member
+		})
+	}
+
+	for key, m := range c.Members {
+		idx.byLevel = append(idx.byLevel, key)
+		if name := m.Details.Name; name != "" {
+			if prev, ok := idx.byName[name]; !ok || key < prev {
+				idx.byName[name] = key
+			}
+		}
+		seen := make(map[string]bool)
+		for service, assigned := range m.ServiceAssignments {
+			if len(assigned) == 0 {
+				continue
+			}
+			idx.byService[service] = append(idx.byService[service], key)
+			for _, a := range assigned {
+				addDomain(service, a)
+				d := indexDomain(a)
+				if d == "" || seen[d] {
+					continue
+				}
+				seen[d] = true
+				idx.memberDomains[key] = append(idx.memberDomains[key], d)
+				if dom := idx.domains[d]; dom != nil {
+					dom.Members = append(dom.Members, key)
+				}
+			}
+		}
+		sort.Strings(idx.memberDomains[key])
+		if m.Override || m.Service.Active != 1 {
+			continue
+		}
+		for _, ep := range m.DNSEndpoints {
+			if r, ok := resolveDNSEndpoint(key, ep); ok {
+				idx.dnsEndpoints[r.Protocol] = append(idx.dnsEndpoints[r.Protocol], r)
+			}
+		}
+	}
+	for _, eps := range idx.dnsEndpoints {
+		sort.SliceStable(eps, func(i, j int) bool { return eps[i].Member < eps[j].Member })
+	}
+	for _, dom := range idx.domains {
+		sort.Strings(dom.Members)
+		sort.Strings(dom.Endpoints)
+	}
+
+	for _, keys := range idx.byService {
+		sort.Strings(keys)
+	}
+	sort.Slice(idx.byLevel, func(i, j int) bool {
+		a, b := c.Members[idx.byLevel[i]], c.Members[idx.byLevel[j]]
+		if a.Membership.Level != b.Membership.Level {
+			return a.Membership.Level > b.Membership.Level
+		}
+		return idx.byLevel[i] < idx.byLevel[j]
+	})
+	idx.levels = make([]int, len(idx.byLevel))
+	for i, key := range idx.byLevel {
+		idx.levels[i] = c.Members[key].Membership.Level
+	}
+	for service, set := range domains {
+		list := make([]string, 0, len(set))
+		for d := range set {
+			list = append(list, d)
+		}
+		sort.Strings(list)
+		idx.serviceDomains[service] = list
+	}
+	return idx
+}
+
+// resolveDNSEndpoint fills the defaults of a member's resolver; endpoints
+// of unknown protocols or without an address are skipped.
+func resolveDNSEndpoint(member string, ep DNSEndpoint) (MemberDNSEndpoint, bool) {
+	r := MemberDNSEndpoint{
+		Member:   member,
+		Protocol: strings.ToLower(strings.TrimSpace(ep.Protocol)),
+		URL:      strings.TrimSpace(ep.URL),
+		Host:     indexDomain(ep.Host),
+		Port:     ep.Port,
+		ALPN:     append([]string(nil), ep.ALPN...),
+	}
+	switch r.Protocol {
+	case DNSProtocolDoH:
+		u, err := url.Parse(r.URL)
+		if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+			return r, false
+		}
+		if r.Host == "" {
+			r.Host = indexDomain(u.Hostname())
+		}
+		if r.Port == 0 {
+			r.Port = 443
+			if p, err := strconv.Atoi(u.Port()); err == nil {
+				r.Port = p
+			}
+		}
+		if len(r.ALPN) == 0 {
+			r.ALPN = []string{"h2", "http/1.1"}
+		}
+	case DNSProtocolDoT:
+		if r.Host == "" {
+			return r, false
+		}
+		if r.Port == 0 {
+			r.Port = 853
+		}
+		if len(r.ALPN) == 0 {
+			r.ALPN = []string{"dot"}
+		}
+	default:
+		return r, false
+	}
+	return r, r.Port > 0 && r.Port < 65536
+}
+
+// indexDomain returns the lower-case host of a domain or URL.
+func indexDomain(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return ""
+		}
+		s = u.Hostname()
+	}
+	return strings.TrimSuffix(strings.ToLower(s), ".")
+}
+
+// rebuildIndexLocked refreshes the member index. Callers must hold cfg.mu
+// for writing.
+func rebuildIndexLocked() {
+	cfg.index = buildMemberIndex(&cfg.data)
+}
+
+func membersLocked(keys []string) []Member {
+	out := make([]Member, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, cloneMember(cfg.data.Members[key]))
+	}
+	return out
+}
+
+// GetMembersForService returns the members with domains assigned for
+// service, sorted by member key.
+func GetMembersForService(service string) []Member {
+	if cfg == nil {
+		return nil
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return membersLocked(cfg.index.byService[service])
+}
+
+// GetMembersAtLevel returns the members of level or higher, highest level
+// first and by member key within a level.
+func GetMembersAtLevel(level int) []Member {
+	if cfg == nil {
+		return nil
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	n := sort.Search(len(cfg.index.levels), func(i int) bool { return cfg.index.levels[i] < level })
+	return membersLocked(cfg.index.byLevel[:n])
+}
+
+// GetServiceDomains returns the domains service is served on: those
+// assigned to members and the hosts of its providers' RPC URLs, lower-case
+// and sorted.
+func GetServiceDomains(service string) []string {
+	if cfg == nil {
+		return nil
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return append([]string(nil), cfg.index.serviceDomains[service]...)
+}
+
+// GetDomain returns the resolved domain name, matched case-insensitively.
+// Only domains used by a provider RPC URL of a service are known.
+func GetDomain(name string) (Domain, bool) {
+	if cfg == nil {
+		return Domain{}, false
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	dom, ok := cfg.index.domains[indexDomain(name)]
+	if !ok {
+		return Domain{}, false
+	}
+	out := *dom
+	out.Members = append([]string(nil), dom.Members...)
+	out.Endpoints = append([]string(nil), dom.Endpoints...)
+	return out, true
+}
+
+// GetServiceForDomain returns the key and configuration of the service
+// domain belongs to.
+func GetServiceForDomain(domain string) (string, Service, bool) {
+	if cfg == nil {
+		return "", Service{}, false
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	dom, ok := cfg.index.domains[indexDomain(domain)]
+	if !ok {
+		return "", Service{}, false
+	}
+	svc, ok := cfg.data.Services[dom.Service]
+	if !ok {
+		return "", Service{}, false
+	}
+	svc.Providers = cloneServiceProviders(svc.Providers)
+	return dom.Service, svc, true
+}
+
+// GetServiceEndpoints returns the providers' RPC URLs of service, by
+// member key.
+func GetServiceEndpoints(service string) []MemberEndpoint {
+	if cfg == nil {
+		return nil
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	eps := cfg.index.serviceEndpoints[service]
+	out := make([]MemberEndpoint, len(eps))
+	for i, ep := range eps {
+		out[i] = MemberEndpoint{Member: ep.Member, RpcUrls: append([]string(nil), ep.RpcUrls...)}
+	}
+	return out
+}
+
+// GetMemberDomains returns the domains assigned to member key, lower-case
+// and sorted.
+func GetMemberDomains(member string) []string {
+	if cfg == nil {
+		return nil
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return append([]string(nil), cfg.index.memberDomains[member]...)
+}
+
+// GetMemberByName returns the member whose Details.Name is name, as
+// proposals and results name members.
+func GetMemberByName(name string) (Member, bool) {
+	if cfg == nil {
+		return Member{}, false
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	key, ok := cfg.index.byName[name]
+	if !ok {
+		return Member{}, false
+	}
+	return cloneMember(cfg.data.Members[key]), true
+}
+
+// GetDNSEndpoints returns the DoH or DoT resolvers of active members
+// without an override, by member key.
+func GetDNSEndpoints(protocol string) []MemberDNSEndpoint {
+	if cfg == nil {
+		return nil
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cloneMemberDNSEndpoints(cfg.index.dnsEndpoints[strings.ToLower(protocol)])
+}
+
+// GetMemberDNSEndpoints returns the resolvers of member key with their
+// defaults filled in, whatever the member's state.
+func GetMemberDNSEndpoints(member string) []MemberDNSEndpoint {
+	if cfg == nil {
+		return nil
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	var out []MemberDNSEndpoint
+	for _, ep := range cfg.data.Members[member].DNSEndpoints {
+		if r, ok := resolveDNSEndpoint(member, ep); ok {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func cloneMemberDNSEndpoints(src []MemberDNSEndpoint) []MemberDNSEndpoint {
+	out := make([]MemberDNSEndpoint, len(src))
+	for i, ep := range src {
+		ep.ALPN = append([]string(nil), ep.ALPN...)
+		out[i] = ep
+	}
+	return out
+}
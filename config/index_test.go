@@ -0,0 +1,153 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func memberNames(ms []Member) []string {
+	var out []string
+	for _, m := range ms {
+		out = append(out, m.Details.Name)
+	}
+	return out
+}
+
+func TestMemberIndexLookups(t *testing.T) {
+	withTestConfig(t, Config{})
+	SetConfig(Config{
+		Members: map[string]Member{
+			"gold": {
+				Details:            MemberDetails{Name: "gold"},
+				Membership:         Membership{Level: 5},
+				ServiceAssignments: map[string][]string{"polkadot": {"RPC.Example.com", "wss://rpc2.example.com/ws"}},
+			},
+			"silver": {
+				Details:            MemberDetails{Name: "silver"},
+				Membership:         Membership{Level: 3},
+				ServiceAssignments: map[string][]string{"polkadot": {"rpc.example.com"}, "kusama": {"ksm.example.com"}},
+			},
+			"bronze": {Details: MemberDetails{Name: "bronze"}, Membership: Membership{Level: 1}},
+		},
+		Services: map[string]Service{
+			"polkadot": {Providers: map[string]ServiceProvider{"gold": {RpcUrls: []string{"https://dot.example.org/rpc"}}}},
+		},
+	})
+
+	if got := memberNames(GetMembersForService("polkadot")); !reflect.DeepEqual(got, []string{"gold", "silver"}) {
+		t.Fatalf("GetMembersForService(polkadot) = %v", got)
+	}
+	if got := GetMembersForService("unknown"); len(got) != 0 {
+		t.Fatalf("GetMembersForService(unknown) = %v", got)
+	}
+	if got := memberNames(GetMembersAtLevel(3)); !reflect.DeepEqual(got, []string{"gold", "silver"}) {
+		t.Fatalf("GetMembersAtLevel(3) = %v", got)
+	}
+	if got := memberNames(GetMembersAtLevel(0)); !reflect.DeepEqual(got, []string{"gold", "silver", "bronze"}) {
+		t.Fatalf("GetMembersAtLevel(0) = %v", got)
+	}
+	want := []string{"dot.example.org", "rpc.example.com", "rpc2.example.com"}
+	if got := GetServiceDomains("polkadot"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetServiceDomains(polkadot) = %v, want %v", got, want)
+	}
+
+	DeleteMember("silver")
+	SetMember("new", Member{Details: MemberDetails{Name: "new"}, Membership: Membership{Level: 9},
+		ServiceAssignments: map[string][]string{"kusama": {"ksm.example.com"}}})
+	if got := memberNames(GetMembersForService("kusama")); !reflect.DeepEqual(got, []string{"new"}) {
+		t.Fatalf("index not rebuilt after member changes: %v", got)
+	}
+	if got := memberNames(GetMembersAtLevel(5)); !reflect.DeepEqual(got, []string{"new", "gold"}) {
+		t.Fatalf("GetMembersAtLevel(5) after changes = %v", got)
+	}
+}
+
+func TestTopologyResolvesDomainsServicesAndMembers(t *testing.T) {
+	withTestConfig(t, Config{})
+	SetConfig(Config{
+		Members: map[string]Member{
+			"m1": {Details: MemberDetails{Name: "Member One"},
+				ServiceAssignments: map[string][]string{"polkadot": {"rpc.dot.example"}}},
+			"m2": {Details: MemberDetails{Name: "Member Two"},
+				ServiceAssignments: map[string][]string{"polkadot": {"RPC.dot.example"}, "kusama": {"rpc.ksm.example"}}},
+		},
+		Services: map[string]Service{
+			"polkadot": {
+				Configuration: ServiceConfiguration{Name: "Polkadot"},
+				Providers: map[string]ServiceProvider{
+					"m2": {RpcUrls: []string{"wss://rpc.dot.example/m2"}},
+					"m1": {RpcUrls: []string{"wss://rpc.dot.example/m1"}},
+				},
+			},
+			"kusama": {Providers: map[string]ServiceProvider{"m2": {RpcUrls: []string{"wss://rpc.ksm.example/m2"}}}},
+		},
+	})
+
+	dom, ok := GetDomain("RPC.DOT.example")
+	if !ok {
+		t.Fatal("expected rpc.dot.example to resolve")
+	}
+	want := Domain{
+		Name:      "rpc.dot.example",
+		Service:   "polkadot",
+		Members:   []string{"m1", "m2"},
+		Endpoints: []string{"wss://rpc.dot.example/m1", "wss://rpc.dot.example/m2"},
+	}
+	if !reflect.DeepEqual(dom, want) {
+		t.Fatalf("GetDomain = %+v, want %+v", dom, want)
+	}
+	key, svc, ok := GetServiceForDomain("rpc.dot.example")
+	if !ok || key != "polkadot" || svc.Configuration.Name != "Polkadot" {
+		t.Fatalf("GetServiceForDomain = %q %+v %v", key, svc.Configuration, ok)
+	}
+	if _, _, ok := GetServiceForDomain("unknown.example"); ok {
+		t.Fatal("expected an unknown domain not to resolve")
+	}
+	eps := GetServiceEndpoints("polkadot")
+	if len(eps) != 2 || eps[0].Member != "m1" || eps[1].Member != "m2" {
+		t.Fatalf("GetServiceEndpoints = %+v", eps)
+	}
+	if got := GetMemberDomains("m2"); !reflect.DeepEqual(got, []string{"rpc.dot.example", "rpc.ksm.example"}) {
+		t.Fatalf("GetMemberDomains(m2) = %v", got)
+	}
+	if m, ok := GetMemberByName("Member Two"); !ok || m.Details.Name != "Member Two" {
+		t.Fatalf("GetMemberByName = %+v %v", m, ok)
+	}
+}
+
+func TestDNSEndpointsResolveDefaults(t *testing.T) {
+	withTestConfig(t, Config{})
+	SetConfig(Config{
+		Members: map[string]Member{
+			"b": {Service: ServiceInfo{Active: 1}, DNSEndpoints: []DNSEndpoint{
+				{Protocol: "DoH", URL: "https://dns.b.example:8443/dns-query"},
+				{Protocol: "dot", Host: "dns.b.example"},
+			}},
+			"a": {Service: ServiceInfo{Active: 1}, DNSEndpoints: []DNSEndpoint{
+				{Protocol: "doh", URL: "https://dns.a.example/dns-query", ALPN: []string{"h3"}},
+				{Protocol: "dot"}, // no host
+			}},
+			"off": {DNSEndpoints: []DNSEndpoint{{Protocol: "dot", Host: "dns.off.example"}}},
+		},
+	})
+
+	want := []MemberDNSEndpoint{
+		{Member: "a", Protocol: "doh", URL: "https://dns.a.example/dns-query", Host: "dns.a.example", Port: 443, ALPN: []string{"h3"}},
+		{Member: "b", Protocol: "doh", URL: "https://dns.b.example:8443/dns-query", Host: "dns.b.example", Port: 8443, ALPN: []string{"h2", "http/1.1"}},
+	}
+	if got := GetDNSEndpoints(DNSProtocolDoH); !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetDNSEndpoints(doh) = %+v, want %+v", got, want)
+	}
+	dot := GetDNSEndpoints("DOT")
+	if len(dot) != 1 || dot[0].Member != "b" || dot[0].Port != 853 || !reflect.DeepEqual(dot[0].ALPN, []string{"dot"}) {
+		t.Fatalf("GetDNSEndpoints(dot) = %+v", dot)
+	}
+	if got := GetMemberDNSEndpoints("off"); len(got) != 1 || got[0].Host != "dns.off.example" {
+		t.Fatalf("GetMemberDNSEndpoints(off) = %+v", got)
+	}
+
+	report := ValidateConfig(GetConfig())
+	if n := len(report.Issues); n != 1 || report.Issues[0].Field != "DNSEndpoints[1]" {
+		t.Fatalf("ValidateConfig issues = %+v", report.Issues)
+	}
+}
@@ -24,6 +24,7 @@ func SetMember(name string, member Member) {
 		cfg.data.Members = make(map[string]Member)
 	}
 	cfg.data.Members[name] = member
+	rebuildIndexLocked()
 	cfg.mu.Unlock()
 }
 
@@ -34,6 +35,7 @@ func DeleteMember(name string) {
 
 	cfg.mu.Lock()
 	delete(cfg.data.Members, name)
+	rebuildIndexLocked()
 	cfg.mu.Unlock()
 }
 
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// -----------------------------------------------------------------------------
+// CHECK OPTIONS
+// -----------------------------------------------------------------------------
+//
+// Check.ExtraOptions stays a free-form map on the wire, but consumers read it
+// through the typed structs below: DecodeOptions fills one from the map,
+// applies the defaults to unset fields and validates the result. Which
+// struct applies follows the check type: site checks take SiteOptions,
+// domain checks HTTPOptions and endpoint checks WSSOptions. Keys a struct
+// does not know are ignored, so monitors may carry options of their own.
+
+// ErrInvalidOptions is returned when a check's ExtraOptions do not decode
+// into its typed options or fail their validation.
+var ErrInvalidOptions = errors.New("invalid check options")
+
+// CheckOptions is implemented by the typed option structs.
+type CheckOptions interface {
+	// Validate reports the first invalid field of the options.
+	Validate() error
+	// Consensus returns the consensus overrides of the check.
+	Consensus() ConsensusOptions
+	setDefaults()
+}
+
+// ConsensusOptions override the consensus thresholds of a check; zero
+// fields keep the cluster-wide behaviour. Every option struct embeds them.
+type ConsensusOptions struct {
+	QuorumPercent  int `json:"consensusQuorumPercent"`  // 50 to 100
+	MinVotes       int `json:"consensusMinVotes"`       // fewest agreeing votes
+	TimeoutSeconds int `json:"consensusTimeoutSeconds"` // proposal timeout
+	Hysteresis     int `json:"consensusHysteresis"`     // results in a row before proposing
+}
+
+func (o *ConsensusOptions) Consensus() ConsensusOptions { return *o }
+
+func (o *ConsensusOptions) setDefaults() {}
+
+func (o *ConsensusOptions) Validate() error {
+	switch {
+	case o.QuorumPercent != 0 && (o.QuorumPercent < 50 || o.QuorumPercent > 100):
+		return fmt.Errorf("consensusQuorumPercent %d is outside 50-100", o.QuorumPercent)
+	case o.MinVotes < 0:
+		return fmt.Errorf("consensusMinVotes %d is negative", o.MinVotes)
+	case o.TimeoutSeconds < 0:
+		return fmt.Errorf("consensusTimeoutSeconds %d is negative", o.TimeoutSeconds)
+	case o.Hysteresis < 0:
+		return fmt.Errorf("consensusHysteresis %d is negative", o.Hysteresis)
+	}
+	return nil
+}
+
+// SiteOptions configure site (ICMP) checks. The site is down when more than
+// MaxLossPercent of Count probes are lost.
+type SiteOptions struct {
+	ConsensusOptions
+	Count          int `json:"count"`          // default 3
+	MaxLossPercent int `json:"maxLossPercent"` // default 50
+}
+
+func (o *SiteOptions) setDefaults() {
+	if o.Count == 0 {
+		o.Count = 3
+	}
+	if o.MaxLossPercent == 0 {
+		o.MaxLossPercent = 50
+	}
+}
+
+func (o *SiteOptions) Validate() error {
+	switch {
+	case o.Count < 1 || o.Count > 100:
+		return fmt.Errorf("count %d is outside 1-100", o.Count)
+	case o.MaxLossPercent < 0 || o.MaxLossPercent > 100:
+		return fmt.Errorf("maxLossPercent %d is outside 0-100", o.MaxLossPercent)
+	}
+	return o.ConsensusOptions.Validate()
+}
+
+// HTTPOptions configure domain (HTTPS) checks: Method on Path must answer
+// ExpectStatus with a certificate valid for at least MinCertDays more days.
+type HTTPOptions struct {
+	ConsensusOptions
+	Method       string            `json:"method"`       // default GET
+	Path         string            `json:"path"`         // default /
+	ExpectStatus int               `json:"expectStatus"` // default 200
+	MinCertDays  int               `json:"minCertDays"`  // default 7
+	Headers      map[string]string `json:"headers"`
+}
+
+func (o *HTTPOptions) setDefaults() {
+	if o.Method == "" {
+		o.Method = "GET"
+	}
+	o.Method = strings.ToUpper(o.Method)
+	if o.Path == "" {
+		o.Path = "/"
+	}
+	if o.ExpectStatus == 0 {
+		o.ExpectStatus = 200
+	}
+	if o.MinCertDays == 0 {
+		o.MinCertDays = 7
+	}
+}
+
+func (o *HTTPOptions) Validate() error {
+	switch {
+	case o.Method != "GET" && o.Method != "HEAD" && o.Method != "POST":
+		return fmt.Errorf("method %q is not GET, HEAD or POST", o.Method)
+	case !strings.HasPrefix(o.Path, "/"):
+		return fmt.Errorf("path %q does not start with /", o.Path)
+	case o.ExpectStatus < 100 || o.ExpectStatus > 599:
+		return fmt.Errorf("expectStatus %d is not an HTTP status", o.ExpectStatus)
+	case o.MinCertDays < 0:
+		return fmt.Errorf("minCertDays %d is negative", o.MinCertDays)
+	}
+	return o.ConsensusOptions.Validate()
+}
+
+// WSSOptions configure endpoint (RPC websocket) checks: the endpoint is
+// stale when its best block is older than MaxBlockAgeSeconds, and down when
+// it has fewer than MinPeers peers.
+type WSSOptions struct {
+	ConsensusOptions
+	MaxBlockAgeSeconds int               `json:"maxBlockAgeSeconds"` // default 60
+	MinPeers           int               `json:"minPeers"`
+	Headers            map[string]string `json:"headers"`
+}
+
+func (o *WSSOptions) setDefaults() {
+	if o.MaxBlockAgeSeconds == 0 {
+		o.MaxBlockAgeSeconds = 60
+	}
+}
+
+func (o *WSSOptions) Validate() error {
+	switch {
+	case o.MaxBlockAgeSeconds < 0:
+		return fmt.Errorf("maxBlockAgeSeconds %d is negative", o.MaxBlockAgeSeconds)
+	case o.MinPeers < 0:
+		return fmt.Errorf("minPeers %d is negative", o.MinPeers)
+	}
+	return o.ConsensusOptions.Validate()
+}
+
+// DecodeOptions fills dst from c.ExtraOptions, applies its defaults and
+// validates it. Errors wrap ErrInvalidOptions and name the check.
+func DecodeOptions(c Check, dst CheckOptions) error {
+	if len(c.ExtraOptions) > 0 {
+		raw, err := json.Marshal(c.ExtraOptions)
+		if err != nil {
+			return fmt.Errorf("%w: check %s/%s: %v", ErrInvalidOptions, c.CheckType, c.Name, err)
+		}
+		if err := json.Unmarshal(raw, dst); err != nil {
+			return fmt.Errorf("%w: check %s/%s: %v", ErrInvalidOptions, c.CheckType, c.Name, err)
+		}
+	}
+	dst.setDefaults()
+	if err := dst.Validate(); err != nil {
+		return fmt.Errorf("%w: check %s/%s: %v", ErrInvalidOptions, c.CheckType, c.Name, err)
+	}
+	return nil
+}
+
+// OptionsFor decodes c's options into the struct of its check type. Checks
+// of other types get their ConsensusOptions.
+func OptionsFor(c Check) (CheckOptions, error) {
+	var opts CheckOptions
+	switch c.CheckType {
+	case "site":
+		opts = &SiteOptions{}
+	case "domain":
+		opts = &HTTPOptions{}
+	case "endpoint":
+		opts = &WSSOptions{}
+	default:
+		opts = &ConsensusOptions{}
+	}
+	if err := DecodeOptions(c, opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// validateChecks checks the options of every check.
+func validateChecks(checks []Check) error {
+	var errs []error
+	for _, c := range checks {
+		if _, err := OptionsFor(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
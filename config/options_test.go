@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeOptionsAppliesDefaults(t *testing.T) {
+	var o HTTPOptions
+	if err := DecodeOptions(Check{Name: "ssl", CheckType: "domain"}, &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Method != "GET" || o.Path != "/" || o.ExpectStatus != 200 || o.MinCertDays != 7 {
+		t.Fatalf("defaults not applied: %+v", o)
+	}
+}
+
+func TestOptionsForDecodesByCheckType(t *testing.T) {
+	c := Check{Name: "wss", CheckType: "endpoint", ExtraOptions: map[string]interface{}{
+		"maxBlockAgeSeconds":     float64(30),
+		"headers":                map[string]interface{}{"User-Agent": "ibp-monitor"},
+		"consensusQuorumPercent": float64(66),
+		"vendorSpecific":         true,
+	}}
+	opts, err := OptionsFor(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := opts.(*WSSOptions)
+	if !ok {
+		t.Fatalf("expected WSSOptions, got %T", opts)
+	}
+	if w.MaxBlockAgeSeconds != 30 || w.Headers["User-Agent"] != "ibp-monitor" || w.Consensus().QuorumPercent != 66 {
+		t.Fatalf("unexpected options: %+v", w)
+	}
+}
+
+func TestValidateChecksRejectsInvalidOptions(t *testing.T) {
+	checks := []Check{
+		{Name: "ping", CheckType: "site", ExtraOptions: map[string]interface{}{"count": float64(500)}},
+		{Name: "ssl", CheckType: "domain", ExtraOptions: map[string]interface{}{"expectStatus": "ok"}},
+		{Name: "wss", CheckType: "endpoint", ExtraOptions: map[string]interface{}{"consensusQuorumPercent": float64(20)}},
+		{Name: "fine", CheckType: "site"},
+	}
+	err := validateChecks(checks)
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("expected ErrInvalidOptions, got %v", err)
+	}
+	for _, name := range []string{"site/ping", "domain/ssl", "endpoint/wss"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not name %s: %v", name, err)
+		}
+	}
+	if strings.Contains(err.Error(), "site/fine") {
+		t.Errorf("error names the valid check: %v", err)
+	}
+}
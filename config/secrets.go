@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// SECRET BACKENDS
+// -----------------------------------------------------------------------------
+//
+// A secret reference is a value "scheme:ref" in one of the overridable
+// fields. Built in are "file:/path" and "vault:mount/path#key", which reads
+// key from a Vault KV secret (v1 or v2) at VAULT_ADDR with VAULT_TOKEN, or
+// System.Secrets.Vault. RegisterSecretResolver adds schemes or replaces the
+// built-in ones. Independently, a local config file encrypted with SOPS is
+// decrypted with the sops binary before it is decoded, so no credential
+// has to be stored in plaintext on disk.
+
+// SecretResolver resolves the ref part of "scheme:ref" references.
+type SecretResolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SecretResolverFunc adapts a function to SecretResolver.
+type SecretResolverFunc func(ctx context.Context, ref string) (string, error)
+
+func (f SecretResolverFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+const secretTimeout = 15 * time.Second
+
+var (
+	resolverMu      sync.RWMutex
+	secretResolvers = make(map[string]SecretResolver)
+
+	// sopsDecrypt returns the decrypted JSON of a SOPS encrypted file.
+	sopsDecrypt = decryptWithSops
+)
+
+// RegisterSecretResolver makes r resolve references of scheme, replacing
+// the built-in resolver of the same scheme. A nil r removes a registered
+// resolver.
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+	if r == nil {
+		delete(secretResolvers, scheme)
+		return
+	}
+	secretResolvers[scheme] = r
+}
+
+// resolversFor returns the resolvers for loading c: the built-in ones,
+// configured from c, and the registered ones.
+func resolversFor(c *LocalConfig) map[string]SecretResolver {
+	out := map[string]SecretResolver{
+		"file":  SecretResolverFunc(resolveFileSecret),
+		"vault": newVaultResolver(c.System.Secrets.Vault),
+	}
+	resolverMu.RLock()
+	defer resolverMu.RUnlock()
+	for scheme, r := range secretResolvers {
+		out[scheme] = r
+	}
+	return out
+}
+
+// resolveSecret returns the value a secret reference points to, or v
+// unchanged when it has no known scheme.
+func resolveSecret(ctx context.Context, resolvers map[string]SecretResolver, v string) (string, error) {
+	scheme, ref, ok := strings.Cut(v, ":")
+	if !ok {
+		return v, nil
+	}
+	r, ok := resolvers[scheme]
+	if !ok {
+		return v, nil
+	}
+	out, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrSecretRef, scheme, err)
+	}
+	return out, nil
+}
+
+func resolveFileSecret(_ context.Context, path string) (string, error) {
+	raw, err := os.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(raw), "\r\n"), nil
+}
+
+// -----------------------------------------------------------------------------
+// VAULT
+// -----------------------------------------------------------------------------
+
+type vaultResolver struct {
+	addr, token, namespace string
+	client                 *http.Client
+}
+
+func newVaultResolver(vc VaultConfig) *vaultResolver {
+	v := &vaultResolver{
+		addr: vc.Addr, token: vc.Token, namespace: vc.Namespace,
+		client: &http.Client{Timeout: secretTimeout},
+	}
+	if v.addr == "" {
+		v.addr = os.Getenv("VAULT_ADDR")
+	}
+	if v.token == "" {
+		v.token = os.Getenv("VAULT_TOKEN")
+	}
+	if v.namespace == "" {
+		v.namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	return v
+}
+
+// Resolve reads "mount/path#key". KV v2 paths include the data segment,
+// e.g. "secret/data/ibp/mysql#password".
+func (v *vaultResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("reference %q is not path#key", ref)
+	}
+	if v.addr == "" || v.token == "" {
+		return "", errors.New("no Vault address or token configured")
+	}
+	token, err := resolveSecret(ctx, map[string]SecretResolver{"file": SecretResolverFunc(resolveFileSecret)}, v.token)
+	if err != nil {
+		return "", fmt.Errorf("vault token: %w", err)
+	}
+
+	u, err := url.JoinPath(v.addr, "v1", strings.Trim(path, "/"))
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault %s: HTTP %d", path, resp.StatusCode)
+	}
+
+	var out struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", fmt.Errorf("vault %s: %v", path, err)
+	}
+	data := out.Data
+	if inner, ok := data["data"]; ok {
+		var kv2 map[string]json.RawMessage
+		if json.Unmarshal(inner, &kv2) == nil {
+			data = kv2
+		}
+	}
+	raw, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("vault %s has no key %q", path, key)
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("vault %s key %q is not a string", path, key)
+	}
+	return s, nil
+}
+
+// -----------------------------------------------------------------------------
+// SOPS
+// -----------------------------------------------------------------------------
+
+// isSopsEncrypted reports whether raw is a JSON document carrying SOPS
+// metadata.
+func isSopsEncrypted(raw []byte) bool {
+	var top map[string]json.RawMessage
+	if json.Unmarshal(raw, &top) != nil {
+		return false
+	}
+	meta, ok := top["sops"]
+	return ok && bytes.HasPrefix(bytes.TrimSpace(meta), []byte("{"))
+}
+
+// decryptWithSops runs sops, or IBP_SOPS_BINARY, to decrypt path. Keys come
+// from the usual sops sources (age, PGP, cloud KMS, Vault transit).
+func decryptWithSops(path string) ([]byte, error) {
+	bin := os.Getenv("IBP_SOPS_BINARY")
+	if bin == "" {
+		bin = "sops"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin, "--decrypt", "--output-type", "json", path)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sops --decrypt %s: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVaultSecretReferences(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.URL.Path != "/v1/secret/data/ibp/mysql" {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"password":"from-vault"},"metadata":{"version":3}}}`))
+	}))
+	defer srv.Close()
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+
+	var c LocalConfig
+	c.Mysql.Pass = "vault:secret/data/ibp/mysql#password"
+	c.Nats.Url = "nats://127.0.0.1:4222"
+	if err := applyOverrides(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Mysql.Pass != "from-vault" || c.Nats.Url != "nats://127.0.0.1:4222" {
+		t.Fatalf("unexpected resolution pass=%q url=%q", c.Mysql.Pass, c.Nats.Url)
+	}
+
+	c.Mysql.Pass = "vault:secret/data/ibp/mysql#missing"
+	if err := applyOverrides(&c); !errors.Is(err, ErrSecretRef) {
+		t.Fatalf("expected ErrSecretRef for a missing key, got %v", err)
+	}
+}
+
+func TestRegisteredSecretResolver(t *testing.T) {
+	RegisterSecretResolver("test", SecretResolverFunc(func(_ context.Context, ref string) (string, error) {
+		return "resolved-" + ref, nil
+	}))
+	t.Cleanup(func() { RegisterSecretResolver("test", nil) })
+
+	var c LocalConfig
+	c.Matrix.Password = "test:matrix"
+	if err := applyOverrides(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Matrix.Password != "resolved-matrix" {
+		t.Fatalf("expected the registered resolver to run, got %q", c.Matrix.Password)
+	}
+}
+
+func TestLoadSystemConfigDecryptsSops(t *testing.T) {
+	withTestConfig(t, Config{})
+	path := filepath.Join(t.TempDir(), "config.sops.json")
+	encrypted := `{"Mysql":{"Pass":"ENC[AES256_GCM,data:abc]"},"sops":{"mac":"ENC[...]","version":"3.9.0"}}`
+	if err := os.WriteFile(path, []byte(encrypted), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	prev := sopsDecrypt
+	sopsDecrypt = func(p string) ([]byte, error) {
+		if p != path {
+			t.Errorf("decrypting %s, want %s", p, path)
+		}
+		return []byte(`{"Mysql":{"Pass":"plain"}}`), nil
+	}
+	t.Cleanup(func() { sopsDecrypt = prev })
+
+	cfg.mu.Lock()
+	loadSystemConfig(path, false)
+	cfg.mu.Unlock()
+	if got := GetConfig().Local.Mysql.Pass; got != "plain" {
+		t.Fatalf("expected the decrypted password, got %q", got)
+	}
+	if isSopsEncrypted([]byte(`{"Mysql":{}}`)) {
+		t.Fatal("plain config detected as SOPS encrypted")
+	}
+}
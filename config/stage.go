@@ -0,0 +1,321 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// STAGED RELOAD
+// -----------------------------------------------------------------------------
+//
+// Without staging a bad members.json reaches every node on its next reload.
+// With System.StagedReload enabled, reloads still apply the local file at
+// once, but a changed remote config (static DNS, members, services, pricing,
+// service requests, alerts) is validated, diffed against the live one and
+// held. It is swapped in after the soak period when its report has no
+// errors, or when approved through the management API; approval is the
+// only way in when RequireApproval is set or the report has errors. The
+// initial load is never staged. Only one candidate is held: a newer remote
+// config replaces it and restarts the soak, and a remote config that
+// returns to the live one drops it.
+
+// DefaultStageSoak is how long a staged remote config is held when
+// StagedReloadConfig sets no SoakSeconds.
+const DefaultStageSoak = 10 * time.Minute
+
+// ErrNoStagedConfig is returned when there is no staged config to approve
+// or reject.
+var ErrNoStagedConfig = errors.New("no staged config")
+
+// SectionDiff lists what changed in one remote config section. Keys are
+// member, service or pricing keys and "qname qtype content" of static DNS
+// records; sections without keys report "*" as changed.
+type SectionDiff struct {
+	Section string   `json:"section"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// StagedConfig describes the held remote config. ReadyAt is when the soak
+// ends; it is zero when only approval can apply the config.
+type StagedConfig struct {
+	StagedAt time.Time        `json:"stagedAt"`
+	ReadyAt  time.Time        `json:"readyAt,omitempty"`
+	Diff     []SectionDiff    `json:"diff"`
+	Report   ValidationReport `json:"report"`
+}
+
+// remoteConfig is the part of Config that is downloaded.
+type remoteConfig struct {
+	StaticDNS       []DNSRecord
+	Members         map[string]Member
+	Services        map[string]Service
+	Pricing         map[string]IaasPricing
+	ServiceRequests ServiceRequests
+	Alerts          AlertsConfig
+}
+
+type stagedRemote struct {
+	remote   remoteConfig
+	stagedAt time.Time
+	diff     []SectionDiff
+	report   ValidationReport
+}
+
+// remoteOf returns a deep copy of c's remote sections.
+func remoteOf(c *Config) remoteConfig {
+	cp := cloneConfigData(Config{
+		StaticDNS: c.StaticDNS, Members: c.Members, Services: c.Services,
+		Pricing: c.Pricing, ServiceRequests: c.ServiceRequests, Alerts: c.Alerts,
+	})
+	return remoteConfig{
+		StaticDNS: cp.StaticDNS, Members: cp.Members, Services: cp.Services,
+		Pricing: cp.Pricing, ServiceRequests: cp.ServiceRequests, Alerts: cp.Alerts,
+	}
+}
+
+func (r remoteConfig) applyTo(c *Config) {
+	c.StaticDNS, c.Members, c.Services = r.StaticDNS, r.Members, r.Services
+	c.Pricing, c.ServiceRequests, c.Alerts = r.Pricing, r.ServiceRequests, r.Alerts
+}
+
+// withoutOverrides returns r with the member override flags cleared; they
+// are local state, not part of the remote config.
+func (r remoteConfig) withoutOverrides() remoteConfig {
+	members := make(map[string]Member, len(r.Members))
+	for k, m := range r.Members {
+		m.Override, m.OverrideTime = false, time.Time{}
+		members[k] = m
+	}
+	r.Members = members
+	return r
+}
+
+func sameRemote(a, b remoteConfig) bool {
+	return reflect.DeepEqual(a.withoutOverrides(), b.withoutOverrides())
+}
+
+func stageSoak(sc StagedReloadConfig) time.Duration {
+	if sc.SoakSeconds > 0 {
+		return time.Duration(sc.SoakSeconds) * time.Second
+	}
+	return DefaultStageSoak
+}
+
+// stageRemoteLocked holds candidate instead of the live remote config and
+// promotes the staged one when it is ready. It returns whether the live
+// config changed. Callers must hold cfg.mu for writing.
+func stageRemoteLocked(candidate remoteConfig, now time.Time) bool {
+	sc := cfg.data.Local.System.StagedReload
+	live := remoteOf(&cfg.data)
+	diff := diffRemote(live, candidate)
+	switch {
+	case len(diff) == 0:
+		if cfg.staged != nil {
+			log.Log(log.Info, "Remote config matches the live one again; dropping the staged config")
+		}
+		cfg.staged, cfg.rejected = nil, nil
+		return false
+	case cfg.rejected != nil && sameRemote(*cfg.rejected, candidate):
+		return false
+	case cfg.staged == nil || !sameRemote(cfg.staged.remote, candidate):
+		c := cloneConfigData(cfg.data)
+		candidate.applyTo(&c)
+		cfg.staged = &stagedRemote{remote: candidate, stagedAt: now, report: ValidateConfig(c)}
+		cfg.rejected = nil
+		log.Log(log.Info, "Staged changed remote config (%d section(s), %d error(s), %d warning(s)); soak %s, approval required: %v",
+			len(diff), cfg.staged.report.Errors, cfg.staged.report.Warnings, stageSoak(sc), sc.RequireApproval)
+	}
+	cfg.staged.diff = diff
+
+	st := stagedViewLocked()
+	if st.ReadyAt.IsZero() || now.Before(st.ReadyAt) {
+		return false
+	}
+	log.Log(log.Info, "Applying staged remote config after a soak of %s", now.Sub(cfg.staged.stagedAt).Round(time.Second))
+	promoteStagedLocked()
+	return true
+}
+
+// promoteStagedLocked swaps the staged remote config in, keeping the
+// member overrides of the live config.
+func promoteStagedLocked() {
+	r := cfg.staged.remote
+	r.Members = preserveOverrides(cfg.data.Members, r.Members)
+	r.applyTo(&cfg.data)
+	cfg.staged = nil
+	rebuildIndexLocked()
+}
+
+func stagedViewLocked() StagedConfig {
+	s := cfg.staged
+	st := StagedConfig{
+		StagedAt: s.stagedAt,
+		Diff:     append([]SectionDiff(nil), s.diff...),
+		Report:   s.report,
+	}
+	if sc := cfg.data.Local.System.StagedReload; !sc.RequireApproval && s.report.OK() {
+		st.ReadyAt = s.stagedAt.Add(stageSoak(sc))
+	}
+	return st
+}
+
+// GetStagedConfig returns the held remote config, if any.
+func GetStagedConfig() (StagedConfig, bool) {
+	if cfg == nil {
+		return StagedConfig{}, false
+	}
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	if cfg.staged == nil {
+		return StagedConfig{}, false
+	}
+	return stagedViewLocked(), true
+}
+
+// ApproveStagedConfig applies the held remote config now, whatever its
+// report, and runs the reload hooks.
+func ApproveStagedConfig() error {
+	if cfg == nil {
+		return ErrNoStagedConfig
+	}
+	cfg.mu.Lock()
+	if cfg.staged == nil {
+		cfg.mu.Unlock()
+		return ErrNoStagedConfig
+	}
+	log.Log(log.Info, "Staged remote config approved; applying")
+	promoteStagedLocked()
+	cfg.mu.Unlock()
+
+	recordHistory(SnapshotApproved)
+	validateLoaded(false)
+	runReloadHooks()
+	return nil
+}
+
+// RejectStagedConfig drops the held remote config. The same remote config
+// is not staged again; the next change to it is.
+func RejectStagedConfig() error {
+	if cfg == nil {
+		return ErrNoStagedConfig
+	}
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	if cfg.staged == nil {
+		return ErrNoStagedConfig
+	}
+	log.Log(log.Info, "Staged remote config rejected")
+	rejected := cfg.staged.remote
+	cfg.rejected, cfg.staged = &rejected, nil
+	return nil
+}
+
+// StagedConfigHandler exposes the staged config for the management API:
+// GET returns it (404 when nothing is staged), POST with
+// {"action":"approve"} or {"action":"reject"} decides it.
+func StagedConfigHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req struct {
+				Action string `json:"action"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			var err error
+			switch req.Action {
+			case "approve":
+				err = ApproveStagedConfig()
+			case "reject":
+				err = RejectStagedConfig()
+			default:
+				http.Error(w, `action must be "approve" or "reject"`, http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		st, ok := GetStagedConfig()
+		if !ok {
+			http.Error(w, ErrNoStagedConfig.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(st)
+	})
+}
+
+// -----------------------------------------------------------------------------
+// DIFF
+// -----------------------------------------------------------------------------
+
+func diffRemote(live, next remoteConfig) []SectionDiff {
+	live, next = live.withoutOverrides(), next.withoutOverrides()
+	var out []SectionDiff
+	add := func(d SectionDiff) {
+		if len(d.Added)+len(d.Removed)+len(d.Changed) > 0 {
+			out = append(out, d)
+		}
+	}
+	add(diffKeyed("StaticDNS", dnsKeys(live.StaticDNS), dnsKeys(next.StaticDNS)))
+	add(diffKeyed("Members", live.Members, next.Members))
+	add(diffKeyed("Services", live.Services, next.Services))
+	add(diffKeyed("IaasPricing", live.Pricing, next.Pricing))
+	if !reflect.DeepEqual(live.ServiceRequests, next.ServiceRequests) {
+		add(SectionDiff{Section: "ServiceRequests", Changed: []string{"*"}})
+	}
+	if !reflect.DeepEqual(live.Alerts, next.Alerts) {
+		add(SectionDiff{Section: "Alerts", Changed: []string{"*"}})
+	}
+	return out
+}
+
+func dnsKeys(recs []DNSRecord) map[string]DNSRecord {
+	m := make(map[string]DNSRecord, len(recs))
+	for _, r := range recs {
+		m[r.QName+" "+r.QType+" "+r.Content] = r
+	}
+	return m
+}
+
+func diffKeyed[V any](section string, live, next map[string]V) SectionDiff {
+	d := SectionDiff{Section: section}
+	for k, v := range next {
+		old, ok := live[k]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, k)
+		case !reflect.DeepEqual(old, v):
+			d.Changed = append(d.Changed, k)
+		}
+	}
+	for k := range live {
+		if _, ok := next[k]; !ok {
+			d.Removed = append(d.Removed, k)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return d
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func stagedTestConfig(sc StagedReloadConfig) Config {
+	var c Config
+	c.Local.System.StagedReload = sc
+	c.Members = map[string]Member{"a": {Details: MemberDetails{Name: "a"}, Override: true}}
+	return c
+}
+
+func candidateWith(members ...string) remoteConfig {
+	r := remoteConfig{Members: make(map[string]Member)}
+	for _, m := range members {
+		r.Members[m] = Member{Details: MemberDetails{Name: m}}
+	}
+	return r
+}
+
+func TestStagedReloadSoaksBeforeApplying(t *testing.T) {
+	withTestConfig(t, stagedTestConfig(StagedReloadConfig{Enabled: true, SoakSeconds: 60}))
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cfg.mu.Lock()
+	promoted := stageRemoteLocked(candidateWith("a", "b"), t0)
+	cfg.mu.Unlock()
+	if promoted {
+		t.Fatal("expected the changed config to be held")
+	}
+	if _, ok := GetMember("b"); ok {
+		t.Fatal("staged member is live before the soak ends")
+	}
+	st, ok := GetStagedConfig()
+	if !ok {
+		t.Fatal("expected a staged config")
+	}
+	wantDiff := []SectionDiff{{Section: "Members", Added: []string{"b"}}}
+	if !reflect.DeepEqual(st.Diff, wantDiff) || !st.ReadyAt.Equal(t0.Add(time.Minute)) {
+		t.Fatalf("unexpected staged config %+v", st)
+	}
+
+	cfg.mu.Lock()
+	promoted = stageRemoteLocked(candidateWith("a", "b"), t0.Add(61*time.Second))
+	cfg.mu.Unlock()
+	if !promoted {
+		t.Fatal("expected the staged config to apply after the soak")
+	}
+	if _, ok := GetMember("b"); !ok {
+		t.Fatal("expected member b to be live")
+	}
+	if a, _ := GetMember("a"); !a.Override {
+		t.Fatal("expected the live override of member a to survive")
+	}
+	if _, ok := GetStagedConfig(); ok {
+		t.Fatal("expected nothing staged after applying")
+	}
+}
+
+func TestStagedReloadApprovalAndRejection(t *testing.T) {
+	withTestConfig(t, stagedTestConfig(StagedReloadConfig{Enabled: true, RequireApproval: true}))
+	withTestReloadHooks(t)
+	t0 := time.Now().UTC()
+
+	cfg.mu.Lock()
+	stageRemoteLocked(candidateWith("a", "b"), t0)
+	promoted := stageRemoteLocked(candidateWith("a", "b"), t0.Add(24*time.Hour))
+	cfg.mu.Unlock()
+	if st, _ := GetStagedConfig(); promoted || !st.ReadyAt.IsZero() {
+		t.Fatalf("expected approval to be required, promoted=%v readyAt=%s", promoted, st.ReadyAt)
+	}
+
+	if err := RejectStagedConfig(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.mu.Lock()
+	stageRemoteLocked(candidateWith("a", "b"), t0)
+	cfg.mu.Unlock()
+	if _, ok := GetStagedConfig(); ok {
+		t.Fatal("expected the rejected config not to be staged again")
+	}
+
+	cfg.mu.Lock()
+	stageRemoteLocked(candidateWith("a", "c"), t0)
+	cfg.mu.Unlock()
+	if err := ApproveStagedConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := GetMember("c"); !ok {
+		t.Fatal("expected the approved config to be live")
+	}
+	if err := ApproveStagedConfig(); !errors.Is(err, ErrNoStagedConfig) {
+		t.Fatalf("expected ErrNoStagedConfig, got %v", err)
+	}
+}
+
+func TestDiffRemoteIgnoresOverrides(t *testing.T) {
+	live := candidateWith("a")
+	live.Members["a"] = Member{Details: MemberDetails{Name: "a"}, Override: true}
+	if d := diffRemote(live, candidateWith("a")); len(d) != 0 {
+		t.Fatalf("expected no diff, got %+v", d)
+	}
+	next := candidateWith()
+	next.StaticDNS = []DNSRecord{{QName: "x.example", QType: "A", Content: "192.0.2.1"}}
+	next.Alerts.Redundancy = []RedundancyRule{{MinHealthy: 2}}
+	want := []SectionDiff{
+		{Section: "StaticDNS", Added: []string{"x.example A 192.0.2.1"}},
+		{Section: "Members", Removed: []string{"a"}},
+		{Section: "Alerts", Changed: []string{"*"}},
+	}
+	if d := diffRemote(live, next); !reflect.DeepEqual(d, want) {
+		t.Fatalf("diff = %+v, want %+v", d, want)
+	}
+}
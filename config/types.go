@@ -9,6 +9,15 @@ type ConfigInit struct {
 	mu      sync.RWMutex
 	cfgFile string
 	data    Config
+	index   memberIndex
+
+	// staged is the remote config held by a staged reload and rejected the
+	// one last rejected through the management API.
+	staged   *stagedRemote
+	rejected *remoteConfig
+	// pinned is the upstream remote config a Rollback replaced; reloads
+	// keep the rolled back config while upstream still serves it.
+	pinned *remoteConfig
 }
 
 type Config struct {
@@ -46,12 +55,184 @@ type DiscordConfig struct {
 }
 
 type SystemConfig struct {
-	WorkDir            string        `json:"WorkDir"`
-	LogLevel           string        `json:"LogLevel"`
-	ConfigReloadTime   int           `json:"ConfigReloadTime"`
-	CacheSaveTime      time.Duration `json:"CacheSaveTime"`
-	MinimumOfflineTime int           `json:"MinimumOfflineTime"`
-	ConfigUrls         ConfigUrls    `json:"ConfigUrls"`
+	WorkDir            string               `json:"WorkDir"`
+	LogLevel           string               `json:"LogLevel"`
+	ModuleLogLevels    map[string]string    `json:"ModuleLogLevels"`
+	LogOutputs         []LogOutputConfig    `json:"LogOutputs"`
+	LogAsync           bool                 `json:"LogAsync"`
+	LogBufferSize      int                  `json:"LogBufferSize"`
+	Tracing            TracingConfig        `json:"Tracing"`
+	CrashReporting     CrashReportingConfig `json:"CrashReporting"`
+	ConfigReloadTime   int                  `json:"ConfigReloadTime"`
+	CacheSaveTime      time.Duration        `json:"CacheSaveTime"`
+	MinimumOfflineTime int                  `json:"MinimumOfflineTime"`
+	StaleResultChecks  int                  `json:"StaleResultChecks"`
+	ConfigUrls         ConfigUrls           `json:"ConfigUrls"`
+	Scoring            ScoringConfig        `json:"Scoring"`
+	Usage              UsageConfig          `json:"Usage"`
+	DNS                DNSConfig            `json:"DNS"`
+	StagedReload       StagedReloadConfig   `json:"StagedReload"`
+	ConfigHistorySize  int                  `json:"ConfigHistorySize"` // default 10, negative disables
+	Secrets            SecretsConfig        `json:"Secrets"`
+	Routing            RoutingConfig        `json:"Routing"`
+	QueryLog           QueryLogConfig       `json:"QueryLog"`
+	StatusHistory      StatusHistoryConfig  `json:"StatusHistory"`
+}
+
+// StatusHistoryConfig samples the official status of every member check
+// into a time series for availability history. It is off unless Enabled is
+// set. IntervalMinutes is the sampling interval (default 5). Store is
+// "mysql" (default), the status_history table, or "file", one compact file
+// per day under Path (default WorkDir/status-history). RetentionDays, when
+// set, is how many days of samples are kept.
+type StatusHistoryConfig struct {
+	Enabled         bool   `json:"Enabled"`
+	IntervalMinutes int    `json:"IntervalMinutes"`
+	Store           string `json:"Store"`
+	Path            string `json:"Path"`
+	RetentionDays   int    `json:"RetentionDays"`
+}
+
+// QueryLogConfig writes a sampled log of raw DNS queries (time, qname,
+// client prefix, member, rcode) for abuse investigation. It is off unless
+// Enabled is set and SampleRate, the fraction of queries logged, is above
+// zero. Sink is "file" (default), JSON lines at Path rotated like file log
+// outputs, or "clickhouse". Client addresses are truncated to
+// Usage.ClientPrefixV4 and ClientPrefixV6.
+type QueryLogConfig struct {
+	Enabled     bool             `json:"Enabled"`
+	SampleRate  float64          `json:"SampleRate"`
+	Sink        string           `json:"Sink"`
+	Path        string           `json:"Path"`
+	MaxSizeMB   int              `json:"MaxSizeMB"`
+	RotateEvery string           `json:"RotateEvery"`
+	MaxBackups  int              `json:"MaxBackups"`
+	ClickHouse  ClickHouseConfig `json:"ClickHouse"`
+}
+
+// ClickHouseConfig addresses a ClickHouse HTTP interface, e.g.
+// http://clickhouse:8123. Table defaults to dns_queries.
+type ClickHouseConfig struct {
+	URL      string `json:"URL"`
+	Table    string `json:"Table"`
+	User     string `json:"User"`
+	Password string `json:"Password"`
+}
+
+// RoutingConfig maps client countries onto the regions monitors announce
+// (Nats.Region): RegionCountries lists the ISO country codes of each
+// region.
+type RoutingConfig struct {
+	RegionCountries map[string][]string `json:"RegionCountries"`
+}
+
+// SecretsConfig configures the secret backends. Empty Vault fields fall
+// back to VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE; Token may itself be
+// a file: reference.
+type SecretsConfig struct {
+	Vault VaultConfig `json:"Vault"`
+}
+
+type VaultConfig struct {
+	Addr      string `json:"Addr"`
+	Token     string `json:"Token"`
+	Namespace string `json:"Namespace"`
+}
+
+// StagedReloadConfig holds changed remote configs on reload instead of
+// applying them: for SoakSeconds (default 600) when they validate without
+// errors, or until approved through the management API when
+// RequireApproval is set.
+type StagedReloadConfig struct {
+	Enabled         bool `json:"Enabled"`
+	SoakSeconds     int  `json:"SoakSeconds"`
+	RequireApproval bool `json:"RequireApproval"`
+}
+
+// DNSConfig describes the zones served from StaticDNS. Records without a TTL
+// get DefaultTTL (default 3600). Zones without SOA or NS records get them
+// synthesised from Nameservers and Hostmaster; NegativeTTL (default 300) is
+// the SOA minimum. DegradedTTL (default DefaultTTL) is the TTL of member
+// answers while some members of the domain are offline.
+type DNSConfig struct {
+	DefaultTTL  int      `json:"DefaultTTL"`
+	NegativeTTL int      `json:"NegativeTTL"`
+	DegradedTTL int      `json:"DegradedTTL"`
+	Zones       []string `json:"Zones"`
+	Nameservers []string `json:"Nameservers"`
+	Hostmaster  string   `json:"Hostmaster"`
+}
+
+// UsageConfig controls how DNS hits are counted. Hourly adds the hour of day
+// to every usage row; hourly rows older than HourlyRetentionDays (default
+// 30) are folded into daily rows. NonPublicSources decides what happens to
+// hits from private, loopback, bogon and known anycast sources: "record"
+// (default) counts them like any other, "skip" drops them and "bucket"
+// counts them under one row per source class without GeoIP data.
+// ClientPrefixV4 and ClientPrefixV6 are the prefix lengths client addresses
+// are aggregated to (default 24 and 48). OmitDimensions lists the usage
+// dimensions left out of every row, among UsageDimensionASN,
+// UsageDimensionNetworkName and UsageDimensionCountryName; the country code
+// is always kept. TruncateClientIPs truncates client addresses to those
+// prefixes before any lookup or log, and RetentionDays, when set, is how
+// many days usage and unique client rows are kept.
+type UsageConfig struct {
+	Hourly              bool     `json:"Hourly"`
+	HourlyRetentionDays int      `json:"HourlyRetentionDays"`
+	NonPublicSources    string   `json:"NonPublicSources"`
+	ClientPrefixV4      int      `json:"ClientPrefixV4"`
+	ClientPrefixV6      int      `json:"ClientPrefixV6"`
+	OmitDimensions      []string `json:"OmitDimensions"`
+	TruncateClientIPs   bool     `json:"TruncateClientIPs"`
+	RetentionDays       int      `json:"RetentionDays"`
+}
+
+// Usage dimensions UsageConfig.OmitDimensions can leave out.
+const (
+	UsageDimensionASN         = "ASN"
+	UsageDimensionNetworkName = "NetworkName"
+	UsageDimensionCountryName = "CountryName"
+)
+
+// ScoringConfig sets the member ranking formula. Weights are relative; all
+// zero selects the defaults. LatencyPercentile is 50, 90 or 99, and
+// LatencyTargetMs is the response time that still earns a full latency score.
+type ScoringConfig struct {
+	UptimeWeight      float64 `json:"UptimeWeight"`
+	LatencyWeight     float64 `json:"LatencyWeight"`
+	UsageWeight       float64 `json:"UsageWeight"`
+	LatencyPercentile int     `json:"LatencyPercentile"`
+	LatencyTargetMs   float64 `json:"LatencyTargetMs"`
+}
+
+// LogOutputConfig describes a log destination. Type is "stdout", "stderr",
+// "file" or "syslog"; RotateEvery is a Go duration string such as "24h".
+type LogOutputConfig struct {
+	Type        string `json:"Type"`
+	Path        string `json:"Path"`
+	MaxSizeMB   int    `json:"MaxSizeMB"`
+	RotateEvery string `json:"RotateEvery"`
+	MaxBackups  int    `json:"MaxBackups"`
+	Network     string `json:"Network"`
+	Address     string `json:"Address"`
+	Tag         string `json:"Tag"`
+}
+
+// TracingConfig configures span export to an OTLP/HTTP collector endpoint
+// such as http://collector:4318/v1/traces.
+type TracingConfig struct {
+	Enabled     bool              `json:"Enabled"`
+	Endpoint    string            `json:"Endpoint"`
+	ServiceName string            `json:"ServiceName"`
+	SampleRatio float64           `json:"SampleRatio"`
+	Headers     map[string]string `json:"Headers"`
+}
+
+// CrashReportingConfig sends panics recovered in NATS handlers to Sentry when
+// SentryDSN is set. Environment tags the events, e.g. "production".
+type CrashReportingConfig struct {
+	SentryDSN   string `json:"SentryDSN"`
+	Environment string `json:"Environment"`
 }
 
 type ConfigUrls struct {
@@ -69,6 +250,135 @@ type AlertsConfig struct {
 		InternalRoom string              `json:"internal_room"`
 		Members      map[string][]string `json:"members"`
 	} `json:"matrix"`
+	Severity     RoomSeverityConfig `json:"severity"`
+	Escalation   EscalationConfig   `json:"escalation"`
+	Digest       DigestConfig       `json:"digest"`
+	Webhooks     []WebhookConfig    `json:"webhooks"`
+	Redundancy   []RedundancyRule   `json:"redundancy"`
+	UsageAnomaly UsageAnomalyConfig `json:"usage_anomaly"`
+	Email        EmailConfig        `json:"email"`
+	Templates    AlertTemplates     `json:"templates"`
+}
+
+// AlertTemplates are the message templates all alert sinks share. Messages
+// maps an event kind ("offline", "quorum_lost", ...) or "default" to its
+// templates; more are loaded from URL, a JSON object of the same shape,
+// where Messages wins on conflicts. Links maps names to URL templates, such
+// as a member's dashboard page, available to the messages as .Links.
+type AlertTemplates struct {
+	URL      string                   `json:"url"`
+	Messages map[string]AlertTemplate `json:"messages"`
+	Links    map[string]string        `json:"links"`
+}
+
+// AlertTemplate renders one kind of alert. Subject and Text are
+// text/templates and HTML an html/template; sinks use their built-in format
+// for parts left empty.
+type AlertTemplate struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+// RoomSeverityConfig sets the least severe events ("info", "warning" or
+// "critical"; empty is info) posted to the Matrix alert room, which members
+// read and which gets their outages, and to the internal room, which gets
+// operational events such as cluster health and monitor votes.
+type RoomSeverityConfig struct {
+	Room     string `json:"room"`
+	Internal string `json:"internal"`
+}
+
+// EmailConfig configures the email alert sink. Alerts go to the deployment
+// recipients in To that pass Filter, to the addresses listed for a member in
+// Members and to the email routes members stored themselves; without Host no
+// email is sent. TLS is "starttls" (required), "tls" (implicit TLS, port 465
+// by default), "none", or empty to use STARTTLS when the relay offers it.
+// Port defaults to 587. Username enables PLAIN authentication, which is only
+// done over TLS or to localhost. Subject and Body are text/templates
+// rendered against a batch of events; alerts for one recipient within
+// BatchSeconds (default 60, negative to send each alert on its own) are
+// sent as one message.
+type EmailConfig struct {
+	Host         string              `json:"host"`
+	Port         int                 `json:"port"`
+	TLS          string              `json:"tls"`
+	From         string              `json:"from"`
+	Username     string              `json:"username"`
+	Password     string              `json:"password"`
+	To           []string            `json:"to"`
+	Filter       AlertFilter         `json:"filter"`
+	Members      map[string][]string `json:"members"`
+	Subject      string              `json:"subject"`
+	Body         string              `json:"body"`
+	BatchSeconds int                 `json:"batch_seconds"`
+}
+
+// UsageAnomalyConfig makes collators compare every hour's hits per ASN and
+// per country with their hourly average over the trailing BaselineDays
+// (default 7) and alert when a value reaches Factor (default 5) times its
+// baseline with at least MinHits (default 1000) hits. Dimensions restricts
+// the comparison to "asn" or "country"; empty means both. It needs hourly
+// usage (System.Usage.Hourly).
+type UsageAnomalyConfig struct {
+	Enabled      bool     `json:"enabled"`
+	BaselineDays int      `json:"baseline_days"`
+	Factor       float64  `json:"factor"`
+	MinHits      int64    `json:"min_hits"`
+	Dimensions   []string `json:"dimensions"`
+}
+
+// RedundancyRule raises a service alert in the internal room when fewer
+// than MinHealthy providers of Service are healthy. An empty Service
+// matches every service. Region "" counts the whole service, "*" each
+// region with an eligible provider separately, any other value that region.
+type RedundancyRule struct {
+	Service    string `json:"service"`
+	Region     string `json:"region"`
+	MinHealthy int    `json:"min_healthy"`
+}
+
+// WebhookConfig describes an outbound webhook alert sink. Format selects a
+// built-in payload shape (json, slack, telegram, pagerduty); Template, when
+// set, overrides it with a text/template rendered against the alert event.
+type WebhookConfig struct {
+	Name       string            `json:"name"`
+	URL        string            `json:"url"`
+	Format     string            `json:"format"`
+	Template   string            `json:"template"`
+	Secret     string            `json:"secret"`
+	Headers    map[string]string `json:"headers"`
+	ChatID     string            `json:"chat_id"`
+	RoutingKey string            `json:"routing_key"`
+	MaxRetries int               `json:"max_retries"`
+	Filter     AlertFilter       `json:"filter"`
+}
+
+// AlertFilter restricts which events a sink receives. Empty lists match all.
+type AlertFilter struct {
+	Members    []string `json:"members"`
+	CheckTypes []string `json:"check_types"`
+	Events     []string `json:"events"`
+}
+
+// DigestConfig controls the daily summary posted by collator nodes.
+type DigestConfig struct {
+	Enabled         bool     `json:"enabled"`
+	HourUTC         int      `json:"hour_utc"`
+	TopCountries    int      `json:"top_countries"`
+	MatrixRooms     []string `json:"matrix_rooms"`
+	DiscordChannels []string `json:"discord_channels"`
+}
+
+// EscalationConfig controls repeated notifications for outages that remain
+// open. IntervalMinutes lists the elapsed downtime (in minutes) at which each
+// escalation fires; once exhausted, RepeatMinutes (if > 0) keeps re-alerting
+// at a fixed cadence.
+type EscalationConfig struct {
+	Enabled         bool  `json:"enabled"`
+	IntervalMinutes []int `json:"interval_minutes"`
+	RepeatMinutes   int   `json:"repeat_minutes"`
+	InternalRoom    bool  `json:"internal_room"`
 }
 
 type IaasPricing struct {
@@ -78,13 +388,18 @@ type IaasPricing struct {
 	Bandwidth float64 `json:"bandwidth"`
 }
 
+// ApiConfig configures a daemon's REST API. AuthKeys maps key names to API
+// keys; AuthKeyRoles grants roles per key name ("read-only", "member-admin",
+// "billing" or "admin"). A key without an AuthKeyRoles entry is an admin.
 type ApiConfig struct {
-	ListenAddress          string            `json:"ListenAddress"`
-	ListenPort             string            `json:"ListenPort"`
-	MonitorAddress         string            `json:"MonitorAddress"`
-	MonitorPort            string            `json:"MonitorPort"`
-	AuthKeys               map[string]string `json:"AuthKeys"`
-	RefreshIntervalSeconds int               `json:"RefreshIntervalSeconds"`
+	ListenAddress          string              `json:"ListenAddress"`
+	ListenPort             string              `json:"ListenPort"`
+	MonitorAddress         string              `json:"MonitorAddress"`
+	MonitorPort            string              `json:"MonitorPort"`
+	AuthKeys               map[string]string   `json:"AuthKeys"`
+	AuthKeyRoles           map[string][]string `json:"AuthKeyRoles"`
+	MemberKeys             map[string]string   `json:"MemberKeys"` // member name → key
+	RefreshIntervalSeconds int                 `json:"RefreshIntervalSeconds"`
 }
 
 type MatrixConfig struct {
@@ -92,6 +407,8 @@ type MatrixConfig struct {
 	Username      string `json:"Username"`
 	Password      string `json:"Password"`
 	RoomID        string `json:"RoomID"`
+	Encryption    bool   `json:"Encryption"`
+	PickleKey     string `json:"PickleKey"`
 }
 
 type Check struct {
@@ -101,6 +418,10 @@ type Check struct {
 	Timeout         int                    `json:"Timeout"`
 	MinimumInterval int                    `json:"minimumInterval"`
 	ExtraOptions    map[string]interface{} `json:"ExtraOptions"`
+	// Shadow runs the check's proposals and votes through consensus but
+	// only logs and stores the outcome in shadow_results; official results,
+	// events and alerts are left alone.
+	Shadow bool `json:"Shadow,omitempty"`
 }
 
 type DNSRecord struct {
@@ -120,6 +441,25 @@ type Member struct {
 	OverrideTime       time.Time
 	ServiceAssignments map[string][]string `json:"ServiceAssignments"`
 	Location           Location            `json:"Location"`
+	DNSEndpoints       []DNSEndpoint       `json:"DNSEndpoints"`
+}
+
+// DNS endpoint protocols.
+const (
+	DNSProtocolDoH = "doh"
+	DNSProtocolDoT = "dot"
+)
+
+// DNSEndpoint is a DNS-over-HTTPS or DNS-over-TLS resolver a member runs.
+// DoH endpoints are addressed by URL (the RFC 8484 template), DoT ones by
+// Host. Port and ALPN default to 443 and h2, http/1.1 for DoH and to 853
+// and dot for DoT.
+type DNSEndpoint struct {
+	Protocol string   `json:"Protocol"`
+	URL      string   `json:"URL"`
+	Host     string   `json:"Host"`
+	Port     int      `json:"Port"`
+	ALPN     []string `json:"ALPN"`
 }
 
 type MemberDetails struct {
@@ -139,6 +479,9 @@ type ServiceInfo struct {
 	ServiceIPv4 string `json:"ServiceIPv4"`
 	ServiceIPv6 string `json:"ServiceIPv6"`
 	MonitorUrl  string `json:"MonitorUrl"`
+	// Weight is the member's share of traffic relative to the others of a
+	// service; 0 derives it from the membership level.
+	Weight float64 `json:"Weight"`
 }
 
 type Location struct {
@@ -158,18 +501,64 @@ type ServiceProvider struct {
 }
 
 type ServiceConfiguration struct {
-	Name          string `json:"Name"`
-	ServiceType   string `json:"ServiceType"`
-	Active        int    `json:"Active"`
-	LevelRequired int    `json:"LevelRequired"`
-	NetworkName   string `json:"NetworkName"`
-	RelayNetwork  string `json:"RelayNetwork"`
-	NetworkType   string `json:"NetworkType"`
-	DisplayName   string `json:"DisplayName"`
-	WebsiteURL    string `json:"WebsiteURL"`
-	LogoURL       string `json:"LogoURL"`
-	Description   string `json:"Description"`
-	StateRootHash string `json:"StateRootHash"`
+	Name          string        `json:"Name"`
+	ServiceType   string        `json:"ServiceType"`
+	Active        int           `json:"Active"`
+	LevelRequired int           `json:"LevelRequired"`
+	NetworkName   string        `json:"NetworkName"`
+	RelayNetwork  string        `json:"RelayNetwork"`
+	NetworkType   string        `json:"NetworkType"`
+	DisplayName   string        `json:"DisplayName"`
+	WebsiteURL    string        `json:"WebsiteURL"`
+	LogoURL       string        `json:"LogoURL"`
+	Description   string        `json:"Description"`
+	StateRootHash string        `json:"StateRootHash"`
+	DNSPolicy     DNSPolicy     `json:"DNSPolicy"`
+	Access        AccessPolicy  `json:"Access"`
+	Routing       RoutingPolicy `json:"Routing"`
+}
+
+// RoutingPolicy tunes member selection for a service. LatencyWeight, 0 to
+// 1 (default 0.5), is the share of measured latency against geographic
+// distance when ranking members; 0 ranks by distance alone. Weighting is
+// how traffic splits across members: "level" (default) in proportion to
+// their weights, "equal" evenly. Mode "sticky" maps each client prefix of
+// StickyPrefixV4 (default 24) or StickyPrefixV6 (default 48) bits onto the
+// same member while it stays healthy.
+type RoutingPolicy struct {
+	LatencyWeight  *float64 `json:"LatencyWeight"`
+	Weighting      string   `json:"Weighting"`
+	Mode           string   `json:"Mode"`
+	StickyPrefixV4 int      `json:"StickyPrefixV4"`
+	StickyPrefixV6 int      `json:"StickyPrefixV6"`
+}
+
+// AccessPolicy restricts which clients a service is served to. A client
+// matching Deny is refused; with a non-empty Allow, so is a client matching
+// nothing in it. DenyAction is what the DNS layer answers a refused client:
+// "refuse" (default) or "nxdomain".
+type AccessPolicy struct {
+	Allow      AccessList `json:"Allow"`
+	Deny       AccessList `json:"Deny"`
+	DenyAction string     `json:"DenyAction"`
+}
+
+// AccessList matches clients by ISO country code, ASN ("AS64500" or
+// "64500") or address prefix.
+type AccessList struct {
+	Countries []string `json:"Countries"`
+	ASNs      []string `json:"ASNs"`
+	CIDRs     []string `json:"CIDRs"`
+}
+
+// DNSPolicy sets the TTLs of a service's GeoDNS answers: AnswerTTL for
+// member records, DegradedTTL while some of a domain's members are offline
+// and NegativeTTL for negative answers. Zero fields fall back to
+// System.DNS.
+type DNSPolicy struct {
+	AnswerTTL   int `json:"AnswerTTL"`
+	DegradedTTL int `json:"DegradedTTL"`
+	NegativeTTL int `json:"NegativeTTL"`
 }
 type Resources struct {
 	Nodes     int     `json:"nodes"`
@@ -195,17 +584,108 @@ type RequestStats struct {
 	UniqueCountries int `json:"uniqueCountries"`
 }
 
+// NatsConfig holds the NATS connection settings. HandlerWorkers and
+// HandlerQueueSize bound message handling; OverflowPolicy is "block",
+// "drop_newest" or "drop_oldest" and applies when a subject's queue is full.
+// AppliedLedgerSize bounds the applied-proposal ledger, which is kept in
+// WorkDir/tmp when PersistAppliedLedger is set. SubjectPrefix, e.g. "prod",
+// is prepended to every subject so environments can share a NATS server;
+// ClusterName additionally keeps nodes from counting peers of other clusters.
+// RateLimits caps how often each sender may hit a subscribed subject, keyed
+// by subject without the prefix (e.g. "dns.usage.getUsage"); subjects not
+// listed use the built-in defaults of the request subjects, and a PerSecond
+// below 0 disables the limit. Chaos injects transport faults for testing and
+// is deliberately left out of the sample configuration.
 type NatsConfig struct {
-	NodeID string `json:"NodeID"`
-	User   string `json:"User"`
-	Pass   string `json:"Pass"`
-	Url    string `json:"Url"`
+	NodeID               string `json:"NodeID"`
+	User                 string `json:"User"`
+	Pass                 string `json:"Pass"`
+	Url                  string `json:"Url"`
+	HandlerWorkers       int    `json:"HandlerWorkers"`
+	HandlerQueueSize     int    `json:"HandlerQueueSize"`
+	OverflowPolicy       string `json:"OverflowPolicy"`
+	AppliedLedgerSize    int    `json:"AppliedLedgerSize"`
+	PersistAppliedLedger bool   `json:"PersistAppliedLedger"`
+	SubjectPrefix        string `json:"SubjectPrefix"`
+	ClusterName          string `json:"ClusterName"`
+	MonitorQuorum        int    `json:"MonitorQuorum"`
+	MonitorChangePercent int    `json:"MonitorChangePercent"`
+	// Region is where this node runs (e.g. "eu-west"), announced in JOIN
+	// messages. MinOfflineRegions is how many distinct monitor regions must
+	// agree before a check is taken offline; below 2 there is no such rule.
+	Region            string `json:"Region"`
+	MinOfflineRegions int    `json:"MinOfflineRegions"`
+	// MaxClockSkewSeconds is how far a peer's clock may drift from this
+	// node's before it is alerted on and its timestamps are distrusted;
+	// 0 uses 30, negative disables the check.
+	MaxClockSkewSeconds int `json:"MaxClockSkewSeconds"`
+
+	RateLimits map[string]RateLimitConfig `json:"RateLimits"`
+	Chaos      *ChaosConfig               `json:"Chaos,omitempty"`
+	// ProposalLanes sets how many received proposals each lane ("site",
+	// "domain", "endpoint") processes at once; unset lanes use 4.
+	ProposalLanes map[string]int `json:"ProposalLanes"`
+	// AdaptiveProposalTimeout derives the proposal timeout from observed
+	// vote arrivals; unset keeps the fixed 30s.
+	AdaptiveProposalTimeout *AdaptiveTimeoutConfig `json:"AdaptiveProposalTimeout,omitempty"`
+	// EventStreamMaxAgeDays is how long the JetStream stream behind
+	// monitor.events.stream keeps outage events for replay; 0 uses 30.
+	EventStreamMaxAgeDays int `json:"EventStreamMaxAgeDays"`
+}
+
+// AdaptiveTimeoutConfig bounds the adaptive proposal timeout: Multiplier
+// times the Percentile of recent vote arrivals per check type, between
+// MinSeconds and MaxSeconds, once MinSamples arrivals are known. Zero fields
+// use 95, 3, 5, 60 and 20.
+type AdaptiveTimeoutConfig struct {
+	Percentile int     `json:"Percentile"`
+	Multiplier float64 `json:"Multiplier"`
+	MinSeconds int     `json:"MinSeconds"`
+	MaxSeconds int     `json:"MaxSeconds"`
+	MinSamples int     `json:"MinSamples"`
+}
+
+// ChaosConfig enables fault injection on the NATS transport. A Seed of 0
+// draws a random one.
+type ChaosConfig struct {
+	Seed  int64       `json:"Seed"`
+	Rules []ChaosRule `json:"Rules"`
+}
+
+// ChaosRule sets fault probabilities (0 to 1) for a subject pattern without
+// the prefix. Direction is "publish", "subscribe" or empty for both.
+type ChaosRule struct {
+	Subject    string  `json:"Subject"`
+	Direction  string  `json:"Direction"`
+	Drop       float64 `json:"Drop"`
+	Delay      float64 `json:"Delay"`
+	Duplicate  float64 `json:"Duplicate"`
+	Reorder    float64 `json:"Reorder"`
+	MaxDelayMs int     `json:"MaxDelayMs"`
+}
+
+// RateLimitConfig is a token bucket per sender: Burst messages at once,
+// refilled at PerSecond.
+type RateLimitConfig struct {
+	PerSecond float64 `json:"PerSecond"`
+	Burst     int     `json:"Burst"`
 }
 
+// MaxmindConfig locates the GeoLite2 databases and the account used to
+// update them. MinFreeSpaceMB is the free space the updater leaves on the
+// database volume (default 256); a download that would go below it is skipped.
+// Source "cluster" fetches the databases published by the collator over NATS
+// instead of downloading them from MaxMind. OverridesFile is a JSON file of
+// per-prefix corrections consulted before the databases. AnycastPrefixes adds
+// CIDRs to the anycast networks maxmind.ClassifyIP knows.
 type MaxmindConfig struct {
-	MaxmindDBPath string `json:"MaxmindDBPath"`
-	AccountID     string `json:"AccountID"`
-	LicenseKey    string `json:"LicenseKey"`
+	MaxmindDBPath   string   `json:"MaxmindDBPath"`
+	AccountID       string   `json:"AccountID"`
+	LicenseKey      string   `json:"LicenseKey"`
+	MinFreeSpaceMB  int64    `json:"MinFreeSpaceMB"`
+	Source          string   `json:"Source"`
+	OverridesFile   string   `json:"OverridesFile"`
+	AnycastPrefixes []string `json:"AnycastPrefixes"`
 }
 
 type MysqlConfig struct {
@@ -214,4 +694,7 @@ type MysqlConfig struct {
 	User string `json:"User"`
 	Pass string `json:"Pass"`
 	DB   string `json:"DB"`
+	// SlowQueryMs logs queries taking longer, with their arguments
+	// redacted; 0 means 1000, negative turns the log off.
+	SlowQueryMs int `json:"SlowQueryMs,omitempty"`
 }
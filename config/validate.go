@@ -0,0 +1,314 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// CONSISTENCY REPORT
+// -----------------------------------------------------------------------------
+//
+// The configs are downloaded from separate sources, so each can be valid on
+// its own and still disagree with the others: a member assigned a service
+// that does not exist, a provider URL no member answers for. Validate
+// cross-checks them. Errors are entries that cannot work as configured,
+// warnings entries that are probably unintended. The report of every load
+// is kept for LastValidation and the management API.
+
+// Issue severities.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ValidationIssue is one inconsistency. Subject names the entry, e.g.
+// "member provider1" or "service polkadot".
+type ValidationIssue struct {
+	Severity string `json:"severity"`
+	Subject  string `json:"subject"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+// ValidationReport is the result of a consistency check.
+type ValidationReport struct {
+	CheckedAt time.Time         `json:"checkedAt"`
+	Errors    int               `json:"errors"`
+	Warnings  int               `json:"warnings"`
+	Issues    []ValidationIssue `json:"issues"`
+}
+
+// OK reports whether the report has no errors.
+func (r ValidationReport) OK() bool { return r.Errors == 0 }
+
+var lastValidation atomic.Pointer[ValidationReport]
+
+// Validate cross-checks the current configuration.
+func Validate() ValidationReport {
+	return ValidateConfig(GetConfig())
+}
+
+// LastValidation returns the report of the last load, or a zero report
+// before the first.
+func LastValidation() ValidationReport {
+	if r := lastValidation.Load(); r != nil {
+		return *r
+	}
+	return ValidationReport{}
+}
+
+// ValidateConfig cross-checks c:
+//   - ServiceAssignments name existing services (when services are loaded)
+//   - ServiceIPv4 and ServiceIPv6 are IPv4 and IPv6 addresses
+//   - every provider RPC URL parses and its host is assigned, for that
+//     service, to some member
+//   - members assigned a service meet its LevelRequired
+//   - check options decode and validate
+//   - DNS policy TTLs are not negative
+//   - access list prefixes parse and DenyAction is known
+//   - LatencyWeight is within 0-1, Weighting and Mode are known, sticky
+//     prefix lengths fit and member weights are not negative
+//   - DoH endpoints have an https URL and DoT endpoints a host, both of a
+//     known protocol and with a valid port
+//   - an enabled query log has a sample rate within 0-1 and a usable sink
+//   - Usage.OmitDimensions names known usage dimensions
+//   - Usage.RetentionDays is not negative and not shorter than
+//     HourlyRetentionDays
+//   - StatusHistory has a known store and no negative interval or retention
+func ValidateConfig(c Config) ValidationReport {
+	r := ValidationReport{CheckedAt: time.Now().UTC(), Issues: make([]ValidationIssue, 0)}
+	add := func(severity, subject, field, format string, args ...interface{}) {
+		r.Issues = append(r.Issues, ValidationIssue{
+			Severity: severity, Subject: subject, Field: field, Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	// service → domains assigned to some member
+	assigned := make(map[string]map[string]bool)
+	for key, m := range c.Members {
+		subject := "member " + key
+		if m.Service.Weight < 0 {
+			add(SeverityError, subject, "Service.Weight", "%v is negative", m.Service.Weight)
+		}
+		for field, ip := range map[string]string{"ServiceIPv4": m.Service.ServiceIPv4, "ServiceIPv6": m.Service.ServiceIPv6} {
+			if strings.TrimSpace(ip) == "" {
+				continue
+			}
+			addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+			switch {
+			case err != nil:
+				add(SeverityError, subject, "Service."+field, "%q is not an IP address", ip)
+			case field == "ServiceIPv4" && !addr.Unmap().Is4():
+				add(SeverityError, subject, "Service."+field, "%q is not an IPv4 address", ip)
+			case field == "ServiceIPv6" && (addr.Is4() || addr.Is4In6()):
+				add(SeverityError, subject, "Service."+field, "%q is not an IPv6 address", ip)
+			}
+		}
+		for i, ep := range m.DNSEndpoints {
+			field := fmt.Sprintf("DNSEndpoints[%d]", i)
+			if ep.Port < 0 || ep.Port > 65535 {
+				add(SeverityError, subject, field, "port %d is out of range", ep.Port)
+				continue
+			}
+			switch strings.ToLower(strings.TrimSpace(ep.Protocol)) {
+			case DNSProtocolDoH, DNSProtocolDoT:
+				if _, ok := resolveDNSEndpoint(key, ep); !ok {
+					add(SeverityError, subject, field, "%s endpoint needs an https URL (doh) or a host (dot)", ep.Protocol)
+				}
+			default:
+				add(SeverityError, subject, field, "unknown protocol %q", ep.Protocol)
+			}
+		}
+		for service, domains := range m.ServiceAssignments {
+			svc, known := c.Services[service]
+			if !known && len(c.Services) > 0 {
+				add(SeverityError, subject, "ServiceAssignments", "service %q does not exist", service)
+				continue
+			}
+			if known && m.Membership.Level < svc.Configuration.LevelRequired {
+				add(SeverityWarning, subject, "ServiceAssignments",
+					"assigned %q but level %d is below its LevelRequired %d; no records are served",
+					service, m.Membership.Level, svc.Configuration.LevelRequired)
+			}
+			for _, d := range domains {
+				if d := indexDomain(d); d != "" {
+					if assigned[service] == nil {
+						assigned[service] = make(map[string]bool)
+					}
+					assigned[service][d] = true
+				}
+			}
+		}
+	}
+
+	for service, svc := range c.Services {
+		subject := "service " + service
+		if p := svc.Configuration.DNSPolicy; p.AnswerTTL < 0 || p.DegradedTTL < 0 || p.NegativeTTL < 0 {
+			add(SeverityError, subject, "Configuration.DNSPolicy", "TTLs must not be negative")
+		}
+		access := svc.Configuration.Access
+		for list, cidrs := range map[string][]string{"Allow": access.Allow.CIDRs, "Deny": access.Deny.CIDRs} {
+			for _, raw := range cidrs {
+				if _, err := netip.ParsePrefix(strings.TrimSpace(raw)); err != nil {
+					add(SeverityError, subject, "Configuration.Access."+list+".CIDRs", "%q is not a prefix", raw)
+				}
+			}
+		}
+		if w := svc.Configuration.Routing.LatencyWeight; w != nil && (*w < 0 || *w > 1) {
+			add(SeverityError, subject, "Configuration.Routing.LatencyWeight", "%v is outside 0-1", *w)
+		}
+		if w := strings.ToLower(strings.TrimSpace(svc.Configuration.Routing.Weighting)); w != "" && w != "level" && w != "equal" {
+			add(SeverityError, subject, "Configuration.Routing.Weighting", "%q is not level or equal", svc.Configuration.Routing.Weighting)
+		}
+		if rp := svc.Configuration.Routing; rp.Mode != "" && !strings.EqualFold(strings.TrimSpace(rp.Mode), "sticky") {
+			add(SeverityError, subject, "Configuration.Routing.Mode", "%q is not sticky", rp.Mode)
+		} else if rp.StickyPrefixV4 < 0 || rp.StickyPrefixV4 > 32 || rp.StickyPrefixV6 < 0 || rp.StickyPrefixV6 > 128 {
+			add(SeverityError, subject, "Configuration.Routing", "sticky prefix lengths must be 0-32 and 0-128")
+		}
+		if a := strings.ToLower(strings.TrimSpace(access.DenyAction)); a != "" && a != "refuse" && a != "nxdomain" {
+			add(SeverityError, subject, "Configuration.Access.DenyAction", "%q is not refuse or nxdomain", access.DenyAction)
+		}
+		for provider, p := range svc.Providers {
+			if _, ok := c.Members[provider]; !ok && len(c.Members) > 0 {
+				add(SeverityWarning, subject, "Providers", "provider %q is not a member", provider)
+			}
+			for _, raw := range p.RpcUrls {
+				u, err := url.Parse(strings.TrimSpace(raw))
+				if err != nil || u.Hostname() == "" {
+					add(SeverityError, subject, "Providers."+provider+".RpcUrls", "%q is not a URL with a host", raw)
+					continue
+				}
+				if host := indexDomain(u.Hostname()); !assigned[service][host] && len(c.Members) > 0 {
+					add(SeverityWarning, subject, "Providers."+provider+".RpcUrls",
+						"host %s of %s is not assigned to any member for this service", host, raw)
+				}
+			}
+		}
+	}
+
+	for _, chk := range c.Local.Checks {
+		if _, err := OptionsFor(chk); err != nil {
+			add(SeverityError, "check "+chk.CheckType+"/"+chk.Name, "ExtraOptions", "%v", err)
+		}
+	}
+
+	if ql := c.Local.System.QueryLog; ql.Enabled {
+		if ql.SampleRate <= 0 || ql.SampleRate > 1 {
+			add(SeverityWarning, "system", "QueryLog.SampleRate", "%v is outside (0, 1]; nothing is logged at 0", ql.SampleRate)
+		}
+		switch strings.ToLower(strings.TrimSpace(ql.Sink)) {
+		case "", "file":
+			if ql.Path == "" {
+				add(SeverityError, "system", "QueryLog.Path", "file sink needs a path")
+			}
+		case "clickhouse":
+			if ql.ClickHouse.URL == "" {
+				add(SeverityError, "system", "QueryLog.ClickHouse.URL", "clickhouse sink needs a URL")
+			}
+		default:
+			add(SeverityError, "system", "QueryLog.Sink", "%q is not file or clickhouse", ql.Sink)
+		}
+	}
+
+	for _, d := range c.Local.System.Usage.OmitDimensions {
+		switch d {
+		case UsageDimensionASN, UsageDimensionNetworkName, UsageDimensionCountryName:
+		default:
+			add(SeverityWarning, "system", "Usage.OmitDimensions", "%q is not %s, %s or %s; ignored",
+				d, UsageDimensionASN, UsageDimensionNetworkName, UsageDimensionCountryName)
+		}
+	}
+
+	if u := c.Local.System.Usage; u.RetentionDays < 0 {
+		add(SeverityError, "system", "Usage.RetentionDays", "%d is negative", u.RetentionDays)
+	} else if u.RetentionDays > 0 && u.RetentionDays < u.HourlyRetentionDays {
+		add(SeverityWarning, "system", "Usage.RetentionDays",
+			"%d is shorter than HourlyRetentionDays %d; hourly rows are deleted before they are rolled up",
+			u.RetentionDays, u.HourlyRetentionDays)
+	}
+
+	if sh := c.Local.System.StatusHistory; sh.Enabled {
+		switch strings.ToLower(strings.TrimSpace(sh.Store)) {
+		case "", "mysql", "file":
+		default:
+			add(SeverityError, "system", "StatusHistory.Store", "%q is not mysql or file", sh.Store)
+		}
+		if sh.IntervalMinutes < 0 {
+			add(SeverityError, "system", "StatusHistory.IntervalMinutes", "%d is negative", sh.IntervalMinutes)
+		}
+		if sh.RetentionDays < 0 {
+			add(SeverityError, "system", "StatusHistory.RetentionDays", "%d is negative", sh.RetentionDays)
+		}
+	}
+
+	sort.Slice(r.Issues, func(i, j int) bool {
+		a, b := r.Issues[i], r.Issues[j]
+		if a.Severity != b.Severity {
+			return a.Severity == SeverityError
+		}
+		if a.Subject != b.Subject {
+			return a.Subject < b.Subject
+		}
+		if a.Field != b.Field {
+			return a.Field < b.Field
+		}
+		return a.Message < b.Message
+	})
+	for _, is := range r.Issues {
+		if is.Severity == SeverityError {
+			r.Errors++
+		} else {
+			r.Warnings++
+		}
+	}
+	return r
+}
+
+// validateLoaded checks the configuration after a load and keeps the
+// report. The initial load logs every issue, reloads only a summary when
+// the counts change.
+func validateLoaded(initialLoad bool) {
+	r := Validate()
+	prev := lastValidation.Swap(&r)
+	if initialLoad {
+		for _, is := range r.Issues {
+			level := log.Warn
+			if is.Severity == SeverityError {
+				level = log.Error
+			}
+			log.Log(level, "Config %s: %s %s: %s", is.Severity, is.Subject, is.Field, is.Message)
+		}
+		return
+	}
+	if prev == nil || prev.Errors != r.Errors || prev.Warnings != r.Warnings {
+		log.Log(log.Warn, "Config consistency: %d error(s), %d warning(s)", r.Errors, r.Warnings)
+	}
+}
+
+// ValidationHandler serves the consistency report for the management API:
+// GET returns the report of the last load, with ?fresh=1 a new one.
+func ValidationHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		report := LastValidation()
+		if r.URL.Query().Get("fresh") != "" || report.CheckedAt.IsZero() {
+			report = Validate()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
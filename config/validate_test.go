@@ -0,0 +1,93 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidateConfigCrossChecks(t *testing.T) {
+	c := Config{
+		Local: LocalConfig{Checks: []Check{
+			{Name: "ping", CheckType: "site", ExtraOptions: map[string]interface{}{"count": float64(0.5)}},
+		}},
+		Members: map[string]Member{
+			"good": {
+				Membership:         Membership{Level: 5},
+				Service:            ServiceInfo{ServiceIPv4: "192.0.2.1", ServiceIPv6: "2001:db8::1"},
+				ServiceAssignments: map[string][]string{"polkadot": {"rpc.dot.example"}},
+			},
+			"bad": {
+				Membership:         Membership{Level: 1},
+				Service:            ServiceInfo{ServiceIPv4: "2001:db8::2", ServiceIPv6: "not-an-ip"},
+				ServiceAssignments: map[string][]string{"polkadot": {"rpc.dot.example"}, "ghost": {"x.example"}},
+			},
+		},
+		Services: map[string]Service{
+			"polkadot": {
+				Configuration: ServiceConfiguration{LevelRequired: 3},
+				Providers: map[string]ServiceProvider{
+					"good":    {RpcUrls: []string{"wss://rpc.dot.example/good", "wss://other.example/good"}},
+					"unknown": {RpcUrls: []string{"::bad"}},
+				},
+			},
+		},
+	}
+
+	r := ValidateConfig(c)
+	want := map[ValidationIssue]bool{
+		{SeverityError, "member bad", "Service.ServiceIPv4", `"2001:db8::2" is not an IPv4 address`}:                                                                     true,
+		{SeverityError, "member bad", "Service.ServiceIPv6", `"not-an-ip" is not an IP address`}:                                                                         true,
+		{SeverityError, "member bad", "ServiceAssignments", `service "ghost" does not exist`}:                                                                            true,
+		{SeverityError, "service polkadot", "Providers.unknown.RpcUrls", `"::bad" is not a URL with a host`}:                                                             true,
+		{SeverityWarning, "member bad", "ServiceAssignments", `assigned "polkadot" but level 1 is below its LevelRequired 3; no records are served`}:                     true,
+		{SeverityWarning, "service polkadot", "Providers", `provider "unknown" is not a member`}:                                                                         true,
+		{SeverityWarning, "service polkadot", "Providers.good.RpcUrls", "host other.example of wss://other.example/good is not assigned to any member for this service"}: true,
+	}
+	got := make(map[ValidationIssue]bool)
+	for _, is := range r.Issues {
+		if is.Subject == "check site/ping" {
+			continue
+		}
+		got[is] = true
+		if !want[is] {
+			t.Errorf("unexpected issue %+v", is)
+		}
+	}
+	for is := range want {
+		if !got[is] {
+			t.Errorf("missing issue %+v", is)
+		}
+	}
+	if r.Errors != 5 || r.Warnings != 3 || r.OK() {
+		t.Fatalf("expected 5 errors and 3 warnings, got %d and %d", r.Errors, r.Warnings)
+	}
+	if r.Issues[0].Severity != SeverityError || r.Issues[len(r.Issues)-1].Severity != SeverityWarning {
+		t.Fatal("expected errors before warnings")
+	}
+}
+
+func TestValidationHandlerServesReport(t *testing.T) {
+	withTestConfig(t, Config{Members: map[string]Member{
+		"m": {Service: ServiceInfo{ServiceIPv4: "nope"}},
+	}})
+	rec := httptest.NewRecorder()
+	ValidationHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config/validate?fresh=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	var r ValidationReport
+	if err := json.NewDecoder(rec.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Errors != 1 || r.Issues[0].Subject != "member m" {
+		t.Fatalf("unexpected report %+v", r)
+	}
+
+	rec = httptest.NewRecorder()
+	ValidationHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/config/validate", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST status %d, want 405", rec.Code)
+	}
+}
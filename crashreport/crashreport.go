@@ -0,0 +1,270 @@
+// Package crashreport sends recovered panics to Sentry. It posts envelopes
+// to the Sentry envelope endpoint directly, so daemons get crash reports
+// without the Sentry SDK; without a DSN reports are dropped.
+package crashreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// Config selects the Sentry project reports go to. DSN is the project's
+// client key URL, e.g. https://<key>@o1.ingest.sentry.io/<project>.
+type Config struct {
+	DSN         string
+	Environment string
+	Release     string
+	ServerName  string
+}
+
+// Report is one recovered panic.
+type Report struct {
+	Message string
+	Stack   []byte
+	Tags    map[string]string
+}
+
+const (
+	sendQueueSize = 64
+	sendTimeout   = 10 * time.Second
+	clientName    = "ibp-geodns-libs/1.0"
+)
+
+type reporter struct {
+	cfg      Config
+	dsn      string
+	endpoint string
+	auth     string
+	client   *http.Client
+	queue    chan Report
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var (
+	reporterMu sync.RWMutex
+	active     *reporter
+)
+
+// Configure installs (or, with an empty DSN, removes) the reporter. Reports
+// queued for a previous reporter are sent first.
+func Configure(c Config) error {
+	var next *reporter
+	if c.DSN != "" {
+		endpoint, auth, err := parseDSN(c.DSN)
+		if err != nil {
+			return err
+		}
+		if c.ServerName == "" {
+			c.ServerName, _ = os.Hostname()
+		}
+		next = &reporter{
+			cfg:      c,
+			dsn:      c.DSN,
+			endpoint: endpoint,
+			auth:     auth,
+			client:   &http.Client{Timeout: sendTimeout},
+			queue:    make(chan Report, sendQueueSize),
+			stop:     make(chan struct{}),
+			done:     make(chan struct{}),
+		}
+		go next.run()
+	}
+
+	reporterMu.Lock()
+	prev := active
+	active = next
+	reporterMu.Unlock()
+
+	if prev != nil {
+		prev.shutdown()
+	}
+	if next != nil {
+		log.Log(log.Info, "[crashreport] sending panics to %s", next.endpoint)
+	}
+	return nil
+}
+
+// Shutdown sends queued reports and disables reporting.
+func Shutdown() {
+	_ = Configure(Config{})
+}
+
+// Enabled reports whether a DSN is configured.
+func Enabled() bool {
+	reporterMu.RLock()
+	defer reporterMu.RUnlock()
+	return active != nil
+}
+
+// Send queues r. It never blocks; reports are dropped while the queue is
+// full.
+func Send(r Report) {
+	reporterMu.RLock()
+	rep := active
+	reporterMu.RUnlock()
+	if rep == nil {
+		return
+	}
+	select {
+	case rep.queue <- r:
+	default:
+		log.Log(log.Warn, "[crashreport] queue full; dropping report %q", r.Message)
+	}
+}
+
+// parseDSN returns the envelope endpoint and X-Sentry-Auth header of dsn.
+func parseDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid Sentry DSN: %w", err)
+	}
+	project := strings.Trim(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || u.Host == "" || project == "" {
+		return "", "", fmt.Errorf("invalid Sentry DSN: expected scheme://key@host/project")
+	}
+	prefix := ""
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project)
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", clientName, u.User.Username())
+	if secret, ok := u.User.Password(); ok && secret != "" {
+		auth += ", sentry_secret=" + secret
+	}
+	return endpoint, auth, nil
+}
+
+func (r *reporter) run() {
+	defer close(r.done)
+	for {
+		select {
+		case rep := <-r.queue:
+			r.deliver(rep)
+		case <-r.stop:
+			for {
+				select {
+				case rep := <-r.queue:
+					r.deliver(rep)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *reporter) shutdown() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *reporter) deliver(rep Report) {
+	if err := r.post(rep); err != nil {
+		log.Log(log.Warn, "[crashreport] sending report failed: %v", err)
+	}
+}
+
+func (r *reporter) post(rep Report) error {
+	body, err := r.envelope(r.event(rep, time.Now().UTC()))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("sentry returned %s", resp.Status)
+	}
+	return nil
+}
+
+// envelope wraps ev in a Sentry envelope: a header line, then one item
+// header and payload line per item.
+func (r *reporter) envelope(ev sentryEvent) ([]byte, error) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	header, err := json.Marshal(struct {
+		EventID string `json:"event_id"`
+		SentAt  string `json:"sent_at"`
+		DSN     string `json:"dsn"`
+	}{ev.EventID, time.Now().UTC().Format(time.RFC3339), r.dsn})
+	if err != nil {
+		return nil, err
+	}
+	item, err := json.Marshal(struct {
+		Type   string `json:"type"`
+		Length int    `json:"length"`
+	}{"event", len(payload)})
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	for _, line := range [][]byte{header, item, payload} {
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+}
+
+func (r *reporter) event(rep Report, now time.Time) sentryEvent {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	ev := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   now.Format(time.RFC3339),
+		Level:       "fatal",
+		Platform:    "go",
+		Logger:      "ibp-geodns-libs",
+		ServerName:  r.cfg.ServerName,
+		Release:     r.cfg.Release,
+		Environment: r.cfg.Environment,
+		Message:     rep.Message,
+		Tags:        rep.Tags,
+	}
+	if len(rep.Stack) > 0 {
+		ev.Extra = map[string]string{"stacktrace": string(rep.Stack)}
+	}
+	return ev
+}
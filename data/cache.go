@@ -1,10 +1,17 @@
 package data
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	cfg "github.com/ibp-network/ibp-geodns-libs/config"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
@@ -19,6 +26,7 @@ var (
 const (
 	officialCacheFile = "official.cache.json"
 	localCacheFile    = "local.cache.json"
+	cacheBackupSuffix = ".bak"
 )
 
 func SetCacheOptions(localOfficial, stats bool) {
@@ -31,28 +39,50 @@ func SetCacheOptions(localOfficial, stats bool) {
 		localOfficial, stats)
 }
 
+// LoadCache decodes the JSON cache at filePath into out. When the file is
+// missing or corrupt it falls back to the filePath.bak copy kept by SaveCache.
+// A missing cache with no backup is not an error.
 func LoadCache(filePath string, out interface{}) error {
-	file, err := os.Open(filePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			log.Log(log.Warn, "Cache file not found: %s", filePath)
-			return nil
-		}
-		log.Log(log.Error, "Failed to open cache file '%s': %v", filePath, err)
-		return err
+	err := decodeCacheFile(filePath, out)
+	if err == nil {
+		log.Log(log.Info, "Cache loaded successfully from %s", filePath)
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		log.Log(log.Error, "Failed to load cache file '%s': %v", filePath, err)
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(out); err != nil {
-		log.Log(log.Error, "Failed to decode cache file '%s': %v", filePath, err)
+	backup := filePath + cacheBackupSuffix
+	bakErr := decodeCacheFile(backup, out)
+	switch {
+	case bakErr == nil:
+		log.Log(log.Warn, "Cache loaded from backup %s", backup)
+		return nil
+	case os.IsNotExist(err) && os.IsNotExist(bakErr):
+		log.Log(log.Warn, "Cache file not found: %s", filePath)
+		return nil
+	case os.IsNotExist(err):
+		return bakErr
+	default:
 		return err
 	}
+}
 
-	log.Log(log.Info, "Cache loaded successfully from %s", filePath)
+func decodeCacheFile(filePath string, out interface{}) error {
+	payload, err := readCachePayload(filePath)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(payload, out); err != nil {
+		return fmt.Errorf("decode %s: %w", filePath, err)
+	}
 	return nil
 }
 
+// SaveCache writes data to filePath atomically as a versioned cache envelope:
+// it is encoded to a temporary file in the same directory, fsynced and
+// renamed over the target, so a crash mid-write never leaves a truncated
+// cache. The previous cache, if it still verifies, is kept as filePath.bak.
 func SaveCache(filePath string, data interface{}) error {
 	log.Log(log.Debug, "[SaveCache] Attempting to create or overwrite cache file: %s", filePath)
 
@@ -62,23 +92,207 @@ func SaveCache(filePath string, data interface{}) error {
 		return err
 	}
 
-	file, err := os.Create(filePath)
+	tmp, err := os.CreateTemp(dir, filepath.Base(filePath)+".tmp-*")
 	if err != nil {
-		log.Log(log.Error, "Failed to create cache file '%s': %v", filePath, err)
+		log.Log(log.Error, "Failed to create temp cache file in '%s': %v", dir, err)
 		return err
 	}
-	defer file.Close()
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once renamed
 
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(data); err != nil {
+	if err := writeCacheEnvelope(tmp, data); err != nil {
+		tmp.Close()
 		log.Log(log.Error, "Failed to encode data to cache file '%s': %v", filePath, err)
 		return err
 	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		log.Log(log.Error, "Failed to sync cache file '%s': %v", tmpPath, err)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		log.Log(log.Error, "Failed to close cache file '%s': %v", tmpPath, err)
+		return err
+	}
+
+	rotateCacheBackup(filePath)
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		log.Log(log.Error, "Failed to replace cache file '%s': %v", filePath, err)
+		return err
+	}
+	syncDir(dir)
 
 	log.Log(log.Info, "Cache saved successfully to %s", filePath)
 	return nil
 }
 
+// rotateCacheBackup moves the current cache to filePath.bak, unless it is
+// corrupt, in which case the existing backup is the better copy to keep.
+func rotateCacheBackup(filePath string) {
+	if _, err := os.Stat(filePath); err != nil {
+		return
+	}
+	if _, err := readCachePayload(filePath); err != nil {
+		log.Log(log.Warn, "Cache file '%s' is corrupt (%v); keeping previous backup", filePath, err)
+		return
+	}
+	if err := os.Rename(filePath, filePath+cacheBackupSuffix); err != nil {
+		log.Log(log.Warn, "Failed to rotate cache backup for '%s': %v", filePath, err)
+	}
+}
+
+// syncDir flushes a directory entry so a rename survives a crash.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	_ = d.Sync()
+}
+
+// -----------------------------------------------------------------------------
+// CACHE ENVELOPE
+// -----------------------------------------------------------------------------
+//
+// Cache files are a JSON envelope around a gzip-compressed JSON payload. The
+// SHA-256 of the uncompressed payload guards against silent corruption, and
+// Version lets the payload format evolve: older payloads are passed through
+// the migrations registered for their cache file before being decoded. Files
+// written before the envelope existed are plain JSON and load as version 0.
+
+// cacheFormatVersion is the payload version written by SaveCache.
+const cacheFormatVersion = 1
+
+type cacheEnvelope struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Encoding  string    `json:"encoding"`
+	SHA256    string    `json:"sha256"`
+	Body      []byte    `json:"body"`
+}
+
+// CacheMigration upgrades a cache payload by one version.
+type CacheMigration func(payload []byte) ([]byte, error)
+
+var (
+	cacheMigrationsMu sync.RWMutex
+	cacheMigrations   = map[string]map[int]CacheMigration{}
+)
+
+// RegisterCacheMigration registers fn to upgrade payloads of the cache file
+// named name (e.g. "official.cache.json") from version from to from+1.
+// Versions without a registered migration are passed through unchanged.
+func RegisterCacheMigration(name string, from int, fn CacheMigration) {
+	if name == "" || fn == nil {
+		return
+	}
+	cacheMigrationsMu.Lock()
+	defer cacheMigrationsMu.Unlock()
+	if cacheMigrations[name] == nil {
+		cacheMigrations[name] = make(map[int]CacheMigration)
+	}
+	cacheMigrations[name][from] = fn
+}
+
+func writeCacheEnvelope(w io.Writer, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	if _, err := zw.Write(payload); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(payload)
+	return json.NewEncoder(w).Encode(cacheEnvelope{
+		Version:   cacheFormatVersion,
+		CreatedAt: time.Now().UTC(),
+		Encoding:  "gzip",
+		SHA256:    hex.EncodeToString(sum[:]),
+		Body:      body.Bytes(),
+	})
+}
+
+// readCachePayload reads filePath, verifies its envelope and returns the
+// payload migrated to cacheFormatVersion.
+func readCachePayload(filePath string) ([]byte, error) {
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid(raw) {
+		return nil, fmt.Errorf("decode %s: invalid JSON", filePath)
+	}
+
+	var env cacheEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil || (env.Body == nil && env.Version == 0) {
+		// Pre-envelope cache: the whole file is the version 0 payload.
+		return migrateCachePayload(filepath.Base(filePath), 0, raw)
+	}
+
+	if env.Version > cacheFormatVersion {
+		return nil, fmt.Errorf("decode %s: cache version %d is newer than supported version %d", filePath, env.Version, cacheFormatVersion)
+	}
+	payload, err := openCacheBody(env)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", filePath, err)
+	}
+	return migrateCachePayload(filepath.Base(filePath), env.Version, payload)
+}
+
+func openCacheBody(env cacheEnvelope) ([]byte, error) {
+	var payload []byte
+	switch env.Encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(env.Body))
+		if err != nil {
+			return nil, fmt.Errorf("open gzip body: %w", err)
+		}
+		defer zr.Close()
+		if payload, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("read gzip body: %w", err)
+		}
+	case "", "identity":
+		payload = env.Body
+	default:
+		return nil, fmt.Errorf("unsupported cache encoding %q", env.Encoding)
+	}
+
+	sum := sha256.Sum256(payload)
+	if got := hex.EncodeToString(sum[:]); got != env.SHA256 {
+		return nil, fmt.Errorf("checksum mismatch: got %s, want %s", got, env.SHA256)
+	}
+	return payload, nil
+}
+
+func migrateCachePayload(name string, version int, payload []byte) ([]byte, error) {
+	cacheMigrationsMu.RLock()
+	steps := cacheMigrations[name]
+	cacheMigrationsMu.RUnlock()
+
+	for v := version; v < cacheFormatVersion; v++ {
+		fn := steps[v]
+		if fn == nil {
+			continue
+		}
+		var err error
+		if payload, err = fn(payload); err != nil {
+			return nil, fmt.Errorf("migrate %s from version %d: %w", name, v, err)
+		}
+		log.Log(log.Info, "[cache] migrated %s from version %d to %d", name, v, v+1)
+	}
+	return payload, nil
+}
+
 func loadCachesFromFiles(officialFile, localFile string, useLocal bool) {
 	if !useLocal {
 		return
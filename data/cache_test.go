@@ -1,7 +1,10 @@
 package data
 
 import (
+	"encoding/json"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	cfg "github.com/ibp-network/ibp-geodns-libs/config"
@@ -138,3 +141,157 @@ func TestLoadCachesFromFilesRefreshesOfficialSnapshot(t *testing.T) {
 		t.Fatalf("expected local cache to load 1 site result, got %d", len(Local.SiteResults))
 	}
 }
+
+func TestSaveCacheKeepsBackupAndLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.cache.json")
+
+	if err := SaveCache(file, map[string]int{"v": 1}); err != nil {
+		t.Fatalf("first save: %v", err)
+	}
+	if err := SaveCache(file, map[string]int{"v": 2}); err != nil {
+		t.Fatalf("second save: %v", err)
+	}
+
+	var cur, bak map[string]int
+	if err := decodeCacheFile(file, &cur); err != nil || cur["v"] != 2 {
+		t.Fatalf("expected current cache v=2, got %v (err=%v)", cur, err)
+	}
+	if err := decodeCacheFile(file+cacheBackupSuffix, &bak); err != nil || bak["v"] != 1 {
+		t.Fatalf("expected backup cache v=1, got %v (err=%v)", bak, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Fatalf("unexpected leftover temp file %s", e.Name())
+		}
+	}
+}
+
+func TestLoadCacheFallsBackToBackupOnCorruption(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.cache.json")
+
+	if err := SaveCache(file, map[string]int{"v": 1}); err != nil {
+		t.Fatalf("first save: %v", err)
+	}
+	if err := SaveCache(file, map[string]int{"v": 2}); err != nil {
+		t.Fatalf("second save: %v", err)
+	}
+	if err := os.WriteFile(file, []byte(`{"v": 3`), 0644); err != nil {
+		t.Fatalf("corrupt cache: %v", err)
+	}
+
+	var got map[string]int
+	if err := LoadCache(file, &got); err != nil {
+		t.Fatalf("expected fallback to backup, got error %v", err)
+	}
+	if got["v"] != 1 {
+		t.Fatalf("expected backup value 1, got %v", got)
+	}
+
+	// A save over the corrupt file must not replace the good backup.
+	if err := SaveCache(file, map[string]int{"v": 4}); err != nil {
+		t.Fatalf("save after corruption: %v", err)
+	}
+	var bak map[string]int
+	if err := decodeCacheFile(file+cacheBackupSuffix, &bak); err != nil || bak["v"] != 1 {
+		t.Fatalf("expected backup to stay at v=1, got %v (err=%v)", bak, err)
+	}
+}
+
+func TestLoadCacheMissingFileIsNotAnError(t *testing.T) {
+	var got map[string]int
+	if err := LoadCache(filepath.Join(t.TempDir(), "missing.json"), &got); err != nil {
+		t.Fatalf("expected missing cache to be ignored, got %v", err)
+	}
+}
+
+func TestSaveCacheWritesCompressedEnvelope(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.cache.json")
+	if err := SaveCache(file, map[string]int{"v": 1}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var env cacheEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		t.Fatalf("expected JSON envelope: %v", err)
+	}
+	if env.Version != cacheFormatVersion || env.Encoding != "gzip" || env.SHA256 == "" || env.CreatedAt.IsZero() {
+		t.Fatalf("unexpected envelope header %+v", env)
+	}
+}
+
+func TestLoadCacheRejectsChecksumMismatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.cache.json")
+	if err := SaveCache(file, map[string]int{"v": 1}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	raw, _ := os.ReadFile(file)
+	var env cacheEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	env.SHA256 = strings.Repeat("0", 64)
+	tampered, _ := json.Marshal(env)
+	if err := os.WriteFile(file, tampered, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var got map[string]int
+	err := decodeCacheFile(file, &got)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestLoadCacheMigratesLegacyJSON(t *testing.T) {
+	dir := t.TempDir()
+	name := "legacy-test.cache.json"
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(`{"old": 7}`), 0644); err != nil {
+		t.Fatalf("write legacy cache: %v", err)
+	}
+
+	RegisterCacheMigration(name, 0, func(payload []byte) ([]byte, error) {
+		var old map[string]int
+		if err := json.Unmarshal(payload, &old); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]int{"v": old["old"]})
+	})
+	t.Cleanup(func() {
+		cacheMigrationsMu.Lock()
+		delete(cacheMigrations, name)
+		cacheMigrationsMu.Unlock()
+	})
+
+	var got map[string]int
+	if err := LoadCache(file, &got); err != nil {
+		t.Fatalf("load legacy: %v", err)
+	}
+	if got["v"] != 7 {
+		t.Fatalf("expected migrated value 7, got %v", got)
+	}
+}
+
+func TestLoadCacheRejectsNewerVersion(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.cache.json")
+	env, _ := json.Marshal(cacheEnvelope{Version: cacheFormatVersion + 1, Encoding: "gzip", Body: []byte{1}})
+	if err := os.WriteFile(file, env, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var got map[string]int
+	if err := decodeCacheFile(file, &got); err == nil {
+		t.Fatal("expected newer cache version to be rejected")
+	}
+}
@@ -28,7 +28,25 @@ func Init(opts InitOptions) {
 		go startAutoUpdate()
 	}
 
+	loadUsageConfig()
+	cfg.RegisterReloadHook(usageConfigReloadHook, loadUsageConfig)
+
+	if opts.UseUsageStats {
+		if err := openUsageJournal(usageJournalPath()); err != nil {
+			log.Log(log.Error, "[data.Init] usage journal: %v; hits are kept in memory only", err)
+		}
+		if files, err := usageSpillFiles(usageSpillPath()); err == nil {
+			countUsageSpill(files)
+		}
+	}
+
 	ensureUsageFlushOnce()
+	ensureStaleReaperOnce()
+	ensureStatusHistoryOnce()
+
+	cfg.RegisterReloadHook(pruneReloadHook, func() {
+		PruneRemoved(cfg.GetConfig())
+	})
 }
 
 var usageFlushOnce sync.Once
@@ -168,5 +186,9 @@ func startPeriodicUsageFlush() {
 		today := time.Now().UTC().Format("2006-01-02")
 		log.Log(log.Info, "[startPeriodicUsageFlush] Flushing usage for today: %s", today)
 		FlushUsageToDatabase(today)
+		if now := time.Now().UTC(); now.Hour() == 0 && now.Minute() < 5 {
+			RollupHourlyUsage()
+			ApplyUsageRetention()
+		}
 	}
 }
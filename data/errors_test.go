@@ -0,0 +1,30 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/data/eventstore"
+)
+
+func TestReversedRangesReturnErrInvalidDateRange(t *testing.T) {
+	start := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, -1)
+
+	if _, err := GetUsageByDomain("rpc.example", start, end); !errors.Is(err, ErrInvalidDateRange) {
+		t.Errorf("GetUsageByDomain: expected ErrInvalidDateRange, got %v", err)
+	}
+	if _, err := TopServices(start, end, 0); !errors.Is(err, ErrInvalidDateRange) {
+		t.Errorf("TopServices: expected ErrInvalidDateRange, got %v", err)
+	}
+	if _, err := GetMemberScoresBetween(start, end); !errors.Is(err, ErrInvalidDateRange) {
+		t.Errorf("GetMemberScoresBetween: expected ErrInvalidDateRange, got %v", err)
+	}
+}
+
+func TestEventStoreNotFoundIsErrNotFound(t *testing.T) {
+	if !errors.Is(eventstore.ErrNotFound, ErrNotFound) {
+		t.Fatal("expected eventstore.ErrNotFound to wrap ErrNotFound")
+	}
+}
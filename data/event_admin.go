@@ -0,0 +1,151 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/api"
+	"github.com/ibp-network/ibp-geodns-libs/data/eventstore"
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// MANUAL EVENT MANAGEMENT
+// -----------------------------------------------------------------------------
+//
+// CloseEvent, AnnotateEvent and ReclassifyEvent let operators fix events
+// without SQL: close an outage that stayed open, note why it happened or
+// mark it as scheduled or a false positive. Every change names its author,
+// is stored as an annotation on the event and is audit logged.
+
+// Event management actions.
+const (
+	EventActionClose      = "close"
+	EventActionAnnotate   = "annotate"
+	EventActionReclassify = "reclassify"
+)
+
+// EventAction is one manual change, as sent over NATS or REST.
+type EventAction struct {
+	Action         string `json:"action"`
+	EventID        int64  `json:"eventID"`
+	Author         string `json:"author"`
+	Note           string `json:"note,omitempty"`
+	Classification string `json:"classification,omitempty"`
+}
+
+var (
+	// ErrAuthorRequired is returned for changes that do not name their
+	// author.
+	ErrAuthorRequired = errors.New("author required")
+	// ErrUnknownEventAction is returned for an unsupported Action.
+	ErrUnknownEventAction = errors.New("unknown event action")
+)
+
+// CloseEvent ends the open event id now.
+func CloseEvent(id int64, author, reason string) (EventRecord, error) {
+	return ApplyEventAction(EventAction{Action: EventActionClose, EventID: id, Author: author, Note: reason})
+}
+
+// AnnotateEvent adds a note to event id.
+func AnnotateEvent(id int64, author, note string) (EventRecord, error) {
+	return ApplyEventAction(EventAction{Action: EventActionAnnotate, EventID: id, Author: author, Note: note})
+}
+
+// ReclassifyEvent sets the classification of event id, e.g.
+// eventstore.ClassScheduled.
+func ReclassifyEvent(id int64, class, author, note string) (EventRecord, error) {
+	return ApplyEventAction(EventAction{Action: EventActionReclassify, EventID: id, Author: author, Note: note, Classification: class})
+}
+
+// ApplyEventAction carries out a on the data connection and returns the
+// updated event.
+func ApplyEventAction(a EventAction) (EventRecord, error) {
+	return ApplyEventActionIn(mysql.Events(), a)
+}
+
+// ApplyEventActionIn is ApplyEventAction on store, e.g. data2.Events() on a
+// collator, which has no data connection.
+func ApplyEventActionIn(store *eventstore.Store, a EventAction) (EventRecord, error) {
+	a.Author = strings.TrimSpace(a.Author)
+	if a.Author == "" {
+		return EventRecord{}, ErrAuthorRequired
+	}
+	now := time.Now().UTC()
+	note := eventstore.Annotation{Time: now, Author: a.Author, Note: a.Note}
+
+	var (
+		ev  *eventstore.Event
+		err error
+	)
+	switch a.Action {
+	case EventActionClose:
+		note.Note = joinNote("closed manually", a.Note)
+		ev, err = store.CloseManual(a.EventID, now, note)
+	case EventActionAnnotate:
+		ev, err = store.Annotate(a.EventID, note)
+	case EventActionReclassify:
+		note.Note = joinNote("reclassified as "+a.Classification, a.Note)
+		ev, err = store.Reclassify(a.EventID, a.Classification, note)
+	default:
+		return EventRecord{}, fmt.Errorf("%w %q", ErrUnknownEventAction, a.Action)
+	}
+	if err != nil {
+		log.Log(log.Warn, "[events] audit: %s of event %d by %s failed: %v", a.Action, a.EventID, a.Author, err)
+		return EventRecord{}, err
+	}
+	log.Log(log.Info, "[events] audit: %s event %d (%s %s/%s) by %s: %s",
+		a.Action, a.EventID, ev.Member, ev.CheckType, ev.CheckName, a.Author, note.Note)
+	return eventRecord(*ev), nil
+}
+
+func joinNote(what, note string) string {
+	if note = strings.TrimSpace(note); note != "" {
+		return what + ": " + note
+	}
+	return what
+}
+
+// EventActionHandler exposes ApplyEventAction for a REST API. POST takes a
+// JSON EventAction and returns the updated event. Behind api.Require the
+// author is the API key name; otherwise the body must name one.
+func EventActionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var a EventAction
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&a); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if p, ok := api.PrincipalFromContext(r.Context()); ok {
+			a.Author = "api:" + p.Name
+		}
+
+		ev, err := ApplyEventAction(a)
+		switch {
+		case errors.Is(err, eventstore.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, eventstore.ErrNotOpen):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, ErrAuthorRequired), errors.Is(err, ErrUnknownEventAction), errors.Is(err, eventstore.ErrInvalidChange):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ev)
+	})
+}
@@ -0,0 +1,49 @@
+package data
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestApplyEventActionValidatesBeforeStore(t *testing.T) {
+	if _, err := ApplyEventAction(EventAction{Action: EventActionClose, EventID: 1, Author: "  "}); !errors.Is(err, ErrAuthorRequired) {
+		t.Fatalf("expected ErrAuthorRequired, got %v", err)
+	}
+	if _, err := ApplyEventAction(EventAction{Action: "delete", EventID: 1, Author: "ops"}); !errors.Is(err, ErrUnknownEventAction) {
+		t.Fatalf("expected ErrUnknownEventAction, got %v", err)
+	}
+}
+
+func TestEventActionHandlerRejectsBadRequests(t *testing.T) {
+	h := EventActionHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events/action", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "POST" {
+		t.Fatalf("expected 405 with Allow: POST, got %d", rec.Code)
+	}
+
+	for _, body := range []string{
+		`{"action":`,
+		`{"action":"close","eventID":1}`,
+		`{"action":"delete","eventID":1,"author":"ops"}`,
+	} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/events/action", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+}
+
+func TestJoinNote(t *testing.T) {
+	if got := joinNote("closed manually", "  "); got != "closed manually" {
+		t.Fatalf("unexpected note %q", got)
+	}
+	if got := joinNote("closed manually", "monitor stuck"); got != "closed manually: monitor stuck" {
+		t.Fatalf("unexpected note %q", got)
+	}
+}
@@ -1,147 +1,111 @@
 package data
 
 import (
-	"database/sql"
-	"encoding/json"
 	"time"
 
-	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-libs/data/eventstore"
 	"github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	"github.com/ibp-network/ibp-geodns-libs/internal/offlinegate"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
 )
 
-const defaultMinimumOfflineTime = 30 * time.Second
-
-func minimumOfflineDuration() time.Duration {
-	c := cfg.GetConfig()
-	if secs := c.Local.System.MinimumOfflineTime; secs > 0 {
-		return time.Duration(secs) * time.Second
-	}
-	return defaultMinimumOfflineTime
-}
-
-func validCheckType(checkType string) bool {
-	switch checkType {
-	case "site", "domain", "endpoint":
-		return true
-	default:
-		return false
-	}
-}
+// offlineEvents holds offline events until the outage exceeds
+// System.MinimumOfflineTime; shorter outages are never written.
+var offlineEvents = offlinegate.New(offlinegate.Minimum)
 
 func RecordEvent(checkType, checkName, memberName, domainName, endpoint string, status bool, errorText string, data map[string]interface{}, isIPv6 bool) {
-	if !validCheckType(checkType) {
+	if !eventstore.ValidCheckType(checkType) {
 		log.Log(log.Warn, "Skipping event with invalid check type %q for member=%s check=%s", checkType, memberName, checkName)
 		return
 	}
 
-	var additionalData string
-	if data != nil {
-		dataBytes, err := json.Marshal(data)
-		if err != nil {
-			log.Log(log.Warn, "Failed to marshal event additional data for %s %s %s: %v", memberName, checkType, checkName, err)
-		}
-		additionalData = string(dataBytes)
-	}
+	key := eventstore.Key{
+		CheckType: checkType,
+		CheckName: checkName,
+		Member:    memberName,
+		Domain:    domainName,
+		Endpoint:  endpoint,
+		IsIPv6:    isIPv6,
+	}.Normalize()
+	store := mysql.Events()
 
 	if status {
-		event, err := mysql.FindOpenOfflineEvent(memberName, checkType, checkName, domainName, endpoint, isIPv6)
-		if err != nil {
-			log.Log(log.Error, "Failed to check for existing offline event: %v", err)
+		if offlineEvents.Release(key.String()) {
+			log.Log(log.Info, "Dropped offline event shorter than the minimum for %s %s %s isIPv6=%v", memberName, checkType, checkName, isIPv6)
 			return
 		}
-		if event != nil {
-			now := time.Now().UTC()
-			duration := now.Sub(event.StartTime)
-			if duration < minimumOfflineDuration() {
-				err := mysql.DeleteEvent(event.ID)
-				if err != nil {
-					log.Log(log.Error, "Failed to delete short-duration event: %v", err)
-				} else {
-					log.Log(log.Info, "Deleted short-duration offline event for %s %s %s isIPv6=%v", memberName, checkType, checkName, isIPv6)
-				}
-				return
-			}
-			err = mysql.UpdateEventEndTime(event.ID, now)
-			if err != nil {
-				log.Log(log.Error, "Failed to update event end time: %v", err)
-				return
-			}
-			log.Log(log.Info, "Closed offline event for %s %s %s isIPv6=%v", memberName, checkType, checkName, isIPv6)
-		}
-	} else {
-		event, err := mysql.FindOpenOfflineEvent(memberName, checkType, checkName, domainName, endpoint, isIPv6)
+		closed, err := store.Close(key, time.Now().UTC())
 		if err != nil {
-			log.Log(log.Error, "Failed to check for existing offline event: %v", err)
+			log.Log(log.Error, "Failed to close offline event: %v", err)
 			return
 		}
-		if event == nil {
-			_, err := mysql.InsertEvent(mysql.EventRecord{
-				MemberName:     memberName,
-				CheckType:      checkType,
-				CheckName:      checkName,
-				DomainName:     sql.NullString{String: domainName, Valid: domainName != ""},
-				Endpoint:       sql.NullString{String: endpoint, Valid: endpoint != ""},
-				Status:         false,
-				StartTime:      time.Now().UTC(),
-				ErrorText:      sql.NullString{String: errorText, Valid: errorText != ""},
-				AdditionalData: sql.NullString{String: additionalData, Valid: additionalData != ""},
-				IsIPv6:         isIPv6,
-			})
-			if err != nil {
-				log.Log(log.Error, "Failed to insert offline event: %v", err)
-			} else {
-				log.Log(log.Info, "Recorded offline event for %s %s %s isIPv6=%v", memberName, checkType, checkName, isIPv6)
-			}
+		if closed > 0 {
+			log.Log(log.Info, "Closed offline event for %s %s %s isIPv6=%v", memberName, checkType, checkName, isIPv6)
 		}
+		return
+	}
+
+	event, err := store.FindOpen(key)
+	if err != nil {
+		log.Log(log.Error, "Failed to check for existing offline event: %v", err)
+		return
 	}
+	if event != nil {
+		return
+	}
+	ev := eventstore.Event{
+		Key:       key,
+		StartTime: time.Now().UTC(),
+		Error:     errorText,
+		Data:      data,
+	}
+	offlineEvents.Hold(key.String(), ev.StartTime, func() {
+		if _, err := store.Open(ev); err != nil {
+			log.Log(log.Error, "Failed to insert offline event: %v", err)
+		} else {
+			log.Log(log.Info, "Recorded offline event for %s %s %s isIPv6=%v", memberName, checkType, checkName, isIPv6)
+		}
+	})
 }
 
 func GetMemberEvents(memberName, domain string, start, end time.Time) ([]EventRecord, error) {
-	rows, err := mysql.FetchEvents(memberName, domain, start, end)
+	if err := checkRange("GetMemberEvents", start, end); err != nil {
+		return nil, err
+	}
+	rows, err := mysql.Events().Fetch(memberName, domain, start, end)
 	if err != nil {
 		return nil, err
 	}
 
 	events := make([]EventRecord, 0, len(rows))
 	for _, r := range rows {
-		var dataMap map[string]interface{}
-		if r.AdditionalData.Valid && r.AdditionalData.String != "" {
-			_ = json.Unmarshal([]byte(r.AdditionalData.String), &dataMap)
-		}
-		var domainName, endpoint, errText string
-		if r.DomainName.Valid {
-			domainName = r.DomainName.String
-		}
-		if r.Endpoint.Valid {
-			endpoint = r.Endpoint.String
-		}
-		if r.ErrorText.Valid {
-			errText = r.ErrorText.String
-		}
-
-		var endTime time.Time
-		var endDate string
-		if r.EndTime.Valid {
-			endTime = r.EndTime.Time
-			endDate = endTime.Format("2006-01-02")
-		}
-
-		events = append(events, EventRecord{
-			CheckType:  r.CheckType,
-			CheckName:  r.CheckName,
-			MemberName: r.MemberName,
-			DomainName: domainName,
-			Endpoint:   endpoint,
-			Status:     r.Status,
-			ErrorText:  errText,
-			Data:       dataMap,
-			StartTime:  r.StartTime,
-			EndTime:    endTime,
-			StartDate:  r.StartTime.Format("2006-01-02"),
-			EndDate:    endDate,
-			IsIPv6:     r.IsIPv6,
-		})
+		events = append(events, eventRecord(r))
 	}
 	return events, nil
 }
+
+func eventRecord(r eventstore.Event) EventRecord {
+	var endTime time.Time
+	var endDate string
+	if r.EndTime.Valid {
+		endTime = r.EndTime.Time
+		endDate = endTime.Format("2006-01-02")
+	}
+	return EventRecord{
+		ID:         r.ID,
+		CheckType:  r.CheckType,
+		CheckName:  r.CheckName,
+		MemberName: r.Member,
+		DomainName: r.Domain,
+		Endpoint:   r.Endpoint,
+		Status:     r.Status,
+		ErrorText:  r.Error,
+		Data:       r.Data,
+		Votes:      r.Votes,
+		StartTime:  r.StartTime,
+		EndTime:    endTime,
+		StartDate:  r.StartTime.Format("2006-01-02"),
+		EndDate:    endDate,
+		IsIPv6:     r.IsIPv6,
+	}
+}
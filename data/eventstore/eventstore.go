@@ -0,0 +1,448 @@
+// Package eventstore is the single repository for the member_events table.
+// Monitors (data.RecordEvent) and collators (data2.InsertNetStatus) both
+// write through it, so every row follows one convention:
+//
+//   - check_type is the string "site", "domain" or "endpoint"
+//   - domain_name and endpoint are empty strings, never NULL; site events
+//     carry neither and domain events carry no endpoint
+//   - a row is one offline event: status is always 0 and the event is closed
+//     by setting end_time
+//   - a check has at most one open event: opening checks for one and
+//     inserts in a single locking transaction, and the uniq_open_event
+//     index (see internal/eventschema) backs this up in the database
+//   - intervals of one check never overlap
+//
+// Lookups also match rows written before this convention, whose empty
+// columns may be NULL.
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/stmtcache"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Key identifies the check an event belongs to.
+type Key struct {
+	CheckType string
+	CheckName string
+	Member    string
+	Domain    string
+	Endpoint  string
+	IsIPv6    bool
+}
+
+// String returns a stable identifier for k, for use as a map key.
+func (k Key) String() string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s|%t", k.CheckType, k.CheckName, k.Member, k.Domain, k.Endpoint, k.IsIPv6)
+}
+
+// Event is one member_events row.
+type Event struct {
+	ID int64
+	Key
+	Status    bool
+	StartTime time.Time
+	EndTime   sql.NullTime
+	Error     string
+	Votes     map[string]bool        // monitor node ID → agreed
+	Data      map[string]interface{} // additional_data
+	// ProposalID is the consensus proposal that opened the event. Collators
+	// set it so the same finalize written by two of them is stored once;
+	// Open only writes it.
+	ProposalID string
+}
+
+// ErrDuplicateProposal is returned by Open for a proposal that already
+// opened an event, e.g. one written by another collator.
+var ErrDuplicateProposal = errors.New("proposal already recorded")
+
+// erDupEntry is MySQL's duplicate-key error number.
+const erDupEntry = 1062
+
+func isDuplicateKey(err error) bool {
+	var myErr *mysql.MySQLError
+	return errors.As(err, &myErr) && myErr.Number == erDupEntry
+}
+
+// ValidCheckType reports whether t is a check type the table stores.
+func ValidCheckType(t string) bool {
+	switch t {
+	case "site", "domain", "endpoint":
+		return true
+	default:
+		return false
+	}
+}
+
+// Normalize clears the columns that do not apply to k's check type.
+func (k Key) Normalize() Key {
+	switch k.CheckType {
+	case "site":
+		k.Domain, k.Endpoint = "", ""
+	case "domain":
+		k.Endpoint = ""
+	}
+	return k
+}
+
+// Store reads and writes member_events on db. onWrite, when set, is called
+// after every successful write.
+type Store struct {
+	db      *sql.DB
+	onWrite func()
+}
+
+// New returns a store backed by db.
+func New(db *sql.DB, onWrite func()) *Store {
+	return &Store{db: db, onWrite: onWrite}
+}
+
+func (s *Store) wrote() {
+	if s.onWrite != nil {
+		s.onWrite()
+	}
+}
+
+const selectColumns = `id, check_type, check_name, member_name,
+	COALESCE(domain_name, ''), COALESCE(endpoint, ''), status, is_ipv6,
+	start_time, end_time, COALESCE(error, ''), vote_data, additional_data`
+
+// keyClause matches k's columns; the COALESCE calls cover legacy NULLs.
+func keyClause(k Key) (string, []interface{}) {
+	q := `check_type = ? AND check_name = ? AND member_name = ? AND is_ipv6 = ?`
+	args := []interface{}{k.CheckType, k.CheckName, k.Member, k.IsIPv6}
+	switch k.CheckType {
+	case "domain":
+		q += ` AND COALESCE(domain_name, '') = ?`
+		args = append(args, k.Domain)
+	case "endpoint":
+		q += ` AND COALESCE(domain_name, '') = ? AND COALESCE(endpoint, '') = ?`
+		args = append(args, k.Domain, k.Endpoint)
+	}
+	return q, args
+}
+
+// Open records the start of an offline event. It returns 1 when a new row
+// was created and 0 when the key already had an open event, whose error and
+// votes are refreshed instead. The check for an open event and the insert
+// run in one transaction holding the key's rows with SELECT ... FOR UPDATE,
+// so concurrent writers cannot open two events for the same check, and the
+// start is moved past the end of the previous event so intervals never
+// overlap. An event whose ProposalID is already stored returns
+// ErrDuplicateProposal and writes nothing.
+func (s *Store) Open(ev Event) (int64, error) {
+	if !ValidCheckType(ev.CheckType) {
+		return 0, fmt.Errorf("unsupported check type %q", ev.CheckType)
+	}
+	k := ev.Key.Normalize()
+
+	votes, err := encodeJSON(ev.Votes)
+	if err != nil {
+		return 0, fmt.Errorf("marshal vote data: %w", err)
+	}
+	extra, err := encodeJSON(ev.Data)
+	if err != nil {
+		return 0, fmt.Errorf("marshal additional data: %w", err)
+	}
+
+	var created int64
+	err = s.inTx(func(stx stmtcache.Tx) error {
+		if ev.ProposalID != "" {
+			var dupID int64
+			err := stx.QueryRowScan(`SELECT id FROM member_events WHERE proposal_id = ? FOR UPDATE`,
+				[]any{ev.ProposalID}, &dupID)
+			switch {
+			case err == nil:
+				return fmt.Errorf("%w: proposal %s is event %d", ErrDuplicateProposal, ev.ProposalID, dupID)
+			case !errors.Is(err, sql.ErrNoRows):
+				return fmt.Errorf("lock proposal %s: %w", ev.ProposalID, err)
+			}
+		}
+
+		where, args := keyClause(k)
+
+		var openID int64
+		err := stx.QueryRowScan(`SELECT id FROM member_events
+			WHERE `+where+` AND status = 0 AND end_time IS NULL
+			ORDER BY start_time DESC LIMIT 1 FOR UPDATE`, args, &openID)
+		switch {
+		case err == nil:
+			_, err = stx.Exec(`UPDATE member_events
+				SET error = ?, vote_data = COALESCE(?, vote_data)
+				WHERE id = ?`, nullString(ev.Error), votes, openID)
+			if err != nil {
+				return fmt.Errorf("refresh open event %d: %w", openID, err)
+			}
+			return nil
+		case !errors.Is(err, sql.ErrNoRows):
+			return fmt.Errorf("lock open event: %w", err)
+		}
+
+		var lastEnd sql.NullTime
+		if err := stx.QueryRowScan(`SELECT MAX(end_time) FROM member_events
+			WHERE `+where+` FOR UPDATE`, args, &lastEnd); err != nil {
+			return fmt.Errorf("lock previous event: %w", err)
+		}
+
+		// A proposal's insert must fail on the uniq_proposal index rather
+		// than update the row another collator stored for it.
+		query := `INSERT INTO member_events
+			(check_type, check_name, endpoint, domain_name, member_name, status, is_ipv6, start_time, error, vote_data, additional_data, proposal_id)
+			VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?, ?, ?)`
+		if ev.ProposalID == "" {
+			query += `
+			ON DUPLICATE KEY UPDATE
+			  error     = VALUES(error),
+			  vote_data = COALESCE(VALUES(vote_data), vote_data)`
+		}
+		res, err := stx.Exec(query,
+			k.CheckType, k.CheckName, k.Endpoint, k.Domain, k.Member, k.IsIPv6,
+			openStart(ev.StartTime, lastEnd), nullString(ev.Error), votes, extra, nullString(ev.ProposalID),
+		)
+		if isDuplicateKey(err) && ev.ProposalID != "" {
+			// Another collator stored the proposal, or opened the
+			// check's event, since the checks above.
+			return fmt.Errorf("%w: proposal %s: %v", ErrDuplicateProposal, ev.ProposalID, err)
+		}
+		if err != nil {
+			return fmt.Errorf("insert event: %w", err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 1 {
+			created = 1
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.wrote()
+	return created, nil
+}
+
+// Close ends the open offline event for k at endTime and returns how many
+// rows it closed. The open event is locked while it is closed, and the end
+// is never set before the event's start.
+func (s *Store) Close(k Key, endTime time.Time) (int64, error) {
+	k = k.Normalize()
+
+	var closed int64
+	err := s.inTx(func(stx stmtcache.Tx) error {
+		where, args := keyClause(k)
+		rows, err := stx.Query(`SELECT id, start_time FROM member_events
+			WHERE `+where+` AND status = 0 AND end_time IS NULL FOR UPDATE`, args...)
+		if err != nil {
+			return fmt.Errorf("lock open events: %w", err)
+		}
+		type openRow struct {
+			id    int64
+			start time.Time
+		}
+		var open []openRow
+		for rows.Next() {
+			var r openRow
+			if err := rows.Scan(&r.id, &r.start); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan open event: %w", err)
+			}
+			open = append(open, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("iterate open events: %w", err)
+		}
+
+		for _, r := range open {
+			if _, err := stx.Exec(`UPDATE member_events SET end_time = ? WHERE id = ?`,
+				closeEnd(endTime, r.start), r.id); err != nil {
+				return fmt.Errorf("close event %d: %w", r.id, err)
+			}
+			closed++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.wrote()
+	return closed, nil
+}
+
+// inTx runs fn in a transaction, committing when it returns nil. fn runs
+// its queries as cached prepared statements.
+func (s *Store) inTx(fn func(stx stmtcache.Tx) error) error {
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	if err := fn(stmtcache.InTx(s.db, tx)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// openStart moves a new event's start past the end of the key's previous
+// event.
+func openStart(start time.Time, lastEnd sql.NullTime) time.Time {
+	start = start.UTC()
+	if lastEnd.Valid && lastEnd.Time.After(start) {
+		return lastEnd.Time.UTC()
+	}
+	return start
+}
+
+// closeEnd keeps an event's end from preceding its start.
+func closeEnd(end, start time.Time) time.Time {
+	end = end.UTC()
+	if end.Before(start) {
+		return start.UTC()
+	}
+	return end
+}
+
+// CloseByID ends the event with the given ID at endTime.
+func (s *Store) CloseByID(id int64, endTime time.Time) error {
+	if _, err := s.db.Exec(`UPDATE member_events SET end_time = ? WHERE id = ?`, endTime.UTC(), id); err != nil {
+		return fmt.Errorf("failed to update end time of event %d: %w", id, err)
+	}
+	s.wrote()
+	return nil
+}
+
+// Delete removes the event with the given ID.
+func (s *Store) Delete(id int64) error {
+	if _, err := s.db.Exec(`DELETE FROM member_events WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete event with ID %d: %w", id, err)
+	}
+	s.wrote()
+	return nil
+}
+
+// FindOpen returns the open offline event for k, or nil when there is none.
+func (s *Store) FindOpen(k Key) (*Event, error) {
+	if !ValidCheckType(k.CheckType) {
+		return nil, fmt.Errorf("unsupported check type %q", k.CheckType)
+	}
+	where, args := keyClause(k.Normalize())
+	rows, err := stmtcache.Query(s.db, `SELECT `+selectColumns+` FROM member_events
+		WHERE `+where+` AND status = 0 AND end_time IS NULL
+		ORDER BY start_time DESC LIMIT 1`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find open offline event: %w", err)
+	}
+	events, err := scanEvents(rows)
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return &events[0], nil
+}
+
+// Fetch returns the events of member that started within [start, end],
+// optionally limited to one domain, ordered by start time.
+func (s *Store) Fetch(member, domain string, start, end time.Time) ([]Event, error) {
+	q := `SELECT ` + selectColumns + ` FROM member_events
+		WHERE member_name = ? AND start_time >= ? AND start_time <= ?`
+	args := []interface{}{member, start, end}
+	if domain != "" {
+		q += ` AND domain_name = ?`
+		args = append(args, domain)
+	}
+	rows, err := s.db.Query(q+` ORDER BY start_time`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch events: %w", err)
+	}
+	return scanEvents(rows)
+}
+
+// FetchOffline returns the offline events of every member that overlap
+// [start, end], including those still open.
+func (s *Store) FetchOffline(start, end time.Time) ([]Event, error) {
+	rows, err := s.db.Query(`SELECT `+selectColumns+` FROM member_events
+		WHERE status = 0 AND start_time <= ? AND (end_time IS NULL OR end_time >= ?)
+		ORDER BY start_time`, end, start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch offline events: %w", err)
+	}
+	return scanEvents(rows)
+}
+
+// FetchOpen returns every offline event that has not ended yet.
+func (s *Store) FetchOpen() ([]Event, error) {
+	rows, err := s.db.Query(`SELECT ` + selectColumns + ` FROM member_events
+		WHERE status = 0 AND end_time IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch open events: %w", err)
+	}
+	return scanEvents(rows)
+}
+
+func scanEvents(rows *sql.Rows) ([]Event, error) {
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var (
+			ev           Event
+			votes, extra sql.NullString
+		)
+		if err := rows.Scan(
+			&ev.ID,
+			&ev.CheckType,
+			&ev.CheckName,
+			&ev.Member,
+			&ev.Domain,
+			&ev.Endpoint,
+			&ev.Status,
+			&ev.IsIPv6,
+			&ev.StartTime,
+			&ev.EndTime,
+			&ev.Error,
+			&votes,
+			&extra,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan event row: %w", err)
+		}
+		decodeJSON(votes, &ev.Votes)
+		decodeJSON(extra, &ev.Data)
+		events = append(events, ev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return events, nil
+}
+
+// encodeJSON marshals v, storing empty maps as NULL.
+func encodeJSON[M ~map[string]V, V any](v M) (sql.NullString, error) {
+	if len(v) == 0 {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// decodeJSON unmarshals a JSON column into dst, ignoring NULL, "null" and
+// malformed values.
+func decodeJSON(col sql.NullString, dst interface{}) {
+	if col.Valid && col.String != "" {
+		_ = json.Unmarshal([]byte(col.String), dst)
+	}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,119 @@
+package eventstore
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeDropsColumnsThatDoNotApply(t *testing.T) {
+	k := Key{CheckType: "site", CheckName: "ping", Member: "m", Domain: "rpc.example", Endpoint: "wss://rpc.example"}
+	if n := k.Normalize(); n.Domain != "" || n.Endpoint != "" {
+		t.Fatalf("expected site key without domain and endpoint, got %+v", n)
+	}
+
+	k.CheckType = "domain"
+	if n := k.Normalize(); n.Domain != "rpc.example" || n.Endpoint != "" {
+		t.Fatalf("expected domain key without endpoint, got %+v", n)
+	}
+
+	k.CheckType = "endpoint"
+	if n := k.Normalize(); n != k {
+		t.Fatalf("expected endpoint key unchanged, got %+v", n)
+	}
+}
+
+func TestMonitorAndCollatorKeysAgree(t *testing.T) {
+	// data2 passes the domain as the check URL of domain checks while the
+	// monitor path leaves the endpoint empty; both must address one row.
+	collator := Key{CheckType: "domain", CheckName: "dns", Member: "m", Domain: "rpc.example", Endpoint: "rpc.example"}.Normalize()
+	monitor := Key{CheckType: "domain", CheckName: "dns", Member: "m", Domain: "rpc.example"}.Normalize()
+	if collator.String() != monitor.String() {
+		t.Fatalf("expected matching keys, got %q and %q", collator, monitor)
+	}
+}
+
+func TestKeyClauseMatchesOnlyRelevantColumns(t *testing.T) {
+	q, args := keyClause(Key{CheckType: "site", CheckName: "ping", Member: "m"})
+	if strings.Contains(q, "domain_name") || len(args) != 4 {
+		t.Fatalf("expected site clause on four columns, got %q %v", q, args)
+	}
+	q, args = keyClause(Key{CheckType: "endpoint", CheckName: "wss", Member: "m", Domain: "d", Endpoint: "e"})
+	if !strings.Contains(q, "COALESCE(endpoint, '')") || len(args) != 6 {
+		t.Fatalf("expected endpoint clause on six columns, got %q %v", q, args)
+	}
+}
+
+func TestJSONColumns(t *testing.T) {
+	col, err := encodeJSON(map[string]bool{})
+	if err != nil || col.Valid {
+		t.Fatalf("expected empty map stored as NULL, got %+v %v", col, err)
+	}
+
+	col, err = encodeJSON(map[string]bool{"monitor-a": true})
+	if err != nil || !col.Valid {
+		t.Fatalf("expected encoded votes, got %+v %v", col, err)
+	}
+	var votes map[string]bool
+	decodeJSON(col, &votes)
+	if !votes["monitor-a"] {
+		t.Fatalf("expected round-tripped votes, got %v", votes)
+	}
+
+	var data map[string]interface{}
+	decodeJSON(sql.NullString{String: "null", Valid: true}, &data)
+	decodeJSON(sql.NullString{String: "{bad", Valid: true}, &data)
+	if data != nil {
+		t.Fatalf("expected null and malformed JSON ignored, got %v", data)
+	}
+}
+
+func TestOpenStartFollowsPreviousEnd(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	if got := openStart(start, sql.NullTime{}); !got.Equal(start) {
+		t.Fatalf("expected start unchanged without a previous event, got %v", got)
+	}
+	if got := openStart(start, sql.NullTime{Time: start.Add(-time.Minute), Valid: true}); !got.Equal(start) {
+		t.Fatalf("expected start unchanged after an earlier end, got %v", got)
+	}
+	later := start.Add(time.Minute)
+	if got := openStart(start, sql.NullTime{Time: later, Valid: true}); !got.Equal(later) {
+		t.Fatalf("expected start moved to previous end %v, got %v", later, got)
+	}
+}
+
+func TestCloseEndNotBeforeStart(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	if got := closeEnd(start.Add(-time.Second), start); !got.Equal(start) {
+		t.Fatalf("expected end clamped to start, got %v", got)
+	}
+	if got := closeEnd(start.Add(time.Hour), start); !got.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expected end unchanged, got %v", got)
+	}
+}
+
+func TestAnnotationsAndClassification(t *testing.T) {
+	var ev Event
+	if ev.Classification() != ClassOutage || ev.Annotations() != nil {
+		t.Fatalf("expected unannotated outage, got %q %v", ev.Classification(), ev.Annotations())
+	}
+
+	// Stored annotations come back from additional_data as generic JSON.
+	ev.Data = map[string]interface{}{
+		dataAnnotations:    []interface{}{map[string]interface{}{"author": "ops", "note": "first", "time": "2026-01-02T03:04:05Z"}},
+		dataClassification: ClassScheduled,
+	}
+	ev.annotate(Annotation{Author: "api:admin", Note: "second"})
+
+	got := ev.Annotations()
+	if len(got) != 2 || got[0].Author != "ops" || got[0].Time.IsZero() || got[1].Note != "second" {
+		t.Fatalf("expected both annotations in order, got %+v", got)
+	}
+	if ev.Classification() != ClassScheduled {
+		t.Fatalf("expected scheduled classification, got %q", ev.Classification())
+	}
+	if ValidClassification("maintenance") || !ValidClassification(ClassFalsePositive) {
+		t.Fatal("unexpected ValidClassification result")
+	}
+}
@@ -0,0 +1,183 @@
+package eventstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
+	"github.com/ibp-network/ibp-geodns-libs/internal/stmtcache"
+)
+
+// -----------------------------------------------------------------------------
+// MANUAL CHANGES
+// -----------------------------------------------------------------------------
+//
+// Operators close stuck events, annotate them and reclassify them (e.g. as a
+// scheduled maintenance) through these methods instead of editing rows by
+// hand. Annotations and the classification live in additional_data, so the
+// table needs no new columns; every change adds an annotation naming its
+// author.
+
+// Event classifications. Events without one are outages.
+const (
+	ClassOutage        = "outage"
+	ClassScheduled     = "scheduled"
+	ClassFalsePositive = "false-positive"
+
+	dataAnnotations    = "annotations"
+	dataClassification = "classification"
+)
+
+var (
+	// ErrNotFound is returned for an event ID without a row.
+	ErrNotFound = fmt.Errorf("event %w", errdefs.ErrNotFound)
+	// ErrNotOpen is returned when closing an event that has already ended.
+	ErrNotOpen = errors.New("event is not open")
+	// ErrInvalidChange is returned for an empty annotation or an unknown
+	// classification.
+	ErrInvalidChange = errors.New("invalid event change")
+)
+
+// Annotation is an operator note on an event.
+type Annotation struct {
+	Time   time.Time `json:"time"`
+	Author string    `json:"author"`
+	Note   string    `json:"note"`
+}
+
+// ValidClassification reports whether c is a known classification.
+func ValidClassification(c string) bool {
+	switch c {
+	case ClassOutage, ClassScheduled, ClassFalsePositive:
+		return true
+	default:
+		return false
+	}
+}
+
+// Classification returns the event's classification, ClassOutage unless it
+// was reclassified.
+func (e Event) Classification() string {
+	if c, ok := e.Data[dataClassification].(string); ok && c != "" {
+		return c
+	}
+	return ClassOutage
+}
+
+// Annotations returns the operator notes of the event, oldest first.
+func (e Event) Annotations() []Annotation {
+	raw, ok := e.Data[dataAnnotations]
+	if !ok {
+		return nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var out []Annotation
+	_ = json.Unmarshal(b, &out)
+	return out
+}
+
+func (e *Event) annotate(a Annotation) {
+	if e.Data == nil {
+		e.Data = make(map[string]interface{})
+	}
+	e.Data[dataAnnotations] = append(e.Annotations(), a)
+}
+
+// Get returns the event with the given ID.
+func (s *Store) Get(id int64) (*Event, error) {
+	rows, err := s.db.Query(`SELECT `+selectColumns+` FROM member_events WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event %d: %w", id, err)
+	}
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, ErrNotFound
+	}
+	return &events[0], nil
+}
+
+// CloseManual ends the open event id at endTime (not before its start) and
+// records a.
+func (s *Store) CloseManual(id int64, endTime time.Time, a Annotation) (*Event, error) {
+	return s.update(id, func(ev *Event) error {
+		if ev.EndTime.Valid {
+			return ErrNotOpen
+		}
+		ev.EndTime = sql.NullTime{Time: closeEnd(endTime, ev.StartTime), Valid: true}
+		ev.annotate(a)
+		return nil
+	})
+}
+
+// Annotate adds a to the event id.
+func (s *Store) Annotate(id int64, a Annotation) (*Event, error) {
+	if strings.TrimSpace(a.Note) == "" {
+		return nil, fmt.Errorf("%w: empty annotation", ErrInvalidChange)
+	}
+	return s.update(id, func(ev *Event) error {
+		ev.annotate(a)
+		return nil
+	})
+}
+
+// Reclassify sets the classification of the event id and records a.
+func (s *Store) Reclassify(id int64, class string, a Annotation) (*Event, error) {
+	if !ValidClassification(class) {
+		return nil, fmt.Errorf("%w: unknown classification %q", ErrInvalidChange, class)
+	}
+	return s.update(id, func(ev *Event) error {
+		if ev.Data == nil {
+			ev.Data = make(map[string]interface{})
+		}
+		ev.Data[dataClassification] = class
+		ev.annotate(a)
+		return nil
+	})
+}
+
+// update locks the event id, applies fn and writes back its end time and
+// additional data.
+func (s *Store) update(id int64, fn func(ev *Event) error) (*Event, error) {
+	var ev Event
+	err := s.inTx(func(stx stmtcache.Tx) error {
+		rows, err := stx.Query(`SELECT `+selectColumns+` FROM member_events WHERE id = ? FOR UPDATE`, id)
+		if err != nil {
+			return fmt.Errorf("lock event %d: %w", id, err)
+		}
+		events, err := scanEvents(rows)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return ErrNotFound
+		}
+		ev = events[0]
+		if err := fn(&ev); err != nil {
+			return err
+		}
+		extra, err := encodeJSON(ev.Data)
+		if err != nil {
+			return fmt.Errorf("marshal additional data: %w", err)
+		}
+		if _, err := stx.Exec(`UPDATE member_events SET end_time = ?, additional_data = ? WHERE id = ?`,
+			ev.EndTime, extra, id); err != nil {
+			return fmt.Errorf("update event %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.wrote()
+	return &ev, nil
+}
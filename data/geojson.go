@@ -0,0 +1,128 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+)
+
+// -----------------------------------------------------------------------------
+// GEOJSON EXPORT
+// -----------------------------------------------------------------------------
+//
+// UsageGeoJSON turns the hits of a period into one GeoJSON point feature per
+// country, placed at the country's centroid in the MaxMind City database, for
+// traffic heatmaps. Countries without a centroid keep a null geometry.
+
+// GeoJSONFeatureCollection is a GeoJSON (RFC 7946) FeatureCollection.
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature is a GeoJSON Feature with point geometry.
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   *GeoJSONPoint          `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONPoint is a GeoJSON Point; Coordinates are longitude, latitude.
+type GeoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// UsageGeoJSON returns the hits per country between start and end on domain,
+// or on every domain when it is empty.
+func UsageGeoJSON(domain string, start, end time.Time) (GeoJSONFeatureCollection, error) {
+	q := `
+SELECT country_code, MAX(country_name), SUM(hits) AS total
+FROM requests
+WHERE date BETWEEN ? AND ?
+  AND country_code <> ''
+`
+	args := []interface{}{start.Format("2006-01-02"), end.Format("2006-01-02")}
+	if domain != "" {
+		q += "  AND domain_name = ?\n"
+		args = append(args, domain)
+	}
+	q += `GROUP BY country_code
+ORDER BY total DESC, country_code
+`
+	totals, err := queryUsageTotals(q, args...)
+	if err != nil {
+		return GeoJSONFeatureCollection{}, fmt.Errorf("UsageGeoJSON: %w", err)
+	}
+	return buildUsageGeoJSON(totals, max.CountryCentroid), nil
+}
+
+func buildUsageGeoJSON(totals []UsageTotal, centroid func(string) (max.Coordinates, bool)) GeoJSONFeatureCollection {
+	var sum int64
+	for _, t := range totals {
+		sum += t.Hits
+	}
+
+	fc := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]GeoJSONFeature, 0, len(totals))}
+	for _, t := range totals {
+		f := GeoJSONFeature{
+			Type: "Feature",
+			Properties: map[string]interface{}{
+				"countryCode": t.Key,
+				"countryName": t.Name,
+				"hits":        t.Hits,
+				"share":       math.Round(10000*float64(t.Hits)/float64(sum)) / 10000,
+			},
+		}
+		if c, ok := centroid(t.Key); ok {
+			f.Geometry = &GeoJSONPoint{Type: "Point", Coordinates: [2]float64{c.Longitude, c.Latitude}}
+		}
+		fc.Features = append(fc.Features, f)
+	}
+	return fc
+}
+
+// UsageGeoJSONHandler serves UsageGeoJSON for a REST API. GET takes domain
+// (optional), start and end (YYYY-MM-DD, default the last 30 days) as query
+// parameters. Authentication is left to the API that mounts the handler.
+func UsageGeoJSONHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		end := time.Now().UTC()
+		start := end.AddDate(0, 0, -30)
+		var err error
+		if v := q.Get("start"); v != "" {
+			if start, err = time.Parse("2006-01-02", v); err != nil {
+				http.Error(w, "invalid start: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if v := q.Get("end"); v != "" {
+			if end, err = time.Parse("2006-01-02", v); err != nil {
+				http.Error(w, "invalid end: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if end.Before(start) {
+			http.Error(w, "end before start", http.StatusBadRequest)
+			return
+		}
+
+		fc, err := UsageGeoJSON(q.Get("domain"), start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/geo+json")
+		_ = json.NewEncoder(w).Encode(fc)
+	})
+}
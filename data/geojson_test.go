@@ -0,0 +1,62 @@
+package data
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+)
+
+func TestBuildUsageGeoJSON(t *testing.T) {
+	centroid := func(code string) (max.Coordinates, bool) {
+		if code == "DE" {
+			return max.Coordinates{Latitude: 51, Longitude: 10}, true
+		}
+		return max.Coordinates{}, false
+	}
+	fc := buildUsageGeoJSON([]UsageTotal{
+		{Key: "DE", Name: "Germany", Hits: 75},
+		{Key: "??", Name: "Unknown", Hits: 25},
+	}, centroid)
+
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 2 {
+		t.Fatalf("expected two features, got %+v", fc)
+	}
+	de := fc.Features[0]
+	if de.Geometry == nil || de.Geometry.Coordinates != [2]float64{10, 51} {
+		t.Fatalf("expected DE point at lon 10 lat 51, got %+v", de.Geometry)
+	}
+	if de.Properties["share"] != 0.75 || de.Properties["hits"] != int64(75) {
+		t.Fatalf("expected hits and share properties, got %v", de.Properties)
+	}
+	if fc.Features[1].Geometry != nil {
+		t.Fatal("expected null geometry without a centroid")
+	}
+
+	raw, _ := json.Marshal(fc.Features[1])
+	if !strings.Contains(string(raw), `"geometry":null`) {
+		t.Fatalf("expected null geometry in JSON, got %s", raw)
+	}
+}
+
+func TestUsageGeoJSONHandlerValidatesParameters(t *testing.T) {
+	h := UsageGeoJSONHandler()
+	for target, want := range map[string]int{
+		"/?start=yesterday":                 http.StatusBadRequest,
+		"/?start=2025-02-01&end=2025-01-01": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Fatalf("%s: expected %d, got %d", target, want, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for POST, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// LATENCY
+// -----------------------------------------------------------------------------
+//
+// Checks report their response time in the result data under LatencyDataKey
+// (milliseconds); the update functions copy it into Result.Latency. Monitors
+// publish these measurements over NATS, and DNS nodes feed the ones they
+// receive into RecordLatency so routing can ask MemberLatency for a member's
+// recent response time. Samples from monitors with a region are also kept
+// per region, for MemberRegionLatency.
+
+// LatencyDataKey is the result data key holding the response time in
+// milliseconds.
+const LatencyDataKey = "latencyMs"
+
+const (
+	// latencyMaxAge drops measurements no monitor has refreshed recently.
+	latencyMaxAge = 15 * time.Minute
+
+	// latencySmoothing is the weight of a new sample in the moving average.
+	latencySmoothing = 0.3
+)
+
+// LatencyFromData returns the response time stored in data, or zero when it
+// is missing or not a non-negative number.
+func LatencyFromData(data map[string]interface{}) time.Duration {
+	ms, ok := toFloat(data[LatencyDataKey])
+	if !ok || ms < 0 || math.IsNaN(ms) || math.IsInf(ms, 0) {
+		return 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case time.Duration:
+		return float64(n) / float64(time.Millisecond), true
+	default:
+		return 0, false
+	}
+}
+
+type latencyKey struct {
+	region string
+	member string
+	domain string
+	ipv6   bool
+}
+
+type latencyEntry struct {
+	avg     time.Duration
+	updated time.Time
+}
+
+var memberLatency = struct {
+	mu      sync.RWMutex
+	entries map[latencyKey]latencyEntry
+}{entries: make(map[latencyKey]latencyEntry)}
+
+// RecordLatency folds one measurement of member serving domain into the
+// moving average used by MemberLatency. Site checks pass an empty domain.
+func RecordLatency(member, domain string, isIPv6 bool, latency time.Duration, measured time.Time) {
+	RecordRegionLatency("", member, domain, isIPv6, latency, measured)
+}
+
+// RecordRegionLatency records a measurement taken by a monitor in region,
+// both for region and for MemberLatency.
+func RecordRegionLatency(region, member, domain string, isIPv6 bool, latency time.Duration, measured time.Time) {
+	if member == "" || latency <= 0 {
+		return
+	}
+	k := latencyKey{member: member, domain: strings.ToLower(domain), ipv6: isIPv6}
+
+	memberLatency.mu.Lock()
+	defer memberLatency.mu.Unlock()
+	foldLatencyLocked(k, latency, measured)
+	if region = strings.ToLower(strings.TrimSpace(region)); region != "" {
+		k.region = region
+		foldLatencyLocked(k, latency, measured)
+	}
+}
+
+func foldLatencyLocked(k latencyKey, latency time.Duration, measured time.Time) {
+	e, ok := memberLatency.entries[k]
+	if !ok || measured.Sub(e.updated) > latencyMaxAge {
+		e.avg = latency
+	} else {
+		e.avg = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(e.avg))
+	}
+	if measured.After(e.updated) {
+		e.updated = measured
+	}
+	memberLatency.entries[k] = e
+}
+
+// MemberLatency returns the smoothed response time of member for domain,
+// falling back to its site-level latency. ok is false when no measurement
+// is recent enough.
+func MemberLatency(member, domain string, isIPv6 bool) (time.Duration, bool) {
+	return MemberRegionLatency("", member, domain, isIPv6)
+}
+
+// MemberRegionLatency is MemberLatency as measured from region, falling
+// back to MemberLatency when region has no recent measurement.
+func MemberRegionLatency(region, member, domain string, isIPv6 bool) (time.Duration, bool) {
+	now := time.Now().UTC()
+	memberLatency.mu.RLock()
+	defer memberLatency.mu.RUnlock()
+	if region = strings.ToLower(strings.TrimSpace(region)); region != "" {
+		if d, ok := latencyLocked(region, member, domain, isIPv6, now); ok {
+			return d, true
+		}
+	}
+	return latencyLocked("", member, domain, isIPv6, now)
+}
+
+func latencyLocked(region, member, domain string, isIPv6 bool, now time.Time) (time.Duration, bool) {
+	for _, d := range []string{strings.ToLower(domain), ""} {
+		e, ok := memberLatency.entries[latencyKey{region: region, member: member, domain: d, ipv6: isIPv6}]
+		if ok && now.Sub(e.updated) <= latencyMaxAge {
+			return e.avg, true
+		}
+		if d == "" {
+			break
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func TestLatencyFromData(t *testing.T) {
+	cases := []struct {
+		in   interface{}
+		want time.Duration
+	}{
+		{12.5, 12500 * time.Microsecond},
+		{40, 40 * time.Millisecond},
+		{json.Number("7"), 7 * time.Millisecond},
+		{-3.0, 0},
+		{"fast", 0},
+		{nil, 0},
+	}
+	for _, c := range cases {
+		if got := LatencyFromData(map[string]interface{}{LatencyDataKey: c.in}); got != c.want {
+			t.Fatalf("%v: expected %v, got %v", c.in, c.want, got)
+		}
+	}
+	if got := LatencyFromData(nil); got != 0 {
+		t.Fatalf("expected zero for nil data, got %v", got)
+	}
+}
+
+func TestUpdateLocalResultCopiesLatency(t *testing.T) {
+	Local.Mu.Lock()
+	saved := Local.SiteResults
+	Local.SiteResults = nil
+	Local.Mu.Unlock()
+	defer func() {
+		Local.Mu.Lock()
+		Local.SiteResults = saved
+		Local.Mu.Unlock()
+	}()
+
+	member := memberResult("provider1").Member
+	UpdateLocalSiteResult(cfg.Check{Name: "ping"}, member, true, "", map[string]interface{}{LatencyDataKey: 25.0}, false)
+
+	sites, _, _ := GetLocalResults()
+	if len(sites) != 1 || sites[0].Results[0].Latency != 25*time.Millisecond {
+		t.Fatalf("expected 25ms latency on the local result, got %+v", sites)
+	}
+}
+
+func TestMemberLatencySmoothsAndFallsBack(t *testing.T) {
+	now := time.Now().UTC()
+	RecordLatency("lat-member", "", false, 100*time.Millisecond, now)
+	RecordLatency("lat-member", "RPC.example", false, 100*time.Millisecond, now)
+	RecordLatency("lat-member", "rpc.example", false, 200*time.Millisecond, now)
+
+	got, ok := MemberLatency("lat-member", "rpc.example", false)
+	if !ok || got != 130*time.Millisecond {
+		t.Fatalf("expected smoothed 130ms, got %v %v", got, ok)
+	}
+	if got, ok := MemberLatency("lat-member", "other.example", false); !ok || got != 100*time.Millisecond {
+		t.Fatalf("expected site-level fallback, got %v %v", got, ok)
+	}
+	if _, ok := MemberLatency("lat-member", "rpc.example", true); ok {
+		t.Fatal("expected no IPv6 measurement")
+	}
+
+	RecordLatency("lat-stale", "", false, 50*time.Millisecond, now.Add(-time.Hour))
+	if _, ok := MemberLatency("lat-stale", "", false); ok {
+		t.Fatal("expected stale measurement to be ignored")
+	}
+}
+
+func TestMemberRegionLatencyFallsBackToAllRegions(t *testing.T) {
+	now := time.Now().UTC()
+	RecordRegionLatency("EU-West", "region-member", "rpc.example.org", false, 20*time.Millisecond, now)
+	RecordRegionLatency("us-east", "region-member", "rpc.example.org", false, 120*time.Millisecond, now)
+
+	if d, ok := MemberRegionLatency("eu-west", "region-member", "rpc.example.org", false); !ok || d != 20*time.Millisecond {
+		t.Fatalf("expected the eu-west latency, got %s %v", d, ok)
+	}
+	if d, ok := MemberRegionLatency("ap-south", "region-member", "rpc.example.org", false); !ok || d != 50*time.Millisecond {
+		t.Fatalf("expected the smoothed latency of all regions, got %s %v", d, ok)
+	}
+}
@@ -0,0 +1,64 @@
+package data
+
+import (
+	"sync"
+)
+
+// -----------------------------------------------------------------------------
+// LIVE USAGE
+// -----------------------------------------------------------------------------
+//
+// Dashboards want hits as they happen, not the daily rows flushed every five
+// minutes. Once EnableLiveUsage is on, RecordDnsHit also counts hits per
+// domain and member in a small map the NATS publisher takes every minute.
+
+type liveUsageKey struct {
+	domain string
+	member string
+}
+
+var liveUsage struct {
+	mu     sync.Mutex
+	on     bool
+	counts map[liveUsageKey]int64
+}
+
+// EnableLiveUsage turns live counting on or off; off drops the counts not
+// yet taken.
+func EnableLiveUsage(on bool) {
+	liveUsage.mu.Lock()
+	defer liveUsage.mu.Unlock()
+	liveUsage.on = on
+	liveUsage.counts = nil
+	if on {
+		liveUsage.counts = make(map[liveUsageKey]int64)
+	}
+}
+
+func countLiveUsage(domain, member string) {
+	liveUsage.mu.Lock()
+	if liveUsage.on {
+		liveUsage.counts[liveUsageKey{domain, member}]++
+	}
+	liveUsage.mu.Unlock()
+}
+
+// TakeLiveUsage returns the hits counted since the last call, by domain and
+// member, and starts a new count.
+func TakeLiveUsage() map[string]map[string]int64 {
+	liveUsage.mu.Lock()
+	counts := liveUsage.counts
+	if liveUsage.on {
+		liveUsage.counts = make(map[liveUsageKey]int64, len(counts))
+	}
+	liveUsage.mu.Unlock()
+
+	out := make(map[string]map[string]int64)
+	for k, n := range counts {
+		if out[k.domain] == nil {
+			out[k.domain] = make(map[string]int64)
+		}
+		out[k.domain][k.member] = n
+	}
+	return out
+}
@@ -0,0 +1,273 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/api"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// MEMBER MAINTENANCE
+// -----------------------------------------------------------------------------
+//
+// Members announce planned restarts by declaring a short maintenance window,
+// with their own API key or through an operator. Offline time inside a
+// declared window is excused in the member scores instead of counting as
+// downtime. Windows are recorded in member_maintenance and never edited;
+// a member that needs longer declares another window.
+
+const (
+	// MaxMaintenanceWindow is the longest window one declaration covers.
+	MaxMaintenanceWindow = 2 * time.Hour
+	// maxMaintenanceLead is how far ahead a window may start.
+	maxMaintenanceLead = 7 * 24 * time.Hour
+	// maintenanceBackdate is how far in the past a window may start, to
+	// absorb clock skew and a declaration sent just after the restart began.
+	maintenanceBackdate = 5 * time.Minute
+)
+
+var errNoMaintenanceDB = errors.New("maintenance database not initialised")
+
+// ErrInvalidMaintenance is returned for a window that is too long, starts
+// too far in the past or the future, or names an unknown member.
+var ErrInvalidMaintenance = errors.New("invalid maintenance window")
+
+// MaintenanceRequest declares a window of Minutes starting at Start, or now
+// when Start is zero.
+type MaintenanceRequest struct {
+	Member     string    `json:"member"`
+	Start      time.Time `json:"start,omitempty"`
+	Minutes    int       `json:"minutes"`
+	Reason     string    `json:"reason,omitempty"`
+	DeclaredBy string    `json:"declaredBy"`
+}
+
+// MaintenanceWindow is a recorded declaration.
+type MaintenanceWindow struct {
+	ID         int64     `json:"id"`
+	Member     string    `json:"member"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Reason     string    `json:"reason,omitempty"`
+	DeclaredBy string    `json:"declaredBy"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// window validates req against now and returns the window it declares.
+func (req MaintenanceRequest) window(now time.Time) (MaintenanceWindow, error) {
+	w := MaintenanceWindow{
+		Member:     strings.TrimSpace(req.Member),
+		Start:      req.Start.UTC(),
+		Reason:     strings.TrimSpace(req.Reason),
+		DeclaredBy: strings.TrimSpace(req.DeclaredBy),
+		CreatedAt:  now,
+	}
+	if w.DeclaredBy == "" {
+		return w, ErrAuthorRequired
+	}
+	if _, ok := cfg.GetMember(w.Member); !ok {
+		return w, fmt.Errorf("%w: unknown member %q", ErrInvalidMaintenance, w.Member)
+	}
+	if req.Start.IsZero() {
+		w.Start = now
+	}
+	d := time.Duration(req.Minutes) * time.Minute
+	switch {
+	case d <= 0 || d > MaxMaintenanceWindow:
+		return w, fmt.Errorf("%w: duration must be 1-%d minutes", ErrInvalidMaintenance, int(MaxMaintenanceWindow/time.Minute))
+	case w.Start.Before(now.Add(-maintenanceBackdate)):
+		return w, fmt.Errorf("%w: start %s is in the past", ErrInvalidMaintenance, w.Start.Format(time.RFC3339))
+	case w.Start.After(now.Add(maxMaintenanceLead)):
+		return w, fmt.Errorf("%w: start %s is more than a week ahead", ErrInvalidMaintenance, w.Start.Format(time.RFC3339))
+	}
+	w.End = w.Start.Add(d)
+	return w, nil
+}
+
+// DeclareMaintenance records a maintenance window on the data connection and
+// returns it.
+func DeclareMaintenance(req MaintenanceRequest) (MaintenanceWindow, error) {
+	return DeclareMaintenanceIn(mysql.DB, req)
+}
+
+// DeclareMaintenanceIn is DeclareMaintenance on db, e.g. data2.DB on a
+// collator, which has no data connection.
+func DeclareMaintenanceIn(db *sql.DB, req MaintenanceRequest) (MaintenanceWindow, error) {
+	w, err := req.window(time.Now().UTC().Truncate(time.Second))
+	if err != nil {
+		return MaintenanceWindow{}, err
+	}
+	if db == nil {
+		return MaintenanceWindow{}, errNoMaintenanceDB
+	}
+	res, err := db.Exec(`INSERT INTO member_maintenance
+		(member_name, start_time, end_time, reason, declared_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		w.Member, w.Start, w.End, w.Reason, w.DeclaredBy, w.CreatedAt)
+	if err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("insert maintenance of %s: %w", w.Member, err)
+	}
+	if w.ID, err = res.LastInsertId(); err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("maintenance ID of %s: %w", w.Member, err)
+	}
+	log.Log(log.Info, "[maintenance] audit: %s declared maintenance of %s from %s to %s: %s",
+		w.DeclaredBy, w.Member, w.Start.Format(time.RFC3339), w.End.Format(time.RFC3339), w.Reason)
+	return w, nil
+}
+
+// GetMaintenanceWindows returns the windows overlapping [start, end],
+// oldest first, of member or of every member when member is empty.
+func GetMaintenanceWindows(member string, start, end time.Time) ([]MaintenanceWindow, error) {
+	return GetMaintenanceWindowsIn(mysql.DB, member, start, end)
+}
+
+// GetMaintenanceWindowsIn is GetMaintenanceWindows on db.
+func GetMaintenanceWindowsIn(db *sql.DB, member string, start, end time.Time) ([]MaintenanceWindow, error) {
+	if err := checkRange("maintenance windows", start, end); err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return nil, errNoMaintenanceDB
+	}
+	query := `SELECT id, member_name, start_time, end_time, reason, declared_by, created_at
+		FROM member_maintenance WHERE start_time < ? AND end_time > ?`
+	args := []interface{}{end.UTC(), start.UTC()}
+	if member != "" {
+		query += ` AND member_name = ?`
+		args = append(args, member)
+	}
+	rows, err := db.Query(query+` ORDER BY start_time, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query maintenance windows: %w", err)
+	}
+	defer rows.Close()
+
+	var out []MaintenanceWindow
+	for rows.Next() {
+		var w MaintenanceWindow
+		if err := rows.Scan(&w.ID, &w.Member, &w.Start, &w.End, &w.Reason, &w.DeclaredBy, &w.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan maintenance window: %w", err)
+		}
+		w.Start, w.End, w.CreatedAt = w.Start.UTC(), w.End.UTC(), w.CreatedAt.UTC()
+		out = append(out, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate maintenance windows: %w", err)
+	}
+	return out, nil
+}
+
+// MaintenanceHandler exposes the maintenance windows for a REST API. POST
+// takes a JSON MaintenanceRequest and returns the recorded window; GET
+// returns the windows of member= (optional) overlapping start= and end=
+// (RFC 3339, default the last and next 7 days). Behind api.Require with
+// api.RoleMember a member key may only see and declare its own member's
+// windows, and the declarer is the API key name.
+func MaintenanceHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, authed := api.PrincipalFromContext(r.Context())
+		switch r.Method {
+		case http.MethodGet:
+			q := r.URL.Query()
+			member := q.Get("member")
+			if authed && p.Member != "" {
+				if member != "" && member != p.Member {
+					http.Error(w, "forbidden: member keys see their own member only", http.StatusForbidden)
+					return
+				}
+				member = p.Member
+			}
+			now := time.Now().UTC()
+			start, end := now.Add(-maxMaintenanceLead), now.Add(maxMaintenanceLead)
+			for name, dst := range map[string]*time.Time{"start": &start, "end": &end} {
+				if v := q.Get(name); v != "" {
+					t, err := time.Parse(time.RFC3339, v)
+					if err != nil {
+						http.Error(w, "invalid "+name, http.StatusBadRequest)
+						return
+					}
+					*dst = t
+				}
+			}
+			out, err := GetMaintenanceWindows(member, start, end)
+			switch {
+			case errors.Is(err, ErrInvalidDateRange):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeMaintenanceJSON(w, http.StatusOK, out)
+
+		case http.MethodPost:
+			var req MaintenanceRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			if authed {
+				if p.Member != "" {
+					if req.Member != "" && req.Member != p.Member {
+						http.Error(w, "forbidden: member keys declare their own member only", http.StatusForbidden)
+						return
+					}
+					req.Member = p.Member
+				}
+				req.DeclaredBy = "api:" + p.Name
+			}
+			win, err := DeclareMaintenance(req)
+			switch {
+			case errors.Is(err, ErrAuthorRequired), errors.Is(err, ErrInvalidMaintenance):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeMaintenanceJSON(w, http.StatusCreated, win)
+
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func writeMaintenanceJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// -----------------------------------------------------------------------------
+// EXCUSED DOWNTIME
+// -----------------------------------------------------------------------------
+
+// memberMaintenance returns, per member, how much of its offline time in
+// offline lies inside its maintenance windows. Both are clipped to [start,
+// end]; overlapping windows count once.
+func memberMaintenance(offline map[string][]timeSpan, windows []MaintenanceWindow, start, end time.Time) map[string]time.Duration {
+	byMember := make(map[string][]timeSpan)
+	for _, w := range windows {
+		if sp, ok := clipSpan(timeSpan{w.Start, w.End}, start, end); ok {
+			byMember[w.Member] = append(byMember[w.Member], sp)
+		}
+	}
+	out := make(map[string]time.Duration, len(byMember))
+	for member, list := range byMember {
+		if d := spansOverlap(offline[member], mergeSpans(list)); d > 0 {
+			out[member] = d
+		}
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/api"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func TestMaintenanceRequestWindow(t *testing.T) {
+	prev := cfg.SetConfig(cfg.Config{Members: map[string]cfg.Member{"member-1": {}}})
+	defer cfg.SetConfig(prev)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	w, err := MaintenanceRequest{Member: "member-1", Minutes: 30, DeclaredBy: "ops"}.window(now)
+	if err != nil {
+		t.Fatalf("window: %v", err)
+	}
+	if !w.Start.Equal(now) || !w.End.Equal(now.Add(30*time.Minute)) {
+		t.Fatalf("unexpected window %s - %s", w.Start, w.End)
+	}
+
+	for name, req := range map[string]MaintenanceRequest{
+		"unknown member": {Member: "member-2", Minutes: 30, DeclaredBy: "ops"},
+		"no duration":    {Member: "member-1", DeclaredBy: "ops"},
+		"too long":       {Member: "member-1", Minutes: 121, DeclaredBy: "ops"},
+		"in the past":    {Member: "member-1", Start: now.Add(-time.Hour), Minutes: 30, DeclaredBy: "ops"},
+		"too far ahead":  {Member: "member-1", Start: now.Add(8 * 24 * time.Hour), Minutes: 30, DeclaredBy: "ops"},
+	} {
+		if _, err := req.window(now); !errors.Is(err, ErrInvalidMaintenance) {
+			t.Errorf("%s: expected ErrInvalidMaintenance, got %v", name, err)
+		}
+	}
+	if _, err := (MaintenanceRequest{Member: "member-1", Minutes: 30}).window(now); !errors.Is(err, ErrAuthorRequired) {
+		t.Fatalf("expected ErrAuthorRequired, got %v", err)
+	}
+}
+
+func TestMemberMaintenanceExcusesOverlapOnly(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+	end := at(600)
+
+	offline := map[string][]timeSpan{
+		"member-1": {{at(10), at(40)}, {at(100), at(130)}},
+		"member-2": {{at(10), at(40)}},
+	}
+	windows := []MaintenanceWindow{
+		{Member: "member-1", Start: at(0), End: at(20)},
+		{Member: "member-1", Start: at(15), End: at(30)},   // overlaps the first window
+		{Member: "member-1", Start: at(120), End: at(700)}, // runs past the period
+		{Member: "member-3", Start: at(0), End: at(60)},    // member-3 was never offline
+	}
+	got := memberMaintenance(offline, windows, start, end)
+	if got["member-1"] != 30*time.Minute {
+		t.Fatalf("expected 30m excused for member-1, got %s", got["member-1"])
+	}
+	if _, ok := got["member-2"]; ok {
+		t.Fatalf("member-2 declared no maintenance, got %s", got["member-2"])
+	}
+	if _, ok := got["member-3"]; ok {
+		t.Fatalf("member-3 was never offline, got %s", got["member-3"])
+	}
+}
+
+func TestMaintenanceHandlerKeepsMemberKeysToTheirMember(t *testing.T) {
+	keys := func() cfg.ApiConfig {
+		return cfg.ApiConfig{MemberKeys: map[string]string{"member-1": "m1-key"}}
+	}
+	h := api.Require(keys, api.RoleMember, MaintenanceHandler())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/maintenance", strings.NewReader(`{"member":"member-2","minutes":30}`))
+	req.Header.Set("Authorization", "Bearer m1-key")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 declaring for another member, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/maintenance?member=member-2", nil)
+	req.Header.Set("Authorization", "Bearer m1-key")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 listing another member, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	MaintenanceHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/maintenance", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, POST" {
+		t.Fatalf("expected 405 with Allow: GET, POST, got %d", rec.Code)
+	}
+}
@@ -1,11 +1,13 @@
 package mysql
 
 import (
-	"database/sql"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-libs/internal/dbmetrics"
+	"github.com/ibp-network/ibp-geodns-libs/internal/eventschema"
 	"github.com/ibp-network/ibp-geodns-libs/internal/requestschema"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -22,7 +24,7 @@ func Init() {
 	)
 
 	var err error
-	DB, err = sql.Open("mysql", dsn)
+	DB, err = dbmetrics.Open(dsn)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to open MySQL DSN: %v", err))
 	}
@@ -48,6 +50,29 @@ func Init() {
 	if err := requestschema.EnsureUniqueIndex(DB); err != nil {
 		fmt.Printf("[mysql.Init] requests schema check failed: %v\n", err)
 	}
+	if err := eventschema.EnsureOpenEventIndex(DB); err != nil {
+		fmt.Printf("[mysql.Init] member_events schema check failed: %v\n", err)
+	}
+	if err := eventschema.EnsureProposalColumn(DB); err != nil {
+		fmt.Printf("[mysql.Init] member_events proposal schema check failed: %v\n", err)
+	}
 
 	fmt.Println("[mysql.Init] Connected successfully to MySQL.")
 }
+
+// lastWrite holds the UnixNano time of the last successful write.
+var lastWrite atomic.Int64
+
+func markWrite() {
+	lastWrite.Store(time.Now().UTC().UnixNano())
+}
+
+// LastWrite returns when a write to MySQL last succeeded, or the zero time
+// if none has since start-up.
+func LastWrite() time.Time {
+	ns := lastWrite.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns).UTC()
+}
@@ -45,6 +45,7 @@ ON DUPLICATE KEY UPDATE
 	if err != nil {
 		return fmt.Errorf("failed UpsertUsageRecord(v4): %w", err)
 	}
+	markWrite()
 	return nil
 }
 
@@ -214,6 +215,7 @@ ON DUPLICATE KEY UPDATE
 	if err != nil {
 		return fmt.Errorf("failed UpsertUsageRecord(v6): %w", err)
 	}
+	markWrite()
 	return nil
 }
 
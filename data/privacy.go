@@ -0,0 +1,119 @@
+package data
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	"github.com/ibp-network/ibp-geodns-libs/internal/requestschema"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+)
+
+// -----------------------------------------------------------------------------
+// DATA MINIMISATION
+// -----------------------------------------------------------------------------
+//
+// With System.Usage.TruncateClientIPs set, RecordDnsHit zeroes the host bits
+// of the client address (to ClientPrefixV4/V6, default /24 and /48) before
+// anything else sees it: classification, GeoIP lookups, unique client
+// sketches and logs. With System.Usage.RetentionDays set, usage and unique
+// client rows older than that many days are deleted once a day, and the
+// retention hooks a deployment registers run with the same cutoff so its
+// own stores can follow the policy.
+
+// truncateClientIPs mirrors System.Usage.TruncateClientIPs.
+var truncateClientIPs atomic.Bool
+
+// minimiseClientIP returns ip with its host bits zeroed when truncation is
+// on. An address that does not parse is returned unchanged.
+func minimiseClientIP(ip string) string {
+	if !truncateClientIPs.Load() {
+		return ip
+	}
+	if masked := max.MaskClientIP(ip, int(clientPrefixV4.Load()), int(clientPrefixV6.Load())); masked != "" {
+		return masked
+	}
+	return ip
+}
+
+// RetentionHook deletes a deployment's own data dated before before.
+type RetentionHook func(before time.Time) error
+
+var (
+	retentionHooksMu sync.Mutex
+	retentionHooks   map[string]RetentionHook
+
+	purgeUsage = func(before time.Time) (int64, error) { return requestschema.PurgeBefore(mysql.DB, before) }
+)
+
+// RegisterRetentionHook adds or replaces the named hook run with every
+// retention pass.
+func RegisterRetentionHook(name string, hook RetentionHook) {
+	if name == "" || hook == nil {
+		return
+	}
+	retentionHooksMu.Lock()
+	defer retentionHooksMu.Unlock()
+	if retentionHooks == nil {
+		retentionHooks = make(map[string]RetentionHook)
+	}
+	retentionHooks[name] = hook
+}
+
+func UnregisterRetentionHook(name string) {
+	retentionHooksMu.Lock()
+	defer retentionHooksMu.Unlock()
+	delete(retentionHooks, name)
+}
+
+// UsageRetentionCutoff returns the first day kept under c's retention
+// policy, or false when data is kept indefinitely.
+func UsageRetentionCutoff(c cfg.UsageConfig, now time.Time) (time.Time, bool) {
+	if c.RetentionDays <= 0 {
+		return time.Time{}, false
+	}
+	return now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -c.RetentionDays), true
+}
+
+// RunRetentionHooks runs the registered hooks, in name order, with before.
+// A failing hook is logged and the rest still run.
+func RunRetentionHooks(before time.Time) {
+	retentionHooksMu.Lock()
+	names := make([]string, 0, len(retentionHooks))
+	hooks := make(map[string]RetentionHook, len(retentionHooks))
+	for name, hook := range retentionHooks {
+		names = append(names, name)
+		hooks[name] = hook
+	}
+	retentionHooksMu.Unlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		if err := hooks[name](before); err != nil {
+			log.Log(log.Error, "[data] retention hook %s: %v", name, err)
+		}
+	}
+}
+
+// ApplyUsageRetention deletes this node's usage and unique client rows
+// older than System.Usage.RetentionDays and runs the retention hooks. It
+// does nothing without a retention policy.
+func ApplyUsageRetention() {
+	before, ok := UsageRetentionCutoff(cfg.GetConfig().Local.System.Usage, time.Now())
+	if !ok {
+		return
+	}
+	if statsEnabled() {
+		n, err := purgeUsage(before)
+		if err != nil {
+			log.Log(log.Error, "[ApplyUsageRetention] %v", err)
+		} else if n > 0 {
+			log.Log(log.Info, "[ApplyUsageRetention] deleted %d usage rows before %s", n, before.Format("2006-01-02"))
+		}
+	}
+	RunRetentionHooks(before)
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func TestMinimiseClientIP(t *testing.T) {
+	defer truncateClientIPs.Store(false)
+	defer clientPrefixV4.Store(0)
+
+	if got := minimiseClientIP("192.0.2.77"); got != "192.0.2.77" {
+		t.Fatalf("truncated without the option: %s", got)
+	}
+	truncateClientIPs.Store(true)
+	for in, want := range map[string]string{
+		"192.0.2.77":          "192.0.2.0",
+		"::ffff:192.0.2.77":   "192.0.2.0",
+		"2001:db8:1:2:3::4":   "2001:db8:1::",
+		"not-an-ip":           "not-an-ip",
+		"fe80::1%eth0":        "fe80::",
+		"2001:db8:ffff::abcd": "2001:db8:ffff::",
+	} {
+		if got := minimiseClientIP(in); got != want {
+			t.Errorf("minimiseClientIP(%q) = %q, want %q", in, got, want)
+		}
+	}
+	clientPrefixV4.Store(16)
+	if got := minimiseClientIP("192.0.2.77"); got != "192.0.0.0" {
+		t.Fatalf("configured /16: %s", got)
+	}
+}
+
+func TestApplyUsageRetentionPurgesAndRunsHooks(t *testing.T) {
+	SetCacheOptions(false, true)
+	defer SetCacheOptions(false, false)
+	prevPurge := purgeUsage
+	prevCfg := cfg.SetConfig(cfg.Config{Local: cfg.LocalConfig{System: cfg.SystemConfig{Usage: cfg.UsageConfig{RetentionDays: 30}}}})
+	defer func() {
+		purgeUsage = prevPurge
+		cfg.SetConfig(prevCfg)
+		UnregisterRetentionHook("test")
+	}()
+
+	want := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -30)
+	var purged, hooked time.Time
+	purgeUsage = func(before time.Time) (int64, error) {
+		purged = before
+		return 3, nil
+	}
+	RegisterRetentionHook("test", func(before time.Time) error {
+		hooked = before
+		return nil
+	})
+
+	ApplyUsageRetention()
+	if !purged.Equal(want) || !hooked.Equal(want) {
+		t.Fatalf("purged before %s, hook before %s, want %s", purged, hooked, want)
+	}
+
+	cfg.SetConfig(cfg.Config{})
+	purged, hooked = time.Time{}, time.Time{}
+	ApplyUsageRetention()
+	if !purged.IsZero() || !hooked.IsZero() {
+		t.Fatal("retention ran without a policy")
+	}
+}
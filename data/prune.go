@@ -0,0 +1,184 @@
+package data
+
+import (
+	"strings"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+)
+
+// -----------------------------------------------------------------------------
+// CONFIG RECONCILIATION
+// -----------------------------------------------------------------------------
+//
+// When members.json or services.json drop a member or domain, its results
+// would otherwise stay in the official/local stores and the disk caches
+// forever. PruneRemoved runs after every config reload and removes them, and
+// closes their open offline events so downtime stops accruing.
+
+const pruneReloadHook = "data.prune"
+
+// PruneStats reports what a reconciliation pass removed.
+type PruneStats struct {
+	OfficialResults int
+	LocalResults    int
+	ClosedEvents    int
+}
+
+func (s PruneStats) empty() bool {
+	return s.OfficialResults == 0 && s.LocalResults == 0 && s.ClosedEvents == 0
+}
+
+// configSet is the set of member names and domains present in a config. A
+// nil map means that part of the config is not loaded and nothing is pruned
+// on its account.
+type configSet struct {
+	members map[string]struct{}
+	domains map[string]struct{}
+}
+
+func configuredSet(c cfg.Config) configSet {
+	var set configSet
+	if len(c.Members) > 0 {
+		set.members = make(map[string]struct{}, len(c.Members))
+		for key, m := range c.Members {
+			set.members[key] = struct{}{}
+			if m.Details.Name != "" {
+				set.members[m.Details.Name] = struct{}{}
+			}
+		}
+	}
+	for _, svc := range c.Services {
+		for _, provider := range svc.Providers {
+			for _, rpcURL := range provider.RpcUrls {
+				domain := strings.ToLower(max.ParseUrl(rpcURL).Domain)
+				if domain == "" {
+					continue
+				}
+				if set.domains == nil {
+					set.domains = make(map[string]struct{})
+				}
+				set.domains[domain] = struct{}{}
+			}
+		}
+	}
+	return set
+}
+
+func (s configSet) hasMember(name string) bool {
+	if s.members == nil {
+		return true
+	}
+	_, ok := s.members[name]
+	return ok
+}
+
+func (s configSet) hasDomain(domain string) bool {
+	if s.domains == nil || domain == "" {
+		return true
+	}
+	_, ok := s.domains[strings.ToLower(domain)]
+	return ok
+}
+
+// PruneRemoved drops results and closes open events that reference members or
+// domains no longer present in c.
+func PruneRemoved(c cfg.Config) PruneStats {
+	set := configuredSet(c)
+	if set.members == nil && set.domains == nil {
+		return PruneStats{}
+	}
+
+	var stats PruneStats
+
+	Official.Mu.Lock()
+	Official.SiteResults, Official.DomainResults, Official.EndpointResults, stats.OfficialResults =
+		pruneResults(set, Official.SiteResults, Official.DomainResults, Official.EndpointResults)
+	if stats.OfficialResults > 0 {
+		publishSnapshotLocked()
+	}
+	Official.Mu.Unlock()
+
+	Local.Mu.Lock()
+	Local.SiteResults, Local.DomainResults, Local.EndpointResults, stats.LocalResults =
+		pruneResults(set, Local.SiteResults, Local.DomainResults, Local.EndpointResults)
+	Local.Mu.Unlock()
+
+	stats.ClosedEvents = closeRemovedEvents(set, time.Now().UTC())
+
+	if stats.empty() {
+		return stats
+	}
+	log.Log(log.Info, "[data] pruned removed config entries: official=%d local=%d events=%d",
+		stats.OfficialResults, stats.LocalResults, stats.ClosedEvents)
+	if stats.OfficialResults > 0 || stats.LocalResults > 0 {
+		SaveAllCaches()
+	}
+	return stats
+}
+
+// pruneResults filters the three result slices in place and returns the
+// number of member results removed. Result groups left empty are dropped.
+func pruneResults(set configSet, sites []SiteResult, domains []DomainResult, endpoints []EndpointResult) ([]SiteResult, []DomainResult, []EndpointResult, int) {
+	removed := 0
+	keep := func(results []Result, domainKept bool) []Result {
+		out := results[:0]
+		for _, r := range results {
+			if domainKept && set.hasMember(r.Member.Details.Name) {
+				out = append(out, r)
+				continue
+			}
+			removed++
+		}
+		return out
+	}
+
+	keptSites := sites[:0]
+	for _, sr := range sites {
+		if sr.Results = keep(sr.Results, true); len(sr.Results) > 0 {
+			keptSites = append(keptSites, sr)
+		}
+	}
+	keptDomains := domains[:0]
+	for _, dr := range domains {
+		if dr.Results = keep(dr.Results, set.hasDomain(dr.Domain)); len(dr.Results) > 0 {
+			keptDomains = append(keptDomains, dr)
+		}
+	}
+	keptEndpoints := endpoints[:0]
+	for _, er := range endpoints {
+		if er.Results = keep(er.Results, set.hasDomain(er.Domain)); len(er.Results) > 0 {
+			keptEndpoints = append(keptEndpoints, er)
+		}
+	}
+	return keptSites, keptDomains, keptEndpoints, removed
+}
+
+// closeRemovedEvents ends open offline events of removed members or domains.
+func closeRemovedEvents(set configSet, now time.Time) int {
+	if mysql.DB == nil {
+		return 0
+	}
+	store := mysql.Events()
+	open, err := store.FetchOpen()
+	if err != nil {
+		log.Log(log.Error, "[data] failed to list open events for pruning: %v", err)
+		return 0
+	}
+
+	closed := 0
+	for _, ev := range open {
+		if set.hasMember(ev.Member) && set.hasDomain(ev.Domain) {
+			continue
+		}
+		if err := store.CloseByID(ev.ID, now); err != nil {
+			log.Log(log.Error, "[data] failed to close event %d of removed %s: %v", ev.ID, ev.Member, err)
+			continue
+		}
+		closed++
+	}
+	return closed
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func pruneTestConfig() cfg.Config {
+	return cfg.Config{
+		Members: map[string]cfg.Member{
+			"kept": {Details: cfg.MemberDetails{Name: "kept"}},
+		},
+		Services: map[string]cfg.Service{
+			"polkadot": {Providers: map[string]cfg.ServiceProvider{
+				"kept": {RpcUrls: []string{"wss://rpc.kept.example/polkadot"}},
+			}},
+		},
+	}
+}
+
+func memberResult(name string) Result {
+	return Result{Member: cfg.Member{Details: cfg.MemberDetails{Name: name}}, Status: true}
+}
+
+func TestPruneRemovedDropsRemovedMembersAndDomains(t *testing.T) {
+	restoreOfficialResults(t)
+
+	SetOfficialSiteResults([]SiteResult{
+		{Check: cfg.Check{Name: "ping"}, Results: []Result{memberResult("kept"), memberResult("gone")}},
+		{Check: cfg.Check{Name: "ssl"}, Results: []Result{memberResult("gone")}},
+	})
+	SetOfficialDomainResults([]DomainResult{
+		{Check: cfg.Check{Name: "dns"}, Domain: "rpc.kept.example", Results: []Result{memberResult("kept")}},
+		{Check: cfg.Check{Name: "dns"}, Domain: "rpc.retired.example", Results: []Result{memberResult("kept")}},
+	})
+	SetOfficialEndpointResults(nil)
+
+	stats := PruneRemoved(pruneTestConfig())
+	if stats.OfficialResults != 3 {
+		t.Fatalf("expected 3 official results pruned, got %+v", stats)
+	}
+
+	sites, domains, _ := GetOfficialResults()
+	if len(sites) != 1 || len(sites[0].Results) != 1 || sites[0].Results[0].Member.Details.Name != "kept" {
+		t.Fatalf("unexpected site results after prune: %+v", sites)
+	}
+	if len(domains) != 1 || domains[0].Domain != "rpc.kept.example" {
+		t.Fatalf("unexpected domain results after prune: %+v", domains)
+	}
+}
+
+func TestPruneRemovedIgnoresUnloadedConfig(t *testing.T) {
+	restoreOfficialResults(t)
+
+	SetOfficialSiteResults([]SiteResult{
+		{Check: cfg.Check{Name: "ping"}, Results: []Result{memberResult("anyone")}},
+	})
+
+	if stats := PruneRemoved(cfg.Config{}); stats.OfficialResults != 0 {
+		t.Fatalf("expected nothing pruned without a loaded config, got %+v", stats)
+	}
+	if sites, _, _ := GetOfficialResults(); len(sites) != 1 {
+		t.Fatal("expected results to survive an empty config")
+	}
+}
@@ -56,6 +56,7 @@ func UpdateLocalSiteResult(check cfg.Check, member cfg.Member, status bool, erro
 		Checktime: time.Now().UTC(),
 		ErrorText: errorMsg,
 		Data:      cloneAnyMap(dataMap),
+		Latency:   LatencyFromData(dataMap),
 		IsIPv6:    isIPv6,
 	}
 
@@ -103,6 +104,7 @@ func UpdateLocalDomainResult(check cfg.Check, member cfg.Member, service cfg.Ser
 		Checktime: time.Now().UTC(),
 		ErrorText: errorMsg,
 		Data:      cloneAnyMap(dataMap),
+		Latency:   LatencyFromData(dataMap),
 		IsIPv6:    isIPv6,
 	}
 
@@ -151,6 +153,7 @@ func UpdateLocalEndpointResult(check cfg.Check, member cfg.Member, service cfg.S
 		Checktime: time.Now().UTC(),
 		ErrorText: errorMsg,
 		Data:      cloneAnyMap(dataMap),
+		Latency:   LatencyFromData(dataMap),
 		IsIPv6:    isIPv6,
 	}
 
@@ -90,6 +90,17 @@ func SetOfficialEndpointResults(results []EndpointResult) {
 	publishSnapshotLocked()
 }
 
+// ReplaceOfficialResults installs a complete set of official results at
+// once, e.g. a snapshot pushed by a monitor to a DNS node.
+func ReplaceOfficialResults(snap Snapshot) {
+	Official.Mu.Lock()
+	defer Official.Mu.Unlock()
+	Official.SiteResults = cloneSiteResults(snap.SiteResults)
+	Official.DomainResults = cloneDomainResults(snap.DomainResults)
+	Official.EndpointResults = cloneEndpointResults(snap.EndpointResults)
+	publishSnapshotLocked()
+}
+
 func UpdateOfficialSiteResult(check cfg.Check, member cfg.Member, status bool, errorMsg string, dataMap map[string]interface{}, isIPv6 bool) {
 	Official.Mu.Lock()
 	var pendingEvent *pendingOfficialEvent
@@ -108,6 +119,7 @@ func UpdateOfficialSiteResult(check cfg.Check, member cfg.Member, status bool, e
 		Checktime: time.Now().UTC(),
 		ErrorText: errorMsg,
 		Data:      cloneAnyMap(dataMap),
+		Latency:   LatencyFromData(dataMap),
 		IsIPv6:    isIPv6,
 	}
 
@@ -193,6 +205,7 @@ func UpdateOfficialDomainResult(check cfg.Check, member cfg.Member, service cfg.
 		Checktime: time.Now().UTC(),
 		ErrorText: errorMsg,
 		Data:      cloneAnyMap(dataMap),
+		Latency:   LatencyFromData(dataMap),
 		IsIPv6:    isIPv6,
 	}
 
@@ -283,6 +296,7 @@ func UpdateOfficialEndpointResult(check cfg.Check, member cfg.Member, service cf
 		Checktime: time.Now().UTC(),
 		ErrorText: errorMsg,
 		Data:      cloneAnyMap(dataMap),
+		Latency:   LatencyFromData(dataMap),
 		IsIPv6:    isIPv6,
 	}
 
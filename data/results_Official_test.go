@@ -98,3 +98,32 @@ func TestGetOfficialResultsReturnsDeepCopies(t *testing.T) {
 		t.Fatalf("expected nested data map to be cloned, got %#v", got)
 	}
 }
+
+func TestReplaceOfficialResultsUpdatesStateAndSnapshot(t *testing.T) {
+	originalOfficial := currentOfficialResultsState()
+	originalSnapshot := currentOfficialSnapshot()
+	t.Cleanup(func() {
+		Official.Mu.Lock()
+		Official.SiteResults = cloneSiteResults(originalOfficial.SiteResults)
+		Official.DomainResults = cloneDomainResults(originalOfficial.DomainResults)
+		Official.EndpointResults = cloneEndpointResults(originalOfficial.EndpointResults)
+		Official.Mu.Unlock()
+		SetOfficialSnapshot(originalSnapshot)
+	})
+
+	snap := sampleOfficialSnapshot()
+	ReplaceOfficialResults(snap)
+	snap.SiteResults[0].Check.Name = "changed"
+
+	Official.Mu.RLock()
+	stored := len(Official.SiteResults) == 1 && Official.SiteResults[0].Check.Name == "ping" &&
+		len(Official.DomainResults) == 0 && len(Official.EndpointResults) == 0
+	Official.Mu.RUnlock()
+	if !stored {
+		t.Fatalf("expected the official state to hold a copy of the snapshot")
+	}
+	sites, _, _ := GetOfficialResults()
+	if len(sites) != 1 || sites[0].Check.Name != "ping" {
+		t.Fatalf("expected the snapshot to expose the replaced results, got %+v", sites)
+	}
+}
@@ -0,0 +1,350 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-libs/data/eventstore"
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+)
+
+// -----------------------------------------------------------------------------
+// MEMBER SCORING
+// -----------------------------------------------------------------------------
+//
+// A member's score combines three components, each between 0 and 1:
+//
+//   - uptime: the share of the period not covered by an offline event,
+//     except inside a maintenance window the member declared
+//   - latency: LatencyTargetMs divided by the member's latency percentile,
+//     capped at 1
+//   - usage: the member's hits relative to the busiest member
+//
+// The score is the weighted mean of the components scaled to 0-100. A
+// component with no data for the member (no latency rollups, or no usage in
+// the whole period) is left out and the remaining weights renormalised.
+
+const (
+	defaultUptimeWeight      = 0.6
+	defaultLatencyWeight     = 0.25
+	defaultUsageWeight       = 0.15
+	defaultLatencyPercentile = 90
+	defaultLatencyTargetMs   = 100
+)
+
+var latencyPercentileColumns = map[int]string{
+	50: "p50_ms",
+	90: "p90_ms",
+	99: "p99_ms",
+}
+
+// ScoreWeights is the resolved ranking formula.
+type ScoreWeights struct {
+	Uptime            float64
+	Latency           float64
+	Usage             float64
+	LatencyPercentile int
+	LatencyTargetMs   float64
+}
+
+// MemberScore is the ranking input and result of one member.
+type MemberScore struct {
+	Member         string        `json:"member"`
+	Uptime         float64       `json:"uptime"`
+	Downtime       time.Duration `json:"downtime"`
+	Maintenance    time.Duration `json:"maintenance"` // offline time excused by maintenance windows
+	LatencyMs      float64       `json:"latencyMs"`
+	LatencySamples int           `json:"latencySamples"`
+	Hits           int64         `json:"hits"`
+	UsageShare     float64       `json:"usageShare"`
+	Score          float64       `json:"score"`
+	Rank           int           `json:"rank"`
+}
+
+// ScoreWeightsFromConfig fills the defaults into c.
+func ScoreWeightsFromConfig(c cfg.ScoringConfig) ScoreWeights {
+	w := ScoreWeights{
+		Uptime:            c.UptimeWeight,
+		Latency:           c.LatencyWeight,
+		Usage:             c.UsageWeight,
+		LatencyPercentile: c.LatencyPercentile,
+		LatencyTargetMs:   c.LatencyTargetMs,
+	}
+	if w.Uptime < 0 {
+		w.Uptime = 0
+	}
+	if w.Latency < 0 {
+		w.Latency = 0
+	}
+	if w.Usage < 0 {
+		w.Usage = 0
+	}
+	if w.Uptime+w.Latency+w.Usage == 0 {
+		w.Uptime, w.Latency, w.Usage = defaultUptimeWeight, defaultLatencyWeight, defaultUsageWeight
+	}
+	if _, ok := latencyPercentileColumns[w.LatencyPercentile]; !ok {
+		w.LatencyPercentile = defaultLatencyPercentile
+	}
+	if w.LatencyTargetMs <= 0 {
+		w.LatencyTargetMs = defaultLatencyTargetMs
+	}
+	return w
+}
+
+// GetMemberScores ranks the configured members over the period ending now.
+func GetMemberScores(period time.Duration) ([]MemberScore, error) {
+	end := time.Now().UTC()
+	return GetMemberScoresBetween(end.Add(-period), end)
+}
+
+// GetMemberScoresBetween ranks the configured members over [start, end]
+// using the formula in System.Scoring.
+func GetMemberScoresBetween(start, end time.Time) ([]MemberScore, error) {
+	start, end = start.UTC(), end.UTC()
+	if !end.After(start) {
+		return nil, fmt.Errorf("scoring period: %w: %s - %s", ErrInvalidDateRange, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	c := cfg.GetConfig()
+	w := ScoreWeightsFromConfig(c.Local.System.Scoring)
+
+	events, err := mysql.Events().FetchOffline(start, end)
+	if err != nil {
+		return nil, err
+	}
+	offline := memberOfflineSpans(events, start, end, time.Now().UTC())
+	windows, err := GetMaintenanceWindows("", start, end)
+	if err != nil {
+		return nil, err
+	}
+	excused := memberMaintenance(offline, windows, start, end)
+
+	latency, err := memberLatencyPercentiles(w.LatencyPercentile, start, end)
+	if err != nil {
+		return nil, err
+	}
+	hits, err := memberHits(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	period := end.Sub(start)
+	scores := make([]MemberScore, 0, len(c.Members))
+	for name := range c.Members {
+		s := MemberScore{Member: name, Maintenance: excused[name], Hits: hits[name]}
+		s.Downtime = spansDuration(offline[name]) - s.Maintenance
+		s.Uptime = 1 - float64(s.Downtime)/float64(period)
+		if l, ok := latency[name]; ok {
+			s.LatencyMs, s.LatencySamples = l.ms, l.samples
+		}
+		scores = append(scores, s)
+	}
+	return RankMembers(scores, w), nil
+}
+
+// RankMembers computes UsageShare, Score and Rank of scores with w and
+// returns them best first.
+func RankMembers(scores []MemberScore, w ScoreWeights) []MemberScore {
+	var total, top int64
+	for _, s := range scores {
+		total += s.Hits
+		if s.Hits > top {
+			top = s.Hits
+		}
+	}
+
+	for i := range scores {
+		s := &scores[i]
+		var sum, weight float64
+
+		sum += w.Uptime * clamp01(s.Uptime)
+		weight += w.Uptime
+
+		if s.LatencySamples > 0 && s.LatencyMs > 0 {
+			sum += w.Latency * math.Min(1, w.LatencyTargetMs/s.LatencyMs)
+			weight += w.Latency
+		}
+
+		if total > 0 {
+			s.UsageShare = float64(s.Hits) / float64(total)
+			sum += w.Usage * float64(s.Hits) / float64(top)
+			weight += w.Usage
+		}
+
+		s.Score = 0
+		if weight > 0 {
+			s.Score = math.Round(10000*sum/weight) / 100
+		}
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Member < scores[j].Member
+	})
+	for i := range scores {
+		scores[i].Rank = i + 1
+	}
+	return scores
+}
+
+// memberOfflineSpans returns, per member, the merged spans of [start, end]
+// covered by offline events. Overlapping events of different checks count
+// once; open events run until now.
+func memberOfflineSpans(events []eventstore.Event, start, end, now time.Time) map[string][]timeSpan {
+	spans := make(map[string][]timeSpan)
+	for _, ev := range events {
+		if ev.Status {
+			continue
+		}
+		to := now
+		if ev.EndTime.Valid {
+			to = ev.EndTime.Time
+		}
+		if sp, ok := clipSpan(timeSpan{ev.StartTime, to}, start, end); ok {
+			spans[ev.Member] = append(spans[ev.Member], sp)
+		}
+	}
+	for member, list := range spans {
+		spans[member] = mergeSpans(list)
+	}
+	return spans
+}
+
+type timeSpan struct{ from, to time.Time }
+
+// clipSpan limits sp to [start, end] and reports whether anything is left.
+func clipSpan(sp timeSpan, start, end time.Time) (timeSpan, bool) {
+	if sp.from.Before(start) {
+		sp.from = start
+	}
+	if sp.to.After(end) {
+		sp.to = end
+	}
+	return sp, sp.to.After(sp.from)
+}
+
+// mergeSpans sorts list and joins the spans that overlap or touch.
+func mergeSpans(list []timeSpan) []timeSpan {
+	if len(list) == 0 {
+		return nil
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].from.Before(list[j].from) })
+	out := []timeSpan{list[0]}
+	for _, sp := range list[1:] {
+		cur := &out[len(out)-1]
+		if !sp.from.After(cur.to) {
+			if sp.to.After(cur.to) {
+				cur.to = sp.to
+			}
+			continue
+		}
+		out = append(out, sp)
+	}
+	return out
+}
+
+func spansDuration(list []timeSpan) time.Duration {
+	var total time.Duration
+	for _, sp := range list {
+		total += sp.to.Sub(sp.from)
+	}
+	return total
+}
+
+// spansOverlap returns how long the merged spans a and b overlap.
+func spansOverlap(a, b []timeSpan) time.Duration {
+	var total time.Duration
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		from, to := a[i].from, a[i].to
+		if b[j].from.After(from) {
+			from = b[j].from
+		}
+		if b[j].to.Before(to) {
+			to = b[j].to
+		}
+		if to.After(from) {
+			total += to.Sub(from)
+		}
+		if a[i].to.Before(b[j].to) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return total
+}
+
+type latencyPercentile struct {
+	ms      float64
+	samples int
+}
+
+// memberLatencyPercentiles averages the hourly percentile of every member
+// over [start, end], weighted by the samples behind each rollup.
+func memberLatencyPercentiles(percentile int, start, end time.Time) (map[string]latencyPercentile, error) {
+	col, ok := latencyPercentileColumns[percentile]
+	if !ok {
+		return nil, fmt.Errorf("unsupported latency percentile %d", percentile)
+	}
+	rows, err := mysql.DB.Query(`SELECT member_name, SUM(samples), SUM(`+col+` * samples) / SUM(samples)
+		FROM latency_rollups
+		WHERE hour >= ? AND hour < ? AND samples > 0
+		GROUP BY member_name`, start.Truncate(time.Hour), end)
+	if err != nil {
+		return nil, fmt.Errorf("query latency rollups: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]latencyPercentile)
+	for rows.Next() {
+		var (
+			member string
+			l      latencyPercentile
+		)
+		if err := rows.Scan(&member, &l.samples, &l.ms); err != nil {
+			return nil, fmt.Errorf("scan latency rollup: %w", err)
+		}
+		out[member] = l
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate latency rollups: %w", err)
+	}
+	return out, nil
+}
+
+// memberHits sums the requests answered by every member on the days of
+// [start, end].
+func memberHits(start, end time.Time) (map[string]int64, error) {
+	rows, err := mysql.DB.Query(`SELECT member_name, SUM(hits)
+		FROM requests
+		WHERE date BETWEEN ? AND ? AND member_name <> ''
+		GROUP BY member_name`, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("query member hits: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]int64)
+	for rows.Next() {
+		var (
+			member string
+			hits   int64
+		)
+		if err := rows.Scan(&member, &hits); err != nil {
+			return nil, fmt.Errorf("scan member hits: %w", err)
+		}
+		out[member] = hits
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate member hits: %w", err)
+	}
+	return out, nil
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,68 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-libs/data/eventstore"
+)
+
+func TestScoreWeightsFromConfigDefaults(t *testing.T) {
+	w := ScoreWeightsFromConfig(cfg.ScoringConfig{LatencyPercentile: 75})
+	if w.Uptime != defaultUptimeWeight || w.LatencyPercentile != defaultLatencyPercentile || w.LatencyTargetMs != defaultLatencyTargetMs {
+		t.Fatalf("expected defaults, got %+v", w)
+	}
+	w = ScoreWeightsFromConfig(cfg.ScoringConfig{UsageWeight: 1, LatencyPercentile: 99})
+	if w.Uptime != 0 || w.Usage != 1 || w.LatencyPercentile != 99 {
+		t.Fatalf("expected configured weights kept, got %+v", w)
+	}
+}
+
+func TestMemberOfflineSpansMergeOverlaps(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	at := func(h int) time.Time { return start.Add(time.Duration(h) * time.Hour) }
+	closed := func(h int) sql.NullTime { return sql.NullTime{Time: at(h), Valid: true} }
+	ev := func(member string, from int, to sql.NullTime) eventstore.Event {
+		return eventstore.Event{Key: eventstore.Key{Member: member}, StartTime: at(from), EndTime: to}
+	}
+
+	events := []eventstore.Event{
+		ev("a", 1, closed(3)),
+		ev("a", 2, closed(4)), // overlaps the first
+		ev("a", -2, closed(1)),
+		ev("b", 22, sql.NullTime{}), // still open, clipped to the period
+	}
+	spans := memberOfflineSpans(events, start, end, at(30))
+	if got := spansDuration(spans["a"]); got != 4*time.Hour {
+		t.Fatalf("expected 4h for a, got %v", got)
+	}
+	if got := spansDuration(spans["b"]); got != 2*time.Hour {
+		t.Fatalf("expected 2h for b, got %v", got)
+	}
+}
+
+func TestRankMembers(t *testing.T) {
+	w := ScoreWeights{Uptime: 0.5, Latency: 0.25, Usage: 0.25, LatencyTargetMs: 100}
+	scores := RankMembers([]MemberScore{
+		{Member: "slow", Uptime: 1, LatencyMs: 400, LatencySamples: 10, Hits: 100},
+		{Member: "fast", Uptime: 1, LatencyMs: 50, LatencySamples: 10, Hits: 50},
+		{Member: "unmeasured", Uptime: 0.5},
+	}, w)
+
+	if scores[0].Member != "fast" || scores[0].Rank != 1 || scores[0].Score != 87.5 {
+		t.Fatalf("expected fast first with 87.5, got %+v", scores[0])
+	}
+	if scores[1].Member != "slow" || scores[1].Score != 81.25 {
+		t.Fatalf("expected slow second, got %+v", scores[1])
+	}
+	// Without latency samples the latency weight is left out.
+	if scores[2].Member != "unmeasured" || scores[2].Score != 33.33 {
+		t.Fatalf("expected unmeasured scored on uptime and usage only, got %+v", scores[2])
+	}
+	if scores[0].UsageShare != 50.0/150 {
+		t.Fatalf("expected usage share of total hits, got %v", scores[0].UsageShare)
+	}
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+)
+
+// -----------------------------------------------------------------------------
+// SERVICE RESOLUTION
+// -----------------------------------------------------------------------------
+//
+// Usage is counted per domain; at flush time each domain is attributed to
+// the Services entry whose provider RPC URLs use it, so reports can group
+// the domains of one network. The index is built on first use, so nodes
+// that never call Init (collators) can resolve too, and rebuilt on every
+// config reload.
+
+const serviceIndexReloadHook = "data.services"
+
+var serviceIndex = struct {
+	once     sync.Once
+	mu       sync.RWMutex
+	byDomain map[string]string
+}{byDomain: map[string]string{}}
+
+// buildServiceIndex maps every provider RPC domain to its service key. A
+// domain listed by several services goes to the first key in sort order.
+func buildServiceIndex(services map[string]cfg.Service) map[string]string {
+	keys := make([]string, 0, len(services))
+	for k := range services {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make(map[string]string)
+	for _, key := range keys {
+		for _, provider := range services[key].Providers {
+			for _, rpcURL := range provider.RpcUrls {
+				domain := strings.ToLower(max.ParseUrl(rpcURL).Domain)
+				if domain == "" {
+					continue
+				}
+				if _, taken := out[domain]; !taken {
+					out[domain] = key
+				}
+			}
+		}
+	}
+	return out
+}
+
+func loadServiceIndex() {
+	idx := buildServiceIndex(cfg.GetConfig().Services)
+	serviceIndex.mu.Lock()
+	serviceIndex.byDomain = idx
+	serviceIndex.mu.Unlock()
+}
+
+// ServiceForDomain returns the Services key serving domain, or "" when no
+// configured service uses it.
+func ServiceForDomain(domain string) string {
+	serviceIndex.once.Do(func() {
+		loadServiceIndex()
+		cfg.RegisterReloadHook(serviceIndexReloadHook, loadServiceIndex)
+	})
+	serviceIndex.mu.RLock()
+	defer serviceIndex.mu.RUnlock()
+	return serviceIndex.byDomain[strings.ToLower(domain)]
+}
@@ -0,0 +1,195 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+)
+
+// -----------------------------------------------------------------------------
+// SERVICE HEALTH
+// -----------------------------------------------------------------------------
+//
+// Member status answers "is this member up"; service health answers "is
+// this network still served". A service's providers are the members listed
+// under its Providers. A provider is eligible when its member is active, not
+// overridden and at least the service's LevelRequired, and healthy when it
+// is eligible and no official site result of the member, nor domain or
+// endpoint result on one of the service's domains, is failing. The service
+// meets its requirement when it has a healthy provider and every region with
+// an eligible provider still has a healthy one.
+
+// ProviderRegionUnknown groups providers whose member has no Location.Region.
+const ProviderRegionUnknown = "unknown"
+
+// RegionHealth counts the providers of a service in one region.
+type RegionHealth struct {
+	Region   string `json:"region"`
+	Eligible int    `json:"eligible"`
+	Healthy  int    `json:"healthy"`
+}
+
+// ServiceHealth is the aggregated state of one service.
+type ServiceHealth struct {
+	Service          string         `json:"service"`
+	LevelRequired    int            `json:"levelRequired"`
+	Providers        int            `json:"providers"`
+	Eligible         int            `json:"eligible"`
+	Healthy          int            `json:"healthy"`
+	Regions          []RegionHealth `json:"regions"`
+	Unhealthy        []string       `json:"unhealthy,omitempty"` // eligible providers with a failing check
+	MeetsRequirement bool           `json:"meetsRequirement"`
+	CheckedAt        time.Time      `json:"checkedAt"`
+}
+
+// GetServiceHealth aggregates the official results of every provider of
+// serviceName. An unknown service returns ErrNotFound.
+func GetServiceHealth(serviceName string) (ServiceHealth, error) {
+	c := cfg.GetConfig()
+	svc, ok := c.Services[serviceName]
+	if !ok {
+		return ServiceHealth{}, fmt.Errorf("service %s: %w", serviceName, ErrNotFound)
+	}
+	sites, domains, endpoints := GetOfficialResults()
+	return serviceHealth(serviceName, svc, c.Members, failingMembers(svc, sites, domains, endpoints)), nil
+}
+
+// GetAllServiceHealth aggregates every configured service, sorted by name,
+// from one read of the official results.
+func GetAllServiceHealth() []ServiceHealth {
+	c := cfg.GetConfig()
+	sites, domains, endpoints := GetOfficialResults()
+	names := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]ServiceHealth, 0, len(names))
+	for _, name := range names {
+		svc := c.Services[name]
+		out = append(out, serviceHealth(name, svc, c.Members, failingMembers(svc, sites, domains, endpoints)))
+	}
+	return out
+}
+
+// failingMembers returns the members with a failing official result that
+// affects svc: any site check, or a domain or endpoint check on one of the
+// service's domains.
+func failingMembers(svc cfg.Service, sites []SiteResult, domains []DomainResult, endpoints []EndpointResult) map[string]bool {
+	svcDomains := make(map[string]bool)
+	for _, provider := range svc.Providers {
+		for _, rpcURL := range provider.RpcUrls {
+			if d := strings.ToLower(max.ParseUrl(rpcURL).Domain); d != "" {
+				svcDomains[d] = true
+			}
+		}
+	}
+
+	failing := make(map[string]bool)
+	mark := func(results []Result) {
+		for _, r := range results {
+			if !r.Status {
+				failing[r.Member.Details.Name] = true
+			}
+		}
+	}
+	for _, sr := range sites {
+		mark(sr.Results)
+	}
+	for _, dr := range domains {
+		if svcDomains[strings.ToLower(dr.Domain)] {
+			mark(dr.Results)
+		}
+	}
+	for _, er := range endpoints {
+		if svcDomains[strings.ToLower(er.Domain)] {
+			mark(er.Results)
+		}
+	}
+	return failing
+}
+
+func serviceHealth(name string, svc cfg.Service, members map[string]cfg.Member, failing map[string]bool) ServiceHealth {
+	h := ServiceHealth{
+		Service:       name,
+		LevelRequired: svc.Configuration.LevelRequired,
+		Providers:     len(svc.Providers),
+		CheckedAt:     time.Now().UTC(),
+	}
+	regions := make(map[string]*RegionHealth)
+	for key := range svc.Providers {
+		m, ok := members[key]
+		if !ok || m.Override || m.Service.Active != 1 || m.Membership.Level < svc.Configuration.LevelRequired {
+			continue
+		}
+		memberName := m.Details.Name
+		if memberName == "" {
+			memberName = key
+		}
+		region := m.Location.Region
+		if region == "" {
+			region = ProviderRegionUnknown
+		}
+		rh := regions[region]
+		if rh == nil {
+			rh = &RegionHealth{Region: region}
+			regions[region] = rh
+		}
+		h.Eligible++
+		rh.Eligible++
+		if failing[memberName] {
+			h.Unhealthy = append(h.Unhealthy, memberName)
+			continue
+		}
+		h.Healthy++
+		rh.Healthy++
+	}
+
+	h.Regions = make([]RegionHealth, 0, len(regions))
+	h.MeetsRequirement = h.Healthy > 0
+	for _, rh := range regions {
+		h.Regions = append(h.Regions, *rh)
+		if rh.Healthy == 0 {
+			h.MeetsRequirement = false
+		}
+	}
+	sort.Slice(h.Regions, func(i, j int) bool { return h.Regions[i].Region < h.Regions[j].Region })
+	sort.Strings(h.Unhealthy)
+	return h
+}
+
+// ServiceHealthHandler exposes GetServiceHealth for a REST API: GET with
+// service=<Services key>. Authentication is left to the API that mounts
+// the handler.
+func ServiceHealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := r.URL.Query().Get("service")
+		if name == "" {
+			http.Error(w, "service required", http.StatusBadRequest)
+			return
+		}
+		h, err := GetServiceHealth(name)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(h)
+	})
+}
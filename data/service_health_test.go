@@ -0,0 +1,63 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func TestServiceHealthAggregatesProvidersByRegion(t *testing.T) {
+	member := func(name, region string, level int) cfg.Member {
+		m := cfg.Member{Details: cfg.MemberDetails{Name: name}, Location: cfg.Location{Region: region}}
+		m.Service.Active, m.Membership.Level = 1, level
+		return m
+	}
+	members := map[string]cfg.Member{
+		"eu-1": member("eu-1", "eu", 5),
+		"eu-2": member("eu-2", "eu", 5),
+		"us-1": member("us-1", "us", 5),
+		"low":  member("low", "us", 1), // below LevelRequired
+		"off":  member("off", "as", 5),
+	}
+	off := members["off"]
+	off.Override = true
+	members["off"] = off
+
+	svc := cfg.Service{
+		Configuration: cfg.ServiceConfiguration{LevelRequired: 3},
+		Providers: map[string]cfg.ServiceProvider{
+			"eu-1": {RpcUrls: []string{"wss://rpc.example/eu-1"}},
+			"eu-2": {RpcUrls: []string{"wss://rpc.example/eu-2"}},
+			"us-1": {RpcUrls: []string{"wss://rpc.example/us-1"}},
+			"low":  {RpcUrls: []string{"wss://rpc.example/low"}},
+			"off":  {RpcUrls: []string{"wss://rpc.example/off"}},
+		},
+	}
+	result := func(name string, up bool) Result {
+		return Result{Member: cfg.Member{Details: cfg.MemberDetails{Name: name}}, Status: up}
+	}
+	domains := []DomainResult{
+		{Domain: "RPC.example", Results: []Result{result("eu-1", false), result("eu-2", true)}},
+		{Domain: "other.example", Results: []Result{result("us-1", false)}}, // another service
+	}
+
+	h := serviceHealth("polkadot", svc, members, failingMembers(svc, nil, domains, nil))
+	if h.Providers != 5 || h.Eligible != 3 || h.Healthy != 2 {
+		t.Fatalf("unexpected counts %+v", h)
+	}
+	want := []RegionHealth{{Region: "eu", Eligible: 2, Healthy: 1}, {Region: "us", Eligible: 1, Healthy: 1}}
+	if !reflect.DeepEqual(h.Regions, want) {
+		t.Fatalf("expected regions %+v, got %+v", want, h.Regions)
+	}
+	if !reflect.DeepEqual(h.Unhealthy, []string{"eu-1"}) || !h.MeetsRequirement {
+		t.Fatalf("expected eu-1 unhealthy and requirement met, got %+v", h)
+	}
+
+	// A failing site check takes out the only provider of the us region.
+	sites := []SiteResult{{Results: []Result{result("us-1", false)}}}
+	h = serviceHealth("polkadot", svc, members, failingMembers(svc, sites, domains, nil))
+	if h.MeetsRequirement || h.Healthy != 1 {
+		t.Fatalf("expected the requirement missed with us down, got %+v", h)
+	}
+}
@@ -0,0 +1,27 @@
+package data
+
+import (
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func TestBuildServiceIndex(t *testing.T) {
+	services := map[string]cfg.Service{
+		"polkadot": {Providers: map[string]cfg.ServiceProvider{
+			"m1": {RpcUrls: []string{"wss://RPC.example/polkadot", "https://sys.example/asset-hub"}},
+		}},
+		"kusama": {Providers: map[string]cfg.ServiceProvider{
+			"m1": {RpcUrls: []string{"wss://ksm.example", "https://sys.example/people"}},
+		}},
+	}
+	idx := buildServiceIndex(services)
+
+	if idx["rpc.example"] != "polkadot" || idx["ksm.example"] != "kusama" {
+		t.Fatalf("expected domains mapped to their services, got %v", idx)
+	}
+	// sys.example is listed by both; the first key in sort order wins.
+	if idx["sys.example"] != "kusama" {
+		t.Fatalf("expected shared domain attributed to kusama, got %q", idx["sys.example"])
+	}
+}
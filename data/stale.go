@@ -0,0 +1,231 @@
+package data
+
+import (
+	"sync"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// STALE RESULT REAPER
+// -----------------------------------------------------------------------------
+//
+// Official results are only replaced when a new consensus round finalizes, so
+// a member that is removed from monitoring would otherwise keep its last
+// result forever. The reaper marks such results stale: results of members no
+// longer in the config always, and results older than StaleResultChecks
+// check intervals when that option is set. Stale results stay in the store
+// but are reported by StaleStatus so DNS routing can exclude the member.
+//
+// An official result only gets a new Checktime when its status changes, so
+// a healthy member would age out however often it is checked. The reaper
+// therefore first moves each official Checktime forward to that of this
+// node's local result for the same check and member when both agree on the
+// status: the member is still being checked and the official status still
+// holds. The refreshed times reach DNS nodes with the official snapshot.
+
+const (
+	staleReapInterval = 30 * time.Second
+
+	// defaultCheckInterval is used for checks without a minimumInterval.
+	defaultCheckInterval = 5 * time.Minute
+)
+
+// StaleResult identifies one stale official result.
+type StaleResult struct {
+	CheckType  string
+	CheckName  string
+	MemberName string
+	Domain     string
+	Endpoint   string
+	IsIPv6     bool
+	Checktime  time.Time
+}
+
+var staleReaperOnce sync.Once
+
+func ensureStaleReaperOnce() {
+	staleReaperOnce.Do(func() {
+		go startStaleReaper()
+	})
+}
+
+func startStaleReaper() {
+	ticker := time.NewTicker(staleReapInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if n := reapStaleResults(time.Now().UTC(), cfg.GetConfig()); n > 0 {
+			log.Log(log.Info, "[data] marked %d official results stale", n)
+		}
+	}
+}
+
+// reapStaleResults updates the Stale flag of every official result and
+// returns how many results became stale.
+func reapStaleResults(now time.Time, c cfg.Config) int {
+	local := localCheckTimes()
+
+	Official.Mu.Lock()
+	defer Official.Mu.Unlock()
+
+	set := configuredSet(c)
+	changed, marked := false, 0
+	mark := func(key resultKey, check cfg.Check, results []Result) {
+		for i := range results {
+			key.member = results[i].Member.Details.Name
+			if l, ok := local[key]; ok && l.Status == results[i].Status && l.Checktime.After(results[i].Checktime) {
+				results[i].Checktime = l.Checktime
+				changed = true
+			}
+			stale := resultIsStale(results[i], check, set, c.Local.System.StaleResultChecks, now)
+			if stale == results[i].Stale {
+				continue
+			}
+			results[i].Stale = stale
+			changed = true
+			if stale {
+				marked++
+			}
+		}
+	}
+
+	for _, sr := range Official.SiteResults {
+		mark(siteKey(sr), sr.Check, sr.Results)
+	}
+	for _, dr := range Official.DomainResults {
+		mark(domainKey(dr), dr.Check, dr.Results)
+	}
+	for _, er := range Official.EndpointResults {
+		mark(endpointKey(er), er.Check, er.Results)
+	}
+
+	if changed {
+		publishSnapshotLocked()
+	}
+	return marked
+}
+
+// resultKey identifies the result of one member for one check.
+type resultKey struct {
+	checkType string
+	check     string
+	domain    string
+	endpoint  string
+	ipv6      bool
+	member    string
+}
+
+func siteKey(sr SiteResult) resultKey {
+	return resultKey{checkType: "site", check: sr.Check.Name, ipv6: sr.IsIPv6}
+}
+
+func domainKey(dr DomainResult) resultKey {
+	return resultKey{checkType: "domain", check: dr.Check.Name, domain: dr.Domain, ipv6: dr.IsIPv6}
+}
+
+func endpointKey(er EndpointResult) resultKey {
+	return resultKey{checkType: "endpoint", check: er.Check.Name, domain: er.Domain, endpoint: er.RpcUrl, ipv6: er.IsIPv6}
+}
+
+// localCheckTimes returns this node's local results by key, with only the
+// status and check time filled in.
+func localCheckTimes() map[resultKey]Result {
+	Local.Mu.RLock()
+	defer Local.Mu.RUnlock()
+
+	out := make(map[resultKey]Result)
+	add := func(key resultKey, results []Result) {
+		for _, r := range results {
+			key.member = r.Member.Details.Name
+			out[key] = Result{Status: r.Status, Checktime: r.Checktime}
+		}
+	}
+	for _, sr := range Local.SiteResults {
+		add(siteKey(sr), sr.Results)
+	}
+	for _, dr := range Local.DomainResults {
+		add(domainKey(dr), dr.Results)
+	}
+	for _, er := range Local.EndpointResults {
+		add(endpointKey(er), er.Results)
+	}
+	return out
+}
+
+func resultIsStale(r Result, check cfg.Check, set configSet, checks int, now time.Time) bool {
+	if !set.hasMember(r.Member.Details.Name) {
+		return true
+	}
+	if checks <= 0 || r.Checktime.IsZero() {
+		return false
+	}
+	interval := defaultCheckInterval
+	if check.MinimumInterval > 0 {
+		interval = time.Duration(check.MinimumInterval) * time.Second
+	}
+	return now.Sub(r.Checktime) > time.Duration(checks)*interval
+}
+
+// StaleStatus reports whether memberName has any official results and
+// whether all of them are stale. Routing should exclude a member when both
+// are true.
+func StaleStatus(memberName string) (found bool, stale bool) {
+	sites, domains, endpoints := GetOfficialResults()
+
+	stale = true
+	visit := func(results []Result) {
+		for _, r := range results {
+			if r.Member.Details.Name != memberName {
+				continue
+			}
+			found = true
+			if !r.Stale {
+				stale = false
+			}
+		}
+	}
+	for _, sr := range sites {
+		visit(sr.Results)
+	}
+	for _, dr := range domains {
+		visit(dr.Results)
+	}
+	for _, er := range endpoints {
+		visit(er.Results)
+	}
+	return found, found && stale
+}
+
+// StaleResults lists every official result currently marked stale.
+func StaleResults() []StaleResult {
+	sites, domains, endpoints := GetOfficialResults()
+
+	var out []StaleResult
+	for _, sr := range sites {
+		for _, r := range sr.Results {
+			if r.Stale {
+				out = append(out, StaleResult{CheckType: "site", CheckName: sr.Check.Name,
+					MemberName: r.Member.Details.Name, IsIPv6: sr.IsIPv6, Checktime: r.Checktime})
+			}
+		}
+	}
+	for _, dr := range domains {
+		for _, r := range dr.Results {
+			if r.Stale {
+				out = append(out, StaleResult{CheckType: "domain", CheckName: dr.Check.Name,
+					MemberName: r.Member.Details.Name, Domain: dr.Domain, IsIPv6: dr.IsIPv6, Checktime: r.Checktime})
+			}
+		}
+	}
+	for _, er := range endpoints {
+		for _, r := range er.Results {
+			if r.Stale {
+				out = append(out, StaleResult{CheckType: "endpoint", CheckName: er.Check.Name,
+					MemberName: r.Member.Details.Name, Domain: er.Domain, Endpoint: er.RpcUrl, IsIPv6: er.IsIPv6, Checktime: r.Checktime})
+			}
+		}
+	}
+	return out
+}
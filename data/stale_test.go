@@ -0,0 +1,163 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func restoreOfficialResults(t *testing.T) {
+	t.Helper()
+	originalOfficial := currentOfficialResultsState()
+	originalSnapshot := currentOfficialSnapshot()
+	t.Cleanup(func() {
+		Official.Mu.Lock()
+		Official.SiteResults = cloneSiteResults(originalOfficial.SiteResults)
+		Official.DomainResults = cloneDomainResults(originalOfficial.DomainResults)
+		Official.EndpointResults = cloneEndpointResults(originalOfficial.EndpointResults)
+		publishSnapshotLocked()
+		Official.Mu.Unlock()
+		SetOfficialSnapshot(originalSnapshot)
+	})
+}
+
+func staleTestConfig(checks int, members ...string) cfg.Config {
+	c := cfg.Config{Members: map[string]cfg.Member{}}
+	c.Local.System.StaleResultChecks = checks
+	for _, m := range members {
+		c.Members[m] = cfg.Member{Details: cfg.MemberDetails{Name: m}}
+	}
+	return c
+}
+
+func TestReapStaleResultsMarksRemovedMembers(t *testing.T) {
+	restoreOfficialResults(t)
+
+	now := time.Now().UTC()
+	SetOfficialSiteResults([]SiteResult{{
+		Check: cfg.Check{Name: "ping"},
+		Results: []Result{
+			{Member: cfg.Member{Details: cfg.MemberDetails{Name: "kept"}}, Status: true, Checktime: now},
+			{Member: cfg.Member{Details: cfg.MemberDetails{Name: "removed"}}, Status: true, Checktime: now},
+		},
+	}})
+
+	if n := reapStaleResults(now, staleTestConfig(0, "kept")); n != 1 {
+		t.Fatalf("expected 1 result marked stale, got %d", n)
+	}
+	if found, stale := StaleStatus("removed"); !found || !stale {
+		t.Fatalf("expected removed member to be stale, found=%v stale=%v", found, stale)
+	}
+	if found, stale := StaleStatus("kept"); !found || stale {
+		t.Fatalf("expected kept member to be fresh, found=%v stale=%v", found, stale)
+	}
+	if found, _ := StaleStatus("unknown"); found {
+		t.Fatal("expected no results for unknown member")
+	}
+
+	list := StaleResults()
+	if len(list) != 1 || list[0].MemberName != "removed" || list[0].CheckType != "site" {
+		t.Fatalf("unexpected stale results %+v", list)
+	}
+}
+
+func TestReapStaleResultsAppliesCheckIntervalTTL(t *testing.T) {
+	restoreOfficialResults(t)
+
+	now := time.Now().UTC()
+	check := cfg.Check{Name: "wss", MinimumInterval: 60}
+	SetOfficialEndpointResults([]EndpointResult{{
+		Check:  check,
+		Domain: "rpc.example.com",
+		RpcUrl: "wss://rpc.example.com",
+		Results: []Result{
+			{Member: cfg.Member{Details: cfg.MemberDetails{Name: "old"}}, Checktime: now.Add(-4 * time.Minute)},
+			{Member: cfg.Member{Details: cfg.MemberDetails{Name: "recent"}}, Checktime: now.Add(-2 * time.Minute)},
+		},
+	}})
+
+	c := staleTestConfig(3, "old", "recent")
+	if n := reapStaleResults(now, c); n != 1 {
+		t.Fatalf("expected 1 result past 3 intervals, got %d", n)
+	}
+	if _, stale := StaleStatus("old"); !stale {
+		t.Fatal("expected result older than 3 intervals to be stale")
+	}
+	if _, stale := StaleStatus("recent"); stale {
+		t.Fatal("expected result within 3 intervals to stay fresh")
+	}
+
+	// Disabling the TTL clears the flag again.
+	if n := reapStaleResults(now, staleTestConfig(0, "old", "recent")); n != 0 {
+		t.Fatalf("expected no newly stale results, got %d", n)
+	}
+	if _, stale := StaleStatus("old"); stale {
+		t.Fatal("expected stale flag to clear once the TTL no longer applies")
+	}
+}
+
+func TestUpdateOfficialResultClearsStale(t *testing.T) {
+	restoreOfficialResults(t)
+
+	member := cfg.Member{Details: cfg.MemberDetails{Name: "provider1"}}
+	SetOfficialSiteResults([]SiteResult{{
+		Check:   cfg.Check{Name: "ping"},
+		Results: []Result{{Member: member, Status: true, Stale: true}},
+	}})
+
+	UpdateOfficialSiteResult(cfg.Check{Name: "ping"}, member, true, "", nil, false)
+
+	if _, stale := StaleStatus("provider1"); stale {
+		t.Fatal("expected a fresh official update to clear the stale flag")
+	}
+}
+
+func TestReapStaleResultsKeepsUnchangedCheckedMembersFresh(t *testing.T) {
+	restoreOfficialResults(t)
+	sites, domains, endpoints := GetLocalResults()
+	t.Cleanup(func() {
+		SetLocalSiteResults(sites)
+		SetLocalDomainResults(domains)
+		SetLocalEndpointResults(endpoints)
+	})
+
+	now := time.Now().UTC()
+	check := cfg.Check{Name: "ping", MinimumInterval: 60}
+	healthy := cfg.Member{Details: cfg.MemberDetails{Name: "healthy"}}
+	flapped := cfg.Member{Details: cfg.MemberDetails{Name: "flapped"}}
+	// Both official results were finalized an hour ago, 60 intervals back.
+	SetOfficialSiteResults([]SiteResult{{
+		Check: check,
+		Results: []Result{
+			{Member: healthy, Status: true, Checktime: now.Add(-time.Hour)},
+			{Member: flapped, Status: true, Checktime: now.Add(-time.Hour)},
+		},
+	}})
+	// This node checked both a moment ago; only healthy still agrees.
+	SetLocalSiteResults([]SiteResult{{
+		Check: check,
+		Results: []Result{
+			{Member: healthy, Status: true, Checktime: now.Add(-30 * time.Second)},
+			{Member: flapped, Status: false, Checktime: now.Add(-30 * time.Second)},
+		},
+	}})
+	SetLocalDomainResults(nil)
+	SetLocalEndpointResults(nil)
+
+	if n := reapStaleResults(now, staleTestConfig(3, "healthy", "flapped")); n != 1 {
+		t.Fatalf("expected only the disagreeing result to go stale, got %d", n)
+	}
+	if _, stale := StaleStatus("healthy"); stale {
+		t.Fatal("expected a member whose unchanged status is still checked to stay fresh")
+	}
+	if _, stale := StaleStatus("flapped"); !stale {
+		t.Fatal("expected a result the local check no longer confirms to age out")
+	}
+	official, _, _ := GetOfficialResults()
+	for _, r := range official[0].Results {
+		if r.Member.Details.Name == "healthy" && !r.Checktime.Equal(now.Add(-30*time.Second)) {
+			t.Fatalf("expected the official check time to follow the local check, got %v", r.Checktime)
+		}
+	}
+}
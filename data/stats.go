@@ -3,9 +3,12 @@ package data
 import (
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	"github.com/ibp-network/ibp-geodns-libs/internal/requestschema"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
 	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
 )
@@ -25,6 +28,8 @@ func normaliseCountryCode(code string) string {
 
 type dailyUsageKey struct {
 	Date        string
+	Hourly      bool
+	Hour        int
 	Domain      string
 	MemberName  string
 	CountryCode string
@@ -35,32 +40,165 @@ type dailyUsageKey struct {
 }
 
 type usageMemory struct {
-	mu   sync.Mutex
-	data map[dailyUsageKey]int
+	mu      sync.Mutex
+	data    map[dailyUsageKey]int
+	pending map[dailyUsageKey]int // hits not yet in the usage journal
 }
 
 var usageMem = &usageMemory{
-	data: make(map[dailyUsageKey]int),
+	data:    make(map[dailyUsageKey]int),
+	pending: make(map[dailyUsageKey]int),
 }
 
 var usageNodeID = func() string {
 	return cfg.GetConfig().Local.Nats.NodeID
 }
 
+// -----------------------------------------------------------------------------
+// HOURLY USAGE
+// -----------------------------------------------------------------------------
+
+const (
+	usageConfigReloadHook      = "data.usage"
+	defaultHourlyRetentionDays = 30
+)
+
+// hourlyUsage mirrors System.Usage.Hourly so RecordDnsHit does not read the
+// config on every hit.
+var hourlyUsage atomic.Bool
+
+// Values of System.Usage.NonPublicSources.
+const (
+	nonPublicRecord = "record"
+	nonPublicSkip   = "skip"
+	nonPublicBucket = "bucket"
+)
+
+// nonPublicSources mirrors System.Usage.NonPublicSources.
+var nonPublicSources atomic.Value
+
+// clientPrefixV4 and clientPrefixV6 mirror System.Usage.ClientPrefixV4 and
+// ClientPrefixV6; 0 selects the maxmind default.
+var clientPrefixV4, clientPrefixV6 atomic.Int32
+
+// Bits of omittedDimensions, which mirrors System.Usage.OmitDimensions.
+const (
+	omitASN uint32 = 1 << iota
+	omitNetworkName
+	omitCountryName
+)
+
+var omittedDimensions atomic.Uint32
+
+func loadUsageConfig() {
+	u := cfg.GetConfig().Local.System.Usage
+	hourlyUsage.Store(u.Hourly)
+	clientPrefixV4.Store(int32(u.ClientPrefixV4))
+	clientPrefixV6.Store(int32(u.ClientPrefixV6))
+	truncateClientIPs.Store(u.TruncateClientIPs)
+
+	var omit uint32
+	for _, d := range u.OmitDimensions {
+		switch d {
+		case cfg.UsageDimensionASN:
+			omit |= omitASN
+		case cfg.UsageDimensionNetworkName:
+			omit |= omitNetworkName
+		case cfg.UsageDimensionCountryName:
+			omit |= omitCountryName
+		default:
+			log.Log(log.Warn, "[data] unknown Usage.OmitDimensions entry %q ignored", d)
+		}
+	}
+	omittedDimensions.Store(omit)
+
+	policy := strings.ToLower(strings.TrimSpace(u.NonPublicSources))
+	switch policy {
+	case nonPublicSkip, nonPublicBucket:
+	case "", nonPublicRecord:
+		policy = nonPublicRecord
+	default:
+		log.Log(log.Warn, "[data] unknown Usage.NonPublicSources %q, recording non-public sources", u.NonPublicSources)
+		policy = nonPublicRecord
+	}
+	nonPublicSources.Store(policy)
+}
+
+func nonPublicPolicy() string {
+	if p, ok := nonPublicSources.Load().(string); ok {
+		return p
+	}
+	return nonPublicRecord
+}
+
+// HourlyRetention returns how long hourly usage rows are kept before they
+// are folded into daily rows.
+func HourlyRetention(c cfg.UsageConfig) time.Duration {
+	days := c.HourlyRetentionDays
+	if days <= 0 {
+		days = defaultHourlyRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// RollupHourlyUsage folds hourly usage rows older than the configured
+// retention into daily rows.
+func RollupHourlyUsage() {
+	if !statsEnabled() {
+		return
+	}
+	before := time.Now().UTC().Add(-HourlyRetention(cfg.GetConfig().Local.System.Usage))
+	n, err := requestschema.RollupHourly(mysql.DB, before)
+	if err != nil {
+		log.Log(log.Error, "[RollupHourlyUsage] %v", err)
+		return
+	}
+	if n > 0 {
+		log.Log(log.Info, "[RollupHourlyUsage] folded %d hourly rows before %s into daily rows",
+			n, before.Format("2006-01-02"))
+	}
+}
+
 func RecordDnsHit(isIPv6 bool, clientIP, domain, memberName string) {
 	if !statsEnabled() || domain == "" || clientIP == "" {
 		return
 	}
+	clientIP = minimiseClientIP(clientIP)
 
-	countryCodeRaw := max.GetCountryCode(clientIP)
-	countryCode := normaliseCountryCode(countryCodeRaw)
-
-	countryName := max.GetCountryName(clientIP)
-	if countryCode == "??" {
-		countryName = "Unknown"
+	class := max.ClassPublic
+	policy := nonPublicPolicy()
+	if policy != nonPublicRecord {
+		class = max.ClassifyIP(clientIP)
+	}
+	if class != max.ClassPublic && policy == nonPublicSkip {
+		log.Log(log.Debug, "[RecordDnsHit] skipping %s source %s for domain=%s", class, clientIP, domain)
+		return
 	}
 
-	asn, netName := max.GetAsnAndNetwork(clientIP)
+	omit := omittedDimensions.Load()
+	var countryCode, countryName, asn, netName string
+	if class == max.ClassPublic {
+		countryCode = normaliseCountryCode(max.GetCountryCode(clientIP))
+		countryName = max.GetCountryName(clientIP)
+		if countryCode == "??" {
+			countryName = "Unknown"
+		}
+		if omit&(omitASN|omitNetworkName) != omitASN|omitNetworkName {
+			asn, netName = max.GetAsnAndNetwork(clientIP)
+		}
+	} else {
+		// Bucketed sources share one row per class and carry no GeoIP data.
+		countryCode, countryName, netName = "??", "Unknown", "("+string(class)+")"
+	}
+	if omit&omitASN != 0 {
+		asn = ""
+	}
+	if omit&omitNetworkName != 0 && class == max.ClassPublic {
+		netName = ""
+	}
+	if omit&omitCountryName != 0 {
+		countryName = ""
+	}
 
 	if memberName == "" {
 		memberName = "(none)"
@@ -71,6 +209,8 @@ func RecordDnsHit(isIPv6 bool, clientIP, domain, memberName string) {
 
 	key := dailyUsageKey{
 		Date:        dateStr,
+		Hourly:      hourlyUsage.Load(),
+		Hour:        now.Hour(),
 		Domain:      domain,
 		MemberName:  memberName,
 		CountryCode: countryCode,
@@ -80,63 +220,23 @@ func RecordDnsHit(isIPv6 bool, clientIP, domain, memberName string) {
 		IsIPv6:      isIPv6,
 	}
 
-	usageMem.mu.Lock()
-	usageMem.data[key]++
-	usageMem.mu.Unlock()
-
-	log.Log(log.Debug,
-		"[RecordDnsHit] domain=%s, member=%s, ip=%s, isIPv6=%v, cc=%s => increment usageMem",
-		domain, memberName, clientIP, isIPv6, countryCode)
-}
-
-func FlushUsageToDatabase(triggerDate string) {
-	if !statsEnabled() {
-		return
+	if !key.Hourly {
+		key.Hour = 0
 	}
 
 	usageMem.mu.Lock()
-	defer usageMem.mu.Unlock()
-
-	if len(usageMem.data) == 0 {
-		log.Log(log.Info,
-			"[FlushUsageToDatabase] No usage to flush (triggerDate=%s)",
-			triggerDate)
-		return
+	usageMem.data[key]++
+	if journalOn.Load() {
+		usageMem.pending[key]++
 	}
+	usageMem.mu.Unlock()
+	countLiveUsage(domain, memberName)
 
-	log.Log(log.Info,
-		"[FlushUsageToDatabase] Flushing %d usage records (triggerDate=%s)",
-		len(usageMem.data), triggerDate)
-
-	flushed := 0
-	for k, hits := range usageMem.data {
-		rec := UsageRecord{
-			Date:        k.Date,
-			NodeID:      usageNodeID(),
-			Domain:      k.Domain,
-			MemberName:  k.MemberName,
-			CountryCode: k.CountryCode,
-			Asn:         k.Asn,
-			NetworkName: k.NetworkName,
-			CountryName: k.CountryName,
-			Hits:        hits,
-			IsIPv6:      k.IsIPv6,
-		}
-
-		if err := UpsertUsageRecord(rec); err != nil {
-			log.Log(log.Error,
-				"[FlushUsageToDatabase] upsert error domain=%s member=%s date=%s: %v",
-				rec.Domain, rec.MemberName, rec.Date, err)
-			// continue even if one record fails
-			continue
-		}
-
-		// remove the key after successful flush
-		delete(usageMem.data, k)
-		flushed++
+	if class == max.ClassPublic {
+		recordUniqueClient(dateStr, domain, memberName, clientIP)
 	}
 
-	log.Log(log.Info,
-		"[FlushUsageToDatabase] Completed flush: %d records written, map size now %d",
-		flushed, len(usageMem.data))
+	log.Log(log.Debug,
+		"[RecordDnsHit] domain=%s, member=%s, ip=%s, isIPv6=%v, cc=%s => increment usageMem",
+		domain, memberName, clientIP, isIPv6, countryCode)
 }
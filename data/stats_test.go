@@ -0,0 +1,165 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func TestRecordDnsHitKeysHourWhenHourly(t *testing.T) {
+	SetCacheOptions(false, true)
+	defer SetCacheOptions(false, false)
+	defer hourlyUsage.Store(false)
+
+	usageMem.mu.Lock()
+	saved := usageMem.data
+	usageMem.data = make(map[dailyUsageKey]int)
+	usageMem.mu.Unlock()
+	defer func() {
+		usageMem.mu.Lock()
+		usageMem.data = saved
+		usageMem.mu.Unlock()
+	}()
+	uniqueMem.mu.Lock()
+	savedUnique := uniqueMem.data
+	uniqueMem.data = make(map[uniqueKey]*uniqueSketches)
+	uniqueMem.mu.Unlock()
+	defer func() {
+		uniqueMem.mu.Lock()
+		uniqueMem.data = savedUnique
+		uniqueMem.mu.Unlock()
+	}()
+
+	RecordDnsHit(false, "192.0.2.1", "rpc.example", "m")
+	hourlyUsage.Store(true)
+	RecordDnsHit(false, "192.0.2.1", "rpc.example", "m")
+
+	usageMem.mu.Lock()
+	defer usageMem.mu.Unlock()
+	if len(usageMem.data) != 2 {
+		t.Fatalf("expected a daily and an hourly counter, got %v", usageMem.data)
+	}
+	for k, hits := range usageMem.data {
+		if hits != 1 {
+			t.Fatalf("expected one hit per counter, got %v", usageMem.data)
+		}
+		if !k.Hourly && k.Hour != 0 {
+			t.Fatalf("expected daily counter without an hour, got %+v", k)
+		}
+	}
+}
+
+func TestHourlyRetention(t *testing.T) {
+	if got := HourlyRetention(cfg.UsageConfig{}); got != defaultHourlyRetentionDays*24*time.Hour {
+		t.Fatalf("expected default retention, got %v", got)
+	}
+	if got := HourlyRetention(cfg.UsageConfig{HourlyRetentionDays: 2}); got != 48*time.Hour {
+		t.Fatalf("expected 48h retention, got %v", got)
+	}
+}
+
+func TestRecordDnsHitNonPublicSources(t *testing.T) {
+	SetCacheOptions(false, true)
+	defer SetCacheOptions(false, false)
+	defer nonPublicSources.Store(nonPublicRecord)
+
+	usageMem.mu.Lock()
+	saved := usageMem.data
+	usageMem.data = make(map[dailyUsageKey]int)
+	usageMem.mu.Unlock()
+	defer func() {
+		usageMem.mu.Lock()
+		usageMem.data = saved
+		usageMem.mu.Unlock()
+	}()
+	uniqueMem.mu.Lock()
+	savedUnique := uniqueMem.data
+	uniqueMem.data = make(map[uniqueKey]*uniqueSketches)
+	uniqueMem.mu.Unlock()
+	defer func() {
+		uniqueMem.mu.Lock()
+		uniqueMem.data = savedUnique
+		uniqueMem.mu.Unlock()
+	}()
+
+	nonPublicSources.Store(nonPublicSkip)
+	RecordDnsHit(false, "10.1.2.3", "rpc.example", "m")
+	usageMem.mu.Lock()
+	skipped := len(usageMem.data)
+	usageMem.mu.Unlock()
+	if skipped != 0 {
+		t.Fatalf("expected private source to be skipped, got %d counters", skipped)
+	}
+
+	nonPublicSources.Store(nonPublicBucket)
+	RecordDnsHit(false, "10.1.2.3", "rpc.example", "m")
+	RecordDnsHit(false, "192.168.7.7", "rpc.example", "m")
+	RecordDnsHit(true, "::1", "rpc.example", "m")
+
+	usageMem.mu.Lock()
+	defer usageMem.mu.Unlock()
+	if len(usageMem.data) != 2 {
+		t.Fatalf("expected one private and one loopback bucket, got %v", usageMem.data)
+	}
+	for k, hits := range usageMem.data {
+		switch k.NetworkName {
+		case "(private)":
+			if hits != 2 || k.CountryCode != "??" {
+				t.Fatalf("expected two private hits without GeoIP data, got %+v=%d", k, hits)
+			}
+		case "(loopback)":
+		default:
+			t.Fatalf("unexpected bucket %+v", k)
+		}
+	}
+	if len(uniqueMem.data) != 0 {
+		t.Fatal("expected bucketed sources not to count as unique clients")
+	}
+}
+
+func TestRecordDnsHitOmitsDimensions(t *testing.T) {
+	SetCacheOptions(false, true)
+	defer SetCacheOptions(false, false)
+
+	prev := cfg.SetConfig(cfg.Config{Local: cfg.LocalConfig{System: cfg.SystemConfig{Usage: cfg.UsageConfig{
+		OmitDimensions: []string{cfg.UsageDimensionASN, cfg.UsageDimensionNetworkName, cfg.UsageDimensionCountryName},
+	}}}})
+	loadUsageConfig()
+	defer func() {
+		cfg.SetConfig(prev)
+		loadUsageConfig()
+	}()
+
+	usageMem.mu.Lock()
+	saved := usageMem.data
+	usageMem.data = make(map[dailyUsageKey]int)
+	usageMem.mu.Unlock()
+	defer func() {
+		usageMem.mu.Lock()
+		usageMem.data = saved
+		usageMem.mu.Unlock()
+	}()
+	uniqueMem.mu.Lock()
+	savedUnique := uniqueMem.data
+	uniqueMem.data = make(map[uniqueKey]*uniqueSketches)
+	uniqueMem.mu.Unlock()
+	defer func() {
+		uniqueMem.mu.Lock()
+		uniqueMem.data = savedUnique
+		uniqueMem.mu.Unlock()
+	}()
+
+	RecordDnsHit(false, "192.0.2.1", "rpc.example", "m")
+
+	usageMem.mu.Lock()
+	defer usageMem.mu.Unlock()
+	if len(usageMem.data) != 1 {
+		t.Fatalf("expected one counter, got %v", usageMem.data)
+	}
+	for k := range usageMem.data {
+		if k.Asn != "" || k.NetworkName != "" || k.CountryName != "" || k.CountryCode != "??" {
+			t.Fatalf("expected only the country code, got %+v", k)
+		}
+	}
+}
@@ -0,0 +1,487 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// STATUS HISTORY
+// -----------------------------------------------------------------------------
+//
+// Official results only hold the current status of each member check. With
+// System.StatusHistory.Enabled the sampler records that status every
+// IntervalMinutes into a time series, kept in the status_history table or in
+// compact per-day files, which QueryStatusHistory and StatusAvailability read
+// back for availability dashboards. Samples are stamped with the start of
+// their interval, so nodes sampling the same official results into one
+// database store each point once.
+
+const (
+	statusHistoryTick            = time.Minute
+	defaultStatusHistoryInterval = 5 * time.Minute
+	defaultStatusHistoryWindow   = 24 * time.Hour
+	statusHistoryDir             = "status-history"
+)
+
+// StatusSeriesKey identifies the series of one member check.
+type StatusSeriesKey struct {
+	MemberName string `json:"memberName"`
+	CheckType  string `json:"checkType"`
+	CheckName  string `json:"checkName"`
+	Domain     string `json:"domain,omitempty"`
+	Endpoint   string `json:"endpoint,omitempty"`
+	IsIPv6     bool   `json:"isIPv6"`
+}
+
+// StatusSample is the official status of one member check at one time.
+type StatusSample struct {
+	StatusSeriesKey
+	At    time.Time
+	Up    bool
+	Stale bool
+}
+
+// StatusPoint is one sample of a series.
+type StatusPoint struct {
+	At    time.Time `json:"at"`
+	Up    bool      `json:"up"`
+	Stale bool      `json:"stale,omitempty"`
+}
+
+// StatusSeries is the sampled history of one member check, oldest first.
+type StatusSeries struct {
+	StatusSeriesKey
+	Points []StatusPoint `json:"points"`
+}
+
+// AvailabilityBucket summarises the samples of a series in one step.
+type AvailabilityBucket struct {
+	Start        time.Time `json:"start"`
+	Samples      int       `json:"samples"`
+	Up           int       `json:"up"`
+	Availability float64   `json:"availability"` // Up / Samples
+}
+
+// AvailabilitySeries is the availability of one member check per step,
+// oldest first. Steps without samples are left out.
+type AvailabilitySeries struct {
+	StatusSeriesKey
+	Buckets []AvailabilityBucket `json:"buckets"`
+}
+
+// StatusHistoryFilter selects series and samples. Empty fields match
+// everything. Until defaults to now and Since to a day before Until.
+type StatusHistoryFilter struct {
+	MemberName string    `json:"memberName,omitempty"`
+	CheckType  string    `json:"checkType,omitempty"`
+	CheckName  string    `json:"checkName,omitempty"`
+	Domain     string    `json:"domain,omitempty"`
+	Since      time.Time `json:"since,omitempty"`
+	Until      time.Time `json:"until,omitempty"`
+}
+
+func (f StatusHistoryFilter) normalise(now time.Time) StatusHistoryFilter {
+	if f.Until.IsZero() {
+		f.Until = now
+	}
+	if f.Since.IsZero() {
+		f.Since = f.Until.Add(-defaultStatusHistoryWindow)
+	}
+	f.Since, f.Until = f.Since.UTC(), f.Until.UTC()
+	return f
+}
+
+func (f StatusHistoryFilter) matches(k StatusSeriesKey) bool {
+	return (f.MemberName == "" || strings.EqualFold(f.MemberName, k.MemberName)) &&
+		(f.CheckType == "" || strings.EqualFold(f.CheckType, k.CheckType)) &&
+		(f.CheckName == "" || strings.EqualFold(f.CheckName, k.CheckName)) &&
+		(f.Domain == "" || strings.EqualFold(f.Domain, k.Domain))
+}
+
+// statusHistoryStore keeps the samples.
+type statusHistoryStore interface {
+	write(samples []StatusSample) error
+	// query calls fn for each sample matching f, in any order.
+	query(f StatusHistoryFilter, fn func(StatusSample) error) error
+	prune(before time.Time) error
+}
+
+// statusHistoryNow is the sampler's clock; tests replace it.
+var statusHistoryNow = time.Now
+
+// statusHistoryFor returns the store c configures.
+func statusHistoryFor(c cfg.SystemConfig) statusHistoryStore {
+	if strings.EqualFold(strings.TrimSpace(c.StatusHistory.Store), "file") {
+		dir := c.StatusHistory.Path
+		if dir == "" {
+			dir = filepath.Join(c.WorkDir, statusHistoryDir)
+		}
+		return fileStatusHistory{dir: dir}
+	}
+	return mysqlStatusHistory{}
+}
+
+func statusHistoryInterval(c cfg.StatusHistoryConfig) time.Duration {
+	if c.IntervalMinutes <= 0 {
+		return defaultStatusHistoryInterval
+	}
+	return time.Duration(c.IntervalMinutes) * time.Minute
+}
+
+// SampleOfficialStatus returns the official status of every member check,
+// stamped at.
+func SampleOfficialStatus(at time.Time) []StatusSample {
+	sites, domains, endpoints := GetOfficialResults()
+	at = at.UTC()
+
+	var out []StatusSample
+	add := func(checkType, checkName, domain, endpoint string, isIPv6 bool, results []Result) {
+		for _, r := range results {
+			out = append(out, StatusSample{
+				StatusSeriesKey: StatusSeriesKey{
+					MemberName: r.Member.Details.Name,
+					CheckType:  checkType,
+					CheckName:  checkName,
+					Domain:     domain,
+					Endpoint:   endpoint,
+					IsIPv6:     isIPv6 || r.IsIPv6,
+				},
+				At:    at,
+				Up:    r.Status,
+				Stale: r.Stale,
+			})
+		}
+	}
+	for _, sr := range sites {
+		add("site", sr.Check.Name, "", "", sr.IsIPv6, sr.Results)
+	}
+	for _, dr := range domains {
+		add("domain", dr.Check.Name, dr.Domain, "", dr.IsIPv6, dr.Results)
+	}
+	for _, er := range endpoints {
+		add("endpoint", er.Check.Name, er.Domain, er.RpcUrl, er.IsIPv6, er.Results)
+	}
+	return out
+}
+
+// RecordStatusSample samples the official status at the start of the
+// configured interval containing at and stores it, whether or not the
+// sampler is enabled. It returns the number of samples written.
+func RecordStatusSample(at time.Time) (int, error) {
+	c := cfg.GetConfig().Local.System
+	slot := at.UTC().Truncate(statusHistoryInterval(c.StatusHistory))
+	return recordStatusSample(statusHistoryFor(c), slot)
+}
+
+func recordStatusSample(st statusHistoryStore, slot time.Time) (int, error) {
+	samples := SampleOfficialStatus(slot)
+	if len(samples) == 0 {
+		return 0, nil
+	}
+	if err := st.write(samples); err != nil {
+		return 0, fmt.Errorf("record status history: %w", err)
+	}
+	return len(samples), nil
+}
+
+// QueryStatusHistory returns the sampled series matching f, ordered by
+// member and check.
+func QueryStatusHistory(f StatusHistoryFilter) ([]StatusSeries, error) {
+	return queryStatusHistory(statusHistoryFor(cfg.GetConfig().Local.System), f)
+}
+
+func queryStatusHistory(st statusHistoryStore, f StatusHistoryFilter) ([]StatusSeries, error) {
+	f = f.normalise(statusHistoryNow().UTC())
+	if f.Since.After(f.Until) {
+		return nil, fmt.Errorf("query status history: since %s is after until %s",
+			f.Since.Format(time.RFC3339), f.Until.Format(time.RFC3339))
+	}
+
+	// A point sampled twice, e.g. by a restarted node, is kept once.
+	points := make(map[StatusSeriesKey]map[time.Time]StatusPoint)
+	err := st.query(f, func(s StatusSample) error {
+		ps, ok := points[s.StatusSeriesKey]
+		if !ok {
+			ps = make(map[time.Time]StatusPoint)
+			points[s.StatusSeriesKey] = ps
+		}
+		ps[s.At] = StatusPoint{At: s.At, Up: s.Up, Stale: s.Stale}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query status history: %w", err)
+	}
+
+	out := make([]StatusSeries, 0, len(points))
+	for k, ps := range points {
+		series := StatusSeries{StatusSeriesKey: k, Points: make([]StatusPoint, 0, len(ps))}
+		for _, p := range ps {
+			series.Points = append(series.Points, p)
+		}
+		sort.Slice(series.Points, func(i, j int) bool { return series.Points[i].At.Before(series.Points[j].At) })
+		out = append(out, series)
+	}
+	sort.Slice(out, func(i, j int) bool { return statusKeyLess(out[i].StatusSeriesKey, out[j].StatusSeriesKey) })
+	return out, nil
+}
+
+func statusKeyLess(a, b StatusSeriesKey) bool {
+	switch {
+	case a.MemberName != b.MemberName:
+		return a.MemberName < b.MemberName
+	case a.CheckType != b.CheckType:
+		return a.CheckType < b.CheckType
+	case a.CheckName != b.CheckName:
+		return a.CheckName < b.CheckName
+	case a.Domain != b.Domain:
+		return a.Domain < b.Domain
+	case a.Endpoint != b.Endpoint:
+		return a.Endpoint < b.Endpoint
+	}
+	return !a.IsIPv6 && b.IsIPv6
+}
+
+// StatusAvailability returns the share of up samples of each series matching
+// f per step, for plotting. Steps start at multiples of step since the Unix
+// epoch; step defaults to an hour.
+func StatusAvailability(f StatusHistoryFilter, step time.Duration) ([]AvailabilitySeries, error) {
+	series, err := QueryStatusHistory(f)
+	if err != nil {
+		return nil, err
+	}
+	return availability(series, step), nil
+}
+
+func availability(series []StatusSeries, step time.Duration) []AvailabilitySeries {
+	if step <= 0 {
+		step = time.Hour
+	}
+	out := make([]AvailabilitySeries, 0, len(series))
+	for _, s := range series {
+		as := AvailabilitySeries{StatusSeriesKey: s.StatusSeriesKey, Buckets: make([]AvailabilityBucket, 0)}
+		for _, p := range s.Points {
+			start := p.At.Truncate(step)
+			if n := len(as.Buckets); n == 0 || !as.Buckets[n-1].Start.Equal(start) {
+				as.Buckets = append(as.Buckets, AvailabilityBucket{Start: start})
+			}
+			b := &as.Buckets[len(as.Buckets)-1]
+			b.Samples++
+			if p.Up {
+				b.Up++
+			}
+		}
+		for i := range as.Buckets {
+			as.Buckets[i].Availability = float64(as.Buckets[i].Up) / float64(as.Buckets[i].Samples)
+		}
+		out = append(out, as)
+	}
+	return out
+}
+
+// -----------------------------------------------------------------------------
+// SAMPLER
+// -----------------------------------------------------------------------------
+//
+// The sampler checks the config every statusHistoryTick, so enabling it or
+// changing the interval takes effect on reload. It samples once per
+// interval, at the first tick of each, and applies RetentionDays once a day.
+
+var statusHistoryOnce sync.Once
+
+func ensureStatusHistoryOnce() {
+	statusHistoryOnce.Do(func() {
+		go startStatusHistory()
+	})
+}
+
+func startStatusHistory() {
+	ticker := time.NewTicker(statusHistoryTick)
+	defer ticker.Stop()
+	var (
+		lastSlot  time.Time
+		lastPrune string
+	)
+	for range ticker.C {
+		c := cfg.GetConfig().Local.System
+		if !c.StatusHistory.Enabled {
+			continue
+		}
+		now := statusHistoryNow().UTC()
+		slot := now.Truncate(statusHistoryInterval(c.StatusHistory))
+		if !slot.After(lastSlot) {
+			continue
+		}
+		lastSlot = slot
+
+		st := statusHistoryFor(c)
+		if n, err := recordStatusSample(st, slot); err != nil {
+			log.Log(log.Warn, "[data] %v", err)
+		} else {
+			log.Log(log.Debug, "[data] status history: %d samples at %s", n, slot.Format(time.RFC3339))
+		}
+
+		if days := c.StatusHistory.RetentionDays; days > 0 && now.Format("2006-01-02") != lastPrune {
+			lastPrune = now.Format("2006-01-02")
+			if err := st.prune(now.AddDate(0, 0, -days)); err != nil {
+				log.Log(log.Warn, "[data] status history retention: %v", err)
+			}
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+// MYSQL STORE
+// -----------------------------------------------------------------------------
+
+const statusHistoryInsertBatch = 500
+
+type mysqlStatusHistory struct{}
+
+func (mysqlStatusHistory) write(samples []StatusSample) error {
+	if mysql.DB == nil {
+		return fmt.Errorf("MySQL not initialised")
+	}
+	for len(samples) > 0 {
+		n := min(len(samples), statusHistoryInsertBatch)
+		rows := make([]string, 0, n)
+		args := make([]interface{}, 0, n*9)
+		for _, s := range samples[:n] {
+			rows = append(rows, "(?,?,?,?,?,?,?,?,?)")
+			args = append(args, s.At, s.MemberName, s.CheckType, s.CheckName, s.Domain, s.Endpoint,
+				s.IsIPv6, s.Up, s.Stale)
+		}
+		q := `INSERT INTO status_history
+			(sampled_at, member_name, check_type, check_name, domain_name, endpoint, is_ipv6, status, stale)
+			VALUES ` + strings.Join(rows, ",") + `
+			ON DUPLICATE KEY UPDATE status = VALUES(status), stale = VALUES(stale)`
+		if _, err := mysql.DB.Exec(q, args...); err != nil {
+			return fmt.Errorf("insert status history: %w", err)
+		}
+		samples = samples[n:]
+	}
+	return nil
+}
+
+func (mysqlStatusHistory) query(f StatusHistoryFilter, fn func(StatusSample) error) error {
+	if mysql.DB == nil {
+		return fmt.Errorf("MySQL not initialised")
+	}
+	conds := []string{"sampled_at BETWEEN ? AND ?"}
+	args := []interface{}{f.Since, f.Until}
+	for _, c := range []struct{ col, val string }{
+		{"member_name", f.MemberName},
+		{"check_type", f.CheckType},
+		{"check_name", f.CheckName},
+		{"domain_name", f.Domain},
+	} {
+		if c.val != "" {
+			conds = append(conds, c.col+" = ?")
+			args = append(args, c.val)
+		}
+	}
+	rows, err := mysql.DB.Query(`SELECT sampled_at, member_name, check_type, check_name, domain_name, endpoint, is_ipv6, status, stale
+		FROM status_history
+		WHERE `+strings.Join(conds, " AND "), args...)
+	if err != nil {
+		return fmt.Errorf("select status history: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s StatusSample
+		if err := rows.Scan(&s.At, &s.MemberName, &s.CheckType, &s.CheckName, &s.Domain, &s.Endpoint,
+			&s.IsIPv6, &s.Up, &s.Stale); err != nil {
+			return fmt.Errorf("scan status history: %w", err)
+		}
+		s.At = s.At.UTC()
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (mysqlStatusHistory) prune(before time.Time) error {
+	if mysql.DB == nil {
+		return fmt.Errorf("MySQL not initialised")
+	}
+	res, err := mysql.DB.Exec(`DELETE FROM status_history WHERE sampled_at < ?`, before.UTC())
+	if err != nil {
+		return fmt.Errorf("delete status history: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Log(log.Info, "[data] status history retention: removed %d samples before %s", n, before.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// HTTP
+// -----------------------------------------------------------------------------
+
+// StatusHistoryHandler serves the status history for dashboards: GET with
+// optional member, checkType, checkName, domain, since and until (RFC 3339).
+// With step (a Go duration such as 1h) it returns AvailabilitySeries,
+// otherwise StatusSeries. Authentication is left to the API that mounts the
+// handler.
+func StatusHistoryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		f := StatusHistoryFilter{
+			MemberName: q.Get("member"),
+			CheckType:  q.Get("checkType"),
+			CheckName:  q.Get("checkName"),
+			Domain:     q.Get("domain"),
+		}
+		var err error
+		for _, p := range []struct {
+			name string
+			dst  *time.Time
+		}{{"since", &f.Since}, {"until", &f.Until}} {
+			if v := q.Get(p.name); v != "" {
+				if *p.dst, err = time.Parse(time.RFC3339, v); err != nil {
+					http.Error(w, p.name+": "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		if !f.Since.IsZero() && !f.Until.IsZero() && f.Since.After(f.Until) {
+			http.Error(w, "since is after until", http.StatusBadRequest)
+			return
+		}
+
+		var body interface{}
+		if v := q.Get("step"); v != "" {
+			step, perr := time.ParseDuration(v)
+			if perr != nil || step <= 0 {
+				http.Error(w, "step must be a positive duration", http.StatusBadRequest)
+				return
+			}
+			body, err = StatusAvailability(f, step)
+		} else {
+			body, err = QueryStatusHistory(f)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	})
+}
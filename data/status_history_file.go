@@ -0,0 +1,300 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// FILE STORE
+// -----------------------------------------------------------------------------
+//
+// The file store keeps one file per UTC day, <date>.hist, laid out in
+// columns: each series is defined once per file and each sample time is one
+// line with one status character per series, so a day of 2,000 series
+// sampled every five minutes takes about 600 KB. Lines are tab-separated:
+//
+//	S <id> <member> <checkType> <checkName> <domain> <endpoint> <0|1 IPv6>
+//	T <unix seconds> <status column>
+//
+// The status character of series id is at offset id: '1' up, '0' down, 'u'
+// and 'd' up and down but stale, '.' not sampled. Series first seen during
+// the day are appended as new S lines before the T line that uses them.
+
+const statusHistoryFileExt = ".hist"
+
+// statusHistoryFileMu serialises writers of the file store.
+var statusHistoryFileMu sync.Mutex
+
+type fileStatusHistory struct {
+	dir string
+}
+
+var statusFieldReplacer = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+func (h fileStatusHistory) path(day time.Time) string {
+	return filepath.Join(h.dir, day.UTC().Format("2006-01-02")+statusHistoryFileExt)
+}
+
+func (h fileStatusHistory) write(samples []StatusSample) error {
+	statusHistoryFileMu.Lock()
+	defer statusHistoryFileMu.Unlock()
+
+	if err := os.MkdirAll(h.dir, 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", h.dir, err)
+	}
+
+	byTime := make(map[time.Time][]StatusSample)
+	var times []time.Time
+	for _, s := range samples {
+		at := s.At.UTC().Truncate(time.Second)
+		if _, ok := byTime[at]; !ok {
+			times = append(times, at)
+		}
+		byTime[at] = append(byTime[at], s)
+	}
+	for _, at := range times {
+		if err := h.writeAt(at, byTime[at]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAt appends the samples taken at at to the file of their day.
+func (h fileStatusHistory) writeAt(at time.Time, samples []StatusSample) error {
+	path := h.path(at)
+	ids, err := readStatusSeries(path)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if tornLastLine(path) {
+		buf.WriteByte('\n')
+	}
+	for _, s := range samples {
+		if _, ok := ids[s.StatusSeriesKey]; ok {
+			continue
+		}
+		id := len(ids)
+		ids[s.StatusSeriesKey] = id
+		ipv6 := "0"
+		if s.IsIPv6 {
+			ipv6 = "1"
+		}
+		fmt.Fprintf(&buf, "S\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", id,
+			statusFieldReplacer.Replace(s.MemberName), statusFieldReplacer.Replace(s.CheckType),
+			statusFieldReplacer.Replace(s.CheckName), statusFieldReplacer.Replace(s.Domain),
+			statusFieldReplacer.Replace(s.Endpoint), ipv6)
+	}
+
+	column := bytes.Repeat([]byte{'.'}, len(ids))
+	for _, s := range samples {
+		column[ids[s.StatusSeriesKey]] = statusChar(s.Up, s.Stale)
+	}
+	fmt.Fprintf(&buf, "T\t%d\t%s\n", at.Unix(), column)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	// One write, so a crash leaves at most a torn last line, which readers
+	// skip and the next write ends.
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// tornLastLine reports whether the file at path ends in a partial line.
+func tornLastLine(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil || st.Size() == 0 {
+		return false
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, st.Size()-1); err != nil {
+		return false
+	}
+	return last[0] != '\n'
+}
+
+// readStatusSeries returns the series ids defined in the file at path.
+func readStatusSeries(path string) (map[StatusSeriesKey]int, error) {
+	ids := make(map[StatusSeriesKey]int)
+	err := scanStatusFile(path, func(line string) {
+		if id, k, ok := parseStatusSeries(line); ok {
+			ids[k] = id
+		}
+	})
+	return ids, err
+}
+
+func (h fileStatusHistory) query(f StatusHistoryFilter, fn func(StatusSample) error) error {
+	for day := f.Since.Truncate(24 * time.Hour); !day.After(f.Until); day = day.AddDate(0, 0, 1) {
+		if err := h.queryDay(h.path(day), f, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h fileStatusHistory) queryDay(path string, f StatusHistoryFilter, fn func(StatusSample) error) error {
+	var (
+		keys    []StatusSeriesKey
+		matched []bool
+		fnErr   error
+	)
+	err := scanStatusFile(path, func(line string) {
+		if fnErr != nil {
+			return
+		}
+		if id, k, ok := parseStatusSeries(line); ok {
+			for len(keys) <= id {
+				keys = append(keys, StatusSeriesKey{})
+				matched = append(matched, false)
+			}
+			keys[id], matched[id] = k, f.matches(k)
+			return
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 || fields[0] != "T" {
+			return
+		}
+		sec, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return
+		}
+		at := time.Unix(sec, 0).UTC()
+		if at.Before(f.Since) || at.After(f.Until) {
+			return
+		}
+		for id, c := range []byte(fields[2]) {
+			if id >= len(keys) || !matched[id] {
+				continue
+			}
+			up, stale, ok := parseStatusChar(c)
+			if !ok {
+				continue
+			}
+			if fnErr = fn(StatusSample{StatusSeriesKey: keys[id], At: at, Up: up, Stale: stale}); fnErr != nil {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+func (h fileStatusHistory) prune(before time.Time) error {
+	entries, err := os.ReadDir(h.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", h.dir, err)
+	}
+	cutoff := before.UTC().Format("2006-01-02")
+	for _, e := range entries {
+		day, ok := strings.CutSuffix(e.Name(), statusHistoryFileExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", day); err != nil || day >= cutoff {
+			continue
+		}
+		if err := os.Remove(filepath.Join(h.dir, e.Name())); err != nil {
+			return fmt.Errorf("remove %s: %w", e.Name(), err)
+		}
+		log.Log(log.Info, "[data] status history retention: removed %s", e.Name())
+	}
+	return nil
+}
+
+// scanStatusFile calls fn for each line of the file at path; a missing file
+// has no lines.
+func scanStatusFile(path string, fn func(line string)) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		fn(sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	return nil
+}
+
+func parseStatusSeries(line string) (int, StatusSeriesKey, bool) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 8 || fields[0] != "S" {
+		return 0, StatusSeriesKey{}, false
+	}
+	id, err := strconv.Atoi(fields[1])
+	if err != nil || id < 0 {
+		return 0, StatusSeriesKey{}, false
+	}
+	return id, StatusSeriesKey{
+		MemberName: fields[2],
+		CheckType:  fields[3],
+		CheckName:  fields[4],
+		Domain:     fields[5],
+		Endpoint:   fields[6],
+		IsIPv6:     fields[7] == "1",
+	}, true
+}
+
+func statusChar(up, stale bool) byte {
+	switch {
+	case up && stale:
+		return 'u'
+	case stale:
+		return 'd'
+	case up:
+		return '1'
+	}
+	return '0'
+}
+
+func parseStatusChar(c byte) (up, stale, ok bool) {
+	switch c {
+	case '1':
+		return true, false, true
+	case '0':
+		return false, false, true
+	case 'u':
+		return true, true, true
+	case 'd':
+		return false, true, true
+	}
+	return false, false, false
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func TestStatusHistoryFileStoreRoundTrip(t *testing.T) {
+	restoreOfficialResults(t)
+	st := fileStatusHistory{dir: t.TempDir()}
+	day := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	down := memberResult("bob")
+	down.Status = false
+	SetOfficialSiteResults([]SiteResult{
+		{Check: cfg.Check{Name: "ping"}, Results: []Result{memberResult("alice"), down}},
+	})
+	SetOfficialDomainResults(nil)
+	SetOfficialEndpointResults(nil)
+	for _, at := range []time.Time{day.Add(10 * time.Minute), day.Add(15 * time.Minute)} {
+		if n, err := recordStatusSample(st, at); err != nil || n != 2 {
+			t.Fatalf("record at %s: n=%d err=%v", at, n, err)
+		}
+	}
+
+	// A series first seen later in the day gets its own column.
+	SetOfficialDomainResults([]DomainResult{
+		{Check: cfg.Check{Name: "dns"}, Domain: "rpc.example", Results: []Result{down}},
+	})
+	if n, err := recordStatusSample(st, day.Add(70*time.Minute)); err != nil || n != 3 {
+		t.Fatalf("record: n=%d err=%v", n, err)
+	}
+
+	series, err := queryStatusHistory(st, StatusHistoryFilter{Since: day, Until: day.Add(2 * time.Hour)})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(series) != 3 {
+		t.Fatalf("expected 3 series, got %+v", series)
+	}
+	alice, bobDNS, bobPing := series[0], series[1], series[2]
+	if alice.MemberName != "alice" || len(alice.Points) != 3 || !alice.Points[0].Up {
+		t.Fatalf("unexpected alice series %+v", alice)
+	}
+	if bobDNS.CheckType != "domain" || bobDNS.Domain != "rpc.example" || len(bobDNS.Points) != 1 || bobDNS.Points[0].Up {
+		t.Fatalf("unexpected bob dns series %+v", bobDNS)
+	}
+	if bobPing.CheckName != "ping" || len(bobPing.Points) != 3 {
+		t.Fatalf("unexpected bob ping series %+v", bobPing)
+	}
+
+	only, err := queryStatusHistory(st, StatusHistoryFilter{
+		MemberName: "BOB", CheckType: "site", Since: day.Add(12 * time.Minute), Until: day.Add(2 * time.Hour),
+	})
+	if err != nil || len(only) != 1 || len(only[0].Points) != 2 {
+		t.Fatalf("expected bob's two later ping samples, got %+v (%v)", only, err)
+	}
+
+	av := availability(series[:1], time.Hour)
+	if len(av[0].Buckets) != 2 || av[0].Buckets[0].Samples != 2 || av[0].Buckets[0].Availability != 1 {
+		t.Fatalf("unexpected availability %+v", av)
+	}
+}
+
+func TestStatusHistoryFileStoreSkipsTornLineAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+	st := fileStatusHistory{dir: dir}
+	old := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := old.AddDate(0, 0, 10)
+	key := StatusSeriesKey{MemberName: "alice", CheckType: "site", CheckName: "ping"}
+
+	if err := st.write([]StatusSample{{StatusSeriesKey: key, At: old, Up: true}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	f, err := os.OpenFile(st.path(now), os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("S\t0\talice\tsite\tping\t\t\t0\nT\t17")
+	f.Close()
+	if err := st.write([]StatusSample{{StatusSeriesKey: key, At: now, Stale: true}}); err != nil {
+		t.Fatalf("write after torn line: %v", err)
+	}
+
+	series, err := queryStatusHistory(st, StatusHistoryFilter{Since: now.Add(-time.Hour), Until: now})
+	if err != nil || len(series) != 1 || len(series[0].Points) != 1 {
+		t.Fatalf("expected the sample after the torn line, got %+v (%v)", series, err)
+	}
+	if p := series[0].Points[0]; p.Up || !p.Stale {
+		t.Fatalf("unexpected point %+v", p)
+	}
+
+	if err := st.prune(now.AddDate(0, 0, -5)); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2025-03-01.hist")); !os.IsNotExist(err) {
+		t.Fatalf("expected the old day to be removed, got %v", err)
+	}
+	if _, err := os.Stat(st.path(now)); err != nil {
+		t.Fatalf("expected the recent day to be kept: %v", err)
+	}
+}
@@ -27,7 +27,9 @@ type Result struct {
 	Checktime time.Time
 	ErrorText string
 	Data      map[string]interface{}
+	Latency   time.Duration // response time, from Data[LatencyDataKey]; zero when not measured
 	IsIPv6    bool
+	Stale     bool // set by the stale-result reaper; cleared on the next update
 }
 
 type SiteResult struct {
@@ -95,6 +97,7 @@ type BCache struct {
 }
 
 type EventRecord struct {
+	ID         int64                  `json:"ID,omitempty"`
 	CheckType  string                 `json:"CheckType"`
 	CheckName  string                 `json:"CheckName"`
 	MemberName string                 `json:"MemberName"`
@@ -104,6 +107,7 @@ type EventRecord struct {
 	ErrorText  string                 `json:"ErrorText"`
 	Data       map[string]interface{} `json:"Data"`
 	IsIPv6     bool                   `json:"IsIPv6"`
+	Votes      map[string]bool        `json:"Votes,omitempty"` // consensus votes, monitor node ID → agreed
 
 	StartTime time.Time `json:"StartTime"`
 	EndTime   time.Time `json:"EndTime"`
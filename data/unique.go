@@ -0,0 +1,212 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	"github.com/ibp-network/ibp-geodns-libs/internal/hll"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+)
+
+// -----------------------------------------------------------------------------
+// UNIQUE CLIENTS
+// -----------------------------------------------------------------------------
+//
+// RecordDnsHit also adds the client to two HyperLogLog sketches per day,
+// domain and member: one of client IPs and one of client prefixes (/24 for
+// IPv4, /48 for IPv6). Each flush merges the in-memory sketches into this
+// node's row in unique_clients. Sketches merge losslessly, so the collator
+// combines the rows of all DNS nodes into one estimate.
+
+// UniqueClientSketch is the encoded sketch pair of one node, day, domain
+// and member.
+type UniqueClientSketch struct {
+	Date         string
+	NodeID       string
+	Domain       string
+	MemberName   string
+	IPSketch     []byte
+	PrefixSketch []byte
+}
+
+// UniqueClients is an estimated number of distinct clients.
+type UniqueClients struct {
+	IPs      uint64 `json:"uniqueIPs"`
+	Prefixes uint64 `json:"uniquePrefixes"`
+}
+
+type uniqueKey struct {
+	Date       string
+	Domain     string
+	MemberName string
+}
+
+type uniqueSketches struct {
+	ips      *hll.Sketch
+	prefixes *hll.Sketch
+}
+
+var uniqueMem = struct {
+	mu   sync.Mutex
+	data map[uniqueKey]*uniqueSketches
+}{data: make(map[uniqueKey]*uniqueSketches)}
+
+// ClientPrefix returns the network of ip aggregated to
+// System.Usage.ClientPrefixV4 and ClientPrefixV6 bits (default /24 and /48),
+// or "" when ip does not parse.
+func ClientPrefix(ip string) string {
+	return max.GetClientPrefix(ip, int(clientPrefixV4.Load()), int(clientPrefixV6.Load()))
+}
+
+func recordUniqueClient(date, domain, member, clientIP string) {
+	prefix := ClientPrefix(clientIP)
+	k := uniqueKey{Date: date, Domain: domain, MemberName: member}
+
+	uniqueMem.mu.Lock()
+	defer uniqueMem.mu.Unlock()
+	s, ok := uniqueMem.data[k]
+	if !ok {
+		s = &uniqueSketches{ips: hll.New(), prefixes: hll.New()}
+		uniqueMem.data[k] = s
+	}
+	s.ips.AddString(clientIP)
+	if prefix != "" {
+		s.prefixes.AddString(prefix)
+	}
+}
+
+// flushUniqueClients merges the in-memory sketches into the stored rows.
+// Sketches of days before today are dropped once written.
+func flushUniqueClients(today string) {
+	uniqueMem.mu.Lock()
+	snapshot := make(map[uniqueKey]*uniqueSketches, len(uniqueMem.data))
+	for k, s := range uniqueMem.data {
+		snapshot[k] = &uniqueSketches{ips: s.ips.Clone(), prefixes: s.prefixes.Clone()}
+	}
+	uniqueMem.mu.Unlock()
+
+	nodeID := usageNodeID()
+	written := 0
+	for k, s := range snapshot {
+		if err := mergeUniqueClientRow(nodeID, k, s); err != nil {
+			log.Log(log.Error, "[flushUniqueClients] domain=%s member=%s date=%s: %v",
+				k.Domain, k.MemberName, k.Date, err)
+			continue
+		}
+		written++
+		if k.Date != today {
+			uniqueMem.mu.Lock()
+			delete(uniqueMem.data, k)
+			uniqueMem.mu.Unlock()
+		}
+	}
+	log.Log(log.Debug, "[flushUniqueClients] wrote %d of %d sketches", written, len(snapshot))
+}
+
+func mergeUniqueClientRow(nodeID string, k uniqueKey, s *uniqueSketches) error {
+	var ipBlob, prefixBlob []byte
+	err := mysql.DB.QueryRow(`SELECT ip_sketch, prefix_sketch FROM unique_clients
+		WHERE date = ? AND node_id = ? AND domain_name = ? AND member_name = ?`,
+		k.Date, nodeID, k.Domain, k.MemberName).Scan(&ipBlob, &prefixBlob)
+	switch {
+	case err == nil:
+		if stored, derr := hll.Decode(ipBlob); derr == nil {
+			s.ips.Merge(stored)
+		}
+		if stored, derr := hll.Decode(prefixBlob); derr == nil {
+			s.prefixes.Merge(stored)
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("read unique clients: %w", err)
+	}
+
+	ipBlob, _ = s.ips.MarshalBinary()
+	prefixBlob, _ = s.prefixes.MarshalBinary()
+	_, err = mysql.DB.Exec(`INSERT INTO unique_clients
+		(date, node_id, domain_name, member_name, ip_sketch, prefix_sketch)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+		  ip_sketch = VALUES(ip_sketch), prefix_sketch = VALUES(prefix_sketch)`,
+		k.Date, nodeID, k.Domain, k.MemberName, ipBlob, prefixBlob)
+	if err != nil {
+		return fmt.Errorf("upsert unique clients: %w", err)
+	}
+	return nil
+}
+
+// GetUniqueClientSketches returns this node's stored sketches for the days
+// of [start, end], optionally limited to one domain and member.
+func GetUniqueClientSketches(domain, member string, start, end time.Time) ([]UniqueClientSketch, error) {
+	if err := checkRange("GetUniqueClientSketches", start, end); err != nil {
+		return nil, err
+	}
+	q := `SELECT date, node_id, domain_name, member_name, ip_sketch, prefix_sketch
+		FROM unique_clients
+		WHERE date BETWEEN ? AND ?`
+	args := []interface{}{start.Format("2006-01-02"), end.Format("2006-01-02")}
+	if domain != "" {
+		q += ` AND domain_name = ?`
+		args = append(args, domain)
+	}
+	if member != "" {
+		q += ` AND member_name = ?`
+		args = append(args, member)
+	}
+	rows, err := mysql.DB.Query(q+` ORDER BY date`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("GetUniqueClientSketches query error: %w", err)
+	}
+	defer rows.Close()
+
+	var out []UniqueClientSketch
+	for rows.Next() {
+		var s UniqueClientSketch
+		if err := rows.Scan(&s.Date, &s.NodeID, &s.Domain, &s.MemberName, &s.IPSketch, &s.PrefixSketch); err != nil {
+			return nil, fmt.Errorf("GetUniqueClientSketches scan error: %w", err)
+		}
+		if len(s.Date) > len("2006-01-02") {
+			s.Date = s.Date[:len("2006-01-02")]
+		}
+		out = append(out, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetUniqueClientSketches iterate error: %w", err)
+	}
+	return out, nil
+}
+
+// GetUniqueClients estimates the distinct clients this node served for
+// domain and member (either empty for all) over the days of [start, end].
+func GetUniqueClients(domain, member string, start, end time.Time) (UniqueClients, error) {
+	sketches, err := GetUniqueClientSketches(domain, member, start, end)
+	if err != nil {
+		return UniqueClients{}, err
+	}
+	ips, prefixes := hll.New(), hll.New()
+	for _, s := range sketches {
+		if err := mergeSketchPair(ips, prefixes, s.IPSketch, s.PrefixSketch); err != nil {
+			return UniqueClients{}, fmt.Errorf("sketch of %s %s/%s: %w", s.Date, s.Domain, s.MemberName, err)
+		}
+	}
+	return UniqueClients{IPs: ips.Estimate(), Prefixes: prefixes.Estimate()}, nil
+}
+
+// mergeSketchPair decodes an encoded sketch pair into ips and prefixes.
+func mergeSketchPair(ips, prefixes *hll.Sketch, ipSketch, prefixSketch []byte) error {
+	ip, err := hll.Decode(ipSketch)
+	if err != nil {
+		return err
+	}
+	prefix, err := hll.Decode(prefixSketch)
+	if err != nil {
+		return err
+	}
+	ips.Merge(ip)
+	prefixes.Merge(prefix)
+	return nil
+}
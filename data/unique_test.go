@@ -0,0 +1,66 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestClientPrefix(t *testing.T) {
+	cases := map[string]string{
+		"192.0.2.77":        "192.0.2.0/24",
+		"::ffff:192.0.2.77": "192.0.2.0/24",
+		"2001:db8:1:2::1":   "2001:db8:1::/48",
+		"not-an-ip":         "",
+		"192.0.2.77:53":     "",
+	}
+	for in, want := range cases {
+		if got := ClientPrefix(in); got != want {
+			t.Fatalf("ClientPrefix(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestClientPrefixUsesConfiguredLengths(t *testing.T) {
+	clientPrefixV4.Store(16)
+	clientPrefixV6.Store(56)
+	defer clientPrefixV4.Store(0)
+	defer clientPrefixV6.Store(0)
+
+	if got := ClientPrefix("192.0.2.77"); got != "192.0.0.0/16" {
+		t.Fatalf("expected /16, got %q", got)
+	}
+	if got := ClientPrefix("2001:db8:1:2ff::1"); got != "2001:db8:1:200::/56" {
+		t.Fatalf("expected /56, got %q", got)
+	}
+}
+
+func TestRecordUniqueClientCountsIPsAndPrefixes(t *testing.T) {
+	uniqueMem.mu.Lock()
+	saved := uniqueMem.data
+	uniqueMem.data = make(map[uniqueKey]*uniqueSketches)
+	uniqueMem.mu.Unlock()
+	defer func() {
+		uniqueMem.mu.Lock()
+		uniqueMem.data = saved
+		uniqueMem.mu.Unlock()
+	}()
+
+	for i := 0; i < 200; i++ {
+		// 200 addresses spread over two /24 networks.
+		recordUniqueClient("2025-01-01", "rpc.example", "m", fmt.Sprintf("198.51.%d.%d", i%2, i))
+	}
+	recordUniqueClient("2025-01-01", "rpc.example", "m", "198.51.0.0")
+
+	uniqueMem.mu.Lock()
+	s := uniqueMem.data[uniqueKey{Date: "2025-01-01", Domain: "rpc.example", MemberName: "m"}]
+	uniqueMem.mu.Unlock()
+	if s == nil {
+		t.Fatal("expected sketches for the day, domain and member")
+	}
+	if got := s.prefixes.Estimate(); got != 2 {
+		t.Fatalf("expected 2 prefixes, got %d", got)
+	}
+	if got := s.ips.Estimate(); got < 190 || got > 210 {
+		t.Fatalf("expected about 200 IPs, got %d", got)
+	}
+}
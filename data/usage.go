@@ -3,15 +3,21 @@ package data
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	"github.com/ibp-network/ibp-geodns-libs/internal/requestschema"
+	"github.com/ibp-network/ibp-geodns-libs/internal/stmtcache"
 )
 
 type UsageRecord struct {
 	Date        string
+	Hourly      bool // Hour is set; otherwise the record counts the whole day
+	Hour        int  // hour of day, 0-23 UTC
 	NodeID      string
 	Domain      string
+	Service     string // Services key of Domain, resolved at flush time
 	MemberName  string
 	CountryCode string
 	Asn         string
@@ -21,6 +27,10 @@ type UsageRecord struct {
 	IsIPv6      bool
 }
 
+// UpsertUsageRecord adds rec.Hits to the stored counter.
+//
+// Deprecated: use store.Default().Usage.Add, which takes the time-dated
+// UsageRecord shared with data2.
 func UpsertUsageRecord(rec UsageRecord) error {
 	ipFlag := "0"
 	if rec.IsIPv6 {
@@ -29,16 +39,20 @@ func UpsertUsageRecord(rec UsageRecord) error {
 
 	q := `
 INSERT INTO requests
-(date, node_id, domain_name, member_name, country_code, network_asn, network_name, country_name, is_ipv6, hits)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+(date, hour, node_id, domain_name, service_name, member_name, country_code, network_asn, network_name, country_name, is_ipv6, hits)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 ON DUPLICATE KEY UPDATE
-  hits = hits + VALUES(hits)
+  hits = hits + VALUES(hits),
+  service_name = VALUES(service_name)
 `
-	_, err := mysql.DB.Exec(
+	_, err := stmtcache.Exec(
+		mysql.DB,
 		q,
 		rec.Date,
+		requestschema.HourValue(rec.Hourly, rec.Hour),
 		usageKeyValue(rec.NodeID),
 		usageKeyValue(rec.Domain),
+		rec.Service,
 		usageKeyValue(rec.MemberName),
 		usageKeyValue(rec.CountryCode),
 		usageKeyValue(rec.Asn),
@@ -53,149 +67,124 @@ ON DUPLICATE KEY UPDATE
 	return nil
 }
 
-func GetUsageByDomain(domain string, start, end time.Time) ([]UsageRecord, error) {
-	startDate := start.Format("2006-01-02")
-	endDate := end.Format("2006-01-02")
-
-	q := `
+// usageSelect reads the requests rows matching where, one row per date, hour
+// and usage key.
+const usageSelect = `
 SELECT
   date,
+  hour,
   domain_name,
+  MAX(service_name) AS service_name,
   IFNULL(member_name,'') AS member_name,
   IFNULL(country_code,'') AS country_code,
-  IFNULL(network_asn,'') as network_asn,
-  IFNULL(network_name,'') as network_name,
-  IFNULL(country_name,'') as country_name,
+  IFNULL(network_asn,'') AS network_asn,
+  IFNULL(network_name,'') AS network_name,
+  IFNULL(country_name,'') AS country_name,
   is_ipv6,
   SUM(hits) AS hits
 FROM requests
-WHERE domain_name = ?
-  AND date BETWEEN ? AND ?
-GROUP BY date, domain_name, member_name, country_code, network_asn, network_name, country_name, is_ipv6
-ORDER BY date
+WHERE %s
+GROUP BY date, hour, domain_name, member_name, country_code, network_asn, network_name, country_name, is_ipv6
+ORDER BY date, hour
 `
-	rows, err := mysql.DB.Query(q, domain, startDate, endDate)
-	if err != nil {
-		return nil, fmt.Errorf("GetUsageByDomain query error: %w", err)
-	}
-	defer rows.Close()
 
-	var results []UsageRecord
-	for rows.Next() {
-		var r UsageRecord
-		var mName, cCode, a, netName, cName sql.NullString
-		var dateStr, dom, ipv6Str string
-		var hits int
+// UsageFilter selects the requests rows ForEachUsageRow reads. Start and
+// End bound the date and are required; empty fields match everything.
+type UsageFilter struct {
+	Domain  string
+	Member  string
+	Service string
+	Country string // ISO code, matched case-insensitively
+	Start   time.Time
+	End     time.Time
+}
 
-		if err := rows.Scan(&dateStr, &dom, &mName, &cCode, &a, &netName, &cName, &ipv6Str, &hits); err != nil {
-			return nil, fmt.Errorf("GetUsageByDomain scan error: %w", err)
+// where returns the condition and arguments of f. Every filter takes one of
+// a bounded set of shapes.
+func (f UsageFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	for _, c := range []struct{ col, val string }{
+		{"domain_name", f.Domain},
+		{"member_name", f.Member},
+		{"service_name", f.Service},
+		{"country_code", strings.ToUpper(f.Country)},
+	} {
+		if c.val != "" {
+			conds = append(conds, c.col+" = ?")
+			args = append(args, c.val)
 		}
-		r.Date = dateStr
-		r.Domain = dom
-		r.MemberName = mName.String
-		r.CountryCode = cCode.String
-		r.Asn = a.String
-		r.NetworkName = netName.String
-		r.CountryName = cName.String
-		r.Hits = hits
-		r.IsIPv6 = ipv6Str == "1"
-
-		results = append(results, r)
 	}
-	return results, nil
+	conds = append(conds, "date BETWEEN ? AND ?")
+	args = append(args, f.Start.Format("2006-01-02"), f.End.Format("2006-01-02"))
+	return strings.Join(conds, " AND "), args
+}
+
+func GetUsageByDomain(domain string, start, end time.Time) ([]UsageRecord, error) {
+	return queryUsageRecords("GetUsageByDomain", UsageFilter{Domain: domain, Start: start, End: end})
 }
 
 func GetUsageByMember(domain, member string, start, end time.Time) ([]UsageRecord, error) {
-	startDate := start.Format("2006-01-02")
-	endDate := end.Format("2006-01-02")
+	return queryUsageRecords("GetUsageByMember", UsageFilter{Domain: domain, Member: member, Start: start, End: end})
+}
 
-	q := `
-SELECT
-  date,
-  domain_name,
-  IFNULL(member_name,'') AS member_name,
-  IFNULL(country_code,'') as country_code,
-  IFNULL(network_asn,'') as network_asn,
-  IFNULL(network_name,'') as network_name,
-  IFNULL(country_name,'') as country_name,
-  is_ipv6,
-  SUM(hits) AS hits
-FROM requests
-WHERE domain_name = ?
-  AND member_name = ?
-  AND date BETWEEN ? AND ?
-GROUP BY date, domain_name, member_name, country_code, network_asn, network_name, country_name, is_ipv6
-ORDER BY date
-`
-	rows, err := mysql.DB.Query(q, domain, member, startDate, endDate)
-	if err != nil {
-		return nil, fmt.Errorf("GetUsageByMember query error: %w", err)
-	}
-	defer rows.Close()
+// GetUsageByCountry returns the usage of every domain between start and end.
+// Large ranges are better read row by row with ForEachUsageRow.
+func GetUsageByCountry(start, end time.Time) ([]UsageRecord, error) {
+	return queryUsageRecords("GetUsageByCountry", UsageFilter{Start: start, End: end})
+}
 
-	var results []UsageRecord
-	for rows.Next() {
-		var r UsageRecord
-		var mName, cCode, a, netName, cName sql.NullString
-		var dateStr, dom, ipv6Str string
-		var hits int
+// GetUsageByService returns the usage of every domain of service, the
+// Services key resolved when the usage was flushed.
+func GetUsageByService(service string, start, end time.Time) ([]UsageRecord, error) {
+	return queryUsageRecords("GetUsageByService", UsageFilter{Service: service, Start: start, End: end})
+}
 
-		if err := rows.Scan(&dateStr, &dom, &mName, &cCode, &a, &netName, &cName, &ipv6Str, &hits); err != nil {
-			return nil, fmt.Errorf("GetUsageByMember scan error: %w", err)
-		}
-		r.Date = dateStr
-		r.Domain = dom
-		r.MemberName = mName.String
-		r.CountryCode = cCode.String
-		r.Asn = a.String
-		r.NetworkName = netName.String
-		r.CountryName = cName.String
-		r.Hits = hits
-		r.IsIPv6 = ipv6Str == "1"
+// ForEachUsageRow calls fn for each usage row matching f, in date and hour
+// order, as the rows are read from MySQL, so a caller can process any range
+// in constant memory. An error from fn stops the scan and is returned as is.
+func ForEachUsageRow(f UsageFilter, fn func(UsageRecord) error) error {
+	return forEachUsageRow("ForEachUsageRow", f, fn)
+}
 
+func queryUsageRecords(name string, f UsageFilter) ([]UsageRecord, error) {
+	var results []UsageRecord
+	err := forEachUsageRow(name, f, func(r UsageRecord) error {
 		results = append(results, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return results, nil
 }
 
-func GetUsageByCountry(start, end time.Time) ([]UsageRecord, error) {
-	startDate := start.Format("2006-01-02")
-	endDate := end.Format("2006-01-02")
-
-	q := `
-SELECT
-  date,
-  domain_name,
-  IFNULL(member_name,'') AS member_name,
-  IFNULL(country_code,'') as country_code,
-  IFNULL(network_asn,'') as network_asn,
-  IFNULL(network_name,'') as network_name,
-  IFNULL(country_name,'') as country_name,
-  is_ipv6,
-  SUM(hits) AS hits
-FROM requests
-WHERE date BETWEEN ? AND ?
-GROUP BY date, domain_name, member_name, country_code, network_asn, network_name, country_name, is_ipv6
-ORDER BY date
-`
-	rows, err := mysql.DB.Query(q, startDate, endDate)
+func forEachUsageRow(name string, f UsageFilter, fn func(UsageRecord) error) error {
+	if err := checkRange(name, f.Start, f.End); err != nil {
+		return err
+	}
+	where, args := f.where()
+	rows, err := mysql.DB.Query(fmt.Sprintf(usageSelect, where), args...)
 	if err != nil {
-		return nil, fmt.Errorf("GetUsageByCountry query error: %w", err)
+		return fmt.Errorf("%s query error: %w", name, err)
 	}
 	defer rows.Close()
 
-	var results []UsageRecord
 	for rows.Next() {
 		var r UsageRecord
 		var mName, cCode, a, netName, cName sql.NullString
-		var dateStr, dom, ipv6Str string
-		var hits int
+		var dateStr, dom, svc, ipv6Str string
+		var hour, hits int
 
-		if err := rows.Scan(&dateStr, &dom, &mName, &cCode, &a, &netName, &cName, &ipv6Str, &hits); err != nil {
-			return nil, fmt.Errorf("GetUsageByCountry scan error: %w", err)
+		if err := rows.Scan(&dateStr, &hour, &dom, &svc, &mName, &cCode, &a, &netName, &cName, &ipv6Str, &hits); err != nil {
+			return fmt.Errorf("%s scan error: %w", name, err)
 		}
 		r.Date = dateStr
+		if hour != requestschema.DailyHour {
+			r.Hourly, r.Hour = true, hour
+		}
 		r.Domain = dom
+		r.Service = svc
 		r.MemberName = mName.String
 		r.CountryCode = cCode.String
 		r.Asn = a.String
@@ -204,9 +193,14 @@ ORDER BY date
 		r.Hits = hits
 		r.IsIPv6 = ipv6Str == "1"
 
-		results = append(results, r)
+		if err := fn(r); err != nil {
+			return err
+		}
 	}
-	return results, nil
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%s iterate error: %w", name, err)
+	}
+	return nil
 }
 
 func usageKeyValue(s string) string {
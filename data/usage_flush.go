@@ -0,0 +1,375 @@
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	"github.com/ibp-network/ibp-geodns-libs/internal/dbguard"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// USAGE FLUSH
+// -----------------------------------------------------------------------------
+//
+// FlushUsageToDatabase takes the counted hits out of memory and upserts
+// them, retrying a failed record with exponential backoff. A record that
+// still fails while MySQL answers a ping goes back into memory for the next
+// flush; once MySQL is down, or the shared MySQL circuit breaker is open,
+// the rest of the batch is spilled to a file under WorkDir/tmp/usage-spill
+// instead, so memory stays bounded through an outage. The upsert adds to
+// the stored hits, so it is only retried when MySQL cannot have applied it
+// (dbguard.NotSent). After a connection lost mid-statement MySQL may or may
+// not have committed it; the record is kept or spilled and written again by
+// a later flush, so such hits are counted at least once, rarely twice.
+// Every flush first replays the spill files, oldest first; past
+// maxUsageSpillFiles the oldest are dropped.
+
+const (
+	usageSpillDir      = "usage-spill"
+	maxUsageSpillFiles = 288 // a day of five-minute flushes
+	usageFlushAttempts = 4
+)
+
+var errNoUsageDB = errors.New("usage database not initialised")
+
+var (
+	// usageFlushMu serialises flushes; RecordDnsHit only waits for the
+	// swap of the in-memory counts.
+	usageFlushMu sync.Mutex
+
+	upsertUsage  = UpsertUsageRecord
+	usageBreaker = dbguard.MySQL
+	pingUsageDB  = func() error {
+		if mysql.DB == nil {
+			return errNoUsageDB
+		}
+		return mysql.DB.Ping()
+	}
+	// usageRetryDelay is the wait before retry n (1-based): 1s, 2s, 4s.
+	usageRetryDelay = func(n int) time.Duration { return time.Second << (n - 1) }
+	usageSpillPath  = func() string {
+		return filepath.Join(cfg.GetConfig().Local.System.WorkDir, "tmp", usageSpillDir)
+	}
+)
+
+// UsageFlushStatus reports the usage not yet in the database.
+type UsageFlushStatus struct {
+	Pending      int       `json:"pending"`      // usage keys counted in memory
+	SpillFiles   int       `json:"spillFiles"`   // batches spilled to disk
+	SpillRecords int       `json:"spillRecords"` // usage records in those batches
+	LastFlush    time.Time `json:"lastFlush,omitempty"`
+	LastError    string    `json:"lastError,omitempty"`
+}
+
+var flushStatus struct {
+	sync.Mutex
+	UsageFlushStatus
+}
+
+// UsageFlushStats returns the pending usage gauges.
+func UsageFlushStats() UsageFlushStatus {
+	usageMem.mu.Lock()
+	pending := len(usageMem.data)
+	usageMem.mu.Unlock()
+
+	flushStatus.Lock()
+	defer flushStatus.Unlock()
+	st := flushStatus.UsageFlushStatus
+	st.Pending = pending
+	return st
+}
+
+func FlushUsageToDatabase(triggerDate string) {
+	if !statsEnabled() {
+		return
+	}
+	defer flushUniqueClients(triggerDate)
+
+	usageFlushMu.Lock()
+	defer usageFlushMu.Unlock()
+
+	dbUp := drainUsageSpill()
+
+	usageMem.mu.Lock()
+	batch := usageMem.data
+	usageMem.data = make(map[dailyUsageKey]int)
+	usageMem.mu.Unlock()
+
+	if len(batch) == 0 {
+		log.Log(log.Info,
+			"[FlushUsageToDatabase] No usage to flush (triggerDate=%s)",
+			triggerDate)
+		finishUsageFlush(nil, nil)
+		return
+	}
+
+	log.Log(log.Info,
+		"[FlushUsageToDatabase] Flushing %d usage records (triggerDate=%s)",
+		len(batch), triggerDate)
+
+	var (
+		flushed int
+		lastErr error
+		spill   []UsageRecord
+	)
+	failed := make(map[dailyUsageKey]int)
+	for k, hits := range batch {
+		rec := usageRecordFor(k, hits)
+		if !dbUp {
+			spill = append(spill, rec)
+			continue
+		}
+		if err := upsertUsageWithRetry(rec); err != nil {
+			lastErr = err
+			if downErr := usageDBDown(err); downErr != nil {
+				log.Log(log.Error,
+					"[FlushUsageToDatabase] database unreachable (%v); spilling the rest of the batch", downErr)
+				dbUp = false
+				spill = append(spill, rec)
+				continue
+			}
+			log.Log(log.Error,
+				"[FlushUsageToDatabase] upsert error domain=%s member=%s date=%s: %v",
+				rec.Domain, rec.MemberName, rec.Date, err)
+			failed[k] += hits
+			continue
+		}
+		flushed++
+	}
+
+	if len(spill) > 0 {
+		if err := spillUsage(spill); err != nil {
+			// Nowhere to put them: keep them in memory after all.
+			log.Log(log.Error, "[FlushUsageToDatabase] spilling %d records: %v", len(spill), err)
+			for _, rec := range spill {
+				failed[usageKeyFor(rec)] += rec.Hits
+			}
+		}
+	}
+	finishUsageFlush(failed, lastErr)
+
+	log.Log(log.Info,
+		"[FlushUsageToDatabase] Completed flush: %d records written, %d spilled, %d kept for retry",
+		flushed, len(spill), len(failed))
+}
+
+// finishUsageFlush puts the failed counts back into memory, rewrites the
+// usage journal to match and records the outcome.
+func finishUsageFlush(failed map[dailyUsageKey]int, err error) {
+	journalMu.Lock()
+	usageMem.mu.Lock()
+	for k, n := range failed {
+		usageMem.data[k] += n
+	}
+	compactUsageJournalLocked()
+	usageMem.mu.Unlock()
+	journalMu.Unlock()
+
+	flushStatus.Lock()
+	defer flushStatus.Unlock()
+	flushStatus.LastFlush = time.Now().UTC()
+	flushStatus.LastError = ""
+	if err != nil {
+		flushStatus.LastError = err.Error()
+	}
+}
+
+func usageRecordFor(k dailyUsageKey, hits int) UsageRecord {
+	return UsageRecord{
+		Date:        k.Date,
+		Hourly:      k.Hourly,
+		Hour:        k.Hour,
+		NodeID:      usageNodeID(),
+		Domain:      k.Domain,
+		Service:     ServiceForDomain(k.Domain),
+		MemberName:  k.MemberName,
+		CountryCode: k.CountryCode,
+		Asn:         k.Asn,
+		NetworkName: k.NetworkName,
+		CountryName: k.CountryName,
+		Hits:        hits,
+		IsIPv6:      k.IsIPv6,
+	}
+}
+
+func usageKeyFor(rec UsageRecord) dailyUsageKey {
+	return dailyUsageKey{
+		Date:        rec.Date,
+		Hourly:      rec.Hourly,
+		Hour:        rec.Hour,
+		Domain:      rec.Domain,
+		MemberName:  rec.MemberName,
+		CountryCode: rec.CountryCode,
+		Asn:         rec.Asn,
+		NetworkName: rec.NetworkName,
+		CountryName: rec.CountryName,
+		IsIPv6:      rec.IsIPv6,
+	}
+}
+
+func upsertUsageWithRetry(rec UsageRecord) error {
+	policy := dbguard.Policy{Attempts: usageFlushAttempts, Delay: usageRetryDelay, Retry: dbguard.NotSent}
+	return usageBreaker.Do(policy, func() error { return upsertUsage(rec) })
+}
+
+// usageDBDown returns why the database cannot take writes after err, or
+// nil when it can: the breaker is open or MySQL does not answer a ping.
+func usageDBDown(err error) error {
+	if errors.Is(err, dbguard.ErrOpen) {
+		return err
+	}
+	return pingUsageDB()
+}
+
+// spillUsage writes recs to a new spill file and drops the oldest files
+// past maxUsageSpillFiles.
+func spillUsage(recs []UsageRecord) error {
+	dir := usageSpillPath()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create usage spill dir: %w", err)
+	}
+	path := filepath.Join(dir, time.Now().UTC().Format("20060102T150405.000000000")+".jsonl")
+	if err := writeUsageSpill(path, recs); err != nil {
+		return err
+	}
+	log.Log(log.Warn, "[data] spilled %d usage records to %s", len(recs), path)
+
+	files, err := usageSpillFiles(dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > maxUsageSpillFiles {
+		log.Log(log.Error, "[data] more than %d usage spill files; dropping %s", maxUsageSpillFiles, files[0])
+		_ = os.Remove(files[0])
+		files = files[1:]
+	}
+	countUsageSpill(files)
+	return nil
+}
+
+// drainUsageSpill upserts the spilled batches, oldest first, and reports
+// whether the database took them all. A batch cut short by an outage is
+// rewritten with the records still to go; a record the database refuses is
+// logged and dropped.
+func drainUsageSpill() bool {
+	files, err := usageSpillFiles(usageSpillPath())
+	if err != nil {
+		log.Log(log.Error, "[data] usage spill: %v", err)
+		return true
+	}
+	defer func() {
+		files, _ := usageSpillFiles(usageSpillPath())
+		countUsageSpill(files)
+	}()
+
+	for _, path := range files {
+		recs, err := readUsageSpill(path)
+		if err != nil {
+			log.Log(log.Error, "[data] dropping unreadable usage spill %s: %v", path, err)
+			_ = os.Remove(path)
+			continue
+		}
+		for i, rec := range recs {
+			err := usageBreaker.Do(dbguard.Policy{Attempts: 1}, func() error { return upsertUsage(rec) })
+			if err != nil && !dbguard.IsTransient(err) && !errors.Is(err, dbguard.ErrOpen) {
+				// MySQL answered and refused the row; replaying it again
+				// won't help, and keeping it would stall every later flush.
+				log.Log(log.Error, "[data] usage spill %s: dropping %s/%s on %s: %v",
+					path, rec.MemberName, rec.Domain, rec.Date, err)
+				continue
+			}
+			if err != nil {
+				log.Log(log.Warn, "[data] usage spill %s: %v; %d records left", path, err, len(recs)-i)
+				if err := writeUsageSpill(path, recs[i:]); err != nil {
+					log.Log(log.Error, "[data] rewriting usage spill %s: %v", path, err)
+				}
+				return false
+			}
+		}
+		_ = os.Remove(path)
+		log.Log(log.Info, "[data] replayed %d spilled usage records from %s", len(recs), path)
+	}
+	return true
+}
+
+func usageSpillFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("list usage spill files: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func countUsageSpill(files []string) {
+	recs := 0
+	for _, path := range files {
+		if r, err := readUsageSpill(path); err == nil {
+			recs += len(r)
+		}
+	}
+	flushStatus.Lock()
+	flushStatus.SpillFiles, flushStatus.SpillRecords = len(files), recs
+	flushStatus.Unlock()
+}
+
+// writeUsageSpill replaces path with recs, one JSON record per line.
+func writeUsageSpill(path string, recs []UsageRecord) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".spill.*")
+	if err != nil {
+		return fmt.Errorf("create usage spill: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, rec := range recs {
+		if err = enc.Encode(rec); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write usage spill: %w", err)
+	}
+	return nil
+}
+
+func readUsageSpill(path string) ([]UsageRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var recs []UsageRecord
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var rec UsageRecord
+		if err := dec.Decode(&rec); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
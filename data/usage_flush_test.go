@@ -0,0 +1,204 @@
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/dbguard"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestFlushUsageSpillsWhileDatabaseDownAndReplays(t *testing.T) {
+	SetCacheOptions(false, true)
+	defer SetCacheOptions(false, false)
+
+	prevUpsert, prevPing, prevDelay, prevPath, prevBreaker := upsertUsage, pingUsageDB, usageRetryDelay, usageSpillPath, usageBreaker
+	usageMem.mu.Lock()
+	saved := usageMem.data
+	usageMem.data = make(map[dailyUsageKey]int)
+	usageMem.mu.Unlock()
+	defer func() {
+		upsertUsage, pingUsageDB, usageRetryDelay, usageSpillPath, usageBreaker = prevUpsert, prevPing, prevDelay, prevPath, prevBreaker
+		usageMem.mu.Lock()
+		usageMem.data = saved
+		usageMem.mu.Unlock()
+		countUsageSpill(nil)
+	}()
+
+	dir := t.TempDir()
+	usageSpillPath = func() string { return dir }
+	usageRetryDelay = func(int) time.Duration { return 0 }
+	usageBreaker = dbguard.NewBreaker(5, 0)
+
+	down := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	var attempts int
+	stored := map[string]int{}
+	dbUp := false
+	upsertUsage = func(rec UsageRecord) error {
+		attempts++
+		if !dbUp {
+			return down
+		}
+		stored[rec.MemberName] += rec.Hits
+		return nil
+	}
+	pingUsageDB = func() error {
+		if !dbUp {
+			return down
+		}
+		return nil
+	}
+
+	countUsage("a")
+	countUsage("a")
+	countUsage("b")
+	FlushUsageToDatabase("2025-03-01")
+
+	if attempts != usageFlushAttempts {
+		t.Fatalf("expected %d attempts before spilling, got %d", usageFlushAttempts, attempts)
+	}
+	st := UsageFlushStats()
+	if st.Pending != 0 || st.SpillFiles != 1 || st.SpillRecords != 2 || st.LastError == "" {
+		t.Fatalf("after outage: %+v", st)
+	}
+
+	// The next flush still finds the database down and leaves the spill alone.
+	countUsage("b")
+	FlushUsageToDatabase("2025-03-01")
+	if st := UsageFlushStats(); st.SpillFiles != 2 || st.SpillRecords != 3 {
+		t.Fatalf("second outage flush: %+v", st)
+	}
+
+	dbUp = true
+	FlushUsageToDatabase("2025-03-01")
+	if stored["a"] != 2 || stored["b"] != 2 {
+		t.Fatalf("replayed %v", stored)
+	}
+	if st := UsageFlushStats(); st.Pending != 0 || st.SpillFiles != 0 || st.SpillRecords != 0 || st.LastError != "" {
+		t.Fatalf("after recovery: %+v", st)
+	}
+}
+
+func TestFlushUsageKeepsRejectedRecordsInMemory(t *testing.T) {
+	SetCacheOptions(false, true)
+	defer SetCacheOptions(false, false)
+
+	prevUpsert, prevPing, prevDelay, prevPath, prevBreaker := upsertUsage, pingUsageDB, usageRetryDelay, usageSpillPath, usageBreaker
+	usageMem.mu.Lock()
+	saved := usageMem.data
+	usageMem.data = make(map[dailyUsageKey]int)
+	usageMem.mu.Unlock()
+	defer func() {
+		upsertUsage, pingUsageDB, usageRetryDelay, usageSpillPath, usageBreaker = prevUpsert, prevPing, prevDelay, prevPath, prevBreaker
+		usageMem.mu.Lock()
+		usageMem.data = saved
+		usageMem.mu.Unlock()
+	}()
+
+	dir := t.TempDir()
+	usageSpillPath = func() string { return dir }
+	usageRetryDelay = func(int) time.Duration { return 0 }
+	usageBreaker = dbguard.NewBreaker(5, 0)
+	upsertUsage = func(rec UsageRecord) error {
+		if rec.MemberName == "bad" {
+			return errors.New("data too long")
+		}
+		return nil
+	}
+	pingUsageDB = func() error { return nil }
+
+	countUsage("good")
+	countUsage("bad")
+	FlushUsageToDatabase("2025-03-01")
+
+	st := UsageFlushStats()
+	if st.Pending != 1 || st.SpillFiles != 0 {
+		t.Fatalf("stats %+v", st)
+	}
+	usageMem.mu.Lock()
+	defer usageMem.mu.Unlock()
+	for k, n := range usageMem.data {
+		if k.MemberName != "bad" || n != 1 {
+			t.Fatalf("kept %v=%d", k, n)
+		}
+	}
+}
+
+func TestUpsertUsageRetriesOnlyUnsentStatements(t *testing.T) {
+	prevUpsert, prevDelay, prevBreaker := upsertUsage, usageRetryDelay, usageBreaker
+	defer func() { upsertUsage, usageRetryDelay, usageBreaker = prevUpsert, prevDelay, prevBreaker }()
+	usageRetryDelay = func(int) time.Duration { return 0 }
+	usageBreaker = dbguard.NewBreaker(100, 0)
+
+	for _, c := range []struct {
+		err      error
+		attempts int
+	}{
+		{io.ErrUnexpectedEOF, 1},
+		{&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, 1},
+		{driver.ErrBadConn, usageFlushAttempts},
+		{&mysql.MySQLError{Number: 1213}, usageFlushAttempts},
+	} {
+		attempts := 0
+		upsertUsage = func(UsageRecord) error { attempts++; return c.err }
+		if err := upsertUsageWithRetry(UsageRecord{MemberName: "a", Hits: 1}); !errors.Is(err, c.err) {
+			t.Fatalf("%v: got %v", c.err, err)
+		}
+		if attempts != c.attempts {
+			t.Errorf("%v: %d attempts, want %d", c.err, attempts, c.attempts)
+		}
+	}
+}
+
+func TestDrainUsageSpillSkipsRefusedRecords(t *testing.T) {
+	prevUpsert, prevPath, prevBreaker := upsertUsage, usageSpillPath, usageBreaker
+	defer func() {
+		upsertUsage, usageSpillPath, usageBreaker = prevUpsert, prevPath, prevBreaker
+		countUsageSpill(nil)
+	}()
+
+	dir := t.TempDir()
+	usageSpillPath = func() string { return dir }
+	usageBreaker = dbguard.NewBreaker(5, 0)
+	spilled := []UsageRecord{
+		{Date: "2025-03-01", Domain: "rpc.example", MemberName: "bad", Hits: 1},
+		{Date: "2025-03-01", Domain: "rpc.example", MemberName: "good", Hits: 2},
+	}
+	if err := writeUsageSpill(filepath.Join(dir, "20250301T000000.000000000.jsonl"), spilled); err != nil {
+		t.Fatalf("write spill: %v", err)
+	}
+
+	stored := map[string]int{}
+	upsertUsage = func(rec UsageRecord) error {
+		if rec.MemberName == "bad" {
+			return &mysql.MySQLError{Number: 1406, Message: "Data too long for column 'member_name'"}
+		}
+		stored[rec.MemberName] += rec.Hits
+		return nil
+	}
+
+	if !drainUsageSpill() {
+		t.Fatal("expected a refused record not to count as an outage")
+	}
+	if stored["good"] != 2 {
+		t.Fatalf("expected the records after the refused one to be replayed, got %v", stored)
+	}
+	if files, _ := usageSpillFiles(dir); len(files) != 0 {
+		t.Fatalf("expected the spill file to be removed, got %v", files)
+	}
+}
+
+// countUsage counts a hit for member the way RecordDnsHit does, without the
+// unique client sketches a flush would try to store.
+func countUsage(member string) {
+	usageMem.mu.Lock()
+	defer usageMem.mu.Unlock()
+	usageMem.data[dailyUsageKey{Date: "2025-03-01", Domain: "rpc.example", MemberName: member}]++
+}
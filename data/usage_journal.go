@@ -0,0 +1,190 @@
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// USAGE JOURNAL
+// -----------------------------------------------------------------------------
+//
+// RecordDnsHit counts in memory and FlushUsageToDatabase writes the counts
+// every five minutes, so a crash loses up to five minutes of hits and a
+// restart the day's unflushed ones. Every second the hits counted since
+// the last write are appended to WorkDir/tmp/usage.journal and synced; on
+// start the journal is replayed into memory, and every flush rewrites it
+// with just the counts still unflushed.
+
+const (
+	usageJournalFile     = "usage.journal"
+	usageJournalInterval = time.Second
+)
+
+// journalEntry is one journal line: hits to add to a usage key.
+type journalEntry struct {
+	dailyUsageKey
+	N int `json:"n"`
+}
+
+var (
+	// journalMu serialises journal writes and is taken before usageMem.mu,
+	// so a flush cannot compact the journal between a write taking the
+	// pending hits and appending them.
+	journalMu   sync.Mutex
+	journalFile *os.File
+	journalPath string
+	journalOn   atomic.Bool
+	journalOnce sync.Once
+)
+
+func usageJournalPath() string {
+	return filepath.Join(cfg.GetConfig().Local.System.WorkDir, "tmp", usageJournalFile)
+}
+
+// openUsageJournal replays the journal at path into memory, opens it for
+// appending and starts the periodic writer.
+func openUsageJournal(path string) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create usage journal dir: %w", err)
+	}
+	keys, hits, err := replayUsageJournal(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open usage journal: %w", err)
+	}
+	journalFile, journalPath = f, path
+	journalOn.Store(true)
+	if keys > 0 {
+		log.Log(log.Info, "[data] replayed %d hits of %d usage keys from %s", hits, keys, path)
+	}
+
+	journalOnce.Do(func() {
+		go func() {
+			t := time.NewTicker(usageJournalInterval)
+			defer t.Stop()
+			for range t.C {
+				if err := WriteUsageJournal(); err != nil {
+					log.Log(log.Warn, "[data] usage journal write: %v", err)
+				}
+			}
+		}()
+	})
+	return nil
+}
+
+// replayUsageJournal adds the hits journaled at path to memory. A line cut
+// short by a crash is skipped.
+func replayUsageJournal(path string) (keys, hits int, err error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("open usage journal: %w", err)
+	}
+	defer f.Close()
+
+	usageMem.mu.Lock()
+	defer usageMem.mu.Unlock()
+	seen := make(map[dailyUsageKey]bool)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.N <= 0 {
+			log.Log(log.Warn, "[data] skipping usage journal line %q", sc.Text())
+			continue
+		}
+		usageMem.data[e.dailyUsageKey] += e.N
+		seen[e.dailyUsageKey] = true
+		hits += e.N
+	}
+	if err := sc.Err(); err != nil {
+		return len(seen), hits, fmt.Errorf("read usage journal: %w", err)
+	}
+	return len(seen), hits, nil
+}
+
+// WriteUsageJournal appends the hits counted since the last write to the
+// journal and syncs it. It runs every second; call it once more on
+// shutdown.
+func WriteUsageJournal() error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if journalFile == nil {
+		return nil
+	}
+
+	usageMem.mu.Lock()
+	pending := usageMem.pending
+	usageMem.pending = make(map[dailyUsageKey]int)
+	usageMem.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	return appendJournal(journalFile, pending)
+}
+
+func appendJournal(f *os.File, counts map[dailyUsageKey]int) error {
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for k, n := range counts {
+		if err := enc.Encode(journalEntry{dailyUsageKey: k, N: n}); err != nil {
+			return fmt.Errorf("encode usage journal entry: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write usage journal: %w", err)
+	}
+	return f.Sync()
+}
+
+// compactUsageJournalLocked rewrites the journal with the unflushed counts
+// in memory. Callers hold journalMu and usageMem.mu.
+func compactUsageJournalLocked() {
+	if journalFile == nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(journalPath), usageJournalFile+".*")
+	if err != nil {
+		log.Log(log.Error, "[data] usage journal compaction: %v", err)
+		return
+	}
+	if err := appendJournal(tmp, usageMem.data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		log.Log(log.Error, "[data] usage journal compaction: %v", err)
+		return
+	}
+	_ = tmp.Close()
+	if err := os.Rename(tmp.Name(), journalPath); err != nil {
+		_ = os.Remove(tmp.Name())
+		log.Log(log.Error, "[data] usage journal compaction: %v", err)
+		return
+	}
+	usageMem.pending = make(map[dailyUsageKey]int)
+	_ = journalFile.Close()
+	f, err := os.OpenFile(journalPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		journalFile = nil
+		journalOn.Store(false)
+		log.Log(log.Error, "[data] reopening usage journal: %v; journaling stopped", err)
+		return
+	}
+	journalFile = f
+}
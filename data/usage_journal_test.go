@@ -0,0 +1,80 @@
+package data
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUsageJournalReplaysAndCompacts(t *testing.T) {
+	SetCacheOptions(false, true)
+	defer SetCacheOptions(false, false)
+
+	usageMem.mu.Lock()
+	saved := usageMem.data
+	usageMem.data = make(map[dailyUsageKey]int)
+	usageMem.mu.Unlock()
+	defer func() {
+		journalMu.Lock()
+		if journalFile != nil {
+			_ = journalFile.Close()
+		}
+		journalFile, journalPath = nil, ""
+		journalOn.Store(false)
+		journalMu.Unlock()
+		usageMem.mu.Lock()
+		usageMem.data = saved
+		usageMem.pending = make(map[dailyUsageKey]int)
+		usageMem.mu.Unlock()
+	}()
+
+	path := filepath.Join(t.TempDir(), "tmp", usageJournalFile)
+	if err := openUsageJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	RecordDnsHit(false, "192.0.2.1", "rpc.example", "a")
+	RecordDnsHit(false, "192.0.2.1", "rpc.example", "a")
+	RecordDnsHit(false, "192.0.2.1", "rpc.example", "b")
+	if err := WriteUsageJournal(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart starts from an empty memory and replays the journal.
+	hitsByMember := func() map[string]int {
+		usageMem.mu.Lock()
+		defer usageMem.mu.Unlock()
+		out := make(map[string]int)
+		for k, n := range usageMem.data {
+			out[k.MemberName] += n
+		}
+		return out
+	}
+	usageMem.mu.Lock()
+	usageMem.data = make(map[dailyUsageKey]int)
+	usageMem.mu.Unlock()
+	if _, _, err := replayUsageJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := hitsByMember(); got["a"] != 2 || got["b"] != 1 {
+		t.Fatalf("replayed %v", got)
+	}
+
+	// A flush that stored member a compacts the journal to member b.
+	journalMu.Lock()
+	usageMem.mu.Lock()
+	for k := range usageMem.data {
+		if k.MemberName == "a" {
+			delete(usageMem.data, k)
+		}
+	}
+	compactUsageJournalLocked()
+	usageMem.data = make(map[dailyUsageKey]int)
+	usageMem.mu.Unlock()
+	journalMu.Unlock()
+
+	if _, _, err := replayUsageJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := hitsByMember(); len(got) != 1 || got["b"] != 1 {
+		t.Fatalf("replayed after compaction %v", got)
+	}
+}
@@ -0,0 +1,257 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	"github.com/ibp-network/ibp-geodns-libs/internal/requestschema"
+)
+
+// -----------------------------------------------------------------------------
+// USAGE ROLLUPS
+// -----------------------------------------------------------------------------
+//
+// The GetUsageBy* functions return one row per day and usage key. The
+// helpers below aggregate in SQL instead, so callers get totals without
+// re-aggregating the rows in Go.
+
+const (
+	defaultUsageLimit = 10
+	maxUsageLimit     = 1000
+)
+
+// ErrHourlyUsageUnavailable is returned by HourlyPattern when requests rows
+// carry no hour.
+var ErrHourlyUsageUnavailable = errors.New("requests table has no hourly usage")
+
+// UsageTotal is the number of hits of one usage key. Key is the country
+// code or ASN and Name the country or network name.
+type UsageTotal struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	Hits int64  `json:"hits"`
+}
+
+// MonthlyTotal is the number of hits of one member in one month
+// ("2006-01").
+type MonthlyTotal struct {
+	Month  string `json:"month"`
+	Member string `json:"member"`
+	Hits   int64  `json:"hits"`
+}
+
+// HourlyTotal is the number of hits within one hour of the day (0-23, UTC)
+// summed over a period.
+type HourlyTotal struct {
+	Hour int   `json:"hour"`
+	Hits int64 `json:"hits"`
+}
+
+// TopCountriesByDomain returns the limit countries with the most hits on
+// domain between start and end, busiest first. limit <= 0 selects 10.
+func TopCountriesByDomain(domain string, start, end time.Time, limit int) ([]UsageTotal, error) {
+	if err := checkRange("TopCountriesByDomain", start, end); err != nil {
+		return nil, err
+	}
+	q := `
+SELECT country_code, MAX(country_name), SUM(hits) AS total
+FROM requests
+WHERE domain_name = ?
+  AND date BETWEEN ? AND ?
+  AND country_code <> ''
+GROUP BY country_code
+ORDER BY total DESC, country_code
+LIMIT ?
+`
+	totals, err := queryUsageTotals(q, domain, start.Format("2006-01-02"), end.Format("2006-01-02"), usageLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("TopCountriesByDomain: %w", err)
+	}
+	return totals, nil
+}
+
+// TopASNs returns the limit networks with the most hits between start and
+// end, busiest first, on domain or on every domain when it is empty.
+// limit <= 0 selects 10.
+func TopASNs(domain string, start, end time.Time, limit int) ([]UsageTotal, error) {
+	if err := checkRange("TopASNs", start, end); err != nil {
+		return nil, err
+	}
+	q := `
+SELECT network_asn, MAX(network_name), SUM(hits) AS total
+FROM requests
+WHERE date BETWEEN ? AND ?
+  AND network_asn <> ''
+`
+	args := []interface{}{start.Format("2006-01-02"), end.Format("2006-01-02")}
+	if domain != "" {
+		q += "  AND domain_name = ?\n"
+		args = append(args, domain)
+	}
+	q += `GROUP BY network_asn
+ORDER BY total DESC, network_asn
+LIMIT ?
+`
+	totals, err := queryUsageTotals(q, append(args, usageLimit(limit))...)
+	if err != nil {
+		return nil, fmt.Errorf("TopASNs: %w", err)
+	}
+	return totals, nil
+}
+
+// TopServices returns the limit services with the most hits between start
+// and end, busiest first. Name is the service's configured display name.
+// limit <= 0 selects 10.
+func TopServices(start, end time.Time, limit int) ([]UsageTotal, error) {
+	if err := checkRange("TopServices", start, end); err != nil {
+		return nil, err
+	}
+	q := `
+SELECT service_name, '', SUM(hits) AS total
+FROM requests
+WHERE date BETWEEN ? AND ?
+  AND service_name <> ''
+GROUP BY service_name
+ORDER BY total DESC, service_name
+LIMIT ?
+`
+	totals, err := queryUsageTotals(q, start.Format("2006-01-02"), end.Format("2006-01-02"), usageLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("TopServices: %w", err)
+	}
+	services := cfg.GetConfig().Services
+	for i := range totals {
+		totals[i].Name = services[totals[i].Key].Configuration.DisplayName
+	}
+	return totals, nil
+}
+
+// MonthlyTotalsByMember returns the hits of member per month between start
+// and end, or of every member when it is empty, ordered by month.
+func MonthlyTotalsByMember(member string, start, end time.Time) ([]MonthlyTotal, error) {
+	if err := checkRange("MonthlyTotalsByMember", start, end); err != nil {
+		return nil, err
+	}
+	q := `
+SELECT DATE_FORMAT(date, '%Y-%m') AS month, member_name, SUM(hits)
+FROM requests
+WHERE date BETWEEN ? AND ?
+  AND member_name <> ''
+`
+	args := []interface{}{start.Format("2006-01-02"), end.Format("2006-01-02")}
+	if member != "" {
+		q += "  AND member_name = ?\n"
+		args = append(args, member)
+	}
+	q += `GROUP BY month, member_name
+ORDER BY month, member_name
+`
+	rows, err := mysql.DB.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("MonthlyTotalsByMember query error: %w", err)
+	}
+	defer rows.Close()
+
+	var out []MonthlyTotal
+	for rows.Next() {
+		var t MonthlyTotal
+		if err := rows.Scan(&t.Month, &t.Member, &t.Hits); err != nil {
+			return nil, fmt.Errorf("MonthlyTotalsByMember scan error: %w", err)
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("MonthlyTotalsByMember iterate error: %w", err)
+	}
+	return out, nil
+}
+
+// HourlyPattern returns the hits of domain (every domain when empty) per
+// hour of the day between start and end. Hours without hits are included
+// with zero, so the result always has 24 entries.
+func HourlyPattern(domain string, start, end time.Time) ([]HourlyTotal, error) {
+	if err := checkRange("HourlyPattern", start, end); err != nil {
+		return nil, err
+	}
+	ok, err := requestschema.HasColumn(mysql.DB, "hour")
+	if err != nil {
+		return nil, fmt.Errorf("HourlyPattern: %w", err)
+	}
+	if !ok {
+		return nil, ErrHourlyUsageUnavailable
+	}
+
+	q := `
+SELECT hour, SUM(hits)
+FROM requests
+WHERE date BETWEEN ? AND ?
+  AND hour BETWEEN 0 AND 23
+`
+	args := []interface{}{start.Format("2006-01-02"), end.Format("2006-01-02")}
+	if domain != "" {
+		q += "  AND domain_name = ?\n"
+		args = append(args, domain)
+	}
+	q += "GROUP BY hour\n"
+
+	rows, err := mysql.DB.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("HourlyPattern query error: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]HourlyTotal, 24)
+	for h := range out {
+		out[h].Hour = h
+	}
+	for rows.Next() {
+		var (
+			hour int
+			hits int64
+		)
+		if err := rows.Scan(&hour, &hits); err != nil {
+			return nil, fmt.Errorf("HourlyPattern scan error: %w", err)
+		}
+		if hour >= 0 && hour < 24 {
+			out[hour].Hits = hits
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("HourlyPattern iterate error: %w", err)
+	}
+	return out, nil
+}
+
+func queryUsageTotals(q string, args ...interface{}) ([]UsageTotal, error) {
+	rows, err := mysql.DB.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	var out []UsageTotal
+	for rows.Next() {
+		var t UsageTotal
+		if err := rows.Scan(&t.Key, &t.Name, &t.Hits); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate error: %w", err)
+	}
+	return out, nil
+}
+
+func usageLimit(limit int) int {
+	if limit <= 0 {
+		return defaultUsageLimit
+	}
+	if limit > maxUsageLimit {
+		return maxUsageLimit
+	}
+	return limit
+}
@@ -0,0 +1,12 @@
+package data
+
+import "testing"
+
+func TestUsageLimit(t *testing.T) {
+	cases := map[int]int{-1: defaultUsageLimit, 0: defaultUsageLimit, 5: 5, maxUsageLimit + 1: maxUsageLimit}
+	for in, want := range cases {
+		if got := usageLimit(in); got != want {
+			t.Fatalf("usageLimit(%d): expected %d, got %d", in, want, got)
+		}
+	}
+}
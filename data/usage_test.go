@@ -0,0 +1,39 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUsageFilterWhere(t *testing.T) {
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	where, args := UsageFilter{Start: start, End: end}.where()
+	if where != "date BETWEEN ? AND ?" {
+		t.Fatalf("unexpected where %q", where)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"2025-03-01", "2025-03-31"}) {
+		t.Fatalf("unexpected args %v", args)
+	}
+
+	where, args = UsageFilter{Domain: "rpc.example", Member: "alice", Country: "de", Start: start, End: end}.where()
+	if want := "domain_name = ? AND member_name = ? AND country_code = ? AND date BETWEEN ? AND ?"; where != want {
+		t.Fatalf("expected %q, got %q", want, where)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"rpc.example", "alice", "DE", "2025-03-01", "2025-03-31"}) {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
+
+func TestForEachUsageRowChecksRange(t *testing.T) {
+	start := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	err := ForEachUsageRow(UsageFilter{Start: start, End: start.AddDate(0, 0, -1)}, func(UsageRecord) error {
+		t.Fatal("callback ran for an invalid range")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected a range error")
+	}
+}
@@ -0,0 +1,197 @@
+package data2
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// CONSENSUS DECISIONS
+// -----------------------------------------------------------------------------
+//
+// Collators store a decision record for every finalized proposal, so a
+// disputed outage can be traced back to the votes that caused it: what each
+// monitor saw locally, which monitors were active and counted, the majority
+// required and how long the round took. Records are written once per
+// proposal however often its finalize is delivered.
+
+// decisionTimeSlack absorbs the rounding of member_events times to whole
+// seconds when matching an event to the decision that opened it.
+const decisionTimeSlack = time.Second
+
+// DecisionVote is one monitor's vote. LocalStatus is the monitor's own
+// result for the check, derived from whether it agreed with the proposal.
+type DecisionVote struct {
+	NodeID      string    `json:"nodeID"`
+	Agree       bool      `json:"agree"`
+	LocalStatus bool      `json:"localStatus"`
+	VotedAt     time.Time `json:"votedAt,omitempty"`
+	Counted     bool      `json:"counted"` // cast by an active monitor of the cluster
+}
+
+// Decision is the tally behind a consensus outcome as the finalizer saw it.
+// Forced is set when the outcome lacks the required majority, i.e. the
+// proposal timed out. Regions lists the monitor regions among the agreeing
+// counted votes; RequiredRegions is set when the outcome was held to a
+// region diversity rule.
+type Decision struct {
+	ActiveMonitors  []string       `json:"activeMonitors"`
+	Votes           []DecisionVote `json:"votes"`
+	Yes             int            `json:"yes"`
+	No              int            `json:"no"`
+	Required        int            `json:"required"`
+	Regions         []string       `json:"regions,omitempty"`
+	RequiredRegions int            `json:"requiredRegions,omitempty"`
+	Forced          bool           `json:"forced,omitempty"`
+	ProposedAt      time.Time      `json:"proposedAt"`
+	DecidedAt       time.Time      `json:"decidedAt"`
+}
+
+// DecisionRecord is the stored decision of one proposal.
+type DecisionRecord struct {
+	Proposal        Proposal `json:"proposal"`
+	Passed          bool     `json:"passed"`
+	FinalizerNodeID string   `json:"finalizerNodeID,omitempty"`
+	Decision
+}
+
+// RecordDecision stores r unless its proposal is already stored.
+func RecordDecision(r DecisionRecord) error {
+	r.Proposal.VoteData = nil
+	blob, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshal decision: %w", err)
+	}
+	p := r.Proposal
+	_, err = DB.Exec(`INSERT IGNORE INTO consensus_decisions
+		(proposal_id, check_type, check_name, member_name, domain_name, endpoint,
+		 is_ipv6, proposed_status, passed, shadow, proposed_at, decided_at, decision_data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.CheckType, p.CheckName, p.MemberName, p.DomainName, p.Endpoint,
+		p.IsIPv6, p.ProposedStatus, r.Passed, p.Shadow, r.ProposedAt.UTC(), r.DecidedAt.UTC(), string(blob))
+	if err != nil {
+		return fmt.Errorf("insert decision %s: %w", p.ID, err)
+	}
+	return nil
+}
+
+// GetDecision returns the decision of proposal id, or ErrNotFound.
+func GetDecision(id string) (DecisionRecord, error) {
+	recs, err := queryDecisions(`proposal_id = ?`, id)
+	if err != nil {
+		return DecisionRecord{}, err
+	}
+	if len(recs) == 0 {
+		return DecisionRecord{}, fmt.Errorf("decision of proposal %s: %w", id, ErrNotFound)
+	}
+	return recs[0], nil
+}
+
+// GetEventDecisions returns the decisions behind member event eventID,
+// oldest first: the offline decision that opened it and every decision on
+// the same check until it ended (now for an open event), including the one
+// that closed it and any that failed. An unknown event returns ErrNotFound.
+func GetEventDecisions(eventID int64) ([]DecisionRecord, error) {
+	ev, err := Events().Get(eventID)
+	if err != nil {
+		return nil, err
+	}
+	k := ev.Key.Normalize()
+	where := `check_type = ? AND check_name = ? AND member_name = ? AND domain_name = ?
+		AND endpoint = ? AND is_ipv6 = ? AND shadow = 0`
+	args := []interface{}{k.CheckType, k.CheckName, k.Member, k.Domain, k.Endpoint, k.IsIPv6}
+
+	// The event may start after the decision that opened it: the minimum
+	// offline time delays the insert and the start is moved past the end
+	// of the previous event.
+	from := ev.StartTime.UTC()
+	var opened sql.NullTime
+	err = DB.QueryRow(`SELECT MAX(decided_at) FROM consensus_decisions
+		WHERE `+where+` AND passed = 1 AND proposed_status = 0 AND decided_at <= ?`,
+		append(args, from.Add(decisionTimeSlack))...).Scan(&opened)
+	if err != nil {
+		return nil, fmt.Errorf("find opening decision of event %d: %w", eventID, err)
+	}
+	if opened.Valid {
+		from = opened.Time.UTC()
+	}
+	until := time.Now().UTC()
+	if ev.EndTime.Valid {
+		until = ev.EndTime.Time.UTC().Add(decisionTimeSlack)
+	}
+	return queryDecisions(where+` AND decided_at >= ? AND decided_at <= ?`,
+		append(args, from, until)...)
+}
+
+func queryDecisions(where string, args ...interface{}) ([]DecisionRecord, error) {
+	rows, err := DB.Query(`SELECT decision_data FROM consensus_decisions
+		WHERE `+where+` ORDER BY decided_at`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query decisions: %w", err)
+	}
+	defer rows.Close()
+
+	var out []DecisionRecord
+	for rows.Next() {
+		var blob []byte
+		if err := rows.Scan(&blob); err != nil {
+			return nil, fmt.Errorf("scan decision: %w", err)
+		}
+		var r DecisionRecord
+		if err := json.Unmarshal(blob, &r); err != nil {
+			return nil, fmt.Errorf("decode decision: %w", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate decisions: %w", err)
+	}
+	return out, nil
+}
+
+// DecisionsHandler exposes the decision records for a REST API: GET with
+// event=<member event ID> returns GetEventDecisions, with proposal=<ID> the
+// one record. Authentication is left to the API that mounts the handler.
+func DecisionsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		var (
+			out interface{}
+			err error
+		)
+		switch {
+		case q.Get("event") != "":
+			id, perr := strconv.ParseInt(q.Get("event"), 10, 64)
+			if perr != nil {
+				http.Error(w, "invalid event ID", http.StatusBadRequest)
+				return
+			}
+			out, err = GetEventDecisions(id)
+		case q.Get("proposal") != "":
+			out, err = GetDecision(q.Get("proposal"))
+		default:
+			http.Error(w, "event or proposal required", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	})
+}
@@ -0,0 +1,101 @@
+package data2_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/data2"
+	"github.com/ibp-network/ibp-geodns-libs/testsupport"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var eventColumns = []string{"id", "check_type", "check_name", "member_name", "domain_name", "endpoint",
+	"status", "is_ipv6", "start_time", "end_time", "error", "vote_data", "additional_data"}
+
+func decisionBlob(t *testing.T, id string, status, passed bool, decidedAt time.Time) []byte {
+	t.Helper()
+	blob, err := json.Marshal(data2.DecisionRecord{
+		Proposal: data2.Proposal{ID: id, CheckType: "site", CheckName: "ping", MemberName: "member-1", ProposedStatus: status},
+		Passed:   passed,
+		Decision: data2.Decision{
+			ActiveMonitors: []string{"monitor-1", "monitor-2"},
+			Votes: []data2.DecisionVote{
+				{NodeID: "monitor-1", Agree: true, LocalStatus: status, Counted: true},
+				{NodeID: "monitor-2", Agree: true, LocalStatus: status, Counted: true},
+			},
+			Yes:       2,
+			Required:  2,
+			DecidedAt: decidedAt,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
+
+func TestGetEventDecisionsStartsAtOpeningDecision(t *testing.T) {
+	m := testsupport.NewMockDB(t)
+	testsupport.UseDB(t, m.DB)
+
+	opened := testsupport.Epoch
+	start := opened.Add(time.Hour) // moved past the previous event's end
+	end := opened.Add(3 * time.Hour)
+
+	m.ExpectQuery(`FROM member_events WHERE id = \?`).
+		WithArgs(int64(42)).
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(int64(42), "site", "ping", "member-1", "", "", false, false, start, end, "timeout", nil, nil))
+	m.ExpectQuery(`SELECT MAX\(decided_at\) FROM consensus_decisions .* passed = 1 AND proposed_status = 0 AND decided_at <= \?`).
+		WithArgs("site", "ping", "member-1", "", "", false, start.Add(time.Second)).
+		WillReturnRows(sqlmock.NewRows([]string{"decided_at"}).AddRow(opened))
+	m.ExpectQuery(`SELECT decision_data FROM consensus_decisions .* decided_at >= \? AND decided_at <= \? ORDER BY decided_at`).
+		WithArgs("site", "ping", "member-1", "", "", false, opened, end.Add(time.Second)).
+		WillReturnRows(sqlmock.NewRows([]string{"decision_data"}).
+			AddRow(decisionBlob(t, "p-offline", false, true, opened)).
+			AddRow(decisionBlob(t, "p-online", true, true, end)))
+
+	recs, err := data2.GetEventDecisions(42)
+	if err != nil {
+		t.Fatalf("GetEventDecisions: %v", err)
+	}
+	if len(recs) != 2 || recs[0].Proposal.ID != "p-offline" || recs[1].Proposal.ID != "p-online" {
+		t.Fatalf("unexpected decisions %+v", recs)
+	}
+	if recs[0].Yes != 2 || len(recs[0].Votes) != 2 || recs[0].Votes[0].LocalStatus {
+		t.Fatalf("expected the tally to round-trip, got %+v", recs[0].Decision)
+	}
+}
+
+func TestDecisionsHandler(t *testing.T) {
+	m := testsupport.NewMockDB(t)
+	testsupport.UseDB(t, m.DB)
+	h := data2.DecisionsHandler()
+
+	m.ExpectQuery(`FROM member_events WHERE id = \?`).WithArgs(int64(7)).WillReturnRows(sqlmock.NewRows(eventColumns))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/decisions?event=7", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown event, got %d", rec.Code)
+	}
+
+	m.ExpectQuery(`FROM consensus_decisions WHERE proposal_id = \?`).
+		WithArgs("p-1").
+		WillReturnRows(sqlmock.NewRows([]string{"decision_data"}).AddRow(decisionBlob(t, "p-1", false, true, testsupport.Epoch)))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/decisions?proposal=p-1", nil))
+	var got data2.DecisionRecord
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &got) != nil || got.Proposal.ID != "p-1" {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/decisions?event=abc", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed event ID, got %d", rec.Code)
+	}
+}
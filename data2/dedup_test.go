@@ -0,0 +1,85 @@
+package data2_test
+
+import (
+	"testing"
+
+	"github.com/ibp-network/ibp-geodns-libs/data2"
+	"github.com/ibp-network/ibp-geodns-libs/testsupport"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestInsertNetStatusSkipsProposalStoredByAnotherCollator(t *testing.T) {
+	m := testsupport.NewMockDB(t)
+	testsupport.UseDB(t, m.DB)
+
+	m.ExpectBegin()
+	m.ExpectPrepare(`SELECT id FROM member_events WHERE proposal_id = \? FOR UPDATE`).ExpectQuery().
+		WithArgs("p-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(9)))
+	m.ExpectRollback()
+
+	err := data2.InsertNetStatus(data2.NetStatusRecord{
+		CheckType:  1,
+		CheckName:  "ping",
+		Member:     "member-1",
+		StartTime:  testsupport.Epoch,
+		Error:      "timeout",
+		ProposalID: "p-1",
+	})
+	if err != nil {
+		t.Fatalf("expected a duplicate proposal to be skipped, got %v", err)
+	}
+}
+
+func TestInsertNetStatusStoresProposalID(t *testing.T) {
+	m := testsupport.NewMockDB(t)
+	testsupport.UseDB(t, m.DB)
+
+	m.ExpectBegin()
+	m.ExpectPrepare(`WHERE proposal_id = \?`).ExpectQuery().WithArgs("p-2").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	m.ExpectPrepare(`SELECT id FROM member_events WHERE .* end_time IS NULL`).ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	m.ExpectPrepare(`SELECT MAX\(end_time\)`).ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"end_time"}).AddRow(nil))
+	m.ExpectPrepare(`INSERT INTO member_events .*proposal_id\)`).ExpectExec().
+		WithArgs("site", "ping", "", "", "member-1", false, testsupport.Epoch, "timeout", nil, nil, "p-2").
+		WillReturnResult(sqlmock.NewResult(1, 0))
+	m.ExpectCommit()
+
+	err := data2.InsertNetStatus(data2.NetStatusRecord{
+		CheckType:  1,
+		CheckName:  "ping",
+		Member:     "member-1",
+		StartTime:  testsupport.Epoch,
+		Error:      "timeout",
+		ProposalID: "p-2",
+	})
+	if err != nil {
+		t.Fatalf("InsertNetStatus: %v", err)
+	}
+}
+
+func TestInsertNetStatusSkipsProposalInsertedConcurrently(t *testing.T) {
+	m := testsupport.NewMockDB(t)
+	testsupport.UseDB(t, m.DB)
+
+	m.ExpectBegin()
+	m.ExpectPrepare(`WHERE proposal_id = \?`).ExpectQuery().WithArgs("p-3").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	m.ExpectPrepare(`end_time IS NULL`).ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	m.ExpectPrepare(`SELECT MAX\(end_time\)`).ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"end_time"}).AddRow(nil))
+	m.ExpectPrepare(`INSERT INTO member_events .*\?\)$`).ExpectExec().
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'p-3' for key 'uniq_proposal'"})
+	m.ExpectRollback()
+
+	err := data2.InsertNetStatus(data2.NetStatusRecord{
+		CheckType:  1,
+		CheckName:  "ping",
+		Member:     "member-1",
+		StartTime:  testsupport.Epoch,
+		Error:      "timeout",
+		ProposalID: "p-3",
+	})
+	if err != nil {
+		t.Fatalf("expected a duplicate-key insert to be skipped, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package data2
+
+import (
+	"fmt"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// TYPES
+// -----------------------------------------------------------------------------
+
+// CountryHits is a single row of the per-country usage ranking.
+type CountryHits struct {
+	CountryCode string
+	CountryName string
+	Hits        int64
+}
+
+// DigestSummary aggregates member_events and requests for a reporting window.
+type DigestSummary struct {
+	Start           time.Time
+	End             time.Time
+	NewOutages      int
+	ResolvedOutages int
+	DowntimeMinutes map[string]int64
+	TopCountries    []CountryHits
+}
+
+// -----------------------------------------------------------------------------
+// QUERIES
+// -----------------------------------------------------------------------------
+
+// BuildDigest summarises outages and usage between start and end (UTC).
+// Downtime is clipped to the window so long-running events only count the
+// minutes that fall inside it.
+func BuildDigest(start, end time.Time, topCountries int) (DigestSummary, error) {
+	if DB == nil {
+		return DigestSummary{}, fmt.Errorf("data2 database not initialised")
+	}
+	start, end = start.UTC(), end.UTC()
+
+	sum := DigestSummary{
+		Start:           start,
+		End:             end,
+		DowntimeMinutes: make(map[string]int64),
+	}
+
+	if err := DB.QueryRow(
+		`SELECT COUNT(*) FROM member_events WHERE status=0 AND start_time >= ? AND start_time < ?`,
+		start, end,
+	).Scan(&sum.NewOutages); err != nil {
+		return DigestSummary{}, fmt.Errorf("count new outages: %w", err)
+	}
+
+	if err := DB.QueryRow(
+		`SELECT COUNT(*) FROM member_events WHERE end_time IS NOT NULL AND end_time >= ? AND end_time < ?`,
+		start, end,
+	).Scan(&sum.ResolvedOutages); err != nil {
+		return DigestSummary{}, fmt.Errorf("count resolved outages: %w", err)
+	}
+
+	rows, err := DB.Query(
+		`SELECT member_name,
+		        SUM(TIMESTAMPDIFF(MINUTE,
+		            GREATEST(start_time, ?),
+		            LEAST(COALESCE(end_time, UTC_TIMESTAMP()), ?)))
+		   FROM member_events
+		  WHERE start_time < ? AND (end_time IS NULL OR end_time > ?)
+		  GROUP BY member_name`,
+		start, end, end, start,
+	)
+	if err != nil {
+		return DigestSummary{}, fmt.Errorf("query downtime: %w", err)
+	}
+	for rows.Next() {
+		var member string
+		var minutes int64
+		if err := rows.Scan(&member, &minutes); err != nil {
+			rows.Close()
+			return DigestSummary{}, fmt.Errorf("scan downtime: %w", err)
+		}
+		if minutes > 0 {
+			sum.DowntimeMinutes[member] = minutes
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return DigestSummary{}, fmt.Errorf("iterate downtime: %w", err)
+	}
+	rows.Close()
+
+	if topCountries <= 0 {
+		return sum, nil
+	}
+
+	rows, err = DB.Query(
+		`SELECT country_code, country_name, SUM(hits) AS total
+		   FROM requests
+		  WHERE date >= ? AND date < ?
+		  GROUP BY country_code, country_name
+		  ORDER BY total DESC
+		  LIMIT ?`,
+		start.Format("2006-01-02"), end.Format("2006-01-02"), topCountries,
+	)
+	if err != nil {
+		return DigestSummary{}, fmt.Errorf("query top countries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ch CountryHits
+		if err := rows.Scan(&ch.CountryCode, &ch.CountryName, &ch.Hits); err != nil {
+			return DigestSummary{}, fmt.Errorf("scan top countries: %w", err)
+		}
+		sum.TopCountries = append(sum.TopCountries, ch)
+	}
+	if err := rows.Err(); err != nil {
+		return DigestSummary{}, fmt.Errorf("iterate top countries: %w", err)
+	}
+
+	return sum, nil
+}
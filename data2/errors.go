@@ -0,0 +1,25 @@
+package data2
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
+)
+
+// Sentinel errors shared with nats and data; test for them with errors.Is.
+var (
+	ErrNoActiveNodes    = errdefs.ErrNoActiveNodes
+	ErrTimeout          = errdefs.ErrTimeout
+	ErrNotFound         = errdefs.ErrNotFound
+	ErrInvalidDateRange = errdefs.ErrInvalidDateRange
+)
+
+// checkRange prefixes the ErrInvalidDateRange of a reversed range with the
+// name of the query.
+func checkRange(name string, start, end time.Time) error {
+	if err := errdefs.CheckRange(start, end); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package data2
+
+import "github.com/ibp-network/ibp-geodns-libs/data/eventstore"
+
+// Events returns the member_events repository on DB, for collators, which
+// have no data/mysql connection.
+func Events() *eventstore.Store {
+	return eventstore.New(DB, nil)
+}
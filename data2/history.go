@@ -0,0 +1,237 @@
+package data2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// PROPOSAL HISTORY
+// -----------------------------------------------------------------------------
+//
+// The proposal cache above only lives until a proposal is finalized. The
+// history keeps every proposal the collator saw, with the votes it received
+// and the finalize outcome, so disputed downtime can be audited. It is held
+// in memory and bounded to the most recent proposalHistorySize proposals.
+
+const (
+	proposalHistorySize     = 5000
+	defaultHistoryLimit     = 100
+	maxHistoryLimit         = 1000
+	historyHandlerBodyLimit = 4096
+)
+
+// ProposalHistoryEntry is one proposal with the votes and outcome seen for it.
+type ProposalHistoryEntry struct {
+	Proposal   Proposal        `json:"proposal"`
+	Votes      map[string]bool `json:"votes"`
+	Finalized  bool            `json:"finalized"`
+	Passed     bool            `json:"passed"`
+	DecidedAt  time.Time       `json:"decidedAt,omitempty"`
+	ReceivedAt time.Time       `json:"receivedAt"`
+}
+
+// ProposalFilter selects history entries. Empty fields match everything;
+// string fields compare case-insensitively. Since and Until bound the
+// proposal timestamp.
+type ProposalFilter struct {
+	ProposalID    string    `json:"proposalID,omitempty"`
+	MemberName    string    `json:"memberName,omitempty"`
+	CheckType     string    `json:"checkType,omitempty"`
+	CheckName     string    `json:"checkName,omitempty"`
+	DomainName    string    `json:"domainName,omitempty"`
+	Since         time.Time `json:"since,omitempty"`
+	Until         time.Time `json:"until,omitempty"`
+	FinalizedOnly bool      `json:"finalizedOnly,omitempty"`
+	Limit         int       `json:"limit,omitempty"`
+}
+
+var (
+	historyMu    sync.RWMutex
+	historyByID  = make(map[string]*ProposalHistoryEntry)
+	historyOrder []string // insertion order, oldest first
+)
+
+// historyEntryLocked returns the entry for id, creating it if needed.
+// Callers must hold historyMu for writing.
+func historyEntryLocked(id string) *ProposalHistoryEntry {
+	if e, ok := historyByID[id]; ok {
+		return e
+	}
+	e := &ProposalHistoryEntry{
+		Proposal:   Proposal{ID: id},
+		Votes:      make(map[string]bool),
+		ReceivedAt: time.Now().UTC(),
+	}
+	historyByID[id] = e
+	historyOrder = append(historyOrder, id)
+	for len(historyOrder) > proposalHistorySize {
+		delete(historyByID, historyOrder[0])
+		historyOrder = historyOrder[1:]
+	}
+	return e
+}
+
+func recordHistoryProposal(p Proposal) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	e := historyEntryLocked(p.ID)
+	p.VoteData = nil
+	e.Proposal = p
+}
+
+func recordHistoryVote(id, nodeID string, agree bool) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	historyEntryLocked(id).Votes[nodeID] = agree
+}
+
+// RecordProposalOutcome stores the finalize result of a proposal in the
+// history, whether it passed or not, together with the finalizer's votes.
+func RecordProposalOutcome(p Proposal, passed bool, decidedAt time.Time, votes map[string]bool) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	e := historyEntryLocked(p.ID)
+	if e.Proposal.SenderNodeID == "" && e.Proposal.MemberName == "" {
+		p.VoteData = nil
+		e.Proposal = p
+	}
+	for nodeID, agree := range votes {
+		e.Votes[nodeID] = agree
+	}
+	e.Finalized = true
+	e.Passed = passed
+	e.DecidedAt = decidedAt.UTC()
+}
+
+// GetProposalHistory returns the entries matching f, newest first.
+func GetProposalHistory(f ProposalFilter) []ProposalHistoryEntry {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	historyMu.RLock()
+	out := make([]ProposalHistoryEntry, 0)
+	for _, e := range historyByID {
+		if !f.matches(e) {
+			continue
+		}
+		cp := *e
+		cp.Votes = make(map[string]bool, len(e.Votes))
+		for node, agree := range e.Votes {
+			cp.Votes[node] = agree
+		}
+		out = append(out, cp)
+	}
+	historyMu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].timestamp().After(out[j].timestamp())
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// timestamp is the proposal's own timestamp, or when it was first seen.
+func (e *ProposalHistoryEntry) timestamp() time.Time {
+	if !e.Proposal.Timestamp.IsZero() {
+		return e.Proposal.Timestamp
+	}
+	return e.ReceivedAt
+}
+
+func (f ProposalFilter) matches(e *ProposalHistoryEntry) bool {
+	p := e.Proposal
+	if f.ProposalID != "" && p.ID != f.ProposalID {
+		return false
+	}
+	if !matchFold(f.MemberName, p.MemberName) || !matchFold(f.CheckType, p.CheckType) ||
+		!matchFold(f.CheckName, p.CheckName) || !matchFold(f.DomainName, p.DomainName) {
+		return false
+	}
+	if f.FinalizedOnly && !e.Finalized {
+		return false
+	}
+	ts := e.timestamp()
+	if !f.Since.IsZero() && ts.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && ts.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+func matchFold(want, got string) bool {
+	return want == "" || strings.EqualFold(want, got)
+}
+
+// ProposalHistoryHandler exposes GetProposalHistory for a REST API. GET takes
+// the filter as query parameters (id, member, checkType, checkName, domain,
+// since, until as RFC 3339, finalized=true, limit); POST takes it as a JSON
+// ProposalFilter. Authentication is left to the API that mounts the handler.
+func ProposalHistoryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			f   ProposalFilter
+			err error
+		)
+		switch r.Method {
+		case http.MethodGet:
+			f, err = parseProposalFilter(r)
+		case http.MethodPost:
+			err = json.NewDecoder(http.MaxBytesReader(w, r.Body, historyHandlerBodyLimit)).Decode(&f)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(GetProposalHistory(f))
+	})
+}
+
+func parseProposalFilter(r *http.Request) (ProposalFilter, error) {
+	q := r.URL.Query()
+	f := ProposalFilter{
+		ProposalID:    q.Get("id"),
+		MemberName:    q.Get("member"),
+		CheckType:     q.Get("checkType"),
+		CheckName:     q.Get("checkName"),
+		DomainName:    q.Get("domain"),
+		FinalizedOnly: q.Get("finalized") == "true",
+	}
+	var err error
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, err
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, err
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
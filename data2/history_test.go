@@ -0,0 +1,130 @@
+package data2
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func resetProposalHistory(t *testing.T) {
+	t.Helper()
+	historyMu.Lock()
+	prevByID, prevOrder := historyByID, historyOrder
+	historyByID, historyOrder = make(map[string]*ProposalHistoryEntry), nil
+	historyMu.Unlock()
+
+	previous := snapshotProposalStore()
+	t.Cleanup(func() {
+		restoreProposalStore(previous)
+		historyMu.Lock()
+		historyByID, historyOrder = prevByID, prevOrder
+		historyMu.Unlock()
+	})
+}
+
+func TestProposalHistoryKeepsVotesAndOutcomeAfterPop(t *testing.T) {
+	resetProposalHistory(t)
+
+	ts := time.Date(2026, 4, 20, 10, 0, 0, 0, time.UTC)
+	p := Proposal{ID: "p1", SenderNodeID: "mon-a", CheckType: "site", CheckName: "ping", MemberName: "provider1", Timestamp: ts}
+	CacheProposal(p)
+	RecordProposalVote("p1", "mon-a", true)
+	RecordProposalVote("p1", "mon-b", false)
+	PopProposal("p1")
+	RecordProposalOutcome(p, false, ts.Add(time.Minute), map[string]bool{"mon-c": false})
+
+	got := GetProposalHistory(ProposalFilter{MemberName: "PROVIDER1"})
+	if len(got) != 1 {
+		t.Fatalf("expected one history entry, got %d", len(got))
+	}
+	e := got[0]
+	if e.Proposal.SenderNodeID != "mon-a" || !e.Finalized || e.Passed {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+	if len(e.Votes) != 3 || !e.Votes["mon-a"] || e.Votes["mon-b"] || e.Votes["mon-c"] {
+		t.Fatalf("expected observed and finalizer votes to be merged, got %+v", e.Votes)
+	}
+}
+
+func TestProposalHistoryFiltersAndOrdersNewestFirst(t *testing.T) {
+	resetProposalHistory(t)
+
+	base := time.Date(2026, 4, 20, 10, 0, 0, 0, time.UTC)
+	for i, member := range []string{"provider1", "provider2", "provider1"} {
+		CacheProposal(Proposal{
+			ID:         string(rune('a' + i)),
+			CheckType:  "endpoint",
+			MemberName: member,
+			Timestamp:  base.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	RecordProposalOutcome(Proposal{ID: "a"}, true, base, nil)
+
+	got := GetProposalHistory(ProposalFilter{MemberName: "provider1"})
+	if len(got) != 2 || got[0].Proposal.ID != "c" || got[1].Proposal.ID != "a" {
+		t.Fatalf("expected provider1 entries newest first, got %+v", got)
+	}
+	if got[1].Proposal.MemberName != "provider1" {
+		t.Fatal("expected outcome not to overwrite the cached proposal")
+	}
+
+	got = GetProposalHistory(ProposalFilter{FinalizedOnly: true})
+	if len(got) != 1 || got[0].Proposal.ID != "a" {
+		t.Fatalf("expected only finalized entry, got %+v", got)
+	}
+
+	got = GetProposalHistory(ProposalFilter{Since: base.Add(30 * time.Minute), Limit: 1})
+	if len(got) != 1 || got[0].Proposal.ID != "c" {
+		t.Fatalf("expected newest entry after since with limit 1, got %+v", got)
+	}
+}
+
+func TestProposalHistoryIsBounded(t *testing.T) {
+	resetProposalHistory(t)
+
+	for i := 0; i < proposalHistorySize+10; i++ {
+		recordHistoryVote(time.Duration(i).String(), "mon-a", true)
+	}
+	historyMu.RLock()
+	n, first := len(historyByID), historyOrder[0]
+	historyMu.RUnlock()
+	if n != proposalHistorySize {
+		t.Fatalf("expected history capped at %d, got %d", proposalHistorySize, n)
+	}
+	if first != time.Duration(10).String() {
+		t.Fatalf("expected oldest entries evicted first, got %s", first)
+	}
+}
+
+func TestProposalHistoryHandler(t *testing.T) {
+	resetProposalHistory(t)
+	CacheProposal(Proposal{ID: "p1", MemberName: "provider1", CheckType: "site"})
+	CacheProposal(Proposal{ID: "p2", MemberName: "provider2", CheckType: "site"})
+
+	rec := httptest.NewRecorder()
+	ProposalHistoryHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proposals?member=provider2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var got []ProposalHistoryEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got) != 1 || got[0].Proposal.ID != "p2" {
+		t.Fatalf("expected p2 only, got %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	ProposalHistoryHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/proposals?since=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad since, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	ProposalHistoryHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/proposals", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+}
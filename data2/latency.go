@@ -0,0 +1,223 @@
+package data2
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// LATENCY SAMPLES
+// -----------------------------------------------------------------------------
+//
+// Monitors publish the response time of every check on monitor.latency; the
+// collator stores each sample in latency_samples and rolls them up hourly
+// into latency_rollups with percentiles per member and check target. Raw
+// samples are kept for latencySampleRetention.
+
+const (
+	latencySampleRetention = 7 * 24 * time.Hour
+	latencyInsertBatch     = 1000
+)
+
+// LatencySample is one measured response time.
+type LatencySample struct {
+	NodeID    string    `json:"nodeID"`
+	Member    string    `json:"member"`
+	CheckType string    `json:"checkType"`
+	CheckName string    `json:"checkName"`
+	Domain    string    `json:"domain,omitempty"`
+	Endpoint  string    `json:"endpoint,omitempty"`
+	IsIPv6    bool      `json:"isIPv6"`
+	LatencyMs float64   `json:"latencyMs"`
+	Measured  time.Time `json:"measured"`
+	// Region of the measuring monitor; set from the report, not stored.
+	Region string `json:"region,omitempty"`
+}
+
+// LatencyRollup summarises the samples of one member and check target over
+// one hour.
+type LatencyRollup struct {
+	Hour      time.Time `json:"hour"`
+	Member    string    `json:"member"`
+	CheckType string    `json:"checkType"`
+	CheckName string    `json:"checkName"`
+	Domain    string    `json:"domain,omitempty"`
+	Endpoint  string    `json:"endpoint,omitempty"`
+	IsIPv6    bool      `json:"isIPv6"`
+	Samples   int       `json:"samples"`
+	AvgMs     float64   `json:"avgMs"`
+	P50Ms     float64   `json:"p50Ms"`
+	P90Ms     float64   `json:"p90Ms"`
+	P99Ms     float64   `json:"p99Ms"`
+	MaxMs     float64   `json:"maxMs"`
+}
+
+// StoreLatencySamples inserts samples in batches of latencyInsertBatch rows.
+// Samples with a negative or non-finite latency are skipped.
+func StoreLatencySamples(samples []LatencySample) error {
+	var (
+		rows []string
+		args []interface{}
+	)
+	flush := func() error {
+		if len(rows) == 0 {
+			return nil
+		}
+		q := `INSERT INTO latency_samples
+			(measured_at, node_id, member_name, check_type, check_name, domain_name, endpoint, is_ipv6, latency_ms)
+			VALUES ` + strings.Join(rows, ",")
+		if _, err := DB.Exec(q, args...); err != nil {
+			return fmt.Errorf("insert latency samples: %w", err)
+		}
+		rows, args = rows[:0], args[:0]
+		return nil
+	}
+
+	for _, s := range samples {
+		if s.LatencyMs < 0 || math.IsNaN(s.LatencyMs) || math.IsInf(s.LatencyMs, 0) {
+			continue
+		}
+		rows = append(rows, "(?,?,?,?,?,?,?,?,?)")
+		args = append(args, s.Measured.UTC(), s.NodeID, s.Member, s.CheckType, s.CheckName,
+			s.Domain, s.Endpoint, s.IsIPv6, s.LatencyMs)
+		if len(rows) == latencyInsertBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// RollupLatency computes the rollups of the hour starting at hour from the
+// stored samples, replaces any earlier rollup of that hour, and deletes
+// samples older than the retention period. It returns the number of rollups
+// written.
+func RollupLatency(hour time.Time) (int, error) {
+	start := hour.UTC().Truncate(time.Hour)
+	end := start.Add(time.Hour)
+
+	rows, err := DB.Query(`SELECT member_name, check_type, check_name, domain_name, endpoint, is_ipv6, latency_ms
+		FROM latency_samples
+		WHERE measured_at >= ? AND measured_at < ?`, start, end)
+	if err != nil {
+		return 0, fmt.Errorf("query latency samples: %w", err)
+	}
+	groups := make(map[LatencyRollup][]float64)
+	for rows.Next() {
+		var (
+			k  LatencyRollup
+			ms float64
+		)
+		if err := rows.Scan(&k.Member, &k.CheckType, &k.CheckName, &k.Domain, &k.Endpoint, &k.IsIPv6, &ms); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan latency sample: %w", err)
+		}
+		k.Hour = start
+		groups[k] = append(groups[k], ms)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, fmt.Errorf("iterate latency samples: %w", err)
+	}
+	rows.Close()
+
+	written := 0
+	for k, values := range groups {
+		r := summarizeLatency(k, values)
+		_, err := DB.Exec(`INSERT INTO latency_rollups
+			(hour, member_name, check_type, check_name, domain_name, endpoint, is_ipv6,
+			 samples, avg_ms, p50_ms, p90_ms, p99_ms, max_ms)
+			VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)
+			ON DUPLICATE KEY UPDATE
+			  samples = VALUES(samples), avg_ms = VALUES(avg_ms), p50_ms = VALUES(p50_ms),
+			  p90_ms = VALUES(p90_ms), p99_ms = VALUES(p99_ms), max_ms = VALUES(max_ms)`,
+			r.Hour, r.Member, r.CheckType, r.CheckName, r.Domain, r.Endpoint, r.IsIPv6,
+			r.Samples, r.AvgMs, r.P50Ms, r.P90Ms, r.P99Ms, r.MaxMs)
+		if err != nil {
+			return written, fmt.Errorf("upsert latency rollup for %s: %w", r.Member, err)
+		}
+		written++
+	}
+
+	if _, err := DB.Exec(`DELETE FROM latency_samples WHERE measured_at < ?`,
+		time.Now().UTC().Add(-latencySampleRetention)); err != nil {
+		return written, fmt.Errorf("prune latency samples: %w", err)
+	}
+	return written, nil
+}
+
+// GetLatencyRollups returns the rollups of member (all members when empty)
+// for hours within [start, end], oldest first.
+func GetLatencyRollups(member string, start, end time.Time) ([]LatencyRollup, error) {
+	if err := checkRange("GetLatencyRollups", start, end); err != nil {
+		return nil, err
+	}
+	q := `SELECT hour, member_name, check_type, check_name, domain_name, endpoint, is_ipv6,
+		       samples, avg_ms, p50_ms, p90_ms, p99_ms, max_ms
+		FROM latency_rollups
+		WHERE hour >= ? AND hour <= ?`
+	args := []interface{}{start.UTC(), end.UTC()}
+	if member != "" {
+		q += ` AND member_name = ?`
+		args = append(args, member)
+	}
+	rows, err := DB.Query(q+` ORDER BY hour, member_name`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query latency rollups: %w", err)
+	}
+	defer rows.Close()
+
+	var out []LatencyRollup
+	for rows.Next() {
+		var r LatencyRollup
+		if err := rows.Scan(&r.Hour, &r.Member, &r.CheckType, &r.CheckName, &r.Domain, &r.Endpoint, &r.IsIPv6,
+			&r.Samples, &r.AvgMs, &r.P50Ms, &r.P90Ms, &r.P99Ms, &r.MaxMs); err != nil {
+			return nil, fmt.Errorf("scan latency rollup: %w", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate latency rollups: %w", err)
+	}
+	return out, nil
+}
+
+// summarizeLatency fills the statistics of k from values.
+func summarizeLatency(k LatencyRollup, values []float64) LatencyRollup {
+	k.Samples = len(values)
+	if len(values) == 0 {
+		return k
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	k.AvgMs = sum / float64(len(sorted))
+	k.P50Ms = percentile(sorted, 50)
+	k.P90Ms = percentile(sorted, 90)
+	k.P99Ms = percentile(sorted, 99)
+	k.MaxMs = sorted[len(sorted)-1]
+	return k
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
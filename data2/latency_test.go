@@ -0,0 +1,26 @@
+package data2
+
+import "testing"
+
+func TestPercentileNearestRank(t *testing.T) {
+	sorted := []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+	cases := map[float64]float64{50: 50, 90: 90, 99: 100, 0: 10}
+	for p, want := range cases {
+		if got := percentile(sorted, p); got != want {
+			t.Fatalf("p%v: expected %v, got %v", p, want, got)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Fatalf("expected 0 for no samples, got %v", got)
+	}
+}
+
+func TestSummarizeLatency(t *testing.T) {
+	r := summarizeLatency(LatencyRollup{Member: "provider1"}, []float64{30, 10, 20})
+	if r.Samples != 3 || r.AvgMs != 20 || r.P50Ms != 20 || r.MaxMs != 30 || r.P99Ms != 30 {
+		t.Fatalf("unexpected rollup %+v", r)
+	}
+	if r.Member != "provider1" {
+		t.Fatalf("expected key fields kept, got %+v", r)
+	}
+}
@@ -2,11 +2,15 @@ package data2
 
 import (
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
-	"github.com/ibp-network/ibp-geodns-libs/matrix"
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	"github.com/ibp-network/ibp-geodns-libs/data/eventstore"
+	"github.com/ibp-network/ibp-geodns-libs/internal/dbguard"
+	"github.com/ibp-network/ibp-geodns-libs/internal/offlinegate"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
 )
 
 // -----------------------------------------------------------------------------
@@ -26,6 +30,9 @@ type NetStatusRecord struct {
 	Error     string
 	VoteData  map[string]bool
 	Extra     map[string]interface{}
+	// ProposalID deduplicates the insert when several collators finalize
+	// the same proposal.
+	ProposalID string
 }
 
 // -----------------------------------------------------------------------------
@@ -45,18 +52,17 @@ func ctToString(ct int) string {
 	}
 }
 
-func boolToTiny(b bool) int {
-	if b {
-		return 1
-	}
-	return 0
-}
-
-func nullOrString(s string) sql.NullString {
-	if s == "" {
-		return sql.NullString{}
-	}
-	return sql.NullString{String: s, Valid: true}
+// eventKey maps rec onto the member_events key. CheckURL is the endpoint
+// for endpoint checks and is dropped for the others.
+func eventKey(rec NetStatusRecord) eventstore.Key {
+	return eventstore.Key{
+		CheckType: ctToString(rec.CheckType),
+		CheckName: rec.CheckName,
+		Member:    rec.Member,
+		Domain:    rec.Domain,
+		Endpoint:  rec.CheckURL,
+		IsIPv6:    rec.IsIPv6,
+	}.Normalize()
 }
 
 func shouldNotifyOffline(status bool, rowsAffected int64) bool {
@@ -64,111 +70,119 @@ func shouldNotifyOffline(status bool, rowsAffected int64) bool {
 }
 
 // -----------------------------------------------------------------------------
-// DB OPERATIONS + MATRIX NOTIFICATIONS
+// DB OPERATIONS + ALERT NOTIFICATIONS
 // -----------------------------------------------------------------------------
 
+// offlineEvents holds finalized offline records until the outage exceeds
+// System.MinimumOfflineTime; shorter outages are neither stored nor alerted.
+var offlineEvents = offlinegate.New(offlinegate.Minimum)
+
+// HoldNetStatus inserts the offline record rec once the outage, measured from
+// rec.StartTime, has lasted the minimum offline time. A CloseOpenEvent for the
+// same check before then drops it.
+func HoldNetStatus(rec NetStatusRecord) {
+	offlineEvents.Hold(eventKey(rec).String(), rec.StartTime, func() {
+		if err := InsertNetStatus(rec); err != nil {
+			log.Log(log.Error, "[data2] InsertNetStatus for %s %s: %v", rec.Member, rec.CheckName, err)
+		}
+	})
+}
+
+// InsertNetStatus opens the offline event rec through the shared event store
+// and raises the OFFLINE alert when the event is new. While MySQL is
+// unreachable the write is spooled and replayed later.
 func InsertNetStatus(rec NetStatusRecord) error {
-	jVotes, err := json.Marshal(rec.VoteData)
-	if err != nil {
-		return fmt.Errorf("marshal vote data: %w", err)
+	if ctToString(rec.CheckType) == "unknown" {
+		return fmt.Errorf("unsupported check type %d", rec.CheckType)
+	}
+	if rec.Status {
+		return fmt.Errorf("InsertNetStatus records offline events; use CloseOpenEvent for %s %s", rec.Member, rec.CheckName)
+	}
+	err := storeNetStatus(rec)
+	if shouldSpool(err) {
+		return spool(spooledWrite{Op: spoolOpen, NetStatus: &rec}, err)
+	}
+	return err
+}
+
+func storeNetStatus(rec NetStatusRecord) error {
+	var affected int64
+	err := mysqlGuard.Do(dbguard.DefaultPolicy, func() (err error) {
+		affected, err = Events().Open(eventstore.Event{
+			Key:        eventKey(rec),
+			StartTime:  rec.StartTime,
+			Error:      rec.Error,
+			Votes:      rec.VoteData,
+			Data:       rec.Extra,
+			ProposalID: rec.ProposalID,
+		})
+		return err
+	})
+	if errors.Is(err, eventstore.ErrDuplicateProposal) {
+		log.Log(log.Info, "[data2] %v; another collator stored it", err)
+		return nil
 	}
-	jExtra, err := json.Marshal(rec.Extra)
 	if err != nil {
-		return fmt.Errorf("marshal extra data: %w", err)
+		return err
 	}
+	if shouldNotifyOffline(rec.Status, affected) {
+		// New outage ⇒ alert, with the votes for the internal room
+		alerts.Dispatch(alerts.Event{
+			Kind:      alerts.KindOffline,
+			Member:    rec.Member,
+			CheckType: ctToString(rec.CheckType),
+			CheckName: rec.CheckName,
+			Domain:    rec.Domain,
+			Endpoint:  rec.CheckURL,
+			IPv6:      rec.IsIPv6,
+			Error:     rec.Error,
+			Votes:     rec.VoteData,
+		})
+	}
+	return nil
+}
 
-	ctString := ctToString(rec.CheckType)
-	if ctString == "unknown" {
+// CloseOpenEvent closes the open event of rec's check and raises the ONLINE
+// alert. While MySQL is unreachable the close is spooled with the current
+// time and replayed later.
+func CloseOpenEvent(rec NetStatusRecord) error {
+	if ctToString(rec.CheckType) == "unknown" {
 		return fmt.Errorf("unsupported check type %d", rec.CheckType)
 	}
-
-	// Ensure StartTime is UTC
-	if rec.StartTime.Location() != time.UTC {
-		rec.StartTime = rec.StartTime.UTC()
+	if offlineEvents.Release(eventKey(rec).String()) {
+		log.Log(log.Info, "[data2] dropped offline event shorter than the minimum for %s %s", rec.Member, rec.CheckName)
+		return nil
 	}
 
-	q := `INSERT INTO member_events
-		(check_type,check_name,endpoint,domain_name,member_name,status,is_ipv6,start_time,error,vote_data,additional_data)
-		VALUES (?,?,?,?,?,?,?,?,?,?,?)
-		ON DUPLICATE KEY UPDATE
-		  status      = VALUES(status),
-		  vote_data   = VALUES(vote_data),
-		  end_time    = IF(VALUES(status)=1,UTC_TIMESTAMP(),NULL)`
-
-	result, err := DB.Exec(q,
-		ctString,
-		rec.CheckName,
-		rec.CheckURL,
-		rec.Domain,
-		rec.Member,
-		boolToTiny(rec.Status),
-		boolToTiny(rec.IsIPv6),
-		rec.StartTime,
-		nullOrString(rec.Error),
-		string(jVotes),
-		string(jExtra),
-	)
-
-	if err == nil {
-		affected, rowsErr := result.RowsAffected()
-		if rowsErr != nil {
-			return rowsErr
-		}
-		if shouldNotifyOffline(rec.Status, affected) {
-			// New outage ⇒ alert
-			matrix.NotifyMemberOffline(
-				rec.Member,
-				ctToString(rec.CheckType),
-				rec.CheckName,
-				rec.Domain,
-				rec.CheckURL,
-				rec.IsIPv6,
-				rec.Error,
-			)
-		}
+	at := time.Now().UTC()
+	err := closeNetStatus(rec, at)
+	if shouldSpool(err) {
+		return spool(spooledWrite{Op: spoolClose, NetStatus: &rec, At: at}, err)
 	}
-
 	return err
 }
 
-func CloseOpenEvent(rec NetStatusRecord) error {
-	ctString := ctToString(rec.CheckType)
-	if ctString == "unknown" {
-		return fmt.Errorf("unsupported check type %d", rec.CheckType)
+func closeNetStatus(rec NetStatusRecord, at time.Time) error {
+	var affected int64
+	err := mysqlGuard.Do(dbguard.DefaultPolicy, func() (err error) {
+		affected, err = Events().Close(eventKey(rec), at)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return nil
 	}
 
-	q := `UPDATE member_events
-		SET end_time = UTC_TIMESTAMP(), status = 1
-		WHERE check_type=? AND check_name=? AND endpoint=? AND domain_name=? AND member_name=? AND is_ipv6=? AND status=0 AND end_time IS NULL`
-
-	result, err := DB.Exec(q,
-		ctString,
+	// Outage resolved ⇒ notify
+	alerts.MemberOnline(
+		rec.Member,
+		ctToString(rec.CheckType),
 		rec.CheckName,
-		rec.CheckURL,
 		rec.Domain,
-		rec.Member,
-		boolToTiny(rec.IsIPv6),
+		rec.CheckURL,
+		rec.IsIPv6,
 	)
-
-	if err == nil {
-		affected, rowsErr := result.RowsAffected()
-		if rowsErr != nil {
-			return rowsErr
-		}
-		if affected == 0 {
-			return nil
-		}
-
-		// Outage resolved ⇒ notify
-		matrix.NotifyMemberOnline(
-			rec.Member,
-			ctToString(rec.CheckType),
-			rec.CheckName,
-			rec.Domain,
-			rec.CheckURL,
-			rec.IsIPv6,
-		)
-	}
-
-	return err
+	return nil
 }
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-libs/internal/dbmetrics"
+	"github.com/ibp-network/ibp-geodns-libs/internal/eventschema"
 	"github.com/ibp-network/ibp-geodns-libs/internal/requestschema"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
 
@@ -25,7 +27,7 @@ func Init() {
 	)
 
 	var err error
-	DB, err = sql.Open("mysql", dsn)
+	DB, err = dbmetrics.Open(dsn)
 	if err != nil {
 		log.Log(log.Fatal, "[data2] MySQL DSN open error: %v", err)
 		panic(fmt.Sprintf("[data2] failed to open MySQL DSN: %v", err))
@@ -42,7 +44,15 @@ func Init() {
 			if schemaErr := requestschema.EnsureUniqueIndex(DB); schemaErr != nil {
 				log.Log(log.Warn, "[data2] requests schema check failed: %v", schemaErr)
 			}
+			if schemaErr := eventschema.EnsureOpenEventIndex(DB); schemaErr != nil {
+				log.Log(log.Warn, "[data2] member_events schema check failed: %v", schemaErr)
+			}
+			if schemaErr := eventschema.EnsureProposalColumn(DB); schemaErr != nil {
+				log.Log(log.Warn, "[data2] member_events proposal schema check failed: %v", schemaErr)
+			}
 			log.Log(log.Info, "[data2] Connected to MySQL (%s)", c.Local.Mysql.Host)
+			startSpoolReplay()
+			startNotificationPreferences()
 			return
 		}
 		log.Log(log.Warn, "[data2] MySQL ping failed (%v) — retry %d/30", err, i+1)
@@ -0,0 +1,281 @@
+package data2
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	"github.com/ibp-network/ibp-geodns-libs/api"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// NOTIFICATION PREFERENCES
+// -----------------------------------------------------------------------------
+//
+// Members choose where their alerts go (Matrix mentions, webhooks, email)
+// through NotificationPreferencesHandler, with their own API key or through
+// an operator. Preferences are kept in notification_preferences and cached
+// in memory, where the alert dispatcher reads them in place of
+// Alerts.matrix.members. The cache is reloaded every
+// notificationPrefsRefresh, so changes made through another collator arrive
+// within that time.
+
+const notificationPrefsRefresh = 5 * time.Minute
+
+// ErrInvalidPreferences is returned for preferences of an unknown member or
+// without an author.
+var ErrInvalidPreferences = errors.New("invalid notification preferences")
+
+// NotificationPreferences are the alert routes one member chose.
+type NotificationPreferences struct {
+	Member string `json:"member"`
+	alerts.MemberRoutes
+	UpdatedBy string    `json:"updatedBy"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+var (
+	notificationPrefsMu    sync.RWMutex
+	notificationPrefs      = make(map[string]NotificationPreferences) // lower-case member → preferences
+	notificationPrefsOnce  sync.Once
+	notificationPrefsClock = time.Now
+)
+
+// startNotificationPreferences loads the preferences, hands them to the
+// alert dispatcher and keeps them fresh.
+func startNotificationPreferences() {
+	notificationPrefsOnce.Do(func() {
+		if err := LoadNotificationPreferences(); err != nil {
+			log.Log(log.Warn, "[data2] %v; alerts use Alerts.matrix.members until the next refresh", err)
+		}
+		alerts.SetRouteSource(cachedRoutes)
+		go func() {
+			ticker := time.NewTicker(notificationPrefsRefresh)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := LoadNotificationPreferences(); err != nil {
+					log.Log(log.Warn, "[data2] %v", err)
+				}
+			}
+		}()
+	})
+}
+
+func cachedRoutes(member string) (alerts.MemberRoutes, bool) {
+	notificationPrefsMu.RLock()
+	defer notificationPrefsMu.RUnlock()
+	p, ok := notificationPrefs[strings.ToLower(member)]
+	return p.MemberRoutes, ok
+}
+
+// LoadNotificationPreferences replaces the cache with the stored
+// preferences.
+func LoadNotificationPreferences() error {
+	rows, err := DB.Query(`SELECT member_name, routes, updated_by, updated_at FROM notification_preferences`)
+	if err != nil {
+		return fmt.Errorf("load notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	loaded := make(map[string]NotificationPreferences)
+	for rows.Next() {
+		p, err := scanNotificationPreferences(rows)
+		if err != nil {
+			return err
+		}
+		loaded[strings.ToLower(p.Member)] = p
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("load notification preferences: %w", err)
+	}
+
+	notificationPrefsMu.Lock()
+	notificationPrefs = loaded
+	notificationPrefsMu.Unlock()
+	return nil
+}
+
+func scanNotificationPreferences(row interface{ Scan(...any) error }) (NotificationPreferences, error) {
+	var (
+		p      NotificationPreferences
+		routes []byte
+	)
+	if err := row.Scan(&p.Member, &routes, &p.UpdatedBy, &p.UpdatedAt); err != nil {
+		return p, fmt.Errorf("scan notification preferences: %w", err)
+	}
+	if err := json.Unmarshal(routes, &p.MemberRoutes); err != nil {
+		return p, fmt.Errorf("decode notification preferences of %s: %w", p.Member, err)
+	}
+	p.UpdatedAt = p.UpdatedAt.UTC()
+	return p, nil
+}
+
+// GetNotificationPreferences returns the stored preferences of member; ok
+// is false when it has none and its alerts follow the config.
+func GetNotificationPreferences(member string) (NotificationPreferences, bool, error) {
+	p, err := scanNotificationPreferences(DB.QueryRow(`SELECT member_name, routes, updated_by, updated_at
+		FROM notification_preferences WHERE member_name = ?`, member))
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotificationPreferences{}, false, nil
+	}
+	if err != nil {
+		return NotificationPreferences{}, false, err
+	}
+	return p, true, nil
+}
+
+// SetNotificationPreferences validates and stores the routes of member,
+// replacing earlier ones, and returns the stored preferences.
+func SetNotificationPreferences(member string, routes alerts.MemberRoutes, by string) (NotificationPreferences, error) {
+	p := NotificationPreferences{
+		Member:       strings.TrimSpace(member),
+		MemberRoutes: normaliseRoutes(routes),
+		UpdatedBy:    strings.TrimSpace(by),
+		UpdatedAt:    notificationPrefsClock().UTC().Truncate(time.Second),
+	}
+	if p.UpdatedBy == "" {
+		return p, fmt.Errorf("%w: author required", ErrInvalidPreferences)
+	}
+	if _, ok := cfg.GetMember(p.Member); !ok {
+		return p, fmt.Errorf("%w: unknown member %q", ErrInvalidPreferences, p.Member)
+	}
+	if err := p.MemberRoutes.Validate(); err != nil {
+		return p, err
+	}
+	data, err := json.Marshal(p.MemberRoutes)
+	if err != nil {
+		return p, fmt.Errorf("encode notification preferences: %w", err)
+	}
+	if _, err := DB.Exec(`INSERT INTO notification_preferences (member_name, routes, updated_by, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE routes = VALUES(routes), updated_by = VALUES(updated_by), updated_at = VALUES(updated_at)`,
+		p.Member, data, p.UpdatedBy, p.UpdatedAt); err != nil {
+		return p, fmt.Errorf("store notification preferences of %s: %w", p.Member, err)
+	}
+
+	notificationPrefsMu.Lock()
+	notificationPrefs[strings.ToLower(p.Member)] = p
+	notificationPrefsMu.Unlock()
+	log.Log(log.Info, "[data2] audit: %s set notification routes of %s: %d matrix, %d webhooks, %d emails",
+		p.UpdatedBy, p.Member, len(p.Matrix), len(p.Webhooks), len(p.Emails))
+	return p, nil
+}
+
+// DeleteNotificationPreferences removes the preferences of member, whose
+// alerts then follow the config again.
+func DeleteNotificationPreferences(member, by string) error {
+	if strings.TrimSpace(by) == "" {
+		return fmt.Errorf("%w: author required", ErrInvalidPreferences)
+	}
+	if _, err := DB.Exec(`DELETE FROM notification_preferences WHERE member_name = ?`, member); err != nil {
+		return fmt.Errorf("delete notification preferences of %s: %w", member, err)
+	}
+	notificationPrefsMu.Lock()
+	delete(notificationPrefs, strings.ToLower(member))
+	notificationPrefsMu.Unlock()
+	log.Log(log.Info, "[data2] audit: %s reset notification routes of %s", by, member)
+	return nil
+}
+
+// normaliseRoutes trims the entries of r and drops empty and repeated ones.
+func normaliseRoutes(r alerts.MemberRoutes) alerts.MemberRoutes {
+	clean := func(list []string) []string {
+		out := make([]string, 0, len(list))
+		seen := make(map[string]bool, len(list))
+		for _, v := range list {
+			v = strings.TrimSpace(v)
+			if v == "" || seen[v] {
+				continue
+			}
+			seen[v] = true
+			out = append(out, v)
+		}
+		return out
+	}
+	return alerts.MemberRoutes{Matrix: clean(r.Matrix), Webhooks: clean(r.Webhooks), Emails: clean(r.Emails)}
+}
+
+// NotificationPreferencesHandler exposes the preferences for a REST API,
+// for member= or, with a member key, the key's own member. GET returns the
+// stored preferences (404 when the member follows the config), PUT takes a
+// JSON alerts.MemberRoutes and stores it, DELETE goes back to the config.
+// Behind api.ReadWrite with api.RoleMember a member key may only see and
+// change its own member's preferences, and the author is the API key name.
+func NotificationPreferencesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		member := r.URL.Query().Get("member")
+		by := ""
+		if p, ok := api.PrincipalFromContext(r.Context()); ok {
+			if p.Member != "" {
+				if member != "" && member != p.Member {
+					http.Error(w, "forbidden: member keys manage their own member only", http.StatusForbidden)
+					return
+				}
+				member = p.Member
+			}
+			by = "api:" + p.Name
+		}
+		if member == "" {
+			http.Error(w, "member required", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			p, ok, err := GetNotificationPreferences(member)
+			switch {
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			case !ok:
+				http.Error(w, "no notification preferences; alerts follow the config", http.StatusNotFound)
+			default:
+				writePreferencesJSON(w, http.StatusOK, p)
+			}
+
+		case http.MethodPut:
+			var routes alerts.MemberRoutes
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&routes); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			p, err := SetNotificationPreferences(member, routes, by)
+			switch {
+			case errors.Is(err, ErrInvalidPreferences), errors.Is(err, alerts.ErrInvalidRoutes):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			default:
+				writePreferencesJSON(w, http.StatusOK, p)
+			}
+
+		case http.MethodDelete:
+			err := DeleteNotificationPreferences(member, by)
+			switch {
+			case errors.Is(err, ErrInvalidPreferences):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func writePreferencesJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,78 @@
+package data2
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	"github.com/ibp-network/ibp-geodns-libs/api"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func TestNormaliseRoutes(t *testing.T) {
+	got := normaliseRoutes(alerts.MemberRoutes{
+		Matrix: []string{" @ops:example.org ", "", "@ops:example.org"},
+		Emails: nil,
+	})
+	want := alerts.MemberRoutes{Matrix: []string{"@ops:example.org"}, Webhooks: []string{}, Emails: []string{}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestSetNotificationPreferencesRejectsBeforeStoring(t *testing.T) {
+	_, err := SetNotificationPreferences("member-1", alerts.MemberRoutes{}, "")
+	if !errors.Is(err, ErrInvalidPreferences) {
+		t.Fatalf("expected ErrInvalidPreferences without an author, got %v", err)
+	}
+	_, err = SetNotificationPreferences("no-such-member", alerts.MemberRoutes{}, "api:ops")
+	if !errors.Is(err, ErrInvalidPreferences) {
+		t.Fatalf("expected ErrInvalidPreferences for an unknown member, got %v", err)
+	}
+}
+
+func TestNotificationPreferencesHandlerKeepsMemberKeysToTheirMember(t *testing.T) {
+	keys := func() cfg.ApiConfig {
+		return cfg.ApiConfig{
+			AuthKeys:   map[string]string{"ops": "ops-key"},
+			MemberKeys: map[string]string{"member-1": "m1-key"},
+		}
+	}
+	h := api.ReadWrite(keys, api.RoleMember, api.RoleMember, NotificationPreferencesHandler())
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/notifications?member=member-2", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer m1-key")
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403 for another member, got %d", method, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/notifications", nil)
+	req.Header.Set("Authorization", "Bearer ops-key")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an operator key without member, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/notifications", strings.NewReader(`{"matrix":["ops"]}`))
+	req.Header.Set("Authorization", "Bearer m1-key")
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid routes or unknown member, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	NotificationPreferencesHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/notifications?member=member-1", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, PUT, DELETE" {
+		t.Fatalf("expected 405 with Allow: GET, PUT, DELETE, got %d", rec.Code)
+	}
+}
@@ -32,6 +32,8 @@ func CacheProposal(p Proposal) {
 	}
 	memStore[p.ID] = p
 	memMu.Unlock()
+
+	recordHistoryProposal(p)
 }
 
 func PopProposal(id string) (Proposal, bool) {
@@ -72,9 +74,12 @@ func RecordProposalVote(id, nodeID string, agree bool) int {
 	}
 	p.VoteData[nodeID] = agree
 	memStore[id] = p
+	recordHistoryVote(id, nodeID, agree)
 	return len(p.VoteData)
 }
 
+// Deprecated: use store.Default().Proposals.Cache.
 func StoreProposal(p Proposal) error { CacheProposal(p); return nil }
 
+// Deprecated: use store.Default().Proposals.Pop.
 func MarkProposalFinal(id string, yes, total int) error { _, _ = PopProposal(id); return nil }
@@ -0,0 +1,98 @@
+package data2
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// SHADOW RESULTS
+// -----------------------------------------------------------------------------
+//
+// Checks flagged Shadow go through consensus like any other, but their
+// finalized outcome is only stored here so a new check type can be judged
+// before it is allowed to open events. A proposal is stored once however
+// often its finalize is delivered.
+
+const defaultShadowLimit = 500
+
+// ShadowResult is the finalized outcome of one shadow proposal.
+type ShadowResult struct {
+	ProposalID     string          `json:"proposalID"`
+	CheckType      string          `json:"checkType"`
+	CheckName      string          `json:"checkName"`
+	Member         string          `json:"member"`
+	Domain         string          `json:"domain,omitempty"`
+	Endpoint       string          `json:"endpoint,omitempty"`
+	IsIPv6         bool            `json:"isIPv6"`
+	ProposedStatus bool            `json:"proposedStatus"`
+	Passed         bool            `json:"passed"`
+	Error          string          `json:"error,omitempty"`
+	Votes          map[string]bool `json:"votes,omitempty"`
+	DecidedAt      time.Time       `json:"decidedAt"`
+}
+
+// RecordShadowResult stores r unless its proposal is already stored.
+func RecordShadowResult(r ShadowResult) error {
+	votes, err := json.Marshal(r.Votes)
+	if err != nil {
+		return fmt.Errorf("marshal shadow votes: %w", err)
+	}
+	_, err = DB.Exec(`INSERT IGNORE INTO shadow_results
+		(proposal_id, check_type, check_name, member_name, domain_name, endpoint,
+		 is_ipv6, proposed_status, passed, error, vote_data, decided_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ProposalID, r.CheckType, r.CheckName, r.Member, r.Domain, r.Endpoint,
+		r.IsIPv6, r.ProposedStatus, r.Passed, r.Error, string(votes), r.DecidedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("insert shadow result: %w", err)
+	}
+	return nil
+}
+
+// GetShadowResults returns the shadow outcomes of checkName (all shadow
+// checks when empty) decided since since, newest first and at most limit
+// (default 500).
+func GetShadowResults(checkName string, since time.Time, limit int) ([]ShadowResult, error) {
+	if limit <= 0 {
+		limit = defaultShadowLimit
+	}
+	q := `SELECT proposal_id, check_type, check_name, member_name, domain_name, endpoint,
+		is_ipv6, proposed_status, passed, error, vote_data, decided_at
+		FROM shadow_results
+		WHERE decided_at >= ?`
+	args := []interface{}{since.UTC()}
+	if checkName != "" {
+		q += ` AND check_name = ?`
+		args = append(args, checkName)
+	}
+	q += ` ORDER BY decided_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := DB.Query(q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query shadow results: %w", err)
+	}
+	defer rows.Close()
+
+	var out []ShadowResult
+	for rows.Next() {
+		var (
+			r     ShadowResult
+			votes []byte
+		)
+		if err := rows.Scan(&r.ProposalID, &r.CheckType, &r.CheckName, &r.Member, &r.Domain, &r.Endpoint,
+			&r.IsIPv6, &r.ProposedStatus, &r.Passed, &r.Error, &votes, &r.DecidedAt); err != nil {
+			return nil, fmt.Errorf("scan shadow result: %w", err)
+		}
+		if len(votes) > 0 {
+			_ = json.Unmarshal(votes, &r.Votes)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate shadow results: %w", err)
+	}
+	return out, nil
+}
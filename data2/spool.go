@@ -0,0 +1,120 @@
+package data2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-libs/internal/dbguard"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// WRITE SPOOL
+// -----------------------------------------------------------------------------
+//
+// Event and usage writes go through the shared MySQL circuit breaker. A
+// write that still fails with a transient error, or finds the breaker open,
+// is spooled under WorkDir/tmp/mysql-spill instead of being lost, and the
+// spool is replayed in order when the breaker closes again and at Init.
+// Replayed event opens raise their OFFLINE alert then; closes keep the time
+// they were asked for.
+
+const (
+	spoolOpen  = "open"
+	spoolClose = "close"
+	spoolUsage = "usage"
+
+	maxSpoolFiles = 10000
+)
+
+// spooledWrite is one shed write.
+type spooledWrite struct {
+	Op        string           `json:"op"`
+	NetStatus *NetStatusRecord `json:"netStatus,omitempty"`
+	Usage     *UsageRecord     `json:"usage,omitempty"`
+	At        time.Time        `json:"at,omitempty"` // close time
+}
+
+var (
+	mysqlGuard = dbguard.MySQL
+	writeSpool = &dbguard.Spool{
+		Dir: func() string {
+			return filepath.Join(cfg.GetConfig().Local.System.WorkDir, "tmp", "mysql-spill")
+		},
+		MaxFiles: maxSpoolFiles,
+	}
+	replayOnce sync.Once
+)
+
+// shouldSpool reports whether a write that failed with err is worth keeping
+// for later: the database was unreachable rather than the write wrong.
+func shouldSpool(err error) bool {
+	return errors.Is(err, dbguard.ErrOpen) || dbguard.IsTransient(err)
+}
+
+// spool keeps w for replay. It returns nil once w is on disk, else both
+// errors.
+func spool(w spooledWrite, cause error) error {
+	if err := writeSpool.Append(w); err != nil {
+		return fmt.Errorf("%w; spooling it failed too: %v", cause, err)
+	}
+	log.Log(log.Warn, "[data2] MySQL unavailable (%v); spooled %s write for replay", cause, w.Op)
+	return nil
+}
+
+// startSpoolReplay replays what an earlier run spooled and registers the
+// replay with the breaker.
+func startSpoolReplay() {
+	replayOnce.Do(func() {
+		mysqlGuard.OnClose(ReplaySpooledWrites)
+	})
+	go ReplaySpooledWrites()
+}
+
+// ReplaySpooledWrites applies the spooled writes, oldest first, stopping at
+// the first one the database refuses again.
+func ReplaySpooledWrites() {
+	n, err := writeSpool.Drain(applySpooled)
+	if n > 0 {
+		log.Log(log.Info, "[data2] replayed %d spooled MySQL writes", n)
+	}
+	if err != nil {
+		log.Log(log.Warn, "[data2] spool replay stopped: %v", err)
+	}
+}
+
+// SpooledWrites returns the number of writes waiting for replay.
+func SpooledWrites() int {
+	return writeSpool.Len()
+}
+
+func applySpooled(line json.RawMessage) error {
+	var w spooledWrite
+	if err := json.Unmarshal(line, &w); err != nil {
+		log.Log(log.Error, "[data2] dropping unreadable spooled write: %v", err)
+		return nil
+	}
+	var err error
+	switch {
+	case w.Op == spoolOpen && w.NetStatus != nil:
+		err = storeNetStatus(*w.NetStatus)
+	case w.Op == spoolClose && w.NetStatus != nil:
+		err = closeNetStatus(*w.NetStatus, w.At)
+	case w.Op == spoolUsage && w.Usage != nil:
+		err = upsertUsageRow(*w.Usage)
+	default:
+		log.Log(log.Error, "[data2] dropping spooled write with op %q", w.Op)
+		return nil
+	}
+	if err != nil && !shouldSpool(err) {
+		// The database answered and refused it; replaying again won't help.
+		log.Log(log.Error, "[data2] dropping spooled %s write: %v", w.Op, err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package data2
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/dbguard"
+)
+
+func TestWritesAreSpooledWhileBreakerOpen(t *testing.T) {
+	prevGuard, prevSpool := mysqlGuard, writeSpool
+	defer func() { mysqlGuard, writeSpool = prevGuard, prevSpool }()
+
+	dir := t.TempDir()
+	writeSpool = &dbguard.Spool{Dir: func() string { return dir }}
+	mysqlGuard = dbguard.NewBreaker(1, time.Hour)
+	_ = mysqlGuard.Do(dbguard.Policy{Attempts: 1}, func() error { return driver.ErrBadConn })
+
+	rec := NetStatusRecord{CheckType: 1, CheckName: "ping", Member: "m", StartTime: time.Now().UTC()}
+	if err := InsertNetStatus(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := CloseOpenEvent(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpsertUsage(UsageRecord{Domain: "rpc.example", Hits: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if n := SpooledWrites(); n != 3 {
+		t.Fatalf("spooled %d writes, want 3", n)
+	}
+
+	var ops []string
+	_, err := writeSpool.Drain(func(line json.RawMessage) error {
+		var w spooledWrite
+		if err := json.Unmarshal(line, &w); err != nil {
+			return err
+		}
+		if w.Op == spoolClose && w.At.IsZero() {
+			t.Error("close spooled without its time")
+		}
+		ops = append(ops, w.Op)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 3 || ops[0] != spoolOpen || ops[1] != spoolClose || ops[2] != spoolUsage {
+		t.Fatalf("spooled ops %v", ops)
+	}
+}
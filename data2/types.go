@@ -46,6 +46,7 @@ type Proposal struct {
 	Data           map[string]interface{} `json:"Data"`
 	IsIPv6         bool                   `json:"IsIPv6"`
 	Timestamp      time.Time              `json:"Timestamp"`
+	Shadow         bool                   `json:"Shadow,omitempty"`
 
 	Domain    string    `json:"Domain,omitempty"`
 	Member    string    `json:"Member,omitempty"`
@@ -77,8 +78,11 @@ type FinalizeMessage struct {
 
 type UsageRecord struct {
 	Date        time.Time `json:"date"`
+	Hourly      bool      `json:"hourly,omitempty"` // Hour is set; otherwise a daily total
+	Hour        int       `json:"hour,omitempty"`
 	NodeID      string    `json:"nodeID"`
 	Domain      string    `json:"domain"`
+	Service     string    `json:"service,omitempty"` // Services key of Domain
 	MemberName  string    `json:"memberName"`
 	Asn         string    `json:"asn"`
 	NetworkName string    `json:"networkName"`
@@ -94,6 +98,13 @@ type UsageRequest struct {
 	Domain     string `json:"domain"`
 	MemberName string `json:"memberName"`
 	Country    string `json:"country"`
+
+	// UniqueClients asks DNS nodes to include their unique-client sketches.
+	UniqueClients bool `json:"uniqueClients,omitempty"`
+
+	// ChunkSize lets DNS nodes answer in several replies of at most this
+	// many records each. Zero asks for a single reply.
+	ChunkSize int `json:"chunkSize,omitempty"`
 }
 
 type UsageResponse struct {
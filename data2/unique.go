@@ -0,0 +1,116 @@
+package data2
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/hll"
+)
+
+// -----------------------------------------------------------------------------
+// UNIQUE CLIENTS
+// -----------------------------------------------------------------------------
+//
+// DNS nodes keep HyperLogLog sketches of client IPs and client prefixes per
+// day, domain and member. The collator stores every node's sketches as sent
+// and merges them at query time, so a client seen by several DNS nodes is
+// counted once.
+
+// UniqueClientRecord is the encoded sketch pair of one DNS node, day
+// ("2006-01-02"), domain and member.
+type UniqueClientRecord struct {
+	NodeID       string `json:"nodeID"`
+	Date         string `json:"date"`
+	Domain       string `json:"domain"`
+	MemberName   string `json:"memberName"`
+	IPSketch     []byte `json:"ipSketch"`
+	PrefixSketch []byte `json:"prefixSketch"`
+}
+
+// UniqueClients is an estimated number of distinct clients.
+type UniqueClients struct {
+	IPs      uint64 `json:"uniqueIPs"`
+	Prefixes uint64 `json:"uniquePrefixes"`
+}
+
+// StoreUniqueClients replaces the stored sketches of each record's node,
+// day, domain and member. Records with undecodable sketches are skipped.
+func StoreUniqueClients(recs []UniqueClientRecord) error {
+	var errs []string
+	for _, r := range recs {
+		if _, err := hll.Decode(r.IPSketch); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s/%s from %s: ip sketch: %v", r.Date, r.Domain, r.MemberName, r.NodeID, err))
+			continue
+		}
+		if _, err := hll.Decode(r.PrefixSketch); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s/%s from %s: prefix sketch: %v", r.Date, r.Domain, r.MemberName, r.NodeID, err))
+			continue
+		}
+		_, err := DB.Exec(`INSERT INTO unique_clients
+			(date, node_id, domain_name, member_name, ip_sketch, prefix_sketch)
+			VALUES (?,?,?,?,?,?)
+			ON DUPLICATE KEY UPDATE
+			  ip_sketch = VALUES(ip_sketch), prefix_sketch = VALUES(prefix_sketch)`,
+			r.Date, r.NodeID, r.Domain, r.MemberName, r.IPSketch, r.PrefixSketch)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s/%s from %s: %v", r.Date, r.Domain, r.MemberName, r.NodeID, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("StoreUniqueClients completed with %d error(s): %s",
+			len(errs), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// GetUniqueClients estimates the distinct clients of domain and member
+// (either empty for all) across every DNS node over the days of
+// [start, end].
+func GetUniqueClients(domain, member string, start, end time.Time) (UniqueClients, error) {
+	if err := checkRange("GetUniqueClients", start, end); err != nil {
+		return UniqueClients{}, err
+	}
+	q := `SELECT ip_sketch, prefix_sketch FROM unique_clients WHERE date BETWEEN ? AND ?`
+	args := []interface{}{start.Format("2006-01-02"), end.Format("2006-01-02")}
+	if domain != "" {
+		q += ` AND domain_name = ?`
+		args = append(args, domain)
+	}
+	if member != "" {
+		q += ` AND member_name = ?`
+		args = append(args, member)
+	}
+	rows, err := DB.Query(q, args...)
+	if err != nil {
+		return UniqueClients{}, fmt.Errorf("query unique clients: %w", err)
+	}
+	defer rows.Close()
+
+	ips, prefixes := hll.New(), hll.New()
+	for rows.Next() {
+		var ipBlob, prefixBlob []byte
+		if err := rows.Scan(&ipBlob, &prefixBlob); err != nil {
+			return UniqueClients{}, fmt.Errorf("scan unique clients: %w", err)
+		}
+		if err := mergeEncoded(ips, ipBlob); err != nil {
+			return UniqueClients{}, err
+		}
+		if err := mergeEncoded(prefixes, prefixBlob); err != nil {
+			return UniqueClients{}, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return UniqueClients{}, fmt.Errorf("iterate unique clients: %w", err)
+	}
+	return UniqueClients{IPs: ips.Estimate(), Prefixes: prefixes.Estimate()}, nil
+}
+
+func mergeEncoded(dst *hll.Sketch, blob []byte) error {
+	s, err := hll.Decode(blob)
+	if err != nil {
+		return fmt.Errorf("decode unique client sketch: %w", err)
+	}
+	dst.Merge(s)
+	return nil
+}
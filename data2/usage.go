@@ -3,7 +3,11 @@ package data2
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/ibp-network/ibp-geodns-libs/internal/dbguard"
+	"github.com/ibp-network/ibp-geodns-libs/internal/requestschema"
+	"github.com/ibp-network/ibp-geodns-libs/internal/stmtcache"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
 )
 
@@ -17,40 +21,61 @@ import (
  *  • The row’s `hits` column is **replaced** with the latest total, NOT
  *    incremented.  This guarantees that importing the *same* period
  *    more than once is idempotent and does **not** compound data.
+ *
+ *  • While MySQL is unreachable the row is spooled and replayed later.
+ *
+ * Deprecated: use store.Default().Usage.Replace.
  */
 func UpsertUsage(r UsageRecord) error {
+	err := upsertUsageRow(r)
+	if shouldSpool(err) {
+		return spool(spooledWrite{Op: spoolUsage, Usage: &r}, err)
+	}
+	return err
+}
+
+func upsertUsageRow(r UsageRecord) error {
 	q := `INSERT INTO requests
-	       (date, node_id, domain_name, member_name, network_asn, network_name,
+	       (date, hour, node_id, domain_name, service_name, member_name, network_asn, network_name,
 	        country_code, country_name, is_ipv6, hits)
-	       VALUES (?,?,?,?,?,?,?,?,?,?)
+	       VALUES (?,?,?,?,?,?,?,?,?,?,?,?)
 	       ON DUPLICATE KEY UPDATE
-	         hits = VALUES(hits)`
+	         hits = VALUES(hits),
+	         service_name = VALUES(service_name)`
 
 	ipFlag := 0
 	if r.IsIPv6 {
 		ipFlag = 1
 	}
 
-	_, err := DB.Exec(
-		q,
-		r.Date.Format("2006-01-02"),
-		usageKeyValue(r.NodeID),
-		usageKeyValue(r.Domain),
-		usageKeyValue(r.MemberName),
-		usageKeyValue(r.Asn),
-		usageKeyValue(r.NetworkName),
-		usageKeyValue(r.CountryCode),
-		usageKeyValue(r.CountryName),
-		ipFlag,
-		r.Hits,
-	)
-	return err
+	return mysqlGuard.Do(dbguard.DefaultPolicy, func() error {
+		_, err := stmtcache.Exec(
+			DB,
+			q,
+			r.Date.Format("2006-01-02"),
+			requestschema.HourValue(r.Hourly, r.Hour),
+			usageKeyValue(r.NodeID),
+			usageKeyValue(r.Domain),
+			r.Service,
+			usageKeyValue(r.MemberName),
+			usageKeyValue(r.Asn),
+			usageKeyValue(r.NetworkName),
+			usageKeyValue(r.CountryCode),
+			usageKeyValue(r.CountryName),
+			ipFlag,
+			r.Hits,
+		)
+		return err
+	})
 }
 
 func usageKeyValue(s string) string {
 	return s
 }
 
+// StoreUsageRecords upserts recs with UpsertUsage, continuing past failures.
+//
+// Deprecated: use store.Default().Usage.Replace.
 func StoreUsageRecords(recs []UsageRecord) error {
 	var errs []string
 	for _, r := range recs {
@@ -69,3 +94,81 @@ func StoreUsageRecords(recs []UsageRecord) error {
 	}
 	return nil
 }
+
+// RollupHourlyUsage folds hourly usage rows dated before the given day into
+// daily rows and returns the number of hourly rows removed.
+func RollupHourlyUsage(before time.Time) (int64, error) {
+	return requestschema.RollupHourly(DB, before)
+}
+
+// PurgeUsage deletes the usage and unique client rows dated before before
+// and returns the number of rows removed.
+func PurgeUsage(before time.Time) (int64, error) {
+	return requestschema.PurgeBefore(DB, before)
+}
+
+// UsageNodeTotals returns the stored hits of every node on date, hourly and
+// daily rows together.
+func UsageNodeTotals(date time.Time) (map[string]int64, error) {
+	rows, err := DB.Query(`SELECT node_id, SUM(hits) FROM requests
+		WHERE date = ? GROUP BY node_id`, date.UTC().Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("query usage totals: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]int64)
+	for rows.Next() {
+		var (
+			nodeID string
+			hits   int64
+		)
+		if err := rows.Scan(&nodeID, &hits); err != nil {
+			return nil, fmt.Errorf("scan usage totals: %w", err)
+		}
+		out[nodeID] = hits
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate usage totals: %w", err)
+	}
+	return out, nil
+}
+
+// ReplaceNodeUsage makes recs the only stored usage of nodeID on date: the
+// node's rows of that day are deleted and recs inserted in one transaction,
+// so rows the node no longer reports do not linger.
+func ReplaceNodeUsage(date time.Time, nodeID string, recs []UsageRecord) error {
+	day := date.UTC().Format("2006-01-02")
+	tx, err := DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin usage replace of %s: %w", nodeID, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM requests WHERE date = ? AND node_id = ?`, day, nodeID); err != nil {
+		return fmt.Errorf("delete usage of %s on %s: %w", nodeID, day, err)
+	}
+	for _, r := range recs {
+		if r.NodeID != nodeID || r.Date.UTC().Format("2006-01-02") != day {
+			return fmt.Errorf("usage record of %s on %s in replace of %s on %s",
+				r.NodeID, r.Date.UTC().Format("2006-01-02"), nodeID, day)
+		}
+		ipFlag := 0
+		if r.IsIPv6 {
+			ipFlag = 1
+		}
+		if _, err := tx.Exec(`INSERT INTO requests
+			(date, hour, node_id, domain_name, service_name, member_name, network_asn, network_name,
+			 country_code, country_name, is_ipv6, hits)
+			VALUES (?,?,?,?,?,?,?,?,?,?,?,?)
+			ON DUPLICATE KEY UPDATE hits = hits + VALUES(hits)`,
+			day, requestschema.HourValue(r.Hourly, r.Hour), r.NodeID, r.Domain, r.Service, r.MemberName,
+			r.Asn, r.NetworkName, r.CountryCode, r.CountryName, ipFlag, r.Hits); err != nil {
+			return fmt.Errorf("insert usage of %s on %s: %w", nodeID, day, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit usage replace of %s: %w", nodeID, err)
+	}
+	return nil
+}
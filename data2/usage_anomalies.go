@@ -0,0 +1,198 @@
+package data2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// USAGE ANOMALIES
+// -----------------------------------------------------------------------------
+//
+// Collators compare each hour's hits per ASN and per country with a
+// trailing baseline and store the spikes they find in usage_anomalies, once
+// per hour, dimension and value, for operators to review.
+
+// Anomaly dimensions and the requests column each groups by.
+const (
+	AnomalyASN     = "asn"
+	AnomalyCountry = "country"
+)
+
+var anomalyColumns = map[string]string{
+	AnomalyASN:     "network_asn",
+	AnomalyCountry: "country_code",
+}
+
+// UsageAnomaly is a spike of hits from one ASN or country in an hour.
+// Baseline is the value's average hits per hour over the trailing window
+// and Ratio Hits over Baseline.
+type UsageAnomaly struct {
+	ID         int64     `json:"id"`
+	Hour       time.Time `json:"hour"`
+	Dimension  string    `json:"dimension"`
+	Value      string    `json:"value"`
+	Hits       int64     `json:"hits"`
+	Baseline   float64   `json:"baseline"`
+	Ratio      float64   `json:"ratio"`
+	DetectedAt time.Time `json:"detectedAt"`
+	Reviewed   bool      `json:"reviewed"`
+	Note       string    `json:"note,omitempty"`
+}
+
+// UsageHitsBy sums the hourly usage rows of the hours from from up to to
+// by dimension value.
+func UsageHitsBy(dimension string, from, to time.Time) (map[string]int64, error) {
+	col, ok := anomalyColumns[dimension]
+	if !ok {
+		return nil, fmt.Errorf("unknown anomaly dimension %q", dimension)
+	}
+	from, to = from.UTC().Truncate(time.Hour), to.UTC().Truncate(time.Hour)
+	rows, err := DB.Query(`SELECT `+col+`, SUM(hits) FROM requests
+		WHERE hour >= 0 AND date BETWEEN ? AND ?
+		  AND ADDTIME(CAST(date AS DATETIME), MAKETIME(hour, 0, 0)) >= ?
+		  AND ADDTIME(CAST(date AS DATETIME), MAKETIME(hour, 0, 0)) < ?
+		GROUP BY `+col,
+		from.Format("2006-01-02"), to.Format("2006-01-02"), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("query usage by %s: %w", dimension, err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]int64)
+	for rows.Next() {
+		var (
+			value string
+			hits  int64
+		)
+		if err := rows.Scan(&value, &hits); err != nil {
+			return nil, fmt.Errorf("scan usage by %s: %w", dimension, err)
+		}
+		out[value] = hits
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate usage by %s: %w", dimension, err)
+	}
+	return out, nil
+}
+
+// RecordUsageAnomaly stores a unless the same hour, dimension and value is
+// already stored, and reports whether it was new.
+func RecordUsageAnomaly(a UsageAnomaly) (bool, error) {
+	res, err := DB.Exec(`INSERT IGNORE INTO usage_anomalies
+		(hour, dimension, value, hits, baseline, ratio, detected_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		a.Hour.UTC(), a.Dimension, a.Value, a.Hits, a.Baseline, a.Ratio, a.DetectedAt.UTC())
+	if err != nil {
+		return false, fmt.Errorf("insert usage anomaly %s %s: %w", a.Dimension, a.Value, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("insert usage anomaly %s %s: %w", a.Dimension, a.Value, err)
+	}
+	return n > 0, nil
+}
+
+// GetUsageAnomalies returns the anomalies of the hours since since, newest
+// first; reviewed ones only when reviewed is set.
+func GetUsageAnomalies(since time.Time, reviewed bool) ([]UsageAnomaly, error) {
+	q := `SELECT id, hour, dimension, value, hits, baseline, ratio, detected_at, reviewed, note
+		FROM usage_anomalies WHERE hour >= ?`
+	if !reviewed {
+		q += ` AND reviewed = 0`
+	}
+	rows, err := DB.Query(q+` ORDER BY hour DESC, ratio DESC`, since.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("query usage anomalies: %w", err)
+	}
+	defer rows.Close()
+
+	var out []UsageAnomaly
+	for rows.Next() {
+		var a UsageAnomaly
+		if err := rows.Scan(&a.ID, &a.Hour, &a.Dimension, &a.Value, &a.Hits, &a.Baseline, &a.Ratio,
+			&a.DetectedAt, &a.Reviewed, &a.Note); err != nil {
+			return nil, fmt.Errorf("scan usage anomaly: %w", err)
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate usage anomalies: %w", err)
+	}
+	return out, nil
+}
+
+// ReviewUsageAnomaly marks anomaly id reviewed with note, or returns
+// ErrNotFound.
+func ReviewUsageAnomaly(id int64, note string) error {
+	res, err := DB.Exec(`UPDATE usage_anomalies SET reviewed = 1, note = ? WHERE id = ?`, note, id)
+	if err != nil {
+		return fmt.Errorf("review usage anomaly %d: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return nil
+	}
+	// MySQL counts unchanged rows as unaffected, so a repeated review
+	// needs a lookup to tell it from an unknown ID.
+	var exists int
+	if err := DB.QueryRow(`SELECT COUNT(*) FROM usage_anomalies WHERE id = ?`, id).Scan(&exists); err != nil {
+		return fmt.Errorf("look up usage anomaly %d: %w", id, err)
+	}
+	if exists == 0 {
+		return fmt.Errorf("usage anomaly %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// UsageAnomaliesHandler exposes the stored anomalies for a REST API: GET
+// lists those of the last days (default 7, ?days=) still to review, with
+// ?all=1 the reviewed too; POST {"id":..,"note":".."} marks one reviewed.
+// Authentication is left to the API that mounts the handler.
+func UsageAnomaliesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			days := 7
+			if v := r.URL.Query().Get("days"); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n <= 0 {
+					http.Error(w, "invalid days", http.StatusBadRequest)
+					return
+				}
+				days = n
+			}
+			out, err := GetUsageAnomalies(time.Now().UTC().AddDate(0, 0, -days), r.URL.Query().Get("all") == "1")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(out)
+		case http.MethodPost:
+			var req struct {
+				ID   int64  `json:"id"`
+				Note string `json:"note"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID <= 0 {
+				http.Error(w, "id required", http.StatusBadRequest)
+				return
+			}
+			err := ReviewUsageAnomaly(req.ID, req.Note)
+			switch {
+			case errors.Is(err, ErrNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
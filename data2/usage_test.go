@@ -0,0 +1,43 @@
+package data2_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/data2"
+	"github.com/ibp-network/ibp-geodns-libs/testsupport"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestReplaceNodeUsageReplacesTheNodesDay(t *testing.T) {
+	db := testsupport.NewMockDB(t)
+	testsupport.UseDB(t, db.DB)
+
+	rec := testsupport.UsageRecord().Node("dns-1").Hour(5).Hits(7).Build()
+	db.ExpectBegin()
+	db.ExpectExec(`^DELETE FROM requests WHERE date = \? AND node_id = \?$`).
+		WithArgs("2025-01-01", "dns-1").WillReturnResult(sqlmock.NewResult(0, 3))
+	db.ExpectExec(`^INSERT INTO requests`).
+		WithArgs("2025-01-01", 5, "dns-1", "rpc.example", "", "member-1", "AS64500", "Example Net", "DE", "Germany", 0, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	db.ExpectCommit()
+
+	if err := data2.ReplaceNodeUsage(testsupport.Epoch, "dns-1", []data2.UsageRecord{rec}); err != nil {
+		t.Fatalf("ReplaceNodeUsage: %v", err)
+	}
+}
+
+func TestReplaceNodeUsageRejectsOtherNodes(t *testing.T) {
+	db := testsupport.NewMockDB(t)
+	testsupport.UseDB(t, db.DB)
+
+	db.ExpectBegin()
+	db.ExpectExec(`^DELETE FROM requests`).WillReturnResult(sqlmock.NewResult(0, 0))
+	db.ExpectRollback()
+
+	rec := testsupport.UsageRecord().Node("dns-2").Date(testsupport.Epoch.Add(time.Hour)).Build()
+	if err := data2.ReplaceNodeUsage(testsupport.Epoch, "dns-1", []data2.UsageRecord{rec}); err == nil {
+		t.Fatal("expected a record of another node to abort the replace")
+	}
+}
@@ -0,0 +1,138 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+	"github.com/ibp-network/ibp-geodns-libs/discord"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/matrix"
+)
+
+const defaultTopCountries = 5
+
+// Start blocks, posting a digest once a day at the configured UTC hour.
+// Configuration is re-read before every run so hot reloads take effect.
+func Start() {
+	for {
+		dc := cfg.GetConfig().Alerts.Digest
+		now := time.Now().UTC()
+		next := nextRun(now, dc.HourUTC)
+		time.Sleep(time.Until(next))
+
+		dc = cfg.GetConfig().Alerts.Digest
+		if !dc.Enabled {
+			continue
+		}
+		if err := Post(next.Add(-24*time.Hour), next, dc); err != nil {
+			log.Log(log.Error, "[digest] %v", err)
+		}
+	}
+}
+
+// Post builds the digest for [start, end) and delivers it to every
+// configured Matrix room and Discord channel.
+func Post(start, end time.Time, dc cfg.DigestConfig) error {
+	top := dc.TopCountries
+	if top <= 0 {
+		top = defaultTopCountries
+	}
+
+	sum, err := data2.BuildDigest(start, end, top)
+	if err != nil {
+		return fmt.Errorf("build digest: %w", err)
+	}
+
+	body, formatted := formatDigest(sum)
+
+	for _, room := range dc.MatrixRooms {
+		if err := matrix.SendToRoom(room, body, formatted); err != nil {
+			log.Log(log.Warn, "[digest] matrix room %s: %v", room, err)
+		}
+	}
+
+	for _, channel := range dc.DiscordChannels {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		err := discord.SendMessage(ctx, channel, body)
+		cancel()
+		if err != nil {
+			log.Log(log.Warn, "[digest] discord channel %s: %v", channel, err)
+		}
+	}
+
+	log.Log(log.Info, "[digest] posted summary for %s – %s",
+		start.Format(time.RFC3339), end.Format(time.RFC3339))
+	return nil
+}
+
+// nextRun returns the next occurrence of hour:00 UTC strictly after now.
+func nextRun(now time.Time, hour int) time.Time {
+	if hour < 0 || hour > 23 {
+		hour = 0
+	}
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, time.UTC)
+	if !next.After(now) {
+		next = next.Add(24 * time.Hour)
+	}
+	return next
+}
+
+// formatDigest renders the summary as plain text and HTML.
+func formatDigest(sum data2.DigestSummary) (body, formatted string) {
+	var b, h strings.Builder
+
+	title := fmt.Sprintf("📊 Daily digest %s – %s UTC",
+		sum.Start.Format("2006-01-02 15:04"), sum.End.Format("2006-01-02 15:04"))
+	fmt.Fprintf(&b, "%s\n", title)
+	fmt.Fprintf(&h, "<strong>%s</strong><br/>", html.EscapeString(title))
+
+	fmt.Fprintf(&b, "• New outages: %d\n• Resolved outages: %d\n", sum.NewOutages, sum.ResolvedOutages)
+	fmt.Fprintf(&h, "• New outages: %d<br/>• Resolved outages: %d<br/>", sum.NewOutages, sum.ResolvedOutages)
+
+	members := make([]string, 0, len(sum.DowntimeMinutes))
+	for m := range sum.DowntimeMinutes {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		mi, mj := sum.DowntimeMinutes[members[i]], sum.DowntimeMinutes[members[j]]
+		if mi != mj {
+			return mi > mj
+		}
+		return members[i] < members[j]
+	})
+
+	if len(members) == 0 {
+		b.WriteString("• Downtime: none\n")
+		h.WriteString("• Downtime: none<br/>")
+	} else {
+		b.WriteString("• Downtime (minutes):\n")
+		h.WriteString("• Downtime (minutes):<br/>")
+		for _, m := range members {
+			fmt.Fprintf(&b, "    %s: %d\n", m, sum.DowntimeMinutes[m])
+			fmt.Fprintf(&h, "&nbsp;&nbsp;<strong>%s</strong>: %d<br/>", html.EscapeString(m), sum.DowntimeMinutes[m])
+		}
+	}
+
+	if len(sum.TopCountries) > 0 {
+		b.WriteString("• Top countries:\n")
+		h.WriteString("• Top countries:<br/>")
+		for i, c := range sum.TopCountries {
+			name := c.CountryName
+			if name == "" {
+				name = c.CountryCode
+			}
+			fmt.Fprintf(&b, "    %d. %s (%s): %d\n", i+1, name, c.CountryCode, c.Hits)
+			fmt.Fprintf(&h, "&nbsp;&nbsp;%d. %s (%s): %d<br/>", i+1,
+				html.EscapeString(name), html.EscapeString(c.CountryCode), c.Hits)
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), strings.TrimSuffix(h.String(), "<br/>")
+}
@@ -0,0 +1,46 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+)
+
+func TestNextRunSchedulesFutureHour(t *testing.T) {
+	now := time.Date(2025, 3, 10, 8, 30, 0, 0, time.UTC)
+
+	if got := nextRun(now, 9); !got.Equal(time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected same-day run, got %v", got)
+	}
+	if got := nextRun(now, 8); !got.Equal(time.Date(2025, 3, 11, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected next-day run, got %v", got)
+	}
+	if got := nextRun(now, 42); !got.Equal(time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected invalid hour to fall back to midnight, got %v", got)
+	}
+}
+
+func TestFormatDigestOrdersDowntimeDescending(t *testing.T) {
+	sum := data2.DigestSummary{
+		Start:           time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC),
+		End:             time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC),
+		NewOutages:      3,
+		ResolvedOutages: 2,
+		DowntimeMinutes: map[string]int64{"alpha": 5, "beta": 120},
+		TopCountries:    []data2.CountryHits{{CountryCode: "DE", CountryName: "Germany", Hits: 900}},
+	}
+
+	body, formatted := formatDigest(sum)
+
+	if strings.Index(body, "beta") > strings.Index(body, "alpha") {
+		t.Fatalf("expected members with more downtime first:\n%s", body)
+	}
+	if !strings.Contains(body, "1. Germany (DE): 900") {
+		t.Fatalf("expected top country line in body:\n%s", body)
+	}
+	if !strings.Contains(formatted, "<strong>beta</strong>: 120") {
+		t.Fatalf("expected html downtime entry, got %s", formatted)
+	}
+}
@@ -0,0 +1,63 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+const (
+	apiBase = "https://discord.com/api/v10"
+
+	// maxMessageLen is Discord's hard limit for message content.
+	maxMessageLen = 2000
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// SendMessage posts plain content to a channel using the configured bot token.
+// Content longer than Discord's limit is truncated.
+func SendMessage(ctx context.Context, channelID, content string) error {
+	token := cfg.GetConfig().Local.Discord.Token
+	if token == "" {
+		return fmt.Errorf("discord token not configured")
+	}
+	if channelID == "" {
+		return fmt.Errorf("discord channel not specified")
+	}
+
+	if r := []rune(content); len(r) > maxMessageLen {
+		content = string(r[:maxMessageLen-1]) + "…"
+	}
+
+	payload, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return fmt.Errorf("marshal discord message: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/channels/%s/messages", apiBase, channelID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("build discord request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bot "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("post discord message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("discord returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,347 @@
+// Package dnsrecords indexes the StaticDNS records of the config for lookups
+// by name and type, with wildcard matching, TTL defaults, SOA/NS synthesis
+// per zone and zone-file export.
+package dnsrecords
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+const (
+	defaultTTL         = 3600
+	defaultNegativeTTL = 300
+
+	soaRefresh = 10800
+	soaRetry   = 3600
+	soaExpire  = 604800
+
+	reloadHook = "dnsrecords"
+)
+
+// ErrUnknownZone is returned for a zone the index does not serve.
+var ErrUnknownZone = errors.New("dnsrecords: unknown zone")
+
+// Options control how an Index is built.
+type Options struct {
+	DefaultTTL  int
+	NegativeTTL int
+	// Zones are served in addition to the names of SOA records.
+	Zones       []string
+	Nameservers []string
+	// Hostmaster is the SOA contact, as an address or in DNS form; the
+	// default is hostmaster.<zone>.
+	Hostmaster string
+	// Serial of synthesised SOA records; 0 uses the build time as
+	// YYYYMMDDHH.
+	Serial uint32
+	// DomainNegativeTTL overrides NegativeTTL for names at or below a
+	// domain.
+	DomainNegativeTTL map[string]int
+}
+
+// OptionsFromConfig converts System.DNS.
+func OptionsFromConfig(c cfg.DNSConfig) Options {
+	return Options{
+		DefaultTTL:  c.DefaultTTL,
+		NegativeTTL: c.NegativeTTL,
+		Zones:       c.Zones,
+		Nameservers: c.Nameservers,
+		Hostmaster:  c.Hostmaster,
+	}
+}
+
+// Index answers lookups over a fixed set of records. It is safe for
+// concurrent use.
+type Index struct {
+	byName map[string][]cfg.DNSRecord
+	zones  []string // longest first
+	negTTL int
+	domNeg map[string]int
+}
+
+// New indexes records. Names are matched case-insensitively and without a
+// trailing dot; records with a TTL of 0 or less get opts.DefaultTTL.
+func New(records []cfg.DNSRecord, opts Options) *Index {
+	if opts.DefaultTTL <= 0 {
+		opts.DefaultTTL = defaultTTL
+	}
+	if opts.NegativeTTL <= 0 {
+		opts.NegativeTTL = defaultNegativeTTL
+	}
+	if opts.Serial == 0 {
+		opts.Serial = serialFor(time.Now().UTC())
+	}
+
+	ix := &Index{byName: make(map[string][]cfg.DNSRecord), negTTL: opts.NegativeTTL, domNeg: make(map[string]int)}
+	for d, ttl := range opts.DomainNegativeTTL {
+		if d = Normalize(d); d != "" && ttl > 0 {
+			ix.domNeg[d] = ttl
+		}
+	}
+	zoneSet := make(map[string]struct{})
+	for _, z := range opts.Zones {
+		if z = Normalize(z); z != "" {
+			zoneSet[z] = struct{}{}
+		}
+	}
+	for _, r := range records {
+		r.QName = Normalize(r.QName)
+		r.QType = strings.ToUpper(strings.TrimSpace(r.QType))
+		if r.QName == "" || r.QType == "" {
+			continue
+		}
+		if r.TTL <= 0 {
+			r.TTL = opts.DefaultTTL
+		}
+		if r.QType == "SOA" {
+			zoneSet[r.QName] = struct{}{}
+		}
+		ix.byName[r.QName] = append(ix.byName[r.QName], r)
+	}
+
+	for z := range zoneSet {
+		ix.zones = append(ix.zones, z)
+	}
+	sort.Slice(ix.zones, func(i, j int) bool {
+		if len(ix.zones[i]) != len(ix.zones[j]) {
+			return len(ix.zones[i]) > len(ix.zones[j])
+		}
+		return ix.zones[i] < ix.zones[j]
+	})
+	for _, z := range ix.zones {
+		ix.synthesize(z, opts)
+	}
+	return ix
+}
+
+// synthesize adds SOA and NS records to zone when it has none.
+func (ix *Index) synthesize(zone string, opts Options) {
+	apex := ix.byName[zone]
+	var hasSOA, hasNS bool
+	domainID := 0
+	for _, r := range apex {
+		hasSOA = hasSOA || r.QType == "SOA"
+		hasNS = hasNS || r.QType == "NS"
+		if domainID == 0 {
+			domainID = r.DomainID
+		}
+	}
+
+	var nameservers []string
+	for _, ns := range opts.Nameservers {
+		if ns = Normalize(ns); ns != "" {
+			nameservers = append(nameservers, ns)
+		}
+	}
+
+	if !hasNS {
+		for _, ns := range nameservers {
+			apex = append(apex, cfg.DNSRecord{QName: zone, QType: "NS", Content: ns + ".", TTL: opts.DefaultTTL, Auth: true, DomainID: domainID})
+		}
+	}
+	if !hasSOA {
+		primary := "ns1." + zone
+		if len(nameservers) > 0 {
+			primary = nameservers[0]
+		}
+		content := fmt.Sprintf("%s. %s %d %d %d %d %d",
+			primary, hostmaster(opts.Hostmaster, zone), opts.Serial, soaRefresh, soaRetry, soaExpire, opts.NegativeTTL)
+		apex = append([]cfg.DNSRecord{{QName: zone, QType: "SOA", Content: content, TTL: opts.DefaultTTL, Auth: true, DomainID: domainID}}, apex...)
+	}
+	ix.byName[zone] = apex
+}
+
+// Lookup returns the records of qname and qtype. "ANY" returns every type.
+// A name without records of qtype but with a CNAME returns the CNAME. A name
+// that does not exist is answered from the wildcard at its closest encloser,
+// with QName rewritten to qname.
+func (ix *Index) Lookup(qname, qtype string) []cfg.DNSRecord {
+	name := Normalize(qname)
+	qtype = strings.ToUpper(strings.TrimSpace(qtype))
+
+	if recs, ok := ix.byName[name]; ok {
+		return filter(recs, qtype, "")
+	}
+	for p := parent(name); p != ""; p = parent(p) {
+		if recs, ok := ix.byName["*."+p]; ok {
+			return filter(recs, qtype, name)
+		}
+		if _, exists := ix.byName[p]; exists {
+			break
+		}
+	}
+	return nil
+}
+
+func filter(recs []cfg.DNSRecord, qtype, rename string) []cfg.DNSRecord {
+	var out, cnames []cfg.DNSRecord
+	for _, r := range recs {
+		if rename != "" {
+			r.QName = rename
+		}
+		switch {
+		case qtype == "ANY" || r.QType == qtype:
+			out = append(out, r)
+		case r.QType == "CNAME":
+			cnames = append(cnames, r)
+		}
+	}
+	if len(out) == 0 {
+		return cnames
+	}
+	return out
+}
+
+// NegativeTTL returns how long a negative answer for qname may be cached:
+// the NegativeTTL policy of the closest domain at or above qname, else the
+// index's NegativeTTL.
+func (ix *Index) NegativeTTL(qname string) int {
+	for name := Normalize(qname); name != ""; name = parent(name) {
+		if ttl, ok := ix.domNeg[name]; ok {
+			return ttl
+		}
+	}
+	return ix.negTTL
+}
+
+// Zones returns the served zones, longest first.
+func (ix *Index) Zones() []string {
+	return append([]string(nil), ix.zones...)
+}
+
+// ZoneFor returns the most specific zone containing qname.
+func (ix *Index) ZoneFor(qname string) (string, bool) {
+	name := Normalize(qname)
+	for _, z := range ix.zones {
+		if name == z || strings.HasSuffix(name, "."+z) {
+			return z, true
+		}
+	}
+	return "", false
+}
+
+// Records returns the records of zone, excluding those of more specific
+// zones, in zone-file order: SOA, apex NS, then by name, type and content.
+func (ix *Index) Records(zone string) ([]cfg.DNSRecord, error) {
+	zone = Normalize(zone)
+	known := false
+	for _, z := range ix.zones {
+		known = known || z == zone
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownZone, zone)
+	}
+
+	var out []cfg.DNSRecord
+	for name, recs := range ix.byName {
+		if z, ok := ix.ZoneFor(name); ok && z == zone {
+			out = append(out, recs...)
+		}
+	}
+	rank := func(r cfg.DNSRecord) int {
+		switch {
+		case r.QName == zone && r.QType == "SOA":
+			return 0
+		case r.QName == zone && r.QType == "NS":
+			return 1
+		case r.QName == zone:
+			return 2
+		}
+		return 3
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra < rb
+		}
+		if a.QName != b.QName {
+			return a.QName < b.QName
+		}
+		if a.QType != b.QType {
+			return a.QType < b.QType
+		}
+		return a.Content < b.Content
+	})
+	return out, nil
+}
+
+// ZoneFile renders zone in RFC 1035 master-file format, for debugging.
+func (ix *Index) ZoneFile(zone string) (string, error) {
+	recs, err := ix.Records(zone)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ORIGIN %s.\n", Normalize(zone))
+	for _, r := range recs {
+		content := r.Content
+		if r.QType == "TXT" && !strings.HasPrefix(content, `"`) {
+			content = fmt.Sprintf("%q", content)
+		}
+		fmt.Fprintf(&b, "%-40s %6d IN %-6s %s\n", r.QName+".", r.TTL, r.QType, content)
+	}
+	return b.String(), nil
+}
+
+// Normalize lower-cases name and strips surrounding whitespace and dots.
+func Normalize(name string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+func parent(name string) string {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+func hostmaster(contact, zone string) string {
+	contact = strings.TrimSpace(contact)
+	if contact == "" {
+		return "hostmaster." + zone + "."
+	}
+	if at := strings.IndexByte(contact, '@'); at >= 0 {
+		local := strings.ReplaceAll(contact[:at], ".", `\.`)
+		return local + "." + Normalize(contact[at+1:]) + "."
+	}
+	return Normalize(contact) + "."
+}
+
+func serialFor(t time.Time) uint32 {
+	return uint32(t.Year())*1000000 + uint32(t.Month())*10000 + uint32(t.Day())*100 + uint32(t.Hour())
+}
+
+// -----------------------------------------------------------------------------
+// CONFIG INDEX
+// -----------------------------------------------------------------------------
+
+var (
+	current  atomic.Pointer[Index]
+	initOnce sync.Once
+)
+
+// Default returns the index of the current StaticDNS config. It is built on
+// first use and rebuilt on every config reload.
+func Default() *Index {
+	initOnce.Do(func() {
+		rebuild()
+		cfg.RegisterReloadHook(reloadHook, rebuild)
+	})
+	return current.Load()
+}
+
+func rebuild() {
+	c := cfg.GetConfig()
+	ix := New(c.StaticDNS, OptionsFromConfig(c.Local.System.DNS))
+	current.Store(ix)
+	log.Log(log.Debug, "[dnsrecords] indexed %d static records in %d zones", len(c.StaticDNS), len(ix.zones))
+}
@@ -0,0 +1,91 @@
+package dnsrecords
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func testIndex() *Index {
+	return New([]cfg.DNSRecord{
+		{QName: "example.org.", QType: "a", Content: "192.0.2.1"},
+		{QName: "www.example.org", QType: "CNAME", Content: "example.org.", TTL: 60},
+		{QName: "*.rpc.example.org", QType: "A", Content: "192.0.2.10"},
+		{QName: "*.rpc.example.org", QType: "TXT", Content: "wildcard"},
+		{QName: "fixed.rpc.example.org", QType: "A", Content: "192.0.2.20"},
+		{QName: "rpc.example.org", QType: "TXT", Content: "v=1"},
+		{QName: "sub.example.net", QType: "SOA", Content: "ns.example.net. admin.example.net. 1 2 3 4 5"},
+	}, Options{
+		Zones:       []string{"Example.org"},
+		Nameservers: []string{"ns1.example.org", "ns2.example.org."},
+		Hostmaster:  "dns.admin@example.org",
+		Serial:      2025010100,
+	})
+}
+
+func TestLookupExactWildcardAndCNAME(t *testing.T) {
+	ix := testIndex()
+
+	if got := ix.Lookup("EXAMPLE.org.", "A"); len(got) != 1 || got[0].TTL != defaultTTL {
+		t.Fatalf("expected apex A with default TTL, got %+v", got)
+	}
+	if got := ix.Lookup("www.example.org", "A"); len(got) != 1 || got[0].QType != "CNAME" || got[0].TTL != 60 {
+		t.Fatalf("expected CNAME for A query, got %+v", got)
+	}
+	got := ix.Lookup("node1.rpc.example.org", "A")
+	if len(got) != 1 || got[0].QName != "node1.rpc.example.org" || got[0].Content != "192.0.2.10" {
+		t.Fatalf("expected wildcard answer renamed to qname, got %+v", got)
+	}
+	if got := ix.Lookup("a.b.rpc.example.org", "ANY"); len(got) != 2 {
+		t.Fatalf("expected both wildcard records for ANY, got %+v", got)
+	}
+	if got := ix.Lookup("fixed.rpc.example.org", "TXT"); got != nil {
+		t.Fatalf("expected existing name not to fall back to the wildcard, got %+v", got)
+	}
+	if got := ix.Lookup("nope.www.example.org", "A"); got != nil {
+		t.Fatalf("expected no answer below a name without wildcard, got %+v", got)
+	}
+}
+
+func TestSynthesizedSOAAndNS(t *testing.T) {
+	ix := testIndex()
+
+	soa := ix.Lookup("example.org", "SOA")
+	want := "ns1.example.org. dns\\.admin.example.org. 2025010100 10800 3600 604800 300"
+	if len(soa) != 1 || soa[0].Content != want {
+		t.Fatalf("expected synthesised SOA %q, got %+v", want, soa)
+	}
+	if ns := ix.Lookup("example.org", "NS"); len(ns) != 2 {
+		t.Fatalf("expected two synthesised NS records, got %+v", ns)
+	}
+	if soa := ix.Lookup("sub.example.net", "SOA"); len(soa) != 1 || !strings.HasPrefix(soa[0].Content, "ns.example.net.") {
+		t.Fatalf("expected configured SOA to be kept, got %+v", soa)
+	}
+	if z, ok := ix.ZoneFor("x.rpc.example.org"); !ok || z != "example.org" {
+		t.Fatalf("expected zone example.org, got %q", z)
+	}
+}
+
+func TestZoneFile(t *testing.T) {
+	ix := testIndex()
+
+	zf, err := ix.ZoneFile("example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(zf), "\n")
+	if lines[0] != "$ORIGIN example.org." || !strings.Contains(lines[1], " SOA ") || !strings.Contains(lines[2], " NS ") {
+		t.Fatalf("expected origin, SOA and NS first, got:\n%s", zf)
+	}
+	if !strings.Contains(zf, `IN TXT    "v=1"`) {
+		t.Fatalf("expected quoted TXT content, got:\n%s", zf)
+	}
+	if strings.Contains(zf, "sub.example.net") {
+		t.Fatal("expected records of other zones to be excluded")
+	}
+	if _, err := ix.ZoneFile("example.com"); !errors.Is(err, ErrUnknownZone) {
+		t.Fatalf("expected ErrUnknownZone, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package dnsrecords
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+)
+
+// -----------------------------------------------------------------------------
+// MEMBER RECORDS
+// -----------------------------------------------------------------------------
+//
+// Every active member answers for the domains in its ServiceAssignments with
+// an A record of Service.ServiceIPv4 and an AAAA record of ServiceIPv6.
+// Members with an override, members below a service's LevelRequired and
+// members offline for the domain are left out, unless every member of a
+// domain is offline: then all of them are returned rather than no answer.
+
+// OnlineFunc reports whether member may answer for domain over IPv4 or IPv6.
+type OnlineFunc func(domain, member string, ipv6 bool) bool
+
+// OfficialOnline checks the official consensus results.
+func OfficialOnline(domain, member string, ipv6 bool) bool {
+	if ipv6 {
+		return dat.IsMemberOnlineForDomainIPv6(domain, member)
+	}
+	return dat.IsMemberOnlineForDomain(domain, member)
+}
+
+// MemberRecord is a generated record with the member it points at.
+// Degraded is set when some members of its record set are offline; the
+// record then carries the DegradedTTL of its policy.
+type MemberRecord struct {
+	cfg.DNSRecord
+	Member   string
+	Location cfg.Location
+	Degraded bool
+}
+
+// ResolvePolicy fills the zero fields of p from sys and the defaults.
+func ResolvePolicy(sys cfg.DNSConfig, p cfg.DNSPolicy) cfg.DNSPolicy {
+	pick := func(vals ...int) int {
+		for _, v := range vals {
+			if v > 0 {
+				return v
+			}
+		}
+		return 0
+	}
+	p.AnswerTTL = pick(p.AnswerTTL, sys.DefaultTTL, defaultTTL)
+	p.DegradedTTL = pick(p.DegradedTTL, sys.DegradedTTL, p.AnswerTTL)
+	p.NegativeTTL = pick(p.NegativeTTL, sys.NegativeTTL, defaultNegativeTTL)
+	return p
+}
+
+// Policy returns the resolved DNS policy of domain under the current
+// config; domains of no service get the System.DNS defaults.
+func Policy(domain string) cfg.DNSPolicy {
+	var p cfg.DNSPolicy
+	if _, svc, ok := cfg.GetServiceForDomain(Normalize(domain)); ok {
+		p = svc.Configuration.DNSPolicy
+	}
+	return ResolvePolicy(cfg.GetConfig().Local.System.DNS, p)
+}
+
+// Generate derives the member records of c with the TTLs of each service's
+// DNSPolicy. A nil online treats every member as online; ttl above 0
+// replaces the policy TTLs.
+func Generate(c cfg.Config, online OnlineFunc, ttl int) []MemberRecord {
+	policy := func(service string) cfg.DNSPolicy {
+		p := ResolvePolicy(c.Local.System.DNS, c.Services[service].Configuration.DNSPolicy)
+		if ttl > 0 {
+			p.AnswerTTL, p.DegradedTTL = ttl, ttl
+		}
+		return p
+	}
+
+	type rrset struct {
+		up, all []MemberRecord
+		policy  cfg.DNSPolicy
+	}
+	sets := make(map[[2]string]*rrset)
+
+	names := make([]string, 0, len(c.Members))
+	for name := range c.Members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, key := range names {
+		m := c.Members[key]
+		if m.Override || m.Service.Active != 1 {
+			continue
+		}
+		member := m.Details.Name
+		if member == "" {
+			member = key
+		}
+		v4, v6 := parseServiceIP(m.Service.ServiceIPv4, true), parseServiceIP(m.Service.ServiceIPv6, false)
+
+		for serviceKey, domains := range m.ServiceAssignments {
+			if svc, ok := c.Services[serviceKey]; ok && m.Membership.Level < svc.Configuration.LevelRequired {
+				continue
+			}
+			for _, d := range domains {
+				domain := assignmentDomain(d)
+				if domain == "" {
+					continue
+				}
+				for _, rr := range []struct {
+					qtype, ip string
+					ipv6      bool
+				}{{"A", v4, false}, {"AAAA", v6, true}} {
+					if rr.ip == "" {
+						continue
+					}
+					k := [2]string{domain, rr.qtype}
+					set := sets[k]
+					if set == nil {
+						set = &rrset{policy: policy(serviceKey)}
+						sets[k] = set
+					}
+					if containsMember(set.all, member) {
+						continue
+					}
+					rec := MemberRecord{
+						DNSRecord: cfg.DNSRecord{QName: domain, QType: rr.qtype, Content: rr.ip, TTL: set.policy.AnswerTTL, Auth: true},
+						Member:    member,
+						Location:  m.Location,
+					}
+					set.all = append(set.all, rec)
+					if online == nil || online(domain, member, rr.ipv6) {
+						set.up = append(set.up, rec)
+					}
+				}
+			}
+		}
+	}
+
+	var out []MemberRecord
+	for _, set := range sets {
+		recs := set.up
+		if len(recs) == 0 {
+			recs = set.all
+		}
+		degraded := len(set.up) < len(set.all)
+		for _, r := range recs {
+			if degraded {
+				r.Degraded, r.TTL = true, set.policy.DegradedTTL
+			}
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.QName != b.QName {
+			return a.QName < b.QName
+		}
+		if a.QType != b.QType {
+			return a.QType < b.QType
+		}
+		return a.Member < b.Member
+	})
+	return out
+}
+
+// Build indexes the StaticDNS records of c together with its generated
+// member records. Static records win: a name and type defined in StaticDNS
+// gets no member records. Domains of services with a NegativeTTL policy
+// get it from Index.NegativeTTL.
+func Build(c cfg.Config, online OnlineFunc) *Index {
+	opts := OptionsFromConfig(c.Local.System.DNS)
+	static := make(map[[2]string]bool, len(c.StaticDNS))
+	records := make([]cfg.DNSRecord, 0, len(c.StaticDNS))
+	for _, r := range c.StaticDNS {
+		static[[2]string{Normalize(r.QName), strings.ToUpper(strings.TrimSpace(r.QType))}] = true
+		records = append(records, r)
+	}
+	for _, r := range Generate(c, online, 0) {
+		if !static[[2]string{r.QName, r.QType}] {
+			records = append(records, r.DNSRecord)
+		}
+	}
+	opts.DomainNegativeTTL = domainNegativeTTLs(c)
+	return New(records, opts)
+}
+
+// domainNegativeTTLs maps the assigned domains of services with a
+// NegativeTTL policy to it.
+func domainNegativeTTLs(c cfg.Config) map[string]int {
+	out := make(map[string]int)
+	for _, m := range c.Members {
+		for service, domains := range m.ServiceAssignments {
+			ttl := c.Services[service].Configuration.DNSPolicy.NegativeTTL
+			if ttl <= 0 {
+				continue
+			}
+			for _, d := range domains {
+				if domain := assignmentDomain(d); domain != "" {
+					out[domain] = ttl
+				}
+			}
+		}
+	}
+	return out
+}
+
+// assignmentDomain accepts a bare domain or an RPC URL.
+func assignmentDomain(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "://") {
+		s = max.ParseUrl(s).Domain
+	}
+	return Normalize(s)
+}
+
+func parseServiceIP(s string, v4 bool) string {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	if addr.Is4() != v4 {
+		return ""
+	}
+	return addr.String()
+}
+
+func containsMember(recs []MemberRecord, member string) bool {
+	for _, r := range recs {
+		if r.Member == member {
+			return true
+		}
+	}
+	return false
+}
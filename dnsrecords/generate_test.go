@@ -0,0 +1,134 @@
+package dnsrecords
+
+import (
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func generateConfig() cfg.Config {
+	member := func(name, v4, v6 string, level int, domains ...string) cfg.Member {
+		return cfg.Member{
+			Details:            cfg.MemberDetails{Name: name},
+			Membership:         cfg.Membership{Level: level},
+			Service:            cfg.ServiceInfo{Active: 1, ServiceIPv4: v4, ServiceIPv6: v6},
+			ServiceAssignments: map[string][]string{"polkadot": domains},
+		}
+	}
+	c := cfg.Config{
+		Members: map[string]cfg.Member{
+			"alpha": member("alpha", "192.0.2.1", "2001:db8::1", 5, "rpc.example.org", "https://sys.example.org/ws"),
+			"beta":  member("beta", "192.0.2.2", "", 5, "rpc.example.org"),
+			"gamma": member("gamma", "192.0.2.3", "", 1, "rpc.example.org"),
+			"delta": member("delta", "192.0.2.4", "", 5, "rpc.example.org"),
+		},
+		Services: map[string]cfg.Service{
+			"polkadot": {Configuration: cfg.ServiceConfiguration{LevelRequired: 3}},
+		},
+		StaticDNS: []cfg.DNSRecord{
+			{QName: "sys.example.org", QType: "A", Content: "198.51.100.9"},
+		},
+	}
+	delta := c.Members["delta"]
+	delta.Override = true
+	c.Members["delta"] = delta
+	return c
+}
+
+func TestGenerateSkipsIneligibleAndOfflineMembers(t *testing.T) {
+	c := generateConfig()
+	online := func(domain, member string, ipv6 bool) bool { return member != "beta" }
+
+	got := Generate(c, online, 0)
+	var a, aaaa []string
+	for _, r := range got {
+		if r.QName != "rpc.example.org" {
+			continue
+		}
+		if r.TTL != defaultTTL {
+			t.Fatalf("expected default TTL, got %+v", r)
+		}
+		if r.QType == "A" {
+			a = append(a, r.Member)
+		} else {
+			aaaa = append(aaaa, r.Member)
+		}
+	}
+	if len(a) != 1 || a[0] != "alpha" || len(aaaa) != 1 || aaaa[0] != "alpha" {
+		t.Fatalf("expected only alpha to answer, got A=%v AAAA=%v", a, aaaa)
+	}
+}
+
+func TestGenerateFailsOpenWhenEveryMemberIsOffline(t *testing.T) {
+	c := generateConfig()
+	offline := func(string, string, bool) bool { return false }
+
+	var members []string
+	for _, r := range Generate(c, offline, 30) {
+		if r.QName == "rpc.example.org" && r.QType == "A" {
+			members = append(members, r.Member)
+		}
+	}
+	if len(members) != 2 {
+		t.Fatalf("expected alpha and beta when all are offline, got %v", members)
+	}
+}
+
+func TestBuildPrefersStaticRecords(t *testing.T) {
+	ix := Build(generateConfig(), nil)
+
+	if got := ix.Lookup("sys.example.org", "A"); len(got) != 1 || got[0].Content != "198.51.100.9" {
+		t.Fatalf("expected the static record to win, got %+v", got)
+	}
+	if got := ix.Lookup("sys.example.org", "AAAA"); len(got) != 1 || got[0].Content != "2001:db8::1" {
+		t.Fatalf("expected the generated AAAA record, got %+v", got)
+	}
+	if got := ix.Lookup("rpc.example.org", "A"); len(got) != 2 {
+		t.Fatalf("expected two member A records, got %+v", got)
+	}
+}
+
+func TestGenerateAppliesServiceDNSPolicy(t *testing.T) {
+	c := generateConfig()
+	c.Local.System.DNS.NegativeTTL = 600
+	c.Services["polkadot"] = cfg.Service{Configuration: cfg.ServiceConfiguration{
+		LevelRequired: 3,
+		DNSPolicy:     cfg.DNSPolicy{AnswerTTL: 120, DegradedTTL: 15, NegativeTTL: 30},
+	}}
+
+	ttls := func(recs []MemberRecord) map[string]int {
+		out := make(map[string]int)
+		for _, r := range recs {
+			if r.QName == "rpc.example.org" {
+				out[r.QType+" "+r.Member] = r.TTL
+			}
+		}
+		return out
+	}
+	got := ttls(Generate(c, nil, 0))
+	if got["A alpha"] != 120 || got["A beta"] != 120 {
+		t.Fatalf("expected the answer TTL while all members are up, got %v", got)
+	}
+	online := func(domain, member string, ipv6 bool) bool { return member != "beta" }
+	recs := Generate(c, online, 0)
+	got = ttls(recs)
+	if got["A alpha"] != 15 || got["AAAA alpha"] != 120 {
+		t.Fatalf("expected the degraded TTL only on the degraded set, got %v", got)
+	}
+	for _, r := range recs {
+		if r.QType == "A" && r.QName == "rpc.example.org" && !r.Degraded {
+			t.Fatalf("expected %+v to be marked degraded", r)
+		}
+	}
+
+	ix := Build(c, online)
+	if ttl := ix.NegativeTTL("missing.rpc.example.org"); ttl != 30 {
+		t.Fatalf("expected the service negative TTL, got %d", ttl)
+	}
+	if ttl := ix.NegativeTTL("other.example.net"); ttl != 600 {
+		t.Fatalf("expected the system negative TTL, got %d", ttl)
+	}
+	if p := ResolvePolicy(cfg.DNSConfig{DefaultTTL: 300}, cfg.DNSPolicy{}); p != (cfg.DNSPolicy{AnswerTTL: 300, DegradedTTL: 300, NegativeTTL: defaultNegativeTTL}) {
+		t.Fatalf("unexpected resolved policy %+v", p)
+	}
+}
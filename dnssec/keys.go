@@ -0,0 +1,232 @@
+// Package dnssec signs the zones served by the GeoDNS nodes: it keeps a
+// key-signing and a zone-signing ECDSA P-256 key per zone under WorkDir,
+// signs record sets with RRSIG, builds the NSEC chain of a zone and outputs
+// the DS record to hand to the parent zone.
+package dnssec
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+const (
+	// AlgorithmECDSAP256SHA256 is DNSSEC algorithm 13 (RFC 6605), the only
+	// one this package signs with.
+	AlgorithmECDSAP256SHA256 = 13
+
+	// FlagsZSK and FlagsKSK are the DNSKEY flags of zone- and key-signing
+	// keys.
+	FlagsZSK = 256
+	FlagsKSK = 257
+
+	digestSHA256 = 2
+	protocol     = 3
+)
+
+// Key is one DNSSEC signing key of a zone.
+type Key struct {
+	Zone      string
+	Flags     uint16
+	Algorithm uint8
+	Created   time.Time
+
+	priv *ecdsa.PrivateKey
+}
+
+// KeySet is the key-signing and zone-signing key of a zone.
+type KeySet struct {
+	Zone string
+	KSK  *Key
+	ZSK  *Key
+}
+
+type keyFile struct {
+	Zone       string    `json:"zone"`
+	Flags      uint16    `json:"flags"`
+	Algorithm  uint8     `json:"algorithm"`
+	Created    time.Time `json:"created"`
+	PrivateKey string    `json:"privateKey"` // base64 PKCS#8
+}
+
+// KeyDir is where keys are kept: WorkDir/dnssec.
+func KeyDir() string {
+	return filepath.Join(cfg.GetConfig().Local.System.WorkDir, "dnssec")
+}
+
+// NewKey generates a key for zone with the given flags.
+func NewKey(zone string, flags uint16) (*Key, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{Zone: normalize(zone), Flags: flags, Algorithm: AlgorithmECDSAP256SHA256, Created: time.Now().UTC(), priv: priv}, nil
+}
+
+// LoadOrCreateKeys reads the KSK and ZSK of zone from dir, generating and
+// saving any that are missing. Key files are readable by the owner only.
+func LoadOrCreateKeys(dir, zone string) (*KeySet, error) {
+	zone = normalize(zone)
+	if zone == "" {
+		return nil, errors.New("dnssec: empty zone")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("dnssec: key directory: %w", err)
+	}
+
+	ks := &KeySet{Zone: zone}
+	for _, k := range []struct {
+		kind  string
+		flags uint16
+		dst   **Key
+	}{{"ksk", FlagsKSK, &ks.KSK}, {"zsk", FlagsZSK, &ks.ZSK}} {
+		path := filepath.Join(dir, zone+"."+k.kind+".json")
+		key, err := loadKey(path)
+		if errors.Is(err, os.ErrNotExist) {
+			if key, err = NewKey(zone, k.flags); err == nil {
+				err = saveKey(path, key)
+			}
+			if err == nil {
+				log.Log(log.Info, "[dnssec] generated %s for %s, key tag %d", strings.ToUpper(k.kind), zone, key.KeyTag())
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("dnssec: %s of %s: %w", k.kind, zone, err)
+		}
+		if key.Flags != k.flags || key.Zone != zone {
+			return nil, fmt.Errorf("dnssec: %s is not the %s of %s", path, k.kind, zone)
+		}
+		*k.dst = key
+	}
+	return ks, nil
+}
+
+func loadKey(path string) (*Key, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kf keyFile
+	if err := json.Unmarshal(b, &kf); err != nil {
+		return nil, err
+	}
+	der, err := base64.StdEncoding.DecodeString(kf.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok || priv.Curve != elliptic.P256() || kf.Algorithm != AlgorithmECDSAP256SHA256 {
+		return nil, fmt.Errorf("unsupported key in %s", path)
+	}
+	return &Key{Zone: kf.Zone, Flags: kf.Flags, Algorithm: kf.Algorithm, Created: kf.Created, priv: priv}, nil
+}
+
+func saveKey(path string, k *Key) error {
+	der, err := x509.MarshalPKCS8PrivateKey(k.priv)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(keyFile{
+		Zone:       k.Zone,
+		Flags:      k.Flags,
+		Algorithm:  k.Algorithm,
+		Created:    k.Created,
+		PrivateKey: base64.StdEncoding.EncodeToString(der),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// publicKey is the DNSKEY public key field: X and Y, 32 bytes each.
+func (k *Key) publicKey() []byte {
+	out := make([]byte, 64)
+	k.priv.PublicKey.X.FillBytes(out[:32])
+	k.priv.PublicKey.Y.FillBytes(out[32:])
+	return out
+}
+
+func (k *Key) rdata() []byte {
+	out := binary.BigEndian.AppendUint16(nil, k.Flags)
+	out = append(out, protocol, k.Algorithm)
+	return append(out, k.publicKey()...)
+}
+
+// KeyTag is the RFC 4034 appendix B key tag.
+func (k *Key) KeyTag() uint16 {
+	var ac uint32
+	for i, b := range k.rdata() {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16 & 0xffff
+	return uint16(ac & 0xffff)
+}
+
+// DNSKEY returns the key's DNSKEY record.
+func (k *Key) DNSKEY(ttl int) cfg.DNSRecord {
+	return cfg.DNSRecord{
+		QName:   k.Zone,
+		QType:   "DNSKEY",
+		Content: fmt.Sprintf("%d %d %d %s", k.Flags, protocol, k.Algorithm, base64.StdEncoding.EncodeToString(k.publicKey())),
+		TTL:     ttl,
+		Auth:    true,
+	}
+}
+
+// DS returns the SHA-256 DS record of the key, for the parent zone.
+func (k *Key) DS(ttl int) (cfg.DNSRecord, error) {
+	owner, err := nameWire(k.Zone)
+	if err != nil {
+		return cfg.DNSRecord{}, err
+	}
+	sum := sha256.Sum256(append(owner, k.rdata()...))
+	return cfg.DNSRecord{
+		QName:   k.Zone,
+		QType:   "DS",
+		Content: fmt.Sprintf("%d %d %d %s", k.KeyTag(), k.Algorithm, digestSHA256, hex.EncodeToString(sum[:])),
+		TTL:     ttl,
+		Auth:    true,
+	}, nil
+}
+
+// DS returns the DS record of the key-signing key.
+func (ks *KeySet) DS(ttl int) (cfg.DNSRecord, error) {
+	return ks.KSK.DS(ttl)
+}
+
+// DNSKEYs returns the DNSKEY records of both keys.
+func (ks *KeySet) DNSKEYs(ttl int) []cfg.DNSRecord {
+	return []cfg.DNSRecord{ks.KSK.DNSKEY(ttl), ks.ZSK.DNSKEY(ttl)}
+}
+
+func normalize(name string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(name)), ".")
+}
@@ -0,0 +1,252 @@
+package dnssec
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+// -----------------------------------------------------------------------------
+// SIGNING
+// -----------------------------------------------------------------------------
+//
+// Records are cfg.DNSRecord values in presentation format, as StaticDNS and
+// the dnsrecords package use them. SignRRset signs one RRset, e.g. an answer
+// generated per query; SignZone signs a whole zone and adds its DNSKEY and
+// NSEC records. DNSKEY RRsets are signed with the KSK, everything else with
+// the ZSK.
+
+const (
+	// DefaultValidity is how long signatures stay valid.
+	DefaultValidity = 14 * 24 * time.Hour
+	// inceptionSkew back-dates signatures for resolvers with slow clocks.
+	inceptionSkew = time.Hour
+
+	rrsigTimeLayout = "20060102150405"
+)
+
+// ErrMixedRRset is returned for records that are not one RRset.
+var ErrMixedRRset = errors.New("dnssec: records do not form one RRset")
+
+// SignRRset returns the RRSIG of rrset, valid from now minus an hour until
+// now plus validity (DefaultValidity when 0 or less).
+func (ks *KeySet) SignRRset(rrset []cfg.DNSRecord, now time.Time, validity time.Duration) (cfg.DNSRecord, error) {
+	if len(rrset) == 0 {
+		return cfg.DNSRecord{}, ErrMixedRRset
+	}
+	if validity <= 0 {
+		validity = DefaultValidity
+	}
+	key := ks.ZSK
+	if strings.EqualFold(rrset[0].QType, "DNSKEY") {
+		key = ks.KSK
+	}
+	return signRRset(key, rrset, now.Add(-inceptionSkew), now.Add(validity))
+}
+
+func signRRset(key *Key, rrset []cfg.DNSRecord, inception, expiration time.Time) (cfg.DNSRecord, error) {
+	owner := normalize(rrset[0].QName)
+	qtype := strings.ToUpper(rrset[0].QType)
+	ttl := rrset[0].TTL
+	for _, r := range rrset[1:] {
+		if normalize(r.QName) != owner || !strings.EqualFold(r.QType, qtype) {
+			return cfg.DNSRecord{}, ErrMixedRRset
+		}
+		if r.TTL < ttl {
+			ttl = r.TTL
+		}
+	}
+	code, ok := TypeCode(qtype)
+	if !ok {
+		return cfg.DNSRecord{}, fmt.Errorf("dnssec: unsupported record type %s", qtype)
+	}
+
+	header := rrsigHeader{
+		qtype:       qtype,
+		typeCovered: code,
+		algorithm:   key.Algorithm,
+		labels:      uint8(labelCount(owner)),
+		originalTTL: uint32(ttl),
+		expiration:  uint32(expiration.Unix()),
+		inception:   uint32(inception.Unix()),
+		keyTag:      key.KeyTag(),
+		signer:      key.Zone,
+	}
+	data, err := signedData(header, owner, rrset)
+	if err != nil {
+		return cfg.DNSRecord{}, err
+	}
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key.priv, digest[:])
+	if err != nil {
+		return cfg.DNSRecord{}, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return cfg.DNSRecord{
+		QName: owner,
+		QType: "RRSIG",
+		Content: fmt.Sprintf("%s %d %d %d %s %s %d %s. %s",
+			qtype, header.algorithm, header.labels, header.originalTTL,
+			expiration.UTC().Format(rrsigTimeLayout), inception.UTC().Format(rrsigTimeLayout),
+			header.keyTag, header.signer, base64.StdEncoding.EncodeToString(sig)),
+		TTL:  ttl,
+		Auth: true,
+	}, nil
+}
+
+type rrsigHeader struct {
+	qtype       string
+	typeCovered uint16
+	algorithm   uint8
+	labels      uint8
+	originalTTL uint32
+	expiration  uint32
+	inception   uint32
+	keyTag      uint16
+	signer      string
+}
+
+// signedData is the input of an RRSIG signature (RFC 4034 section 3.1.8.1):
+// the RRSIG RDATA without the signature followed by the RRset in canonical
+// form and order.
+func signedData(h rrsigHeader, owner string, rrset []cfg.DNSRecord) ([]byte, error) {
+	signer, err := nameWire(h.signer)
+	if err != nil {
+		return nil, err
+	}
+	out := binary.BigEndian.AppendUint16(nil, h.typeCovered)
+	out = append(out, h.algorithm, h.labels)
+	out = binary.BigEndian.AppendUint32(out, h.originalTTL)
+	out = binary.BigEndian.AppendUint32(out, h.expiration)
+	out = binary.BigEndian.AppendUint32(out, h.inception)
+	out = binary.BigEndian.AppendUint16(out, h.keyTag)
+	out = append(out, signer...)
+
+	// A wildcard owner is signed as the wildcard name, not the query name.
+	labels, err := splitLabels(owner)
+	if err != nil {
+		return nil, err
+	}
+	if int(h.labels) < len(labels) {
+		owner = "*." + strings.Join(labels[len(labels)-int(h.labels):], ".")
+	}
+	ownerWire, err := nameWire(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	rdatas := make([][]byte, 0, len(rrset))
+	for _, r := range rrset {
+		rd, err := rdataWire(h.qtype, r.Content)
+		if err != nil {
+			return nil, err
+		}
+		rdatas = append(rdatas, rd)
+	}
+	sort.Slice(rdatas, func(i, j int) bool { return bytes.Compare(rdatas[i], rdatas[j]) < 0 })
+
+	var prev []byte
+	for _, rd := range rdatas {
+		if prev != nil && bytes.Equal(prev, rd) {
+			continue // duplicate records are one RR
+		}
+		prev = rd
+		out = append(out, ownerWire...)
+		out = binary.BigEndian.AppendUint16(out, h.typeCovered)
+		out = binary.BigEndian.AppendUint16(out, classIN)
+		out = binary.BigEndian.AppendUint32(out, h.originalTTL)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(rd)))
+		out = append(out, rd...)
+	}
+	return out, nil
+}
+
+// SignZone returns records with the zone's DNSKEY records, an NSEC chain and
+// an RRSIG for every RRset added. Records outside the zone are rejected.
+// The DNSKEY and NSEC TTLs follow the SOA (TTL and minimum respectively).
+func (ks *KeySet) SignZone(records []cfg.DNSRecord, now time.Time, validity time.Duration) ([]cfg.DNSRecord, error) {
+	zone := ks.Zone
+	type rrKey struct{ name, qtype string }
+	sets := make(map[rrKey][]cfg.DNSRecord)
+	var order []rrKey
+	add := func(r cfg.DNSRecord) {
+		k := rrKey{normalize(r.QName), strings.ToUpper(r.QType)}
+		if _, seen := sets[k]; !seen {
+			order = append(order, k)
+		}
+		r.QName, r.QType = k.name, k.qtype
+		sets[k] = append(sets[k], r)
+	}
+
+	soaTTL, negTTL := 3600, 3600
+	for _, r := range records {
+		name := normalize(r.QName)
+		if name != zone && !strings.HasSuffix(name, "."+zone) {
+			return nil, fmt.Errorf("dnssec: %s is outside zone %s", r.QName, zone)
+		}
+		switch strings.ToUpper(r.QType) {
+		case "RRSIG", "NSEC", "DNSKEY":
+			continue // regenerated below
+		case "SOA":
+			if name == zone {
+				soaTTL = r.TTL
+				if f := strings.Fields(r.Content); len(f) == 7 {
+					if v, err := strconv.Atoi(f[6]); err == nil {
+						negTTL = v
+					}
+				}
+			}
+		}
+		add(r)
+	}
+	for _, r := range ks.DNSKEYs(soaTTL) {
+		add(r)
+	}
+
+	// NSEC chain over every owner name in canonical order.
+	typesByName := make(map[string][]string)
+	for _, k := range order {
+		typesByName[k.name] = append(typesByName[k.name], k.qtype)
+	}
+	names := make([]string, 0, len(typesByName))
+	for name := range typesByName {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return canonicalLess(names[i], names[j]) })
+	for i, name := range names {
+		next := names[(i+1)%len(names)]
+		types := append(append([]string(nil), typesByName[name]...), "RRSIG", "NSEC")
+		sort.Slice(types, func(a, b int) bool {
+			ca, _ := TypeCode(types[a])
+			cb, _ := TypeCode(types[b])
+			return ca < cb
+		})
+		add(cfg.DNSRecord{QName: name, QType: "NSEC", Content: next + ". " + strings.Join(types, " "), TTL: negTTL, Auth: true})
+	}
+
+	out := make([]cfg.DNSRecord, 0, 2*len(order))
+	for _, k := range order {
+		rrset := sets[k]
+		sig, err := ks.SignRRset(rrset, now, validity)
+		if err != nil {
+			return nil, fmt.Errorf("dnssec: signing %s/%s: %w", k.name, k.qtype, err)
+		}
+		out = append(out, rrset...)
+		out = append(out, sig)
+	}
+	return out, nil
+}
@@ -0,0 +1,216 @@
+package dnssec
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+// rfc6605Key is the example.net KSK of RFC 6605 section 6.1.
+func rfc6605Key(t *testing.T) *Key {
+	t.Helper()
+	d, err := base64.StdEncoding.DecodeString("GU6SnQ/Ou+xC5RumuIUIuJZteXT2z0O/ok1s38Et6mQ=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	priv.Curve = elliptic.P256()
+	priv.X, priv.Y = priv.Curve.ScalarBaseMult(d)
+	return &Key{Zone: "example.net", Flags: FlagsKSK, Algorithm: AlgorithmECDSAP256SHA256, priv: priv}
+}
+
+func TestKeyMatchesRFC6605(t *testing.T) {
+	k := rfc6605Key(t)
+	if got := k.DNSKEY(3600).Content; got != "257 3 13 GojIhhXUN/u4v54ZQqGSnyhWJwaubCvTmeexv7bR6edbkrSqQpF64cYbcB7wNcP+e+MAnLr+Wi9xMWyQLc8NAA==" {
+		t.Fatalf("unexpected DNSKEY %q", got)
+	}
+	if tag := k.KeyTag(); tag != 55648 {
+		t.Fatalf("expected key tag 55648, got %d", tag)
+	}
+	ds, err := k.DS(3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "55648 13 2 b4c8c1fe2e7477127b27115656ad6256f424625bf5c1e2770ce6d6e37df61d17"; ds.Content != want {
+		t.Fatalf("expected DS %q, got %q", want, ds.Content)
+	}
+}
+
+func testKeySet(t *testing.T) *KeySet {
+	t.Helper()
+	ks, err := LoadOrCreateKeys(t.TempDir(), "Example.NET.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestLoadOrCreateKeysPersists(t *testing.T) {
+	dir := t.TempDir()
+	first, err := LoadOrCreateKeys(dir, "example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadOrCreateKeys(dir, "example.net.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.KSK.KeyTag() != second.KSK.KeyTag() || first.ZSK.KeyTag() != second.ZSK.KeyTag() {
+		t.Fatal("expected the stored keys to be loaded again")
+	}
+	fi, err := os.Stat(filepath.Join(dir, "example.net.ksk.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected key file mode 0600, got %v", fi.Mode().Perm())
+	}
+	if _, err := LoadOrCreateKeys(dir, ""); err == nil {
+		t.Fatal("expected an error for an empty zone")
+	}
+}
+
+// verify checks sig against rrset with the public key of k.
+func verify(t *testing.T, k *Key, sig cfg.DNSRecord, rrset []cfg.DNSRecord) {
+	t.Helper()
+	f := strings.Fields(sig.Content)
+	if len(f) != 9 {
+		t.Fatalf("malformed RRSIG %q", sig.Content)
+	}
+	exp, _ := time.Parse(rrsigTimeLayout, f[4])
+	inc, _ := time.Parse(rrsigTimeLayout, f[5])
+	code, _ := TypeCode(f[0])
+	h := rrsigHeader{
+		qtype:       f[0],
+		typeCovered: code,
+		algorithm:   k.Algorithm,
+		labels:      uint8(labelCount(sig.QName)),
+		originalTTL: uint32(sig.TTL),
+		expiration:  uint32(exp.Unix()),
+		inception:   uint32(inc.Unix()),
+		keyTag:      k.KeyTag(),
+		signer:      k.Zone,
+	}
+	data, err := signedData(h, sig.QName, rrset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(f[8])
+	if err != nil || len(raw) != 64 {
+		t.Fatalf("bad signature field %q", f[8])
+	}
+	digest := sha256.Sum256(data)
+	r, s := new(big.Int).SetBytes(raw[:32]), new(big.Int).SetBytes(raw[32:])
+	if !ecdsa.Verify(&k.priv.PublicKey, digest[:], r, s) {
+		t.Fatalf("signature of %s/%s does not verify", sig.QName, f[0])
+	}
+}
+
+func TestSignRRset(t *testing.T) {
+	ks := testKeySet(t)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	rrset := []cfg.DNSRecord{
+		{QName: "www.example.net", QType: "A", Content: "192.0.2.2", TTL: 300},
+		{QName: "WWW.example.net.", QType: "a", Content: "192.0.2.1", TTL: 60},
+	}
+	sig, err := ks.SignRRset(rrset, now, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "A 13 3 60 20260116030405 20260102020405 "
+	if !strings.HasPrefix(sig.Content, want) {
+		t.Fatalf("expected RRSIG to start with %q, got %q", want, sig.Content)
+	}
+	verify(t, ks.ZSK, sig, rrset)
+
+	// Record order must not change what is signed.
+	data1, _ := signedData(rrsigHeader{qtype: "A", typeCovered: 1, labels: 3, signer: "example.net"}, "www.example.net", rrset)
+	data2, _ := signedData(rrsigHeader{qtype: "A", typeCovered: 1, labels: 3, signer: "example.net"}, "www.example.net", []cfg.DNSRecord{rrset[1], rrset[0]})
+	if string(data1) != string(data2) {
+		t.Fatal("expected canonical RR order in the signed data")
+	}
+
+	if _, err := ks.SignRRset([]cfg.DNSRecord{rrset[0], {QName: "www.example.net", QType: "AAAA", Content: "2001:db8::1"}}, now, 0); err != ErrMixedRRset {
+		t.Fatalf("expected ErrMixedRRset, got %v", err)
+	}
+
+	keys := ks.DNSKEYs(3600)
+	sig, err = ks.SignRRset(keys, now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify(t, ks.KSK, sig, keys)
+}
+
+func TestSignZone(t *testing.T) {
+	ks := testKeySet(t)
+	records := []cfg.DNSRecord{
+		{QName: "example.net", QType: "SOA", Content: "ns1.example.net. hostmaster.example.net. 2026010100 10800 3600 604800 300", TTL: 3600},
+		{QName: "example.net", QType: "NS", Content: "ns1.example.net.", TTL: 3600},
+		{QName: "ns1.example.net", QType: "A", Content: "192.0.2.53", TTL: 3600},
+		{QName: "*.example.net", QType: "TXT", Content: `"wild"`, TTL: 60},
+		{QName: "rpc.example.net", QType: "A", Content: "192.0.2.10", TTL: 60},
+		{QName: "rpc.example.net", QType: "AAAA", Content: "2001:db8::10", TTL: 60},
+	}
+	signed, err := ks.SignZone(records, time.Now(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nsec := make(map[string]string)
+	sigs := make(map[string]cfg.DNSRecord)
+	sets := make(map[string][]cfg.DNSRecord)
+	for _, r := range signed {
+		switch r.QType {
+		case "NSEC":
+			nsec[r.QName] = r.Content
+			if r.TTL != 300 {
+				t.Fatalf("expected NSEC TTL of the SOA minimum, got %d", r.TTL)
+			}
+		case "RRSIG":
+			sigs[r.QName+"/"+strings.Fields(r.Content)[0]] = r
+			continue
+		}
+		sets[r.QName+"/"+r.QType] = append(sets[r.QName+"/"+r.QType], r)
+	}
+
+	wantChain := map[string]string{
+		"example.net":     "*.example.net. NS SOA RRSIG NSEC DNSKEY",
+		"*.example.net":   "ns1.example.net. TXT RRSIG NSEC",
+		"ns1.example.net": "rpc.example.net. A RRSIG NSEC",
+		"rpc.example.net": "example.net. A AAAA RRSIG NSEC",
+	}
+	for name, want := range wantChain {
+		if nsec[name] != want {
+			t.Fatalf("expected NSEC %q at %s, got %q", want, name, nsec[name])
+		}
+	}
+
+	for key, rrset := range sets {
+		sig, ok := sigs[key]
+		if !ok {
+			t.Fatalf("expected an RRSIG for %s", key)
+		}
+		k := ks.ZSK
+		if rrset[0].QType == "DNSKEY" {
+			k = ks.KSK
+		}
+		verify(t, k, sig, rrset)
+	}
+	if f := strings.Fields(sigs["*.example.net/TXT"].Content); f[2] != "2" {
+		t.Fatalf("expected a wildcard RRSIG label count of 2, got %s", f[2])
+	}
+
+	if _, err := ks.SignZone([]cfg.DNSRecord{{QName: "example.org", QType: "A", Content: "192.0.2.1"}}, time.Now(), 0); err == nil {
+		t.Fatal("expected records outside the zone to be rejected")
+	}
+}
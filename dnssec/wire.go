@@ -0,0 +1,352 @@
+package dnssec
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Resource record type codes of the types that can be signed.
+var typeCodes = map[string]uint16{
+	"A":      1,
+	"NS":     2,
+	"CNAME":  5,
+	"SOA":    6,
+	"PTR":    12,
+	"MX":     15,
+	"TXT":    16,
+	"AAAA":   28,
+	"SRV":    33,
+	"DS":     43,
+	"RRSIG":  46,
+	"NSEC":   47,
+	"DNSKEY": 48,
+	"CAA":    257,
+}
+
+const classIN = 1
+
+// TypeCode returns the numeric code of a record type.
+func TypeCode(qtype string) (uint16, bool) {
+	code, ok := typeCodes[strings.ToUpper(qtype)]
+	return code, ok
+}
+
+// splitLabels splits a presentation-format name into labels, honouring
+// backslash escapes ("\." and "\DDD"). The root name has no labels.
+func splitLabels(name string) ([]string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." {
+		return nil, nil
+	}
+	var (
+		labels []string
+		cur    []byte
+	)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '\\':
+			if i+3 < len(name) && isDigit(name[i+1]) && isDigit(name[i+2]) && isDigit(name[i+3]) {
+				v, _ := strconv.Atoi(name[i+1 : i+4])
+				if v > 255 {
+					return nil, fmt.Errorf("bad escape in %q", name)
+				}
+				cur = append(cur, byte(v))
+				i += 3
+			} else if i+1 < len(name) {
+				cur = append(cur, name[i+1])
+				i++
+			} else {
+				return nil, fmt.Errorf("trailing backslash in %q", name)
+			}
+		case c == '.':
+			if len(cur) == 0 {
+				if i == len(name)-1 {
+					continue
+				}
+				return nil, fmt.Errorf("empty label in %q", name)
+			}
+			labels = append(labels, string(cur))
+			cur = nil
+		default:
+			cur = append(cur, c)
+		}
+	}
+	if len(cur) > 0 {
+		labels = append(labels, string(cur))
+	}
+	for _, l := range labels {
+		if len(l) > 63 {
+			return nil, fmt.Errorf("label too long in %q", name)
+		}
+	}
+	return labels, nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// nameWire encodes name as an absolute, lower-cased wire-format name, the
+// canonical form of RFC 4034 section 6.2.
+func nameWire(name string) ([]byte, error) {
+	labels, err := splitLabels(name)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, l := range labels {
+		out = append(out, byte(len(l)))
+		out = append(out, strings.ToLower(l)...)
+	}
+	out = append(out, 0)
+	if len(out) > 255 {
+		return nil, fmt.Errorf("name too long: %q", name)
+	}
+	return out, nil
+}
+
+// labelCount is the RRSIG labels field of owner: its labels without the
+// root and without a leading wildcard.
+func labelCount(owner string) int {
+	labels, _ := splitLabels(owner)
+	if len(labels) > 0 && labels[0] == "*" {
+		return len(labels) - 1
+	}
+	return len(labels)
+}
+
+// canonicalLess orders names as RFC 4034 section 6.1: label by label from
+// the right, lower-cased, as octet strings.
+func canonicalLess(a, b string) bool {
+	la, _ := splitLabels(a)
+	lb, _ := splitLabels(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		x, y := strings.ToLower(la[i]), strings.ToLower(lb[j])
+		if x != y {
+			return x < y
+		}
+	}
+	return len(la) < len(lb)
+}
+
+// rdataWire encodes the presentation-format content of a record.
+func rdataWire(qtype, content string) ([]byte, error) {
+	f := strings.Fields(content)
+	need := func(n int) error {
+		if len(f) < n {
+			return fmt.Errorf("%s content %q: expected %d fields", qtype, content, n)
+		}
+		return nil
+	}
+	u16 := func(s string) ([]byte, error) {
+		v, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint16(nil, uint16(v)), nil
+	}
+	u32 := func(s string) ([]byte, error) {
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint32(nil, uint32(v)), nil
+	}
+
+	switch strings.ToUpper(qtype) {
+	case "A", "AAAA":
+		addr, err := netip.ParseAddr(strings.TrimSpace(content))
+		if err != nil || addr.Is4() != (strings.ToUpper(qtype) == "A") {
+			return nil, fmt.Errorf("%s content %q is not a matching address", qtype, content)
+		}
+		return addr.AsSlice(), nil
+	case "NS", "CNAME", "PTR":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		return nameWire(f[0])
+	case "MX":
+		if err := need(2); err != nil {
+			return nil, err
+		}
+		pref, err := u16(f[0])
+		if err != nil {
+			return nil, err
+		}
+		n, err := nameWire(f[1])
+		return append(pref, n...), err
+	case "SRV":
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		var out []byte
+		for _, s := range f[:3] {
+			b, err := u16(s)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+		}
+		n, err := nameWire(f[3])
+		return append(out, n...), err
+	case "SOA":
+		if err := need(7); err != nil {
+			return nil, err
+		}
+		mname, err := nameWire(f[0])
+		if err != nil {
+			return nil, err
+		}
+		rname, err := nameWire(f[1])
+		if err != nil {
+			return nil, err
+		}
+		out := append(mname, rname...)
+		for _, s := range f[2:7] {
+			b, err := u32(s)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+		}
+		return out, nil
+	case "TXT":
+		var out []byte
+		for _, s := range txtStrings(content) {
+			for len(s) > 255 {
+				out = append(out, 255)
+				out = append(out, s[:255]...)
+				s = s[255:]
+			}
+			out = append(out, byte(len(s)))
+			out = append(out, s...)
+		}
+		return out, nil
+	case "CAA":
+		if err := need(3); err != nil {
+			return nil, err
+		}
+		flags, err := strconv.ParseUint(f[0], 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		value := strings.Trim(strings.Join(f[2:], " "), `"`)
+		out := []byte{byte(flags), byte(len(f[1]))}
+		out = append(out, f[1]...)
+		return append(out, value...), nil
+	case "DNSKEY":
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		flags, err := u16(f[0])
+		if err != nil {
+			return nil, err
+		}
+		proto, err1 := strconv.ParseUint(f[1], 10, 8)
+		alg, err2 := strconv.ParseUint(f[2], 10, 8)
+		key, err3 := base64.StdEncoding.DecodeString(strings.Join(f[3:], ""))
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("DNSKEY content %q is malformed", content)
+		}
+		return append(append(flags, byte(proto), byte(alg)), key...), nil
+	case "DS":
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		tag, err := u16(f[0])
+		if err != nil {
+			return nil, err
+		}
+		alg, err1 := strconv.ParseUint(f[1], 10, 8)
+		dt, err2 := strconv.ParseUint(f[2], 10, 8)
+		digest, err3 := hex.DecodeString(strings.Join(f[3:], ""))
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("DS content %q is malformed", content)
+		}
+		return append(append(tag, byte(alg), byte(dt)), digest...), nil
+	case "NSEC":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		next, err := nameWire(f[0])
+		if err != nil {
+			return nil, err
+		}
+		var codes []uint16
+		for _, t := range f[1:] {
+			code, ok := TypeCode(t)
+			if !ok {
+				return nil, fmt.Errorf("NSEC content %q: unknown type %s", content, t)
+			}
+			codes = append(codes, code)
+		}
+		return append(next, typeBitmap(codes)...), nil
+	}
+	return nil, fmt.Errorf("unsupported record type %s", qtype)
+}
+
+// txtStrings splits TXT content into its character-strings: quoted strings
+// are taken as they are, unquoted content is one string.
+func txtStrings(content string) []string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, `"`) {
+		return []string{content}
+	}
+	var (
+		out     []string
+		cur     []byte
+		inQuote bool
+	)
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '\\' && i+1 < len(content):
+			cur = append(cur, content[i+1])
+			i++
+		case c == '"':
+			if inQuote {
+				out = append(out, string(cur))
+				cur = nil
+			}
+			inQuote = !inQuote
+		case inQuote:
+			cur = append(cur, c)
+		}
+	}
+	return out
+}
+
+// typeBitmap encodes the NSEC type bit maps field (RFC 4034 section 4.1.2).
+func typeBitmap(codes []uint16) []byte {
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	var (
+		out    []byte
+		window = -1
+		bitmap []byte
+	)
+	flush := func() {
+		if window >= 0 {
+			out = append(out, byte(window), byte(len(bitmap)))
+			out = append(out, bitmap...)
+		}
+	}
+	for _, c := range codes {
+		w := int(c >> 8)
+		if w != window {
+			flush()
+			window, bitmap = w, nil
+		}
+		octet := int(c&0xff) / 8
+		for len(bitmap) <= octet {
+			bitmap = append(bitmap, 0)
+		}
+		bitmap[octet] |= 0x80 >> (c & 7)
+	}
+	flush()
+	return out
+}
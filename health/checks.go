@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+	"github.com/ibp-network/ibp-geodns-libs/nats"
+)
+
+// -----------------------------------------------------------------------------
+// STANDARD CHECKS
+// -----------------------------------------------------------------------------
+
+// NATS fails while the NATS connection is missing or not connected.
+func NATS() Check {
+	return Check{Name: "nats", Fn: func(context.Context) error {
+		conn := nats.GetConnection()
+		if conn == nil {
+			return errors.New("not connected")
+		}
+		if !conn.IsConnected() {
+			return fmt.Errorf("connection %s", strings.ToLower(conn.Status().String()))
+		}
+		return nil
+	}}
+}
+
+// MySQL fails while the database does not answer a ping.
+func MySQL() Check {
+	return Check{Name: "mysql", Fn: func(ctx context.Context) error {
+		if mysql.DB == nil {
+			return errors.New("not initialised")
+		}
+		return mysql.DB.PingContext(ctx)
+	}}
+}
+
+// MaxMind fails while a GeoIP database is not loaded.
+func MaxMind() Check {
+	return Check{Name: "maxmind", Fn: func(context.Context) error {
+		if missing := max.Missing(); len(missing) > 0 {
+			return fmt.Errorf("not loaded: %s", strings.Join(missing, ", "))
+		}
+		return nil
+	}}
+}
+
+// ConfigFresh fails when the remote configs have not all been downloaded
+// within maxAge; 0 allows three ConfigReloadTime intervals.
+func ConfigFresh(maxAge time.Duration) Check {
+	return Check{Name: "config", Fn: func(context.Context) error {
+		return checkConfigAge(cfg.LastRefresh(), time.Now(), maxAge, cfg.GetConfig().Local.System.ConfigReloadTime)
+	}}
+}
+
+func checkConfigAge(last, now time.Time, maxAge time.Duration, reloadSeconds int) error {
+	if maxAge <= 0 {
+		if reloadSeconds <= 0 {
+			reloadSeconds = 30
+		}
+		maxAge = 3 * time.Duration(reloadSeconds) * time.Second
+	}
+	if last.IsZero() {
+		return errors.New("never refreshed")
+	}
+	if age := now.Sub(last); age > maxAge {
+		return fmt.Errorf("last refreshed %s ago", age.Truncate(time.Second))
+	}
+	return nil
+}
+
+// CacheWritable fails when a file cannot be created in dir; an empty dir is
+// WorkDir/tmp, where the data caches live.
+func CacheWritable(dir string) Check {
+	return Check{Name: "cache", Fn: func(context.Context) error {
+		d := dir
+		if d == "" {
+			d = filepath.Join(cfg.GetConfig().Local.System.WorkDir, "tmp")
+		}
+		return checkWritable(d)
+	}}
+}
+
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".healthcheck-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	_, werr := f.Write([]byte("ok"))
+	cerr := f.Close()
+	os.Remove(name)
+	if werr != nil {
+		return werr
+	}
+	return cerr
+}
@@ -0,0 +1,214 @@
+// Package health aggregates the state of a daemon's subsystems into /healthz
+// (liveness) and /readyz (readiness) HTTP handlers that report every check
+// as JSON. Daemons register the checks of the subsystems they use, e.g.
+// NATS, MySQL, MaxMind, config freshness and cache writability.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+const (
+	// DefaultTimeout bounds a check without a Timeout of its own.
+	DefaultTimeout = 2 * time.Second
+
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check is one subsystem check. Fn returns nil while the subsystem is
+// healthy.
+type Check struct {
+	Name string
+	Fn   func(ctx context.Context) error
+
+	// Liveness checks also fail /healthz, which should make the
+	// supervisor restart the daemon; leave it unset for anything a restart
+	// cannot fix.
+	Liveness bool
+	// Optional checks are reported but never fail /readyz.
+	Optional bool
+	Timeout  time.Duration
+}
+
+// CheckResult is the outcome of one check.
+type CheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Liveness   bool   `json:"liveness,omitempty"`
+	Optional   bool   `json:"optional,omitempty"`
+}
+
+// Report is the JSON body of both handlers.
+type Report struct {
+	Status string                 `json:"status"`
+	Time   time.Time              `json:"time"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Registry holds the checks of a daemon.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+var defaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{checks: make(map[string]Check)}
+}
+
+// Default returns the registry used by the package-level functions.
+func Default() *Registry { return defaultRegistry }
+
+// Register adds c to the default registry.
+func Register(c Check) { defaultRegistry.Register(c) }
+
+// Unregister removes the check name from the default registry.
+func Unregister(name string) { defaultRegistry.Unregister(name) }
+
+// Mount serves the default registry on mux under /healthz and /readyz.
+func Mount(mux *http.ServeMux) { defaultRegistry.Mount(mux) }
+
+// Register adds c, replacing a check of the same name.
+func (r *Registry) Register(c Check) {
+	if c.Name == "" || c.Fn == nil {
+		return
+	}
+	r.mu.Lock()
+	r.checks[c.Name] = c
+	r.mu.Unlock()
+}
+
+// Unregister removes the check name.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	delete(r.checks, name)
+	r.mu.Unlock()
+}
+
+// Names returns the registered check names in order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]string, 0, len(r.checks))
+	for name := range r.checks {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Run runs every check concurrently. The report fails if a liveness check
+// fails or, for readiness, if any check that is not optional fails.
+func (r *Registry) Run(ctx context.Context, readiness bool) Report {
+	r.mu.RLock()
+	checks := make([]Check, 0, len(r.checks))
+	for _, c := range r.checks {
+		checks = append(checks, c)
+	}
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	rep := Report{Status: StatusOK, Time: time.Now().UTC(), Checks: make(map[string]CheckResult, len(checks))}
+	for i, c := range checks {
+		res := results[i]
+		rep.Checks[c.Name] = res
+		if res.Status == StatusOK {
+			continue
+		}
+		if c.Liveness || (readiness && !c.Optional) {
+			rep.Status = StatusFail
+		}
+	}
+	return rep
+}
+
+func runCheck(ctx context.Context, c Check) CheckResult {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				log.Log(log.Error, "[health] check %s panicked: %v", c.Name, p)
+				done <- errors.New("check panicked")
+			}
+		}()
+		done <- c.Fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	res := CheckResult{Status: StatusOK, DurationMs: time.Since(start).Milliseconds(), Liveness: c.Liveness, Optional: c.Optional}
+	if err != nil {
+		res.Status, res.Error = StatusFail, err.Error()
+	}
+	return res
+}
+
+// LivenessHandler serves /healthz: 503 only when a liveness check fails.
+func (r *Registry) LivenessHandler() http.Handler {
+	return r.handler(false)
+}
+
+// ReadinessHandler serves /readyz: 503 when any check that is not optional
+// fails.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return r.handler(true)
+}
+
+// Mount serves r on mux under /healthz and /readyz.
+func (r *Registry) Mount(mux *http.ServeMux) {
+	mux.Handle("/healthz", r.LivenessHandler())
+	mux.Handle("/readyz", r.ReadinessHandler())
+}
+
+func (r *Registry) handler(readiness bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rep := r.Run(req.Context(), readiness)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if rep.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if req.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(rep)
+		}
+	})
+}
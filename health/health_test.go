@@ -0,0 +1,131 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func okCheck(name string) Check {
+	return Check{Name: name, Fn: func(context.Context) error { return nil }}
+}
+
+func failCheck(name string) Check {
+	return Check{Name: name, Fn: func(context.Context) error { return errors.New("down") }}
+}
+
+func serve(t *testing.T, h http.Handler) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var rep Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	return rec.Code, rep
+}
+
+func TestReadinessAndLiveness(t *testing.T) {
+	r := NewRegistry()
+	r.Register(okCheck("nats"))
+	r.Register(failCheck("mysql"))
+	opt := failCheck("maxmind")
+	opt.Optional = true
+	r.Register(opt)
+
+	code, rep := serve(t, r.ReadinessHandler())
+	if code != http.StatusServiceUnavailable || rep.Status != StatusFail {
+		t.Fatalf("expected readiness to fail, got %d %s", code, rep.Status)
+	}
+	if got := rep.Checks["mysql"]; got.Status != StatusFail || got.Error != "down" {
+		t.Fatalf("expected mysql detail to report the error, got %+v", got)
+	}
+	if rep.Checks["nats"].Status != StatusOK {
+		t.Fatalf("expected nats ok, got %+v", rep.Checks["nats"])
+	}
+
+	code, rep = serve(t, r.LivenessHandler())
+	if code != http.StatusOK || rep.Status != StatusOK || len(rep.Checks) != 3 {
+		t.Fatalf("expected liveness to pass with all details, got %d %+v", code, rep)
+	}
+
+	r.Unregister("mysql")
+	if code, _ := serve(t, r.ReadinessHandler()); code != http.StatusOK {
+		t.Fatalf("expected an optional failure not to fail readiness, got %d", code)
+	}
+
+	live := failCheck("cache")
+	live.Liveness = true
+	r.Register(live)
+	if code, _ := serve(t, r.LivenessHandler()); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a failing liveness check to fail /healthz, got %d", code)
+	}
+}
+
+func TestRunCheckTimeoutAndPanic(t *testing.T) {
+	r := NewRegistry()
+	r.Register(Check{Name: "slow", Timeout: 10 * time.Millisecond, Fn: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}})
+	r.Register(Check{Name: "panics", Fn: func(context.Context) error { panic("boom") }})
+
+	rep := r.Run(context.Background(), true)
+	if got := rep.Checks["slow"]; got.Status != StatusFail || got.Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("expected the slow check to time out, got %+v", got)
+	}
+	if got := rep.Checks["panics"]; got.Status != StatusFail {
+		t.Fatalf("expected a panicking check to fail, got %+v", got)
+	}
+}
+
+func TestHandlerMethods(t *testing.T) {
+	h := NewRegistry().ReadinessHandler()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/readyz", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for POST, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/readyz", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("expected an empty 200 for HEAD, got %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+}
+
+func TestCheckConfigAge(t *testing.T) {
+	now := time.Now()
+	if err := checkConfigAge(time.Time{}, now, 0, 60); err == nil {
+		t.Fatal("expected a config that never refreshed to fail")
+	}
+	if err := checkConfigAge(now.Add(-2*time.Minute), now, 0, 60); err != nil {
+		t.Fatalf("expected two reload intervals to pass, got %v", err)
+	}
+	if err := checkConfigAge(now.Add(-4*time.Minute), now, 0, 60); err == nil {
+		t.Fatal("expected four reload intervals to fail")
+	}
+	if err := checkConfigAge(now.Add(-4*time.Minute), now, time.Hour, 60); err != nil {
+		t.Fatalf("expected an explicit max age to win, got %v", err)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tmp")
+	if err := checkWritable(dir); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected the probe file to be removed, found %d entries", len(entries))
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0644)
+	if err := checkWritable(file); err == nil {
+		t.Fatal("expected a file path to fail")
+	}
+}
@@ -0,0 +1,50 @@
+// Package clientprefix masks client addresses to the network they are
+// counted, pinned and logged by. It is the one place the prefix rules live:
+// maxmind exposes them as GetClientPrefix, and querylog, which maxmind's
+// config dependency keeps from importing maxmind, uses them directly.
+package clientprefix
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// Default prefix lengths.
+const (
+	DefaultV4 = 24
+	DefaultV6 = 48
+)
+
+// Of returns the network of ip masked to v4Bits for IPv4 (including
+// IPv4-mapped IPv6) and v6Bits for IPv6. A length of 0 or less selects the
+// default and one beyond the address size is capped. ok is false when ip
+// does not parse.
+func Of(ip string, v4Bits, v6Bits int) (p netip.Prefix, ok bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap().WithZone("")
+
+	bits := v6Bits
+	if bits <= 0 {
+		bits = DefaultV6
+	}
+	if addr.Is4() {
+		bits = v4Bits
+		if bits <= 0 {
+			bits = DefaultV4
+		}
+	}
+	p, err = addr.Prefix(min(bits, addr.BitLen()))
+	return p, err == nil
+}
+
+// String returns Of in CIDR notation, e.g. "192.0.2.0/24", or "".
+func String(ip string, v4Bits, v6Bits int) string {
+	p, ok := Of(ip, v4Bits, v6Bits)
+	if !ok {
+		return ""
+	}
+	return p.String()
+}
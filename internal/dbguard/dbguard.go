@@ -0,0 +1,231 @@
+// Package dbguard is the resilience layer around MySQL writes shared by data
+// and data2. Do retries a write a few times when it fails with a transient
+// error (a dropped connection, a deadlock, a lock wait timeout) and feeds the
+// outcome to a circuit breaker. Once enough writes in a row fail that way
+// the breaker opens: writes fail fast with ErrOpen, and the callers shed
+// them to a Spool on local disk instead of blocking their hot path on a
+// database that is not there. After a cooldown one write is let through as
+// a probe; when it succeeds the breaker closes and the OnClose hooks run so
+// the callers can replay their spools.
+package dbguard
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrOpen is returned by Do while the breaker is open.
+var ErrOpen = errors.New("mysql circuit breaker open")
+
+// MySQL errors worth another try: too many connections, server shutdown,
+// lock wait timeout, deadlock and connection killed.
+var transientCodes = map[uint16]bool{1040: true, 1053: true, 1205: true, 1213: true, 1927: true}
+
+// IsTransient reports whether err is a failure another attempt may well not hit:
+// the connection went away or the server rolled the statement back. Errors
+// in the statement or the data are not.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return transientCodes[myErr.Number]
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// MySQL errors after which the server has rolled the statement back or
+// never ran it: too many connections, lock wait timeout and deadlock.
+var notRunCodes = map[uint16]bool{1040: true, 1205: true, 1213: true}
+
+// NotSent reports whether err shows the write never took effect: the
+// connection failed before the statement went out, or the server rolled it
+// back. A lost connection or timeout mid-statement is transient but not
+// NotSent, since the server may have committed before the reply was lost.
+func NotSent(err error) bool {
+	if err == nil {
+		return false
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return notRunCodes[myErr.Number]
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone)
+}
+
+// Policy bounds the retries of one write.
+type Policy struct {
+	Attempts int                       // tries in total, at least one
+	Delay    func(n int) time.Duration // wait before retry n (1-based)
+	// Retry reports whether a failed try may be repeated; nil means
+	// IsTransient. Writes that are not idempotent use NotSent.
+	Retry func(err error) bool
+}
+
+// DefaultPolicy suits writes on a request path: three tries within 300ms.
+var DefaultPolicy = Policy{
+	Attempts: 3,
+	Delay:    func(n int) time.Duration { return 100 * time.Millisecond << (n - 1) },
+}
+
+// State is the state of a Breaker.
+type State int
+
+const (
+	Closed   State = iota // writes go through
+	Open                  // writes fail fast with ErrOpen
+	HalfOpen              // one probe write is in flight
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// Breaker is a circuit breaker for one database.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	onClose  []func()
+}
+
+// NewBreaker returns a closed breaker that opens after threshold transient
+// failures in a row and probes again after cooldown.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// MySQL guards the MySQL database data and data2 share.
+var MySQL = NewBreaker(5, 30*time.Second)
+
+var (
+	now   = time.Now
+	sleep = time.Sleep
+)
+
+// OnClose adds fn to the hooks run, each on its own goroutine, whenever the
+// breaker closes after being open.
+func (b *Breaker) OnClose(fn func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onClose = append(b.onClose, fn)
+}
+
+// State returns the breaker's current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow reports whether a write may go ahead, turning an open breaker past
+// its cooldown into a half-open one whose caller is the probe.
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Closed:
+		return true
+	case Open:
+		if now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = HalfOpen
+		return true
+	}
+	return false // a probe is already in flight
+}
+
+// record feeds the outcome of a write to the breaker. Only transient errors
+// count as failures; any other outcome means the database answered.
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	var hooks []func()
+	if IsTransient(err) {
+		b.failures++
+		if b.state == HalfOpen || b.failures >= b.threshold {
+			b.state = Open
+			b.openedAt = now()
+		}
+	} else {
+		if b.state != Closed {
+			hooks = append(hooks, b.onClose...)
+		}
+		b.state = Closed
+		b.failures = 0
+	}
+	b.mu.Unlock()
+
+	for _, fn := range hooks {
+		go fn()
+	}
+}
+
+// Reset closes the breaker and forgets past failures.
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = Closed
+	b.failures = 0
+}
+
+// Do runs fn, retrying it under p while it fails with an error p.Retry
+// accepts (by default a transient one). It returns ErrOpen without calling fn while the breaker is open, and
+// stops retrying as soon as the breaker opens.
+func (b *Breaker) Do(p Policy, fn func() error) error {
+	attempts := max(p.Attempts, 1)
+	retry := p.Retry
+	if retry == nil {
+		retry = IsTransient
+	}
+	var err error
+	for n := 0; n < attempts; n++ {
+		if n > 0 && p.Delay != nil {
+			sleep(p.Delay(n))
+		}
+		if !b.allow() {
+			if err != nil {
+				return errors.Join(ErrOpen, err)
+			}
+			return ErrOpen
+		}
+		err = fn()
+		b.record(err)
+		if !retry(err) {
+			return err
+		}
+	}
+	return err
+}
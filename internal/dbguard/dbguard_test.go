@@ -0,0 +1,189 @@
+package dbguard
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestIsTransient(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{driver.ErrBadConn, true},
+		{fmt.Errorf("exec: %w", mysql.ErrInvalidConn), true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, true},
+		{&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, true},
+		{&mysql.MySQLError{Number: 1406, Message: "Data too long"}, false},
+		{errors.New("syntax error"), false},
+	}
+	for _, c := range cases {
+		if got := IsTransient(c.err); got != c.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestDoRetriesTransientErrorsOnly(t *testing.T) {
+	prev := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = prev }()
+
+	b := NewBreaker(10, time.Minute)
+	policy := Policy{Attempts: 3, Delay: func(int) time.Duration { return time.Second }}
+
+	calls := 0
+	err := b.Do(policy, func() error {
+		calls++
+		if calls < 3 {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("transient: err=%v calls=%d", err, calls)
+	}
+
+	calls = 0
+	bad := &mysql.MySQLError{Number: 1406}
+	if err := b.Do(policy, func() error { calls++; return bad }); !errors.Is(err, bad) || calls != 1 {
+		t.Fatalf("permanent: err=%v calls=%d", err, calls)
+	}
+}
+
+func TestNotSent(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{driver.ErrBadConn, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, true},
+		{&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, true},
+		{fmt.Errorf("exec: %w", mysql.ErrInvalidConn), false},
+		{&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, false},
+		{io.ErrUnexpectedEOF, false},
+		{&mysql.MySQLError{Number: 1927, Message: "Connection was killed"}, false},
+	}
+	for _, c := range cases {
+		if got := NotSent(c.err); got != c.want {
+			t.Errorf("NotSent(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestDoRetriesOnlyWhatPolicyAccepts(t *testing.T) {
+	prev := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = prev }()
+
+	b := NewBreaker(10, time.Minute)
+	policy := Policy{Attempts: 3, Retry: NotSent}
+
+	calls := 0
+	if err := b.Do(policy, func() error { calls++; return io.ErrUnexpectedEOF }); calls != 1 || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("maybe sent: err=%v calls=%d", err, calls)
+	}
+	calls = 0
+	if err := b.Do(policy, func() error { calls++; return driver.ErrBadConn }); calls != 3 || err == nil {
+		t.Fatalf("not sent: err=%v calls=%d", err, calls)
+	}
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	prevNow := now
+	clock := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = prevNow }()
+
+	b := NewBreaker(2, 30*time.Second)
+	closed := make(chan struct{}, 1)
+	b.OnClose(func() { closed <- struct{}{} })
+
+	calls := 0
+	down := func() error { calls++; return driver.ErrBadConn }
+	once := Policy{Attempts: 1}
+
+	_ = b.Do(once, down)
+	_ = b.Do(once, down)
+	if b.State() != Open {
+		t.Fatalf("state %v after two failures", b.State())
+	}
+	if err := b.Do(once, down); !errors.Is(err, ErrOpen) || calls != 2 {
+		t.Fatalf("open breaker: err=%v calls=%d", err, calls)
+	}
+
+	// A failed probe opens it again for another cooldown.
+	clock = clock.Add(31 * time.Second)
+	_ = b.Do(once, down)
+	if b.State() != Open || calls != 3 {
+		t.Fatalf("failed probe: state %v calls %d", b.State(), calls)
+	}
+
+	clock = clock.Add(31 * time.Second)
+	if err := b.Do(once, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if b.State() != Closed {
+		t.Fatalf("state %v after a good probe", b.State())
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("OnClose hook did not run")
+	}
+}
+
+func TestSpoolDrainsInOrderAndKeepsTheRest(t *testing.T) {
+	dir := t.TempDir()
+	s := &Spool{Dir: func() string { return dir }}
+	if err := s.Append(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(3); err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 3 {
+		t.Fatalf("Len = %d", s.Len())
+	}
+
+	var got []int
+	stop := errors.New("down again")
+	n, err := s.Drain(func(line json.RawMessage) error {
+		var v int
+		_ = json.Unmarshal(line, &v)
+		if v == 2 {
+			return stop
+		}
+		got = append(got, v)
+		return nil
+	})
+	if !errors.Is(err, stop) || n != 1 || s.Len() != 2 {
+		t.Fatalf("partial drain: n=%d err=%v len=%d", n, err, s.Len())
+	}
+
+	n, err = s.Drain(func(line json.RawMessage) error {
+		var v int
+		_ = json.Unmarshal(line, &v)
+		got = append(got, v)
+		return nil
+	})
+	if err != nil || n != 2 || s.Len() != 0 {
+		t.Fatalf("full drain: n=%d err=%v len=%d", n, err, s.Len())
+	}
+	if fmt.Sprint(got) != "[1 2 3]" {
+		t.Fatalf("drained %v", got)
+	}
+}
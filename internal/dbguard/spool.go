@@ -0,0 +1,167 @@
+package dbguard
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Spool keeps writes shed while the database is unreachable, one JSON value
+// per line in files under Dir, until Drain replays them in order. Past
+// MaxFiles the oldest files are dropped.
+type Spool struct {
+	Dir      func() string
+	MaxFiles int
+
+	mu  sync.Mutex
+	seq int // orders files appended within one clock tick
+}
+
+// Append writes vs to a new spool file.
+func (s *Spool) Append(vs ...any) error {
+	if len(vs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := s.Dir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create spool dir: %w", err)
+	}
+	lines := make([]json.RawMessage, 0, len(vs))
+	for _, v := range vs {
+		line, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("marshal spooled write: %w", err)
+		}
+		lines = append(lines, line)
+	}
+	s.seq++
+	name := fmt.Sprintf("%s-%06d.jsonl", now().UTC().Format("20060102T150405.000000000"), s.seq%1000000)
+	path := filepath.Join(dir, name)
+	if err := writeSpool(path, lines); err != nil {
+		return err
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	for s.MaxFiles > 0 && len(files) > s.MaxFiles {
+		_ = os.Remove(files[0])
+		files = files[1:]
+	}
+	return nil
+}
+
+// Drain passes the spooled values, oldest first, to apply and removes each
+// file once all its values are applied. It stops at the first error,
+// keeping the values not yet applied, and returns how many it applied.
+func (s *Spool) Drain(apply func(json.RawMessage) error) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+	applied := 0
+	for _, path := range files {
+		lines, err := readSpool(path)
+		if err != nil {
+			_ = os.Remove(path)
+			return applied, fmt.Errorf("dropped unreadable spool %s: %w", path, err)
+		}
+		for i, line := range lines {
+			if err := apply(line); err != nil {
+				if werr := writeSpool(path, lines[i:]); werr != nil {
+					return applied, fmt.Errorf("rewrite spool %s: %w", path, werr)
+				}
+				return applied, err
+			}
+			applied++
+		}
+		_ = os.Remove(path)
+	}
+	return applied, nil
+}
+
+// Len returns the number of spooled values.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, _ := s.files()
+	n := 0
+	for _, path := range files {
+		lines, _ := readSpool(path)
+		n += len(lines)
+	}
+	return n
+}
+
+func (s *Spool) files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir(), "*.jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("list spool files: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// writeSpool replaces path with lines.
+func writeSpool(path string, lines []json.RawMessage) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".spool.*")
+	if err != nil {
+		return fmt.Errorf("create spool: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	for _, line := range lines {
+		if _, err = w.Write(line); err != nil {
+			break
+		}
+		if err = w.WriteByte('\n'); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write spool: %w", err)
+	}
+	return nil
+}
+
+func readSpool(path string) ([]json.RawMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []json.RawMessage
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var line json.RawMessage
+		if err := dec.Decode(&line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
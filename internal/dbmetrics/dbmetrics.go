@@ -0,0 +1,290 @@
+// Package dbmetrics times every MySQL call of data and data2. Open wraps the
+// driver so each query and statement execution records its duration in the
+// mysql_query_duration_seconds histogram, by query name, and queries slower
+// than Mysql.SlowQueryMs are logged with their arguments redacted to their
+// types.
+//
+// A query is named after its verb and first table ("insert requests",
+// "select member_events"), which keeps the label set small however the
+// statement text varies.
+package dbmetrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/metrics"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	defaultSlowQuery = time.Second
+	reloadHook       = "dbmetrics.slowQuery"
+)
+
+var (
+	queryDuration = metrics.NewHistogramVec("mysql_query_duration_seconds",
+		"Duration of MySQL queries by query name.", "query", nil)
+	slowQueries = metrics.NewCounterVec("mysql_slow_queries_total",
+		"MySQL queries slower than Mysql.SlowQueryMs by query name.", "query")
+	queryErrors = metrics.NewCounterVec("mysql_query_errors_total",
+		"Failed MySQL queries by query name.", "query")
+
+	slowQuery atomic.Int64 // threshold in nanoseconds; <= 0 is off
+	hookOnce  sync.Once
+
+	now = time.Now
+)
+
+func loadSlowQuery() {
+	ms := cfg.GetConfig().Local.Mysql.SlowQueryMs
+	switch {
+	case ms == 0:
+		slowQuery.Store(int64(defaultSlowQuery))
+	case ms < 0:
+		slowQuery.Store(0)
+	default:
+		slowQuery.Store(int64(time.Duration(ms) * time.Millisecond))
+	}
+}
+
+// Open opens dsn with the MySQL driver, instrumented.
+func Open(dsn string) (*sql.DB, error) {
+	c, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse MySQL DSN: %w", err)
+	}
+	conn, err := mysql.NewConnector(c)
+	if err != nil {
+		return nil, err
+	}
+	hookOnce.Do(func() {
+		loadSlowQuery()
+		cfg.RegisterReloadHook(reloadHook, loadSlowQuery)
+	})
+	return sql.OpenDB(Wrap(conn)), nil
+}
+
+// Wrap instruments the connections of c.
+func Wrap(c driver.Connector) driver.Connector { return connector{c} }
+
+var (
+	nameRe  = regexp.MustCompile(`(?is)^\s*(?:/\*.*?\*/\s*)?(\w+)`)
+	tableRe = regexp.MustCompile("(?i)\\b(?:from|into|update|table|join)\\s+`?(\\w+)")
+	spaceRe = regexp.MustCompile(`\s+`)
+)
+
+// QueryName names query after its verb and first table.
+func QueryName(query string) string {
+	m := nameRe.FindStringSubmatch(query)
+	if m == nil {
+		return "other"
+	}
+	verb := strings.ToLower(m[1])
+	if verb == "update" {
+		// The table follows the verb itself.
+		if t := tableRe.FindStringSubmatch(query); t != nil {
+			return verb + " " + strings.ToLower(t[1])
+		}
+		return verb
+	}
+	if t := tableRe.FindStringSubmatch(query[len(m[0]):]); t != nil {
+		return verb + " " + strings.ToLower(t[1])
+	}
+	return verb
+}
+
+// redact describes args by type only.
+func redact(args []driver.NamedValue) string {
+	types := make([]string, len(args))
+	for i, a := range args {
+		if a.Value == nil {
+			types[i] = "NULL"
+			continue
+		}
+		types[i] = fmt.Sprintf("%T", a.Value)
+	}
+	return "[" + strings.Join(types, " ") + "]"
+}
+
+// observe records one call of query that started at start.
+func observe(query string, args []driver.NamedValue, start time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		return // database/sql retries it as a prepared statement
+	}
+	d := now().Sub(start)
+	name := QueryName(query)
+	queryDuration.Observe(name, d.Seconds())
+	if err != nil {
+		queryErrors.Inc(name)
+	}
+	if limit := time.Duration(slowQuery.Load()); limit > 0 && d >= limit {
+		slowQueries.Inc(name)
+		log.Log(log.Warn, "[mysql] slow query %q took %s: %s args=%s",
+			name, d.Round(time.Millisecond), strings.TrimSpace(spaceRe.ReplaceAllString(query, " ")), redact(args))
+	}
+}
+
+// -----------------------------------------------------------------------------
+// DRIVER WRAPPERS
+// -----------------------------------------------------------------------------
+//
+// The wrappers time ExecContext and QueryContext of connections and
+// statements and pass everything else through, answering for an optional
+// interface the wrapped value lacks the way database/sql would without it.
+
+type connector struct{ driver.Connector }
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	cn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{cn}, nil
+}
+
+type conn struct{ driver.Conn }
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		st  driver.Stmt
+		err error
+	)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		st, err = p.PrepareContext(ctx, query)
+	} else {
+		st, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: st, conn: c.Conn, query: query}, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := now()
+	res, err := e.ExecContext(ctx, query, args)
+	observe(query, args, start, err)
+	return res, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := now()
+	rows, err := q.QueryContext(ctx, query, args)
+	observe(query, args, start, err)
+	return rows, err
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if ch, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type stmt struct {
+	driver.Stmt
+	conn  driver.Conn
+	query string
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := now()
+	var (
+		res driver.Result
+		err error
+	)
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else {
+		res, err = s.Stmt.Exec(values(args))
+	}
+	observe(s.query, args, start, err)
+	return res, err
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := now()
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(values(args))
+	}
+	observe(s.query, args, start, err)
+	return rows, err
+}
+
+// CheckNamedValue asks the statement, then its connection, as database/sql
+// would have.
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if ch, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	if ch, ok := s.conn.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	out := make([]driver.Value, len(args))
+	for i, a := range args {
+		out[i] = a.Value
+	}
+	return out
+}
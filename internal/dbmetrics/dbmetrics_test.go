@@ -0,0 +1,85 @@
+package dbmetrics
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestQueryName(t *testing.T) {
+	cases := map[string]string{
+		"SELECT id FROM member_events WHERE proposal_id = ? FOR UPDATE": "select member_events",
+		"\n\tINSERT INTO requests (date) VALUES (?)":                    "insert requests",
+		"UPDATE member_events SET end_time = ? WHERE id = ?":            "update member_events",
+		"DELETE FROM `requests` WHERE date < ?":                         "delete requests",
+		"SELECT MAX(end_time) FROM member_events WHERE x = ?":           "select member_events",
+		"/* flush */ REPLACE INTO usage_rollups VALUES (?)":             "replace usage_rollups",
+		"SELECT 1": "select",
+		"":         "other",
+	}
+	for q, want := range cases {
+		if got := QueryName(q); got != want {
+			t.Errorf("QueryName(%q) = %q, want %q", q, got, want)
+		}
+	}
+}
+
+func TestRedactKeepsOnlyTypes(t *testing.T) {
+	got := redact([]driver.NamedValue{{Value: "203.0.113.7"}, {Value: int64(3)}, {Value: nil}})
+	if got != "[string int64 NULL]" {
+		t.Fatalf("redact = %s", got)
+	}
+}
+
+// fakeConn answers every statement at once; the clock makes it slow.
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return fakeStmt{}, nil }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error                               { return nil }
+func (fakeStmt) NumInput() int                              { return -1 }
+func (fakeStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (fakeStmt) Query([]driver.Value) (driver.Rows, error)  { return nil, driver.ErrSkip }
+
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return nil }
+
+func TestExecsAreTimedAndSlowOnesCounted(t *testing.T) {
+	prevNow, prevSlow := now, slowQuery.Load()
+	defer func() { now = prevNow; slowQuery.Store(prevSlow) }()
+
+	clock := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	step := 10 * time.Millisecond
+	now = func() time.Time { clock = clock.Add(step); return clock }
+	slowQuery.Store(int64(time.Second))
+
+	db := sql.OpenDB(Wrap(fakeConnector{}))
+	defer db.Close()
+
+	const name = "insert dbmetrics_test"
+	before := queryDuration.Snapshot(name).Count
+	slowBefore := slowQueries.Value(name)
+
+	if _, err := db.Exec("INSERT INTO dbmetrics_test VALUES (?)", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	step = 2 * time.Second
+	if _, err := db.Exec("INSERT INTO dbmetrics_test VALUES (?)", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := queryDuration.Snapshot(name).Count - before; n != 2 {
+		t.Fatalf("timed %d execs, want 2", n)
+	}
+	if n := slowQueries.Value(name) - slowBefore; n != 1 {
+		t.Fatalf("counted %v slow queries, want 1", n)
+	}
+}
@@ -0,0 +1,37 @@
+// Package errdefs holds the sentinel errors shared by nats, data and data2.
+// Each of those packages re-exports them, so callers test with errors.Is
+// against whichever package they already import:
+//
+//	if errors.Is(err, nats.ErrNoActiveNodes) { ... }
+//
+// Errors are wrapped with %w and the context of the failing call, never
+// returned bare or compared by string.
+package errdefs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNoActiveNodes is returned when a request has no node of the
+	// required role to ask.
+	ErrNoActiveNodes = errors.New("no active nodes")
+	// ErrTimeout is returned when a request got no reply in time.
+	ErrTimeout = errors.New("timeout")
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidDateRange is returned for a malformed date or a range that
+	// ends before it starts.
+	ErrInvalidDateRange = errors.New("invalid date range")
+)
+
+// CheckRange returns ErrInvalidDateRange when end is before start.
+func CheckRange(start, end time.Time) error {
+	if end.Before(start) {
+		return fmt.Errorf("%w: %s is before %s", ErrInvalidDateRange,
+			end.UTC().Format(time.RFC3339), start.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
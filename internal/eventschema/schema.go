@@ -0,0 +1,196 @@
+// Package eventschema keeps the member_events constraints that the event
+// store relies on: a generated open_marker column, set only on open offline
+// events, and a unique index over the check key and that marker, so MySQL
+// rejects a second open event for the same check; and the proposal_id
+// column with its unique index, so collators store each finalized proposal
+// once.
+package eventschema
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+const (
+	OpenIndexName    = "uniq_open_event"
+	OpenMarkerColumn = "open_marker"
+
+	ProposalIndexName = "uniq_proposal"
+	ProposalColumn    = "proposal_id"
+)
+
+var expectedOpenIndexColumns = []string{
+	"check_type",
+	"check_name",
+	"member_name",
+	"domain_name",
+	"endpoint",
+	"is_ipv6",
+	OpenMarkerColumn,
+}
+
+func ExpectedOpenIndexColumns() []string {
+	out := make([]string, len(expectedOpenIndexColumns))
+	copy(out, expectedOpenIndexColumns)
+	return out
+}
+
+func HasExpectedOpenIndex(columns []string) bool {
+	if len(columns) != len(expectedOpenIndexColumns) {
+		return false
+	}
+
+	for i := range columns {
+		if columns[i] != expectedOpenIndexColumns[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasOpenMarker(db *sql.DB) (bool, error) {
+	return hasColumn(db, OpenMarkerColumn)
+}
+
+func hasColumn(db *sql.DB, column string) (bool, error) {
+	var n int
+	err := db.QueryRow(`
+SELECT COUNT(*)
+FROM information_schema.COLUMNS
+WHERE TABLE_SCHEMA = DATABASE()
+  AND TABLE_NAME = 'member_events'
+  AND COLUMN_NAME = ?
+`, column).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("query member_events column metadata: %w", err)
+	}
+	return n > 0, nil
+}
+
+func CurrentOpenIndexColumns(db *sql.DB) ([]string, error) {
+	return indexColumns(db, OpenIndexName)
+}
+
+func indexColumns(db *sql.DB, index string) ([]string, error) {
+	rows, err := db.Query(`
+SELECT COLUMN_NAME
+FROM information_schema.STATISTICS
+WHERE TABLE_SCHEMA = DATABASE()
+  AND TABLE_NAME = 'member_events'
+  AND INDEX_NAME = ?
+ORDER BY SEQ_IN_INDEX
+`, index)
+	if err != nil {
+		return nil, fmt.Errorf("query member_events index metadata: %w", err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, fmt.Errorf("scan member_events index metadata: %w", err)
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate member_events index metadata: %w", err)
+	}
+
+	return columns, nil
+}
+
+// EnsureOpenEventIndex adds the open_marker column and the unique index when
+// they are missing. It fails when the table already holds two open events
+// for one check; those must be closed before the index can be built.
+func EnsureOpenEventIndex(db *sql.DB) error {
+	if db == nil {
+		return fmt.Errorf("nil DB")
+	}
+
+	hasMarker, err := hasOpenMarker(db)
+	if err != nil {
+		return err
+	}
+	if !hasMarker {
+		ddl := `
+ALTER TABLE member_events
+ADD COLUMN open_marker TINYINT
+  AS (IF(status = 0 AND end_time IS NULL, 1, NULL)) VIRTUAL`
+		if _, err := db.Exec(ddl); err != nil {
+			return fmt.Errorf("add member_events open marker: %w", err)
+		}
+	}
+
+	columns, err := CurrentOpenIndexColumns(db)
+	if err != nil {
+		return err
+	}
+	if HasExpectedOpenIndex(columns) {
+		return nil
+	}
+
+	ddl := `
+ALTER TABLE member_events
+`
+	if len(columns) > 0 {
+		ddl += "DROP INDEX " + OpenIndexName + ",\n"
+	}
+	ddl += `
+ADD UNIQUE KEY uniq_open_event (
+  check_type, check_name, member_name,
+  domain_name, endpoint, is_ipv6, open_marker
+)`
+
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("update member_events open event index: %w", err)
+	}
+
+	return nil
+}
+
+// EnsureProposalColumn adds the proposal_id column and its unique index when
+// they are missing, for tables created before collators recorded the
+// proposal of each event. Existing rows keep a NULL proposal_id, which the
+// unique index allows any number of times.
+func EnsureProposalColumn(db *sql.DB) error {
+	if db == nil {
+		return fmt.Errorf("nil DB")
+	}
+
+	hasProposal, err := hasColumn(db, ProposalColumn)
+	if err != nil {
+		return err
+	}
+	if !hasProposal {
+		ddl := `
+ALTER TABLE member_events
+ADD COLUMN proposal_id VARCHAR(64) NULL`
+		if _, err := db.Exec(ddl); err != nil {
+			return fmt.Errorf("add member_events proposal_id: %w", err)
+		}
+	}
+
+	columns, err := indexColumns(db, ProposalIndexName)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 1 && columns[0] == ProposalColumn {
+		return nil
+	}
+
+	ddl := `
+ALTER TABLE member_events
+`
+	if len(columns) > 0 {
+		ddl += "DROP INDEX " + ProposalIndexName + ",\n"
+	}
+	ddl += "ADD UNIQUE KEY uniq_proposal (proposal_id)"
+
+	if _, err := db.Exec(ddl); err != nil {
+		return fmt.Errorf("update member_events proposal index: %w", err)
+	}
+
+	return nil
+}
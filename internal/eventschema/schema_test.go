@@ -0,0 +1,47 @@
+package eventschema
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestHasExpectedOpenIndex(t *testing.T) {
+	if !HasExpectedOpenIndex(ExpectedOpenIndexColumns()) {
+		t.Fatal("expected canonical open event index columns to validate")
+	}
+
+	if HasExpectedOpenIndex([]string{"check_type", "check_name", "member_name"}) {
+		t.Fatal("expected incomplete open event index to be rejected")
+	}
+}
+
+func TestEnsureProposalColumnMigratesOldTables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`FROM information_schema.COLUMNS`).WithArgs(ProposalColumn).
+		WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(0))
+	mock.ExpectExec(`ADD COLUMN proposal_id VARCHAR\(64\) NULL`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`FROM information_schema.STATISTICS`).WithArgs(ProposalIndexName).
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}))
+	mock.ExpectExec(`^ALTER TABLE member_events ADD UNIQUE KEY uniq_proposal \(proposal_id\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := EnsureProposalColumn(db); err != nil {
+		t.Fatalf("EnsureProposalColumn: %v", err)
+	}
+
+	mock.ExpectQuery(`FROM information_schema.COLUMNS`).WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+	mock.ExpectQuery(`FROM information_schema.STATISTICS`).
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow(ProposalColumn))
+	if err := EnsureProposalColumn(db); err != nil {
+		t.Fatalf("EnsureProposalColumn on a migrated table: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,181 @@
+// Package hll is a HyperLogLog cardinality sketch used to estimate unique
+// clients. Sketches hash with a fixed function, so sketches built on
+// different DNS nodes can be merged by the collator.
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// Precision is the number of hash bits selecting a register; the
+	// standard error of an estimate is about 1.04/sqrt(2^Precision), 1.6%.
+	Precision = 12
+	registers = 1 << Precision
+
+	encodingVersion = 1
+	formatDense     = 0
+	formatSparse    = 1
+	headerLen       = 3
+	sparseEntryLen  = 3
+)
+
+// ErrInvalidEncoding is returned when decoding data that is not a sketch of
+// this precision.
+var ErrInvalidEncoding = errors.New("hll: invalid sketch encoding")
+
+// Sketch estimates the number of distinct values added to it. The zero
+// value is an empty sketch.
+type Sketch struct {
+	reg [registers]uint8
+}
+
+// New returns an empty sketch.
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Add adds one value.
+func (s *Sketch) Add(v []byte) {
+	h := hash64(v)
+	idx := h >> (64 - Precision)
+	rho := uint8(bits.LeadingZeros64(h<<Precision|1<<(Precision-1))) + 1
+	if rho > s.reg[idx] {
+		s.reg[idx] = rho
+	}
+}
+
+// AddString adds one string value.
+func (s *Sketch) AddString(v string) {
+	s.Add([]byte(v))
+}
+
+// Merge folds o into s, so s estimates the union of both.
+func (s *Sketch) Merge(o *Sketch) {
+	if o == nil {
+		return
+	}
+	for i, r := range o.reg {
+		if r > s.reg[i] {
+			s.reg[i] = r
+		}
+	}
+}
+
+// Clone returns an independent copy of s.
+func (s *Sketch) Clone() *Sketch {
+	c := *s
+	return &c
+}
+
+// Estimate returns the estimated number of distinct values added.
+func (s *Sketch) Estimate() uint64 {
+	const m = float64(registers)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	var (
+		sum   float64
+		zeros int
+	)
+	for _, r := range s.reg {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small cardinalities.
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(e + 0.5)
+}
+
+// MarshalBinary encodes s. Sketches with few set registers are stored as
+// index/value pairs, others as the full register array.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	set := 0
+	for _, r := range s.reg {
+		if r != 0 {
+			set++
+		}
+	}
+
+	if set*sparseEntryLen < registers {
+		out := make([]byte, headerLen, headerLen+set*sparseEntryLen)
+		out[0], out[1], out[2] = encodingVersion, Precision, formatSparse
+		for i, r := range s.reg {
+			if r != 0 {
+				out = binary.BigEndian.AppendUint16(out, uint16(i))
+				out = append(out, r)
+			}
+		}
+		return out, nil
+	}
+
+	out := make([]byte, headerLen+registers)
+	out[0], out[1], out[2] = encodingVersion, Precision, formatDense
+	copy(out[headerLen:], s.reg[:])
+	return out, nil
+}
+
+// UnmarshalBinary replaces s with the sketch encoded in data.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) < headerLen || data[0] != encodingVersion || data[1] != Precision {
+		return ErrInvalidEncoding
+	}
+	var reg [registers]uint8
+	body := data[headerLen:]
+	switch data[2] {
+	case formatDense:
+		if len(body) != registers {
+			return ErrInvalidEncoding
+		}
+		copy(reg[:], body)
+	case formatSparse:
+		if len(body)%sparseEntryLen != 0 {
+			return ErrInvalidEncoding
+		}
+		for ; len(body) > 0; body = body[sparseEntryLen:] {
+			idx := binary.BigEndian.Uint16(body)
+			if int(idx) >= registers {
+				return ErrInvalidEncoding
+			}
+			reg[idx] = body[2]
+		}
+	default:
+		return ErrInvalidEncoding
+	}
+	s.reg = reg
+	return nil
+}
+
+// Decode returns the sketch encoded in data; empty data is an empty sketch.
+func Decode(data []byte) (*Sketch, error) {
+	s := New()
+	if len(data) == 0 {
+		return s, nil
+	}
+	if err := s.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// hash64 is FNV-1a followed by the murmur3 finalizer, which spreads FNV's
+// weak high bits across the register index.
+func hash64(v []byte) uint64 {
+	f := fnv.New64a()
+	f.Write(v)
+	h := f.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,79 @@
+package hll
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func withinError(t *testing.T, got uint64, want int, tolerance float64) {
+	t.Helper()
+	if diff := math.Abs(float64(got)-float64(want)) / float64(want); diff > tolerance {
+		t.Fatalf("expected about %d, got %d (%.1f%% off)", want, got, 100*diff)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	if got := New().Estimate(); got != 0 {
+		t.Fatalf("expected empty sketch to estimate 0, got %d", got)
+	}
+
+	for _, n := range []int{100, 5000, 200000} {
+		s := New()
+		for i := 0; i < n; i++ {
+			s.AddString(fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff))
+			s.AddString(fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)) // duplicates do not count
+		}
+		withinError(t, s.Estimate(), n, 0.05)
+	}
+}
+
+func TestMergeEstimatesUnion(t *testing.T) {
+	a, b := New(), New()
+	for i := 0; i < 3000; i++ {
+		a.AddString(fmt.Sprint("ip-", i))
+		b.AddString(fmt.Sprint("ip-", i+2000))
+	}
+	a.Merge(b)
+	withinError(t, a.Estimate(), 5000, 0.05)
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 10, 50000} {
+		s := New()
+		for i := 0; i < n; i++ {
+			s.AddString(fmt.Sprint("client-", i))
+		}
+		enc, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 10 && len(enc) > headerLen+10*sparseEntryLen {
+			t.Fatalf("expected sparse encoding for a small sketch, got %d bytes", len(enc))
+		}
+		got, err := Decode(enc)
+		if err != nil {
+			t.Fatalf("decode %d: %v", n, err)
+		}
+		if *got != *s {
+			t.Fatalf("expected round-tripped sketch of %d values to match", n)
+		}
+	}
+}
+
+func TestDecodeRejectsInvalidData(t *testing.T) {
+	for _, data := range [][]byte{
+		{encodingVersion},
+		{encodingVersion, Precision + 1, formatSparse},
+		{encodingVersion, Precision, formatDense, 1, 2},
+		{encodingVersion, Precision, formatSparse, 0xff, 0xff, 1},
+		{encodingVersion, Precision, 7},
+	} {
+		if _, err := Decode(data); err != ErrInvalidEncoding {
+			t.Fatalf("expected ErrInvalidEncoding for %v, got %v", data, err)
+		}
+	}
+	if s, err := Decode(nil); err != nil || s.Estimate() != 0 {
+		t.Fatalf("expected empty data to decode to an empty sketch, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+// Package offlinegate holds offline events until the outage has lasted the
+// configured minimum, so short blips are neither persisted nor alerted on.
+// Both event paths use it: data.RecordEvent on monitors and the collator's
+// finalize handling in data2.
+package offlinegate
+
+import (
+	"sync"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+// DefaultMinimum applies when System.MinimumOfflineTime is unset.
+const DefaultMinimum = 30 * time.Second
+
+// Minimum returns the configured minimum offline duration.
+func Minimum() time.Duration {
+	if secs := cfg.GetConfig().Local.System.MinimumOfflineTime; secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return DefaultMinimum
+}
+
+// Gate buffers pending offline events by key.
+type Gate struct {
+	minimum func() time.Duration
+
+	mu         sync.Mutex
+	pending    map[string]*time.Timer
+	committing map[string]chan struct{}
+}
+
+// New returns a gate that reads its threshold from minimum on every Hold.
+func New(minimum func() time.Duration) *Gate {
+	return &Gate{
+		minimum:    minimum,
+		pending:    make(map[string]*time.Timer),
+		committing: make(map[string]chan struct{}),
+	}
+}
+
+// Hold runs commit once the outage that started at start has lasted the
+// minimum duration, unless Release is called for key first. commit runs on
+// its own goroutine, or synchronously when the minimum has already passed.
+// Hold returns false when key is already pending or being committed.
+func (g *Gate) Hold(key string, start time.Time, commit func()) bool {
+	g.mu.Lock()
+	if _, ok := g.pending[key]; ok {
+		g.mu.Unlock()
+		return false
+	}
+	if _, ok := g.committing[key]; ok {
+		g.mu.Unlock()
+		return false
+	}
+
+	wait := g.minimum() - time.Since(start)
+	if wait <= 0 {
+		done := make(chan struct{})
+		g.committing[key] = done
+		g.mu.Unlock()
+		g.run(key, done, commit)
+		return true
+	}
+
+	var t *time.Timer
+	t = time.AfterFunc(wait, func() {
+		g.mu.Lock()
+		if g.pending[key] != t {
+			g.mu.Unlock()
+			return
+		}
+		delete(g.pending, key)
+		done := make(chan struct{})
+		g.committing[key] = done
+		g.mu.Unlock()
+		g.run(key, done, commit)
+	})
+	g.pending[key] = t
+	g.mu.Unlock()
+	return true
+}
+
+func (g *Gate) run(key string, done chan struct{}, commit func()) {
+	defer func() {
+		g.mu.Lock()
+		delete(g.committing, key)
+		g.mu.Unlock()
+		close(done)
+	}()
+	commit()
+}
+
+// Release cancels the pending offline event for key and reports whether one
+// was pending; a true result means the outage ended before the minimum and
+// nothing was committed. When the event is being committed, Release waits
+// for the commit to finish and returns false so the caller can close it.
+func (g *Gate) Release(key string) bool {
+	g.mu.Lock()
+	if t, ok := g.pending[key]; ok {
+		t.Stop()
+		delete(g.pending, key)
+		g.mu.Unlock()
+		return true
+	}
+	done, committing := g.committing[key]
+	g.mu.Unlock()
+	if committing {
+		<-done
+	}
+	return false
+}
+
+// Pending returns the number of offline events waiting for the minimum.
+func (g *Gate) Pending() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.pending)
+}
@@ -0,0 +1,85 @@
+package offlinegate
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func fixed(d time.Duration) func() time.Duration {
+	return func() time.Duration { return d }
+}
+
+func TestReleaseBeforeMinimumDropsEvent(t *testing.T) {
+	g := New(fixed(time.Hour))
+	var commits int32
+	if !g.Hold("k", time.Now(), func() { atomic.AddInt32(&commits, 1) }) {
+		t.Fatal("expected first hold to be accepted")
+	}
+	if g.Hold("k", time.Now(), func() { atomic.AddInt32(&commits, 1) }) {
+		t.Fatal("expected second hold for the same key to be ignored")
+	}
+	if g.Pending() != 1 {
+		t.Fatalf("expected 1 pending event, got %d", g.Pending())
+	}
+	if !g.Release("k") {
+		t.Fatal("expected release of a pending event to report true")
+	}
+	if g.Release("k") {
+		t.Fatal("expected second release to report false")
+	}
+	if n := atomic.LoadInt32(&commits); n != 0 {
+		t.Fatalf("expected no commit, got %d", n)
+	}
+}
+
+func TestHoldCommitsAfterMinimum(t *testing.T) {
+	g := New(fixed(20 * time.Millisecond))
+	done := make(chan struct{})
+	g.Hold("k", time.Now(), func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected commit once the minimum elapsed")
+	}
+	if g.Release("k") {
+		t.Fatal("expected release after commit to report false")
+	}
+}
+
+func TestHoldCommitsImmediatelyWhenOutageIsOld(t *testing.T) {
+	g := New(fixed(time.Minute))
+	committed := false
+	g.Hold("k", time.Now().Add(-2*time.Minute), func() { committed = true })
+	if !committed {
+		t.Fatal("expected synchronous commit for an outage older than the minimum")
+	}
+	if g.Pending() != 0 {
+		t.Fatalf("expected nothing pending, got %d", g.Pending())
+	}
+}
+
+func TestReleaseWaitsForRunningCommit(t *testing.T) {
+	g := New(fixed(time.Millisecond))
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	var finished int32
+	g.Hold("k", time.Now(), func() {
+		close(started)
+		<-finish
+		atomic.StoreInt32(&finished, 1)
+	})
+	<-started
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(finish)
+	}()
+	if g.Release("k") {
+		t.Fatal("expected release during commit to report false")
+	}
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Fatal("expected release to wait for the commit to finish")
+	}
+}
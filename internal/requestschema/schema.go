@@ -3,12 +3,17 @@ package requestschema
 import (
 	"database/sql"
 	"fmt"
+	"time"
 )
 
 const UniqueIndexName = "uniq_traffic_dedupe"
 
+// DailyHour is the hour column of a row that counts a whole day.
+const DailyHour = -1
+
 var expectedUniqueIndexColumns = []string{
 	"date",
+	"hour",
 	"node_id",
 	"domain_name",
 	"member_name",
@@ -68,11 +73,20 @@ ORDER BY SEQ_IN_INDEX
 	return columns, nil
 }
 
+// EnsureUniqueIndex adds the requests columns added since the table was
+// created and rebuilds the dedupe index when its columns differ.
 func EnsureUniqueIndex(db *sql.DB) error {
 	if db == nil {
 		return fmt.Errorf("nil DB")
 	}
 
+	if err := EnsureHourColumn(db); err != nil {
+		return err
+	}
+	if err := EnsureServiceColumn(db); err != nil {
+		return err
+	}
+
 	columns, err := CurrentUniqueIndexColumns(db)
 	if err != nil {
 		return err
@@ -89,7 +103,7 @@ ALTER TABLE requests
 	}
 	ddl += `
 ADD UNIQUE KEY uniq_traffic_dedupe (
-  date, node_id, domain_name, member_name,
+  date, hour, node_id, domain_name, member_name,
   network_asn, network_name, country_code,
   country_name, is_ipv6
 )`
@@ -100,3 +114,122 @@ ADD UNIQUE KEY uniq_traffic_dedupe (
 
 	return nil
 }
+
+// HasColumn reports whether the requests table has the named column.
+func HasColumn(db *sql.DB, column string) (bool, error) {
+	if db == nil {
+		return false, fmt.Errorf("nil DB")
+	}
+	var n int
+	err := db.QueryRow(`
+SELECT COUNT(*)
+FROM information_schema.COLUMNS
+WHERE TABLE_SCHEMA = DATABASE()
+  AND TABLE_NAME = 'requests'
+  AND COLUMN_NAME = ?
+`, column).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("query requests column metadata: %w", err)
+	}
+	return n > 0, nil
+}
+
+// EnsureHourColumn adds the hour column to requests. Existing rows become
+// daily rows.
+func EnsureHourColumn(db *sql.DB) error {
+	ok, err := HasColumn(db, "hour")
+	if err != nil || ok {
+		return err
+	}
+	if _, err := db.Exec(`
+ALTER TABLE requests
+ADD COLUMN hour TINYINT NOT NULL DEFAULT -1 AFTER date`); err != nil {
+		return fmt.Errorf("add requests hour column: %w", err)
+	}
+	return nil
+}
+
+// EnsureServiceColumn adds the service_name column and its index to
+// requests. Existing rows keep an empty service.
+func EnsureServiceColumn(db *sql.DB) error {
+	ok, err := HasColumn(db, "service_name")
+	if err != nil || ok {
+		return err
+	}
+	if _, err := db.Exec(`
+ALTER TABLE requests
+ADD COLUMN service_name VARCHAR(255) NOT NULL DEFAULT '' AFTER domain_name,
+ADD KEY idx_service_date (service_name, date)`); err != nil {
+		return fmt.Errorf("add requests service_name column: %w", err)
+	}
+	return nil
+}
+
+// HourValue returns the hour column of a row: hour for hourly rows and
+// DailyHour otherwise.
+func HourValue(hourly bool, hour int) int {
+	if !hourly || hour < 0 || hour > 23 {
+		return DailyHour
+	}
+	return hour
+}
+
+// RollupHourly folds the hourly rows dated before the given day into daily
+// rows, adding to any daily row of the same key, and deletes them. It
+// returns the number of hourly rows removed.
+func RollupHourly(db *sql.DB, before time.Time) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("nil DB")
+	}
+	cutoff := before.UTC().Format("2006-01-02")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin hourly rollup: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+INSERT INTO requests
+(date, hour, node_id, domain_name, service_name, member_name, network_asn, network_name, country_code, country_name, is_ipv6, hits)
+SELECT date, -1, node_id, domain_name, MAX(service_name), member_name, network_asn, network_name, country_code, country_name, is_ipv6, SUM(hits)
+FROM requests
+WHERE hour >= 0 AND date < ?
+GROUP BY date, node_id, domain_name, member_name, network_asn, network_name, country_code, country_name, is_ipv6
+ON DUPLICATE KEY UPDATE
+  hits = hits + VALUES(hits)
+`, cutoff); err != nil {
+		return 0, fmt.Errorf("roll up hourly requests: %w", err)
+	}
+
+	res, err := tx.Exec(`DELETE FROM requests WHERE hour >= 0 AND date < ?`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("delete hourly requests: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit hourly rollup: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// PurgeBefore deletes the usage rows, hourly and daily, and the unique
+// client rows dated before the given day. It returns the number of rows
+// removed.
+func PurgeBefore(db *sql.DB, before time.Time) (int64, error) {
+	if db == nil {
+		return 0, fmt.Errorf("nil DB")
+	}
+	cutoff := before.UTC().Format("2006-01-02")
+
+	var total int64
+	for _, table := range []string{"requests", "unique_clients"} {
+		res, err := db.Exec(`DELETE FROM `+table+` WHERE date < ?`, cutoff)
+		if err != nil {
+			return total, fmt.Errorf("purge %s: %w", table, err)
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
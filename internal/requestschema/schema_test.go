@@ -11,3 +11,38 @@ func TestHasExpectedUniqueIndex(t *testing.T) {
 		t.Fatal("expected incomplete requests index to be rejected")
 	}
 }
+
+func TestHasColumnRejectsNilDB(t *testing.T) {
+	if _, err := HasColumn(nil, "hour"); err == nil {
+		t.Fatal("expected an error for a nil DB")
+	}
+}
+
+func TestLegacyIndexWithoutHourIsRebuilt(t *testing.T) {
+	legacy := []string{
+		"date", "node_id", "domain_name", "member_name", "network_asn",
+		"network_name", "country_code", "country_name", "is_ipv6",
+	}
+	if HasExpectedUniqueIndex(legacy) {
+		t.Fatal("expected index without hour to be rejected")
+	}
+}
+
+func TestHourValue(t *testing.T) {
+	cases := []struct {
+		hourly bool
+		hour   int
+		want   int
+	}{
+		{false, 5, DailyHour},
+		{true, 0, 0},
+		{true, 23, 23},
+		{true, 24, DailyHour},
+		{true, -1, DailyHour},
+	}
+	for _, c := range cases {
+		if got := HourValue(c.hourly, c.hour); got != c.want {
+			t.Fatalf("HourValue(%v, %d): expected %d, got %d", c.hourly, c.hour, c.want, got)
+		}
+	}
+}
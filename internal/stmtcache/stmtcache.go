@@ -0,0 +1,165 @@
+// Package stmtcache keeps prepared statements for the hot queries of data,
+// data2 and the event store, so MySQL parses each of them once instead of
+// on every call. Without a prepared statement the driver prepares, executes
+// and closes the query on every call with arguments; a cached statement is
+// executed directly, saving a round trip each time. database/sql prepares a
+// cached statement again on each pooled connection it runs on, once.
+//
+// Statements are keyed by database and query text, so queries built from
+// fragments must take a bounded set of shapes.
+package stmtcache
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type key struct {
+	db    *sql.DB
+	query string
+}
+
+var (
+	mu    sync.Mutex
+	stmts = make(map[key]*sql.Stmt)
+
+	prepares atomic.Int64
+	execs    atomic.Int64
+)
+
+// Stats counts the statements this cache prepared and the executions that
+// went through them. Executions − Prepares is roughly the prepare round
+// trips saved.
+type Stats struct {
+	Statements int   `json:"statements"`
+	Prepares   int64 `json:"prepares"`
+	Executions int64 `json:"executions"`
+}
+
+// Snapshot returns the cache counters.
+func Snapshot() Stats {
+	mu.Lock()
+	n := len(stmts)
+	mu.Unlock()
+	return Stats{Statements: n, Prepares: prepares.Load(), Executions: execs.Load()}
+}
+
+// Stmt returns the statement for query on db, preparing it on first use.
+func Stmt(db *sql.DB, query string) (*sql.Stmt, error) {
+	if db == nil {
+		return nil, fmt.Errorf("prepare statement: database not initialised")
+	}
+	k := key{db, query}
+	mu.Lock()
+	st, ok := stmts[k]
+	mu.Unlock()
+	if ok {
+		return st, nil
+	}
+
+	// Prepare without the lock; of two racing callers the first to store
+	// its statement wins and the other closes its own.
+	st, err := db.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("prepare statement: %w", err)
+	}
+	prepares.Add(1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if cur, ok := stmts[k]; ok {
+		_ = st.Close()
+		return cur, nil
+	}
+	stmts[k] = st
+	return st, nil
+}
+
+// Exec runs query on db through its cached statement.
+func Exec(db *sql.DB, query string, args ...any) (sql.Result, error) {
+	st, err := Stmt(db, query)
+	if err != nil {
+		return nil, err
+	}
+	execs.Add(1)
+	return st.Exec(args...)
+}
+
+// Query runs query on db through its cached statement.
+func Query(db *sql.DB, query string, args ...any) (*sql.Rows, error) {
+	st, err := Stmt(db, query)
+	if err != nil {
+		return nil, err
+	}
+	execs.Add(1)
+	return st.Query(args...)
+}
+
+// Tx binds the cached statements of its database to one transaction.
+type Tx struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+// InTx returns a Tx running the cached statements of db within tx.
+func InTx(db *sql.DB, tx *sql.Tx) Tx { return Tx{db: db, tx: tx} }
+
+func (t Tx) stmt(query string) (*sql.Stmt, error) {
+	mu.Lock()
+	st, ok := stmts[key{t.db, query}]
+	mu.Unlock()
+	if !ok {
+		// Preparing on the pool could wait for the very connection the
+		// transaction holds; prepare on the transaction this time and cache
+		// the statement in the background for the next.
+		go func() { _, _ = Stmt(t.db, query) }()
+		return t.tx.Prepare(query)
+	}
+	execs.Add(1)
+	// The transaction's statement is closed with the transaction; the
+	// statement prepared on its connection stays with the cached one.
+	return t.tx.StmtContext(context.Background(), st), nil
+}
+
+// Exec runs query within the transaction.
+func (t Tx) Exec(query string, args ...any) (sql.Result, error) {
+	st, err := t.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return st.Exec(args...)
+}
+
+// Query runs query within the transaction.
+func (t Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	st, err := t.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return st.Query(args...)
+}
+
+// QueryRowScan runs query within the transaction and scans its first row
+// into dest, returning sql.ErrNoRows when there is none.
+func (t Tx) QueryRowScan(query string, args []any, dest ...any) error {
+	st, err := t.stmt(query)
+	if err != nil {
+		return err
+	}
+	return st.QueryRow(args...).Scan(dest...)
+}
+
+// Forget closes and drops the statements of db, e.g. before it is closed.
+func Forget(db *sql.DB) {
+	mu.Lock()
+	defer mu.Unlock()
+	for k, st := range stmts {
+		if k.db == db {
+			_ = st.Close()
+			delete(stmts, k)
+		}
+	}
+}
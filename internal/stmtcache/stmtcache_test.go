@@ -0,0 +1,115 @@
+package stmtcache
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+// countingDriver counts the statements the server would have to parse.
+type countingDriver struct{ prepares atomic.Int64 }
+
+func (d *countingDriver) Open(string) (driver.Conn, error) { return &countingConn{d}, nil }
+
+type countingConn struct{ d *countingDriver }
+
+func (c *countingConn) Prepare(string) (driver.Stmt, error) {
+	c.d.prepares.Add(1)
+	return countingStmt{}, nil
+}
+func (c *countingConn) Close() error              { return nil }
+func (c *countingConn) Begin() (driver.Tx, error) { return countingTx{}, nil }
+
+type countingStmt struct{}
+
+func (countingStmt) Close() error                               { return nil }
+func (countingStmt) NumInput() int                              { return -1 }
+func (countingStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (countingStmt) Query([]driver.Value) (driver.Rows, error)  { return emptyRows{}, nil }
+
+type countingTx struct{}
+
+func (countingTx) Commit() error   { return nil }
+func (countingTx) Rollback() error { return nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return []string{"id"} }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func openCounting(t *testing.T, name string) (*sql.DB, *countingDriver) {
+	t.Helper()
+	d := &countingDriver{}
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		Forget(db)
+		_ = db.Close()
+	})
+	return db, d
+}
+
+func TestStatementsArePreparedOnce(t *testing.T) {
+	db, d := openCounting(t, "stmtcache-once")
+	before := Snapshot()
+
+	const q = `UPDATE requests SET hits = ? WHERE id = ?`
+	for i := 0; i < 10; i++ {
+		if _, err := Exec(db, q, i, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := d.prepares.Load(); n != 1 {
+		t.Fatalf("driver prepared %d times, want 1", n)
+	}
+	after := Snapshot()
+	if after.Prepares-before.Prepares != 1 || after.Executions-before.Executions != 10 {
+		t.Fatalf("stats %+v after %+v", after, before)
+	}
+}
+
+func TestTransactionsReuseTheCachedStatement(t *testing.T) {
+	db, d := openCounting(t, "stmtcache-tx")
+
+	const q = `SELECT id FROM member_events WHERE proposal_id = ? FOR UPDATE`
+	scan := func() {
+		t.Helper()
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var id int64
+		err = InTx(db, tx).QueryRowScan(q, []any{"p"}, &id)
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("scan: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A cold cache must not wait for the connection the transaction holds.
+	scan()
+	Forget(db)
+
+	if _, err := Stmt(db, q); err != nil {
+		t.Fatal(err)
+	}
+	d.prepares.Store(0)
+	for i := 0; i < 5; i++ {
+		scan()
+	}
+	// One connection, so the statement prepared on it is reused by every
+	// transaction.
+	if n := d.prepares.Load(); n != 0 {
+		t.Fatalf("driver prepared %d more times, want none", n)
+	}
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type correlationKey struct{}
+
+// NewCorrelationID returns a short random identifier for one request flow.
+func NewCorrelationID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// WithCorrelationID returns ctx carrying id. An empty id leaves ctx unchanged.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the identifier carried by ctx, or "".
+func CorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// LogCtx is Log with the correlation ID from ctx appended as "[cid=...]", so
+// every line of one flow can be grepped across nodes.
+func LogCtx(ctx context.Context, level LogLevel, format string, v ...interface{}) {
+	if level < LogLevel(minLevel.Load()) {
+		return
+	}
+	threshold := LogLevel(logLevel.Load())
+	if hasOverrides.Load() {
+		threshold = levelForModule(callerModule(1))
+	}
+	if level < threshold {
+		return
+	}
+	if id := CorrelationID(ctx); id != "" {
+		format += " [cid=%s]"
+		v = append(v[:len(v):len(v)], id)
+	}
+	output(level, format, v...)
+}
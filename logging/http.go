@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// levelsResponse is the body returned by LevelHandler.
+type levelsResponse struct {
+	Global  string            `json:"global"`
+	Modules map[string]string `json:"modules"`
+}
+
+// levelChange is accepted by LevelHandler on PUT/POST. An empty Module targets
+// the global level; an empty Level clears the module override.
+type levelChange struct {
+	Module string `json:"module"`
+	Level  string `json:"level"`
+}
+
+// LevelHandler exposes the log levels for a management API. GET returns the
+// global level and module overrides; PUT or POST applies a levelChange.
+// Authentication is left to the API that mounts the handler.
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var req levelChange
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+				http.Error(w, "invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			if err := applyLevelChange(req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(currentLevels())
+	})
+}
+
+func applyLevelChange(req levelChange) error {
+	if req.Module == "" {
+		level, err := LookupLogLevel(req.Level)
+		if err != nil {
+			return err
+		}
+		SetLogLevel(level)
+		Log(Info, "[logging] global level set to %s", level)
+		return nil
+	}
+
+	if req.Level == "" {
+		ClearModuleLevel(req.Module)
+		Log(Info, "[logging] cleared level override for %s", req.Module)
+		return nil
+	}
+
+	level, err := LookupLogLevel(req.Level)
+	if err != nil {
+		return err
+	}
+	SetModuleLevel(req.Module, level)
+	Log(Info, "[logging] level override %s=%s", normalizeModule(req.Module), level)
+	return nil
+}
+
+func currentLevels() levelsResponse {
+	resp := levelsResponse{
+		Global:  GetLogLevel().String(),
+		Modules: map[string]string{},
+	}
+	for module, level := range ModuleLevels() {
+		resp.Modules[module] = level.String()
+	}
+	return resp
+}
@@ -14,18 +14,33 @@ var logLevel atomic.Int32
 func init() {
 	logger = log.New(os.Stdout, "", log.LstdFlags|log.LUTC)
 	logLevel.Store(int32(Info))
+	minLevel.Store(int32(Info))
 	Log(Debug, "Logging Package initializing...")
 }
 
 func SetLogLevel(level LogLevel) {
 	logLevel.Store(int32(level))
+	recomputeMinLevel()
 }
 
+// Log writes a message if level passes the threshold of the calling package,
+// which is the global level unless a module override applies.
 func Log(level LogLevel, format string, v ...interface{}) {
-	if level >= LogLevel(logLevel.Load()) {
-		msg := fmt.Sprintf(format, v...)
-		logger.Printf("%s: %s", level.String(), msg)
+	if level < LogLevel(minLevel.Load()) {
+		return
 	}
+	threshold := LogLevel(logLevel.Load())
+	if hasOverrides.Load() {
+		threshold = levelForModule(callerModule(1))
+	}
+	if level >= threshold {
+		output(level, format, v...)
+	}
+}
+
+func output(level LogLevel, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	logger.Printf("%s: %s", level.String(), msg)
 }
 
 func Fmt(format string, v ...interface{}) error {
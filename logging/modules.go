@@ -0,0 +1,212 @@
+package logging
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// modulePrefix is stripped from package paths so overrides can be written as
+// "nats" or "nats/modules/consensus" rather than full import paths.
+const modulePrefix = "github.com/ibp-network/ibp-geodns-libs/"
+
+var (
+	modulesMu    sync.RWMutex
+	moduleLevels = map[string]LogLevel{}
+
+	// minLevel is the lowest threshold across the global level and every
+	// override; anything below it can be discarded without a caller lookup.
+	minLevel     atomic.Int32
+	hasOverrides atomic.Bool
+
+	callerModules sync.Map // pc → module name
+)
+
+// Logger writes through the shared logger using the level configured for a
+// single module.
+type Logger struct {
+	module string
+}
+
+var (
+	loggersMu sync.Mutex
+	loggers   = map[string]*Logger{}
+)
+
+// ForModule returns the logger for name. Loggers are cached, so calling this
+// at package level or per call is equally cheap.
+func ForModule(name string) *Logger {
+	name = normalizeModule(name)
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	if l, ok := loggers[name]; ok {
+		return l
+	}
+	l := &Logger{module: name}
+	loggers[name] = l
+	return l
+}
+
+// Module returns the module name the logger filters on.
+func (l *Logger) Module() string { return l.module }
+
+// Log writes a message if level passes the module's effective threshold.
+func (l *Logger) Log(level LogLevel, format string, v ...interface{}) {
+	if level < LogLevel(minLevel.Load()) {
+		return
+	}
+	if level >= levelForModule(l.module) {
+		output(level, format, v...)
+	}
+}
+
+// Enabled reports whether a message at level would be written.
+func (l *Logger) Enabled(level LogLevel) bool {
+	return level >= levelForModule(l.module)
+}
+
+// SetModuleLevel overrides the level for a single module.
+func SetModuleLevel(module string, level LogLevel) {
+	modulesMu.Lock()
+	moduleLevels[normalizeModule(module)] = level
+	modulesMu.Unlock()
+	recomputeMinLevel()
+}
+
+// ClearModuleLevel removes a module override so it follows the global level.
+func ClearModuleLevel(module string) {
+	modulesMu.Lock()
+	delete(moduleLevels, normalizeModule(module))
+	modulesMu.Unlock()
+	recomputeMinLevel()
+}
+
+// SetModuleLevels replaces every module override at once.
+func SetModuleLevels(levels map[string]LogLevel) {
+	modulesMu.Lock()
+	moduleLevels = make(map[string]LogLevel, len(levels))
+	for module, level := range levels {
+		moduleLevels[normalizeModule(module)] = level
+	}
+	modulesMu.Unlock()
+	recomputeMinLevel()
+}
+
+// ModuleLevels returns the current overrides keyed by module name.
+func ModuleLevels() map[string]LogLevel {
+	modulesMu.RLock()
+	defer modulesMu.RUnlock()
+	out := make(map[string]LogLevel, len(moduleLevels))
+	for module, level := range moduleLevels {
+		out[module] = level
+	}
+	return out
+}
+
+// GetLogLevel returns the global level.
+func GetLogLevel() LogLevel {
+	return LogLevel(logLevel.Load())
+}
+
+// LookupLogLevel parses a level name, rejecting unknown values.
+func LookupLogLevel(levelStr string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(levelStr)) {
+	case "debug":
+		return Debug, nil
+	case "info":
+		return Info, nil
+	case "warn", "warning":
+		return Warn, nil
+	case "error":
+		return Error, nil
+	case "fatal":
+		return Fatal, nil
+	default:
+		return Info, fmt.Errorf("unknown log level %q", levelStr)
+	}
+}
+
+func normalizeModule(module string) string {
+	module = strings.Trim(strings.TrimSpace(module), "/")
+	return strings.TrimPrefix(module, modulePrefix)
+}
+
+func recomputeMinLevel() {
+	modulesMu.RLock()
+	min := LogLevel(logLevel.Load())
+	for _, level := range moduleLevels {
+		if level < min {
+			min = level
+		}
+	}
+	n := len(moduleLevels)
+	modulesMu.RUnlock()
+
+	minLevel.Store(int32(min))
+	hasOverrides.Store(n > 0)
+}
+
+// levelForModule resolves the most specific override for module. A key
+// matches the module itself, any sub-package ("nats" → "nats/router") and
+// trailing path segments ("consensus" → "nats/modules/consensus").
+func levelForModule(module string) LogLevel {
+	global := LogLevel(logLevel.Load())
+	if !hasOverrides.Load() {
+		return global
+	}
+
+	modulesMu.RLock()
+	defer modulesMu.RUnlock()
+
+	best, bestLen := global, -1
+	for key, level := range moduleLevels {
+		if !moduleMatches(module, key) {
+			continue
+		}
+		if len(key) > bestLen {
+			best, bestLen = level, len(key)
+		}
+	}
+	return best
+}
+
+func moduleMatches(module, key string) bool {
+	return module == key ||
+		strings.HasPrefix(module, key+"/") ||
+		strings.HasSuffix(module, "/"+key) ||
+		strings.Contains(module, "/"+key+"/")
+}
+
+// callerModule derives the module name from the package of the function that
+// called Log, skip frames above this function.
+func callerModule(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
+	if cached, ok := callerModules.Load(pc); ok {
+		return cached.(string)
+	}
+
+	module := ""
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		module = normalizeModule(packageOf(fn.Name()))
+	}
+	callerModules.Store(pc, module)
+	return module
+}
+
+// packageOf extracts the import path from a fully qualified function name
+// such as "github.com/x/y/pkg.(*T).Method".
+func packageOf(funcName string) string {
+	slash := strings.LastIndex(funcName, "/")
+	if slash < 0 {
+		slash = 0
+	}
+	if dot := strings.Index(funcName[slash:], "."); dot >= 0 {
+		return funcName[:slash+dot]
+	}
+	return funcName
+}
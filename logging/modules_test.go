@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func withCapturedOutput(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prevLogger, prevLevel := logger, GetLogLevel()
+	logger = log.New(&buf, "", 0)
+	t.Cleanup(func() {
+		logger = prevLogger
+		SetModuleLevels(nil)
+		SetLogLevel(prevLevel)
+	})
+	return &buf
+}
+
+func TestLevelForModulePrefersMostSpecificOverride(t *testing.T) {
+	withCapturedOutput(t)
+	SetLogLevel(Info)
+	SetModuleLevels(map[string]LogLevel{
+		"nats":                   Debug,
+		"nats/modules/consensus": Error,
+		"data":                   Warn,
+	})
+
+	cases := map[string]LogLevel{
+		"nats":                   Debug,
+		"nats/router":            Debug,
+		"nats/modules/consensus": Error,
+		"data/mysql":             Warn,
+		"maxmind":                Info,
+	}
+	for module, want := range cases {
+		if got := levelForModule(module); got != want {
+			t.Fatalf("levelForModule(%q): expected %s, got %s", module, want, got)
+		}
+	}
+}
+
+func TestForModuleFiltersIndependentlyOfGlobalLevel(t *testing.T) {
+	buf := withCapturedOutput(t)
+	SetLogLevel(Warn)
+	SetModuleLevel("nats", Debug)
+
+	ForModule("nats").Log(Debug, "consensus detail")
+	ForModule("data").Log(Info, "usage noise")
+
+	out := buf.String()
+	if !strings.Contains(out, "consensus detail") {
+		t.Fatalf("expected debug output for overridden module, got %q", out)
+	}
+	if strings.Contains(out, "usage noise") {
+		t.Fatalf("expected info output for non-overridden module to be dropped, got %q", out)
+	}
+}
+
+func TestLogUsesCallerPackageOverride(t *testing.T) {
+	buf := withCapturedOutput(t)
+	SetLogLevel(Error)
+	SetModuleLevel("logging", Debug)
+
+	Log(Debug, "from logging package")
+
+	if !strings.Contains(buf.String(), "from logging package") {
+		t.Fatalf("expected caller package override to apply, got %q", buf.String())
+	}
+}
+
+func TestPackageOf(t *testing.T) {
+	cases := map[string]string{
+		"github.com/ibp-network/ibp-geodns-libs/nats/modules/consensus.(*Module).decideLocked": "github.com/ibp-network/ibp-geodns-libs/nats/modules/consensus",
+		"github.com/ibp-network/ibp-geodns-libs/data.RecordDnsHit.func1":                       "github.com/ibp-network/ibp-geodns-libs/data",
+		"main.main": "main",
+	}
+	for fn, want := range cases {
+		if got := packageOf(fn); got != want {
+			t.Fatalf("packageOf(%q): expected %q, got %q", fn, want, got)
+		}
+	}
+}
+
+func TestLevelHandlerAppliesChanges(t *testing.T) {
+	withCapturedOutput(t)
+	SetLogLevel(Info)
+
+	h := LevelHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"module":"nats","level":"debug"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"nats":"DEBUG"`) {
+		t.Fatalf("expected override in response, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"module":"nats","level":"loud"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected unknown level to be rejected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"module":"nats","level":""}`)))
+	if _, ok := ModuleLevels()["nats"]; ok {
+		t.Fatal("expected empty level to clear the override")
+	}
+}
+
+func TestLogCtxAppendsCorrelationID(t *testing.T) {
+	buf := withCapturedOutput(t)
+	SetLogLevel(Info)
+
+	ctx := WithCorrelationID(context.Background(), "abc123")
+	LogCtx(ctx, Info, "[NATS] vote id=%s", "p1")
+	LogCtx(context.Background(), Info, "[NATS] no flow")
+	LogCtx(ctx, Debug, "[NATS] filtered")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	if !strings.HasSuffix(lines[0], "[NATS] vote id=p1 [cid=abc123]") {
+		t.Fatalf("expected correlation suffix, got %q", lines[0])
+	}
+	if strings.Contains(lines[1], "cid=") {
+		t.Fatalf("expected no correlation suffix without an id, got %q", lines[1])
+	}
+}
+
+func TestNewCorrelationIDIsUnique(t *testing.T) {
+	a, b := NewCorrelationID(), NewCorrelationID()
+	if len(a) != 16 || a == b {
+		t.Fatalf("expected distinct 16-char ids, got %q and %q", a, b)
+	}
+}
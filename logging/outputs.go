@@ -0,0 +1,226 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OutputConfig describes a single log destination.
+//
+//	Type "stdout" (default), "stderr", "file" or "syslog".
+//	File outputs rotate when MaxSizeMB is exceeded or RotateEvery elapses,
+//	keeping at most MaxBackups rotated files (0 keeps all).
+//	Syslog outputs dial Network/Address (both empty = local syslog).
+type OutputConfig struct {
+	Type        string
+	Path        string
+	MaxSizeMB   int
+	RotateEvery time.Duration
+	MaxBackups  int
+	Network     string
+	Address     string
+	Tag         string
+}
+
+// Options configures where and how log lines are written.
+type Options struct {
+	Outputs []OutputConfig
+	// Async queues lines in memory and writes them from a background
+	// goroutine. When the buffer is full, lines are dropped rather than
+	// blocking the caller; the number dropped is reported periodically.
+	Async      bool
+	BufferSize int
+}
+
+const defaultAsyncBuffer = 8192
+
+var (
+	outputsMu     sync.Mutex
+	activeClosers []io.Closer
+	activeAsync   *asyncWriter
+)
+
+// Configure replaces the current log outputs. On error the previous outputs
+// remain in place.
+func Configure(opts Options) error {
+	outputs := opts.Outputs
+	if len(outputs) == 0 {
+		outputs = []OutputConfig{{Type: "stdout"}}
+	}
+
+	var writers []io.Writer
+	var closers []io.Closer
+	for _, oc := range outputs {
+		w, err := openOutput(oc)
+		if err != nil {
+			for _, c := range closers {
+				_ = c.Close()
+			}
+			return fmt.Errorf("open %s output: %w", outputType(oc), err)
+		}
+		writers = append(writers, w)
+		if c, ok := w.(io.Closer); ok {
+			closers = append(closers, c)
+		}
+	}
+
+	var w io.Writer = writers[0]
+	if len(writers) > 1 {
+		w = io.MultiWriter(writers...)
+	}
+
+	var async *asyncWriter
+	if opts.Async {
+		size := opts.BufferSize
+		if size <= 0 {
+			size = defaultAsyncBuffer
+		}
+		async = newAsyncWriter(w, size)
+		w = async
+	}
+
+	outputsMu.Lock()
+	prevClosers, prevAsync := activeClosers, activeAsync
+	activeClosers, activeAsync = closers, async
+	logger.SetOutput(w)
+	outputsMu.Unlock()
+
+	if prevAsync != nil {
+		prevAsync.Close()
+	}
+	for _, c := range prevClosers {
+		_ = c.Close()
+	}
+	return nil
+}
+
+// Close flushes buffered lines and closes file and syslog outputs, reverting
+// to stdout. Call it during shutdown.
+func Close() {
+	outputsMu.Lock()
+	closers, async := activeClosers, activeAsync
+	activeClosers, activeAsync = nil, nil
+	logger.SetOutput(os.Stdout)
+	outputsMu.Unlock()
+
+	if async != nil {
+		async.Close()
+	}
+	for _, c := range closers {
+		_ = c.Close()
+	}
+}
+
+func outputType(oc OutputConfig) string {
+	t := strings.ToLower(strings.TrimSpace(oc.Type))
+	if t == "" {
+		return "stdout"
+	}
+	return t
+}
+
+func openOutput(oc OutputConfig) (io.Writer, error) {
+	switch outputType(oc) {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	case "file":
+		if oc.Path == "" {
+			return nil, errors.New("file output requires a path")
+		}
+		return newRotatingFile(oc.Path, int64(oc.MaxSizeMB)*1024*1024, oc.RotateEvery, oc.MaxBackups)
+	case "syslog":
+		return newSyslogWriter(oc.Network, oc.Address, oc.Tag)
+	default:
+		return nil, fmt.Errorf("unknown output type %q", oc.Type)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// ASYNC WRITER
+// -----------------------------------------------------------------------------
+
+type asyncWriter struct {
+	out     io.Writer
+	lines   chan []byte
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	mu     sync.RWMutex // guards closed against sends on a closed channel
+	closed bool
+}
+
+func newAsyncWriter(out io.Writer, size int) *asyncWriter {
+	a := &asyncWriter{
+		out:   out,
+		lines: make(chan []byte, size),
+		done:  make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Write never blocks: if the buffer is full the line is counted and dropped.
+func (a *asyncWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return a.out.Write(p)
+	}
+
+	line := make([]byte, len(p))
+	copy(line, p)
+	select {
+	case a.lines <- line:
+	default:
+		a.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+func (a *asyncWriter) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line, ok := <-a.lines:
+			if !ok {
+				a.reportDropped()
+				return
+			}
+			_, _ = a.out.Write(line)
+		case <-ticker.C:
+			a.reportDropped()
+		}
+	}
+}
+
+func (a *asyncWriter) reportDropped() {
+	if n := a.dropped.Swap(0); n > 0 {
+		msg := fmt.Sprintf("%s %s: [logging] dropped %d log line(s); async buffer full\n",
+			time.Now().UTC().Format("2006/01/02 15:04:05"), Warn.String(), n)
+		_, _ = a.out.Write([]byte(msg))
+	}
+}
+
+// Close drains queued lines and stops the background writer.
+func (a *asyncWriter) Close() {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.closed = true
+	close(a.lines)
+	a.mu.Unlock()
+	<-a.done
+}
@@ -0,0 +1,156 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileRotatesBySizeAndPrunesBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "geodns.log")
+
+	r, err := newRotatingFile(path, 16, 0, 2)
+	if err != nil {
+		t.Fatalf("open rotating file: %v", err)
+	}
+	defer r.Close()
+
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := r.Write([]byte("0123456789\n")); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 retained backups, got %d: %v", len(backups), backups)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read active file: %v", err)
+	}
+	if string(data) != "0123456789\n" {
+		t.Fatalf("expected active file to hold only the latest line, got %q", data)
+	}
+}
+
+func TestRotatingFileRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geodns.log")
+	r, err := newRotatingFile(path, 0, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("open rotating file: %v", err)
+	}
+	defer r.Close()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	r.openedAt = now
+
+	_, _ = r.Write([]byte("first\n"))
+	now = now.Add(2 * time.Hour)
+	_, _ = r.Write([]byte("second\n"))
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 1 {
+		t.Fatalf("expected one time-based rotation, got %v", backups)
+	}
+}
+
+func TestRotatingFileKeepsWritingWhenRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geodns.log")
+	r, err := newRotatingFile(path, 16, 0, 0)
+	if err != nil {
+		t.Fatalf("open rotating file: %v", err)
+	}
+	defer r.Close()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	var reported bytes.Buffer
+	origRename, origErrors := renameFile, rotateErrors
+	renameFile = func(string, string) error { return errors.New("read-only directory") }
+	rotateErrors = &reported
+	defer func() { renameFile, rotateErrors = origRename, origErrors }()
+
+	// The file is one of several outputs; a rotation error must not stop
+	// the ones after it.
+	var syslog bytes.Buffer
+	out := io.MultiWriter(r, &syslog)
+	for _, line := range []string{"0123456789\n", "second\n", "third\n"} {
+		if _, err := out.Write([]byte(line)); err != nil {
+			t.Fatalf("write %q: %v", line, err)
+		}
+	}
+	if syslog.String() != "0123456789\nsecond\nthird\n" {
+		t.Fatalf("expected every line in the next output, got %q", syslog.String())
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "0123456789\nsecond\nthird\n" {
+		t.Fatalf("expected all writes in the active file, got %q", data)
+	}
+	if n := strings.Count(reported.String(), "read-only directory"); n != 1 {
+		t.Fatalf("expected the failure reported once per retry window, got %q", reported.String())
+	}
+
+	renameFile = origRename
+	now = now.Add(rotateRetry)
+	if _, err := r.Write([]byte("fourth\n")); err != nil {
+		t.Fatalf("write after retry: %v", err)
+	}
+	if backups, _ := filepath.Glob(path + ".*"); len(backups) != 1 {
+		t.Fatalf("expected rotation to be retried, got %v", backups)
+	}
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAsyncWriterDrainsOnClose(t *testing.T) {
+	var out lockedBuffer
+	a := newAsyncWriter(&out, 16)
+
+	for i := 0; i < 10; i++ {
+		_, _ = a.Write([]byte("line\n"))
+	}
+	a.Close()
+
+	if got := strings.Count(out.String(), "line\n"); got != 10 {
+		t.Fatalf("expected 10 drained lines, got %d", got)
+	}
+	if _, err := a.Write([]byte("after\n")); err != nil {
+		t.Fatalf("expected writes after close to fall through, got %v", err)
+	}
+}
+
+func TestConfigureRejectsUnknownOutput(t *testing.T) {
+	if err := Configure(Options{Outputs: []OutputConfig{{Type: "carrier-pigeon"}}}); err == nil {
+		t.Fatal("expected unknown output type to be rejected")
+	}
+}
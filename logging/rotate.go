@@ -0,0 +1,185 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rotateStampLayout = "20060102T150405"
+	rotateRetry       = time.Minute
+)
+
+var (
+	// renameFile renames the active file on rotation; tests replace it.
+	renameFile = os.Rename
+	// rotateErrors receives failed rotations. They cannot go through the
+	// log outputs, which may be this file, or through Write, whose error
+	// would stop an io.MultiWriter before the outputs after it.
+	rotateErrors io.Writer = os.Stderr
+)
+
+// rotatingFile is an io.WriteCloser that rotates the underlying file by size
+// and/or age. Rotated files are renamed to <path>.<UTC timestamp>.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	every      time.Duration
+	maxBackups int
+
+	f        *os.File
+	size     int64
+	openedAt time.Time
+	retryAt  time.Time // no rotation before this after a failed one
+	now      func() time.Time
+}
+
+// NewRotatingFile opens path for appending, rotating it like file log
+// outputs: once it would exceed maxSize bytes or is older than every (zero
+// disables either), keeping maxBackups rotated files (zero keeps all).
+func NewRotatingFile(path string, maxSize int64, every time.Duration, maxBackups int) (io.WriteCloser, error) {
+	return newRotatingFile(path, maxSize, every, maxBackups)
+}
+
+func newRotatingFile(path string, maxSize int64, every time.Duration, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		every:      every,
+		maxBackups: maxBackups,
+		now:        func() time.Time { return time.Now().UTC() },
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("stat log file: %w", err)
+	}
+	r.f = f
+	r.size = info.Size()
+	r.openedAt = r.now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			if r.f == nil {
+				return 0, err
+			}
+			// Logging carries on in the current file; retries are
+			// rotateRetry apart, so this is reported once per window.
+			fmt.Fprintf(rotateErrors, "logging: %s: %v; retrying in %s\n", r.path, err, rotateRetry)
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) shouldRotate(incoming int64) bool {
+	if r.size == 0 || r.now().Before(r.retryAt) {
+		return false
+	}
+	if r.maxSize > 0 && r.size+incoming > r.maxSize {
+		return true
+	}
+	return r.every > 0 && r.now().Sub(r.openedAt) >= r.every
+}
+
+// rotate renames the active file and opens a new one. When the rename
+// fails, the active file is reopened so logging carries on in it, and
+// rotation is retried after rotateRetry; the error is still returned for
+// Write to report. r.f is nil afterwards only if no file could be opened.
+func (r *rotatingFile) rotate() error {
+	err := r.f.Close()
+	r.f = nil
+	if err != nil {
+		err = fmt.Errorf("close log file: %w", err)
+	} else {
+		rotated := r.path + "." + r.now().Format(rotateStampLayout)
+		if _, statErr := os.Stat(rotated); statErr == nil {
+			rotated = fmt.Sprintf("%s.%d", rotated, r.now().UnixNano())
+		}
+		if err = renameFile(r.path, rotated); err != nil {
+			err = fmt.Errorf("rotate log file: %w", err)
+		} else {
+			r.pruneBackups()
+		}
+	}
+
+	openedAt := r.openedAt
+	if openErr := r.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	if err != nil {
+		// Still the old file: keep its age and hold off retrying.
+		r.openedAt = openedAt
+		r.retryAt = r.now().Add(rotateRetry)
+	}
+	return err
+}
+
+// pruneBackups removes the oldest rotated files beyond maxBackups.
+func (r *rotatingFile) pruneBackups() {
+	if r.maxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return
+	}
+	backups := matches[:0]
+	for _, m := range matches {
+		if strings.HasPrefix(filepath.Base(m), filepath.Base(r.path)+".") {
+			backups = append(backups, m)
+		}
+	}
+	if len(backups) <= r.maxBackups {
+		return
+	}
+	// Timestamps sort lexically, so the oldest come first.
+	sort.Strings(backups)
+	for _, old := range backups[:len(backups)-r.maxBackups] {
+		_ = os.Remove(old)
+	}
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
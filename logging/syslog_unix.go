@@ -0,0 +1,64 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"log/syslog"
+	"strings"
+)
+
+// syslogWriter forwards formatted lines to syslog, mapping the level token
+// written by output() to a syslog priority.
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func newSyslogWriter(network, address, tag string) (*syslogWriter, error) {
+	if tag == "" {
+		tag = "ibp-geodns"
+	}
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{w: w}, nil
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	var err error
+	switch lineLevel(line) {
+	case Fatal.String():
+		err = s.w.Crit(line)
+	case Error.String():
+		err = s.w.Err(line)
+	case Warn.String():
+		err = s.w.Warning(line)
+	case Debug.String():
+		err = s.w.Debug(line)
+	default:
+		err = s.w.Info(line)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// lineLevel returns the level token preceding the first ": " in a line, e.g.
+// "WARN" for "2025/01/02 03:04:05 WARN: message".
+func lineLevel(line string) string {
+	i := strings.Index(line, ": ")
+	if i < 0 {
+		return ""
+	}
+	head := line[:i]
+	if sp := strings.LastIndex(head, " "); sp >= 0 {
+		head = head[sp+1:]
+	}
+	return head
+}
+
+func (s *syslogWriter) Close() error {
+	return s.w.Close()
+}
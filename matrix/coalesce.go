@@ -0,0 +1,293 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+
+	"maunium.net/go/mautrix/id"
+)
+
+const (
+	// coalesceWindow is how long offline reports for one member are
+	// collected before a single combined alert is posted.
+	coalesceWindow = 3 * time.Second
+
+	// deliveryTimeout bounds a queued send, including rate-limit back-off.
+	deliveryTimeout = 3 * time.Minute
+)
+
+// -----------------------------------------------------------------------------
+// ALERT GROUPS
+// -----------------------------------------------------------------------------
+
+// outageDetails carries the fields needed to re-render an outage alert.
+type outageDetails struct {
+	member    string
+	checkType string
+	checkName string
+	domain    string
+	endpoint  string
+	ipv6      bool
+	errText   string
+}
+
+// event returns the alert event of the outage, offline or back online.
+// started, when known, is when the outage began.
+func (d outageDetails) event(offline bool, started time.Time) alerts.Event {
+	kind := alerts.KindOnline
+	if offline {
+		kind = alerts.KindOffline
+	}
+	return alerts.Event{
+		Kind:      kind,
+		Member:    d.member,
+		CheckType: d.checkType,
+		CheckName: d.checkName,
+		Domain:    d.domain,
+		Endpoint:  d.endpoint,
+		IPv6:      d.ipv6,
+		Error:     d.errText,
+		Time:      time.Now().UTC(),
+		Started:   started,
+	}
+}
+
+// alertEntry is one outage inside a (possibly combined) alert message.
+type alertEntry struct {
+	key     string
+	details outageDetails
+	online  bool
+}
+
+// alertGroup is a single Matrix message covering one or more outages of the
+// same member.
+type alertGroup struct {
+	mu          sync.Mutex
+	member      string
+	evID        id.EventID
+	entries     []*alertEntry
+	startedAt   time.Time
+	escalations int
+}
+
+var (
+	groups sync.Map // outage‑key → *alertGroup (once posted)
+
+	pendingMu sync.Mutex
+	pending   = map[string]*alertGroup{} // member → group awaiting flush
+)
+
+// queueOffline adds an outage to the member's pending group, scheduling a
+// flush when the group is first created.
+func queueOffline(key string, d outageDetails) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	g, ok := pending[d.member]
+	if !ok {
+		g = &alertGroup{member: d.member}
+		pending[d.member] = g
+		time.AfterFunc(coalesceWindow, func() { flushPending(d.member) })
+	}
+	g.entries = append(g.entries, &alertEntry{key: key, details: d})
+}
+
+// cancelPending removes key from the member's pending group. It reports
+// whether the outage was still waiting to be posted.
+func cancelPending(member, key string) bool {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	g, ok := pending[member]
+	if !ok {
+		return false
+	}
+	for i, e := range g.entries {
+		if e.key == key {
+			g.entries = append(g.entries[:i], g.entries[i+1:]...)
+			if len(g.entries) == 0 {
+				delete(pending, member)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// flushPending posts the member's pending group as one message.
+func flushPending(member string) {
+	pendingMu.Lock()
+	g := pending[member]
+	delete(pending, member)
+	pendingMu.Unlock()
+
+	if g == nil || len(g.entries) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	g.mu.Lock()
+	g.startedAt = time.Now().UTC()
+	body, html := renderGroup(g, getMemberMentions(member), "")
+	g.mu.Unlock()
+
+	evID, err := sendFormattedText(ctx, body, html)
+	if err != nil {
+		// Clean‑up sentinels so future attempts can retry.
+		for _, e := range g.entries {
+			offlineMap.Delete(e.key)
+		}
+		log.Log(log.Error, "[matrix] failed to send offline alert: %v", err)
+		return
+	}
+
+	g.mu.Lock()
+	g.evID = evID
+	recovered := false
+	for _, e := range g.entries {
+		if offlineMap.CompareAndSwap(e.key, id.EventID(""), evID) {
+			groups.Store(e.key, g)
+			continue
+		}
+		// Resolved while the alert was in flight.
+		e.online = true
+		recovered = true
+	}
+	body, html = renderGroup(g, getMemberMentions(member), "")
+	g.mu.Unlock()
+
+	if recovered {
+		if err := editFormattedText(ctx, evID, body, html); err != nil {
+			log.Log(log.Warn, "[matrix] failed to mark in-flight recovery for %s: %v", member, err)
+		}
+	}
+}
+
+// resolveGroupEntry marks key as recovered and edits the group message.
+func resolveGroupEntry(g *alertGroup, key string, d outageDetails) {
+	g.mu.Lock()
+	for _, e := range g.entries {
+		if e.key == key {
+			e.online = true
+		}
+	}
+	evID := g.evID
+	var mentions []string
+	if !g.allOnline() {
+		mentions = getMemberMentions(g.member)
+	}
+	body, html := renderGroup(g, mentions, "")
+	g.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	// Attempt edit‑in‑place.
+	if err := editFormattedText(ctx, evID, body, html); err != nil {
+		log.Log(log.Warn, "[matrix] edit failed – falling back to new msg: %v", err)
+		sendOnline(d)
+	}
+}
+
+func (g *alertGroup) allOnline() bool {
+	for _, e := range g.entries {
+		if !e.online {
+			return false
+		}
+	}
+	return true
+}
+
+// -----------------------------------------------------------------------------
+// RENDERING
+// -----------------------------------------------------------------------------
+
+// renderGroup formats a group as plain text and HTML. Single-outage groups use
+// the classic alert layout; combined groups list every outage with its own
+// status. downtime, when non-empty, is appended for open outages. Callers
+// must hold g.mu.
+func renderGroup(g *alertGroup, mentions []string, downtime string) (body, html string) {
+	if len(g.entries) == 1 {
+		e := g.entries[0]
+		d := e.details
+		if e.online {
+			mentions = nil
+		}
+		// The outage start only matters once it has lasted a while.
+		var started time.Time
+		if e.online || downtime != "" {
+			started = g.startedAt
+		}
+		body, html = renderAlert(d.event(!e.online, started), mentions)
+		if !e.online && downtime != "" {
+			body += fmt.Sprintf("\n• Down for: %s", downtime)
+			html += fmt.Sprintf("<br/>• Down for: %s", downtime)
+		}
+		return body, html
+	}
+
+	offline := 0
+	for _, e := range g.entries {
+		if !e.online {
+			offline++
+		}
+	}
+
+	var b, h strings.Builder
+	if offline > 0 && len(mentions) > 0 {
+		b.WriteString(strings.Join(mentions, " ") + "\n")
+		h.WriteString(strings.Join(mentions, " ") + "<br/>")
+	}
+
+	if offline == 0 {
+		fmt.Fprintf(&b, "✅  *ONLINE* – **%s** (%d checks)", g.member, len(g.entries))
+		fmt.Fprintf(&h, "✅  <strong>ONLINE</strong> – <strong>%s</strong> (%d checks)", g.member, len(g.entries))
+	} else {
+		fmt.Fprintf(&b, "⚠️  *OFFLINE* – **%s** (%d of %d checks)", g.member, offline, len(g.entries))
+		fmt.Fprintf(&h, "⚠️  <strong>OFFLINE</strong> – <strong>%s</strong> (%d of %d checks)", g.member, offline, len(g.entries))
+	}
+
+	for _, e := range g.entries {
+		line := groupEntryLine(e)
+		b.WriteString("\n" + line)
+		h.WriteString("<br/>" + line)
+	}
+
+	if offline > 0 && downtime != "" {
+		fmt.Fprintf(&b, "\n• Down for: %s", downtime)
+		fmt.Fprintf(&h, "<br/>• Down for: %s", downtime)
+	}
+
+	return b.String(), h.String()
+}
+
+func groupEntryLine(e *alertEntry) string {
+	d := e.details
+	icon := "⚠️"
+	if e.online {
+		icon = "✅"
+	}
+
+	line := fmt.Sprintf("• %s %s / %s", icon, d.checkType, d.checkName)
+	if d.domain != "" {
+		line += " – " + d.domain
+	}
+	if d.endpoint != "" {
+		line += " – " + d.endpoint
+	}
+	if d.ipv6 {
+		line += " (IPv6)"
+	}
+	if !e.online && d.errText != "" {
+		line += " – Error: " + d.errText
+	}
+	return line
+}
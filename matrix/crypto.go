@@ -0,0 +1,35 @@
+package matrix
+
+import (
+	"path/filepath"
+	"sync"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+var (
+	cryptoMu     sync.Mutex
+	cryptoCloser func() // tears down the crypto helper and sync loop, if any
+)
+
+func setCryptoCloser(fn func()) {
+	cryptoMu.Lock()
+	cryptoCloser = fn
+	cryptoMu.Unlock()
+}
+
+// stopCrypto releases any crypto state left over from a previous login.
+func stopCrypto() {
+	cryptoMu.Lock()
+	fn := cryptoCloser
+	cryptoCloser = nil
+	cryptoMu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// cryptoStorePath returns where device keys and Olm/Megolm sessions persist.
+func cryptoStorePath() string {
+	return filepath.Join(cfg.GetConfig().Local.System.WorkDir, "matrix", "crypto.db")
+}
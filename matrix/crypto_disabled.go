@@ -0,0 +1,17 @@
+//go:build !e2ee
+
+package matrix
+
+import (
+	"context"
+	"errors"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+
+	"maunium.net/go/mautrix"
+)
+
+// enableEncryption is unavailable unless built with the e2ee tag.
+func enableEncryption(_ context.Context, _ *mautrix.Client, _ cfg.MatrixConfig, _ *mautrix.ReqLogin) (func(), error) {
+	return nil, errors.New("matrix encryption requested but this binary was built without the e2ee build tag")
+}
@@ -0,0 +1,74 @@
+//go:build e2ee
+
+// Building with the e2ee tag links mautrix's crypto package, which uses
+// libolm through cgo: it needs CGO_ENABLED=1, a C compiler and libolm-dev
+// (3.2+). Add the goolm tag (-tags e2ee,goolm) to use mautrix's pure Go Olm
+// instead. See docs/MATRIX.md.
+
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/crypto/cryptohelper"
+)
+
+// enableEncryption logs in through the mautrix crypto helper, persisting the
+// device and its keys under WorkDir/matrix, and starts the sync loop needed
+// to track room membership and share Megolm sessions. The returned closer
+// stops syncing and closes the crypto store.
+//
+// The crypto store is SQLite; the final binary must register a
+// "sqlite3-fk-wal" driver (e.g. by importing go.mau.fi/util/dbutil/litestream).
+func enableEncryption(ctx context.Context, cli *mautrix.Client, c cfg.MatrixConfig, login *mautrix.ReqLogin) (func(), error) {
+	if c.PickleKey == "" {
+		return nil, errors.New("PickleKey is required when Encryption is enabled")
+	}
+
+	path := cryptoStorePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create crypto store dir: %w", err)
+	}
+
+	helper, err := cryptohelper.NewCryptoHelper(cli, []byte(c.PickleKey), path)
+	if err != nil {
+		return nil, fmt.Errorf("create crypto helper: %w", err)
+	}
+	helper.LoginAs = login
+
+	if err := helper.Init(ctx); err != nil {
+		_ = helper.Close()
+		return nil, fmt.Errorf("init crypto helper: %w", err)
+	}
+	cli.Crypto = helper
+
+	syncCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			err := cli.SyncWithContext(syncCtx)
+			if syncCtx.Err() != nil {
+				return
+			}
+			log.Log(log.Warn, "[matrix] sync stopped, restarting: %v", err)
+			time.Sleep(10 * time.Second)
+		}
+	}()
+
+	log.Log(log.Info, "[matrix] end-to-end encryption enabled (device %s)", cli.DeviceID)
+
+	return func() {
+		cancel()
+		if err := helper.Close(); err != nil {
+			log.Log(log.Warn, "[matrix] close crypto helper: %v", err)
+		}
+	}, nil
+}
@@ -0,0 +1,134 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+
+	"maunium.net/go/mautrix/id"
+)
+
+const escalationTick = time.Minute
+
+// escalationThreshold returns the elapsed downtime at which the n-th
+// (zero-based) escalation should fire. ok is false when no further
+// escalations are configured.
+func escalationThreshold(ec cfg.EscalationConfig, n int) (time.Duration, bool) {
+	if !ec.Enabled || n < 0 {
+		return 0, false
+	}
+
+	intervals := make([]int, 0, len(ec.IntervalMinutes))
+	for _, m := range ec.IntervalMinutes {
+		if m > 0 {
+			intervals = append(intervals, m)
+		}
+	}
+
+	if n < len(intervals) {
+		return time.Duration(intervals[n]) * time.Minute, true
+	}
+	if ec.RepeatMinutes <= 0 {
+		return 0, false
+	}
+
+	base := 0
+	if len(intervals) > 0 {
+		base = intervals[len(intervals)-1]
+	}
+	steps := n - len(intervals) + 1
+	if len(intervals) == 0 {
+		steps = n + 1
+	}
+	return time.Duration(base+steps*ec.RepeatMinutes) * time.Minute, true
+}
+
+// formatDowntime renders an elapsed duration as e.g. "1d 4h 12m".
+func formatDowntime(d time.Duration) string {
+	return alerts.FormatDuration(d)
+}
+
+// escalationLoop periodically re-notifies outages that remain open past the
+// configured escalation thresholds.
+func escalationLoop() {
+	t := time.NewTicker(escalationTick)
+	defer t.Stop()
+	for range t.C {
+		if !isReady() {
+			continue
+		}
+		ec := cfg.GetConfig().Alerts.Escalation
+		if !ec.Enabled {
+			continue
+		}
+		runEscalations(ec, time.Now().UTC())
+	}
+}
+
+func runEscalations(ec cfg.EscalationConfig, now time.Time) {
+	seen := make(map[*alertGroup]struct{})
+	groups.Range(func(k, v interface{}) bool {
+		g, ok := v.(*alertGroup)
+		if !ok {
+			groups.Delete(k)
+			return true
+		}
+		if _, dup := seen[g]; dup {
+			return true
+		}
+		seen[g] = struct{}{}
+
+		g.mu.Lock()
+		if g.evID == "" || g.allOnline() {
+			g.mu.Unlock()
+			return true
+		}
+
+		elapsed := now.Sub(g.startedAt)
+		due, ok := escalationThreshold(ec, g.escalations)
+		if !ok || elapsed < due {
+			g.mu.Unlock()
+			return true
+		}
+		g.escalations++
+
+		downtime := formatDowntime(elapsed)
+		mentions := getMemberMentions(g.member)
+		body, html := renderGroup(g, mentions, downtime)
+		evID, member := g.evID, g.member
+		g.mu.Unlock()
+
+		go escalate(ec, evID, member, body, html, downtime)
+		return true
+	})
+}
+
+// escalate edits the original alert with the elapsed downtime and posts a
+// fresh reminder, optionally to the internal room.
+func escalate(ec cfg.EscalationConfig, evID id.EventID, member, body, html, downtime string) {
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	if err := editFormattedText(ctx, evID, body, html); err != nil {
+		log.Log(log.Warn, "[matrix] escalation edit failed for %s: %v", member, err)
+	}
+
+	target := roomID
+	if ec.InternalRoom {
+		if internal := cfg.GetConfig().Alerts.Matrix.InternalRoom; internal != "" {
+			target = id.RoomID(internal)
+		}
+	}
+
+	remBody := fmt.Sprintf("⏰  *STILL OFFLINE* for %s\n", downtime) + body
+	remHTML := fmt.Sprintf("⏰  <strong>STILL OFFLINE</strong> for %s<br/>", downtime) + html
+	if _, err := sendFormattedTextToRoom(ctx, target, remBody, remHTML); err != nil {
+		log.Log(log.Error, "[matrix] failed to send escalation for %s: %v", member, err)
+		return
+	}
+	log.Log(log.Info, "[matrix] escalated outage for %s after %s", member, downtime)
+}
@@ -3,15 +3,16 @@ package matrix
 import (
 	"context"
 	"fmt"
+	"html"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
 	cfg "github.com/ibp-network/ibp-geodns-libs/config"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
 
 	"maunium.net/go/mautrix"
-	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 )
 
@@ -31,7 +32,10 @@ var (
 // -----------------------------------------------------------------------------
 func Init() {
 	once.Do(func() {
+		alerts.RegisterSink(alertSink{})
+		startSendWorkers()
 		go loginLoop()
+		go escalationLoop()
 	})
 }
 
@@ -51,26 +55,43 @@ func loginLoop() {
 			continue
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-		resp, err := cli.Login(ctx, &mautrix.ReqLogin{
+		req := &mautrix.ReqLogin{
 			Type: "m.login.password",
 			Identifier: mautrix.UserIdentifier{
 				Type: "m.id.user",
 				User: c.Username,
 			},
 			Password: c.Password,
-		})
-		cancel()
+		}
 
-		if err != nil {
-			log.Log(log.Error, "[matrix] login failed: %v", err)
-			time.Sleep(30 * time.Second)
-			continue
+		stopCrypto()
+		if c.Encryption {
+			// The crypto helper performs the login itself so the device ID
+			// matches the persisted crypto store.
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			closer, err := enableEncryption(ctx, cli, c, req)
+			cancel()
+			if err != nil {
+				log.Log(log.Error, "[matrix] enable encryption: %v", err)
+				time.Sleep(30 * time.Second)
+				continue
+			}
+			setCryptoCloser(closer)
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			resp, err := cli.Login(ctx, req)
+			cancel()
+
+			if err != nil {
+				log.Log(log.Error, "[matrix] login failed: %v", err)
+				time.Sleep(30 * time.Second)
+				continue
+			}
+			cli.SetCredentials(resp.UserID, resp.AccessToken)
 		}
 
-		cli.SetCredentials(resp.UserID, resp.AccessToken)
 		client = cli
-		userID = resp.UserID
+		userID = cli.UserID
 		roomID = id.RoomID(c.RoomID)
 
 		log.Log(log.Info, "[matrix] logged in as %s; ready to post to %s", userID, roomID)
@@ -145,15 +166,43 @@ func claimOutageAlert(key string) bool {
 	}
 }
 
+// getMemberMentions returns the Matrix users to mention in alerts of
+// memberName, from the member's notification routes.
 func getMemberMentions(memberName string) []string {
-	c := cfg.GetConfig()
+	return alerts.RoutesFor(memberName).Matrix
+}
 
-	memberKey := strings.ToLower(memberName)
-	if users, ok := c.Alerts.Matrix.Members[memberKey]; ok {
-		return users
+// renderAlert formats a member outage alert with the configured alert
+// templates, using formatAlert for the parts without one. Mentions always
+// lead the message, so templates cannot drop them.
+func renderAlert(ev alerts.Event, mentions []string) (body, formatted string) {
+	body, formatted = formatAlert(ev.Kind == alerts.KindOffline, ev.Member, ev.CheckType, ev.CheckName,
+		ev.Domain, ev.Endpoint, ev.IPv6, ev.Error, mentions)
+	msg, ok := alerts.Render(ev)
+	if !ok || (msg.Text == "" && msg.HTML == "") {
+		return body, formatted
 	}
 
-	return nil
+	mentionText, mentionHTML := "", ""
+	if len(mentions) > 0 {
+		mentionText = strings.Join(mentions, " ") + "\n"
+		mentionHTML = strings.Join(mentions, " ") + "<br/>"
+	}
+	if msg.Text != "" {
+		body = mentionText + strings.TrimRight(msg.Text, "\n")
+	}
+	switch {
+	case msg.HTML != "":
+		formatted = mentionHTML + msg.HTML
+	case msg.Text != "":
+		formatted = mentionHTML + textToHTML(strings.TrimRight(msg.Text, "\n"))
+	}
+	return body, formatted
+}
+
+// textToHTML escapes text and keeps its line breaks.
+func textToHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br/>")
 }
 
 // formatAlert creates both plain text and HTML versions of an alert message.
@@ -200,6 +249,11 @@ func formatAlert(isOffline bool, member, checkType, checkName, domain, endpoint
 
 // sendFormattedText posts an HTML formatted message.
 func sendFormattedText(ctx context.Context, body, formattedBody string) (id.EventID, error) {
+	return sendFormattedTextToRoom(ctx, roomID, body, formattedBody)
+}
+
+// sendFormattedTextToRoom posts an HTML formatted message to a specific room.
+func sendFormattedTextToRoom(ctx context.Context, room id.RoomID, body, formattedBody string) (id.EventID, error) {
 	content := map[string]interface{}{
 		"msgtype":        "m.text",
 		"body":           body,
@@ -207,11 +261,7 @@ func sendFormattedText(ctx context.Context, body, formattedBody string) (id.Even
 		"formatted_body": formattedBody,
 	}
 
-	resp, err := client.SendMessageEvent(ctx, roomID, event.EventMessage, content)
-	if err != nil {
-		return "", err
-	}
-	return resp.EventID, nil
+	return enqueueSend(ctx, room, content)
 }
 
 // editFormattedText performs an *in‑place* edit with HTML content.
@@ -233,7 +283,7 @@ func editFormattedText(ctx context.Context, target id.EventID, body, formattedBo
 		},
 	}
 
-	_, err := client.SendMessageEvent(ctx, roomID, event.EventMessage, content)
+	_, err := enqueueSend(ctx, roomID, content)
 	return err
 }
 
@@ -242,7 +292,9 @@ func editFormattedText(ctx context.Context, target id.EventID, body, formattedBo
 // -----------------------------------------------------------------------------
 
 // NotifyMemberOffline posts a single alert for a given outage, regardless of
-// how many times the caller tries to report it.
+// how many times the caller tries to report it. Outages for the same member
+// reported within coalesceWindow are combined into one message; delivery
+// happens in the background.
 func NotifyMemberOffline(
 	member, checkType, checkName, domain, endpoint string,
 	ipv6 bool, errText string,
@@ -256,27 +308,42 @@ func NotifyMemberOffline(
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	queueOffline(key, outageDetails{
+		member:    member,
+		checkType: checkType,
+		checkName: checkName,
+		domain:    domain,
+		endpoint:  endpoint,
+		ipv6:      ipv6,
+		errText:   errText,
+	})
+}
 
-	// Get member mentions and format message
-	mentions := getMemberMentions(member)
-	body, formattedBody := formatAlert(true, member, checkType, checkName, domain, endpoint, ipv6, errText, mentions)
+// SendToRoom posts an HTML formatted message to an arbitrary room. An empty
+// room posts to the configured alert room.
+func SendToRoom(room, body, formattedBody string) error {
+	if !isReady() {
+		return fmt.Errorf("matrix client not ready")
+	}
 
-	evID, err := sendFormattedText(ctx, body, formattedBody)
-	if err != nil {
-		// Clean‑up sentinel so future attempts can retry.
-		offlineMap.Delete(key)
-		log.Log(log.Error, "[matrix] failed to send offline alert: %v", err)
-		return
+	target := roomID
+	if room != "" {
+		target = id.RoomID(room)
 	}
 
-	offlineMap.Store(key, evID)
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	if _, err := sendFormattedTextToRoom(ctx, target, body, formattedBody); err != nil {
+		return fmt.Errorf("send to %s: %w", target, err)
+	}
+	return nil
 }
 
 // NotifyMemberOnline edits the existing alert back to *ONLINE* status.  If the
 // original alert is missing or the edit fails, it falls back to sending a new
-// message.
+// message. Outage state is released immediately so a fresh outage can be
+// announced while the edit is still being delivered.
 func NotifyMemberOnline(
 	member, checkType, checkName, domain, endpoint string,
 	ipv6 bool,
@@ -286,32 +353,50 @@ func NotifyMemberOnline(
 	}
 
 	key := makeKey(member, checkType, checkName, domain, endpoint, ipv6)
+	details := outageDetails{
+		member:    member,
+		checkType: checkType,
+		checkName: checkName,
+		domain:    domain,
+		endpoint:  endpoint,
+		ipv6:      ipv6,
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Flapped within the coalescing window – nothing was posted yet.
+	if cancelPending(member, key) {
+		offlineMap.Delete(key)
+		return
+	}
 
-	// Format message (no mentions for online alerts)
-	body, formattedBody := formatAlert(false, member, checkType, checkName, domain, endpoint, ipv6, "", nil)
-
-	if raw, ok := offlineMap.Load(key); ok {
-		if evID, ok2 := storedEventID(raw); ok2 && evID != "" {
-			// Attempt edit‑in‑place.
-			editErr := editFormattedText(ctx, evID, body, formattedBody)
-			if editErr == nil {
-				offlineMap.Delete(key)
-				return
-			}
-			log.Log(log.Warn, "[matrix] edit failed – falling back to new msg: %v", editErr)
-		} else if !ok2 {
+	raw, loaded := offlineMap.LoadAndDelete(key)
+	gv, grouped := groups.LoadAndDelete(key)
+
+	if loaded {
+		evID, ok := storedEventID(raw)
+		switch {
+		case !ok:
 			log.Log(log.Warn, "[matrix] invalid cached event for %s; sending a new online alert", key)
-			offlineMap.Delete(key)
+		case evID == "":
+			// The offline alert is still in flight; flushPending notices the
+			// missing key and marks the entry recovered once it is posted.
+			return
+		case grouped:
+			go resolveGroupEntry(gv.(*alertGroup), key, details)
+			return
 		}
 	}
 
-	// Either we had no cached event or the edit did not work – send a fresh one.
+	// No cached event – send a fresh one.
+	go sendOnline(details)
+}
+
+func sendOnline(d outageDetails) {
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	// Format message (no mentions for online alerts)
+	body, formattedBody := renderAlert(d.event(false, time.Time{}), nil)
 	if _, err := sendFormattedText(ctx, body, formattedBody); err != nil {
 		log.Log(log.Error, "[matrix] failed to send online alert: %v", err)
-		return
 	}
-	offlineMap.Delete(key) // ensure future OFFLINE alerts are allowed again
 }
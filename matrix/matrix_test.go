@@ -1,8 +1,19 @@
 package matrix
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+
+	"maunium.net/go/mautrix"
 
 	"maunium.net/go/mautrix/id"
 )
@@ -39,3 +50,237 @@ func TestClaimOutageAlertRejectsExistingEventID(t *testing.T) {
 		t.Fatalf("expected existing event ID to prevent a duplicate outage alert")
 	}
 }
+
+func TestEscalationThresholdUsesIntervalsThenRepeat(t *testing.T) {
+	ec := cfg.EscalationConfig{
+		Enabled:         true,
+		IntervalMinutes: []int{60, 240},
+		RepeatMinutes:   720,
+	}
+
+	want := []time.Duration{60 * time.Minute, 240 * time.Minute, 960 * time.Minute, 1680 * time.Minute}
+	for n, expected := range want {
+		got, ok := escalationThreshold(ec, n)
+		if !ok {
+			t.Fatalf("expected escalation %d to be scheduled", n)
+		}
+		if got != expected {
+			t.Fatalf("escalation %d: expected %v, got %v", n, expected, got)
+		}
+	}
+}
+
+func TestEscalationThresholdStopsWithoutRepeat(t *testing.T) {
+	ec := cfg.EscalationConfig{Enabled: true, IntervalMinutes: []int{30}}
+
+	if _, ok := escalationThreshold(ec, 1); ok {
+		t.Fatalf("expected no escalation after intervals are exhausted")
+	}
+	if _, ok := escalationThreshold(cfg.EscalationConfig{IntervalMinutes: []int{30}}, 0); ok {
+		t.Fatalf("expected disabled escalation config to never fire")
+	}
+}
+
+func TestFormatDowntime(t *testing.T) {
+	cases := map[time.Duration]string{
+		30 * time.Second:              "<1m",
+		45 * time.Minute:              "45m",
+		12*time.Hour + 3*time.Minute:  "12h 3m",
+		26*time.Hour + 90*time.Second: "1d 2h 1m",
+	}
+	for d, want := range cases {
+		if got := formatDowntime(d); got != want {
+			t.Fatalf("formatDowntime(%v): expected %q, got %q", d, want, got)
+		}
+	}
+}
+
+func TestRetryAfterHonoursRateLimitHints(t *testing.T) {
+	limited := mautrix.HTTPError{
+		RespError: &mautrix.RespError{
+			ErrCode:   mautrix.MLimitExceeded.ErrCode,
+			ExtraData: map[string]any{"retry_after_ms": float64(1500)},
+		},
+	}
+	if wait, ok := retryAfter(limited); !ok || wait != 1500*time.Millisecond {
+		t.Fatalf("expected 1.5s back-off from retry_after_ms, got %v (limited=%v)", wait, ok)
+	}
+
+	header := mautrix.HTTPError{
+		Response: &http.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{"Retry-After": []string{"7"}},
+		},
+	}
+	if wait, ok := retryAfter(fmt.Errorf("send: %w", header)); !ok || wait != 7*time.Second {
+		t.Fatalf("expected 7s back-off from Retry-After header, got %v (limited=%v)", wait, ok)
+	}
+
+	if _, ok := retryAfter(errors.New("connection refused")); ok {
+		t.Fatal("expected plain errors not to be treated as rate limits")
+	}
+}
+
+func TestCancelPendingDropsFlappedOutage(t *testing.T) {
+	pendingMu.Lock()
+	pending = map[string]*alertGroup{
+		"provider1": {member: "provider1", entries: []*alertEntry{{key: "a"}, {key: "b"}}},
+	}
+	pendingMu.Unlock()
+
+	if !cancelPending("provider1", "a") {
+		t.Fatal("expected pending outage to be cancelled")
+	}
+	if cancelPending("provider1", "a") {
+		t.Fatal("expected second cancel to report nothing pending")
+	}
+	if !cancelPending("provider1", "b") {
+		t.Fatal("expected remaining outage to be cancelled")
+	}
+	if _, ok := pending["provider1"]; ok {
+		t.Fatal("expected empty pending group to be removed")
+	}
+}
+
+func TestRenderGroupCombinesOutages(t *testing.T) {
+	g := &alertGroup{
+		member: "provider1",
+		entries: []*alertEntry{
+			{key: "a", details: outageDetails{member: "provider1", checkType: "site", checkName: "ping", errText: "timeout"}},
+			{key: "b", details: outageDetails{member: "provider1", checkType: "endpoint", checkName: "wss", endpoint: "wss://x"}, online: true},
+		},
+	}
+
+	body, _ := renderGroup(g, []string{"@ops:example.org"}, "2h 0m")
+	for _, want := range []string{"@ops:example.org", "(1 of 2 checks)", "⚠️ site / ping – Error: timeout", "✅ endpoint / wss – wss://x", "Down for: 2h 0m"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in combined alert:\n%s", want, body)
+		}
+	}
+
+	g.entries[0].online = true
+	body, _ = renderGroup(g, []string{"@ops:example.org"}, "")
+	if strings.Contains(body, "@ops") || !strings.Contains(body, "ONLINE") {
+		t.Fatalf("expected fully recovered group without mentions:\n%s", body)
+	}
+}
+
+type roomPost struct {
+	room, body string
+}
+
+func capturePosts(t *testing.T, c cfg.Config) func() []roomPost {
+	t.Helper()
+	var (
+		mu    sync.Mutex
+		posts []roomPost
+	)
+	orig := postToRoom
+	postToRoom = func(room, body, _ string) error {
+		mu.Lock()
+		posts = append(posts, roomPost{room, body})
+		mu.Unlock()
+		return nil
+	}
+	prev := cfg.SetConfig(c)
+	t.Cleanup(func() {
+		postToRoom = orig
+		cfg.SetConfig(prev)
+	})
+	return func() []roomPost {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]roomPost(nil), posts...)
+	}
+}
+
+func TestOperationalEventsRouteBySeverity(t *testing.T) {
+	c := cfg.Config{}
+	c.Alerts.Matrix.InternalRoom = "!ops:example.org"
+	c.Alerts.Severity.Internal = "warning"
+	c.Alerts.Severity.Room = "critical"
+	posts := capturePosts(t, c)
+
+	for _, ev := range []alerts.Event{
+		{Kind: alerts.KindClusterChanged, CheckType: alerts.CheckTypeCluster, Message: "node joined"},
+		{Kind: alerts.KindClockSkew, CheckType: alerts.CheckTypeCluster, Message: "node-b 3s ahead"},
+	} {
+		if err := (alertSink{}).Send(context.Background(), ev); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	got := posts()
+	if len(got) != 1 || got[0].room != "!ops:example.org" || !strings.Contains(got[0].body, "CLOCK SKEW") {
+		t.Fatalf("expected only the warning in the internal room, got %+v", got)
+	}
+
+	// Without an internal room the alert room and its severity apply.
+	c.Alerts.Matrix.InternalRoom = ""
+	cfg.SetConfig(c)
+	if err := (alertSink{}).Send(context.Background(), alerts.Event{Kind: alerts.KindClockSkew, CheckType: alerts.CheckTypeCluster}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := (alertSink{}).Send(context.Background(), alerts.Event{Kind: alerts.KindQuorumLost, CheckType: alerts.CheckTypeCluster}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	got = posts()
+	if len(got) != 2 || got[1].room != "" || !strings.Contains(got[1].body, "QUORUM LOST") {
+		t.Fatalf("expected only the critical event in the alert room, got %+v", got)
+	}
+}
+
+func TestVoteBreakdownGoesToInternalRoom(t *testing.T) {
+	c := cfg.Config{}
+	c.Alerts.Matrix.InternalRoom = "!ops:example.org"
+	posts := capturePosts(t, c)
+
+	ev := alerts.Event{
+		Kind: alerts.KindOffline, Member: "provider1", CheckType: "endpoint", CheckName: "wss",
+		Votes: map[string]bool{"node-b": true, "node-a": true, "node-c": false},
+	}
+	if err := (alertSink{}).Send(context.Background(), ev); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	got := posts()
+	if len(got) != 1 || got[0].room != "!ops:example.org" {
+		t.Fatalf("expected one post to the internal room, got %+v", got)
+	}
+	for _, want := range []string{"VOTES provider1 endpoint/wss", "2 of 3 monitors", "Offline: node-a, node-b", "Online: node-c"} {
+		if !strings.Contains(got[0].body, want) {
+			t.Fatalf("expected %q in vote breakdown:\n%s", want, got[0].body)
+		}
+	}
+
+	// Unanimous votes are info, below a warning threshold.
+	c.Alerts.Severity.Internal = "warning"
+	cfg.SetConfig(c)
+	ev.Votes = map[string]bool{"node-a": true}
+	if err := (alertSink{}).Send(context.Background(), ev); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if got := posts(); len(got) != 1 {
+		t.Fatalf("expected unanimous votes to be filtered, got %+v", got)
+	}
+}
+
+func TestRenderAlertUsesTemplatesAndKeepsMentions(t *testing.T) {
+	ev := outageDetails{member: "provider1", checkType: "site", checkName: "ping", errText: "a < b"}.event(true, time.Time{})
+
+	body, _ := renderAlert(ev, nil)
+	if !strings.Contains(body, "*OFFLINE*") {
+		t.Fatalf("expected the built-in format without templates:\n%s", body)
+	}
+
+	c := cfg.Config{}
+	c.Alerts.Templates.Messages = map[string]cfg.AlertTemplate{"offline": {Text: "{{.Member}} down\n{{.Error}}\n"}}
+	prev := cfg.SetConfig(c)
+	t.Cleanup(func() { cfg.SetConfig(prev) })
+
+	body, formatted := renderAlert(ev, []string{"@ops:example.org"})
+	if body != "@ops:example.org\nprovider1 down\na < b" {
+		t.Fatalf("unexpected body %q", body)
+	}
+	if formatted != "@ops:example.org<br/>provider1 down<br/>a &lt; b" {
+		t.Fatalf("expected the text as escaped HTML, got %q", formatted)
+	}
+}
@@ -0,0 +1,182 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+// -----------------------------------------------------------------------------
+// SEND QUEUE
+// -----------------------------------------------------------------------------
+//
+// Every outgoing event goes through a bounded queue drained by a small,
+// fixed pool of workers. When the homeserver answers 429 / M_LIMIT_EXCEEDED
+// all workers pause until the advertised Retry-After has elapsed and the
+// event is retried instead of being dropped.
+
+const (
+	sendWorkers      = 2
+	sendQueueSize    = 512
+	maxSendAttempts  = 6
+	defaultRetryWait = 5 * time.Second
+	maxRetryWait     = 2 * time.Minute
+)
+
+type sendResult struct {
+	evID id.EventID
+	err  error
+}
+
+type sendJob struct {
+	ctx     context.Context
+	room    id.RoomID
+	content map[string]interface{}
+	done    chan sendResult
+}
+
+var (
+	sendQueue        = make(chan *sendJob, sendQueueSize)
+	sendWorkersOnce  sync.Once
+	rateLimitedUntil atomic.Int64 // unix nanos; shared back-off gate
+)
+
+func startSendWorkers() {
+	sendWorkersOnce.Do(func() {
+		for i := 0; i < sendWorkers; i++ {
+			go sendWorker()
+		}
+	})
+}
+
+func sendWorker() {
+	for job := range sendQueue {
+		evID, err := deliver(job)
+		job.done <- sendResult{evID: evID, err: err}
+	}
+}
+
+// enqueueSend hands content to the send queue and waits for the outcome.
+func enqueueSend(ctx context.Context, room id.RoomID, content map[string]interface{}) (id.EventID, error) {
+	startSendWorkers()
+
+	job := &sendJob{
+		ctx:     ctx,
+		room:    room,
+		content: content,
+		done:    make(chan sendResult, 1),
+	}
+
+	select {
+	case sendQueue <- job:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	select {
+	case res := <-job.done:
+		return res.evID, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// deliver sends a single job, retrying while the homeserver rate-limits us.
+func deliver(job *sendJob) (id.EventID, error) {
+	var lastErr error
+	for attempt := 1; attempt <= maxSendAttempts; attempt++ {
+		if err := waitForRateLimit(job.ctx); err != nil {
+			return "", err
+		}
+
+		cli := client
+		if cli == nil {
+			return "", errors.New("matrix client not ready")
+		}
+
+		resp, err := cli.SendMessageEvent(job.ctx, job.room, event.EventMessage, job.content)
+		if err == nil {
+			return resp.EventID, nil
+		}
+		lastErr = err
+
+		wait, limited := retryAfter(err)
+		if !limited {
+			return "", err
+		}
+		until := time.Now().Add(wait).UnixNano()
+		for {
+			cur := rateLimitedUntil.Load()
+			if cur >= until || rateLimitedUntil.CompareAndSwap(cur, until) {
+				break
+			}
+		}
+		log.Log(log.Warn, "[matrix] rate limited (attempt %d/%d), backing off %s", attempt, maxSendAttempts, wait)
+	}
+	return "", lastErr
+}
+
+func waitForRateLimit(ctx context.Context) error {
+	until := rateLimitedUntil.Load()
+	d := time.Until(time.Unix(0, until))
+	if until == 0 || d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryAfter reports whether err is a rate-limit response and how long to
+// wait before retrying, honouring retry_after_ms and the Retry-After header.
+func retryAfter(err error) (time.Duration, bool) {
+	var httpErr mautrix.HTTPError
+	if !errors.As(err, &httpErr) {
+		return 0, false
+	}
+
+	limited := false
+	wait := time.Duration(0)
+
+	if httpErr.RespError != nil && httpErr.RespError.ErrCode == mautrix.MLimitExceeded.ErrCode {
+		limited = true
+		if ms, ok := httpErr.RespError.ExtraData["retry_after_ms"].(float64); ok && ms > 0 {
+			wait = time.Duration(ms) * time.Millisecond
+		}
+	}
+	if httpErr.Response != nil && httpErr.Response.StatusCode == http.StatusTooManyRequests {
+		limited = true
+		if wait == 0 {
+			if secs, perr := strconv.Atoi(httpErr.Response.Header.Get("Retry-After")); perr == nil && secs > 0 {
+				wait = time.Duration(secs) * time.Second
+			}
+		}
+	}
+
+	if !limited {
+		return 0, false
+	}
+	if wait <= 0 {
+		wait = defaultRetryWait
+	}
+	if wait > maxRetryWait {
+		wait = maxRetryWait
+	}
+	return wait, true
+}
@@ -0,0 +1,166 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// ROUTING
+// -----------------------------------------------------------------------------
+//
+// Members read the alert room, so it gets their outage notices only.
+// Operational detail goes to Alerts.matrix.internal_room: cluster health,
+// service redundancy, clock skew, usage anomalies and the monitor votes
+// behind each outage. Without an internal room the operational events still
+// go to the alert room, as before, but vote breakdowns are not posted. Each
+// room drops events below its configured severity.
+
+// postToRoom posts to a Matrix room; tests replace it.
+var postToRoom = SendToRoom
+
+// alertSink adapts the Matrix notifier to the alerts dispatcher.
+type alertSink struct{}
+
+func (alertSink) Name() string { return "matrix" }
+
+func (alertSink) Send(_ context.Context, ev alerts.Event) error {
+	switch ev.Kind {
+	case alerts.KindOffline:
+		if roomAccepts(cfg.GetConfig().Alerts.Severity.Room, ev.Kind.Severity()) {
+			NotifyMemberOffline(ev.Member, ev.CheckType, ev.CheckName, ev.Domain, ev.Endpoint, ev.IPv6, ev.Error)
+		}
+		return notifyVotes(ev)
+	case alerts.KindOnline:
+		if roomAccepts(cfg.GetConfig().Alerts.Severity.Room, ev.Kind.Severity()) {
+			NotifyMemberOnline(ev.Member, ev.CheckType, ev.CheckName, ev.Domain, ev.Endpoint, ev.IPv6)
+		}
+	case alerts.KindQuorumLost, alerts.KindQuorumRestored, alerts.KindClusterChanged,
+		alerts.KindRedundancyLost, alerts.KindRedundancyRestored,
+		alerts.KindClockSkew, alerts.KindClockSynced, alerts.KindUsageAnomaly:
+		return notifyClusterHealth(ev)
+	}
+	return nil
+}
+
+// roomAccepts reports whether a room taking events from severity least on
+// accepts sev. An invalid least is logged and accepts everything, so a
+// typo never silences a room.
+func roomAccepts(least string, sev alerts.Severity) bool {
+	threshold, err := alerts.ParseSeverity(least)
+	if err != nil {
+		log.Log(log.Warn, "[matrix] %v; posting every alert", err)
+		return true
+	}
+	return sev >= threshold
+}
+
+// internalRoom returns the room for operational events and its least
+// severity: the internal room when one is configured, else the alert room.
+func internalRoom() (room, least string) {
+	a := cfg.GetConfig().Alerts
+	if a.Matrix.InternalRoom != "" {
+		return a.Matrix.InternalRoom, a.Severity.Internal
+	}
+	return "", a.Severity.Room
+}
+
+// notifyClusterHealth posts cluster health, clock skew, service redundancy
+// and usage anomaly events to the internal room when one is configured, since they
+// concern operators rather than members.
+func notifyClusterHealth(ev alerts.Event) error {
+	room, least := internalRoom()
+	if !roomAccepts(least, ev.Kind.Severity()) {
+		return nil
+	}
+
+	icon, title := "ℹ️", "CLUSTER CHANGED"
+	switch ev.Kind {
+	case alerts.KindQuorumLost:
+		icon, title = "🚨", "QUORUM LOST"
+	case alerts.KindQuorumRestored:
+		icon, title = "✅", "QUORUM RESTORED"
+	case alerts.KindRedundancyLost:
+		icon, title = "🚨", "REDUNDANCY LOST"
+	case alerts.KindRedundancyRestored:
+		icon, title = "✅", "REDUNDANCY RESTORED"
+	case alerts.KindClockSkew:
+		icon, title = "⚠️", "CLOCK SKEW"
+	case alerts.KindClockSynced:
+		icon, title = "✅", "CLOCK SYNCED"
+	case alerts.KindUsageAnomaly:
+		icon, title = "⚠️", "USAGE ANOMALY"
+	}
+	if ev.Domain != "" {
+		scope := ev.Domain
+		if ev.Endpoint != "" {
+			scope += "/" + ev.Endpoint
+		}
+		title += " (" + scope + ")"
+	}
+	body := fmt.Sprintf("%s  *%s*\n%s", icon, title, ev.Message)
+	formatted := fmt.Sprintf("%s  <strong>%s</strong><br/>%s", icon, title, html.EscapeString(ev.Message))
+	if msg, ok := alerts.Render(ev); ok {
+		if msg.Text != "" {
+			body = strings.TrimRight(msg.Text, "\n")
+		}
+		switch {
+		case msg.HTML != "":
+			formatted = msg.HTML
+		case msg.Text != "":
+			formatted = textToHTML(body)
+		}
+	}
+	return postToRoom(room, body, formatted)
+}
+
+// notifyVotes posts the monitor votes behind an offline event to the
+// internal room: info when the monitors agreed, warning when some of them
+// saw the member online.
+func notifyVotes(ev alerts.Event) error {
+	a := cfg.GetConfig().Alerts
+	if a.Matrix.InternalRoom == "" || len(ev.Votes) == 0 {
+		return nil
+	}
+	var agree, disagree []string
+	for node, offline := range ev.Votes {
+		if offline {
+			agree = append(agree, node)
+		} else {
+			disagree = append(disagree, node)
+		}
+	}
+	sev := alerts.SeverityInfo
+	if len(disagree) > 0 {
+		sev = alerts.SeverityWarning
+	}
+	if !roomAccepts(a.Severity.Internal, sev) {
+		return nil
+	}
+	sort.Strings(agree)
+	sort.Strings(disagree)
+
+	title := fmt.Sprintf("VOTES %s %s/%s", ev.Member, ev.CheckType, ev.CheckName)
+	if ev.Domain != "" {
+		title += " " + ev.Domain
+	}
+	if ev.IPv6 {
+		title += " (IPv6)"
+	}
+	count := fmt.Sprintf("%d of %d monitors saw it offline", len(agree), len(ev.Votes))
+	body := fmt.Sprintf("🗳️  *%s*\n%s\n• Offline: %s", title, count, strings.Join(agree, ", "))
+	formatted := fmt.Sprintf("🗳️  <strong>%s</strong><br/>%s<br/>• Offline: %s",
+		html.EscapeString(title), count, html.EscapeString(strings.Join(agree, ", ")))
+	if len(disagree) > 0 {
+		body += "\n• Online: " + strings.Join(disagree, ", ")
+		formatted += "<br/>• Online: " + html.EscapeString(strings.Join(disagree, ", "))
+	}
+	return postToRoom(a.Matrix.InternalRoom, body, formatted)
+}
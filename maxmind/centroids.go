@@ -0,0 +1,122 @@
+package maxmind
+
+import (
+	"math"
+	"strings"
+	"sync"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Coordinates is a point in decimal degrees.
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+var centroidCache struct {
+	mu        sync.Mutex
+	reader    *maxminddb.Reader
+	byCountry map[string]Coordinates
+}
+
+// CountryCentroid returns the mean location of the City database networks
+// of the ISO country code. ok is false without a City database or when the
+// country has no located networks.
+func CountryCentroid(code string) (Coordinates, bool) {
+	c, ok := CountryCentroids()[strings.ToUpper(code)]
+	return c, ok
+}
+
+// CountryCentroids returns the centroid of every country in the City
+// database. The first call walks the whole database, which takes a few
+// seconds; the result is kept until another database is loaded.
+func CountryCentroids() map[string]Coordinates {
+	centroidCache.mu.Lock()
+	defer centroidCache.mu.Unlock()
+
+	reader := maxmindCity.Load()
+	if reader == nil {
+		return nil
+	}
+	if centroidCache.reader == reader {
+		return centroidCache.byCountry
+	}
+
+	byCountry, err := computeCentroids(reader)
+	if err != nil {
+		log.Log(log.Error, "[maxmind] computing country centroids: %v", err)
+		return nil
+	}
+	centroidCache.reader = reader
+	centroidCache.byCountry = byCountry
+	return byCountry
+}
+
+func computeCentroids(reader *maxminddb.Reader) (map[string]Coordinates, error) {
+	var record struct {
+		Country struct {
+			IsoCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		Location struct {
+			Latitude  *float64 `maxminddb:"latitude"`
+			Longitude *float64 `maxminddb:"longitude"`
+		} `maxminddb:"location"`
+	}
+
+	acc := make(map[string]*centroid)
+	networks := reader.Networks(maxminddb.SkipAliasedNetworks)
+	for networks.Next() {
+		record.Country.IsoCode = ""
+		record.Location.Latitude, record.Location.Longitude = nil, nil
+		if _, err := networks.Network(&record); err != nil {
+			return nil, err
+		}
+		if record.Country.IsoCode == "" || record.Location.Latitude == nil || record.Location.Longitude == nil {
+			continue
+		}
+		c, ok := acc[record.Country.IsoCode]
+		if !ok {
+			c = &centroid{}
+			acc[record.Country.IsoCode] = c
+		}
+		c.add(*record.Location.Latitude, *record.Location.Longitude)
+	}
+	if err := networks.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]Coordinates, len(acc))
+	for code, c := range acc {
+		out[code] = c.mean()
+	}
+	return out, nil
+}
+
+// centroid averages points as unit vectors, so countries spanning the
+// antimeridian are not pulled towards longitude 0.
+type centroid struct {
+	x, y, z float64
+	n       int
+}
+
+func (c *centroid) add(lat, lon float64) {
+	la, lo := lat*math.Pi/180, lon*math.Pi/180
+	c.x += math.Cos(la) * math.Cos(lo)
+	c.y += math.Cos(la) * math.Sin(lo)
+	c.z += math.Sin(la)
+	c.n++
+}
+
+func (c *centroid) mean() Coordinates {
+	if c.n == 0 {
+		return Coordinates{}
+	}
+	x, y, z := c.x/float64(c.n), c.y/float64(c.n), c.z/float64(c.n)
+	return Coordinates{
+		Latitude:  math.Atan2(z, math.Hypot(x, y)) * 180 / math.Pi,
+		Longitude: math.Atan2(y, x) * 180 / math.Pi,
+	}
+}
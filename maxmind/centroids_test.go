@@ -0,0 +1,29 @@
+package maxmind
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCentroidAcrossAntimeridian(t *testing.T) {
+	var c centroid
+	c.add(-17, 179)
+	c.add(-17, -179)
+
+	got := c.mean()
+	if math.Abs(math.Abs(got.Longitude)-180) > 0.01 || math.Abs(got.Latitude+17) > 0.1 {
+		t.Fatalf("expected centroid near (-17, 180), got %+v", got)
+	}
+}
+
+func TestCentroidMean(t *testing.T) {
+	var c centroid
+	c.add(10, 20)
+	c.add(10, 20)
+	if got := c.mean(); math.Abs(got.Latitude-10) > 1e-9 || math.Abs(got.Longitude-20) > 1e-9 {
+		t.Fatalf("expected (10, 20), got %+v", got)
+	}
+	if got := (&centroid{}).mean(); got != (Coordinates{}) {
+		t.Fatalf("expected zero coordinates for an empty centroid, got %+v", got)
+	}
+}
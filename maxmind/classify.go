@@ -0,0 +1,121 @@
+package maxmind
+
+import (
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// IP CLASSIFICATION
+// -----------------------------------------------------------------------------
+
+// IPClass is the category of a source address.
+type IPClass string
+
+const (
+	// ClassPublic is a routable unicast address.
+	ClassPublic IPClass = "public"
+	// ClassPrivate covers RFC 1918, carrier-grade NAT and IPv6 unique local
+	// addresses.
+	ClassPrivate IPClass = "private"
+	// ClassLoopback covers 127.0.0.0/8 and ::1.
+	ClassLoopback IPClass = "loopback"
+	// ClassBogon covers addresses that must not appear as sources on the
+	// internet: unspecified, link-local, documentation, benchmarking,
+	// multicast, reserved and unallocated IPv6 space.
+	ClassBogon IPClass = "bogon"
+	// ClassAnycast is a known anycast network, e.g. a public resolver whose
+	// location says nothing about the client behind it.
+	ClassAnycast IPClass = "anycast-known"
+	// ClassInvalid is returned for strings that are not IP addresses.
+	ClassInvalid IPClass = "invalid"
+)
+
+const anycastReloadHook = "maxmind.anycast"
+
+var (
+	privatePrefixes = mustPrefixes(
+		"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10",
+		"fc00::/7",
+	)
+	bogonPrefixes = mustPrefixes(
+		"0.0.0.0/8", "169.254.0.0/16", "192.0.0.0/24", "192.0.2.0/24",
+		"198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128", "100::/64", "2001:db8::/32", "fe80::/10", "ff00::/8",
+	)
+	// globalUnicast6 is the only IPv6 range allocated for global unicast.
+	globalUnicast6 = netip.MustParsePrefix("2000::/3")
+
+	// defaultAnycastPrefixes are the large public DNS resolvers.
+	defaultAnycastPrefixes = mustPrefixes(
+		"1.1.1.0/24", "1.0.0.0/24", "8.8.8.0/24", "8.8.4.0/24", "9.9.9.0/24",
+		"149.112.112.0/24", "208.67.222.0/24", "208.67.220.0/24",
+		"2606:4700:4700::/48", "2001:4860:4860::/48", "2620:fe::/48",
+		"2620:119:35::/48", "2620:119:53::/48",
+	)
+	extraAnycast atomic.Pointer[[]netip.Prefix]
+)
+
+func mustPrefixes(cidrs ...string) []netip.Prefix {
+	out := make([]netip.Prefix, len(cidrs))
+	for i, c := range cidrs {
+		out[i] = netip.MustParsePrefix(c)
+	}
+	return out
+}
+
+// ClassifyIP returns the category of ipStr. Maxmind.AnycastPrefixes adds
+// networks to the built-in anycast list.
+func ClassifyIP(ipStr string) IPClass {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ipStr))
+	if err != nil {
+		return ClassInvalid
+	}
+	addr = addr.Unmap().WithZone("")
+
+	switch {
+	case addr.IsLoopback():
+		return ClassLoopback
+	case containsAddr(privatePrefixes, addr):
+		return ClassPrivate
+	case containsAddr(bogonPrefixes, addr), addr == netip.IPv4Unspecified(),
+		addr.Is4() && addr == netip.AddrFrom4([4]byte{255, 255, 255, 255}),
+		addr.Is6() && !globalUnicast6.Contains(addr):
+		return ClassBogon
+	case containsAddr(defaultAnycastPrefixes, addr):
+		return ClassAnycast
+	}
+	if extra := extraAnycast.Load(); extra != nil && containsAddr(*extra, addr) {
+		return ClassAnycast
+	}
+	return ClassPublic
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadAnycastPrefixes parses Maxmind.AnycastPrefixes, skipping invalid
+// entries.
+func reloadAnycastPrefixes() {
+	var prefixes []netip.Prefix
+	for _, c := range cfg.GetConfig().Local.Maxmind.AnycastPrefixes {
+		p, err := netip.ParsePrefix(strings.TrimSpace(c))
+		if err != nil {
+			log.Log(log.Warn, "[maxmind] ignoring anycast prefix %q: %v", c, err)
+			continue
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	extraAnycast.Store(&prefixes)
+}
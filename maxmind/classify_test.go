@@ -0,0 +1,42 @@
+package maxmind
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestClassifyIP(t *testing.T) {
+	for ip, want := range map[string]IPClass{
+		"8.8.8.8":              ClassAnycast,
+		"2606:4700:4700::1111": ClassAnycast,
+		"93.184.216.34":        ClassPublic,
+		"2a01:4f8::1":          ClassPublic,
+		"10.0.0.1":             ClassPrivate,
+		"172.31.255.255":       ClassPrivate,
+		"100.64.1.1":           ClassPrivate,
+		"fd00::1":              ClassPrivate,
+		"127.0.0.53":           ClassLoopback,
+		"::1":                  ClassLoopback,
+		"::ffff:127.0.0.1":     ClassLoopback,
+		"0.0.0.0":              ClassBogon,
+		"169.254.1.1":          ClassBogon,
+		"198.51.100.7":         ClassBogon,
+		"239.1.1.1":            ClassBogon,
+		"255.255.255.255":      ClassBogon,
+		"fe80::1":              ClassBogon,
+		"2001:db8::1":          ClassBogon,
+		"4000::1":              ClassBogon,
+		"not-an-ip":            ClassInvalid,
+	} {
+		if got := ClassifyIP(ip); got != want {
+			t.Errorf("ClassifyIP(%s) = %s, expected %s", ip, got, want)
+		}
+	}
+
+	extra := []netip.Prefix{netip.MustParsePrefix("93.184.216.0/24")}
+	extraAnycast.Store(&extra)
+	defer extraAnycast.Store(nil)
+	if got := ClassifyIP("93.184.216.34"); got != ClassAnycast {
+		t.Fatalf("expected configured anycast prefix, got %s", got)
+	}
+}
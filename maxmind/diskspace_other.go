@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+
+package maxmind
+
+import "errors"
+
+func freeSpace(_ string) (uint64, error) {
+	return 0, errors.New("free space is not reported on this platform")
+}
@@ -0,0 +1,243 @@
+package maxmind
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// CLUSTER DISTRIBUTION
+// -----------------------------------------------------------------------------
+//
+// Only one node needs a MaxMind licence download. The publishing node (the
+// collator) downloads as usual and puts every database it has into a
+// Distributor; nodes with Maxmind.Source "cluster" fetch from it instead of
+// MaxMind. The nats package registers a Distributor backed by a JetStream
+// object store, which chunks the files.
+
+// SourceCluster is the Maxmind.Source value that fetches the databases from
+// the cluster instead of MaxMind.
+const SourceCluster = "cluster"
+
+// ErrNotDistributed is returned by a Distributor that holds no copy of the
+// requested database.
+var ErrNotDistributed = errors.New("maxmind: database not distributed")
+
+// DatabaseInfo describes one distributed database file. Stamp is the
+// Last-Modified value the publisher downloaded it with.
+type DatabaseInfo struct {
+	Name   string `json:"name"`
+	Stamp  string `json:"stamp"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Distributor stores database files for other nodes.
+type Distributor interface {
+	// Info describes the stored copy of name, or returns ErrNotDistributed.
+	Info(name string) (DatabaseInfo, error)
+	// Put stores the database read from r, replacing any previous copy.
+	Put(info DatabaseInfo, r io.Reader) error
+	// Get writes the stored copy of name to w.
+	Get(name string, w io.Writer) error
+}
+
+var dist struct {
+	mu      sync.RWMutex
+	d       Distributor
+	publish bool
+}
+
+// SetDistributor registers d. A publishing node puts its databases into d
+// after every update; other nodes only read from it. A nil d unregisters.
+func SetDistributor(d Distributor, publish bool) {
+	dist.mu.Lock()
+	dist.d, dist.publish = d, publish && d != nil
+	dist.mu.Unlock()
+}
+
+func distributor() (Distributor, bool) {
+	dist.mu.RLock()
+	defer dist.mu.RUnlock()
+	return dist.d, dist.publish
+}
+
+func fromCluster(c cfg.MaxmindConfig) bool {
+	return strings.EqualFold(strings.TrimSpace(c.Source), SourceCluster)
+}
+
+// PublishDatabases puts the local databases whose stamp differs from the
+// distributed copy into the registered Distributor. It does nothing unless
+// the Distributor was registered for publishing.
+func PublishDatabases() {
+	publishDatabases(filepath.Join(cfg.GetConfig().Local.Maxmind.MaxmindDBPath))
+}
+
+func publishDatabases(baseDir string) {
+	d, publish := distributor()
+	if !publish {
+		return
+	}
+	for _, db := range databases {
+		if err := publishDatabase(d, baseDir, db.name, db.filenameLite, db.markerFile); err != nil {
+			log.Log(log.Warn, "[maxmind] publishing %s: %v", db.name, err)
+		}
+	}
+}
+
+func publishDatabase(d Distributor, baseDir, name, mmdbFilename, markerFilename string) error {
+	mmdbPath := filepath.Join(baseDir, mmdbFilename)
+	stamp := readMarker(filepath.Join(baseDir, markerFilename))
+	if stamp == "" {
+		return nil
+	}
+	if _, err := os.Stat(mmdbPath); err != nil {
+		return nil
+	}
+	if remote, err := d.Info(name); err == nil && remote.Stamp == stamp {
+		return nil
+	} else if err != nil && !errors.Is(err, ErrNotDistributed) {
+		return err
+	}
+
+	sum, size, err := fileSHA256(mmdbPath)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(mmdbPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info := DatabaseInfo{Name: name, Stamp: stamp, SHA256: sum, Size: size}
+	if err := d.Put(info, f); err != nil {
+		return err
+	}
+	log.Log(log.Info, "[maxmind] published %s (%d bytes, stamp %s)", name, size, stamp)
+	return nil
+}
+
+// SyncFromCluster fetches databases that changed in the cluster and reloads
+// them. It is meant to run periodically on nodes with Source "cluster".
+func SyncFromCluster() error {
+	baseDir := filepath.Join(cfg.GetConfig().Local.Maxmind.MaxmindDBPath)
+	changed, err := fetchFromCluster(baseDir)
+	if changed == 0 {
+		return err
+	}
+	if rerr := Reload(); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+	return err
+}
+
+// updateFromCluster is the startup update of a "cluster" node. A missing
+// distributor or copy is only fatal when the database is not present locally.
+func updateFromCluster(baseDir string) error {
+	if _, err := fetchFromCluster(baseDir); err != nil {
+		for _, db := range databases {
+			if st, statErr := os.Stat(filepath.Join(baseDir, db.filenameLite)); statErr != nil || st.IsDir() {
+				return fmt.Errorf("cannot fetch %s from the cluster and no local copy found: %w", db.name, err)
+			}
+		}
+		log.Log(log.Warn, "[maxmind] using existing local databases: %v", err)
+	}
+	return nil
+}
+
+// fetchFromCluster replaces the local databases whose stamp differs from the
+// distributed copy and returns how many it replaced.
+func fetchFromCluster(baseDir string) (int, error) {
+	d, _ := distributor()
+	if d == nil {
+		return 0, errors.New("no cluster distributor registered; connect NATS before maxmind.Init")
+	}
+
+	changed := 0
+	var errs []error
+	for _, db := range databases {
+		ok, err := fetchDatabase(d, baseDir, db.name, db.filenameLite, db.markerFile)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", db.name, err))
+			continue
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+func fetchDatabase(d Distributor, baseDir, name, mmdbFilename, markerFilename string) (bool, error) {
+	mmdbPath := filepath.Join(baseDir, mmdbFilename)
+	markerPath := filepath.Join(baseDir, markerFilename)
+
+	info, err := d.Info(name)
+	if err != nil {
+		return false, err
+	}
+	if _, statErr := os.Stat(mmdbPath); statErr == nil && readMarker(markerPath) == info.Stamp {
+		return false, nil
+	}
+	if err := ensureFreeSpace(baseDir, info.Size, minFreeSpace(cfg.GetConfig().Local.Maxmind)); err != nil {
+		return false, err
+	}
+
+	tmpPath := mmdbPath + ".cluster"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return false, err
+	}
+	h := sha256.New()
+	getErr := d.Get(name, io.MultiWriter(f, h))
+	closeErr := f.Close()
+	if err := errors.Join(getErr, closeErr); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != info.SHA256 {
+		os.Remove(tmpPath)
+		return false, fmt.Errorf("%w: got %s, expected %s", errChecksumMismatch, got, info.SHA256)
+	}
+
+	if err := os.Rename(tmpPath, mmdbPath); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+	if err := os.WriteFile(markerPath, []byte(info.Stamp), 0644); err != nil {
+		log.Log(log.Error, "[maxmind] writing marker %s: %v", markerPath, err)
+	}
+	log.Log(log.Info, "[maxmind] fetched %s from the cluster (%d bytes, stamp %s)", name, info.Size, info.Stamp)
+	return true, nil
+}
+
+func readMarker(path string) string {
+	b, _ := os.ReadFile(path)
+	return strings.TrimSpace(string(b))
+}
+
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
@@ -0,0 +1,80 @@
+package maxmind
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type memDistributor struct {
+	info map[string]DatabaseInfo
+	data map[string][]byte
+}
+
+func (m *memDistributor) Info(name string) (DatabaseInfo, error) {
+	info, ok := m.info[name]
+	if !ok {
+		return DatabaseInfo{}, ErrNotDistributed
+	}
+	return info, nil
+}
+
+func (m *memDistributor) Put(info DatabaseInfo, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.info[info.Name], m.data[info.Name] = info, b
+	return nil
+}
+
+func (m *memDistributor) Get(name string, w io.Writer) error {
+	_, err := w.Write(m.data[name])
+	return err
+}
+
+func TestPublishAndFetchDatabase(t *testing.T) {
+	d := &memDistributor{info: map[string]DatabaseInfo{}, data: map[string][]byte{}}
+	db := bytes.Repeat([]byte("mmdb"), 4096)
+
+	pub := t.TempDir()
+	os.WriteFile(filepath.Join(pub, "CityLite.mmdb"), db, 0644)
+	os.WriteFile(filepath.Join(pub, ".CityLite"), []byte("Tue, 07 Jan 2025 00:00:00 GMT"), 0644)
+	if err := publishDatabase(d, pub, "CityLite", "CityLite.mmdb", ".CityLite"); err != nil {
+		t.Fatal(err)
+	}
+	if d.info["CityLite"].Size != int64(len(db)) {
+		t.Fatalf("expected published size %d, got %+v", len(db), d.info["CityLite"])
+	}
+
+	node := t.TempDir()
+	changed, err := fetchDatabase(d, node, "CityLite", "CityLite.mmdb", ".CityLite")
+	if err != nil || !changed {
+		t.Fatalf("expected database to be fetched, changed=%v err=%v", changed, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(node, "CityLite.mmdb")); !bytes.Equal(got, db) {
+		t.Fatal("expected fetched database to match the published one")
+	}
+	if changed, _ := fetchDatabase(d, node, "CityLite", "CityLite.mmdb", ".CityLite"); changed {
+		t.Fatal("expected an unchanged stamp not to be fetched again")
+	}
+
+	// A corrupted copy is rejected and the local database kept.
+	info := d.info["CityLite"]
+	info.Stamp = "newer"
+	d.info["CityLite"] = info
+	d.data["CityLite"] = []byte("corrupt")
+	if _, err := fetchDatabase(d, node, "CityLite", "CityLite.mmdb", ".CityLite"); !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("expected errChecksumMismatch, got %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(node, "CityLite.mmdb")); !bytes.Equal(got, db) {
+		t.Fatal("expected the local database to survive a corrupted fetch")
+	}
+
+	if _, err := fetchDatabase(d, node, "AsnLite", "AsnLite.mmdb", ".AsnLite"); !errors.Is(err, ErrNotDistributed) {
+		t.Fatalf("expected ErrNotDistributed, got %v", err)
+	}
+}
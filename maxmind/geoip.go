@@ -7,17 +7,21 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 
 	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-libs/internal/clientprefix"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
 
 	"github.com/oschwald/maxminddb-golang"
 )
 
+// The readers are swapped by Reload while lookups run. A replaced reader is
+// not closed; the maxminddb finalizer unmaps it once no lookup holds it.
 var (
-	maxmindAsn     *maxminddb.Reader
-	maxmindCity    *maxminddb.Reader
-	maxmindCountry *maxminddb.Reader
+	maxmindAsn     atomic.Pointer[maxminddb.Reader]
+	maxmindCity    atomic.Pointer[maxminddb.Reader]
+	maxmindCountry atomic.Pointer[maxminddb.Reader]
 )
 
 type URLParts struct {
@@ -45,49 +49,64 @@ func Init() {
 		log.Log(log.Fatal, "Failed to load local maxmind databases: %v", err)
 		os.Exit(1)
 	}
-}
 
-func loadLocalDatabases(baseDir string) error {
-	var err error
+	reloadOverrides()
+	cfg.RegisterReloadHook(overridesReloadHook, reloadOverrides)
+	reloadAnycastPrefixes()
+	cfg.RegisterReloadHook(anycastReloadHook, reloadAnycastPrefixes)
+}
 
-	cityPath := filepath.Join(baseDir, "CityLite.mmdb")
-	countryPath := filepath.Join(baseDir, "CountryLite.mmdb")
-	asnPath := filepath.Join(baseDir, "AsnLite.mmdb")
+// Reload reopens the databases in MaxmindDBPath, e.g. after SyncFromCluster
+// replaced them. Databases that fail to open keep their current reader.
+func Reload() error {
+	return loadLocalDatabases(filepath.Join(cfg.GetConfig().Local.Maxmind.MaxmindDBPath))
+}
 
-	cityOK := false
-	if _, statErr := os.Stat(cityPath); statErr == nil {
-		maxmindCity, err = maxminddb.Open(cityPath)
-		if err != nil {
-			return fmt.Errorf("could not open city database %s: %w", cityPath, err)
+// Missing returns the databases that have no open reader, e.g. for a health
+// check. It is empty once Init loaded all three.
+func Missing() []string {
+	var out []string
+	for _, db := range []struct {
+		name   string
+		reader *atomic.Pointer[maxminddb.Reader]
+	}{
+		{"CityLite", &maxmindCity},
+		{"CountryLite", &maxmindCountry},
+		{"AsnLite", &maxmindAsn},
+	} {
+		if db.reader.Load() == nil {
+			out = append(out, db.name)
 		}
-		cityOK = true
-	} else {
-		log.Log(log.Error, "CityLite.mmdb not found at %s", cityPath)
 	}
+	return out
+}
 
-	countryOK := false
-	if _, statErr := os.Stat(countryPath); statErr == nil {
-		maxmindCountry, err = maxminddb.Open(countryPath)
-		if err != nil {
-			return fmt.Errorf("could not open country database %s: %w", countryPath, err)
+func loadLocalDatabases(baseDir string) error {
+	dbs := []struct {
+		name   string
+		reader *atomic.Pointer[maxminddb.Reader]
+	}{
+		{"CityLite", &maxmindCity},
+		{"CountryLite", &maxmindCountry},
+		{"AsnLite", &maxmindAsn},
+	}
+
+	loaded := 0
+	for _, db := range dbs {
+		path := filepath.Join(baseDir, db.name+".mmdb")
+		if _, statErr := os.Stat(path); statErr != nil {
+			log.Log(log.Error, "%s.mmdb not found at %s", db.name, path)
+			continue
 		}
-		countryOK = true
-	} else {
-		log.Log(log.Error, "CountryLite.mmdb not found at %s", countryPath)
-	}
-
-	asnOK := false
-	if _, statErr := os.Stat(asnPath); statErr == nil {
-		maxmindAsn, err = maxminddb.Open(asnPath)
+		reader, err := maxminddb.Open(path)
 		if err != nil {
-			return fmt.Errorf("could not open ASN database %s: %w", asnPath, err)
+			return fmt.Errorf("could not open %s database %s: %w", db.name, path, err)
 		}
-		asnOK = true
-	} else {
-		log.Log(log.Error, "AsnLite.mmdb not found at %s", asnPath)
+		db.reader.Store(reader)
+		loaded++
 	}
 
-	if !cityOK && !countryOK && !asnOK {
+	if loaded == 0 {
 		return fmt.Errorf("no MaxMind databases available in %s", baseDir)
 	}
 
@@ -110,16 +129,20 @@ func Distance(lat1, lon1, lat2, lon2 float64) float64 {
 }
 
 func GetClientCoordinates(ipStr string) (float64, float64) {
-	if maxmindCity == nil {
-		log.Log(log.Error, "CityLite is not loaded")
-		return 0, 0
-	}
-
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		log.Log(log.Error, "Invalid IP address: %s", ipStr)
 		return 0, 0
 	}
+	if o, ok := lookupOverride(ip, hasCoordinates); ok {
+		return *o.Latitude, *o.Longitude
+	}
+
+	city := maxmindCity.Load()
+	if city == nil {
+		log.Log(log.Error, "CityLite is not loaded")
+		return 0, 0
+	}
 
 	var record struct {
 		Location struct {
@@ -128,7 +151,7 @@ func GetClientCoordinates(ipStr string) (float64, float64) {
 		} `maxminddb:"location"`
 	}
 
-	if err := maxmindCity.Lookup(ip, &record); err != nil {
+	if err := city.Lookup(ip, &record); err != nil {
 		log.Log(log.Error, "CityLite lookup error: %v", err)
 		return 0, 0
 	}
@@ -136,17 +159,20 @@ func GetClientCoordinates(ipStr string) (float64, float64) {
 }
 
 func GetCountryCode(ipStr string) string {
-	reader := getCountryReader()
-	if reader == nil {
-		log.Log(log.Error, "No MaxMind country database is loaded, cannot fetch country code.")
-		return ""
-	}
-
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		log.Log(log.Error, "Invalid IP address: %s", ipStr)
 		return ""
 	}
+	if o, ok := lookupOverride(ip, hasCountryCode); ok {
+		return o.CountryCode
+	}
+
+	reader := getCountryReader()
+	if reader == nil {
+		log.Log(log.Error, "No MaxMind country database is loaded, cannot fetch country code.")
+		return ""
+	}
 
 	var record struct {
 		Country struct {
@@ -162,17 +188,20 @@ func GetCountryCode(ipStr string) string {
 }
 
 func GetCountryName(ipStr string) string {
-	reader := getCountryReader()
-	if reader == nil {
-		log.Log(log.Error, "No MaxMind country database is loaded, cannot fetch country name.")
-		return ""
-	}
-
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		log.Log(log.Error, "Invalid IP address: %s", ipStr)
 		return ""
 	}
+	if o, ok := lookupOverride(ip, hasCountryName); ok {
+		return o.CountryName
+	}
+
+	reader := getCountryReader()
+	if reader == nil {
+		log.Log(log.Error, "No MaxMind country database is loaded, cannot fetch country name.")
+		return ""
+	}
 
 	var record struct {
 		Country struct {
@@ -198,6 +227,9 @@ func GetClientCountry(ipStr string) string {
 	return GetCountryCode(ipStr)
 }
 
+// GetClassC returns the first three octets of an IPv4 address.
+//
+// Deprecated: GetClassC fails for IPv6; use GetClientPrefix.
 func GetClassC(ipStr string) string {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
@@ -212,23 +244,52 @@ func GetClassC(ipStr string) string {
 	return fmt.Sprintf("%d.%d.%d", ipv4[0], ipv4[1], ipv4[2])
 }
 
-func GetAsnAndNetwork(ipStr string) (string, string) {
-	if maxmindAsn == nil {
-		return "", ""
+// Default prefix lengths of GetClientPrefix.
+const (
+	DefaultClientPrefixV4 = clientprefix.DefaultV4
+	DefaultClientPrefixV6 = clientprefix.DefaultV6
+)
+
+// GetClientPrefix returns the network of ipStr in CIDR notation, masked to
+// v4Bits for IPv4 (including IPv4-mapped IPv6) and v6Bits for IPv6, e.g.
+// "192.0.2.0/24" or "2001:db8:1::/48". A length of 0 or less selects the
+// default and one beyond the address size is capped. ipStr that does not
+// parse yields "".
+func GetClientPrefix(ipStr string, v4Bits, v6Bits int) string {
+	return clientprefix.String(ipStr, v4Bits, v6Bits)
+}
+
+// MaskClientIP returns ipStr with the host bits beyond the GetClientPrefix
+// network zeroed, e.g. "192.0.2.0", or "" when it does not parse.
+func MaskClientIP(ipStr string, v4Bits, v6Bits int) string {
+	p, ok := clientprefix.Of(ipStr, v4Bits, v6Bits)
+	if !ok {
+		return ""
 	}
+	return p.Addr().String()
+}
 
+func GetAsnAndNetwork(ipStr string) (string, string) {
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		log.Log(log.Error, "Invalid IP address in GetAsnAndNetwork: %s", ipStr)
 		return "", ""
 	}
+	if o, ok := lookupOverride(ip, hasASN); ok {
+		return o.ASN, o.ASNOrg
+	}
+
+	asnReader := maxmindAsn.Load()
+	if asnReader == nil {
+		return "", ""
+	}
 
 	var record struct {
 		AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
 		AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
 	}
 
-	if err := maxmindAsn.Lookup(ip, &record); err != nil {
+	if err := asnReader.Lookup(ip, &record); err != nil {
 		log.Log(log.Error, "Failed asn lookup for IP %s: %v", ipStr, err)
 		return "", ""
 	}
@@ -242,14 +303,10 @@ func GetAsnAndNetwork(ipStr string) (string, string) {
 }
 
 func Close() {
-	if maxmindCity != nil {
-		maxmindCity.Close()
-	}
-	if maxmindCountry != nil {
-		maxmindCountry.Close()
-	}
-	if maxmindAsn != nil {
-		maxmindAsn.Close()
+	for _, reader := range []*atomic.Pointer[maxminddb.Reader]{&maxmindCity, &maxmindCountry, &maxmindAsn} {
+		if r := reader.Swap(nil); r != nil {
+			r.Close()
+		}
 	}
 }
 
@@ -269,8 +326,8 @@ func ParseUrl(rawURL string) URLParts {
 }
 
 func getCountryReader() *maxminddb.Reader {
-	if maxmindCity != nil {
-		return maxmindCity
+	if city := maxmindCity.Load(); city != nil {
+		return city
 	}
-	return maxmindCountry
+	return maxmindCountry.Load()
 }
@@ -0,0 +1,40 @@
+package maxmind
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetClientPrefix(t *testing.T) {
+	cases := []struct {
+		ip     string
+		v4, v6 int
+		want   string
+	}{
+		{"192.0.2.77", 0, 0, "192.0.2.0/24"},
+		{"192.0.2.77", 16, 0, "192.0.0.0/16"},
+		{"::ffff:192.0.2.77", 0, 0, "192.0.2.0/24"},
+		{"2001:db8:1:2::1", 0, 0, "2001:db8:1::/48"},
+		{"2001:db8:1:2::1", 0, 64, "2001:db8:1:2::/64"},
+		{"fe80::1%eth0", 0, 10, "fe80::/10"},
+		{"192.0.2.77", 40, 0, "192.0.2.77/32"},
+		{"not-an-ip", 0, 0, ""},
+	}
+	for _, c := range cases {
+		if got := GetClientPrefix(c.ip, c.v4, c.v6); got != c.want {
+			t.Errorf("GetClientPrefix(%q, %d, %d) = %q, expected %q", c.ip, c.v4, c.v6, got, c.want)
+		}
+	}
+}
+
+func TestMaskClientIPMatchesClientPrefix(t *testing.T) {
+	for _, ip := range []string{"192.0.2.77", "::ffff:192.0.2.77", "2001:db8:1:2::1", "fe80::1%eth0"} {
+		prefix := GetClientPrefix(ip, 0, 0)
+		if got := MaskClientIP(ip, 0, 0); got == "" || !strings.HasPrefix(prefix, got+"/") {
+			t.Errorf("MaskClientIP(%q) = %q, expected the address of %q", ip, got, prefix)
+		}
+	}
+	if got := MaskClientIP("not-an-ip", 0, 0); got != "" {
+		t.Errorf("expected \"\" for an unparsable address, got %q", got)
+	}
+}
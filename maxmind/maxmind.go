@@ -3,6 +3,9 @@ package maxmind
 import (
 	"archive/tar"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,10 +18,32 @@ import (
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
 )
 
+const defaultMinFreeSpaceMB = 256
+
+// databases are the GeoLite2 editions kept in MaxmindDBPath.
+var databases = []struct {
+	name         string
+	editionID    string
+	filenameLite string
+	markerFile   string
+}{
+	{"CityLite", "GeoLite2-City", "CityLite.mmdb", ".CityLite"},
+	{"CountryLite", "GeoLite2-Country", "CountryLite.mmdb", ".CountryLite"},
+	{"AsnLite", "GeoLite2-ASN", "AsnLite.mmdb", ".AsnLite"},
+}
+
+// errChecksumMismatch is returned when a downloaded archive does not match
+// the SHA256 published by MaxMind.
+var errChecksumMismatch = errors.New("archive checksum mismatch")
+
 func updateMaxmindDatabase() error {
 	c := cfg.GetConfig()
 	baseDir := filepath.Join(c.Local.Maxmind.MaxmindDBPath)
 
+	if fromCluster(c.Local.Maxmind) {
+		return updateFromCluster(baseDir)
+	}
+
 	accountID := c.Local.Maxmind.AccountID
 	licenseKey := c.Local.Maxmind.LicenseKey
 	if accountID == "" || licenseKey == "" {
@@ -30,19 +55,8 @@ func updateMaxmindDatabase() error {
 		return fmt.Errorf("maxmind AccountID or LicenseKey is missing; cannot download databases and no local copy found")
 	}
 
-	downloads := []struct {
-		name         string
-		editionID    string
-		filenameLite string
-		markerFile   string
-	}{
-		{"CityLite", "GeoLite2-City", "CityLite.mmdb", ".CityLite"},
-		{"CountryLite", "GeoLite2-Country", "CountryLite.mmdb", ".CountryLite"},
-		{"AsnLite", "GeoLite2-ASN", "AsnLite.mmdb", ".AsnLite"},
-	}
-
-	for _, dl := range downloads {
-		if err := checkAndDownloadOne(baseDir, accountID, licenseKey, dl.name, dl.editionID, dl.filenameLite, dl.markerFile); err != nil {
+	for _, dl := range databases {
+		if err := checkAndDownloadOne(baseDir, accountID, licenseKey, dl.name, dl.editionID, dl.filenameLite, dl.markerFile, minFreeSpace(c.Local.Maxmind)); err != nil {
 			// If the specific DB is missing locally, this is fatal. Otherwise continue.
 			localPath := filepath.Join(baseDir, dl.filenameLite)
 			if st, statErr := os.Stat(localPath); statErr != nil || st.IsDir() {
@@ -52,9 +66,19 @@ func updateMaxmindDatabase() error {
 		}
 	}
 
+	publishDatabases(baseDir)
 	return nil
 }
 
+// minFreeSpace returns the configured free-space floor in bytes.
+func minFreeSpace(c cfg.MaxmindConfig) uint64 {
+	mb := c.MinFreeSpaceMB
+	if mb <= 0 {
+		mb = defaultMinFreeSpaceMB
+	}
+	return uint64(mb) << 20
+}
+
 func haveLocalMaxmindDatabases(baseDir string) bool {
 	required := []string{
 		filepath.Join(baseDir, "CityLite.mmdb"),
@@ -70,7 +94,7 @@ func haveLocalMaxmindDatabases(baseDir string) bool {
 }
 
 func checkAndDownloadOne(
-	baseDir, accountID, licenseKey, dbName, editionID, mmdbFilename, markerFilename string,
+	baseDir, accountID, licenseKey, dbName, editionID, mmdbFilename, markerFilename string, minFree uint64,
 ) error {
 	localMmdbPath := filepath.Join(baseDir, mmdbFilename)
 	localMarkerPath := filepath.Join(baseDir, markerFilename)
@@ -80,7 +104,7 @@ func checkAndDownloadOne(
 		editionID, editionID,
 	)
 
-	remoteModTime, err := getRemoteLastModified(remoteURL, accountID, licenseKey)
+	remoteModTime, remoteSize, err := getRemoteLastModified(remoteURL, accountID, licenseKey)
 	if err != nil {
 		if st, statErr := os.Stat(localMmdbPath); statErr == nil && !st.IsDir() {
 			log.Log(log.Warn, "%s HEAD request failed, using existing local db: %v", dbName, err)
@@ -88,6 +112,7 @@ func checkAndDownloadOne(
 		}
 		return fmt.Errorf("%s HEAD request error: %w", dbName, err)
 	}
+	ifRange := remoteModTime
 	if remoteModTime == "" {
 		log.Log(log.Warn, "No Last-Modified header for %s from server. Will always download it.", dbName)
 		remoteModTime = "no-last-mod-header"
@@ -101,7 +126,14 @@ func checkAndDownloadOne(
 		log.Log(log.Info, "Downloading fresh MaxMind DB for %s ...", dbName)
 
 		tmpArchivePath := filepath.Join(baseDir, dbName+".tar.gz")
-		err = downloadDatabase(remoteURL, accountID, licenseKey, tmpArchivePath)
+		err = ensureFreeSpace(baseDir, remoteSize, minFree)
+		if err == nil {
+			err = downloadDatabase(remoteURL, accountID, licenseKey, tmpArchivePath, ifRange)
+		}
+		if err == nil {
+			// suffix=tar.gz.sha256 selects the archive's published checksum.
+			err = verifyDownload(remoteURL+".sha256", accountID, licenseKey, tmpArchivePath)
+		}
 		if err != nil {
 			if st, statErr := os.Stat(localMmdbPath); statErr == nil && !st.IsDir() {
 				log.Log(log.Warn, "%s download failed; keeping existing local copy: %v", dbName, err)
@@ -140,10 +172,12 @@ func checkAndDownloadOne(
 	return nil
 }
 
-func getRemoteLastModified(url, accountID, licenseKey string) (string, error) {
+// getRemoteLastModified returns the Last-Modified header and the size (-1
+// when unknown) of the remote archive.
+func getRemoteLastModified(url, accountID, licenseKey string) (string, int64, error) {
 	req, err := http.NewRequest("HEAD", url, nil)
 	if err != nil {
-		return "", err
+		return "", -1, err
 	}
 
 	req.SetBasicAuth(accountID, licenseKey)
@@ -156,23 +190,37 @@ func getRemoteLastModified(url, accountID, licenseKey string) (string, error) {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return "", -1, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HEAD status: %d, %s", resp.StatusCode, resp.Status)
+		return "", -1, fmt.Errorf("HEAD status: %d, %s", resp.StatusCode, resp.Status)
 	}
 
-	return resp.Header.Get("Last-Modified"), nil
+	return resp.Header.Get("Last-Modified"), resp.ContentLength, nil
 }
 
-func downloadDatabase(url, accountID, licenseKey, outPath string) error {
+// downloadDatabase fetches url to outPath through outPath.part. An existing
+// part file left by an interrupted download is resumed with a Range request;
+// ifRange (the Last-Modified seen by HEAD) makes the server send the whole
+// archive instead when it changed in the meantime.
+func downloadDatabase(url, accountID, licenseKey, outPath, ifRange string) error {
+	partPath := outPath + ".part"
+	var offset int64
+	if st, err := os.Stat(partPath); err == nil && !st.IsDir() && ifRange != "" {
+		offset = st.Size()
+	}
+
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return err
 	}
 	req.SetBasicAuth(accountID, licenseKey)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", ifRange)
+	}
 
 	client := &http.Client{
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -186,18 +234,124 @@ func downloadDatabase(url, accountID, licenseKey, outPath string) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+	case http.StatusPartialContent:
+		if offset == 0 {
+			return fmt.Errorf("unexpected partial content for a full download")
+		}
+		flags |= os.O_APPEND
+		log.Log(log.Info, "Resuming download of %s at %d bytes", filepath.Base(outPath), offset)
+	case http.StatusRequestedRangeNotSatisfiable:
+		os.Remove(partPath)
+		return fmt.Errorf("GET status: %d, %s; discarded partial download", resp.StatusCode, resp.Status)
+	default:
 		return fmt.Errorf("GET status: %d, %s", resp.StatusCode, resp.Status)
 	}
 
-	f, err := os.Create(outPath)
+	f, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(f, resp.Body)
+	closeErr := f.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(partPath, outPath)
+}
+
+// verifyDownload checks archivePath against the SHA256 MaxMind publishes at
+// checksumURL and removes the archive when it does not match.
+func verifyDownload(checksumURL, accountID, licenseKey, archivePath string) error {
+	want, err := fetchChecksum(checksumURL, accountID, licenseKey)
+	if err != nil {
+		return fmt.Errorf("checksum download: %w", err)
+	}
+	if err := verifyChecksum(archivePath, want); err != nil {
+		os.Remove(archivePath)
+		return err
+	}
+	return nil
+}
+
+// fetchChecksum returns the hex digest of a sha256sum-style file
+// ("<digest>  <filename>").
+func fetchChecksum(url, accountID, licenseKey string) (string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(accountID, licenseKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET status: %d, %s", resp.StatusCode, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	return parseChecksum(string(body))
+}
+
+func parseChecksum(body string) (string, error) {
+	fields := strings.Fields(body)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum file")
+	}
+	digest := strings.ToLower(fields[0])
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("malformed sha256 %q", fields[0])
+	}
+	return digest, nil
+}
+
+func verifyChecksum(path, want string) error {
+	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	_, err = io.Copy(f, resp.Body)
-	return err
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("%w: %s has %s, expected %s", errChecksumMismatch, filepath.Base(path), got, want)
+	}
+	return nil
+}
+
+// ensureFreeSpace fails when downloading and extracting an archive of size
+// bytes (-1 when unknown) would leave less than minFree bytes free in dir.
+// Platforms without free-space reporting are not guarded.
+func ensureFreeSpace(dir string, size int64, minFree uint64) error {
+	free, err := freeSpace(dir)
+	if err != nil {
+		log.Log(log.Debug, "Free space of %s unknown, skipping guard: %v", dir, err)
+		return nil
+	}
+	need := minFree
+	if size > 0 {
+		// The archive and the extracted database are on disk together.
+		need += 2 * uint64(size)
+	}
+	if free < need {
+		return fmt.Errorf("insufficient free space in %s: %d MB free, %d MB required", dir, free>>20, need>>20)
+	}
+	return nil
 }
 
 func findExtractedMmdb(baseDir, editionID string) (string, error) {
@@ -280,14 +434,10 @@ func extractTarGz(tarGzPath, destDir string) error {
 			return err
 		}
 
-		outPath := filepath.Join(destDir, header.Name)
-		cleanDestDir := filepath.Clean(destDir)
-		cleanOutPath := filepath.Clean(outPath)
-		destPrefix := cleanDestDir + string(os.PathSeparator)
-		if cleanOutPath != cleanDestDir && !strings.HasPrefix(cleanOutPath, destPrefix) {
-			return fmt.Errorf("tar entry escapes destination: %s", header.Name)
+		outPath, err := extractPath(destDir, header.Name)
+		if err != nil {
+			return err
 		}
-		outPath = cleanOutPath
 
 		switch header.Typeflag {
 		case tar.TypeDir:
@@ -298,7 +448,7 @@ func extractTarGz(tarGzPath, destDir string) error {
 			if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
 				return err
 			}
-			outFile, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			outFile, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
 			if err != nil {
 				return err
 			}
@@ -313,3 +463,17 @@ func extractTarGz(tarGzPath, destDir string) error {
 	}
 	return nil
 }
+
+// extractPath returns where the tar entry name is written below destDir. It
+// rejects absolute names, volume names and names that climb out of destDir.
+func extractPath(destDir, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) || strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("tar entry has unsafe path: %q", name)
+	}
+	cleanDestDir := filepath.Clean(destDir)
+	outPath := filepath.Join(cleanDestDir, name)
+	if outPath != cleanDestDir && !strings.HasPrefix(outPath, cleanDestDir+string(os.PathSeparator)) {
+		return "", fmt.Errorf("tar entry escapes destination: %q", name)
+	}
+	return outPath, nil
+}
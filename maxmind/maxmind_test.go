@@ -0,0 +1,82 @@
+package maxmind
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExtractPathRejectsUnsafeNames(t *testing.T) {
+	dest := t.TempDir()
+	for _, name := range []string{"../evil", "a/../../evil", "/etc/passwd", ""} {
+		if _, err := extractPath(dest, name); err == nil {
+			t.Fatalf("expected %q to be rejected", name)
+		}
+	}
+	got, err := extractPath(dest, "GeoLite2-City_20250101/GeoLite2-City.mmdb")
+	if err != nil || got != filepath.Join(dest, "GeoLite2-City_20250101", "GeoLite2-City.mmdb") {
+		t.Fatalf("unexpected path %q, %v", got, err)
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	digest := hex.EncodeToString(make([]byte, sha256.Size))
+	if got, err := parseChecksum(digest + "  GeoLite2-City_20250101.tar.gz\n"); err != nil || got != digest {
+		t.Fatalf("unexpected checksum %q, %v", got, err)
+	}
+	for _, body := range []string{"", "nothex  file", "abcd  file"} {
+		if _, err := parseChecksum(body); err == nil {
+			t.Fatalf("expected %q to be rejected", body)
+		}
+	}
+}
+
+func TestDownloadResumesAndVerifies(t *testing.T) {
+	archive := bytes.Repeat([]byte("maxmind-archive-"), 1024)
+	modified := time.Date(2025, 1, 7, 0, 0, 0, 0, time.UTC)
+	var ranged bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranged = ranged || r.Header.Get("Range") != ""
+		http.ServeContent(w, r, "db.tar.gz", modified, bytes.NewReader(archive))
+	}))
+	defer srv.Close()
+
+	out := filepath.Join(t.TempDir(), "CityLite.tar.gz")
+	if err := os.WriteFile(out+".part", archive[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloadDatabase(srv.URL, "id", "key", out, modified.Format(http.TimeFormat)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil || !bytes.Equal(got, archive) || !ranged {
+		t.Fatalf("expected resumed download to match the archive (ranged=%v, err=%v)", ranged, err)
+	}
+
+	sum := sha256.Sum256(archive)
+	if err := verifyChecksum(out, hex.EncodeToString(sum[:])); err != nil {
+		t.Fatalf("expected checksum to match: %v", err)
+	}
+	if err := verifyChecksum(out, hex.EncodeToString(make([]byte, sha256.Size))); !errors.Is(err, errChecksumMismatch) {
+		t.Fatalf("expected errChecksumMismatch, got %v", err)
+	}
+}
+
+func TestEnsureFreeSpace(t *testing.T) {
+	if _, err := freeSpace(t.TempDir()); err != nil {
+		t.Skipf("free space not reported: %v", err)
+	}
+	if err := ensureFreeSpace(t.TempDir(), 1024, 0); err != nil {
+		t.Fatalf("expected a small download to fit: %v", err)
+	}
+	if err := ensureFreeSpace(t.TempDir(), -1, 1<<62); err == nil {
+		t.Fatal("expected an unreachable free-space floor to fail")
+	}
+}
@@ -0,0 +1,130 @@
+package maxmind
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// GEOIP OVERRIDES
+// -----------------------------------------------------------------------------
+//
+// Maxmind.OverridesFile names a JSON array of prefixes GeoLite2 places wrongly:
+//
+//	[{"cidr": "203.0.113.0/24", "countryCode": "DE", "countryName": "Germany",
+//	  "latitude": 50.11, "longitude": 8.68, "asn": "AS64500", "asnOrg": "Example"}]
+//
+// Every field but cidr is optional. Lookups consult the most specific prefix
+// that sets the requested field before the mmdb databases. The file is read
+// again on every config reload.
+
+const overridesReloadHook = "maxmind.overrides"
+
+// Override corrects the GeoIP data of one prefix.
+type Override struct {
+	CIDR        string   `json:"cidr"`
+	CountryCode string   `json:"countryCode,omitempty"`
+	CountryName string   `json:"countryName,omitempty"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
+	ASN         string   `json:"asn,omitempty"`
+	ASNOrg      string   `json:"asnOrg,omitempty"`
+
+	prefix netip.Prefix
+}
+
+type overrideTable struct {
+	path    string
+	entries []Override // most specific first
+}
+
+var overrides atomic.Pointer[overrideTable]
+
+// parseOverrides validates the entries of an overrides file.
+func parseOverrides(data []byte) ([]Override, error) {
+	var entries []Override
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		o := &entries[i]
+		p, err := netip.ParsePrefix(strings.TrimSpace(o.CIDR))
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		if (o.Latitude == nil) != (o.Longitude == nil) {
+			return nil, fmt.Errorf("entry %d (%s): latitude and longitude must be set together", i, o.CIDR)
+		}
+		if o.ASN != "" && !strings.HasPrefix(strings.ToUpper(o.ASN), "AS") {
+			o.ASN = "AS" + o.ASN
+		}
+		o.CountryCode = strings.ToUpper(o.CountryCode)
+		o.prefix = p.Masked()
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].prefix.Bits() > entries[j].prefix.Bits()
+	})
+	return entries, nil
+}
+
+// reloadOverrides reads Maxmind.OverridesFile. A file that fails to load
+// keeps the previous table.
+func reloadOverrides() {
+	path := strings.TrimSpace(cfg.GetConfig().Local.Maxmind.OverridesFile)
+	if path == "" {
+		if overrides.Swap(nil) != nil {
+			log.Log(log.Info, "[maxmind] GeoIP overrides cleared")
+		}
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Log(log.Error, "[maxmind] reading GeoIP overrides %s: %v", path, err)
+		return
+	}
+	entries, err := parseOverrides(data)
+	if err != nil {
+		log.Log(log.Error, "[maxmind] parsing GeoIP overrides %s: %v", path, err)
+		return
+	}
+	prev := overrides.Swap(&overrideTable{path: path, entries: entries})
+	if prev == nil || prev.path != path || len(prev.entries) != len(entries) {
+		log.Log(log.Info, "[maxmind] loaded %d GeoIP overrides from %s", len(entries), path)
+	}
+}
+
+// lookupOverride returns the most specific override of ip for which has
+// reports the wanted field as set.
+func lookupOverride(ip net.IP, has func(*Override) bool) (*Override, bool) {
+	t := overrides.Load()
+	if t == nil || ip == nil {
+		return nil, false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return nil, false
+	}
+	addr = addr.Unmap()
+	for i := range t.entries {
+		o := &t.entries[i]
+		if o.prefix.Contains(addr) && has(o) {
+			return o, true
+		}
+	}
+	return nil, false
+}
+
+func hasCountryCode(o *Override) bool { return o.CountryCode != "" }
+func hasCountryName(o *Override) bool { return o.CountryName != "" }
+func hasCoordinates(o *Override) bool { return o.Latitude != nil }
+func hasASN(o *Override) bool         { return o.ASN != "" }
@@ -0,0 +1,44 @@
+package maxmind
+
+import "testing"
+
+func TestOverridesMostSpecificFieldWins(t *testing.T) {
+	entries, err := parseOverrides([]byte(`[
+		{"cidr": "203.0.113.0/24", "countryCode": "de", "countryName": "Germany", "asn": "64500", "asnOrg": "Example"},
+		{"cidr": "203.0.113.128/25", "latitude": 50.11, "longitude": 8.68},
+		{"cidr": "2001:db8::/32", "countryCode": "NL"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrides.Store(&overrideTable{entries: entries})
+	defer overrides.Store(nil)
+
+	if got := GetCountryCode("203.0.113.200"); got != "DE" {
+		t.Fatalf("expected country from the /24, got %q", got)
+	}
+	if lat, lon := GetClientCoordinates("203.0.113.200"); lat != 50.11 || lon != 8.68 {
+		t.Fatalf("expected coordinates from the /25, got %v,%v", lat, lon)
+	}
+	if asn, org := GetAsnAndNetwork("203.0.113.1"); asn != "AS64500" || org != "Example" {
+		t.Fatalf("expected normalised ASN override, got %q %q", asn, org)
+	}
+	if got := GetCountryCode("2001:db8::1"); got != "NL" {
+		t.Fatalf("expected IPv6 override, got %q", got)
+	}
+	if got := GetCountryName("2001:db8::1"); got != "" {
+		t.Fatalf("expected no name without a database, got %q", got)
+	}
+}
+
+func TestParseOverridesRejectsInvalidEntries(t *testing.T) {
+	for _, data := range []string{
+		`[{"cidr": "not-a-prefix"}]`,
+		`[{"cidr": "10.0.0.0/8", "latitude": 1}]`,
+		`{"cidr": "10.0.0.0/8"}`,
+	} {
+		if _, err := parseOverrides([]byte(data)); err == nil {
+			t.Fatalf("expected %s to be rejected", data)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Package metrics keeps counters and histograms of the library's subsystems
+// and serves them in the Prometheus text format under /metrics. Each metric
+// has at most one label, whose values must come from a bounded set (a query
+// name, a subject), never from request data.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultDurationBuckets are upper bounds in seconds, from 1ms to 10s.
+var DefaultDurationBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry holds the metrics of a daemon.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]metric
+}
+
+var defaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// Default returns the registry the package-level constructors register in.
+func Default() *Registry { return defaultRegistry }
+
+// Mount serves the default registry on mux under /metrics.
+func Mount(mux *http.ServeMux) { defaultRegistry.Mount(mux) }
+
+// Mount serves r on mux under /metrics.
+func (r *Registry) Mount(mux *http.ServeMux) {
+	mux.Handle("/metrics", r.Handler())
+}
+
+// Handler serves r in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Write writes every metric, in name order.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ms := make([]metric, len(names))
+	for i, name := range names {
+		ms[i] = r.metrics[name]
+	}
+	r.mu.RUnlock()
+
+	for _, m := range ms {
+		m.write(w)
+	}
+}
+
+// register adds m under name; a second metric of the same name is kept
+// from the registry but still works for its owner.
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; !ok {
+		r.metrics[name] = m
+	}
+}
+
+// -----------------------------------------------------------------------------
+// COUNTERS
+// -----------------------------------------------------------------------------
+
+// CounterVec counts events by one label.
+type CounterVec struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec returns a counter registered in the default registry.
+func NewCounterVec(name, help, label string) *CounterVec {
+	return defaultRegistry.NewCounterVec(name, help, label)
+}
+
+// NewCounterVec returns a counter registered in r.
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{name: name, help: help, label: label, values: make(map[string]float64)}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one for value.
+func (c *CounterVec) Inc(value string) { c.Add(value, 1) }
+
+// Add adds n for value.
+func (c *CounterVec) Add(value string, n float64) {
+	c.mu.Lock()
+	c.values[value] += n
+	c.mu.Unlock()
+}
+
+// Value returns the count for value.
+func (c *CounterVec) Value(value string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[value]
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	for _, v := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, labelPair(c.label, v), formatFloat(c.values[v]))
+	}
+}
+
+// -----------------------------------------------------------------------------
+// HISTOGRAMS
+// -----------------------------------------------------------------------------
+
+// HistogramVec counts observations into buckets by one label.
+type HistogramVec struct {
+	name, help, label string
+	buckets           []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// HistogramSnapshot is one series of a HistogramVec. Counts are cumulative,
+// one per bucket bound.
+type HistogramSnapshot struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+// NewHistogramVec returns a histogram registered in the default registry.
+// buckets are upper bounds in ascending order; nil means
+// DefaultDurationBuckets.
+func NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	return defaultRegistry.NewHistogramVec(name, help, label, buckets)
+}
+
+// NewHistogramVec returns a histogram registered in r.
+func (r *Registry) NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultDurationBuckets
+	}
+	h := &HistogramVec{name: name, help: help, label: label, buckets: buckets, series: make(map[string]*histogram)}
+	r.register(name, h)
+	return h
+}
+
+// Observe records v for value.
+func (h *HistogramVec) Observe(value string, v float64) {
+	i := sort.SearchFloat64s(h.buckets, v) // first bound >= v
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[value]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[value] = s
+	}
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+// Snapshot returns the series for value.
+func (h *HistogramVec) Snapshot(value string) HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	snap := HistogramSnapshot{Buckets: h.buckets, Counts: make([]uint64, len(h.buckets))}
+	s, ok := h.series[value]
+	if !ok {
+		return snap
+	}
+	var cum uint64
+	for i := range h.buckets {
+		cum += s.counts[i]
+		snap.Counts[i] = cum
+	}
+	snap.Count, snap.Sum = s.count, s.sum
+	return snap
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	values := make([]string, 0, len(h.series))
+	for v := range h.series {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	for _, v := range values {
+		s := h.series[v]
+		lp := labelPair(h.label, v)
+		var cum uint64
+		for i, le := range h.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", h.name, lp, formatFloat(le), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, lp, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, lp, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, lp, s.count)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// TEXT FORMAT
+// -----------------------------------------------------------------------------
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	if help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func labelPair(label, value string) string {
+	esc := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return label + `="` + esc + `"`
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
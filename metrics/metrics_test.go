@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesPrometheusText(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("q_seconds", "Query time.", "query", []float64{0.1, 1})
+	c := r.NewCounterVec("q_total", "Queries.", "query")
+
+	h.Observe("select a", 0.05)
+	h.Observe("select a", 0.5)
+	h.Observe("select a", 5)
+	c.Inc(`say "hi"`)
+
+	snap := h.Snapshot("select a")
+	if snap.Count != 3 || snap.Counts[0] != 1 || snap.Counts[1] != 2 || snap.Sum != 5.55 {
+		t.Fatalf("snapshot %+v", snap)
+	}
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE q_seconds histogram",
+		`q_seconds_bucket{query="select a",le="0.1"} 1`,
+		`q_seconds_bucket{query="select a",le="1"} 2`,
+		`q_seconds_bucket{query="select a",le="+Inf"} 3`,
+		`q_seconds_count{query="select a"} 3`,
+		"# TYPE q_total counter",
+		`q_total{query="say \"hi\""} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in\n%s", want, body)
+		}
+	}
+	if strings.Index(body, "q_seconds") > strings.Index(body, "q_total") {
+		t.Error("metrics not in name order")
+	}
+}
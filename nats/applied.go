@@ -0,0 +1,86 @@
+package nats
+
+import (
+	"path/filepath"
+	"strings"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+)
+
+// -----------------------------------------------------------------------------
+// APPLIED-PROPOSAL LEDGER
+// -----------------------------------------------------------------------------
+//
+// Finalize messages can be re-delivered (reconnects, duplicate finalizers), so
+// every applied proposal ID is recorded in State.Applied and a finalize whose
+// ID is already present is skipped. With Nats.PersistAppliedLedger the ledger
+// is written to WorkDir/tmp and restored on start, so a restart does not
+// re-fire events and alerts for proposals applied just before it.
+
+const appliedLedgerFile = "applied.ledger.json"
+
+// initAppliedLedger creates State.Applied if needed and restores persisted
+// entries. Callers must not hold State.Mu.
+func initAppliedLedger() {
+	c := cfg.GetConfig()
+
+	State.Mu.Lock()
+	if State.Applied != nil {
+		State.Mu.Unlock()
+		return
+	}
+	ledger := core.NewAppliedLedger(c.Local.Nats.AppliedLedgerSize)
+	State.Applied = ledger
+	State.Mu.Unlock()
+
+	path := appliedLedgerPath(c)
+	if path == "" {
+		return
+	}
+	var entries []core.AppliedEntry
+	if err := dat.LoadCache(path, &entries); err != nil {
+		log.Log(log.Warn, "[NATS] applied ledger load failed: %v", err)
+		return
+	}
+	ledger.Restore(entries)
+	log.Log(log.Debug, "[NATS] applied ledger restored with %d entries", ledger.Len())
+}
+
+// SaveAppliedLedger writes the applied-proposal ledger to disk when
+// persistence is enabled. It is called periodically and should be called
+// once more on shutdown.
+func SaveAppliedLedger() {
+	path := appliedLedgerPath(cfg.GetConfig())
+	if path == "" {
+		return
+	}
+	State.Mu.RLock()
+	ledger := State.Applied
+	State.Mu.RUnlock()
+	if ledger == nil {
+		return
+	}
+	if err := dat.SaveCache(path, ledger.Snapshot()); err != nil {
+		log.Log(log.Error, "[NATS] applied ledger save failed: %v", err)
+	}
+}
+
+// saveAppliedLedgerIfDirty persists the ledger only when new IDs were added.
+func saveAppliedLedgerIfDirty() {
+	State.Mu.RLock()
+	ledger := State.Applied
+	State.Mu.RUnlock()
+	if ledger.Dirty() {
+		SaveAppliedLedger()
+	}
+}
+
+func appliedLedgerPath(c cfg.Config) string {
+	if !c.Local.Nats.PersistAppliedLedger || strings.TrimSpace(c.Local.System.WorkDir) == "" {
+		return ""
+	}
+	return filepath.Join(c.Local.System.WorkDir, "tmp", appliedLedgerFile)
+}
@@ -0,0 +1,63 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+)
+
+func TestOnConsensusFinalizeSkipsAppliedProposal(t *testing.T) {
+	State.Mu.Lock()
+	originalApplied, originalRole := State.Applied, State.ThisNode.NodeRole
+	State.Applied = core.NewAppliedLedger(8)
+	State.ThisNode.NodeRole = "IBPDns"
+	ledger := State.Applied
+	State.Mu.Unlock()
+	defer func() {
+		State.Mu.Lock()
+		State.Applied, State.ThisNode.NodeRole = originalApplied, originalRole
+		State.Mu.Unlock()
+	}()
+
+	fm := core.FinalizeMessage{
+		Proposal:  core.Proposal{ID: "finalize-dup"},
+		Passed:    true,
+		DecidedAt: time.Now().UTC(),
+	}
+	onConsensusFinalize(fm)
+	if !ledger.Applied("finalize-dup") {
+		t.Fatal("expected finalize to be recorded in the applied ledger")
+	}
+	if ledger.MarkApplied("finalize-dup", time.Now()) {
+		t.Fatal("expected redelivered finalize to be treated as already applied")
+	}
+
+	onConsensusFinalize(core.FinalizeMessage{Proposal: core.Proposal{ID: "failed"}, Passed: false})
+	if ledger.Applied("failed") {
+		t.Fatal("expected failed finalize not to be recorded")
+	}
+}
+
+func TestOnConsensusFinalizeDoesNotApplyShadowProposals(t *testing.T) {
+	State.Mu.Lock()
+	originalApplied, originalRole := State.Applied, State.ThisNode.NodeRole
+	State.Applied = core.NewAppliedLedger(8)
+	State.ThisNode.NodeRole = "IBPMonitor"
+	ledger := State.Applied
+	State.Mu.Unlock()
+	defer func() {
+		State.Mu.Lock()
+		State.Applied, State.ThisNode.NodeRole = originalApplied, originalRole
+		State.Mu.Unlock()
+	}()
+
+	onConsensusFinalize(core.FinalizeMessage{
+		Proposal:  core.Proposal{ID: "shadow-1", CheckType: "site", CheckName: "new-check", MemberName: "m", Shadow: true},
+		Passed:    true,
+		DecidedAt: time.Now().UTC(),
+	})
+	if ledger.Applied("shadow-1") {
+		t.Fatal("expected shadow finalize not to be applied")
+	}
+}
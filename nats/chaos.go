@@ -0,0 +1,96 @@
+package nats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/chaos"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+)
+
+// -----------------------------------------------------------------------------
+// FAULT INJECTION
+// -----------------------------------------------------------------------------
+//
+// With an injector installed, PublishMsg and every subscription pass their
+// messages through it, so tests can drop, delay, duplicate or reorder
+// traffic. Tests install one with SetChaos; Nats.Chaos installs one from the
+// configuration and replaces it on reload.
+
+const chaosReloadHook = "nats.chaos"
+
+var (
+	chaosInjector atomic.Pointer[chaos.Injector]
+
+	chaosConfigMu sync.Mutex
+	chaosFromCfg  *chaos.Injector
+)
+
+// SetChaos installs inj on the transport; nil removes it.
+func SetChaos(inj *chaos.Injector) {
+	chaosInjector.Store(inj)
+}
+
+// ChaosStats returns the counters of the installed injector, if any.
+func ChaosStats() (chaos.Stats, bool) {
+	inj := chaosInjector.Load()
+	if inj == nil {
+		return chaos.Stats{}, false
+	}
+	return inj.Stats(), true
+}
+
+// chaosRules converts the configured rules, prefixing their subjects.
+func chaosRules(c *cfg.ChaosConfig) []chaos.Rule {
+	if c == nil {
+		return nil
+	}
+	out := make([]chaos.Rule, 0, len(c.Rules))
+	for _, r := range c.Rules {
+		subject := r.Subject
+		if subject == "" {
+			subject = ">"
+		}
+		out = append(out, chaos.Rule{
+			Subject:   subjects.With(subject),
+			Direction: chaos.Direction(r.Direction),
+			Drop:      r.Drop,
+			Delay:     r.Delay,
+			Duplicate: r.Duplicate,
+			Reorder:   r.Reorder,
+			MaxDelay:  time.Duration(r.MaxDelayMs) * time.Millisecond,
+		})
+	}
+	return out
+}
+
+// applyChaos installs the configured injector. An injector set by a test
+// through SetChaos is left alone.
+func applyChaos() {
+	c := cfg.GetConfig().Local.Nats.Chaos
+	rules := chaosRules(c)
+
+	chaosConfigMu.Lock()
+	defer chaosConfigMu.Unlock()
+	var next *chaos.Injector
+	if len(rules) > 0 {
+		next = chaos.New(c.Seed, rules...)
+	}
+	if !chaosInjector.CompareAndSwap(chaosFromCfg, next) {
+		return
+	}
+	if next != nil {
+		log.Log(log.Warn, "[NATS] chaos injection enabled with %d rule(s); not for production", len(rules))
+	} else if chaosFromCfg != nil {
+		log.Log(log.Info, "[NATS] chaos injection disabled")
+	}
+	chaosFromCfg = next
+}
+
+func registerChaos() {
+	applyChaos()
+	cfg.RegisterReloadHook(chaosReloadHook, applyChaos)
+}
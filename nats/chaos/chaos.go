@@ -0,0 +1,224 @@
+// Package chaos injects transport faults into the NATS layer: messages are
+// dropped, delayed, duplicated or reordered per subject with configured
+// probabilities, so consensus can be tested under packet loss. It is meant
+// for tests and staging clusters, never production.
+package chaos
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/nats/router"
+
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultMaxDelay bounds delays and how long a reordered message is held
+// when a rule sets no MaxDelay.
+const DefaultMaxDelay = 200 * time.Millisecond
+
+// Direction selects the path a Rule applies to.
+type Direction string
+
+const (
+	Both      Direction = ""
+	Publish   Direction = "publish"
+	Subscribe Direction = "subscribe"
+)
+
+// Rule sets the fault probabilities (0 to 1) for the subjects matching the
+// NATS-style pattern Subject. Drop is drawn first; a kept message may then
+// be held back behind the next one on its subject (Reorder), delayed by up
+// to MaxDelay (Delay) and sent twice (Duplicate).
+type Rule struct {
+	Subject   string
+	Direction Direction
+	Drop      float64
+	Delay     float64
+	Duplicate float64
+	Reorder   float64
+	MaxDelay  time.Duration
+}
+
+// Stats counts the faults injected so far.
+type Stats struct {
+	Passed     uint64 `json:"passed"`
+	Dropped    uint64 `json:"dropped"`
+	Delayed    uint64 `json:"delayed"`
+	Duplicated uint64 `json:"duplicated"`
+	Reordered  uint64 `json:"reordered"`
+}
+
+// Injector applies rules to messages. The first rule matching a message's
+// subject and direction decides; messages without one pass unchanged.
+type Injector struct {
+	rules []Rule
+
+	mu   sync.Mutex
+	rng  *rand.Rand
+	held map[heldKey]*heldMsg
+
+	passed, dropped, delayed, duplicated, reordered atomic.Uint64
+}
+
+type heldKey struct {
+	dir     Direction
+	subject string
+}
+
+type heldMsg struct {
+	msg   *nats.Msg
+	send  func(*nats.Msg) error
+	timer *time.Timer
+}
+
+// New returns an Injector for rules. A seed of 0 seeds from the clock; tests
+// pass a fixed seed to get the same faults on every run.
+func New(seed int64, rules ...Rule) *Injector {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Injector{
+		rules: append([]Rule(nil), rules...),
+		rng:   rand.New(rand.NewSource(seed)),
+		held:  make(map[heldKey]*heldMsg),
+	}
+}
+
+// Publish passes msg to send, the real publish, subject to the publish
+// rules. Faults are silent: a dropped or delayed message returns nil.
+func (i *Injector) Publish(msg *nats.Msg, send func(*nats.Msg) error) error {
+	return i.apply(Publish, msg, send)
+}
+
+// Deliver passes an inbound msg to deliver subject to the subscribe rules.
+func (i *Injector) Deliver(msg *nats.Msg, deliver func(*nats.Msg)) {
+	_ = i.apply(Subscribe, msg, func(m *nats.Msg) error {
+		deliver(m)
+		return nil
+	})
+}
+
+// Stats returns the fault counters.
+func (i *Injector) Stats() Stats {
+	return Stats{
+		Passed:     i.passed.Load(),
+		Dropped:    i.dropped.Load(),
+		Delayed:    i.delayed.Load(),
+		Duplicated: i.duplicated.Load(),
+		Reordered:  i.reordered.Load(),
+	}
+}
+
+// Flush releases every message held for reordering.
+func (i *Injector) Flush() {
+	i.mu.Lock()
+	held := i.held
+	i.held = make(map[heldKey]*heldMsg)
+	i.mu.Unlock()
+	for _, h := range held {
+		h.timer.Stop()
+		_ = h.send(h.msg)
+	}
+}
+
+func (i *Injector) rule(dir Direction, subject string) (Rule, bool) {
+	for _, r := range i.rules {
+		if r.Direction != Both && r.Direction != dir {
+			continue
+		}
+		if r.Subject == "" || r.Subject == ">" || router.Match(r.Subject, subject) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+func (i *Injector) apply(dir Direction, msg *nats.Msg, send func(*nats.Msg) error) error {
+	r, ok := i.rule(dir, msg.Subject)
+	if !ok {
+		i.passed.Add(1)
+		return send(msg)
+	}
+	maxDelay := r.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelay
+	}
+	key := heldKey{dir: dir, subject: msg.Subject}
+
+	i.mu.Lock()
+	if i.roll(r.Drop) {
+		i.mu.Unlock()
+		i.dropped.Add(1)
+		return nil
+	}
+	// A message held earlier on this subject goes out after this one.
+	prev := i.held[key]
+	if prev != nil {
+		delete(i.held, key)
+		prev.timer.Stop()
+	} else if i.roll(r.Reorder) {
+		h := &heldMsg{msg: msg, send: send}
+		h.timer = time.AfterFunc(maxDelay, func() { i.release(key, h) })
+		i.held[key] = h
+		i.mu.Unlock()
+		i.reordered.Add(1)
+		return nil
+	}
+	var delay time.Duration
+	if i.roll(r.Delay) {
+		delay = time.Duration(i.rng.Int63n(int64(maxDelay))) + 1
+	}
+	dup := i.roll(r.Duplicate)
+	i.mu.Unlock()
+
+	out := func() error {
+		err := send(msg)
+		if dup {
+			i.duplicated.Add(1)
+			_ = send(clone(msg))
+		}
+		if prev != nil {
+			_ = prev.send(prev.msg)
+		}
+		return err
+	}
+	if delay > 0 {
+		i.delayed.Add(1)
+		time.AfterFunc(delay, func() { _ = out() })
+		return nil
+	}
+	i.passed.Add(1)
+	return out()
+}
+
+// release sends h when no later message on its subject arrived in time.
+func (i *Injector) release(key heldKey, h *heldMsg) {
+	i.mu.Lock()
+	if i.held[key] != h {
+		i.mu.Unlock()
+		return
+	}
+	delete(i.held, key)
+	i.mu.Unlock()
+	_ = h.send(h.msg)
+}
+
+// roll reports whether an event of probability p happens. Callers must hold
+// i.mu.
+func (i *Injector) roll(p float64) bool {
+	return p > 0 && i.rng.Float64() < p
+}
+
+func clone(m *nats.Msg) *nats.Msg {
+	c := &nats.Msg{Subject: m.Subject, Reply: m.Reply, Data: append([]byte(nil), m.Data...)}
+	if m.Header != nil {
+		c.Header = make(nats.Header, len(m.Header))
+		for k, v := range m.Header {
+			c.Header[k] = append([]string(nil), v...)
+		}
+	}
+	return c
+}
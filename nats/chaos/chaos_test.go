@@ -0,0 +1,132 @@
+package chaos
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+type sink struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (s *sink) send(m *nats.Msg) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, string(m.Data))
+	return nil
+}
+
+func (s *sink) got() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.msgs...)
+}
+
+func msg(subject, data string) *nats.Msg {
+	return &nats.Msg{Subject: subject, Data: []byte(data)}
+}
+
+func TestUnmatchedSubjectsPass(t *testing.T) {
+	inj := New(1, Rule{Subject: "consensus.vote", Drop: 1})
+	var s sink
+	for _, d := range []string{"a", "b"} {
+		if err := inj.Publish(msg("consensus.propose", d), s.send); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.got(); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("expected both messages in order, got %v", got)
+	}
+	if st := inj.Stats(); st.Passed != 2 || st.Dropped != 0 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestDropAndDirection(t *testing.T) {
+	inj := New(1, Rule{Subject: "consensus.*", Direction: Subscribe, Drop: 1})
+	var s sink
+	_ = inj.Publish(msg("consensus.vote", "out"), s.send)
+	inj.Deliver(msg("consensus.vote", "in"), func(m *nats.Msg) { _ = s.send(m) })
+	if got := s.got(); len(got) != 1 || got[0] != "out" {
+		t.Fatalf("expected only the published message, got %v", got)
+	}
+	if inj.Stats().Dropped != 1 {
+		t.Fatalf("expected one drop, got %+v", inj.Stats())
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	inj := New(1, Rule{Duplicate: 1})
+	var s sink
+	m := msg("consensus.finalize", "x")
+	m.Header = nats.Header{"Ibp-Correlation-Id": []string{"c"}}
+	_ = inj.Publish(m, s.send)
+	if got := s.got(); len(got) != 2 {
+		t.Fatalf("expected the message twice, got %v", got)
+	}
+}
+
+func TestReorderSwapsWithNextMessage(t *testing.T) {
+	inj := New(1, Rule{Subject: "consensus.vote", Reorder: 1, MaxDelay: time.Hour})
+	var s sink
+	_ = inj.Publish(msg("consensus.vote", "1"), s.send)
+	_ = inj.Publish(msg("consensus.vote", "2"), s.send)
+	_ = inj.Publish(msg("consensus.vote", "3"), s.send)
+	if got := s.got(); len(got) != 2 || got[0] != "2" || got[1] != "1" {
+		t.Fatalf("expected 2 before 1 and 3 held, got %v", got)
+	}
+	inj.Flush()
+	if got := s.got(); len(got) != 3 || got[2] != "3" {
+		t.Fatalf("expected flush to release 3, got %v", got)
+	}
+}
+
+func TestHeldMessageReleasedAfterMaxDelay(t *testing.T) {
+	inj := New(1, Rule{Reorder: 1, MaxDelay: 5 * time.Millisecond})
+	var s sink
+	_ = inj.Publish(msg("consensus.vote", "1"), s.send)
+	deadline := time.Now().Add(time.Second)
+	for len(s.got()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := s.got(); len(got) != 1 {
+		t.Fatalf("expected held message to be released, got %v", got)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	inj := New(1, Rule{Delay: 1, MaxDelay: 5 * time.Millisecond})
+	var s sink
+	_ = inj.Publish(msg("consensus.vote", "1"), s.send)
+	deadline := time.Now().Add(time.Second)
+	for len(s.got()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := s.got(); len(got) != 1 || inj.Stats().Delayed != 1 {
+		t.Fatalf("expected one delayed delivery, got %v %+v", got, inj.Stats())
+	}
+}
+
+func TestSeedIsDeterministic(t *testing.T) {
+	run := func() []string {
+		inj := New(42, Rule{Drop: 0.5})
+		var s sink
+		for _, d := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+			_ = inj.Publish(msg("consensus.vote", d), s.send)
+		}
+		return s.got()
+	}
+	a, b := run(), run()
+	if len(a) != len(b) {
+		t.Fatalf("expected the same drops for the same seed, got %v and %v", a, b)
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("expected the same drops for the same seed, got %v and %v", a, b)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package nats
+
+import (
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-libs/nats/chaos"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+)
+
+func TestChaosRulesPrefixSubjects(t *testing.T) {
+	subjects.SetPrefix("staging")
+	defer subjects.SetPrefix("")
+
+	rules := chaosRules(&cfg.ChaosConfig{Rules: []cfg.ChaosRule{
+		{Subject: "consensus.vote", Direction: "publish", Drop: 0.2, MaxDelayMs: 50},
+		{Delay: 0.1},
+	}})
+	if len(rules) != 2 || rules[0].Subject != "staging.consensus.vote" || rules[0].Direction != chaos.Publish ||
+		rules[0].MaxDelay.Milliseconds() != 50 || rules[1].Subject != "staging.>" {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+	if chaosRules(nil) != nil {
+		t.Fatal("expected no rules without chaos config")
+	}
+}
+
+func TestApplyChaosKeepsTestInjector(t *testing.T) {
+	inj := chaos.New(1)
+	SetChaos(inj)
+	defer SetChaos(nil)
+
+	applyChaos()
+	if chaosInjector.Load() != inj {
+		t.Fatal("expected config without chaos rules to keep the injector set by SetChaos")
+	}
+}
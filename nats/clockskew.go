@@ -0,0 +1,151 @@
+package nats
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// CLOCK SKEW
+// -----------------------------------------------------------------------------
+//
+// Consensus and event times come from the clocks of the nodes that produce
+// them; a monitor ten minutes off moves the start of every outage it
+// finalizes. Every heartbeat carries the sender's clock, so each node keeps
+// the offset of every peer (receive time minus send time, which includes a
+// few milliseconds of transport). An offset beyond Nats.MaxClockSkewSeconds
+// on two heartbeats in a row raises a clock_skew alert, from the watchdog
+// reporter only, and clock_synced once it is back in range. Collators use
+// their own receive time for event boundaries finalized by a skewed node.
+
+const defaultMaxClockSkew = 30 * time.Second
+
+type clockSkews struct {
+	mu     sync.Mutex
+	skew   map[string]time.Duration
+	skewed map[string]bool // last reported state
+	streak map[string]int
+}
+
+type clockSkewAlert struct {
+	kind    alerts.Kind
+	nodeID  string
+	message string
+}
+
+// observe records one offset of nodeID and returns the transition it
+// causes, if any. A limit of 0 disables alerting.
+func (c *clockSkews) observe(nodeID string, skew, limit time.Duration) (clockSkewAlert, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.skew == nil {
+		c.skew, c.skewed, c.streak = make(map[string]time.Duration), make(map[string]bool), make(map[string]int)
+	}
+	c.skew[nodeID] = skew
+	if limit <= 0 {
+		return clockSkewAlert{}, false
+	}
+
+	skewed := absDuration(skew) > limit
+	if skewed == c.skewed[nodeID] {
+		c.streak[nodeID] = 0
+		return clockSkewAlert{}, false
+	}
+	c.streak[nodeID]++
+	if c.streak[nodeID] < watchdogConfirmSamples {
+		return clockSkewAlert{}, false
+	}
+	c.skewed[nodeID], c.streak[nodeID] = skewed, 0
+	if skewed {
+		return clockSkewAlert{alerts.KindClockSkew, nodeID,
+			fmt.Sprintf("clock of node %s is off by %s (limit %s); its timestamps are not trusted", nodeID, skew.Round(time.Second), limit)}, true
+	}
+	return clockSkewAlert{alerts.KindClockSynced, nodeID,
+		fmt.Sprintf("clock of node %s is within %s again (off by %s)", nodeID, limit, skew.Round(time.Millisecond))}, true
+}
+
+// get returns the last offset of nodeID.
+func (c *clockSkews) get(nodeID string) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.skew[nodeID]
+	return d, ok
+}
+
+// max returns the offset furthest from zero.
+func (c *clockSkews) max() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out time.Duration
+	for _, d := range c.skew {
+		if absDuration(d) > absDuration(out) {
+			out = d
+		}
+	}
+	return out
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+var peerClocks = &clockSkews{}
+
+// maxClockSkew returns the configured limit, or 0 when the check is
+// disabled.
+func maxClockSkew() time.Duration {
+	s := cfg.GetConfig().Local.Nats.MaxClockSkewSeconds
+	switch {
+	case s < 0:
+		return 0
+	case s == 0:
+		return defaultMaxClockSkew
+	}
+	return time.Duration(s) * time.Second
+}
+
+// observeClockSkew records the offset of a heartbeat sent by nodeID at
+// sentAt and received at receivedAt.
+func observeClockSkew(nodeID string, sentAt, receivedAt time.Time) {
+	if sentAt.IsZero() {
+		return
+	}
+	a, ok := peerClocks.observe(nodeID, receivedAt.Sub(sentAt), maxClockSkew())
+	if !ok {
+		return
+	}
+	log.Log(log.Warn, "[NATS] clock skew: %s", a.message)
+	if isWatchdogReporter() {
+		dispatchClusterHealth(a.kind, cfg.GetConfig().Local.Nats.ClusterName, "clock-skew:"+a.nodeID, a.message)
+	}
+}
+
+// maxPeerClockSkew returns the largest peer offset seen.
+func maxPeerClockSkew() time.Duration {
+	return peerClocks.max()
+}
+
+// trustedTime returns t as stamped by nodeID, or receivedAt when t is more
+// than the configured limit from receivedAt or nodeID's clock is known to be
+// off by more than it.
+func trustedTime(nodeID string, t, receivedAt time.Time) time.Time {
+	limit := maxClockSkew()
+	if limit <= 0 {
+		return t
+	}
+	if skew, ok := peerClocks.get(nodeID); ok && absDuration(skew) > limit {
+		return receivedAt
+	}
+	if absDuration(receivedAt.Sub(t)) > limit {
+		return receivedAt
+	}
+	return t
+}
@@ -0,0 +1,63 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+)
+
+func TestClockSkewsConfirmSkewAndRecovery(t *testing.T) {
+	var c clockSkews
+	limit := 30 * time.Second
+
+	if _, ok := c.observe("monitor-2", 2*time.Second, limit); ok {
+		t.Fatal("expected a small offset to stay quiet")
+	}
+	if _, ok := c.observe("monitor-2", -10*time.Minute, limit); ok {
+		t.Fatal("expected a single skewed heartbeat to be ignored")
+	}
+	a, ok := c.observe("monitor-2", -10*time.Minute, limit)
+	if !ok || a.kind != alerts.KindClockSkew || a.nodeID != "monitor-2" {
+		t.Fatalf("expected clock skew after confirmation, got %+v %v", a, ok)
+	}
+	if _, ok := c.observe("monitor-2", -10*time.Minute, limit); ok {
+		t.Fatal("expected the skew to be reported once")
+	}
+	if got := c.max(); got != -10*time.Minute {
+		t.Fatalf("expected max skew -10m, got %s", got)
+	}
+
+	c.observe("monitor-2", time.Second, limit)
+	if a, ok := c.observe("monitor-2", time.Second, limit); !ok || a.kind != alerts.KindClockSynced {
+		t.Fatalf("expected clock synced, got %+v %v", a, ok)
+	}
+
+	if _, ok := c.observe("monitor-3", time.Hour, 0); ok {
+		t.Fatal("expected no alert with the check disabled")
+	}
+	if d, ok := c.get("monitor-3"); !ok || d != time.Hour {
+		t.Fatalf("expected offset recorded with the check disabled, got %s %v", d, ok)
+	}
+}
+
+func TestTrustedTimeFallsBackToReceiveTime(t *testing.T) {
+	prev := peerClocks
+	defer func() { peerClocks = prev }()
+	peerClocks = &clockSkews{}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	if got := trustedTime("monitor-1", now.Add(-5*time.Second), now); !got.Equal(now.Add(-5 * time.Second)) {
+		t.Fatalf("expected a close timestamp kept, got %s", got)
+	}
+	if got := trustedTime("monitor-1", now.Add(-10*time.Minute), now); !got.Equal(now) {
+		t.Fatalf("expected a distant timestamp replaced, got %s", got)
+	}
+
+	// A node known to be skewed is not trusted even when its stamp looks
+	// plausible, e.g. a decision delivered late.
+	peerClocks.observe("monitor-2", 5*time.Minute, defaultMaxClockSkew)
+	if got := trustedTime("monitor-2", now.Add(-time.Second), now); !got.Equal(now) {
+		t.Fatalf("expected a skewed node's timestamp replaced, got %s", got)
+	}
+}
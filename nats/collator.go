@@ -7,9 +7,14 @@ import (
 	"sync"
 	"time"
 
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
 	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+	"github.com/ibp-network/ibp-geodns-libs/digest"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
 	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+	"github.com/ibp-network/ibp-geodns-libs/store"
 
 	"github.com/nats-io/nats.go"
 )
@@ -26,6 +31,10 @@ import (
 
 var collatorDBInitOnce sync.Once
 
+// collatorPeerCheckDelay lets the startup joins and the first heartbeat
+// fill ClusterNodes before the active collators are counted.
+const collatorPeerCheckDelay = 2 * time.Minute
+
 func parseDateFlexible(s string) (time.Time, error) {
 	s = strings.TrimSpace(s)
 	if s == "" {
@@ -50,10 +59,19 @@ func buildUsageRecord(nodeID string, r UsageRecord) (data2.UsageRecord, error) {
 		return data2.UsageRecord{}, err
 	}
 
+	// Older DNS nodes do not resolve the service; use this node's config.
+	service := r.Service
+	if service == "" {
+		service = dat.ServiceForDomain(r.Domain)
+	}
+
 	return data2.UsageRecord{
 		Date:        dt,
+		Hourly:      r.Hourly,
+		Hour:        r.Hour,
 		NodeID:      nodeID,
 		Domain:      r.Domain,
+		Service:     service,
 		MemberName:  r.MemberName,
 		Asn:         r.Asn,
 		NetworkName: r.NetworkName,
@@ -65,9 +83,10 @@ func buildUsageRecord(nodeID string, r UsageRecord) (data2.UsageRecord, error) {
 }
 
 func handleUsageData(m *nats.Msg) {
+	ctx := core.ContextFromMsg(m)
 	var resp UsageResponse
 	if err := json.Unmarshal(m.Data, &resp); err != nil {
-		log.Log(log.Error, "[collator] usageData unmarshal: %v", err)
+		log.LogCtx(ctx, log.Error, "[collator] usageData unmarshal: %v", err)
 		return
 	}
 	if resp.NodeID != "" {
@@ -81,19 +100,19 @@ func handleUsageData(m *nats.Msg) {
 	for _, r := range resp.UsageRecords {
 		record, err := buildUsageRecord(resp.NodeID, r)
 		if err != nil {
-			log.Log(log.Warn, "[collator] skipping record with invalid date %q: %v", r.Date, err)
+			log.LogCtx(ctx, log.Warn, "[collator] skipping record with invalid date %q: %v", r.Date, err)
 			continue
 		}
 		records = append(records, record)
 	}
 
 	if len(records) == 0 {
-		log.Log(log.Warn, "[collator] no valid usage records to store from node %s", resp.NodeID)
+		log.LogCtx(ctx, log.Warn, "[collator] no valid usage records to store from node %s", resp.NodeID)
 		return
 	}
 
-	if err := data2.StoreUsageRecords(records); err != nil {
-		log.Log(log.Error, "[collator] StoreUsageRecords: %v", err)
+	if err := store.Default().Usage.Replace(records); err != nil {
+		log.LogCtx(ctx, log.Error, "[collator] StoreUsageRecords: %v", err)
 	}
 }
 
@@ -110,22 +129,67 @@ func StartUsageCollector() {
 
 	for {
 		collectOnce()
+		detectLastHourAnomalies()
+		if time.Now().UTC().Hour() == 0 {
+			rollupHourlyUsage()
+			applyUsageRetention()
+		}
+		if now := time.Now().UTC(); now.Hour() == usageReconcileHour {
+			if _, err := ReconcileUsage(now.AddDate(0, 0, -1)); err != nil {
+				log.Log(log.Error, "[collator] usage reconciliation: %v", err)
+			}
+		}
 		<-ticker.C
 	}
 }
 
+// rollupHourlyUsage folds hourly usage older than System.Usage's retention
+// into daily rows once a day.
+func rollupHourlyUsage() {
+	before := time.Now().UTC().Add(-dat.HourlyRetention(cfg.GetConfig().Local.System.Usage))
+	n, err := data2.RollupHourlyUsage(before)
+	if err != nil {
+		log.Log(log.Error, "[collator] hourly usage rollup: %v", err)
+		return
+	}
+	log.Log(log.Info, "[collator] folded %d hourly usage rows before %s into daily rows", n, before.Format("2006-01-02"))
+}
+
+// applyUsageRetention deletes usage older than System.Usage.RetentionDays
+// and runs the retention hooks, when a retention policy is set.
+func applyUsageRetention() {
+	before, ok := dat.UsageRetentionCutoff(cfg.GetConfig().Local.System.Usage, time.Now())
+	if !ok {
+		return
+	}
+	n, err := data2.PurgeUsage(before)
+	if err != nil {
+		log.Log(log.Error, "[collator] usage retention: %v", err)
+	} else {
+		log.Log(log.Info, "[collator] deleted %d usage rows before %s", n, before.Format("2006-01-02"))
+	}
+	dat.RunRetentionHooks(before)
+}
+
 func collectOnce() {
 	period := time.Now().UTC().Format("2006-01-02")
 	req := data2.UsageRequest{
-		StartDate: period,
-		EndDate:   period,
+		StartDate:     period,
+		EndDate:       period,
+		UniqueClients: true,
 	}
 
-	raw, err := RequestAllDnsUsage(req, 20*time.Second)
+	report, err := RequestAllDnsUsageDetailed(req, 20*time.Second, 0)
 	if err != nil {
 		log.Log(log.Error, "[collator] RequestAllDnsUsage: %v", err)
 		return
 	}
+	if len(report.UniqueClients) > 0 {
+		if err := data2.StoreUniqueClients(report.UniqueClients); err != nil {
+			log.Log(log.Error, "[collator] StoreUniqueClients: %v", err)
+		}
+	}
+	raw := report.Records
 	if len(raw) == 0 {
 		log.Log(log.Info, "[collator] no usage data returned from DNS nodes")
 		return
@@ -146,7 +210,7 @@ func collectOnce() {
 		return
 	}
 
-	if err := data2.StoreUsageRecords(records); err != nil {
+	if err := store.Default().Usage.Replace(records); err != nil {
 		log.Log(log.Error, "[collator] StoreUsageRecords: %v", err)
 		return
 	}
@@ -176,12 +240,31 @@ func StartCollatorServices() error {
 		return err
 	}
 
-	if _, err := Subscribe(subjects.DnsUsageData, handleUsageData); err != nil {
+	// Same queue group as the role subscription, so each push is stored once.
+	if _, err := QueueSubscribe(subjects.With(subjects.DnsUsageData), subjects.CollatorQueue, handleUsageData); err != nil {
 		return err
 	}
 
+	time.AfterFunc(collatorPeerCheckDelay, func() { warnMultipleCollators() })
+
 	go StartUsageCollector()
 	go StartMemoryJanitor()
+	go StartLatencyRollup()
+	go digest.Start()
 
 	return nil
 }
+
+// warnMultipleCollators logs a warning when more than one collator is
+// active and reports whether it did. Until collators elect a leader each of
+// them writes every finalized outage; member_events drops the second write
+// of a proposal, but the operator should know the cluster runs redundant.
+func warnMultipleCollators() bool {
+	ids := activeNodeIDs(RoleCollator)
+	if len(ids) < 2 {
+		return false
+	}
+	log.Log(log.Warn, "[NATS] %d active collators (%s) write member_events; duplicate writes are dropped by proposal ID",
+		len(ids), strings.Join(ids, ", "))
+	return true
+}
@@ -0,0 +1,66 @@
+package nats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	natsio "github.com/nats-io/nats.go"
+)
+
+// collatorDB gives the test the database connections of a collator: data2
+// on a script, no data/mysql connection.
+func collatorDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	prevData, prevData2 := mysql.DB, data2.DB
+	mysql.DB, data2.DB = nil, db
+	t.Cleanup(func() {
+		mysql.DB, data2.DB = prevData, prevData2
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return mock
+}
+
+func TestEventActionRequestUsesCollatorDatabase(t *testing.T) {
+	mock := collatorDB(t)
+	mock.ExpectBegin()
+	mock.ExpectPrepare(`FROM member_events WHERE id = \? FOR UPDATE`).ExpectQuery().
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "check_type", "check_name", "member_name", "domain_name", "endpoint",
+			"status", "is_ipv6", "start_time", "end_time", "error", "vote_data", "additional_data"}).
+			AddRow(int64(7), "site", "ping", "member-1", "", "", false, false, time.Now().Add(-time.Hour), nil, "timeout", nil, nil))
+	mock.ExpectPrepare(`UPDATE member_events SET end_time = \?`).ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	data, _ := json.Marshal(EventAction{Action: "annotate", EventID: 7, Author: "ops", Note: "upstream maintenance"})
+	// The reply fails without a connection; the action must still run on
+	// data2.DB instead of dereferencing the missing data/mysql connection.
+	handleEventActionRequest(&natsio.Msg{Subject: "collator.event.action", Reply: "_INBOX.test", Data: data})
+}
+
+func TestMaintenanceRequestUsesCollatorDatabase(t *testing.T) {
+	c := cfg.Config{Members: map[string]cfg.Member{"member-1": {Details: cfg.MemberDetails{Name: "member-1"}}}}
+	prev := cfg.SetConfig(c)
+	t.Cleanup(func() { cfg.SetConfig(prev) })
+
+	mock := collatorDB(t)
+	mock.ExpectExec(`INSERT INTO member_maintenance`).
+		WithArgs("member-1", sqlmock.AnyArg(), sqlmock.AnyArg(), "restart", "ops", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	data, _ := json.Marshal(MaintenanceRequest{Member: "member-1", Minutes: 30, Reason: "restart", DeclaredBy: "ops"})
+	handleMaintenanceRequest(&natsio.Msg{Subject: "collator.maintenance.declare", Reply: "_INBOX.test", Data: data})
+}
@@ -72,3 +72,23 @@ func TestHandleUsageDataMarksNodeHeardBeforeReturningOnEmptyRecords(t *testing.T
 		t.Fatalf("expected marked node to have LastHeard set")
 	}
 }
+
+func TestWarnMultipleCollators(t *testing.T) {
+	prev := activeNodeIDs
+	defer func() { activeNodeIDs = prev }()
+
+	collators := []string{"collator-a"}
+	activeNodeIDs = func(role string) []string {
+		if role == "IBPCollator" {
+			return collators
+		}
+		return nil
+	}
+	if warnMultipleCollators() {
+		t.Fatal("expected no warning for a single collator")
+	}
+	collators = []string{"collator-a", "collator-b"}
+	if !warnMultipleCollators() {
+		t.Fatal("expected a warning for two active collators")
+	}
+}
@@ -8,6 +8,8 @@ import (
 
 	cfg "github.com/ibp-network/ibp-geodns-libs/config"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
 
 	"github.com/nats-io/nats.go"
 )
@@ -15,7 +17,6 @@ import (
 var (
 	nc           *nats.Conn
 	connectionMu sync.RWMutex
-	callbackSem  = make(chan struct{}, 256)
 )
 
 func cloneNatsMsg(m *nats.Msg) *nats.Msg {
@@ -72,6 +73,8 @@ func Connect() error {
 	if err := validateNatsConfig(c); err != nil {
 		return err
 	}
+	configureHandlerPool(c.Local.Nats)
+	subjects.SetPrefix(c.Local.Nats.SubjectPrefix)
 	opts := []nats.Option{
 		nats.UserInfo(c.Local.Nats.User, c.Local.Nats.Pass),
 		nats.NoEcho(),
@@ -111,6 +114,9 @@ func Connect() error {
 	}
 	nc = conn
 	NC = conn
+	registerMaxmindDistributor()
+	registerRateLimits()
+	registerChaos()
 	log.Log(log.Info, "[NATS] Connected to %s", conn.ConnectedUrl())
 	return nil
 }
@@ -126,39 +132,75 @@ func Disconnect() {
 }
 
 func Publish(subject string, data []byte) error {
-	conn := currentConnection()
-	if conn == nil || conn.IsClosed() {
-		return nats.ErrConnectionClosed
-	}
-	return conn.Publish(subject, data)
+	return PublishMsg(&nats.Msg{Subject: subject, Data: data})
 }
 
 func PublishMsgWithReply(subject, reply string, data []byte) error {
+	return PublishMsg(&nats.Msg{Subject: subject, Reply: reply, Data: data})
+}
+
+// PublishMsg publishes a fully formed message, including any headers. A
+// correlation ID and this node's ID as sender are added when the caller did
+// not set them.
+func PublishMsg(msg *nats.Msg) error {
 	conn := currentConnection()
 	if conn == nil || conn.IsClosed() {
 		return nats.ErrConnectionClosed
 	}
-	return conn.PublishMsg(&nats.Msg{Subject: subject, Reply: reply, Data: data})
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	if msg.Header.Get(core.CorrelationHeader) == "" {
+		msg.Header.Set(core.CorrelationHeader, log.NewCorrelationID())
+	}
+	if msg.Header.Get(core.SenderHeader) == "" {
+		if node := cfg.GetConfig().Local.Nats.NodeID; node != "" {
+			msg.Header.Set(core.SenderHeader, node)
+		}
+	}
+	if inj := chaosInjector.Load(); inj != nil {
+		return inj.Publish(msg, conn.PublishMsg)
+	}
+	return conn.PublishMsg(msg)
 }
 
 func Subscribe(subject string, cb func(*nats.Msg)) (*nats.Subscription, error) {
+	return subscribe(subject, "", cb)
+}
+
+// QueueSubscribe subscribes as a member of queue, so each message on subject
+// is delivered to only one member of the group.
+func QueueSubscribe(subject, queue string, cb func(*nats.Msg)) (*nats.Subscription, error) {
+	return subscribe(subject, queue, cb)
+}
+
+func subscribe(subject, queue string, cb func(*nats.Msg)) (*nats.Subscription, error) {
 	conn := currentConnection()
 	if conn == nil || conn.IsClosed() {
 		return nil, nats.ErrConnectionClosed
 	}
-	sub, err := conn.Subscribe(subject, func(m *nats.Msg) {
-		callbackSem <- struct{}{}
-		msgCopy := cloneNatsMsg(m)
-		go func() {
-			defer func() {
-				<-callbackSem
-				if r := recover(); r != nil {
-					log.Log(log.Error, "[NATS] callback panic for %s: %v", msgCopy.Subject, r)
-				}
-			}()
-			cb(msgCopy)
-		}()
-	})
+	pool := currentPool()
+	q := pool.queue(subject)
+	deliver := func(m *nats.Msg) {
+		pool.enqueue(q, handlerJob{cb: cb, msg: m})
+	}
+	handler := func(m *nats.Msg) {
+		if inj := chaosInjector.Load(); inj != nil {
+			inj.Deliver(cloneNatsMsg(m), deliver)
+			return
+		}
+		deliver(cloneNatsMsg(m))
+	}
+
+	var (
+		sub *nats.Subscription
+		err error
+	)
+	if queue != "" {
+		sub, err = conn.QueueSubscribe(subject, queue, handler)
+	} else {
+		sub, err = conn.Subscribe(subject, handler)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -166,10 +208,17 @@ func Subscribe(subject string, cb func(*nats.Msg)) (*nats.Subscription, error) {
 	return sub, nil
 }
 
+// Request sends one request and waits for the first reply. A reply missing
+// after timeout returns ErrTimeout and a subject nobody serves returns
+// ErrNoActiveNodes.
 func Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
 	conn := currentConnection()
 	if conn == nil || conn.IsClosed() {
 		return nil, nats.ErrConnectionClosed
 	}
-	return conn.Request(subject, data, timeout)
+	msg, err := conn.Request(subject, data, timeout)
+	if err != nil {
+		return nil, requestError(subject, err)
+	}
+	return msg, nil
 }
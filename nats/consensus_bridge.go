@@ -1,6 +1,8 @@
 package nats
 
 import (
+	"time"
+
 	cfg "github.com/ibp-network/ibp-geodns-libs/config"
 	dat "github.com/ibp-network/ibp-geodns-libs/data"
 	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
@@ -11,13 +13,80 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
+const (
+	proposalLanesReloadHook    = "nats.proposallanes"
+	proposalTimeoutsReloadHook = "nats.proposaltimeouts"
+)
+
+var (
+	proposalLanes    = modconsensus.NewLanes(nil, 0)
+	proposalTimeouts = modconsensus.NewTimeouts()
+)
+
 var consensusDeps = modconsensus.Dependencies{
 	State:               &State,
 	Publish:             Publish,
+	PublishMsg:          PublishMsg,
 	CountActiveMonitors: countActiveMonitors,
 	IsNodeActive:        isNodeActive,
 	MarkNodeHeard:       markNodeHeard,
 	OnFinalize:          onConsensusFinalize,
+	IsShadowCheck:       isShadowCheck,
+	Sequencer:           finalizeSequencer,
+	Tracker:             finalizeTracker,
+	OnGap:               onFinalizeGap,
+	Lanes:               proposalLanes,
+	Timeouts:            proposalTimeouts,
+	MinOfflineRegions:   minOfflineRegions,
+	CheckRules:          checkRules,
+}
+
+func minOfflineRegions() int {
+	return cfg.GetConfig().Local.Nats.MinOfflineRegions
+}
+
+// ProposalLaneStats reports the queue depth, concurrency and throughput of
+// the proposal lanes, highest priority first.
+func ProposalLaneStats() []LaneStats {
+	return proposalLanes.Stats()
+}
+
+func applyProposalLanes() {
+	proposalLanes.SetConcurrency(cfg.GetConfig().Local.Nats.ProposalLanes)
+}
+
+func registerProposalLanes() {
+	applyProposalLanes()
+	cfg.RegisterReloadHook(proposalLanesReloadHook, applyProposalLanes)
+}
+
+// ProposalTimeoutStats reports the proposal timeout of every check type
+// and the vote arrivals behind it.
+func ProposalTimeoutStats() []TimeoutStats {
+	State.Mu.RLock()
+	fallback := State.ProposalTimeout
+	State.Mu.RUnlock()
+	return proposalTimeouts.Stats(fallback)
+}
+
+func applyProposalTimeouts() {
+	a := cfg.GetConfig().Local.Nats.AdaptiveProposalTimeout
+	if a == nil {
+		proposalTimeouts.SetPolicy(false, modconsensus.TimeoutPolicy{})
+		return
+	}
+	proposalTimeouts.SetPolicy(true, modconsensus.TimeoutPolicy{
+		Percentile: a.Percentile,
+		Multiplier: a.Multiplier,
+		Min:        time.Duration(a.MinSeconds) * time.Second,
+		Max:        time.Duration(a.MaxSeconds) * time.Second,
+		MinSamples: a.MinSamples,
+	})
+}
+
+func registerProposalTimeouts() {
+	applyProposalTimeouts()
+	cfg.RegisterReloadHook(proposalTimeoutsReloadHook, applyProposalTimeouts)
 }
 
 func ProposeCheckStatus(
@@ -31,6 +100,13 @@ func ProposeCheckStatus(
 	modconsensus.ProposeCheckStatus(consensusDeps, checkType, checkName, memberName, domainName, endpoint, status, errorText, dataMap, isIPv6)
 }
 
+// ObserveLocalResult is called by monitors for every local result that
+// matches the official status and is therefore not proposed; it resets the
+// target's consensusHysteresis run.
+func ObserveLocalResult(checkType, checkName, memberName, domainName, endpoint string, isIPv6 bool) {
+	modconsensus.ObserveLocalResult(checkType, checkName, memberName, domainName, endpoint, isIPv6)
+}
+
 func handleProposal(m *nats.Msg) {
 	modconsensus.HandleProposal(consensusDeps, m)
 }
@@ -44,44 +120,149 @@ func handleFinalize(m *nats.Msg) {
 }
 
 func onConsensusFinalize(fm core.FinalizeMessage) {
+	if State.ThisNode.NodeRole == RoleCollator {
+		data2.RecordProposalOutcome(toData2Proposal(fm.Proposal), fm.Passed, fm.DecidedAt, fm.Votes)
+		recordDecision(fm)
+	}
+	if fm.Proposal.Shadow {
+		handleShadowFinalize(fm)
+		return
+	}
 	if !fm.Passed {
 		return
 	}
 
+	State.Mu.RLock()
+	applied := State.Applied
+	State.Mu.RUnlock()
+	if !applied.MarkApplied(fm.Proposal.ID, fm.DecidedAt) {
+		log.Log(log.Debug, "[NATS] finalize for proposal %s already applied; skipping", fm.Proposal.ID)
+		return
+	}
+
 	switch State.ThisNode.NodeRole {
-	case "IBPMonitor":
+	case RoleMonitor:
 		applyOfficialChanges(fm.Proposal)
-	case "IBPCollator":
+	case RoleCollator:
 		handleCollatorFinalize(fm)
 	}
 }
 
+// recordDecision stores why fm's proposal passed or failed. Finalize
+// messages of older finalizers carry only the votes.
+func recordDecision(fm core.FinalizeMessage) {
+	rec := data2.DecisionRecord{
+		Proposal:        toData2Proposal(fm.Proposal),
+		Passed:          fm.Passed,
+		FinalizerNodeID: fm.SenderNodeID,
+	}
+	if fm.Decision != nil {
+		rec.Decision = *fm.Decision
+	} else {
+		rec.ProposedAt = fm.Proposal.Timestamp.UTC()
+		rec.DecidedAt = fm.DecidedAt.UTC()
+		for nodeID, agree := range fm.Votes {
+			rec.Votes = append(rec.Votes, data2.DecisionVote{
+				NodeID:      nodeID,
+				Agree:       agree,
+				LocalStatus: agree == fm.Proposal.ProposedStatus,
+			})
+		}
+	}
+	if err := data2.RecordDecision(rec); err != nil {
+		log.Log(log.Error, "[NATS] recordDecision: %v", err)
+	}
+}
+
+// isShadowCheck reports whether the configured check is flagged Shadow.
+// checkRules returns a check's consensus overrides from its typed options.
+// Invalid options were rejected when the config loaded.
+func checkRules(checkType, checkName string) modconsensus.Rules {
+	chk, ok := findCheckByName(checkName, checkType)
+	if !ok {
+		return modconsensus.Rules{}
+	}
+	opts, err := cfg.OptionsFor(chk)
+	if err != nil {
+		return modconsensus.Rules{}
+	}
+	c := opts.Consensus()
+	return modconsensus.Rules{
+		QuorumPercent: c.QuorumPercent,
+		MinVotes:      c.MinVotes,
+		Timeout:       time.Duration(c.TimeoutSeconds) * time.Second,
+		Hysteresis:    c.Hysteresis,
+	}
+}
+
+func isShadowCheck(checkType, checkName string) bool {
+	chk, ok := findCheckByName(checkName, checkType)
+	return ok && chk.Shadow
+}
+
+// handleShadowFinalize logs the outcome of a shadow proposal and, on
+// collators, stores it in shadow_results. Nothing official changes.
+func handleShadowFinalize(fm core.FinalizeMessage) {
+	p := fm.Proposal
+	log.Log(log.Info,
+		"[CONSENSUS] shadow outcome id=%s type=%s check=%s member=%s domain=%s endpoint=%s status=%v passed=%v v6=%v",
+		p.ID, p.CheckType, p.CheckName, p.MemberName, p.DomainName, p.Endpoint, p.ProposedStatus, fm.Passed, p.IsIPv6)
+
+	if State.ThisNode.NodeRole != RoleCollator {
+		return
+	}
+	data2.PopProposal(string(p.ID))
+	err := data2.RecordShadowResult(data2.ShadowResult{
+		ProposalID:     string(p.ID),
+		CheckType:      p.CheckType,
+		CheckName:      p.CheckName,
+		Member:         p.MemberName,
+		Domain:         p.DomainName,
+		Endpoint:       p.Endpoint,
+		IsIPv6:         p.IsIPv6,
+		ProposedStatus: p.ProposedStatus,
+		Passed:         fm.Passed,
+		Error:          p.ErrorText,
+		Votes:          fm.Votes,
+		DecidedAt:      fm.DecidedAt,
+	})
+	if err != nil {
+		log.Log(log.Error, "[NATS] handleShadowFinalize: %v", err)
+	}
+}
+
 func handleCollatorFinalize(fm core.FinalizeMessage) {
 	ct := checkTypeToInt(fm.Proposal.CheckType)
 	url := deriveCheckURL(fm.Proposal)
 	cachedProposal, hasCachedProposal := data2.PopProposal(string(fm.Proposal.ID))
 
 	rec := data2.NetStatusRecord{
-		CheckType: ct,
-		CheckName: fm.Proposal.CheckName,
-		CheckURL:  url,
-		Domain:    fm.Proposal.DomainName,
-		Member:    fm.Proposal.MemberName,
-		IsIPv6:    fm.Proposal.IsIPv6,
+		CheckType:  ct,
+		CheckName:  fm.Proposal.CheckName,
+		CheckURL:   url,
+		Domain:     fm.Proposal.DomainName,
+		Member:     fm.Proposal.MemberName,
+		IsIPv6:     fm.Proposal.IsIPv6,
+		ProposalID: string(fm.Proposal.ID),
 	}
 
 	if !fm.Proposal.ProposedStatus {
 		rec.Status = false
-		rec.StartTime = fm.DecidedAt.UTC()
+		// A skewed finalizer would move the start of the outage; its
+		// decision time is only trusted within the clock skew limit.
+		rec.StartTime = trustedTime(fm.SenderNodeID, fm.DecidedAt.UTC(), time.Now().UTC())
 		rec.Error = fm.Proposal.ErrorText
-		if hasCachedProposal {
+		// The finalizer's tally is authoritative; the votes this collator
+		// happened to observe are a fallback for older finalizers.
+		switch {
+		case len(fm.Votes) > 0:
+			rec.VoteData = fm.Votes
+		case hasCachedProposal:
 			rec.VoteData = cachedProposal.VoteData
 		}
 		rec.Extra = fm.Proposal.Data
 
-		if err := data2.InsertNetStatus(rec); err != nil {
-			log.Log(log.Error, "[NATS] handleFinalize: InsertNetStatus: %v", err)
-		}
+		data2.HoldNetStatus(rec)
 	} else {
 		if err := data2.CloseOpenEvent(rec); err != nil {
 			log.Log(log.Error, "[NATS] handleFinalize: CloseOpenEvent: %v", err)
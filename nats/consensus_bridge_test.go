@@ -0,0 +1,30 @@
+package nats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	modconsensus "github.com/ibp-network/ibp-geodns-libs/nats/modules/consensus"
+)
+
+func TestCheckRulesReadsExtraOptions(t *testing.T) {
+	var opts map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"consensusQuorumPercent": 66, "consensusMinVotes": 3,
+		"consensusTimeoutSeconds": 45, "consensusHysteresis": 2}`), &opts); err != nil {
+		t.Fatal(err)
+	}
+	var c cfg.Config
+	c.Local.Checks = []cfg.Check{{Name: "icmp", CheckType: "site", ExtraOptions: opts}}
+	prev := cfg.SetConfig(c)
+	t.Cleanup(func() { cfg.SetConfig(prev) })
+
+	want := modconsensus.Rules{QuorumPercent: 66, MinVotes: 3, Timeout: 45 * time.Second, Hysteresis: 2}
+	if got := checkRules("site", "icmp"); got != want {
+		t.Fatalf("checkRules = %+v, want %+v", got, want)
+	}
+	if got := checkRules("endpoint", "icmp"); got != (modconsensus.Rules{}) {
+		t.Fatalf("checkRules of an unknown check = %+v, want zero", got)
+	}
+}
@@ -0,0 +1,330 @@
+// Package fanout implements the inbox scatter-gather used to ask every node of
+// a role for data: publish one request with a private reply inbox, collect one
+// reply, or one multi-part answer, per responding node until the expected
+// count arrives or the timeout fires, and drop duplicates and stragglers.
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Transport is the messaging surface a fan-out needs. Publish is expected to
+// carry the correlation and trace headers of ctx.
+type Transport struct {
+	NodeID    string
+	Subscribe func(subject string, cb func(*nats.Msg)) (*nats.Subscription, error)
+	Publish   func(ctx context.Context, subject, reply string, data []byte) error
+}
+
+// Result holds the replies of one fan-out, keyed by responder, and how each
+// node answered.
+type Result[T any] struct {
+	Responses map[string]T
+	Nodes     map[string]NodeStatus
+	Expected  int
+	Complete  bool // every expected responder replied before the deadline
+}
+
+// NodeStatus reports how one node answered a fan-out. Nodes that were named
+// in Options.Nodes but never replied have Replied unset.
+type NodeStatus struct {
+	NodeID  string        `json:"nodeID"`
+	Replied bool          `json:"replied"`
+	Late    bool          `json:"late,omitempty"` // replied during the grace period
+	Latency time.Duration `json:"latency,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// OK reports whether the node replied without an error.
+func (s NodeStatus) OK() bool { return s.Replied && s.Error == "" }
+
+// Options tunes RequestWith.
+type Options[T any] struct {
+	Timeout time.Duration
+	// Grace keeps accepting replies for this long after Timeout when some
+	// expected node is still missing. Zero disables the grace period.
+	Grace time.Duration
+	// Nodes lists the IDs expected to reply. When set, the fan-out completes
+	// once all of them replied and silent ones are reported in Result.Nodes.
+	Nodes []string
+	// Expected is the number of distinct responders to wait for when Nodes
+	// is empty.
+	Expected int
+	// Responder extracts the replying node's ID.
+	Responder func(T) string
+	// Failure optionally extracts an error reported inside a reply.
+	Failure func(T) string
+	// Part, when set, reports that a reply is one part of a longer answer:
+	// its zero-based index and whether it is the last part. Subscription
+	// callbacks may run concurrently, so parts can arrive in any order; a
+	// responder's parts are buffered until the last one and every index
+	// before it arrived, then folded in index order with Merge, and the node
+	// counts as replied. An answer cut short by the deadline is reported as
+	// an incomplete reply and left out of Responses. A plain reply is part
+	// 0 and the last.
+	Part func(T) (index int, last bool)
+	// Merge folds part into the parts before it. Required with Part.
+	Merge func(acc, part T) T
+}
+
+// partialReply holds the parts of one responder's answer received so far.
+type partialReply[T any] struct {
+	parts map[int]T
+	last  int // index of the last part, -1 until it arrives
+}
+
+// add stores part at index and reports whether it was new and acceptable.
+func (p *partialReply[T]) add(part T, index int, last bool) bool {
+	if _, dup := p.parts[index]; dup || index < 0 || (p.last >= 0 && index > p.last) {
+		return false
+	}
+	if last {
+		for i := range p.parts {
+			if i > index {
+				return false
+			}
+		}
+		p.last = index
+	}
+	p.parts[index] = part
+	return true
+}
+
+// done reports whether every part up to the last one arrived.
+func (p *partialReply[T]) done() bool {
+	return p.last >= 0 && len(p.parts) == p.last+1
+}
+
+// merge folds the parts in index order.
+func (p *partialReply[T]) merge(fold func(acc, part T) T) T {
+	acc := p.parts[0]
+	for i := 1; i <= p.last; i++ {
+		acc = fold(acc, p.parts[i])
+	}
+	return acc
+}
+
+// Values returns the replies ordered by responder ID.
+func (r Result[T]) Values() []T {
+	ids := make([]string, 0, len(r.Responses))
+	for id := range r.Responses {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	out := make([]T, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, r.Responses[id])
+	}
+	return out
+}
+
+// Statuses returns the per-node outcome ordered by node ID.
+func (r Result[T]) Statuses() []NodeStatus {
+	out := make([]NodeStatus, 0, len(r.Nodes))
+	for _, st := range r.Nodes {
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].NodeID < out[j].NodeID })
+	return out
+}
+
+// Failed returns the nodes that did not reply or replied with an error,
+// ordered by node ID.
+func (r Result[T]) Failed() []NodeStatus {
+	var out []NodeStatus
+	for _, st := range r.Statuses() {
+		if !st.OK() {
+			out = append(out, st)
+		}
+	}
+	return out
+}
+
+// Request publishes req on subject and gathers replies of type T until
+// expected distinct responders have answered, timeout elapses or ctx is
+// done. It is RequestWith without a node list or grace period.
+func Request[T any](
+	ctx context.Context,
+	tr Transport,
+	subject string,
+	req any,
+	timeout time.Duration,
+	expected int,
+	responder func(T) string,
+) (Result[T], error) {
+	return RequestWith(ctx, tr, subject, req, Options[T]{
+		Timeout:   timeout,
+		Expected:  expected,
+		Responder: responder,
+	})
+}
+
+// RequestWith publishes req on subject and gathers replies of type T. It
+// returns as soon as the last expected node replies; otherwise it waits for
+// opts.Timeout, plus opts.Grace while nodes are still missing, or until ctx
+// is done. A reply with an empty responder ID or from a node that already
+// answered is ignored, and replies that arrive after RequestWith returns are
+// dropped. Running out of time is not an error: the partial result is
+// returned with Complete unset and the silent nodes listed in Nodes.
+func RequestWith[T any](ctx context.Context, tr Transport, subject string, req any, opts Options[T]) (Result[T], error) {
+	// pending holds the named nodes still to reply; without a node list
+	// remaining counts down distinct responders instead.
+	expected := opts.Expected
+	var pending map[string]struct{}
+	if len(opts.Nodes) > 0 {
+		pending = make(map[string]struct{}, len(opts.Nodes))
+		for _, id := range opts.Nodes {
+			pending[id] = struct{}{}
+		}
+		expected = len(pending)
+	}
+	res := Result[T]{
+		Responses: make(map[string]T),
+		Nodes:     make(map[string]NodeStatus),
+		Expected:  expected,
+	}
+	if expected <= 0 {
+		return res, fmt.Errorf("fanout %s: %w", subject, errdefs.ErrNoActiveNodes)
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("fanout %s: marshal request: %w", subject, err)
+	}
+
+	var (
+		mu        sync.Mutex
+		closed    bool
+		inGrace   bool
+		parts     = make(map[string]*partialReply[T])
+		remaining = expected
+		complete  = make(chan struct{})
+		sentAt    time.Time
+	)
+	inbox := fmt.Sprintf("_INBOX.%s.%s.%d", tr.NodeID, subject, time.Now().UnixNano())
+
+	sub, err := tr.Subscribe(inbox, func(msg *nats.Msg) {
+		var reply T
+		if err := json.Unmarshal(msg.Data, &reply); err != nil {
+			log.LogCtx(ctx, log.Error, "[NATS] fanout %s: unmarshal error: %v", subject, err)
+			return
+		}
+		id := opts.Responder(reply)
+		if id == "" {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			log.LogCtx(ctx, log.Debug, "[NATS] fanout %s: late reply from %s dropped", subject, id)
+			return
+		}
+		if _, dup := res.Responses[id]; dup {
+			log.LogCtx(ctx, log.Warn, "[NATS] fanout %s: duplicate reply from %s ignored", subject, id)
+			return
+		}
+		if opts.Part != nil {
+			index, last := opts.Part(reply)
+			p, ok := parts[id]
+			if !ok {
+				p = &partialReply[T]{parts: make(map[int]T), last: -1}
+				parts[id] = p
+			}
+			if !p.add(reply, index, last) {
+				log.LogCtx(ctx, log.Warn, "[NATS] fanout %s: duplicate or invalid part %d from %s ignored", subject, index, id)
+				return
+			}
+			if !p.done() {
+				return
+			}
+			reply = p.merge(opts.Merge)
+			delete(parts, id)
+		}
+		res.Responses[id] = reply
+
+		st := NodeStatus{NodeID: id, Replied: true, Late: inGrace, Latency: time.Since(sentAt)}
+		if opts.Failure != nil {
+			st.Error = opts.Failure(reply)
+		}
+		res.Nodes[id] = st
+
+		if pending != nil {
+			if _, ok := pending[id]; !ok {
+				return
+			}
+			delete(pending, id)
+		}
+		if remaining--; remaining == 0 {
+			close(complete)
+		}
+	})
+	if err != nil {
+		return res, fmt.Errorf("fanout %s: subscribe error: %w", subject, err)
+	}
+	defer sub.Unsubscribe()
+
+	mu.Lock()
+	sentAt = time.Now()
+	mu.Unlock()
+	if err := tr.Publish(ctx, subject, inbox, data); err != nil {
+		return res, fmt.Errorf("fanout %s: publish error: %w", subject, err)
+	}
+
+	timer := time.NewTimer(opts.Timeout)
+	defer timer.Stop()
+
+	select {
+	case <-complete:
+	case <-ctx.Done():
+	case <-timer.C:
+		if opts.Grace > 0 {
+			mu.Lock()
+			inGrace = true
+			mu.Unlock()
+			timer.Reset(opts.Grace)
+			select {
+			case <-complete:
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	closed = true
+	res.Complete = remaining <= 0
+	for id := range pending {
+		res.Nodes[id] = NodeStatus{NodeID: id, Error: "no reply"}
+	}
+	for id := range parts {
+		res.Nodes[id] = NodeStatus{NodeID: id, Error: "incomplete reply"}
+	}
+	if !res.Complete {
+		log.LogCtx(ctx, log.Warn, "[NATS] fanout %s: timeout after receiving %d/%d responses",
+			subject, expected-remaining, expected)
+	}
+
+	responses := make(map[string]T, len(res.Responses))
+	for id, reply := range res.Responses {
+		responses[id] = reply
+	}
+	nodes := make(map[string]NodeStatus, len(res.Nodes))
+	for id, st := range res.Nodes {
+		nodes[id] = st
+	}
+	res.Responses, res.Nodes = responses, nodes
+	return res, nil
+}
@@ -0,0 +1,313 @@
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
+
+	"github.com/nats-io/nats.go"
+)
+
+type testReply struct {
+	NodeID string `json:"nodeID"`
+	Value  int    `json:"value"`
+	Part   int    `json:"part,omitempty"`
+	More   bool   `json:"more,omitempty"`
+}
+
+// fakeBus delivers replies to the inbox subscribed by Request.
+type fakeBus struct {
+	mu      sync.Mutex
+	handler func(*nats.Msg)
+	onPub   func(reply string)
+}
+
+func (b *fakeBus) transport() Transport {
+	return Transport{
+		NodeID: "collator-a",
+		Subscribe: func(subject string, cb func(*nats.Msg)) (*nats.Subscription, error) {
+			b.mu.Lock()
+			b.handler = cb
+			b.mu.Unlock()
+			return &nats.Subscription{Subject: subject}, nil
+		},
+		Publish: func(ctx context.Context, subject, reply string, data []byte) error {
+			if b.onPub != nil {
+				b.onPub(reply)
+			}
+			return nil
+		},
+	}
+}
+
+func (b *fakeBus) reply(r any) {
+	data, _ := json.Marshal(r)
+	b.mu.Lock()
+	h := b.handler
+	b.mu.Unlock()
+	h(&nats.Msg{Data: data})
+}
+
+func replyID(r testReply) string { return r.NodeID }
+
+func testPart(r testReply) (int, bool) { return r.Part, !r.More }
+
+func sumParts(acc, part testReply) testReply {
+	part.Value += acc.Value
+	return part
+}
+
+func TestRequestCompletesWhenAllExpectedReply(t *testing.T) {
+	bus := &fakeBus{}
+	bus.onPub = func(string) {
+		go func() {
+			bus.reply(testReply{NodeID: "dns-b", Value: 2})
+			bus.reply(testReply{NodeID: "dns-a", Value: 1})
+			bus.reply(testReply{NodeID: "dns-a", Value: 99}) // duplicate
+		}()
+	}
+
+	start := time.Now()
+	res, err := Request(context.Background(), bus.transport(), "dns.usage.getUsage", struct{}{}, 5*time.Second, 2, replyID)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("expected early return once all replies arrived")
+	}
+	if !res.Complete || len(res.Responses) != 2 {
+		t.Fatalf("expected complete result with 2 replies, got %+v", res)
+	}
+	vals := res.Values()
+	if vals[0].NodeID != "dns-a" || vals[0].Value != 1 || vals[1].NodeID != "dns-b" {
+		t.Fatalf("expected replies ordered by node with duplicates dropped, got %+v", vals)
+	}
+}
+
+func TestRequestReturnsPartialResultOnTimeout(t *testing.T) {
+	bus := &fakeBus{}
+	bus.onPub = func(string) {
+		go bus.reply(testReply{NodeID: "dns-a", Value: 1})
+	}
+
+	res, err := Request(context.Background(), bus.transport(), "dns.usage.getUsage", struct{}{}, 100*time.Millisecond, 3, replyID)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if res.Complete || len(res.Responses) != 1 || res.Expected != 3 {
+		t.Fatalf("expected partial result with 1/3 replies, got %+v", res)
+	}
+}
+
+func TestRequestDropsStragglers(t *testing.T) {
+	bus := &fakeBus{}
+	bus.onPub = func(string) {
+		go bus.reply(testReply{NodeID: "dns-a", Value: 1})
+	}
+
+	res, err := Request(context.Background(), bus.transport(), "dns.usage.getUsage", struct{}{}, 5*time.Second, 1, replyID)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+
+	// A reply delivered after Request returned must not show up in the result.
+	bus.reply(testReply{NodeID: "dns-late", Value: 7})
+	if len(res.Responses) != 1 {
+		t.Fatalf("expected straggler to be dropped, got %+v", res.Responses)
+	}
+}
+
+func TestRequestHonoursContextCancel(t *testing.T) {
+	bus := &fakeBus{}
+	ctx, cancel := context.WithCancel(context.Background())
+	bus.onPub = func(string) { cancel() }
+
+	res, err := Request(ctx, bus.transport(), "dns.usage.getUsage", struct{}{}, 5*time.Second, 1, replyID)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if res.Complete {
+		t.Fatal("expected cancelled request to be incomplete")
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	bus := &fakeBus{}
+	if _, err := Request(context.Background(), bus.transport(), "s", struct{}{}, time.Second, 0, replyID); !errors.Is(err, errdefs.ErrNoActiveNodes) {
+		t.Fatalf("expected ErrNoActiveNodes when no responders are expected, got %v", err)
+	}
+
+	tr := bus.transport()
+	tr.Publish = func(context.Context, string, string, []byte) error { return errors.New("down") }
+	if _, err := Request(context.Background(), tr, "s", struct{}{}, time.Second, 1, replyID); err == nil {
+		t.Fatal("expected publish error to be returned")
+	}
+}
+
+func TestRequestWithReportsPerNodeStatus(t *testing.T) {
+	type reply struct {
+		NodeID string `json:"nodeID"`
+		Error  string `json:"error"`
+	}
+	bus := &fakeBus{}
+	bus.onPub = func(string) {
+		go func() {
+			bus.reply(reply{NodeID: "dns-a"})
+			bus.reply(reply{NodeID: "dns-b", Error: "db down"})
+		}()
+	}
+
+	res, err := RequestWith(context.Background(), bus.transport(), "s", struct{}{}, Options[reply]{
+		Timeout:   100 * time.Millisecond,
+		Nodes:     []string{"dns-a", "dns-b", "dns-c"},
+		Responder: func(r reply) string { return r.NodeID },
+		Failure:   func(r reply) string { return r.Error },
+	})
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if res.Complete || res.Expected != 3 {
+		t.Fatalf("expected incomplete 3-node result, got %+v", res)
+	}
+	if !res.Nodes["dns-a"].OK() {
+		t.Fatalf("expected dns-a to be ok, got %+v", res.Nodes["dns-a"])
+	}
+	failed := res.Failed()
+	if len(failed) != 2 || failed[0].NodeID != "dns-b" || failed[0].Error != "db down" ||
+		failed[1].NodeID != "dns-c" || failed[1].Replied {
+		t.Fatalf("expected dns-b error and dns-c missing, got %+v", failed)
+	}
+}
+
+func TestRequestWithCompletesOnLastNamedNode(t *testing.T) {
+	bus := &fakeBus{}
+	bus.onPub = func(string) {
+		go func() {
+			bus.reply(testReply{NodeID: "dns-x"}) // not expected; must not complete the request
+			bus.reply(testReply{NodeID: "dns-a"})
+			bus.reply(testReply{NodeID: "dns-b"})
+		}()
+	}
+
+	start := time.Now()
+	res, err := RequestWith(context.Background(), bus.transport(), "s", struct{}{}, Options[testReply]{
+		Timeout:   5 * time.Second,
+		Nodes:     []string{"dns-a", "dns-b"},
+		Responder: replyID,
+	})
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if time.Since(start) > time.Second || !res.Complete {
+		t.Fatalf("expected early completion, got %+v", res)
+	}
+	if len(res.Responses) != 3 {
+		t.Fatalf("expected extra responder to be kept, got %d replies", len(res.Responses))
+	}
+}
+
+func TestRequestWithAcceptsStragglersDuringGrace(t *testing.T) {
+	bus := &fakeBus{}
+	bus.onPub = func(string) {
+		go func() {
+			bus.reply(testReply{NodeID: "dns-a"})
+			time.Sleep(80 * time.Millisecond)
+			bus.reply(testReply{NodeID: "dns-b"})
+		}()
+	}
+
+	start := time.Now()
+	res, err := RequestWith(context.Background(), bus.transport(), "s", struct{}{}, Options[testReply]{
+		Timeout:   30 * time.Millisecond,
+		Grace:     2 * time.Second,
+		Nodes:     []string{"dns-a", "dns-b"},
+		Responder: replyID,
+	})
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if !res.Complete || time.Since(start) > time.Second {
+		t.Fatalf("expected straggler to complete the request inside the grace period, got %+v", res)
+	}
+	if res.Nodes["dns-a"].Late || !res.Nodes["dns-b"].Late {
+		t.Fatalf("expected only dns-b to be late, got %+v", res.Nodes)
+	}
+}
+
+func TestRequestWithMergesMultiPartReplies(t *testing.T) {
+	bus := &fakeBus{}
+	bus.onPub = func(string) {
+		go func() {
+			bus.reply(testReply{NodeID: "dns-a", Value: 1, More: true})
+			bus.reply(testReply{NodeID: "dns-b", Value: 10})
+			bus.reply(testReply{NodeID: "dns-a", Value: 2, Part: 1, More: true})
+			bus.reply(testReply{NodeID: "dns-c", Value: 100, More: true})
+			bus.reply(testReply{NodeID: "dns-a", Value: 3, Part: 2})
+		}()
+	}
+
+	res, err := RequestWith(context.Background(), bus.transport(), "s", struct{}{}, Options[testReply]{
+		Timeout:   200 * time.Millisecond,
+		Nodes:     []string{"dns-a", "dns-b", "dns-c"},
+		Responder: replyID,
+		Part:      testPart,
+		Merge:     sumParts,
+	})
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if res.Complete {
+		t.Fatal("expected dns-c's unfinished answer to leave the request incomplete")
+	}
+	if got := res.Responses["dns-a"].Value; got != 6 {
+		t.Fatalf("expected dns-a's parts to be merged into 6, got %d", got)
+	}
+	if got := res.Responses["dns-b"].Value; got != 10 {
+		t.Fatalf("expected dns-b's single reply, got %d", got)
+	}
+	if _, ok := res.Responses["dns-c"]; ok {
+		t.Fatal("expected dns-c's partial answer to be left out")
+	}
+	if st := res.Nodes["dns-c"]; st.Replied || st.Error != "incomplete reply" {
+		t.Fatalf("expected dns-c to be reported incomplete, got %+v", st)
+	}
+}
+
+func TestRequestWithReordersParts(t *testing.T) {
+	bus := &fakeBus{}
+	bus.onPub = func(string) {
+		go func() {
+			// Pooled subscription callbacks handle the last part first.
+			bus.reply(testReply{NodeID: "dns-a", Value: 3, Part: 2})
+			bus.reply(testReply{NodeID: "dns-a", Value: 1, More: true})
+			bus.reply(testReply{NodeID: "dns-a", Value: 1, More: true})
+			bus.reply(testReply{NodeID: "dns-a", Value: 2, Part: 1, More: true})
+		}()
+	}
+
+	var order []int
+	res, err := RequestWith(context.Background(), bus.transport(), "s", struct{}{}, Options[testReply]{
+		Timeout:   time.Second,
+		Nodes:     []string{"dns-a"},
+		Responder: replyID,
+		Part:      testPart,
+		Merge: func(acc, part testReply) testReply {
+			order = append(order, part.Part)
+			return sumParts(acc, part)
+		},
+	})
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if !res.Complete || res.Responses["dns-a"].Value != 6 {
+		t.Fatalf("expected all three parts merged into 6, got %+v", res)
+	}
+	if len(order) != 2 || order[0] != 1 || order[1] != 2 {
+		t.Fatalf("expected parts merged in index order, got %v", order)
+	}
+}
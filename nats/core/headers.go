@@ -0,0 +1,74 @@
+package core
+
+import (
+	"context"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/tracing"
+
+	"github.com/nats-io/nats.go"
+)
+
+// CorrelationHeader carries the ID shared by every message of one request
+// flow, e.g. a consensus round or a usage collection.
+const CorrelationHeader = "Ibp-Correlation-Id"
+
+// SenderHeader carries the node ID of the publisher, which per-sender rate
+// limits are keyed by.
+const SenderHeader = "Ibp-Sender"
+
+// InjectHeaders writes the correlation ID and span context held in ctx into
+// hdr.
+func InjectHeaders(ctx context.Context, hdr nats.Header) {
+	if hdr == nil {
+		return
+	}
+	if id := log.CorrelationID(ctx); id != "" {
+		hdr.Set(CorrelationHeader, id)
+	}
+	tracing.Inject(ctx, hdr)
+}
+
+// ContextFromMsg returns a context carrying the correlation ID and span
+// context found in the headers of m.
+func ContextFromMsg(m *nats.Msg) context.Context {
+	ctx := context.Background()
+	if m == nil || m.Header == nil {
+		return ctx
+	}
+	ctx = log.WithCorrelationID(ctx, m.Header.Get(CorrelationHeader))
+	return tracing.Extract(ctx, m.Header)
+}
+
+// EnsureCorrelationID returns ctx with a correlation ID, generating one when
+// ctx does not already carry it.
+func EnsureCorrelationID(ctx context.Context) context.Context {
+	if log.CorrelationID(ctx) != "" {
+		return ctx
+	}
+	return log.WithCorrelationID(ctx, log.NewCorrelationID())
+}
+
+// RoundContext rebuilds the context of a tracked proposal from its stored
+// trace parent and correlation ID. Callers must hold the state lock or own pt.
+func RoundContext(pt *ProposalTracking) context.Context {
+	ctx := log.WithCorrelationID(context.Background(), pt.CorrelationID)
+	return tracing.FromTraceParent(ctx, pt.TraceParent)
+}
+
+// PublishCtx publishes data to subject with the correlation ID and span
+// context of ctx in the message headers. Modules whose PublishMsg is not
+// wired fall back to publish, without headers.
+func PublishCtx(ctx context.Context, publishMsg func(*nats.Msg) error, publish func(subject, reply string, data []byte) error, subject, reply string, data []byte) error {
+	if publishMsg == nil {
+		return publish(subject, reply, data)
+	}
+	msg := &nats.Msg{Subject: subject, Reply: reply, Data: data, Header: nats.Header{}}
+	InjectHeaders(ctx, msg.Header)
+	return publishMsg(msg)
+}
+
+// NoReply adapts a publish function without reply subject to PublishCtx.
+func NoReply(publish func(subject string, data []byte) error) func(subject, reply string, data []byte) error {
+	return func(subject, _ string, data []byte) error { return publish(subject, data) }
+}
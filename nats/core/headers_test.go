@@ -0,0 +1,29 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestPublishCtx(t *testing.T) {
+	ctx := log.WithCorrelationID(context.Background(), "cid-1")
+
+	var got *nats.Msg
+	publishMsg := func(m *nats.Msg) error { got = m; return nil }
+	if err := PublishCtx(ctx, publishMsg, nil, "subj", "inbox", []byte("x")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if got == nil || got.Subject != "subj" || got.Reply != "inbox" || got.Header.Get(CorrelationHeader) != "cid-1" {
+		t.Fatalf("expected the message with the correlation header, got %+v", got)
+	}
+
+	var plain string
+	publish := NoReply(func(subject string, data []byte) error { plain = subject + ":" + string(data); return nil })
+	if err := PublishCtx(ctx, nil, publish, "subj", "", []byte("y")); err != nil || plain != "subj:y" {
+		t.Fatalf("expected the plain publish fallback, got %q (%v)", plain, err)
+	}
+}
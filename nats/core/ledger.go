@@ -0,0 +1,131 @@
+package core
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultAppliedLedgerSize is the number of proposal IDs remembered when no
+// size is configured.
+const DefaultAppliedLedgerSize = 10000
+
+// AppliedEntry records when a proposal's finalize was applied.
+type AppliedEntry struct {
+	ID        ProposalID `json:"ID"`
+	AppliedAt time.Time  `json:"AppliedAt"`
+}
+
+// AppliedLedger remembers the most recently applied proposal IDs so that a
+// re-delivered or duplicate finalize is applied only once. The oldest entry
+// is evicted once the ledger is full. A nil ledger records nothing and
+// treats every proposal as new.
+type AppliedLedger struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front = oldest
+	index    map[ProposalID]*list.Element
+	dirty    bool
+}
+
+// NewAppliedLedger returns a ledger holding up to capacity IDs.
+func NewAppliedLedger(capacity int) *AppliedLedger {
+	if capacity <= 0 {
+		capacity = DefaultAppliedLedgerSize
+	}
+	return &AppliedLedger{
+		capacity: capacity,
+		order:    list.New(),
+		index:    make(map[ProposalID]*list.Element),
+	}
+}
+
+// MarkApplied records id and reports whether it was new. A false result means
+// the proposal was already applied and must be skipped.
+func (l *AppliedLedger) MarkApplied(id ProposalID, at time.Time) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.index[id]; ok {
+		return false
+	}
+	l.insertLocked(AppliedEntry{ID: id, AppliedAt: at.UTC()})
+	l.dirty = true
+	return true
+}
+
+// Applied reports whether id has been applied.
+func (l *AppliedLedger) Applied(id ProposalID) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.index[id]
+	return ok
+}
+
+// Len returns the number of remembered IDs.
+func (l *AppliedLedger) Len() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+// Snapshot returns the entries oldest first and clears the dirty flag.
+func (l *AppliedLedger) Snapshot() []AppliedEntry {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]AppliedEntry, 0, l.order.Len())
+	for e := l.order.Front(); e != nil; e = e.Next() {
+		out = append(out, e.Value.(AppliedEntry))
+	}
+	l.dirty = false
+	return out
+}
+
+// Dirty reports whether entries were added since the last Snapshot.
+func (l *AppliedLedger) Dirty() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dirty
+}
+
+// Restore adds persisted entries, oldest first, keeping existing ones.
+func (l *AppliedLedger) Restore(entries []AppliedEntry) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range entries {
+		if e.ID == "" {
+			continue
+		}
+		if _, ok := l.index[e.ID]; ok {
+			continue
+		}
+		l.insertLocked(e)
+	}
+}
+
+func (l *AppliedLedger) insertLocked(e AppliedEntry) {
+	l.index[e.ID] = l.order.PushBack(e)
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Front()
+		l.order.Remove(oldest)
+		delete(l.index, oldest.Value.(AppliedEntry).ID)
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAppliedLedgerRejectsDuplicates(t *testing.T) {
+	l := NewAppliedLedger(4)
+	now := time.Now()
+	if !l.MarkApplied("p1", now) {
+		t.Fatal("expected first application to be accepted")
+	}
+	if l.MarkApplied("p1", now) {
+		t.Fatal("expected duplicate application to be rejected")
+	}
+	if !l.Applied("p1") || l.Len() != 1 {
+		t.Fatalf("unexpected ledger state: applied=%v len=%d", l.Applied("p1"), l.Len())
+	}
+}
+
+func TestAppliedLedgerEvictsOldest(t *testing.T) {
+	l := NewAppliedLedger(2)
+	now := time.Now()
+	l.MarkApplied("p1", now)
+	l.MarkApplied("p2", now)
+	l.MarkApplied("p3", now)
+
+	if l.Applied("p1") {
+		t.Fatal("expected oldest entry to be evicted")
+	}
+	if !l.Applied("p2") || !l.Applied("p3") || l.Len() != 2 {
+		t.Fatal("expected the two newest entries to remain")
+	}
+}
+
+func TestAppliedLedgerSnapshotRestore(t *testing.T) {
+	src := NewAppliedLedger(3)
+	now := time.Now()
+	src.MarkApplied("p1", now)
+	src.MarkApplied("p2", now.Add(time.Second))
+	if !src.Dirty() {
+		t.Fatal("expected ledger to be dirty after MarkApplied")
+	}
+	snap := src.Snapshot()
+	if src.Dirty() {
+		t.Fatal("expected Snapshot to clear the dirty flag")
+	}
+	if len(snap) != 2 || snap[0].ID != "p1" || snap[1].ID != "p2" {
+		t.Fatalf("unexpected snapshot order: %+v", snap)
+	}
+
+	dst := NewAppliedLedger(1)
+	dst.Restore(snap)
+	if dst.Applied("p1") || !dst.Applied("p2") {
+		t.Fatal("expected restore to keep only the newest entry within capacity")
+	}
+	if dst.MarkApplied("p2", now) {
+		t.Fatal("expected restored entry to block re-application")
+	}
+}
+
+func TestNilAppliedLedgerAcceptsEverything(t *testing.T) {
+	var l *AppliedLedger
+	if !l.MarkApplied("p1", time.Now()) || !l.MarkApplied("p1", time.Now()) {
+		t.Fatal("expected nil ledger to treat every proposal as new")
+	}
+	if l.Applied("p1") || l.Len() != 0 || l.Snapshot() != nil {
+		t.Fatal("expected nil ledger to record nothing")
+	}
+}
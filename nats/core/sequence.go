@@ -0,0 +1,89 @@
+package core
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sequencer numbers the messages of one sender, e.g. its finalize messages
+// or official snapshots. Its epoch is the process start, so a restarted
+// sender may start its sequence over.
+type Sequencer struct {
+	epoch int64
+	seq   atomic.Uint64
+}
+
+func NewSequencer() *Sequencer {
+	return &Sequencer{epoch: time.Now().UnixNano()}
+}
+
+// Next returns the epoch and the next sequence number, starting at 1.
+func (s *Sequencer) Next() (int64, uint64) {
+	return s.epoch, s.seq.Add(1)
+}
+
+// seqWindow is how far behind the newest number a message may arrive and
+// still be accepted as reordered rather than missed. Handlers run on a pool
+// of workers, so messages of one sender are not handled in order.
+const seqWindow = 64
+
+type seqPosition struct {
+	epoch int64
+	high  uint64 // newest number seen
+	seen  uint64 // bit i set: number high-i was seen
+}
+
+// SeqTracker follows the sequence numbers seen from each sender.
+type SeqTracker struct {
+	mu   sync.Mutex
+	last map[string]seqPosition
+}
+
+func NewSeqTracker() *SeqTracker {
+	return &SeqTracker{last: make(map[string]seqPosition)}
+}
+
+// Observe records a message and reports whether it is newer than every
+// message seen from sender, and how many of sender's messages are now known
+// to be missed. A number only counts as missed once it is seqWindow behind
+// the newest one without having arrived, so messages handled out of order
+// are not gaps. The first message of a sender or of a new epoch never
+// counts a gap; a message of an older epoch, an already seen number or one
+// that arrives after it was counted as missed is not newer.
+func (t *SeqTracker) Observe(sender string, epoch int64, seq uint64) (bool, uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prev, ok := t.last[sender]
+	switch {
+	case !ok || epoch > prev.epoch:
+		// Numbers before the first are unknown; treat them as seen.
+		t.last[sender] = seqPosition{epoch: epoch, high: seq, seen: ^uint64(0)}
+		return true, 0
+	case epoch < prev.epoch:
+		return false, 0
+	case seq <= prev.high:
+		if back := prev.high - seq; back < seqWindow {
+			prev.seen |= 1 << back
+			t.last[sender] = prev
+		}
+		return false, 0
+	}
+
+	// Numbers pushed out of the window without arriving are missed.
+	shift := seq - prev.high
+	var missed uint64
+	if shift >= seqWindow {
+		missed = uint64(seqWindow-bits.OnesCount64(prev.seen)) + shift - seqWindow
+		prev.seen = 0
+	} else {
+		dropped := prev.seen >> (seqWindow - shift)
+		missed = shift - uint64(bits.OnesCount64(dropped))
+		prev.seen <<= shift
+	}
+	prev.high = seq
+	prev.seen |= 1
+	t.last[sender] = prev
+	return true, missed
+}
@@ -0,0 +1,40 @@
+package core
+
+import "testing"
+
+func TestSeqTrackerOrdersBySenderEpochAndSeq(t *testing.T) {
+	tr := NewSeqTracker()
+	steps := []struct {
+		sender string
+		epoch  int64
+		seq    uint64
+		newer  bool
+		missed uint64
+	}{
+		{"mon-a", 10, 1, true, 0},
+		{"mon-a", 10, 1, false, 0},    // duplicate
+		{"mon-a", 10, 4, true, 0},     // 2 and 3 may still arrive
+		{"mon-a", 10, 3, false, 0},    // reordered
+		{"mon-a", 10, 68, true, 1},    // 2 left the window: missed
+		{"mon-a", 10, 2, false, 0},    // too late
+		{"mon-a", 10, 200, true, 131}, // 5-67 and 69-136 missed
+		{"mon-b", 5, 1, true, 0},      // other sender
+		{"mon-a", 20, 1, true, 0},     // restarted
+		{"mon-a", 10, 9, false, 0},    // previous run
+	}
+	for i, s := range steps {
+		newer, missed := tr.Observe(s.sender, s.epoch, s.seq)
+		if newer != s.newer || missed != s.missed {
+			t.Fatalf("step %d: expected (%v, %d), got (%v, %d)", i, s.newer, s.missed, newer, missed)
+		}
+	}
+}
+
+func TestSequencerCountsFromOne(t *testing.T) {
+	s := NewSequencer()
+	e1, n1 := s.Next()
+	e2, n2 := s.Next()
+	if e1 != e2 || n1 != 1 || n2 != 2 {
+		t.Fatalf("expected (e, 1), (e, 2), got (%d, %d), (%d, %d)", e1, n1, e2, n2)
+	}
+}
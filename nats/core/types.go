@@ -9,6 +9,27 @@ import (
 
 type UsageRequest = data2.UsageRequest
 
+// UniqueClientRecord carries a DNS node's unique-client sketches of one
+// day, domain and member.
+type UniqueClientRecord = data2.UniqueClientRecord
+
+// Decision explains a consensus outcome: the votes, the monitors that
+// counted and the timing. The finalizer attaches it to its finalize message.
+type Decision = data2.Decision
+
+// DecisionVote is one monitor's vote within a Decision.
+type DecisionVote = data2.DecisionVote
+
+// LatencySample is one response time measured by a monitor.
+type LatencySample = data2.LatencySample
+
+// LatencyReport is a monitor's batch of measurements on monitor.latency.
+type LatencyReport struct {
+	NodeID  string          `json:"nodeID"`
+	Region  string          `json:"region,omitempty"`
+	Samples []LatencySample `json:"samples"`
+}
+
 type NodeState struct {
 	NodeID             string
 	ThisNode           NodeInfo
@@ -17,6 +38,7 @@ type NodeState struct {
 	PendingVotes       map[ProposalID]map[string]Vote
 	PendingVoteTouched map[ProposalID]time.Time
 	ClusterNodes       map[string]NodeInfo
+	Applied            *AppliedLedger
 	SubjectPropose     string
 	SubjectVote        string
 	SubjectFinalize    string
@@ -26,12 +48,21 @@ type NodeState struct {
 	JoinUrl            string
 }
 
+// Node roles as carried in NodeInfo.NodeRole.
+const (
+	RoleMonitor  = "IBPMonitor"
+	RoleDns      = "IBPDns"
+	RoleCollator = "IBPCollator"
+)
+
 type NodeInfo struct {
 	NodeID        string    `json:"NodeID"`
 	PublicAddress string    `json:"PublicAddress"`
 	ListenAddress string    `json:"ListenAddress"`
 	ListenPort    string    `json:"ListenPort"`
 	NodeRole      string    `json:"NodeRole"`
+	ClusterName   string    `json:"ClusterName,omitempty"`
+	Region        string    `json:"Region,omitempty"` // monitor location, for consensus diversity
 	LastHeard     time.Time `json:"LastHeard"`
 }
 
@@ -50,6 +81,10 @@ type Proposal struct {
 	Data           map[string]interface{} `json:"Data"`
 	IsIPv6         bool                   `json:"IsIPv6"`
 	Timestamp      time.Time              `json:"Timestamp"`
+	ClusterName    string                 `json:"ClusterName,omitempty"`
+	// Shadow marks a proposal of a shadow check; its outcome is recorded
+	// but never applied.
+	Shadow bool `json:"Shadow,omitempty"`
 }
 
 type ProposalTracking struct {
@@ -59,7 +94,11 @@ type ProposalTracking struct {
 	Passed                bool
 	Timer                 *time.Timer
 	LastBroadcastAt       time.Time
+	TrackedAt             time.Time // local time this node started tracking the proposal
 	ForceFinalizeAttempts int
+	TraceParent           string
+	CorrelationID         string
+	VoteTimes             map[string]time.Time // when each vote was cast
 }
 
 type Vote struct {
@@ -68,19 +107,29 @@ type Vote struct {
 	NodeID       string     `json:"NodeID"`
 	Agree        bool       `json:"Agree"`
 	Timestamp    time.Time  `json:"Timestamp"`
+	ClusterName  string     `json:"ClusterName,omitempty"`
 }
 
 type FinalizeMessage struct {
-	Proposal     Proposal  `json:"Proposal"`
-	SenderNodeID string    `json:"SenderNodeID,omitempty"`
-	Passed       bool      `json:"Passed"`
-	DecidedAt    time.Time `json:"DecidedAt"`
+	Proposal     Proposal        `json:"Proposal"`
+	SenderNodeID string          `json:"SenderNodeID,omitempty"`
+	Passed       bool            `json:"Passed"`
+	DecidedAt    time.Time       `json:"DecidedAt"`
+	Votes        map[string]bool `json:"Votes,omitempty"` // monitor node ID → agreed
+	Decision     *Decision       `json:"Decision,omitempty"`
+	// Epoch and Seq number the finalize messages of SenderNodeID so
+	// receivers can detect missed ones; zero from older finalizers.
+	Epoch int64  `json:"Epoch,omitempty"`
+	Seq   uint64 `json:"Seq,omitempty"`
 }
 
 type UsageRecord struct {
 	NodeID      string `json:"nodeid"`
 	Date        string `json:"date"`
+	Hourly      bool   `json:"hourly,omitempty"` // Hour is set; otherwise a daily total
+	Hour        int    `json:"hour,omitempty"`
 	Domain      string `json:"domain"`
+	Service     string `json:"service,omitempty"` // Services key of Domain
 	MemberName  string `json:"memberName"`
 	CountryCode string `json:"countryCode"`
 	Asn         string `json:"asn"`
@@ -91,9 +140,16 @@ type UsageRecord struct {
 }
 
 type UsageResponse struct {
-	NodeID       string        `json:"nodeID"`
-	UsageRecords []UsageRecord `json:"usageRecords"`
-	Error        string        `json:"error,omitempty"`
+	NodeID        string               `json:"nodeID"`
+	UsageRecords  []UsageRecord        `json:"usageRecords"`
+	UniqueClients []UniqueClientRecord `json:"uniqueClients,omitempty"`
+	Error         string               `json:"error,omitempty"`
+	// More marks a chunk of a reply to a request with ChunkSize set; the
+	// last chunk, which carries UniqueClients and Error, leaves it unset.
+	More bool `json:"more,omitempty"`
+	// Part is the zero-based index of the chunk, so the collector can put
+	// chunks handled out of order back in sequence.
+	Part int `json:"part,omitempty"`
 }
 
 type DowntimeRequest struct {
@@ -114,6 +170,36 @@ type DowntimeEvent struct {
 	ErrorText  string                 `json:"errorText"`
 	Data       map[string]interface{} `json:"data"`
 	IsIPv6     bool                   `json:"isIPv6"`
+	Votes      map[string]bool        `json:"votes,omitempty"`
+	LatencyMs  float64                `json:"latencyMs,omitempty"` // response time recorded with the event
+}
+
+// StatusRequest asks monitors for the current official status of every
+// check, of one member when MemberName is set.
+type StatusRequest struct {
+	MemberName string `json:"memberName,omitempty"`
+}
+
+// MemberCheckStatus is the current official status of one member check.
+// Checked is when the status was last confirmed; Stale marks a result the
+// monitors stopped confirming.
+type MemberCheckStatus struct {
+	MemberName string    `json:"memberName"`
+	CheckType  string    `json:"checkType"`
+	CheckName  string    `json:"checkName"`
+	DomainName string    `json:"domainName,omitempty"`
+	Endpoint   string    `json:"endpoint,omitempty"`
+	IsIPv6     bool      `json:"isIPv6"`
+	Status     bool      `json:"status"`
+	Checked    time.Time `json:"checked"`
+	ErrorText  string    `json:"errorText,omitempty"`
+	Stale      bool      `json:"stale,omitempty"`
+}
+
+type StatusResponse struct {
+	NodeID   string              `json:"nodeID"`
+	Statuses []MemberCheckStatus `json:"statuses"`
+	Error    string              `json:"error,omitempty"`
 }
 
 type DowntimeResponse struct {
@@ -122,8 +208,94 @@ type DowntimeResponse struct {
 	Error  string          `json:"error,omitempty"`
 }
 
+// OutageEventVersion is the schema version of OutageEvent. Fields may be
+// added within a version; a change to existing fields bumps it.
+const OutageEventVersion = 1
+
+// OutageEvent types.
+const (
+	OutageOpen  = "open"
+	OutageClose = "close"
+)
+
+// OutageEvent is an outage a collator opened or closed after consensus,
+// published on monitor.events.stream. Open and close events of one outage
+// share member, check, domain, endpoint and IP family; NodeID is the
+// publishing collator.
+type OutageEvent struct {
+	Version   int       `json:"version"`
+	Type      string    `json:"type"`
+	Member    string    `json:"member"`
+	CheckType string    `json:"checkType"`
+	CheckName string    `json:"checkName"`
+	Domain    string    `json:"domain,omitempty"`
+	Endpoint  string    `json:"endpoint,omitempty"`
+	IsIPv6    bool      `json:"isIPv6"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+	NodeID    string    `json:"nodeID"`
+}
+
+// LiveUsageCount is the hits of one domain and member in a live usage
+// report.
+type LiveUsageCount struct {
+	Domain string `json:"domain"`
+	Member string `json:"member"`
+	Hits   int64  `json:"hits"`
+}
+
+// LiveUsageReport is a DNS node's hits of one interval on dns.usage.live,
+// from Start up to End.
+type LiveUsageReport struct {
+	NodeID string           `json:"nodeID"`
+	Start  time.Time        `json:"start"`
+	End    time.Time        `json:"end"`
+	Counts []LiveUsageCount `json:"counts"`
+}
+
+// NodeStatusResponse is one node's answer to a cluster.nodeStatus request.
+type NodeStatusResponse struct {
+	NodeID            string    `json:"nodeID"`
+	NodeRole          string    `json:"nodeRole"`
+	ClusterName       string    `json:"cluster,omitempty"`
+	Version           string    `json:"version"`
+	StartedAt         time.Time `json:"startedAt"`
+	UptimeSeconds     int64     `json:"uptimeSeconds"`
+	CheckQueueDepth   int       `json:"checkQueueDepth"`
+	HandlerQueueDepth int       `json:"handlerQueueDepth"`
+	LastMysqlWrite    time.Time `json:"lastMysqlWrite,omitempty"`
+	PendingUsage      int       `json:"pendingUsage"`   // usage keys counted but not yet flushed
+	SpilledUsage      int       `json:"spilledUsage"`   // usage records spilled to disk while MySQL was down
+	MysqlPrepares     int64     `json:"mysqlPrepares"`  // hot queries prepared
+	MysqlStmtExecs    int64     `json:"mysqlStmtExecs"` // executions of prepared hot queries; minus prepares, the round trips saved
+	MemoryAllocBytes  uint64    `json:"memoryAllocBytes"`
+	MemorySysBytes    uint64    `json:"memorySysBytes"`
+	Goroutines        int       `json:"goroutines"`
+	Subscriptions     int       `json:"subscriptions"`
+	SequenceGaps      uint64    `json:"sequenceGaps"`           // missed finalize messages and snapshots
+	MaxClockSkew      string    `json:"maxClockSkew,omitempty"` // largest peer clock offset seen
+	Error             string    `json:"error,omitempty"`
+}
+
 type ClusterMessage struct {
-	Type    string     `json:"type"`
-	Sender  NodeInfo   `json:"sender"`
-	Members []NodeInfo `json:"members"`
+	Type        string     `json:"type"`
+	ClusterName string     `json:"cluster,omitempty"`
+	Sender      NodeInfo   `json:"sender"`
+	Members     []NodeInfo `json:"members"`
+	SentAt      time.Time  `json:"sentAt,omitempty"` // sender's clock, for skew detection
+}
+
+// SameCluster reports whether name is this node's cluster. Messages and peers
+// from other clusters sharing the NATS server must be ignored. Callers must
+// not hold s.Mu.
+func (s *NodeState) SameCluster(name string) bool {
+	s.Mu.RLock()
+	defer s.Mu.RUnlock()
+	return name == s.ThisNode.ClusterName
+}
+
+// InClusterLocked reports whether n belongs to this node's cluster. Callers
+// must hold s.Mu.
+func (s *NodeState) InClusterLocked(n NodeInfo) bool {
+	return n.ClusterName == s.ThisNode.ClusterName
 }
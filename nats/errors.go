@@ -0,0 +1,32 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Sentinel errors returned, wrapped, by the requests of this package and
+// its modules. They are the same values as data.ErrNotFound etc., so
+// errors.Is works whichever package the caller checks against.
+var (
+	ErrNoActiveNodes    = errdefs.ErrNoActiveNodes
+	ErrTimeout          = errdefs.ErrTimeout
+	ErrNotFound         = errdefs.ErrNotFound
+	ErrInvalidDateRange = errdefs.ErrInvalidDateRange
+)
+
+// requestError wraps the error of a request to subject, mapping the NATS
+// client's timeout and no-responders errors onto the sentinels.
+func requestError(subject string, err error) error {
+	switch {
+	case errors.Is(err, nats.ErrTimeout):
+		return fmt.Errorf("request %s: %w: %w", subject, ErrTimeout, err)
+	case errors.Is(err, nats.ErrNoResponders):
+		return fmt.Errorf("request %s: %w: %w", subject, ErrNoActiveNodes, err)
+	}
+	return fmt.Errorf("request %s: %w", subject, err)
+}
@@ -0,0 +1,29 @@
+package nats
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ibp-network/ibp-geodns-libs/data"
+	natsio "github.com/nats-io/nats.go"
+)
+
+func TestRequestErrorMapsClientErrors(t *testing.T) {
+	err := requestError("collator.events.action", natsio.ErrTimeout)
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, natsio.ErrTimeout) {
+		t.Fatalf("expected ErrTimeout wrapping the client error, got %v", err)
+	}
+	if !errors.Is(err, data.ErrTimeout) {
+		t.Fatal("expected nats and data sentinels to be the same value")
+	}
+
+	err = requestError("collator.events.action", natsio.ErrNoResponders)
+	if !errors.Is(err, ErrNoActiveNodes) {
+		t.Fatalf("expected ErrNoActiveNodes, got %v", err)
+	}
+
+	err = requestError("collator.events.action", natsio.ErrConnectionClosed)
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrNoActiveNodes) || !errors.Is(err, natsio.ErrConnectionClosed) {
+		t.Fatalf("expected other errors to be wrapped unchanged, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+type EventAction = dat.EventAction
+
+// EventActionResponse is a collator's answer to an event action.
+type EventActionResponse struct {
+	NodeID string           `json:"nodeID"`
+	Event  *dat.EventRecord `json:"event,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+func handleEventActionRequest(m *nats.Msg) {
+	ctx := core.ContextFromMsg(m)
+	if m.Reply == "" {
+		log.LogCtx(ctx, log.Warn, "[collator] event action without reply inbox")
+		return
+	}
+
+	resp := EventActionResponse{NodeID: State.NodeID}
+	var a EventAction
+	if err := json.Unmarshal(m.Data, &a); err != nil {
+		resp.Error = fmt.Sprintf("unmarshal error: %v", err)
+	} else if ev, err := dat.ApplyEventActionIn(data2.Events(), a); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Event = &ev
+	}
+
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.LogCtx(ctx, log.Error, "[collator] event action marshal error: %v", err)
+		return
+	}
+	if err := PublishMsgWithReply(m.Reply, "", payload); err != nil {
+		log.LogCtx(ctx, log.Error, "[collator] event action reply error: %v", err)
+	}
+}
+
+// RequestEventAction asks one collator to close, annotate or reclassify an
+// event and returns the updated event.
+func RequestEventAction(a EventAction, timeout time.Duration) (dat.EventRecord, error) {
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return dat.EventRecord{}, fmt.Errorf("marshal event action: %w", err)
+	}
+	msg, err := Request(subjects.With(subjects.CollatorEventAction), payload, timeout)
+	if err != nil {
+		return dat.EventRecord{}, fmt.Errorf("event action request: %w", err)
+	}
+	var resp EventActionResponse
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return dat.EventRecord{}, fmt.Errorf("decode event action response: %w", err)
+	}
+	if resp.Error != "" {
+		return dat.EventRecord{}, fmt.Errorf("collator %s: %s", resp.NodeID, resp.Error)
+	}
+	if resp.Event == nil {
+		return dat.EventRecord{}, fmt.Errorf("collator %s: empty event action response", resp.NodeID)
+	}
+	return *resp.Event, nil
+}
@@ -0,0 +1,179 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+// -----------------------------------------------------------------------------
+// OUTAGE EVENT STREAM
+// -----------------------------------------------------------------------------
+//
+// Member dashboards and ticketing systems want to hear of outages as they
+// open and close. Collators publish every outage they store or close after
+// consensus as an OutageEvent on monitor.events.stream; the subject is
+// captured by a JetStream stream, kept Nats.EventStreamMaxAgeDays, so a
+// consumer can replay what it missed. Without JetStream the events are
+// still published, live only. The events come from the OFFLINE and ONLINE
+// alerts, through an alerts sink, so they follow the minimum offline time
+// and collator deduplication exactly like the alerts do.
+
+const (
+	eventStreamSinkName      = "nats-events"
+	defaultEventStreamMaxAge = 30 * 24 * time.Hour
+)
+
+var (
+	eventStreamOnce  sync.Once
+	eventStreamReady atomic.Bool // the JetStream stream exists
+)
+
+// outageEventStream is the JetStream stream name, qualified with the
+// cluster prefix.
+func outageEventStream() string { return jetStreamName("outage-events") }
+
+func eventStreamMaxAge() time.Duration {
+	if d := cfg.GetConfig().Local.Nats.EventStreamMaxAgeDays; d > 0 {
+		return time.Duration(d) * 24 * time.Hour
+	}
+	return defaultEventStreamMaxAge
+}
+
+// startOutageEventStream creates the stream, when JetStream is available,
+// and starts publishing outage events.
+func startOutageEventStream() {
+	eventStreamOnce.Do(func() {
+		if err := ensureOutageEventStream(); err != nil {
+			log.Log(log.Warn, "[NATS] outage event stream: %v; events are published without replay", err)
+		}
+		alerts.RegisterSink(eventStreamSink{})
+	})
+}
+
+func ensureOutageEventStream() error {
+	conn := currentConnection()
+	if conn == nil {
+		return fmt.Errorf("not connected to NATS")
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		return fmt.Errorf("jetstream: %w", err)
+	}
+	sc := &nats.StreamConfig{
+		Name:        outageEventStream(),
+		Description: "Outages opened and closed by the collators",
+		Subjects:    []string{subjects.With(subjects.MonitorEventsStream)},
+		MaxAge:      eventStreamMaxAge(),
+		Storage:     nats.FileStorage,
+	}
+	_, err = js.StreamInfo(sc.Name)
+	switch {
+	case errors.Is(err, nats.ErrStreamNotFound):
+		_, err = js.AddStream(sc)
+	case err == nil:
+		_, err = js.UpdateStream(sc)
+	}
+	if err != nil {
+		return fmt.Errorf("stream %s: %w", sc.Name, err)
+	}
+	eventStreamReady.Store(true)
+	return nil
+}
+
+// outageEventFrom turns an OFFLINE or ONLINE alert into an outage event.
+func outageEventFrom(ev alerts.Event) (core.OutageEvent, bool) {
+	out := core.OutageEvent{
+		Version:   core.OutageEventVersion,
+		Member:    ev.Member,
+		CheckType: ev.CheckType,
+		CheckName: ev.CheckName,
+		Domain:    ev.Domain,
+		Endpoint:  ev.Endpoint,
+		IsIPv6:    ev.IPv6,
+		Error:     ev.Error,
+		Time:      ev.Time.UTC(),
+		NodeID:    State.NodeID,
+	}
+	switch ev.Kind {
+	case alerts.KindOffline:
+		out.Type = core.OutageOpen
+	case alerts.KindOnline:
+		out.Type = core.OutageClose
+	default:
+		return core.OutageEvent{}, false
+	}
+	return out, true
+}
+
+// eventStreamSink publishes outage alerts on monitor.events.stream.
+type eventStreamSink struct{}
+
+func (eventStreamSink) Name() string { return eventStreamSinkName }
+
+func (eventStreamSink) Send(ctx context.Context, ev alerts.Event) error {
+	out, ok := outageEventFrom(ev)
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("marshal outage event: %w", err)
+	}
+	subject := subjects.With(subjects.MonitorEventsStream)
+	if eventStreamReady.Load() {
+		if conn := currentConnection(); conn != nil {
+			js, err := conn.JetStream()
+			if err == nil {
+				// The ack means the event is stored for replay.
+				_, err = js.Publish(subject, data, nats.Context(ctx))
+			}
+			if err == nil {
+				return nil
+			}
+			log.Log(log.Warn, "[NATS] outage event not stored in JetStream: %v; publishing live only", err)
+		}
+	}
+	return Publish(subject, data)
+}
+
+// SubscribeOutageEvents calls fn with every outage event collators publish.
+// With since set, the events stored since then are replayed first, in
+// order, before live ones; that needs the JetStream stream. Unsubscribe the
+// returned subscription to stop.
+func SubscribeOutageEvents(since time.Time, fn func(OutageEvent)) (*nats.Subscription, error) {
+	subject := subjects.With(subjects.MonitorEventsStream)
+	handle := func(m *nats.Msg) {
+		var ev core.OutageEvent
+		if err := json.Unmarshal(m.Data, &ev); err != nil {
+			log.Log(log.Warn, "[NATS] outage event: unmarshal error: %v", err)
+			return
+		}
+		fn(ev)
+	}
+	if since.IsZero() {
+		return Subscribe(subject, handle)
+	}
+
+	conn := currentConnection()
+	if conn == nil || conn.IsClosed() {
+		return nil, nats.ErrConnectionClosed
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("jetstream: %w", err)
+	}
+	return js.Subscribe(subject, handle, nats.OrderedConsumer(), nats.StartTime(since))
+}
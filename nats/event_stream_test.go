@@ -0,0 +1,87 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	natsio "github.com/nats-io/nats.go"
+)
+
+func TestOutageEventsAreStoredForReplay(t *testing.T) {
+	srv, err := natsserver.NewServer(&natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("new NATS server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(10 * time.Second) {
+		srv.Shutdown()
+		t.Fatal("test NATS server did not become ready")
+	}
+	t.Cleanup(func() {
+		srv.Shutdown()
+		srv.WaitForShutdown()
+	})
+
+	conn, err := natsio.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectionMu.Lock()
+	nc = conn
+	NC = conn
+	connectionMu.Unlock()
+	State.NodeID = "collator-a"
+	t.Cleanup(func() {
+		Disconnect()
+		State = NodeState{}
+		eventStreamReady.Store(false)
+	})
+
+	if err := ensureOutageEventStream(); err != nil {
+		t.Fatal(err)
+	}
+	since := time.Now().UTC().Add(-time.Second)
+	sink := eventStreamSink{}
+	for _, ev := range []alerts.Event{
+		{Kind: alerts.KindOffline, Member: "m", CheckType: "site", CheckName: "ping", Error: "timeout", Time: since},
+		{Kind: alerts.KindClockSkew, CheckType: alerts.CheckTypeCluster},
+		{Kind: alerts.KindOnline, Member: "m", CheckType: "site", CheckName: "ping", Time: since.Add(time.Minute)},
+	} {
+		if err := sink.Send(context.Background(), ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := make(chan OutageEvent, 4)
+	sub, err := SubscribeOutageEvents(since, func(ev OutageEvent) { got <- ev })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	for _, want := range []string{"open", "close"} {
+		select {
+		case ev := <-got:
+			if ev.Type != want || ev.Member != "m" || ev.NodeID != "collator-a" || ev.Version != 1 {
+				t.Fatalf("replayed %+v, want type %s", ev, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event replayed", want)
+		}
+	}
+	select {
+	case ev := <-got:
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -1,10 +1,7 @@
 package nats
 
 import (
-	"strings"
-
 	cfg "github.com/ibp-network/ibp-geodns-libs/config"
-	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
 )
 
 func findCheckByName(checkName, checkType string) (cfg.Check, bool) {
@@ -18,26 +15,10 @@ func findCheckByName(checkName, checkType string) (cfg.Check, bool) {
 }
 
 func findMemberByName(memberName string) (cfg.Member, bool) {
-	c := cfg.GetConfig()
-	for _, m := range c.Members {
-		if m.Details.Name == memberName {
-			return m, true
-		}
-	}
-	return cfg.Member{}, false
+	return cfg.GetMemberByName(memberName)
 }
 
 func findServiceForDomain(domainName string) (cfg.Service, bool) {
-	c := cfg.GetConfig()
-	for _, service := range c.Services {
-		for _, provider := range service.Providers {
-			for _, rpcUrl := range provider.RpcUrls {
-				u := max.ParseUrl(rpcUrl)
-				if strings.EqualFold(u.Domain, domainName) {
-					return service, true
-				}
-			}
-		}
-	}
-	return cfg.Service{}, false
+	_, svc, ok := cfg.GetServiceForDomain(domainName)
+	return svc, ok
 }
@@ -16,21 +16,7 @@ func cacheCollatorProposal(m *nats.Msg) {
 		return
 	}
 
-	data2.CacheProposal(data2.Proposal{
-		ID:             string(p.ID),
-		SenderNodeID:   p.SenderNodeID,
-		CheckType:      p.CheckType,
-		CheckName:      p.CheckName,
-		MemberName:     p.MemberName,
-		DomainName:     p.DomainName,
-		Endpoint:       p.Endpoint,
-		ProposedStatus: p.ProposedStatus,
-		ErrorText:      p.ErrorText,
-		Data:           p.Data,
-		IsIPv6:         p.IsIPv6,
-		Timestamp:      p.Timestamp,
-		CreatedAt:      p.Timestamp,
-	})
+	data2.CacheProposal(toData2Proposal(p))
 
 	log.Log(log.Debug, "[collator] cached proposal id=%s member=%s type=%s v6=%v",
 		p.ID, p.MemberName, p.CheckType, p.IsIPv6)
@@ -51,3 +37,22 @@ func cacheCollatorVote(m *nats.Msg) {
 	log.Log(log.Debug, "[collator] cached vote proposal=%s from=%s agree=%v totalVotes=%d",
 		v.ProposalID, v.NodeID, v.Agree, voteCount)
 }
+
+func toData2Proposal(p Proposal) data2.Proposal {
+	return data2.Proposal{
+		ID:             string(p.ID),
+		SenderNodeID:   p.SenderNodeID,
+		CheckType:      p.CheckType,
+		CheckName:      p.CheckName,
+		MemberName:     p.MemberName,
+		DomainName:     p.DomainName,
+		Endpoint:       p.Endpoint,
+		ProposedStatus: p.ProposedStatus,
+		ErrorText:      p.ErrorText,
+		Data:           p.Data,
+		IsIPv6:         p.IsIPv6,
+		Timestamp:      p.Timestamp,
+		CreatedAt:      p.Timestamp,
+		Shadow:         p.Shadow,
+	}
+}
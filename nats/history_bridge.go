@@ -0,0 +1,70 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+type ProposalFilter = data2.ProposalFilter
+type ProposalHistoryEntry = data2.ProposalHistoryEntry
+
+// ProposalHistoryResponse is a collator's answer to a proposal history query.
+type ProposalHistoryResponse struct {
+	NodeID  string                 `json:"nodeID"`
+	Entries []ProposalHistoryEntry `json:"entries"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+func handleProposalHistoryRequest(m *nats.Msg) {
+	ctx := core.ContextFromMsg(m)
+	if m.Reply == "" {
+		log.LogCtx(ctx, log.Warn, "[collator] proposal history request without reply inbox")
+		return
+	}
+
+	resp := ProposalHistoryResponse{NodeID: State.NodeID}
+	var f ProposalFilter
+	if err := json.Unmarshal(m.Data, &f); err != nil {
+		resp.Error = fmt.Sprintf("unmarshal error: %v", err)
+	} else {
+		resp.Entries = data2.GetProposalHistory(f)
+	}
+
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.LogCtx(ctx, log.Error, "[collator] proposal history marshal error: %v", err)
+		return
+	}
+	if err := PublishMsgWithReply(m.Reply, "", payload); err != nil {
+		log.LogCtx(ctx, log.Error, "[collator] proposal history reply error: %v", err)
+	}
+}
+
+// RequestProposalHistory asks one collator for the proposals, votes and
+// finalize outcomes matching f, newest first.
+func RequestProposalHistory(f ProposalFilter, timeout time.Duration) ([]ProposalHistoryEntry, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, fmt.Errorf("marshal proposal filter: %w", err)
+	}
+	msg, err := Request(subjects.With(subjects.CollatorProposalHistory), data, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("proposal history request: %w", err)
+	}
+	var resp ProposalHistoryResponse
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return nil, fmt.Errorf("decode proposal history: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("collator %s: %s", resp.NodeID, resp.Error)
+	}
+	return resp.Entries, nil
+}
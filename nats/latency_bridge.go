@@ -0,0 +1,126 @@
+package nats
+
+import (
+	"sync"
+	"time"
+
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	modlatency "github.com/ibp-network/ibp-geodns-libs/nats/modules/latency"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	latencyPublishInterval = time.Minute
+
+	// latencyRollupDelay lets late samples of an hour arrive before the
+	// hour is rolled up.
+	latencyRollupDelay = 5 * time.Minute
+)
+
+// latencyDeps is built per call so the subject follows the configured
+// cluster prefix.
+func latencyDeps() modlatency.Dependencies {
+	return modlatency.Dependencies{
+		State:         &State,
+		Publish:       Publish,
+		PublishMsg:    PublishMsg,
+		MarkNodeHeard: markNodeHeard,
+		Subject:       subjects.With(subjects.MonitorLatency),
+		Collect:       collectLocalLatency,
+	}
+}
+
+func handleCollatorLatencyReport(m *nats.Msg) {
+	deps := latencyDeps()
+	deps.Store = data2.StoreLatencySamples
+	modlatency.HandleReportContext(core.ContextFromMsg(m), deps, m.Data)
+}
+
+func handleDnsLatencyReport(m *nats.Msg) {
+	deps := latencyDeps()
+	deps.Record = func(s core.LatencySample) {
+		dat.RecordRegionLatency(s.Region, s.Member, s.Domain, s.IsIPv6, time.Duration(s.LatencyMs*float64(time.Millisecond)), s.Measured)
+	}
+	modlatency.HandleReportContext(core.ContextFromMsg(m), deps, m.Data)
+}
+
+// collectLocalLatency turns the local results measured after since into
+// samples.
+func collectLocalLatency(since time.Time) []core.LatencySample {
+	sites, domains, endpoints := dat.GetLocalResults()
+
+	var out []core.LatencySample
+	add := func(checkType, checkName, domain, endpoint string, results []dat.Result) {
+		for _, r := range results {
+			if r.Latency <= 0 || !r.Checktime.After(since) {
+				continue
+			}
+			out = append(out, core.LatencySample{
+				Member:    r.Member.Details.Name,
+				CheckType: checkType,
+				CheckName: checkName,
+				Domain:    domain,
+				Endpoint:  endpoint,
+				IsIPv6:    r.IsIPv6,
+				LatencyMs: float64(r.Latency) / float64(time.Millisecond),
+				Measured:  r.Checktime,
+			})
+		}
+	}
+	for _, sr := range sites {
+		add("site", sr.Check.Name, "", "", sr.Results)
+	}
+	for _, dr := range domains {
+		add("domain", dr.Check.Name, dr.Domain, "", dr.Results)
+	}
+	for _, er := range endpoints {
+		add("endpoint", er.Check.Name, er.Domain, er.RpcUrl, er.Results)
+	}
+	return out
+}
+
+var latencyPublisherOnce sync.Once
+
+// startLatencyPublisher publishes this monitor's new measurements every
+// latencyPublishInterval.
+func startLatencyPublisher() {
+	latencyPublisherOnce.Do(func() {
+		go func() {
+			since := time.Now().UTC()
+			t := time.NewTicker(latencyPublishInterval)
+			defer t.Stop()
+			for range t.C {
+				now := time.Now().UTC()
+				n, err := modlatency.PublishLocal(latencyDeps(), since)
+				if err != nil {
+					log.Log(log.Warn, "[NATS] latency publish failed: %v", err)
+					continue
+				}
+				since = now
+				log.Log(log.Debug, "[NATS] published %d latency samples", n)
+			}
+		}()
+	})
+}
+
+// StartLatencyRollup rolls up the previous hour's latency samples shortly
+// after every hour.
+func StartLatencyRollup() {
+	for {
+		next := time.Now().UTC().Truncate(time.Hour).Add(time.Hour + latencyRollupDelay)
+		time.Sleep(time.Until(next))
+
+		hour := next.Add(-latencyRollupDelay).Add(-time.Hour)
+		n, err := data2.RollupLatency(hour)
+		if err != nil {
+			log.Log(log.Error, "[collator] latency rollup for %s: %v", hour.Format(time.RFC3339), err)
+			continue
+		}
+		log.Log(log.Info, "[collator] rolled up latency for %s: %d series", hour.Format(time.RFC3339), n)
+	}
+}
@@ -0,0 +1,95 @@
+package nats
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+// -----------------------------------------------------------------------------
+// LIVE USAGE
+// -----------------------------------------------------------------------------
+//
+// DNS nodes publish the hits of every minute by domain and member on
+// dns.usage.live, fire and forget, for dashboards. It is separate from the
+// daily usage rows: nothing stores it, and a minute no one listens to is
+// gone.
+
+const liveUsagePublishInterval = time.Minute
+
+var liveUsagePublisherOnce sync.Once
+
+// startLiveUsagePublisher starts live counting and publishes the counts
+// every liveUsagePublishInterval.
+func startLiveUsagePublisher() {
+	liveUsagePublisherOnce.Do(func() {
+		dat.EnableLiveUsage(true)
+		go func() {
+			start := time.Now().UTC()
+			t := time.NewTicker(liveUsagePublishInterval)
+			defer t.Stop()
+			for range t.C {
+				end := time.Now().UTC()
+				if err := publishLiveUsage(liveUsageReport(start, end, dat.TakeLiveUsage())); err != nil {
+					log.Log(log.Warn, "[NATS] live usage publish failed: %v", err)
+				}
+				start = end
+			}
+		}()
+	})
+}
+
+// liveUsageReport builds the report of counts taken between start and end,
+// busiest first.
+func liveUsageReport(start, end time.Time, counts map[string]map[string]int64) core.LiveUsageReport {
+	State.Mu.RLock()
+	rep := core.LiveUsageReport{NodeID: State.NodeID, Start: start, End: end, Counts: []core.LiveUsageCount{}}
+	State.Mu.RUnlock()
+	for domain, members := range counts {
+		for member, hits := range members {
+			rep.Counts = append(rep.Counts, core.LiveUsageCount{Domain: domain, Member: member, Hits: hits})
+		}
+	}
+	sort.Slice(rep.Counts, func(i, j int) bool {
+		a, b := rep.Counts[i], rep.Counts[j]
+		if a.Hits != b.Hits {
+			return a.Hits > b.Hits
+		}
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		return a.Member < b.Member
+	})
+	return rep
+}
+
+func publishLiveUsage(rep core.LiveUsageReport) error {
+	data, err := json.Marshal(rep)
+	if err != nil {
+		return err
+	}
+	return Publish(subjects.With(subjects.DnsUsageLive), data)
+}
+
+// SubscribeLiveUsage calls fn with every live usage report of the cluster's
+// DNS nodes. Reports are published every minute, also when a node counted
+// no hits, so a missing report means a silent node. Unsubscribe the
+// returned subscription to stop.
+func SubscribeLiveUsage(fn func(LiveUsageReport)) (*nats.Subscription, error) {
+	return Subscribe(subjects.With(subjects.DnsUsageLive), func(m *nats.Msg) {
+		var rep core.LiveUsageReport
+		if err := json.Unmarshal(m.Data, &rep); err != nil {
+			log.Log(log.Warn, "[NATS] live usage: unmarshal error: %v", err)
+			return
+		}
+		fn(rep)
+	})
+}
@@ -0,0 +1,60 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+)
+
+func TestLiveUsageReportSortsBusiestFirst(t *testing.T) {
+	State.Mu.Lock()
+	prevID := State.NodeID
+	State.NodeID = "dns-a"
+	State.Mu.Unlock()
+	defer func() {
+		State.Mu.Lock()
+		State.NodeID = prevID
+		State.Mu.Unlock()
+	}()
+
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	rep := liveUsageReport(start, start.Add(time.Minute), map[string]map[string]int64{
+		"rpc.a.example": {"m1": 3, "m2": 9},
+		"rpc.b.example": {"m1": 3},
+	})
+	if rep.NodeID != "dns-a" || !rep.Start.Equal(start) || len(rep.Counts) != 3 {
+		t.Fatalf("report %+v", rep)
+	}
+	want := []LiveUsageCount{
+		{Domain: "rpc.a.example", Member: "m2", Hits: 9},
+		{Domain: "rpc.a.example", Member: "m1", Hits: 3},
+		{Domain: "rpc.b.example", Member: "m1", Hits: 3},
+	}
+	for i, c := range rep.Counts {
+		if c != want[i] {
+			t.Fatalf("counts %+v, want %+v", rep.Counts, want)
+		}
+	}
+
+	if empty := liveUsageReport(start, start, nil); empty.Counts == nil {
+		t.Fatal("an idle minute should publish an empty count list")
+	}
+}
+
+func TestTakeLiveUsageStartsANewCount(t *testing.T) {
+	dat.EnableLiveUsage(true)
+	defer dat.EnableLiveUsage(false)
+
+	dat.SetCacheOptions(false, true)
+	defer dat.SetCacheOptions(false, false)
+	dat.RecordDnsHit(false, "10.0.0.1", "rpc.example", "m")
+	dat.RecordDnsHit(false, "10.0.0.1", "rpc.example", "m")
+
+	if got := dat.TakeLiveUsage(); got["rpc.example"]["m"] != 2 {
+		t.Fatalf("first take %v", got)
+	}
+	if got := dat.TakeLiveUsage(); len(got) != 0 {
+		t.Fatalf("second take %v", got)
+	}
+}
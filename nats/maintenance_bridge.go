@@ -0,0 +1,76 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+type MaintenanceRequest = dat.MaintenanceRequest
+
+// MaintenanceResponse is a collator's answer to a maintenance declaration.
+type MaintenanceResponse struct {
+	NodeID string                 `json:"nodeID"`
+	Window *dat.MaintenanceWindow `json:"window,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+func handleMaintenanceRequest(m *nats.Msg) {
+	ctx := core.ContextFromMsg(m)
+	if m.Reply == "" {
+		log.LogCtx(ctx, log.Warn, "[collator] maintenance declaration without reply inbox")
+		return
+	}
+
+	resp := MaintenanceResponse{NodeID: State.NodeID}
+	var req MaintenanceRequest
+	if err := json.Unmarshal(m.Data, &req); err != nil {
+		resp.Error = fmt.Sprintf("unmarshal error: %v", err)
+	} else if w, err := dat.DeclareMaintenanceIn(data2.DB, req); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Window = &w
+	}
+
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.LogCtx(ctx, log.Error, "[collator] maintenance marshal error: %v", err)
+		return
+	}
+	if err := PublishMsgWithReply(m.Reply, "", payload); err != nil {
+		log.LogCtx(ctx, log.Error, "[collator] maintenance reply error: %v", err)
+	}
+}
+
+// RequestMaintenance asks one collator to record a member maintenance
+// window and returns it. The caller authenticates the member and sets
+// DeclaredBy; collators trust the NATS connection.
+func RequestMaintenance(req MaintenanceRequest, timeout time.Duration) (dat.MaintenanceWindow, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return dat.MaintenanceWindow{}, fmt.Errorf("marshal maintenance request: %w", err)
+	}
+	msg, err := Request(subjects.With(subjects.CollatorMaintenance), payload, timeout)
+	if err != nil {
+		return dat.MaintenanceWindow{}, fmt.Errorf("maintenance request: %w", err)
+	}
+	var resp MaintenanceResponse
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return dat.MaintenanceWindow{}, fmt.Errorf("decode maintenance response: %w", err)
+	}
+	if resp.Error != "" {
+		return dat.MaintenanceWindow{}, fmt.Errorf("collator %s: %s", resp.NodeID, resp.Error)
+	}
+	if resp.Window == nil {
+		return dat.MaintenanceWindow{}, fmt.Errorf("collator %s: empty maintenance response", resp.NodeID)
+	}
+	return *resp.Window, nil
+}
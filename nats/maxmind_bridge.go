@@ -0,0 +1,163 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+// maxmindSyncInterval is how often "cluster" nodes look for databases the
+// collator published. Only object metadata is read unless a stamp changed.
+const maxmindSyncInterval = time.Hour
+
+var maxmindSyncOnce sync.Once
+
+// objectStoreDistributor keeps the MaxMind databases in a JetStream object
+// store, one object per database. The stamp and digest travel as object
+// metadata; the object store chunks the file itself.
+type objectStoreDistributor struct {
+	// create lets the publisher create the bucket on first use.
+	create bool
+}
+
+// maxmindBucket is the object store bucket, qualified with the cluster
+// prefix like subjects are.
+func maxmindBucket() string { return jetStreamName("maxmind") }
+
+// jetStreamName qualifies a JetStream stream or bucket name with the
+// cluster prefix. The names cannot contain dots.
+func jetStreamName(name string) string {
+	p := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '-'
+	}, subjects.Prefix())
+	if p == "" {
+		return name
+	}
+	return p + "-" + name
+}
+
+func (d objectStoreDistributor) store() (nats.ObjectStore, error) {
+	conn := currentConnection()
+	if conn == nil {
+		return nil, fmt.Errorf("not connected to NATS")
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("jetstream: %w", err)
+	}
+	obs, err := js.ObjectStore(maxmindBucket())
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		if !d.create {
+			return nil, max.ErrNotDistributed
+		}
+		obs, err = js.CreateObjectStore(&nats.ObjectStoreConfig{
+			Bucket:      maxmindBucket(),
+			Description: "GeoLite2 databases published by the collator",
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("object store %s: %w", maxmindBucket(), err)
+	}
+	return obs, nil
+}
+
+func (d objectStoreDistributor) Info(name string) (max.DatabaseInfo, error) {
+	obs, err := d.store()
+	if err != nil {
+		return max.DatabaseInfo{}, err
+	}
+	oi, err := obs.GetInfo(name)
+	if errors.Is(err, nats.ErrObjectNotFound) {
+		return max.DatabaseInfo{}, max.ErrNotDistributed
+	}
+	if err != nil {
+		return max.DatabaseInfo{}, err
+	}
+	size, _ := strconv.ParseInt(oi.Metadata["size"], 10, 64)
+	return max.DatabaseInfo{
+		Name:   name,
+		Stamp:  oi.Metadata["stamp"],
+		SHA256: oi.Metadata["sha256"],
+		Size:   size,
+	}, nil
+}
+
+func (d objectStoreDistributor) Put(info max.DatabaseInfo, r io.Reader) error {
+	obs, err := d.store()
+	if err != nil {
+		return err
+	}
+	_, err = obs.Put(&nats.ObjectMeta{
+		Name: info.Name,
+		Metadata: map[string]string{
+			"stamp":  info.Stamp,
+			"sha256": info.SHA256,
+			"size":   strconv.FormatInt(info.Size, 10),
+			"node":   State.NodeID,
+		},
+	}, r)
+	return err
+}
+
+func (d objectStoreDistributor) Get(name string, w io.Writer) error {
+	obs, err := d.store()
+	if err != nil {
+		return err
+	}
+	res, err := obs.Get(name)
+	if errors.Is(err, nats.ErrObjectNotFound) {
+		return max.ErrNotDistributed
+	}
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	_, err = io.Copy(w, res)
+	return err
+}
+
+// registerMaxmindDistributor lets maxmind.Init of a "cluster" node read the
+// databases once NATS is connected.
+func registerMaxmindDistributor() {
+	max.SetDistributor(objectStoreDistributor{}, false)
+}
+
+// startMaxmindPublisher makes the collator the publishing node and pushes
+// the databases it already has.
+func startMaxmindPublisher() {
+	max.SetDistributor(objectStoreDistributor{create: true}, true)
+	go max.PublishDatabases()
+}
+
+// startMaxmindSync refreshes the databases of a "cluster" node periodically.
+func startMaxmindSync() {
+	if !strings.EqualFold(strings.TrimSpace(cfg.GetConfig().Local.Maxmind.Source), max.SourceCluster) {
+		return
+	}
+	maxmindSyncOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(maxmindSyncInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := max.SyncFromCluster(); err != nil {
+					log.Log(log.Warn, "[NATS] MaxMind cluster sync: %v", err)
+				}
+			}
+		}()
+	})
+}
@@ -5,7 +5,6 @@ import (
 	modDns "github.com/ibp-network/ibp-geodns-libs/nats/modules/dns"
 	modMonitor "github.com/ibp-network/ibp-geodns-libs/nats/modules/monitor"
 	"github.com/ibp-network/ibp-geodns-libs/nats/router"
-	"github.com/nats-io/nats.go"
 )
 
 var messageRouter = router.New()
@@ -23,21 +22,26 @@ func registerModules() {
 		HandleVote:      handleVote,
 		HandleFinalize:  handleFinalize,
 		HandleStatsReq:  handleMonitorStatsRequest,
-		HandleStatsData: handleMonitorStatsData,
+		HandleStatusReq: handleMonitorStatusRequest,
+		HandleSyncReq:   handleOfficialSyncRequest,
 	})
 
 	modDns.Register(messageRouter, modDns.Dependencies{
-		HandleUsageRequest: handleDnsUsageRequest,
-		HandleUsageData:    handleDnsUsageData,
+		HandleUsageRequest:  handleDnsUsageRequest,
+		HandleLatencyReport: handleDnsLatencyReport,
+		HandleSnapshot:      handleOfficialSnapshot,
 	})
 
 	modCollator.Register(messageRouter, modCollator.Dependencies{
-		Subjects:        subjects,
-		CacheProposal:   cacheCollatorProposal,
-		CacheVote:       cacheCollatorVote,
-		HandleFinalize:  handleFinalize,
-		HandleStatsData: handleMonitorStatsData,
-		HandleUsageData: handleUsageData,
+		Subjects:             subjects,
+		CacheProposal:        cacheCollatorProposal,
+		CacheVote:            cacheCollatorVote,
+		HandleFinalize:       handleFinalize,
+		HandleUsageData:      handleUsageData,
+		HandleHistoryRequest: handleProposalHistoryRequest,
+		HandleLatencyReport:  handleCollatorLatencyReport,
+		HandleEventAction:    handleEventActionRequest,
+		HandleMaintenance:    handleMaintenanceRequest,
 	})
 }
 
@@ -48,8 +52,3 @@ func (stateSubjectProvider) Subjects() (string, string, string) {
 	defer State.Mu.RUnlock()
 	return State.SubjectPropose, State.SubjectVote, State.SubjectFinalize
 }
-
-// expose helper for tests or future modules
-func dispatchMessage(role string, msg *nats.Msg) bool {
-	return messageRouter.Dispatch(role, msg)
-}
@@ -1,20 +1,22 @@
 package collator
 
 import (
-	"strings"
-
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
 	"github.com/ibp-network/ibp-geodns-libs/nats/router"
 	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
 	"github.com/nats-io/nats.go"
 )
 
 type Dependencies struct {
-	Subjects        SubjectProvider
-	CacheProposal   func(*nats.Msg)
-	CacheVote       func(*nats.Msg)
-	HandleFinalize  func(*nats.Msg)
-	HandleStatsData func(*nats.Msg)
-	HandleUsageData func(*nats.Msg)
+	Subjects             SubjectProvider
+	CacheProposal        func(*nats.Msg)
+	CacheVote            func(*nats.Msg)
+	HandleFinalize       func(*nats.Msg)
+	HandleUsageData      func(*nats.Msg)
+	HandleHistoryRequest func(*nats.Msg)
+	HandleLatencyReport  func(*nats.Msg)
+	HandleEventAction    func(*nats.Msg)
+	HandleMaintenance    func(*nats.Msg)
 }
 
 type SubjectProvider interface {
@@ -22,7 +24,7 @@ type SubjectProvider interface {
 }
 
 func Register(reg *router.Registry, deps Dependencies) {
-	reg.Register("IBPCollator", module{deps: deps})
+	reg.Register(core.RoleCollator, module{deps: deps})
 }
 
 type module struct {
@@ -31,51 +33,23 @@ type module struct {
 
 func (module) Name() string { return "collator-core" }
 
-func (m module) Handle(msg *nats.Msg) bool {
-	subj := msg.Subject
-
-	switch subj {
-	case subjects.MonitorStatsData:
-		if m.deps.HandleStatsData != nil {
-			m.deps.HandleStatsData(msg)
-			return true
-		}
-	case subjects.DnsUsageData:
-		if m.deps.HandleUsageData != nil {
-			m.deps.HandleUsageData(msg)
-			return true
-		}
-	}
-
-	if strings.Contains(subj, "downtimeReply") && m.deps.HandleStatsData != nil {
-		m.deps.HandleStatsData(msg)
-		return true
-	}
-	if strings.Contains(subj, "usageReply") && m.deps.HandleUsageData != nil {
-		m.deps.HandleUsageData(msg)
-		return true
-	}
-
+// Subscriptions lists the collator's subjects. Pushed usage data and latency
+// reports are work items stored once in the shared database, and history
+// queries, event actions and maintenance declarations need only one answer,
+// so collators share them through the collator queue group; consensus
+// traffic must reach every collator.
+func (m module) Subscriptions() []router.Subscription {
 	propose, vote, finalize := m.subjectStrings()
-	switch subj {
-	case propose:
-		if m.deps.CacheProposal != nil {
-			m.deps.CacheProposal(msg)
-			return true
-		}
-	case vote:
-		if m.deps.CacheVote != nil {
-			m.deps.CacheVote(msg)
-			return true
-		}
-	case finalize:
-		if m.deps.HandleFinalize != nil {
-			m.deps.HandleFinalize(msg)
-			return true
-		}
+	return []router.Subscription{
+		{Subject: propose, Handler: m.deps.CacheProposal},
+		{Subject: vote, Handler: m.deps.CacheVote},
+		{Subject: finalize, Handler: m.deps.HandleFinalize},
+		{Subject: subjects.With(subjects.DnsUsageData), Queue: subjects.CollatorQueue, Handler: m.deps.HandleUsageData},
+		{Subject: subjects.With(subjects.CollatorProposalHistory), Queue: subjects.CollatorQueue, Handler: m.deps.HandleHistoryRequest},
+		{Subject: subjects.With(subjects.MonitorLatency), Queue: subjects.CollatorQueue, Handler: m.deps.HandleLatencyReport},
+		{Subject: subjects.With(subjects.CollatorEventAction), Queue: subjects.CollatorQueue, Handler: m.deps.HandleEventAction},
+		{Subject: subjects.With(subjects.CollatorMaintenance), Queue: subjects.CollatorQueue, Handler: m.deps.HandleMaintenance},
 	}
-
-	return false
 }
 
 func (m module) subjectStrings() (string, string, string) {
@@ -1,12 +1,16 @@
 package consensus
 
 import (
+	"context"
 	"encoding/json"
+	"sort"
+	"sync"
 	"time"
 
 	dat "github.com/ibp-network/ibp-geodns-libs/data"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
 	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/tracing"
 
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
@@ -21,12 +25,62 @@ const (
 type Dependencies struct {
 	State               *core.NodeState
 	Publish             func(subject string, data []byte) error
+	PublishMsg          func(msg *nats.Msg) error // optional; carries trace and correlation headers
 	CountActiveMonitors func() int
 	IsNodeActive        func(core.NodeInfo) bool
 	MarkNodeHeard       func(string)
 	OnFinalize          func(core.FinalizeMessage)
+	IsShadowCheck       func(checkType, checkName string) bool // optional
+
+	// Sequencer numbers this node's finalize messages and Tracker follows
+	// the numbers of the others; OnGap is told how many finalize messages
+	// of a sender were missed. All optional.
+	Sequencer *core.Sequencer
+	Tracker   *core.SeqTracker
+	OnGap     func(sender string, missed uint64)
+
+	// Lanes processes received proposals by priority; optional, without
+	// it they are processed on the delivering goroutine.
+	Lanes *Lanes
+
+	// Timeouts adapts the proposal timeout to observed vote arrivals;
+	// optional, without it State.ProposalTimeout applies.
+	Timeouts *Timeouts
+
+	// MinOfflineRegions is how many distinct monitor regions must agree
+	// before an offline status passes; optional, below 2 there is no
+	// diversity rule.
+	MinOfflineRegions func() int
+
+	// CheckRules returns the thresholds of a check; optional, without it
+	// every check uses the defaults.
+	CheckRules func(checkType, checkName string) Rules
 }
 
+// requiredRegions returns the region diversity p needs to pass, or 0.
+// Only offline proposals are held to it.
+func requiredRegions(deps Dependencies, p core.Proposal) int {
+	if p.ProposedStatus || deps.MinOfflineRegions == nil {
+		return 0
+	}
+	if k := deps.MinOfflineRegions(); k > 1 {
+		return k
+	}
+	return 0
+}
+
+// proposalTimeout returns how long p waits for its votes before it is
+// forced: the check's own timeout, else the adaptive one of its type.
+func proposalTimeout(deps Dependencies, p core.Proposal) time.Duration {
+	if d := rulesFor(deps, p).Timeout; d > 0 {
+		return d
+	}
+	return deps.Timeouts.For(p.CheckType, deps.State.ProposalTimeout)
+}
+
+// finalizeMu keeps finalize messages on the wire in sequence order.
+var finalizeMu sync.Mutex
+
 func ProposeCheckStatus(
 	deps Dependencies,
 	checkType, checkName, memberName,
@@ -40,12 +94,20 @@ func ProposeCheckStatus(
 		status, errorText, dataMap, isIPv6)
 }
 
-func publishProposal(deps Dependencies, proposal core.Proposal) error {
+func publishProposal(ctx context.Context, deps Dependencies, proposal core.Proposal) error {
 	dataBytes, err := json.Marshal(proposal)
 	if err != nil {
 		return err
 	}
-	return deps.Publish(deps.State.SubjectPropose, dataBytes)
+	return core.PublishCtx(ctx, deps.PublishMsg, core.NoReply(deps.Publish), deps.State.SubjectPropose, "", dataBytes)
+}
+
+func proposalSpanAttrs(span *tracing.Span, prop core.Proposal) {
+	span.SetAttr("proposal.id", string(prop.ID))
+	span.SetAttr("proposal.sender", prop.SenderNodeID)
+	span.SetAttr("check.type", prop.CheckType)
+	span.SetAttr("check.name", prop.CheckName)
+	span.SetAttr("member", prop.MemberName)
 }
 
 func findMatchingProposalLocked(state *core.NodeState, prop core.Proposal) *core.ProposalTracking {
@@ -57,7 +119,8 @@ func findMatchingProposalLocked(state *core.NodeState, prop core.Proposal) *core
 			pt.Proposal.DomainName == prop.DomainName &&
 			pt.Proposal.Endpoint == prop.Endpoint &&
 			pt.Proposal.ProposedStatus == prop.ProposedStatus &&
-			pt.Proposal.IsIPv6 == prop.IsIPv6 {
+			pt.Proposal.IsIPv6 == prop.IsIPv6 &&
+			pt.Proposal.Shadow == prop.Shadow {
 			return pt
 		}
 	}
@@ -81,8 +144,8 @@ func applyPendingVotesLocked(deps Dependencies, pt *core.ProposalTracking) int {
 	}
 
 	applied := 0
-	for nodeID, vote := range pending {
-		pt.Votes[nodeID] = vote.Agree
+	for _, vote := range pending {
+		setVoteLocked(pt, vote)
 		applied++
 	}
 	if applied > 0 {
@@ -95,14 +158,23 @@ func applyPendingVotesLocked(deps Dependencies, pt *core.ProposalTracking) int {
 func countActiveMonitorsLocked(state *core.NodeState, isNodeActive func(core.NodeInfo) bool) int {
 	count := 0
 	for _, node := range state.ClusterNodes {
-		if node.NodeRole == "IBPMonitor" && isNodeActive(node) {
+		if node.NodeRole == core.RoleMonitor && state.InClusterLocked(node) && isNodeActive(node) {
 			count++
 		}
 	}
 	return count
 }
 
-func markConsensusSenderHeard(deps Dependencies, nodeID string) {
+// clusterName returns the cluster this node belongs to.
+func clusterName(state *core.NodeState) string {
+	state.Mu.RLock()
+	defer state.Mu.RUnlock()
+	return state.ThisNode.ClusterName
+}
+
+// markConsensusSenderHeard records a consensus sender as an active monitor
+// of cluster, the cluster named in the message it sent.
+func markConsensusSenderHeard(deps Dependencies, nodeID, cluster string) {
 	if nodeID == "" {
 		return
 	}
@@ -123,7 +195,10 @@ func markConsensusSenderHeard(deps Dependencies, nodeID string) {
 		node = core.NodeInfo{NodeID: nodeID}
 	}
 	if node.NodeRole == "" {
-		node.NodeRole = "IBPMonitor"
+		node.NodeRole = core.RoleMonitor
+	}
+	if node.ClusterName == "" {
+		node.ClusterName = cluster
 	}
 	if node.LastHeard.IsZero() {
 		node.LastHeard = time.Now().UTC()
@@ -138,11 +213,24 @@ func recordLocalVoteLocked(deps Dependencies, vote core.Vote) bool {
 		return false
 	}
 
-	pt.Votes[vote.NodeID] = vote.Agree
+	setVoteLocked(pt, vote)
 	decideLocked(deps, pt)
 	return true
 }
 
+// setVoteLocked records vote on pt with the time it was cast.
+func setVoteLocked(pt *core.ProposalTracking, vote core.Vote) {
+	pt.Votes[vote.NodeID] = vote.Agree
+	if pt.VoteTimes == nil {
+		pt.VoteTimes = make(map[string]time.Time)
+	}
+	at := vote.Timestamp
+	if at.IsZero() {
+		at = time.Now().UTC()
+	}
+	pt.VoteTimes[vote.NodeID] = at.UTC()
+}
+
 func propose(
 	deps Dependencies,
 	checkType, checkName, memberName, domainName, endpoint string,
@@ -168,12 +256,22 @@ func propose(
 		Data:           data,
 		IsIPv6:         isIPv6,
 		Timestamp:      now,
+		ClusterName:    clusterName(state),
+		Shadow:         deps.IsShadowCheck != nil && deps.IsShadowCheck(checkType, checkName),
 	}
 
+	ctx := core.EnsureCorrelationID(context.Background())
+	ctx, span := tracing.Start(ctx, "consensus.propose", tracing.KindProducer)
+	defer span.End()
+	proposalSpanAttrs(span, prop)
+
 	pt := &core.ProposalTracking{
 		Proposal:        prop,
 		Votes:           make(map[string]bool),
 		LastBroadcastAt: now,
+		TrackedAt:       now,
+		TraceParent:     tracing.TraceParent(ctx),
+		CorrelationID:   log.CorrelationID(ctx),
 	}
 
 	state.Mu.Lock()
@@ -187,6 +285,7 @@ func propose(
 			lastBroadcastAt = existingProp.Timestamp
 		}
 		existingAge := now.Sub(existingProp.Timestamp)
+		existingCtx := core.RoundContext(existing)
 		shouldRepublish := existingProp.SenderNodeID == state.NodeID &&
 			now.Sub(lastBroadcastAt) >= proposalRepublishInterval
 		if shouldRepublish {
@@ -194,15 +293,15 @@ func propose(
 		}
 		state.Mu.Unlock()
 		if shouldRepublish {
-			log.Log(log.Debug,
+			log.LogCtx(existingCtx, log.Debug,
 				"[CONSENSUS] ↻ PROPOSAL republish id=%s type=%s member=%s status=%v v6=%v age=%s",
 				existingProp.ID, existingProp.CheckType, existingProp.MemberName, existingProp.ProposedStatus, existingProp.IsIPv6, existingAge)
-			log.Log(log.Debug, "[CONSENSUS]     details=%+v", existingProp)
-			if err := publishProposal(deps, existingProp); err != nil {
-				log.Log(log.Error, "[NATS] failed to republish proposal %s: %v", existingProp.ID, err)
+			log.LogCtx(existingCtx, log.Debug, "[CONSENSUS]     details=%+v", existingProp)
+			if err := publishProposal(existingCtx, deps, existingProp); err != nil {
+				log.LogCtx(existingCtx, log.Error, "[NATS] failed to republish proposal %s: %v", existingProp.ID, err)
 			}
 		} else {
-			log.Log(log.Debug,
+			log.LogCtx(existingCtx, log.Debug,
 				"[CONSENSUS]    suppress duplicate proposal new_id=%s existing_id=%s sender=%s age=%s type=%s member=%s status=%v v6=%v",
 				pid, existingProp.ID, existingProp.SenderNodeID, existingAge,
 				existingProp.CheckType, existingProp.MemberName, existingProp.ProposedStatus, existingProp.IsIPv6)
@@ -210,17 +309,25 @@ func propose(
 		go voteOnProposal(deps, existingProp)
 		return
 	}
+	if n, need := proposeStreaks.observe(prop, now), rulesFor(deps, prop).Hysteresis; n < need {
+		state.Mu.Unlock()
+		log.LogCtx(ctx, log.Debug,
+			"[CONSENSUS]    hold proposal type=%s check=%s member=%s status=%v v6=%v: seen %d of %d time(s)",
+			prop.CheckType, prop.CheckName, prop.MemberName, prop.ProposedStatus, prop.IsIPv6, n, need)
+		return
+	}
 	state.Proposals[pid] = pt
-	pt.Timer = time.AfterFunc(state.ProposalTimeout, func() { forceFinalize(deps, pid) })
+	pt.Timer = time.AfterFunc(proposalTimeout(deps, prop), func() { forceFinalize(deps, pid) })
 	state.Mu.Unlock()
 
-	log.Log(log.Debug,
+	log.LogCtx(ctx, log.Debug,
 		"[CONSENSUS] → PROPOSAL published id=%s type=%s member=%s status=%v v6=%v",
 		prop.ID, prop.CheckType, prop.MemberName, prop.ProposedStatus, prop.IsIPv6)
-	log.Log(log.Debug, "[CONSENSUS]     details=%+v", prop)
+	log.LogCtx(ctx, log.Debug, "[CONSENSUS]     details=%+v", prop)
 
-	if err := publishProposal(deps, prop); err != nil {
-		log.Log(log.Error, "[NATS] failed to publish proposal %s: %v", pid, err)
+	if err := publishProposal(ctx, deps, prop); err != nil {
+		span.RecordError(err)
+		log.LogCtx(ctx, log.Error, "[NATS] failed to publish proposal %s: %v", pid, err)
 		state.Mu.Lock()
 		if existing, ok := state.Proposals[pid]; ok {
 			if existing.Timer != nil {
@@ -237,15 +344,38 @@ func propose(
 
 func HandleProposal(deps Dependencies, m *nats.Msg) {
 	state := deps.State
+	ctx := core.EnsureCorrelationID(core.ContextFromMsg(m))
 	var prop core.Proposal
 	if err := json.Unmarshal(m.Data, &prop); err != nil {
-		log.Log(log.Error, "[NATS] handleProposal: unmarshal error: %v", err)
+		log.LogCtx(ctx, log.Error, "[NATS] handleProposal: unmarshal error: %v", err)
 		return
 	}
-	log.Log(log.Debug,
+	log.LogCtx(ctx, log.Debug,
 		"[CONSENSUS] ← PROPOSAL received id=%s from=%s type=%s check=%s member=%s domain=%s endpoint=%s status=%v v6=%v",
 		prop.ID, prop.SenderNodeID, prop.CheckType, prop.CheckName, prop.MemberName, prop.DomainName, prop.Endpoint, prop.ProposedStatus, prop.IsIPv6)
-	markConsensusSenderHeard(deps, prop.SenderNodeID)
+	if !state.SameCluster(prop.ClusterName) {
+		log.LogCtx(ctx, log.Debug, "[CONSENSUS]    ignore proposal id=%s from cluster %q", prop.ID, prop.ClusterName)
+		return
+	}
+	markConsensusSenderHeard(deps, prop.SenderNodeID, prop.ClusterName)
+
+	if deps.Lanes == nil {
+		processProposal(ctx, deps, prop, false)
+		return
+	}
+	if !deps.Lanes.Submit(prop, func() { processProposal(ctx, deps, prop, true) }) {
+		log.LogCtx(ctx, log.Warn, "[CONSENSUS]    %s lane full; dropped proposal id=%s", LaneOf(prop), prop.ID)
+	}
+}
+
+// processProposal tracks a received proposal and votes on it. In a lane
+// the vote is cast by the lane's worker, so the lane's concurrency bounds
+// the work; otherwise it runs on its own goroutine.
+func processProposal(ctx context.Context, deps Dependencies, prop core.Proposal, inLane bool) {
+	state := deps.State
+	ctx, span := tracing.Start(ctx, "consensus.proposal.receive", tracing.KindConsumer)
+	defer span.End()
+	proposalSpanAttrs(span, prop)
 
 	state.Mu.Lock()
 	if state.Proposals == nil {
@@ -255,17 +385,25 @@ func HandleProposal(deps Dependencies, m *nats.Msg) {
 		state.Mu.Unlock()
 		return
 	}
+	now := time.Now().UTC()
 	state.Proposals[prop.ID] = &core.ProposalTracking{
 		Proposal:        prop,
 		Votes:           make(map[string]bool),
-		LastBroadcastAt: time.Now().UTC(),
+		LastBroadcastAt: now,
+		TrackedAt:       now,
+		TraceParent:     tracing.TraceParent(ctx),
+		CorrelationID:   log.CorrelationID(ctx),
 	}
 	appliedPending := applyPendingVotesLocked(deps, state.Proposals[prop.ID])
-	state.Proposals[prop.ID].Timer = time.AfterFunc(state.ProposalTimeout,
+	state.Proposals[prop.ID].Timer = time.AfterFunc(proposalTimeout(deps, prop),
 		func() { forceFinalize(deps, prop.ID) })
 	state.Mu.Unlock()
 	if appliedPending > 0 {
-		log.Log(log.Debug, "[CONSENSUS]    applied %d pending vote(s) for id=%s", appliedPending, prop.ID)
+		log.LogCtx(ctx, log.Debug, "[CONSENSUS]    applied %d pending vote(s) for id=%s", appliedPending, prop.ID)
+	}
+	if inLane {
+		voteOnProposal(deps, prop)
+		return
 	}
 	go voteOnProposal(deps, prop)
 }
@@ -273,11 +411,18 @@ func HandleProposal(deps Dependencies, m *nats.Msg) {
 func voteOnProposal(deps Dependencies, prop core.Proposal) {
 	state := deps.State
 
+	ctx := context.Background()
+	state.Mu.RLock()
+	if pt, ok := state.Proposals[prop.ID]; ok {
+		ctx = core.RoundContext(pt)
+	}
+	state.Mu.RUnlock()
+
 	found, localStatus := checkLocalStatus(
 		prop.CheckType, prop.CheckName, prop.MemberName,
 		prop.DomainName, prop.Endpoint, prop.IsIPv6)
 	if !found {
-		log.Log(log.Debug,
+		log.LogCtx(ctx, log.Debug,
 			"[CONSENSUS]    skip vote id=%s no local status type=%s check=%s member=%s domain=%s endpoint=%s v6=%v",
 			prop.ID, prop.CheckType, prop.CheckName, prop.MemberName, prop.DomainName, prop.Endpoint, prop.IsIPv6)
 		return
@@ -289,9 +434,10 @@ func voteOnProposal(deps Dependencies, prop core.Proposal) {
 		NodeID:       state.NodeID,
 		Agree:        localStatus == prop.ProposedStatus,
 		Timestamp:    time.Now().UTC(),
+		ClusterName:  clusterName(state),
 	}
 
-	log.Log(log.Debug,
+	log.LogCtx(ctx, log.Debug,
 		"[CONSENSUS]    vote id=%s agree=%v (local=%v proposed=%v)",
 		prop.ID, v.Agree, localStatus, prop.ProposedStatus)
 
@@ -299,34 +445,50 @@ func voteOnProposal(deps Dependencies, prop core.Proposal) {
 	appliedLocally := recordLocalVoteLocked(deps, v)
 	state.Mu.Unlock()
 	if !appliedLocally {
-		log.Log(log.Debug, "[CONSENSUS]    skip publish for id=%s because proposal is missing or finalized locally", v.ProposalID)
+		log.LogCtx(ctx, log.Debug, "[CONSENSUS]    skip publish for id=%s because proposal is missing or finalized locally", v.ProposalID)
 		return
 	}
-	log.Log(log.Debug, "[CONSENSUS]    applied local vote immediately for id=%s node=%s", v.ProposalID, v.NodeID)
+	log.LogCtx(ctx, log.Debug, "[CONSENSUS]    applied local vote immediately for id=%s node=%s", v.ProposalID, v.NodeID)
+
+	ctx, span := tracing.Start(ctx, "consensus.vote", tracing.KindProducer)
+	defer span.End()
+	span.SetAttr("proposal.id", string(prop.ID))
+	span.SetAttr("vote.agree", boolString(v.Agree))
 
 	data, err := json.Marshal(v)
 	if err != nil {
-		log.Log(log.Error, "[NATS] failed to marshal vote for %s: %v", prop.ID, err)
+		log.LogCtx(ctx, log.Error, "[NATS] failed to marshal vote for %s: %v", prop.ID, err)
 		return
 	}
 
-	if deps.Publish(state.SubjectVote, data) != nil {
-		log.Log(log.Error, "[NATS] failed to publish vote for %s", prop.ID)
+	if err := core.PublishCtx(ctx, deps.PublishMsg, core.NoReply(deps.Publish), state.SubjectVote, "", data); err != nil {
+		span.RecordError(err)
+		log.LogCtx(ctx, log.Error, "[NATS] failed to publish vote for %s", prop.ID)
 	}
 }
 
 func HandleVote(deps Dependencies, m *nats.Msg) {
 	state := deps.State
+	ctx := core.ContextFromMsg(m)
 	var v core.Vote
 	if err := json.Unmarshal(m.Data, &v); err != nil {
-		log.Log(log.Error, "[NATS] handleVote: unmarshal error: %v", err)
+		log.LogCtx(ctx, log.Error, "[NATS] handleVote: unmarshal error: %v", err)
 		return
 	}
-	log.Log(log.Debug, "[CONSENSUS] ← vote id=%s from=%s agree=%v", v.ProposalID, v.NodeID, v.Agree)
-	log.Log(log.Debug,
+	log.LogCtx(ctx, log.Debug, "[CONSENSUS] ← vote id=%s from=%s agree=%v", v.ProposalID, v.NodeID, v.Agree)
+	log.LogCtx(ctx, log.Debug,
 		"[CONSENSUS]    vote sender=%s proposal=%s voter=%s agree=%v",
 		v.SenderNodeID, v.ProposalID, v.NodeID, v.Agree)
-	markConsensusSenderHeard(deps, v.SenderNodeID)
+	if !state.SameCluster(v.ClusterName) {
+		log.LogCtx(ctx, log.Debug, "[CONSENSUS]    ignore vote id=%s from cluster %q", v.ProposalID, v.ClusterName)
+		return
+	}
+	markConsensusSenderHeard(deps, v.SenderNodeID, v.ClusterName)
+
+	_, span := tracing.Start(ctx, "consensus.vote.receive", tracing.KindConsumer)
+	defer span.End()
+	span.SetAttr("proposal.id", string(v.ProposalID))
+	span.SetAttr("vote.node", v.NodeID)
 
 	state.Mu.Lock()
 	pt, ok := state.Proposals[v.ProposalID]
@@ -343,31 +505,39 @@ func HandleVote(deps Dependencies, m *nats.Msg) {
 		state.PendingVotes[v.ProposalID][v.NodeID] = v
 		state.PendingVoteTouched[v.ProposalID] = time.Now().UTC()
 		state.Mu.Unlock()
-		log.Log(log.Debug, "[CONSENSUS]    buffered out-of-order vote id=%s from=%s", v.ProposalID, v.NodeID)
+		log.LogCtx(ctx, log.Debug, "[CONSENSUS]    buffered out-of-order vote id=%s from=%s", v.ProposalID, v.NodeID)
 		return
 	}
 	if pt.Finalized {
 		state.Mu.Unlock()
 		return
 	}
-	pt.Votes[v.NodeID] = v.Agree
+	if _, seen := pt.Votes[v.NodeID]; !seen && v.NodeID != state.NodeID && !pt.TrackedAt.IsZero() {
+		deps.Timeouts.Observe(pt.Proposal.CheckType, time.Since(pt.TrackedAt))
+	}
+	setVoteLocked(pt, v)
 	decideLocked(deps, pt)
 	state.Mu.Unlock()
 }
 
 func decideLocked(deps Dependencies, pt *core.ProposalTracking) {
 	state := deps.State
+	rules := rulesFor(deps, pt.Proposal)
 	total := countActiveMonitorsLocked(state, deps.IsNodeActive)
-	if total < minConsensusVotes {
+	if total < rules.minVotes() {
 		return
 	}
-	maj := (total / 2) + 1
+	maj := rules.required(total)
 
 	yes, no := 0, 0
+	regions := make(map[string]bool)
 	for nid, agree := range pt.Votes {
-		if node, ok := state.ClusterNodes[nid]; ok && node.NodeRole == "IBPMonitor" && deps.IsNodeActive(node) {
+		if node, ok := state.ClusterNodes[nid]; ok && node.NodeRole == core.RoleMonitor && state.InClusterLocked(node) && deps.IsNodeActive(node) {
 			if agree {
 				yes++
+				if node.Region != "" {
+					regions[node.Region] = true
+				}
 			} else {
 				no++
 			}
@@ -375,16 +545,32 @@ func decideLocked(deps Dependencies, pt *core.ProposalTracking) {
 	}
 
 	switch {
-	case yes >= maj && yes >= minConsensusVotes:
+	case yes >= maj:
+		// A majority from too few regions may be one site's network
+		// problem: wait for the other monitors, and fail once all of them
+		// voted without reaching the diversity.
+		if need := requiredRegions(deps, pt.Proposal); len(regions) < need {
+			if yes+no < total {
+				log.LogCtx(core.RoundContext(pt), log.Debug,
+					"[CONSENSUS]    id=%s has a majority from %d of %d required region(s), waiting",
+					pt.Proposal.ID, len(regions), need)
+				return
+			}
+			log.LogCtx(core.RoundContext(pt), log.Warn,
+				"[CONSENSUS] id=%s offline agreed from only %d of %d required region(s), failing",
+				pt.Proposal.ID, len(regions), need)
+			pt.Finalized, pt.Passed = true, false
+			break
+		}
 		pt.Finalized, pt.Passed = true, true
-	case no >= maj && no >= minConsensusVotes:
+	case no >= maj:
 		pt.Finalized, pt.Passed = true, false
 	}
 
 	if pt.Finalized {
-		log.Log(log.Info,
-			"[CONSENSUS] ⇢ finalize id=%s PASS=%v yes=%d no=%d (%d active monitors)",
-			pt.Proposal.ID, pt.Passed, yes, no, total)
+		log.LogCtx(core.RoundContext(pt), log.Info,
+			"[CONSENSUS] ⇢ finalize id=%s PASS=%v yes=%d no=%d (%d active monitors) shadow=%v",
+			pt.Proposal.ID, pt.Passed, yes, no, total, pt.Proposal.Shadow)
 
 		if pt.Timer != nil {
 			pt.Timer.Stop()
@@ -413,7 +599,7 @@ func forceFinalize(deps Dependencies, pid core.ProposalID) {
 		}
 		pt.ForceFinalizeAttempts++
 		if pt.ForceFinalizeAttempts >= maxForceFinalizeRetries {
-			log.Log(log.Warn, "[CONSENSUS] giving up on id=%s after %d finalize attempt(s)", pid, pt.ForceFinalizeAttempts)
+			log.LogCtx(core.RoundContext(pt), log.Warn, "[CONSENSUS] giving up on id=%s after %d finalize attempt(s)", pid, pt.ForceFinalizeAttempts)
 			pt.Finalized = true
 			pt.Passed = false
 			state.Mu.Unlock()
@@ -422,7 +608,7 @@ func forceFinalize(deps Dependencies, pid core.ProposalID) {
 		}
 
 		// Otherwise, keep retrying until the bounded attempt limit is reached.
-		pt.Timer = time.AfterFunc(state.ProposalTimeout, func() { forceFinalize(deps, pid) })
+		pt.Timer = time.AfterFunc(proposalTimeout(deps, pt.Proposal), func() { forceFinalize(deps, pid) })
 	}
 	state.Mu.Unlock()
 }
@@ -446,18 +632,29 @@ func cleanupFinalizedProposalLocked(state *core.NodeState, proposalID core.Propo
 
 func HandleFinalize(deps Dependencies, m *nats.Msg) {
 	state := deps.State
+	ctx := core.ContextFromMsg(m)
 	var fm core.FinalizeMessage
 	if err := json.Unmarshal(m.Data, &fm); err != nil {
-		log.Log(log.Error, "[NATS] handleFinalize: unmarshal error: %v", err)
+		log.LogCtx(ctx, log.Error, "[NATS] handleFinalize: unmarshal error: %v", err)
 		return
 	}
-	log.Log(log.Debug,
+	log.LogCtx(ctx, log.Debug,
 		"[CONSENSUS] ← FINALIZE id=%s PASS=%v", fm.Proposal.ID, fm.Passed)
+	if !state.SameCluster(fm.Proposal.ClusterName) {
+		log.LogCtx(ctx, log.Debug, "[CONSENSUS]    ignore finalize id=%s from cluster %q", fm.Proposal.ID, fm.Proposal.ClusterName)
+		return
+	}
 	senderNodeID := fm.SenderNodeID
 	if senderNodeID == "" {
 		senderNodeID = fm.Proposal.SenderNodeID
 	}
-	markConsensusSenderHeard(deps, senderNodeID)
+	markConsensusSenderHeard(deps, senderNodeID, fm.Proposal.ClusterName)
+	trackFinalizeSeq(ctx, deps, fm)
+
+	_, span := tracing.Start(ctx, "consensus.finalize.receive", tracing.KindConsumer)
+	defer span.End()
+	proposalSpanAttrs(span, fm.Proposal)
+	span.SetAttr("finalize.passed", boolString(fm.Passed))
 
 	state.Mu.Lock()
 	cleanupFinalizedProposalLocked(state, fm.Proposal.ID)
@@ -468,6 +665,22 @@ func HandleFinalize(deps Dependencies, m *nats.Msg) {
 	}
 }
 
+// trackFinalizeSeq reports the finalize messages of fm's sender known to be
+// missed once fm arrived (see core.SeqTracker). A node's own finalize
+// messages are not tracked.
+func trackFinalizeSeq(ctx context.Context, deps Dependencies, fm core.FinalizeMessage) {
+	if deps.Tracker == nil || fm.Seq == 0 || fm.SenderNodeID == "" || fm.SenderNodeID == deps.State.NodeID {
+		return
+	}
+	if _, missed := deps.Tracker.Observe(fm.SenderNodeID, fm.Epoch, fm.Seq); missed > 0 {
+		log.LogCtx(ctx, log.Warn, "[CONSENSUS] missed %d finalize message(s) from %s (newest seq %d)",
+			missed, fm.SenderNodeID, fm.Seq)
+		if deps.OnGap != nil {
+			deps.OnGap(fm.SenderNodeID, missed)
+		}
+	}
+}
+
 func checkLocalStatus(checkType, checkName, memberName, domainName, endpoint string, isIPv6 bool) (bool, bool) {
 	switch checkType {
 	case "site":
@@ -483,26 +696,111 @@ func checkLocalStatus(checkType, checkName, memberName, domainName, endpoint str
 
 func finalize(deps Dependencies, pt *core.ProposalTracking) {
 	state := deps.State
+
+	state.Mu.Lock()
+	ctx := core.RoundContext(pt)
+	votes := make(map[string]bool, len(pt.Votes))
+	for nodeID, agree := range pt.Votes {
+		votes[nodeID] = agree
+	}
+	decision := decisionLocked(deps, pt)
+	state.Mu.Unlock()
+
 	msg := core.FinalizeMessage{
 		Proposal:     pt.Proposal,
 		SenderNodeID: state.NodeID,
 		Passed:       pt.Passed,
-		DecidedAt:    time.Now().UTC(),
+		DecidedAt:    decision.DecidedAt,
+		Votes:        votes,
+		Decision:     decision,
 	}
+	ctx, span := tracing.Start(ctx, "consensus.finalize", tracing.KindProducer)
+	defer span.End()
+	proposalSpanAttrs(span, pt.Proposal)
+	span.SetAttr("finalize.passed", boolString(pt.Passed))
 
 	if deps.OnFinalize != nil {
 		deps.OnFinalize(msg)
-		log.Log(log.Debug, "[CONSENSUS]    applied finalize locally for id=%s", pt.Proposal.ID)
+		log.LogCtx(ctx, log.Debug, "[CONSENSUS]    applied finalize locally for id=%s", pt.Proposal.ID)
 	}
 
+	finalizeMu.Lock()
+	if deps.Sequencer != nil {
+		msg.Epoch, msg.Seq = deps.Sequencer.Next()
+	}
 	data, err := json.Marshal(msg)
 	if err != nil {
-		log.Log(log.Error, "[NATS] failed to marshal finalize for %s: %v", pt.Proposal.ID, err)
-	} else if deps.Publish(state.SubjectFinalize, data) != nil {
-		log.Log(log.Error, "[NATS] failed to publish finalize for %s", pt.Proposal.ID)
+		log.LogCtx(ctx, log.Error, "[NATS] failed to marshal finalize for %s: %v", pt.Proposal.ID, err)
+	} else if err := core.PublishCtx(ctx, deps.PublishMsg, core.NoReply(deps.Publish), state.SubjectFinalize, "", data); err != nil {
+		span.RecordError(err)
+		log.LogCtx(ctx, log.Error, "[NATS] failed to publish finalize for %s", pt.Proposal.ID)
 	}
+	finalizeMu.Unlock()
 
 	state.Mu.Lock()
 	cleanupFinalizedProposalLocked(state, pt.Proposal.ID)
 	state.Mu.Unlock()
 }
+
+// decisionLocked snapshots the tally behind pt's outcome: every vote with
+// the voter's local status, the active monitors and the majority they
+// required.
+func decisionLocked(deps Dependencies, pt *core.ProposalTracking) *core.Decision {
+	state := deps.State
+	d := &core.Decision{
+		ActiveMonitors: make([]string, 0),
+		Votes:          make([]core.DecisionVote, 0, len(pt.Votes)),
+		ProposedAt:     pt.Proposal.Timestamp.UTC(),
+		DecidedAt:      time.Now().UTC(),
+	}
+	active := make(map[string]bool)
+	for id, node := range state.ClusterNodes {
+		if node.NodeRole == core.RoleMonitor && state.InClusterLocked(node) && deps.IsNodeActive(node) {
+			active[id] = true
+			d.ActiveMonitors = append(d.ActiveMonitors, id)
+		}
+	}
+	sort.Strings(d.ActiveMonitors)
+	d.Required = rulesFor(deps, pt.Proposal).required(len(d.ActiveMonitors))
+	d.RequiredRegions = requiredRegions(deps, pt.Proposal)
+	regions := make(map[string]bool)
+
+	for nodeID, agree := range pt.Votes {
+		v := core.DecisionVote{
+			NodeID:      nodeID,
+			Agree:       agree,
+			LocalStatus: agree == pt.Proposal.ProposedStatus,
+			VotedAt:     pt.VoteTimes[nodeID],
+			Counted:     active[nodeID],
+		}
+		d.Votes = append(d.Votes, v)
+		if !v.Counted {
+			continue
+		}
+		if agree {
+			d.Yes++
+			if r := state.ClusterNodes[nodeID].Region; r != "" && !regions[r] {
+				regions[r] = true
+				d.Regions = append(d.Regions, r)
+			}
+		} else {
+			d.No++
+		}
+	}
+	sort.Strings(d.Regions)
+	sort.Slice(d.Votes, func(i, j int) bool { return d.Votes[i].NodeID < d.Votes[j].NodeID })
+
+	if pt.Passed {
+		d.Forced = d.Yes < d.Required
+	} else {
+		d.Forced = d.No < d.Required
+	}
+	return d
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -2,6 +2,7 @@ package consensus
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -9,6 +10,7 @@ import (
 	cfg "github.com/ibp-network/ibp-geodns-libs/config"
 	dat "github.com/ibp-network/ibp-geodns-libs/data"
 	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/tracing"
 
 	"github.com/nats-io/nats.go"
 )
@@ -661,6 +663,68 @@ func TestVoteOnProposalAppliesLocalVoteWithoutEcho(t *testing.T) {
 	}
 }
 
+func TestVoteOnProposalPropagatesProposalContext(t *testing.T) {
+	deps := newTestDependencies()
+	defer stopProposalTimers(deps.State)
+
+	prevLocal := dat.Local
+	resetLocalResults()
+	defer func() {
+		dat.Local = prevLocal
+	}()
+
+	check := cfg.Check{Name: "wss"}
+	member := cfg.Member{Details: cfg.MemberDetails{Name: "provider1"}}
+	dat.UpdateLocalEndpointResult(check, member, cfg.Service{}, "rpc.example.com", "wss://rpc.example.com/ws", false, "timeout", nil, false)
+
+	proposal := core.Proposal{
+		ID:             core.ProposalID("traced-proposal"),
+		SenderNodeID:   "monitor-b",
+		CheckType:      "endpoint",
+		CheckName:      "wss",
+		MemberName:     "provider1",
+		DomainName:     "rpc.example.com",
+		Endpoint:       "wss://rpc.example.com/ws",
+		ProposedStatus: false,
+		Timestamp:      time.Now().UTC(),
+	}
+	const traceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	deps.State.Proposals[proposal.ID] = &core.ProposalTracking{
+		Proposal:      proposal,
+		Votes:         make(map[string]bool),
+		TraceParent:   traceParent,
+		CorrelationID: "round-1",
+	}
+
+	var voteHeader nats.Header
+	deps.PublishMsg = func(msg *nats.Msg) error {
+		if msg.Subject == deps.State.SubjectVote {
+			voteHeader = msg.Header
+		}
+		return nil
+	}
+
+	voteOnProposal(deps, proposal)
+
+	if voteHeader == nil {
+		t.Fatal("expected vote to be published through PublishMsg")
+	}
+	got, err := tracing.ParseTraceParent(voteHeader.Get(tracing.TraceParentHeader))
+	if err != nil {
+		t.Fatalf("expected traceparent on vote: %v", err)
+	}
+	want, _ := tracing.ParseTraceParent(traceParent)
+	if got.TraceID() != want.TraceID() {
+		t.Fatalf("expected vote on trace %s, got %s", want.TraceID(), got.TraceID())
+	}
+	if got.SpanID() == want.SpanID() {
+		t.Fatal("expected vote to carry its own span id")
+	}
+	if cid := voteHeader.Get(core.CorrelationHeader); cid != "round-1" {
+		t.Fatalf("expected vote to carry the round's correlation id, got %q", cid)
+	}
+}
+
 func TestVoteOnProposalWithLockingCountFunctionDoesNotDeadlock(t *testing.T) {
 	deps := newTestDependencies()
 	defer stopProposalTimers(deps.State)
@@ -975,6 +1039,32 @@ func TestFinalizeAppliesLocallyWithoutEcho(t *testing.T) {
 	}
 }
 
+func TestFinalizeCarriesVotes(t *testing.T) {
+	deps := newTestDependencies()
+	defer stopProposalTimers(deps.State)
+
+	var published core.FinalizeMessage
+	deps.Publish = func(subject string, data []byte) error {
+		if subject == deps.State.SubjectFinalize {
+			_ = json.Unmarshal(data, &published)
+		}
+		return nil
+	}
+
+	pt := &core.ProposalTracking{
+		Proposal: core.Proposal{ID: core.ProposalID("finalize-votes")},
+		Votes:    map[string]bool{"monitor-a": true, "monitor-b": false},
+		Passed:   true,
+	}
+	deps.State.Proposals[pt.Proposal.ID] = pt
+
+	finalize(deps, pt)
+
+	if len(published.Votes) != 2 || !published.Votes["monitor-a"] || published.Votes["monitor-b"] {
+		t.Fatalf("expected per-node votes in finalize message, got %+v", published.Votes)
+	}
+}
+
 func TestForceFinalizeFailsAfterRetryLimit(t *testing.T) {
 	deps := newTestDependencies()
 	defer stopProposalTimers(deps.State)
@@ -1042,3 +1132,269 @@ func TestForceFinalizeFailsAfterRetryLimit(t *testing.T) {
 		t.Fatalf("expected proposal %s to be removed after retry limit", proposalID)
 	}
 }
+
+func TestConsensusIgnoresOtherClusters(t *testing.T) {
+	deps := newTestDependencies()
+	deps.State.ThisNode.ClusterName = "prod"
+	defer stopProposalTimers(deps.State)
+
+	var finalized int
+	deps.OnFinalize = func(core.FinalizeMessage) { finalized++ }
+
+	prop := core.Proposal{ID: "staging-1", SenderNodeID: "monitor-staging", ClusterName: "staging", Timestamp: time.Now().UTC()}
+	data, _ := json.Marshal(prop)
+	HandleProposal(deps, &nats.Msg{Data: data})
+
+	vote, _ := json.Marshal(core.Vote{ProposalID: "staging-1", SenderNodeID: "monitor-staging", NodeID: "monitor-staging", Agree: true, ClusterName: "staging"})
+	HandleVote(deps, &nats.Msg{Data: vote})
+
+	fm, _ := json.Marshal(core.FinalizeMessage{Proposal: prop, Passed: true})
+	HandleFinalize(deps, &nats.Msg{Data: fm})
+
+	deps.State.Mu.RLock()
+	_, tracked := deps.State.Proposals["staging-1"]
+	_, buffered := deps.State.PendingVotes["staging-1"]
+	_, known := deps.State.ClusterNodes["monitor-staging"]
+	deps.State.Mu.RUnlock()
+
+	if tracked || buffered || known || finalized != 0 {
+		t.Fatalf("expected staging traffic to be ignored: tracked=%v buffered=%v known=%v finalized=%d", tracked, buffered, known, finalized)
+	}
+}
+
+func TestCountActiveMonitorsOnlyCountsOwnCluster(t *testing.T) {
+	deps := newTestDependencies()
+	state := deps.State
+	state.ThisNode.ClusterName = "prod"
+	state.ClusterNodes["monitor-a"] = core.NodeInfo{NodeID: "monitor-a", NodeRole: "IBPMonitor", ClusterName: "prod"}
+	state.ClusterNodes["monitor-b"] = core.NodeInfo{NodeID: "monitor-b", NodeRole: "IBPMonitor", ClusterName: "prod"}
+	state.ClusterNodes["monitor-s"] = core.NodeInfo{NodeID: "monitor-s", NodeRole: "IBPMonitor", ClusterName: "staging"}
+
+	state.Mu.RLock()
+	got := countActiveMonitorsLocked(state, deps.IsNodeActive)
+	state.Mu.RUnlock()
+	if got != 2 {
+		t.Fatalf("expected 2 prod monitors, got %d", got)
+	}
+}
+
+func TestProposeCheckStatusMarksShadowChecks(t *testing.T) {
+	deps := newTestDependencies()
+	defer stopProposalTimers(deps.State)
+
+	deps.IsShadowCheck = func(checkType, checkName string) bool {
+		return checkType == "endpoint" && checkName == "new-check"
+	}
+	var published []core.Proposal
+	deps.Publish = func(subject string, data []byte) error {
+		if subject == deps.State.SubjectPropose {
+			var p core.Proposal
+			if err := json.Unmarshal(data, &p); err != nil {
+				t.Errorf("unmarshal proposal: %v", err)
+			}
+			published = append(published, p)
+		}
+		return nil
+	}
+
+	ProposeCheckStatus(deps, "endpoint", "new-check", "member", "rpc.example", "wss://rpc.example", false, "", nil, false)
+	ProposeCheckStatus(deps, "endpoint", "wss", "member", "rpc.example", "wss://rpc.example", false, "", nil, false)
+
+	if len(published) != 2 {
+		t.Fatalf("expected 2 proposals, got %d", len(published))
+	}
+	if !published[0].Shadow || published[1].Shadow {
+		t.Fatalf("expected only the shadow check's proposal to be marked, got %v and %v",
+			published[0].Shadow, published[1].Shadow)
+	}
+
+	deps.State.Mu.RLock()
+	defer deps.State.Mu.RUnlock()
+	official := published[0]
+	official.ID = "other"
+	official.Shadow = false
+	if pt := findMatchingProposalLocked(deps.State, official); pt != nil {
+		t.Fatalf("expected an official proposal not to match the shadow round %s", pt.Proposal.ID)
+	}
+}
+
+func TestFinalizeCarriesDecision(t *testing.T) {
+	deps := newTestDependencies()
+	defer stopProposalTimers(deps.State)
+
+	for _, id := range []string{"monitor-a", "monitor-b", "monitor-c"} {
+		deps.State.ClusterNodes[id] = core.NodeInfo{NodeID: id, NodeRole: "IBPMonitor"}
+	}
+	proposedAt := time.Now().Add(-time.Minute).UTC()
+	votedAt := proposedAt.Add(time.Second)
+
+	var published core.FinalizeMessage
+	deps.Publish = func(subject string, data []byte) error {
+		if subject == deps.State.SubjectFinalize {
+			_ = json.Unmarshal(data, &published)
+		}
+		return nil
+	}
+
+	pt := &core.ProposalTracking{
+		Proposal: core.Proposal{ID: "decision", ProposedStatus: false, Timestamp: proposedAt},
+		Votes:    make(map[string]bool),
+	}
+	deps.State.Proposals[pt.Proposal.ID] = pt
+	deps.State.Mu.Lock()
+	setVoteLocked(pt, core.Vote{NodeID: "monitor-a", Agree: true, Timestamp: votedAt})
+	setVoteLocked(pt, core.Vote{NodeID: "monitor-b", Agree: true, Timestamp: votedAt})
+	setVoteLocked(pt, core.Vote{NodeID: "monitor-x", Agree: false, Timestamp: votedAt})
+	pt.Finalized, pt.Passed = true, true
+	deps.State.Mu.Unlock()
+
+	finalize(deps, pt)
+
+	d := published.Decision
+	if d == nil {
+		t.Fatal("expected a decision in the finalize message")
+	}
+	if d.Yes != 2 || d.No != 0 || d.Required != 2 || d.Forced {
+		t.Fatalf("unexpected tally %+v", d)
+	}
+	if len(d.ActiveMonitors) != 3 || d.ActiveMonitors[0] != "monitor-a" {
+		t.Fatalf("expected sorted active monitors, got %v", d.ActiveMonitors)
+	}
+	if len(d.Votes) != 3 || d.Votes[2].NodeID != "monitor-x" || d.Votes[2].Counted {
+		t.Fatalf("expected the inactive voter listed but not counted, got %+v", d.Votes)
+	}
+	if d.Votes[0].LocalStatus || !d.Votes[2].LocalStatus {
+		t.Fatalf("expected local statuses derived from agreement, got %+v", d.Votes)
+	}
+	if !d.Votes[0].VotedAt.Equal(votedAt) || !d.ProposedAt.Equal(proposedAt) || !d.DecidedAt.Equal(published.DecidedAt) {
+		t.Fatalf("unexpected timing %+v", d)
+	}
+}
+
+func TestFinalizeSequenceNumbersAndGaps(t *testing.T) {
+	deps := newTestDependencies()
+	defer stopProposalTimers(deps.State)
+	deps.Sequencer = core.NewSequencer()
+	deps.Tracker = core.NewSeqTracker()
+
+	var published []core.FinalizeMessage
+	deps.Publish = func(subject string, data []byte) error {
+		var fm core.FinalizeMessage
+		_ = json.Unmarshal(data, &fm)
+		published = append(published, fm)
+		return nil
+	}
+	for _, id := range []string{"seq-1", "seq-2"} {
+		pt := &core.ProposalTracking{Proposal: core.Proposal{ID: core.ProposalID(id)}, Passed: true}
+		deps.State.Proposals[pt.Proposal.ID] = pt
+		finalize(deps, pt)
+	}
+	if len(published) != 2 || published[0].Seq != 1 || published[1].Seq != 2 ||
+		published[0].Epoch == 0 || published[0].Epoch != published[1].Epoch {
+		t.Fatalf("expected finalize messages numbered 1 and 2 in one epoch, got %+v", published)
+	}
+
+	gaps := map[string]uint64{}
+	deps.OnGap = func(sender string, missed uint64) { gaps[sender] += missed }
+	receive := func(sender string, seq uint64) {
+		payload, _ := json.Marshal(core.FinalizeMessage{
+			Proposal:     core.Proposal{ID: core.ProposalID(fmt.Sprintf("%s-%d", sender, seq))},
+			SenderNodeID: sender,
+			Epoch:        7,
+			Seq:          seq,
+		})
+		HandleFinalize(deps, &nats.Msg{Data: payload})
+	}
+	receive("monitor-b", 1)
+	receive("monitor-b", 4)
+	receive("monitor-b", 4)       // duplicate
+	receive(deps.State.NodeID, 9) // own finalize
+	receive("monitor-c", 3)       // first seen
+	if len(gaps) != 0 {
+		t.Fatalf("expected no gap while 2 and 3 may still arrive, got %v", gaps)
+	}
+	receive("monitor-b", 68) // 2 and 3 fall out of the reorder window
+	if len(gaps) != 1 || gaps["monitor-b"] != 2 {
+		t.Fatalf("expected 2 missed finalize messages from monitor-b only, got %v", gaps)
+	}
+}
+
+func TestFinalizeHandledOutOfOrderIsNoGap(t *testing.T) {
+	deps := newTestDependencies()
+	defer stopProposalTimers(deps.State)
+	deps.Tracker = core.NewSeqTracker()
+	var gaps uint64
+	deps.OnGap = func(_ string, missed uint64) { gaps += missed }
+
+	// The worker pool handled 3 before 2 and 5 before 4.
+	for _, seq := range []uint64{1, 3, 2, 5, 4, 6} {
+		payload, _ := json.Marshal(core.FinalizeMessage{
+			Proposal:     core.Proposal{ID: core.ProposalID(fmt.Sprintf("p-%d", seq))},
+			SenderNodeID: "monitor-b",
+			Epoch:        7,
+			Seq:          seq,
+		})
+		HandleFinalize(deps, &nats.Msg{Data: payload})
+	}
+	if gaps != 0 {
+		t.Fatalf("expected reordered finalize messages not to count as missed, got %d", gaps)
+	}
+}
+
+func TestOfflineNeedsAgreementFromDistinctRegions(t *testing.T) {
+	deps := newTestDependencies()
+	defer stopProposalTimers(deps.State)
+	deps.MinOfflineRegions = func() int { return 2 }
+	now := time.Now().UTC()
+	for id, region := range map[string]string{"monitor-a": "eu", "monitor-b": "eu", "monitor-c": "us"} {
+		deps.State.ClusterNodes[id] = core.NodeInfo{NodeID: id, NodeRole: "IBPMonitor", Region: region, LastHeard: now}
+	}
+	finalized := make(chan core.FinalizeMessage, 2)
+	deps.OnFinalize = func(msg core.FinalizeMessage) { finalized <- msg }
+
+	track := func(id core.ProposalID, votes map[string]bool) *core.ProposalTracking {
+		pt := &core.ProposalTracking{
+			Proposal: core.Proposal{ID: id, SenderNodeID: "monitor-a", Timestamp: now},
+			Votes:    votes,
+		}
+		deps.State.Mu.Lock()
+		deps.State.Proposals[id] = pt
+		decideLocked(deps, pt)
+		deps.State.Mu.Unlock()
+		return pt
+	}
+
+	// Both eu monitors agree: a majority, but from one region.
+	pt := track("offline-eu", map[string]bool{"monitor-a": true, "monitor-b": true})
+	deps.State.Mu.RLock()
+	waiting := !pt.Finalized
+	deps.State.Mu.RUnlock()
+	if !waiting {
+		t.Fatal("expected a single-region majority to wait for more votes")
+	}
+
+	// The us monitor disagrees: every monitor voted, the offline fails.
+	deps.State.Mu.Lock()
+	pt.Votes["monitor-c"] = false
+	decideLocked(deps, pt)
+	deps.State.Mu.Unlock()
+	select {
+	case msg := <-finalized:
+		if msg.Passed || msg.Decision.RequiredRegions != 2 || len(msg.Decision.Regions) != 1 {
+			t.Fatalf("expected failed offline held to 2 regions, got passed=%v decision=%+v", msg.Passed, msg.Decision)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the proposal to finalize once all monitors voted")
+	}
+
+	// Agreement from eu and us passes.
+	track("offline-eu-us", map[string]bool{"monitor-a": true, "monitor-c": true})
+	select {
+	case msg := <-finalized:
+		if !msg.Passed || len(msg.Decision.Regions) != 2 {
+			t.Fatalf("expected offline agreed from 2 regions to pass, got passed=%v decision=%+v", msg.Passed, msg.Decision)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the proposal to finalize")
+	}
+}
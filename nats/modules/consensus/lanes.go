@@ -0,0 +1,190 @@
+package consensus
+
+import (
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+)
+
+// -----------------------------------------------------------------------------
+// PRIORITY LANES
+// -----------------------------------------------------------------------------
+//
+// Received proposals are processed in one lane per check type, each with its
+// own queue and workers, so a storm of endpoint proposals never delays a site
+// or domain proposal. Within a lane recoveries are processed before outages.
+
+// Lanes in priority order.
+const (
+	LaneSite     = "site"
+	LaneDomain   = "domain"
+	LaneEndpoint = "endpoint"
+)
+
+const (
+	DefaultLaneConcurrency = 4
+	DefaultLaneQueueSize   = 1024
+)
+
+var laneOrder = []string{LaneSite, LaneDomain, LaneEndpoint}
+
+// LaneOf returns the lane of p. Unknown check types share the endpoint
+// lane.
+func LaneOf(p core.Proposal) string {
+	switch p.CheckType {
+	case "site":
+		return LaneSite
+	case "domain":
+		return LaneDomain
+	default:
+		return LaneEndpoint
+	}
+}
+
+// LaneStats describes one lane.
+type LaneStats struct {
+	Lane        string `json:"lane"`
+	Concurrency int    `json:"concurrency"`
+	Running     int    `json:"running"`
+	Recoveries  int    `json:"recoveries"` // queued
+	Outages     int    `json:"outages"`    // queued
+	Processed   uint64 `json:"processed"`
+	Dropped     uint64 `json:"dropped"`
+}
+
+// Lanes schedules proposal processing. Workers are started on demand, up to
+// each lane's concurrency, and exit when their lane is empty.
+type Lanes struct {
+	lanes map[string]*lane
+}
+
+type lane struct {
+	name      string
+	queueSize int
+
+	mu         sync.Mutex
+	limit      int
+	running    int
+	recoveries []func()
+	outages    []func()
+
+	processed atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// NewLanes returns lanes with concurrency per lane name; missing or
+// non-positive entries use DefaultLaneConcurrency. A queueSize of 0 uses
+// DefaultLaneQueueSize.
+func NewLanes(concurrency map[string]int, queueSize int) *Lanes {
+	if queueSize <= 0 {
+		queueSize = DefaultLaneQueueSize
+	}
+	l := &Lanes{lanes: make(map[string]*lane, len(laneOrder))}
+	for _, name := range laneOrder {
+		l.lanes[name] = &lane{name: name, queueSize: queueSize, limit: laneLimit(concurrency, name)}
+	}
+	return l
+}
+
+func laneLimit(concurrency map[string]int, name string) int {
+	if n := concurrency[name]; n > 0 {
+		return n
+	}
+	return DefaultLaneConcurrency
+}
+
+// Submit queues job in p's lane. It returns false when the lane is full
+// and the job was dropped; the proposer republishes unresolved proposals.
+func (l *Lanes) Submit(p core.Proposal, job func()) bool {
+	ln := l.lanes[LaneOf(p)]
+	ln.mu.Lock()
+	if len(ln.recoveries)+len(ln.outages) >= ln.queueSize {
+		ln.mu.Unlock()
+		ln.dropped.Add(1)
+		return false
+	}
+	if p.ProposedStatus {
+		ln.recoveries = append(ln.recoveries, job)
+	} else {
+		ln.outages = append(ln.outages, job)
+	}
+	ln.spawnLocked()
+	ln.mu.Unlock()
+	return true
+}
+
+// SetConcurrency changes the concurrency of the lanes, e.g. after a config
+// reload. Workers above a lowered limit finish their current job first.
+func (l *Lanes) SetConcurrency(concurrency map[string]int) {
+	for _, name := range laneOrder {
+		ln := l.lanes[name]
+		ln.mu.Lock()
+		ln.limit = laneLimit(concurrency, name)
+		ln.spawnLocked()
+		ln.mu.Unlock()
+	}
+}
+
+// Stats returns the lanes in priority order.
+func (l *Lanes) Stats() []LaneStats {
+	out := make([]LaneStats, 0, len(laneOrder))
+	for _, name := range laneOrder {
+		ln := l.lanes[name]
+		ln.mu.Lock()
+		out = append(out, LaneStats{
+			Lane:        name,
+			Concurrency: ln.limit,
+			Running:     ln.running,
+			Recoveries:  len(ln.recoveries),
+			Outages:     len(ln.outages),
+			Processed:   ln.processed.Load(),
+			Dropped:     ln.dropped.Load(),
+		})
+		ln.mu.Unlock()
+	}
+	return out
+}
+
+// spawnLocked starts workers until the queued jobs or the limit are
+// covered. Callers must hold ln.mu.
+func (ln *lane) spawnLocked() {
+	for ln.running < ln.limit && ln.running < len(ln.recoveries)+len(ln.outages) {
+		ln.running++
+		go ln.work()
+	}
+}
+
+func (ln *lane) work() {
+	for {
+		ln.mu.Lock()
+		var job func()
+		switch {
+		case ln.running > ln.limit:
+		case len(ln.recoveries) > 0:
+			job, ln.recoveries = ln.recoveries[0], ln.recoveries[1:]
+		case len(ln.outages) > 0:
+			job, ln.outages = ln.outages[0], ln.outages[1:]
+		}
+		if job == nil {
+			ln.running--
+			ln.mu.Unlock()
+			return
+		}
+		ln.mu.Unlock()
+
+		ln.run(job)
+		ln.processed.Add(1)
+	}
+}
+
+func (ln *lane) run(job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Log(log.Error, "[CONSENSUS] panic in %s lane: %v\n%s", ln.name, r, debug.Stack())
+		}
+	}()
+	job()
+}
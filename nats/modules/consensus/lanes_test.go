@@ -0,0 +1,128 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+
+	"github.com/nats-io/nats.go"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLanesIsolateSiteFromEndpointStorm(t *testing.T) {
+	lanes := NewLanes(map[string]int{LaneEndpoint: 1, LaneSite: 1}, 0)
+	block := make(chan struct{})
+	defer close(block)
+
+	endpoint := core.Proposal{CheckType: "endpoint"}
+	for i := 0; i < 50; i++ {
+		lanes.Submit(endpoint, func() { <-block })
+	}
+	done := make(chan struct{})
+	lanes.Submit(core.Proposal{CheckType: "site", ProposedStatus: true}, func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the site proposal to run while the endpoint lane is busy")
+	}
+	waitFor(t, "the endpoint worker to start", func() bool { return lanes.Stats()[2].Outages == 49 })
+	stats := lanes.Stats()
+	if stats[0].Lane != LaneSite || stats[2].Lane != LaneEndpoint || stats[2].Running != 1 {
+		t.Fatalf("unexpected lane stats: %+v", stats)
+	}
+}
+
+func TestLanesRunRecoveriesBeforeOutages(t *testing.T) {
+	lanes := NewLanes(map[string]int{LaneDomain: 1}, 0)
+	block := make(chan struct{})
+	order := make(chan string, 4)
+
+	domain := func(recovery bool) core.Proposal {
+		return core.Proposal{CheckType: "domain", ProposedStatus: recovery}
+	}
+	lanes.Submit(domain(false), func() { <-block })
+	waitFor(t, "the first job to start", func() bool { return lanes.Stats()[1].Running == 1 && lanes.Stats()[1].Outages == 0 })
+
+	lanes.Submit(domain(false), func() { order <- "outage-1" })
+	lanes.Submit(domain(true), func() { order <- "recovery" })
+	lanes.Submit(domain(false), func() { order <- "outage-2" })
+	close(block)
+
+	for _, want := range []string{"recovery", "outage-1", "outage-2"} {
+		select {
+		case got := <-order:
+			if got != want {
+				t.Fatalf("expected %s next, got %s", want, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+}
+
+func TestLanesDropWhenFullAndSurvivePanics(t *testing.T) {
+	lanes := NewLanes(map[string]int{LaneSite: 1}, 2)
+	block := make(chan struct{})
+	site := core.Proposal{CheckType: "site"}
+
+	lanes.Submit(site, func() { <-block })
+	waitFor(t, "the first job to start", func() bool { return lanes.Stats()[0].Outages == 0 })
+	lanes.Submit(site, func() { panic("boom") })
+	lanes.Submit(site, func() {})
+	if lanes.Submit(site, func() {}) {
+		t.Fatal("expected a full lane to drop the job")
+	}
+	close(block)
+
+	waitFor(t, "the lane to drain", func() bool {
+		s := lanes.Stats()[0]
+		return s.Processed == 3 && s.Running == 0
+	})
+	if s := lanes.Stats()[0]; s.Dropped != 1 {
+		t.Fatalf("expected 1 dropped job, got %+v", s)
+	}
+}
+
+func TestLanesSetConcurrencyStartsWorkers(t *testing.T) {
+	lanes := NewLanes(map[string]int{LaneEndpoint: 1}, 0)
+	block := make(chan struct{})
+	defer close(block)
+	endpoint := core.Proposal{CheckType: "endpoint"}
+	for i := 0; i < 3; i++ {
+		lanes.Submit(endpoint, func() { <-block })
+	}
+	lanes.SetConcurrency(map[string]int{LaneEndpoint: 3})
+	waitFor(t, "three running workers", func() bool { return lanes.Stats()[2].Running == 3 })
+	if c := lanes.Stats()[0].Concurrency; c != DefaultLaneConcurrency {
+		t.Fatalf("expected unset lanes to use the default concurrency, got %d", c)
+	}
+}
+
+func TestHandleProposalUsesLanes(t *testing.T) {
+	deps := newTestDependencies()
+	defer stopProposalTimers(deps.State)
+	deps.Lanes = NewLanes(nil, 0)
+
+	payload := []byte(`{"ID":"lane-1","SenderNodeID":"monitor-b","CheckType":"site","CheckName":"ping","MemberName":"m"}`)
+	HandleProposal(deps, &nats.Msg{Data: payload})
+
+	waitFor(t, "the proposal to be tracked", func() bool {
+		deps.State.Mu.RLock()
+		defer deps.State.Mu.RUnlock()
+		_, ok := deps.State.Proposals["lane-1"]
+		return ok
+	})
+	waitFor(t, "the site lane to process it", func() bool { return deps.Lanes.Stats()[0].Processed == 1 })
+}
@@ -0,0 +1,128 @@
+package consensus
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+)
+
+// -----------------------------------------------------------------------------
+// PER-CHECK RULES
+// -----------------------------------------------------------------------------
+//
+// Checks differ in how much a single failure means: a stale endpoint is
+// seen the same way from everywhere, an unreachable ICMP target may be one
+// monitor's path. Rules lets each check set its own thresholds; zero fields
+// keep the cluster-wide behaviour.
+
+// hysteresisTTL is how long a run of identical local results is remembered
+// between two proposals of the same target.
+const hysteresisTTL = 10 * time.Minute
+
+// Rules are the consensus thresholds of one check.
+type Rules struct {
+	// QuorumPercent: a side needs votes from more than this percent of the
+	// active monitors, 50 to 100; other values use 50, a simple majority.
+	QuorumPercent int
+	// MinVotes is the fewest agreeing votes an outcome needs and the
+	// fewest active monitors a decision needs; 0 uses 2.
+	MinVotes int
+	// Timeout forces an undecided proposal; 0 uses the adaptive or fixed
+	// proposal timeout.
+	Timeout time.Duration
+	// Hysteresis is how many times in a row this node must see the same
+	// status before it opens a proposal; below 2 the first time does.
+	Hysteresis int
+}
+
+func rulesFor(deps Dependencies, p core.Proposal) Rules {
+	if deps.CheckRules == nil {
+		return Rules{}
+	}
+	return deps.CheckRules(p.CheckType, p.CheckName)
+}
+
+func (r Rules) minVotes() int {
+	if r.MinVotes > 0 {
+		return r.MinVotes
+	}
+	return minConsensusVotes
+}
+
+// required returns how many votes a side needs out of total active
+// monitors.
+func (r Rules) required(total int) int {
+	pct := r.QuorumPercent
+	if pct < 50 || pct > 100 {
+		pct = 50
+	}
+	return max(min(total*pct/100+1, total), r.minVotes())
+}
+
+// streaks counts how often in a row this node proposed each status of a
+// target, for Rules.Hysteresis. A local result that agrees with the
+// official status ends the run (see ObserveLocalResult), so fail, ok, fail
+// counts one failure, not two.
+type streaks struct {
+	mu sync.Mutex
+	m  map[string]streak
+}
+
+type streak struct {
+	status bool
+	count  int
+	seen   time.Time
+}
+
+var proposeStreaks = &streaks{m: make(map[string]streak)}
+
+// observe records a local result of status for p's target at now and
+// returns how many results in a row had that status.
+func (s *streaks) observe(p core.Proposal, now time.Time) int {
+	key := streakKey(p)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, st := range s.m {
+		if now.Sub(st.seen) > hysteresisTTL {
+			delete(s.m, k)
+		}
+	}
+	st, ok := s.m[key]
+	if !ok || st.status != p.ProposedStatus {
+		st = streak{status: p.ProposedStatus}
+	}
+	st.count++
+	st.seen = now
+	s.m[key] = st
+	return st.count
+}
+
+// reset forgets the run of p's target.
+func (s *streaks) reset(p core.Proposal) {
+	s.mu.Lock()
+	delete(s.m, streakKey(p))
+	s.mu.Unlock()
+}
+
+func streakKey(p core.Proposal) string {
+	return strings.Join([]string{p.CheckType, p.CheckName, p.MemberName,
+		p.DomainName, p.Endpoint, strconv.FormatBool(p.IsIPv6)}, "|")
+}
+
+// ObserveLocalResult tells consensus that this node's latest result for a
+// target agrees with the official status, so nothing is proposed. It ends
+// the target's hysteresis run: a later disagreeing result starts counting
+// from one again.
+func ObserveLocalResult(checkType, checkName, memberName, domainName, endpoint string, isIPv6 bool) {
+	proposeStreaks.reset(core.Proposal{
+		CheckType:  checkType,
+		CheckName:  checkName,
+		MemberName: memberName,
+		DomainName: domainName,
+		Endpoint:   endpoint,
+		IsIPv6:     isIPv6,
+	})
+}
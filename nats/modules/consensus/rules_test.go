@@ -0,0 +1,138 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+)
+
+func TestRulesRequired(t *testing.T) {
+	tests := []struct {
+		rules Rules
+		total int
+		want  int
+	}{
+		{Rules{}, 3, 2},
+		{Rules{}, 4, 3},
+		{Rules{}, 1, 2},
+		{Rules{QuorumPercent: 66}, 6, 4},
+		{Rules{QuorumPercent: 100}, 5, 5},
+		{Rules{QuorumPercent: 30}, 4, 3},
+		{Rules{MinVotes: 4}, 5, 4},
+		{Rules{MinVotes: 1}, 1, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.rules.required(tt.total); got != tt.want {
+			t.Errorf("%+v.required(%d) = %d, want %d", tt.rules, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestCheckRulesRaiseThresholdAndTimeout(t *testing.T) {
+	deps := newTestDependencies()
+	defer stopProposalTimers(deps.State)
+	deps.CheckRules = func(checkType, checkName string) Rules {
+		if checkName == "icmp" {
+			return Rules{QuorumPercent: 100, Timeout: 90 * time.Second}
+		}
+		return Rules{}
+	}
+	now := time.Now().UTC()
+	for _, id := range []string{"monitor-a", "monitor-b", "monitor-c"} {
+		deps.State.ClusterNodes[id] = core.NodeInfo{NodeID: id, NodeRole: "IBPMonitor", LastHeard: now}
+	}
+	finalized := make(chan core.FinalizeMessage, 1)
+	deps.OnFinalize = func(msg core.FinalizeMessage) { finalized <- msg }
+
+	icmp := core.Proposal{ID: "icmp-1", CheckType: "site", CheckName: "icmp", Timestamp: now}
+	if got := proposalTimeout(deps, icmp); got != 90*time.Second {
+		t.Fatalf("proposalTimeout = %s, want 90s", got)
+	}
+	if got := proposalTimeout(deps, core.Proposal{CheckType: "site", CheckName: "ping"}); got != deps.State.ProposalTimeout {
+		t.Fatalf("proposalTimeout of a check without rules = %s, want %s", got, deps.State.ProposalTimeout)
+	}
+
+	pt := &core.ProposalTracking{Proposal: icmp, Votes: map[string]bool{"monitor-a": true, "monitor-b": true}}
+	deps.State.Mu.Lock()
+	deps.State.Proposals[icmp.ID] = pt
+	decideLocked(deps, pt)
+	decided := pt.Finalized
+	deps.State.Mu.Unlock()
+	if decided {
+		t.Fatal("expected 2 of 3 votes to fall short of a 100% quorum")
+	}
+
+	deps.State.Mu.Lock()
+	pt.Votes["monitor-c"] = true
+	decideLocked(deps, pt)
+	deps.State.Mu.Unlock()
+	select {
+	case msg := <-finalized:
+		if !msg.Passed || msg.Decision.Required != 3 {
+			t.Fatalf("expected pass requiring 3 votes, got passed=%v required=%d", msg.Passed, msg.Decision.Required)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the proposal to finalize with every vote")
+	}
+}
+
+func TestHysteresisHoldsProposalUntilStatusRepeats(t *testing.T) {
+	deps := newTestDependencies()
+	defer stopProposalTimers(deps.State)
+	deps.CheckRules = func(string, string) Rules { return Rules{Hysteresis: 3} }
+	published := 0
+	deps.Publish = func(subject string, _ []byte) error {
+		if subject == deps.State.SubjectPropose {
+			published++
+		}
+		return nil
+	}
+	tracked := func() int {
+		deps.State.Mu.RLock()
+		defer deps.State.Mu.RUnlock()
+		return len(deps.State.Proposals)
+	}
+
+	for i := 1; i <= 2; i++ {
+		propose(deps, "site", "hysteresis-check", "member-1", "", "", false, "timeout", nil, false)
+		if n := tracked(); n != 0 {
+			t.Fatalf("after %d result(s) expected no proposal, got %d", i, n)
+		}
+	}
+	// An online result breaks the run.
+	propose(deps, "site", "hysteresis-check", "member-1", "", "", true, "", nil, false)
+	for i := 1; i <= 2; i++ {
+		propose(deps, "site", "hysteresis-check", "member-1", "", "", false, "timeout", nil, false)
+	}
+	if n := tracked(); n != 0 {
+		t.Fatalf("expected the broken run to start over, got %d proposal(s)", n)
+	}
+	propose(deps, "site", "hysteresis-check", "member-1", "", "", false, "timeout", nil, false)
+	if n := tracked(); n != 1 || published != 1 {
+		t.Fatalf("expected one proposal on the third offline result, got tracked=%d published=%d", n, published)
+	}
+}
+
+func TestLocalResultMatchingOfficialResetsHysteresis(t *testing.T) {
+	deps := newTestDependencies()
+	defer stopProposalTimers(deps.State)
+	deps.CheckRules = func(string, string) Rules { return Rules{Hysteresis: 2} }
+	tracked := func() int {
+		deps.State.Mu.RLock()
+		defer deps.State.Mu.RUnlock()
+		return len(deps.State.Proposals)
+	}
+
+	// fail, ok (agrees with official, not proposed), fail: one failure in a row.
+	propose(deps, "site", "reset-check", "member-1", "", "", false, "timeout", nil, false)
+	ObserveLocalResult("site", "reset-check", "member-1", "", "", false)
+	propose(deps, "site", "reset-check", "member-1", "", "", false, "timeout", nil, false)
+	if n := tracked(); n != 0 {
+		t.Fatalf("expected the agreeing result to reset the run, got %d proposal(s)", n)
+	}
+	propose(deps, "site", "reset-check", "member-1", "", "", false, "timeout", nil, false)
+	if n := tracked(); n != 1 {
+		t.Fatalf("expected a proposal on the second failure in a row, got %d", n)
+	}
+}
@@ -0,0 +1,184 @@
+package consensus
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// -----------------------------------------------------------------------------
+// ADAPTIVE PROPOSAL TIMEOUT
+// -----------------------------------------------------------------------------
+//
+// A fixed proposal timeout is either too long for a small, fast cluster
+// (outages are forced late) or too short for a large or distant one (rounds
+// are forced before the votes arrive). Timeouts records how long every
+// remote vote took to arrive after this node started tracking the proposal,
+// per check type, and derives the timeout from a percentile of the recent
+// arrivals times a headroom multiplier, bounded by Min and Max. Every
+// monitor's vote is a sample, so more or slower monitors lift the tail.
+// Until MinSamples arrivals are recorded for a check type the fallback
+// (the node's fixed ProposalTimeout) applies.
+
+const (
+	DefaultTimeoutPercentile = 95
+	DefaultTimeoutMultiplier = 3.0
+	DefaultTimeoutMin        = 5 * time.Second
+	DefaultTimeoutMax        = 60 * time.Second
+	DefaultTimeoutMinSamples = 20
+
+	timeoutWindow = 256 // arrivals kept per check type
+)
+
+// TimeoutPolicy bounds the adaptive timeout. Zero fields use the defaults.
+type TimeoutPolicy struct {
+	Percentile int
+	Multiplier float64
+	Min        time.Duration
+	Max        time.Duration
+	MinSamples int
+}
+
+func (p TimeoutPolicy) withDefaults() TimeoutPolicy {
+	if p.Percentile <= 0 || p.Percentile > 100 {
+		p.Percentile = DefaultTimeoutPercentile
+	}
+	if p.Multiplier <= 0 {
+		p.Multiplier = DefaultTimeoutMultiplier
+	}
+	if p.Min <= 0 {
+		p.Min = DefaultTimeoutMin
+	}
+	if p.Max <= 0 {
+		p.Max = DefaultTimeoutMax
+	}
+	if p.Max < p.Min {
+		p.Max = p.Min
+	}
+	if p.MinSamples <= 0 {
+		p.MinSamples = DefaultTimeoutMinSamples
+	}
+	return p
+}
+
+// TimeoutStats is the adaptive timeout of one check type.
+type TimeoutStats struct {
+	CheckType  string        `json:"checkType"`
+	Samples    int           `json:"samples"`
+	Percentile time.Duration `json:"percentile"`
+	Timeout    time.Duration `json:"timeout"`
+}
+
+// Timeouts tracks vote arrivals and computes proposal timeouts. A nil
+// *Timeouts, or one that is disabled, always returns the fallback.
+type Timeouts struct {
+	mu       sync.Mutex
+	enabled  bool
+	policy   TimeoutPolicy
+	arrivals map[string]*arrivalRing
+}
+
+type arrivalRing struct {
+	buf  [timeoutWindow]time.Duration
+	next int
+	n    int
+}
+
+func (r *arrivalRing) add(d time.Duration) {
+	r.buf[r.next] = d
+	r.next = (r.next + 1) % timeoutWindow
+	if r.n < timeoutWindow {
+		r.n++
+	}
+}
+
+// NewTimeouts returns a disabled tracker; SetPolicy enables it.
+func NewTimeouts() *Timeouts {
+	return &Timeouts{arrivals: make(map[string]*arrivalRing)}
+}
+
+// SetPolicy enables adaptive timeouts with p, or disables them when enabled
+// is false. Recorded arrivals are kept.
+func (t *Timeouts) SetPolicy(enabled bool, p TimeoutPolicy) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.enabled, t.policy = enabled, p.withDefaults()
+	t.mu.Unlock()
+}
+
+// Observe records that a vote on a proposal of checkType arrived after d.
+func (t *Timeouts) Observe(checkType string, d time.Duration) {
+	if t == nil || d < 0 {
+		return
+	}
+	t.mu.Lock()
+	r := t.arrivals[checkType]
+	if r == nil {
+		r = &arrivalRing{}
+		t.arrivals[checkType] = r
+	}
+	r.add(d)
+	t.mu.Unlock()
+}
+
+// For returns the proposal timeout of checkType.
+func (t *Timeouts) For(checkType string, fallback time.Duration) time.Duration {
+	if t == nil {
+		return fallback
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.enabled {
+		return fallback
+	}
+	return t.statsLocked(checkType, fallback).Timeout
+}
+
+// Stats reports the adaptive timeout of every check type seen, by name.
+func (t *Timeouts) Stats(fallback time.Duration) []TimeoutStats {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]TimeoutStats, 0, len(t.arrivals))
+	for ct := range t.arrivals {
+		s := t.statsLocked(ct, fallback)
+		if !t.enabled {
+			s.Timeout = fallback
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CheckType < out[j].CheckType })
+	return out
+}
+
+func (t *Timeouts) statsLocked(checkType string, fallback time.Duration) TimeoutStats {
+	p := t.policy.withDefaults()
+	s := TimeoutStats{CheckType: checkType, Timeout: fallback}
+	r := t.arrivals[checkType]
+	if r == nil {
+		return s
+	}
+	s.Samples = r.n
+	if r.n < p.MinSamples {
+		return s
+	}
+	sorted := append([]time.Duration(nil), r.buf[:r.n]...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := (p.Percentile*r.n + 99) / 100 // nearest rank
+	if idx < 1 {
+		idx = 1
+	}
+	s.Percentile = sorted[idx-1]
+	s.Timeout = time.Duration(float64(s.Percentile) * p.Multiplier)
+	if s.Timeout < p.Min {
+		s.Timeout = p.Min
+	}
+	if s.Timeout > p.Max {
+		s.Timeout = p.Max
+	}
+	return s
+}
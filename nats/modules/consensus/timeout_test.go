@@ -0,0 +1,66 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeoutsFallBackUntilEnoughSamples(t *testing.T) {
+	to := NewTimeouts()
+	for i := 0; i < 30; i++ {
+		to.Observe("site", time.Second)
+	}
+	if got := to.For("site", 30*time.Second); got != 30*time.Second {
+		t.Fatalf("expected the fallback while disabled, got %s", got)
+	}
+
+	to.SetPolicy(true, TimeoutPolicy{MinSamples: 40})
+	if got := to.For("site", 30*time.Second); got != 30*time.Second {
+		t.Fatalf("expected the fallback below MinSamples, got %s", got)
+	}
+	if got := to.For("endpoint", 30*time.Second); got != 30*time.Second {
+		t.Fatalf("expected the fallback for an unseen check type, got %s", got)
+	}
+
+	var nilTimeouts *Timeouts
+	nilTimeouts.Observe("site", time.Second)
+	if got := nilTimeouts.For("site", 7*time.Second); got != 7*time.Second {
+		t.Fatalf("expected a nil tracker to return the fallback, got %s", got)
+	}
+}
+
+func TestTimeoutsFollowPercentileWithinBounds(t *testing.T) {
+	to := NewTimeouts()
+	to.SetPolicy(true, TimeoutPolicy{Percentile: 90, Multiplier: 2, Min: 3 * time.Second, Max: 20 * time.Second, MinSamples: 10})
+
+	// 90 fast votes and 10 slow ones: p90 is the last fast vote.
+	for i := 0; i < 90; i++ {
+		to.Observe("endpoint", 2*time.Second)
+	}
+	for i := 0; i < 10; i++ {
+		to.Observe("endpoint", 8*time.Second)
+	}
+	if got := to.For("endpoint", 30*time.Second); got != 4*time.Second {
+		t.Fatalf("expected 2 x p90 = 4s, got %s", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		to.Observe("site", 100*time.Millisecond)
+	}
+	if got := to.For("site", 30*time.Second); got != 3*time.Second {
+		t.Fatalf("expected the minimum of 3s, got %s", got)
+	}
+
+	// Slow arrivals push the window out and hit the maximum.
+	for i := 0; i < timeoutWindow; i++ {
+		to.Observe("endpoint", 15*time.Second)
+	}
+	if got := to.For("endpoint", 30*time.Second); got != 20*time.Second {
+		t.Fatalf("expected the maximum of 20s, got %s", got)
+	}
+
+	stats := to.Stats(30 * time.Second)
+	if len(stats) != 2 || stats[0].CheckType != "endpoint" || stats[0].Samples != timeoutWindow || stats[0].Percentile != 15*time.Second {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -1,20 +1,20 @@
 package dns
 
 import (
-	"strings"
-
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
 	"github.com/ibp-network/ibp-geodns-libs/nats/router"
 	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
 	"github.com/nats-io/nats.go"
 )
 
 type Dependencies struct {
-	HandleUsageRequest func(*nats.Msg)
-	HandleUsageData    func(*nats.Msg)
+	HandleUsageRequest  func(*nats.Msg)
+	HandleLatencyReport func(*nats.Msg)
+	HandleSnapshot      func(*nats.Msg)
 }
 
 func Register(reg *router.Registry, deps Dependencies) {
-	reg.Register("IBPDns", module{deps: deps})
+	reg.Register(core.RoleDns, module{deps: deps})
 }
 
 type module struct {
@@ -23,18 +23,14 @@ type module struct {
 
 func (module) Name() string { return "dns-usage" }
 
-func (m module) Handle(msg *nats.Msg) bool {
-	switch msg.Subject {
-	case subjects.DnsUsageRequest:
-		if m.deps.HandleUsageRequest != nil {
-			m.deps.HandleUsageRequest(msg)
-			return true
-		}
-	default:
-		if strings.Contains(msg.Subject, "usageReply") && m.deps.HandleUsageData != nil {
-			m.deps.HandleUsageData(msg)
-			return true
-		}
+// Subscriptions lists the DNS node's subjects. Usage requests fan out to
+// every DNS node, each answering with its own counters, and every DNS node
+// keeps its own latency table for routing and its own copy of the official
+// results, so no queue groups.
+func (m module) Subscriptions() []router.Subscription {
+	return []router.Subscription{
+		{Subject: subjects.With(subjects.DnsUsageRequest), Handler: m.deps.HandleUsageRequest},
+		{Subject: subjects.With(subjects.MonitorLatency), Handler: m.deps.HandleLatencyReport},
+		{Subject: subjects.With(subjects.MonitorOfficialSnapshot), Handler: m.deps.HandleSnapshot},
 	}
-	return false
 }
@@ -0,0 +1,94 @@
+package latency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/tracing"
+
+	"github.com/nats-io/nats.go"
+)
+
+type Dependencies struct {
+	State         *core.NodeState
+	Publish       func(subject string, data []byte) error
+	PublishMsg    func(msg *nats.Msg) error // optional; carries trace and correlation headers
+	MarkNodeHeard func(string)
+	Subject       string
+
+	// Collect returns the local measurements taken after since (monitors).
+	Collect func(since time.Time) []core.LatencySample
+	// Store persists received samples (collators); optional.
+	Store func([]core.LatencySample) error
+	// Record feeds one received sample to the routing table (DNS nodes);
+	// optional.
+	Record func(core.LatencySample)
+}
+
+// PublishLocal publishes the measurements taken after since and returns how
+// many were sent.
+func PublishLocal(deps Dependencies, since time.Time) (int, error) {
+	ctx, span := tracing.Start(core.EnsureCorrelationID(context.Background()), "monitor.latency.publish", tracing.KindProducer)
+	defer span.End()
+
+	samples := deps.Collect(since)
+	if len(samples) == 0 {
+		return 0, nil
+	}
+	deps.State.Mu.RLock()
+	region := deps.State.ThisNode.Region
+	deps.State.Mu.RUnlock()
+	payload, err := json.Marshal(core.LatencyReport{NodeID: deps.State.NodeID, Region: region, Samples: samples})
+	if err != nil {
+		return 0, fmt.Errorf("marshal latency report: %w", err)
+	}
+	if err := core.PublishCtx(ctx, deps.PublishMsg, core.NoReply(deps.Publish), deps.Subject, "", payload); err != nil {
+		span.RecordError(err)
+		return 0, fmt.Errorf("publish latency report: %w", err)
+	}
+	return len(samples), nil
+}
+
+func HandleReport(deps Dependencies, data []byte) {
+	HandleReportContext(context.Background(), deps, data)
+}
+
+// HandleReportContext stores and records the samples of one latency report.
+func HandleReportContext(ctx context.Context, deps Dependencies, data []byte) {
+	var rep core.LatencyReport
+	if err := json.Unmarshal(data, &rep); err != nil {
+		log.LogCtx(ctx, log.Error, "[NATS] handleLatencyReport: unmarshal error: %v", err)
+		return
+	}
+	if rep.NodeID == "" {
+		log.LogCtx(ctx, log.Warn, "[NATS] handleLatencyReport: report without node ID dropped")
+		return
+	}
+	if deps.MarkNodeHeard != nil {
+		deps.MarkNodeHeard(rep.NodeID)
+	}
+
+	// The publisher is authoritative for the node ID and region of its
+	// samples.
+	for i := range rep.Samples {
+		rep.Samples[i].NodeID = rep.NodeID
+		rep.Samples[i].Region = rep.Region
+	}
+
+	if deps.Store != nil {
+		if err := deps.Store(rep.Samples); err != nil {
+			log.LogCtx(ctx, log.Error, "[NATS] handleLatencyReport: store %d samples from %s: %v",
+				len(rep.Samples), rep.NodeID, err)
+		}
+	}
+	if deps.Record != nil {
+		for _, s := range rep.Samples {
+			deps.Record(s)
+		}
+	}
+	log.LogCtx(ctx, log.Debug, "[NATS] handleLatencyReport: %d samples from node=%s", len(rep.Samples), rep.NodeID)
+}
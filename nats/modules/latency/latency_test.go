@@ -0,0 +1,73 @@
+package latency
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+)
+
+func TestHandleReportUsesPublisherNodeID(t *testing.T) {
+	var stored, recorded []core.LatencySample
+	heard := ""
+
+	deps := Dependencies{
+		State:         &core.NodeState{NodeID: "collator-a"},
+		MarkNodeHeard: func(id string) { heard = id },
+		Store: func(s []core.LatencySample) error {
+			stored = append(stored, s...)
+			return nil
+		},
+		Record: func(s core.LatencySample) { recorded = append(recorded, s) },
+	}
+
+	payload, _ := json.Marshal(core.LatencyReport{
+		NodeID:  "monitor-a",
+		Region:  "eu-west",
+		Samples: []core.LatencySample{{NodeID: "spoofed", Region: "us-east", Member: "m", LatencyMs: 12}},
+	})
+	HandleReport(deps, payload)
+
+	if heard != "monitor-a" {
+		t.Fatalf("expected monitor-a marked heard, got %q", heard)
+	}
+	if len(stored) != 1 || stored[0].NodeID != "monitor-a" {
+		t.Fatalf("expected stored sample attributed to monitor-a, got %+v", stored)
+	}
+	if len(recorded) != 1 || recorded[0].NodeID != "monitor-a" || recorded[0].Region != "eu-west" {
+		t.Fatalf("expected recorded sample attributed to monitor-a, got %+v", recorded)
+	}
+}
+
+func TestHandleReportDropsAnonymousReports(t *testing.T) {
+	called := false
+	deps := Dependencies{
+		State: &core.NodeState{NodeID: "collator-a"},
+		Store: func([]core.LatencySample) error {
+			called = true
+			return nil
+		},
+	}
+	HandleReport(deps, []byte(`{"samples":[{"member":"m","latencyMs":5}]}`))
+	if called {
+		t.Fatal("expected report without node ID to be dropped")
+	}
+}
+
+func TestPublishLocalSkipsEmptyBatches(t *testing.T) {
+	published := false
+	deps := Dependencies{
+		State:   &core.NodeState{NodeID: "monitor-a"},
+		Subject: "monitor.latency",
+		Publish: func(string, []byte) error {
+			published = true
+			return nil
+		},
+		Collect: func(time.Time) []core.LatencySample { return nil },
+	}
+	n, err := PublishLocal(deps, time.Now())
+	if err != nil || n != 0 || published {
+		t.Fatalf("expected nothing published, got n=%d err=%v published=%v", n, err, published)
+	}
+}
@@ -1,8 +1,7 @@
 package monitor
 
 import (
-	"strings"
-
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
 	"github.com/ibp-network/ibp-geodns-libs/nats/router"
 	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
 	"github.com/nats-io/nats.go"
@@ -20,12 +19,13 @@ type Dependencies struct {
 	HandleVote      func(*nats.Msg)
 	HandleFinalize  func(*nats.Msg)
 	HandleStatsReq  func(*nats.Msg)
-	HandleStatsData func(*nats.Msg)
+	HandleStatusReq func(*nats.Msg)
+	HandleSyncReq   func(*nats.Msg)
 }
 
 // Register wires the monitor module into the provided registry.
 func Register(reg *router.Registry, deps Dependencies) {
-	reg.Register("IBPMonitor", module{deps: deps})
+	reg.Register(core.RoleMonitor, module{deps: deps})
 }
 
 type module struct {
@@ -34,42 +34,21 @@ type module struct {
 
 func (module) Name() string { return "monitor-core" }
 
-func (m module) Handle(msg *nats.Msg) bool {
-	subj := msg.Subject
-
-	switch subj {
-	case subjects.MonitorStatsRequest:
-		if m.deps.HandleStatsReq != nil {
-			m.deps.HandleStatsReq(msg)
-			return true
-		}
-	}
-
-	if strings.Contains(subj, "downtimeReply") && m.deps.HandleStatsData != nil {
-		m.deps.HandleStatsData(msg)
-		return true
-	}
-
+// Subscriptions lists the monitor's subjects. Every monitor must see every
+// consensus message and answer every downtime and status request (the
+// requester waits for one reply per monitor), so none of them use a queue group. Official
+// sync requests reach every monitor too: those without results yet stay
+// silent and the requester takes the first reply.
+func (m module) Subscriptions() []router.Subscription {
 	propose, vote, finalize := m.subjectStrings()
-	switch subj {
-	case propose:
-		if m.deps.HandleProposal != nil {
-			m.deps.HandleProposal(msg)
-			return true
-		}
-	case vote:
-		if m.deps.HandleVote != nil {
-			m.deps.HandleVote(msg)
-			return true
-		}
-	case finalize:
-		if m.deps.HandleFinalize != nil {
-			m.deps.HandleFinalize(msg)
-			return true
-		}
+	return []router.Subscription{
+		{Subject: propose, Handler: m.deps.HandleProposal},
+		{Subject: vote, Handler: m.deps.HandleVote},
+		{Subject: finalize, Handler: m.deps.HandleFinalize},
+		{Subject: subjects.With(subjects.MonitorStatsRequest), Handler: m.deps.HandleStatsReq},
+		{Subject: subjects.With(subjects.MonitorStatusRequest), Handler: m.deps.HandleStatusReq},
+		{Subject: subjects.With(subjects.MonitorOfficialSync), Handler: m.deps.HandleSyncReq},
 	}
-
-	return false
 }
 
 func (m module) subjectStrings() (string, string, string) {
@@ -0,0 +1,100 @@
+package nodestatus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core/fanout"
+	"github.com/ibp-network/ibp-geodns-libs/tracing"
+
+	"github.com/nats-io/nats.go"
+)
+
+type Dependencies struct {
+	State               *core.NodeState
+	PublishMsgWithReply func(subject, reply string, data []byte) error
+	PublishMsg          func(msg *nats.Msg) error // optional; carries trace and correlation headers
+	Subscribe           func(subject string, cb func(*nats.Msg)) (*nats.Subscription, error)
+	ActiveNodes         func() []string
+	Collect             func() core.NodeStatusResponse
+}
+
+// Report is the outcome of a node status fan-out: one status per node that
+// answered and how each active node replied.
+type Report struct {
+	Statuses []core.NodeStatusResponse `json:"statuses"`
+	Nodes    []fanout.NodeStatus       `json:"nodes"`
+	Complete bool                      `json:"complete"`
+}
+
+func HandleRequest(deps Dependencies, reply string) {
+	HandleRequestContext(context.Background(), deps, reply)
+}
+
+// HandleRequestContext answers a node status request on reply.
+func HandleRequestContext(ctx context.Context, deps Dependencies, reply string) {
+	ctx, span := tracing.Start(core.EnsureCorrelationID(ctx), "cluster.nodestatus.serve", tracing.KindServer)
+	defer span.End()
+
+	if reply == "" {
+		log.LogCtx(ctx, log.Warn, "[NATS] handleNodeStatusRequest: missing reply inbox")
+		return
+	}
+
+	status := deps.Collect()
+	payload, err := json.Marshal(status)
+	if err != nil {
+		log.LogCtx(ctx, log.Error, "[NATS] handleNodeStatusRequest: marshal error: %v", err)
+		return
+	}
+	if err := core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, reply, "", payload); err != nil {
+		log.LogCtx(ctx, log.Error, "[NATS] handleNodeStatusRequest: reply error: %v", err)
+	}
+}
+
+// RequestAll asks every active node of the cluster for its status.
+func RequestAll(deps Dependencies, timeout time.Duration, subject string) (Report, error) {
+	ctx, span := tracing.Start(core.EnsureCorrelationID(context.Background()), "cluster.nodestatus.request", tracing.KindClient)
+	defer span.End()
+
+	nodes := deps.ActiveNodes()
+	if len(nodes) == 0 {
+		return Report{}, fmt.Errorf("%w in the cluster", errdefs.ErrNoActiveNodes)
+	}
+
+	res, err := fanout.RequestWith(ctx, transport(deps), subject, struct{}{}, fanout.Options[core.NodeStatusResponse]{
+		Timeout:   timeout,
+		Nodes:     nodes,
+		Responder: func(resp core.NodeStatusResponse) string { return resp.NodeID },
+		Failure:   func(resp core.NodeStatusResponse) string { return resp.Error },
+	})
+	if err != nil {
+		span.RecordError(err)
+		return Report{}, err
+	}
+
+	log.LogCtx(ctx, log.Debug, "[NATS] RequestAllNodeStatus: %d/%d nodes replied",
+		len(res.Responses), len(nodes))
+
+	return Report{
+		Statuses: res.Values(),
+		Nodes:    res.Statuses(),
+		Complete: res.Complete,
+	}, nil
+}
+
+// transport adapts deps to the fan-out helper.
+func transport(deps Dependencies) fanout.Transport {
+	return fanout.Transport{
+		NodeID:    deps.State.NodeID,
+		Subscribe: deps.Subscribe,
+		Publish: func(ctx context.Context, subject, reply string, data []byte) error {
+			return core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, subject, reply, data)
+		},
+	}
+}
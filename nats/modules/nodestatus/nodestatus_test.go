@@ -0,0 +1,104 @@
+package nodestatus
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestHandleRequestRepliesWithCollectedStatus(t *testing.T) {
+	var (
+		gotReply string
+		gotData  []byte
+	)
+	deps := Dependencies{
+		State: &core.NodeState{NodeID: "dns-a"},
+		PublishMsgWithReply: func(subject, reply string, data []byte) error {
+			gotReply, gotData = subject, data
+			return nil
+		},
+		Collect: func() core.NodeStatusResponse {
+			return core.NodeStatusResponse{NodeID: "dns-a", Version: "v1", Subscriptions: 3}
+		},
+	}
+
+	HandleRequest(deps, "_INBOX.x")
+
+	if gotReply != "_INBOX.x" {
+		t.Fatalf("expected reply on inbox, got %q", gotReply)
+	}
+	var status core.NodeStatusResponse
+	if err := json.Unmarshal(gotData, &status); err != nil {
+		t.Fatalf("decode reply: %v", err)
+	}
+	if status.NodeID != "dns-a" || status.Version != "v1" || status.Subscriptions != 3 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestHandleRequestIgnoresMissingReply(t *testing.T) {
+	deps := Dependencies{
+		State: &core.NodeState{NodeID: "dns-a"},
+		PublishMsgWithReply: func(string, string, []byte) error {
+			t.Fatal("expected no publish without a reply inbox")
+			return nil
+		},
+		Collect: func() core.NodeStatusResponse { return core.NodeStatusResponse{} },
+	}
+	HandleRequest(deps, "")
+}
+
+func TestRequestAllReportsSilentNodes(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		handler func(*nats.Msg)
+	)
+	deps := Dependencies{
+		State:       &core.NodeState{NodeID: "collator-a"},
+		ActiveNodes: func() []string { return []string{"dns-a", "monitor-a"} },
+		Subscribe: func(subject string, cb func(*nats.Msg)) (*nats.Subscription, error) {
+			mu.Lock()
+			handler = cb
+			mu.Unlock()
+			return &nats.Subscription{Subject: subject}, nil
+		},
+		PublishMsgWithReply: func(subject, reply string, data []byte) error {
+			go func() {
+				payload, _ := json.Marshal(core.NodeStatusResponse{NodeID: "dns-a", NodeRole: "IBPDns"})
+				mu.Lock()
+				h := handler
+				mu.Unlock()
+				h(&nats.Msg{Data: payload})
+			}()
+			return nil
+		},
+	}
+
+	report, err := RequestAll(deps, 100*time.Millisecond, "cluster.nodeStatus")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if report.Complete || len(report.Statuses) != 1 || report.Statuses[0].NodeRole != "IBPDns" {
+		t.Fatalf("expected one status from dns-a, got %+v", report)
+	}
+	if len(report.Nodes) != 2 || report.Nodes[1].NodeID != "monitor-a" || report.Nodes[1].Replied {
+		t.Fatalf("expected monitor-a reported as silent, got %+v", report.Nodes)
+	}
+}
+
+func TestRequestAllRequiresActiveNodes(t *testing.T) {
+	deps := Dependencies{
+		State:       &core.NodeState{NodeID: "collator-a"},
+		ActiveNodes: func() []string { return nil },
+	}
+	if _, err := RequestAll(deps, time.Second, "cluster.nodeStatus"); !errors.Is(err, errdefs.ErrNoActiveNodes) {
+		t.Fatalf("expected ErrNoActiveNodes without active nodes, got %v", err)
+	}
+}
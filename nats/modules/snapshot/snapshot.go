@@ -0,0 +1,171 @@
+// Package snapshot pushes the official results from monitors to DNS nodes,
+// which take no part in consensus and would otherwise only learn the
+// official state from finalize messages. One monitor broadcasts a full
+// snapshot periodically and every ready monitor answers a sync request, so
+// a freshly started DNS node converges within seconds.
+//
+// Each snapshot carries its sender's epoch (process start) and a sequence
+// number. A DNS node applies a snapshot only when it is newer than the last
+// one it applied from the same sender, so duplicated or reordered messages
+// never roll the state back.
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/tracing"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Message is one official snapshot on the wire.
+type Message struct {
+	NodeID      string       `json:"nodeID"`
+	Epoch       int64        `json:"epoch"` // sender start, Unix nanoseconds
+	Seq         uint64       `json:"seq"`
+	GeneratedAt time.Time    `json:"generatedAt"`
+	Snapshot    dat.Snapshot `json:"snapshot"`
+}
+
+type Dependencies struct {
+	State               *core.NodeState
+	Publish             func(subject string, data []byte) error
+	PublishMsg          func(msg *nats.Msg) error // optional; carries trace and correlation headers
+	PublishMsgWithReply func(subject, reply string, data []byte) error
+	MarkNodeHeard       func(string)
+	Subject             string
+
+	// Sequencer numbers this monitor's snapshots and Snapshot returns its
+	// official results (monitors).
+	Sequencer *core.Sequencer
+	Snapshot  func() dat.Snapshot
+	// Tracker filters stale snapshots and Apply installs the accepted ones
+	// (DNS nodes). OnGap is told how many snapshots of a sender were
+	// missed; optional.
+	Tracker *core.SeqTracker
+	Apply   func(dat.Snapshot)
+	OnGap   func(sender string, missed uint64)
+}
+
+// SyncRequest asks the monitors for their official results.
+type SyncRequest struct {
+	NodeID string `json:"nodeID"`
+}
+
+// -----------------------------------------------------------------------------
+// MONITORS
+// -----------------------------------------------------------------------------
+
+// Build numbers the current official results. It returns false while they
+// are empty, so a monitor that has not learned the state yet never wipes
+// the DNS nodes'.
+func Build(deps Dependencies) (Message, bool) {
+	snap := deps.Snapshot()
+	if len(snap.SiteResults)+len(snap.DomainResults)+len(snap.EndpointResults) == 0 {
+		return Message{}, false
+	}
+	epoch, seq := deps.Sequencer.Next()
+	return Message{
+		NodeID:      deps.State.NodeID,
+		Epoch:       epoch,
+		Seq:         seq,
+		GeneratedAt: time.Now().UTC(),
+		Snapshot:    snap,
+	}, true
+}
+
+// Publish broadcasts the official results on deps.Subject. It reports
+// whether a snapshot was sent.
+func Publish(deps Dependencies) (bool, error) {
+	ctx, span := tracing.Start(core.EnsureCorrelationID(context.Background()), "monitor.official.snapshot", tracing.KindProducer)
+	defer span.End()
+
+	msg, ok := Build(deps)
+	if !ok {
+		return false, nil
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return false, fmt.Errorf("marshal official snapshot: %w", err)
+	}
+	if err := core.PublishCtx(ctx, deps.PublishMsg, core.NoReply(deps.Publish), deps.Subject, "", payload); err != nil {
+		span.RecordError(err)
+		return false, fmt.Errorf("publish official snapshot: %w", err)
+	}
+	return true, nil
+}
+
+// HandleSyncRequest answers a sync request with the official results.
+// Monitors without results stay silent and leave the request to the
+// others, as does the requester itself when it is a monitor.
+func HandleSyncRequest(ctx context.Context, deps Dependencies, data []byte, reply string) {
+	if reply == "" {
+		log.LogCtx(ctx, log.Warn, "[NATS] official sync request without reply inbox")
+		return
+	}
+	var req SyncRequest
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			log.LogCtx(ctx, log.Warn, "[NATS] official sync request: unmarshal error: %v", err)
+			return
+		}
+	}
+	if req.NodeID != "" && req.NodeID == deps.State.NodeID {
+		return
+	}
+	msg, ok := Build(deps)
+	if !ok {
+		log.LogCtx(ctx, log.Debug, "[NATS] official sync request ignored: no official results yet")
+		return
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.LogCtx(ctx, log.Error, "[NATS] official sync marshal error: %v", err)
+		return
+	}
+	if err := deps.PublishMsgWithReply(reply, "", payload); err != nil {
+		log.LogCtx(ctx, log.Error, "[NATS] official sync reply error: %v", err)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// DNS NODES
+// -----------------------------------------------------------------------------
+
+// Handle decodes a snapshot, broadcast or sync reply, and applies it unless
+// it is stale. It reports whether the snapshot was applied.
+func Handle(ctx context.Context, deps Dependencies, data []byte) (bool, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return false, fmt.Errorf("unmarshal official snapshot: %w", err)
+	}
+	if msg.NodeID == "" {
+		return false, fmt.Errorf("official snapshot without node ID")
+	}
+	if deps.MarkNodeHeard != nil {
+		deps.MarkNodeHeard(msg.NodeID)
+	}
+
+	ok, missed := deps.Tracker.Observe(msg.NodeID, msg.Epoch, msg.Seq)
+	if !ok {
+		log.LogCtx(ctx, log.Debug, "[NATS] stale official snapshot from %s (epoch=%d seq=%d) dropped",
+			msg.NodeID, msg.Epoch, msg.Seq)
+		return false, nil
+	}
+	if missed > 0 {
+		log.LogCtx(ctx, log.Debug, "[NATS] missed %d official snapshot(s) from %s", missed, msg.NodeID)
+		if deps.OnGap != nil {
+			deps.OnGap(msg.NodeID, missed)
+		}
+	}
+	deps.Apply(msg.Snapshot)
+	log.LogCtx(ctx, log.Debug, "[NATS] applied official snapshot from %s seq=%d (%d site, %d domain, %d endpoint)",
+		msg.NodeID, msg.Seq, len(msg.Snapshot.SiteResults), len(msg.Snapshot.DomainResults), len(msg.Snapshot.EndpointResults))
+	return true, nil
+}
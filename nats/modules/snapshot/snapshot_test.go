@@ -0,0 +1,111 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+)
+
+func sampleSnapshot() dat.Snapshot {
+	return dat.Snapshot{SiteResults: []dat.SiteResult{{
+		Check:   cfg.Check{Name: "ping"},
+		Results: []dat.Result{{Member: cfg.Member{Details: cfg.MemberDetails{Name: "member-1"}}, Status: true}},
+	}}}
+}
+
+func TestPublishSkipsEmptyResults(t *testing.T) {
+	published := 0
+	deps := Dependencies{
+		State:     &core.NodeState{NodeID: "mon-a"},
+		Publish:   func(string, []byte) error { published++; return nil },
+		Sequencer: core.NewSequencer(),
+		Snapshot:  func() dat.Snapshot { return dat.Snapshot{} },
+	}
+	if sent, err := Publish(deps); err != nil || sent || published != 0 {
+		t.Fatalf("expected nothing published, got sent=%v err=%v published=%d", sent, err, published)
+	}
+
+	var got []Message
+	deps.Snapshot = sampleSnapshot
+	deps.Publish = func(_ string, data []byte) error {
+		var m Message
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		got = append(got, m)
+		return nil
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := Publish(deps); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	if len(got) != 2 || got[0].Seq != 1 || got[1].Seq != 2 || got[0].Epoch != got[1].Epoch || got[0].NodeID != "mon-a" {
+		t.Fatalf("expected two sequenced snapshots from mon-a, got %+v", got)
+	}
+}
+
+func TestHandleAppliesOnlyNewerSnapshots(t *testing.T) {
+	var applied []dat.Snapshot
+	var gaps uint64
+	heard := ""
+	deps := Dependencies{
+		State:         &core.NodeState{NodeID: "dns-a"},
+		MarkNodeHeard: func(id string) { heard = id },
+		Tracker:       core.NewSeqTracker(),
+		Apply:         func(s dat.Snapshot) { applied = append(applied, s) },
+		OnGap:         func(_ string, missed uint64) { gaps += missed },
+	}
+	payload := func(seq uint64) []byte {
+		b, _ := json.Marshal(Message{NodeID: "mon-a", Epoch: 1, Seq: seq, Snapshot: sampleSnapshot()})
+		return b
+	}
+
+	// 3 and 4 count as missed once 69 pushes them out of the reorder window.
+	for _, seq := range []uint64{2, 1, 2, 5, 69} {
+		if _, err := Handle(context.Background(), deps, payload(seq)); err != nil {
+			t.Fatalf("handle seq %d: %v", seq, err)
+		}
+	}
+	if len(applied) != 3 || heard != "mon-a" || gaps != 2 {
+		t.Fatalf("expected seq 2, 5 and 69 applied from mon-a with 2 missed, got %d applied, %d missed (heard %q)",
+			len(applied), gaps, heard)
+	}
+	if len(applied[0].SiteResults) != 1 || applied[0].SiteResults[0].Results[0].Member.Details.Name != "member-1" {
+		t.Fatalf("expected the snapshot to survive the round trip, got %+v", applied[0])
+	}
+
+	if _, err := Handle(context.Background(), deps, []byte(`{"seq":4}`)); err == nil {
+		t.Fatal("expected a snapshot without node ID to be rejected")
+	}
+}
+
+func TestHandleSyncRequestRepliesWhenReady(t *testing.T) {
+	var replies []string
+	deps := Dependencies{
+		State:     &core.NodeState{NodeID: "mon-a"},
+		Sequencer: core.NewSequencer(),
+		Snapshot:  func() dat.Snapshot { return dat.Snapshot{} },
+		PublishMsgWithReply: func(subject, _ string, _ []byte) error {
+			replies = append(replies, subject)
+			return nil
+		},
+	}
+	HandleSyncRequest(context.Background(), deps, nil, "_INBOX.1")
+	if len(replies) != 0 {
+		t.Fatalf("expected a monitor without results to stay silent, got %v", replies)
+	}
+	deps.Snapshot = sampleSnapshot
+	HandleSyncRequest(context.Background(), deps, []byte(`{"nodeID":"mon-a"}`), "_INBOX.2")
+	if len(replies) != 0 {
+		t.Fatalf("expected a monitor not to answer its own request, got %v", replies)
+	}
+	HandleSyncRequest(context.Background(), deps, []byte(`{"nodeID":"dns-a"}`), "_INBOX.3")
+	if len(replies) != 1 || replies[0] != "_INBOX.3" {
+		t.Fatalf("expected a reply to _INBOX.3, got %v", replies)
+	}
+}
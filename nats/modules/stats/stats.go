@@ -1,14 +1,17 @@
 package stats
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"sync"
 	"time"
 
 	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
 	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core/fanout"
+	"github.com/ibp-network/ibp-geodns-libs/tracing"
 
 	"github.com/nats-io/nats.go"
 )
@@ -17,51 +20,62 @@ type Dependencies struct {
 	State               *core.NodeState
 	Publish             func(subject string, data []byte) error
 	PublishMsgWithReply func(subject, reply string, data []byte) error
+	PublishMsg          func(msg *nats.Msg) error // optional; carries trace and correlation headers
 	Subscribe           func(subject string, cb func(*nats.Msg)) (*nats.Subscription, error)
 	CountActiveMonitors func() int
+	ActiveMonitorNodes  func() []string // optional; lets RequestAll report silent nodes
 	MarkNodeHeard       func(string)
 	StatsDataSubject    string
 }
 
 func HandleRequest(deps Dependencies, reply string, data []byte) {
+	HandleRequestContext(context.Background(), deps, reply, data)
+}
+
+// HandleRequestContext serves a request whose trace context, if any, has
+// already been extracted into ctx.
+func HandleRequestContext(ctx context.Context, deps Dependencies, reply string, data []byte) {
+	ctx, span := tracing.Start(core.EnsureCorrelationID(ctx), "stats.downtime.serve", tracing.KindServer)
+	defer span.End()
+
 	if reply == "" {
-		log.Log(log.Warn, "[NATS] handleMonitorStatsRequest: missing reply inbox; refusing to broadcast downtime data")
+		log.LogCtx(ctx, log.Warn, "[NATS] handleMonitorStatsRequest: missing reply inbox; refusing to broadcast downtime data")
 		return
 	}
 
 	var req core.DowntimeRequest
 	if err := json.Unmarshal(data, &req); err != nil {
-		log.Log(log.Error, "[NATS] handleMonitorStatsRequest: unmarshal error: %v", err)
+		log.LogCtx(ctx, log.Error, "[NATS] handleMonitorStatsRequest: unmarshal error: %v", err)
 		errResp := core.DowntimeResponse{
 			NodeID: deps.State.NodeID,
 			Events: []core.DowntimeEvent{},
 			Error:  fmt.Sprintf("unmarshal error: %v", err),
 		}
 		if payload, err := json.Marshal(errResp); err == nil {
-			_ = deps.PublishMsgWithReply(reply, "", payload)
+			_ = core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, reply, "", payload)
 		}
 		return
 	}
 
-	log.Log(log.Debug, "[NATS] handleMonitorStatsRequest: StartTime=%v EndTime=%v MemberName=%s",
+	log.LogCtx(ctx, log.Debug, "[NATS] handleMonitorStatsRequest: StartTime=%v EndTime=%v MemberName=%s",
 		req.StartTime, req.EndTime, req.MemberName)
 
 	if req.EndTime.Before(req.StartTime) {
-		log.Log(log.Error, "[NATS] handleMonitorStatsRequest: EndTime before StartTime")
+		log.LogCtx(ctx, log.Error, "[NATS] handleMonitorStatsRequest: EndTime before StartTime")
 		errResp := core.DowntimeResponse{
 			NodeID: deps.State.NodeID,
 			Events: []core.DowntimeEvent{},
 			Error:  "EndTime must be after StartTime",
 		}
 		if payload, err := json.Marshal(errResp); err == nil {
-			_ = deps.PublishMsgWithReply(reply, "", payload)
+			_ = core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, reply, "", payload)
 		}
 		return
 	}
 
 	events, err := retrieveLocalDowntimeEvents(req.MemberName, req.StartTime, req.EndTime)
 	if err != nil {
-		log.Log(log.Error, "[NATS] handleMonitorStatsRequest: error retrieving local downtime: %v", err)
+		log.LogCtx(ctx, log.Error, "[NATS] handleMonitorStatsRequest: error retrieving local downtime: %v", err)
 		events = []core.DowntimeEvent{}
 	}
 
@@ -71,115 +85,101 @@ func HandleRequest(deps Dependencies, reply string, data []byte) {
 	}
 	payload, err := json.Marshal(resp)
 	if err != nil {
-		log.Log(log.Error, "[NATS] handleMonitorStatsRequest: marshal error: %v", err)
+		log.LogCtx(ctx, log.Error, "[NATS] handleMonitorStatsRequest: marshal error: %v", err)
 		return
 	}
 
-	log.Log(log.Debug,
+	log.LogCtx(ctx, log.Debug,
 		"[NATS] handleMonitorStatsRequest: replying to %s with %d events",
 		reply, len(events))
-	_ = deps.PublishMsgWithReply(reply, "", payload)
+	_ = core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, reply, "", payload)
 }
 
 func HandleData(deps Dependencies, data []byte) {
+	HandleDataContext(context.Background(), deps, data)
+}
+
+// HandleDataContext is HandleData for a message whose correlation ID has been
+// extracted into ctx.
+func HandleDataContext(ctx context.Context, deps Dependencies, data []byte) {
 	var resp core.DowntimeResponse
 	if err := json.Unmarshal(data, &resp); err != nil {
-		log.Log(log.Error, "[NATS] handleMonitorStatsData: unmarshal error: %v", err)
+		log.LogCtx(ctx, log.Error, "[NATS] handleMonitorStatsData: unmarshal error: %v", err)
 		return
 	}
 	if deps.MarkNodeHeard != nil {
 		deps.MarkNodeHeard(resp.NodeID)
 	}
-	log.Log(log.Debug, "[NATS] handleMonitorStatsData: got %d downtime events from node=%s",
+	log.LogCtx(ctx, log.Debug, "[NATS] handleMonitorStatsData: got %d downtime events from node=%s",
 		len(resp.Events), resp.NodeID)
 }
 
+// Report is the outcome of a downtime fan-out: the concatenated events and
+// how each monitor answered.
+type Report struct {
+	Events   []core.DowntimeEvent `json:"events"`
+	Nodes    []fanout.NodeStatus  `json:"nodes"`
+	Complete bool                 `json:"complete"`
+}
+
 func RequestAll(deps Dependencies, req core.DowntimeRequest, timeout time.Duration, subject string) ([]core.DowntimeEvent, error) {
-	monitorCount := deps.CountActiveMonitors()
-	if monitorCount == 0 {
-		return nil, fmt.Errorf("no active IBPMonitor nodes found")
+	report, err := RequestAllDetailed(deps, req, timeout, 0, subject)
+	if err != nil {
+		return nil, err
 	}
+	return report.Events, nil
+}
 
-	log.Log(log.Debug, "[NATS] RequestAllMonitorsDowntime: requesting from %d active monitors", monitorCount)
+// RequestAllDetailed asks every active monitor for downtime events. It
+// returns as soon as the last monitor replies; monitors still missing at
+// timeout get grace more time before they are reported as failed.
+func RequestAllDetailed(deps Dependencies, req core.DowntimeRequest, timeout, grace time.Duration, subject string) (Report, error) {
+	ctx, span := tracing.Start(core.EnsureCorrelationID(context.Background()), "stats.downtime.request", tracing.KindClient)
+	defer span.End()
 
-	payload, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("downtime request marshal error: %w", err)
+	opts := fanout.Options[core.DowntimeResponse]{
+		Timeout:   timeout,
+		Grace:     grace,
+		Responder: func(resp core.DowntimeResponse) string { return resp.NodeID },
+		Failure:   func(resp core.DowntimeResponse) string { return resp.Error },
+	}
+	if deps.ActiveMonitorNodes != nil {
+		opts.Nodes = deps.ActiveMonitorNodes()
+	} else {
+		opts.Expected = deps.CountActiveMonitors()
+	}
+	if len(opts.Nodes) == 0 && opts.Expected == 0 {
+		return Report{}, fmt.Errorf("%w of role %s", errdefs.ErrNoActiveNodes, core.RoleMonitor)
 	}
 
-	inbox := fmt.Sprintf("_INBOX.%s.downtimeReply.%d", deps.State.NodeID, time.Now().UnixNano())
-	responseMap := make(map[string][]core.DowntimeEvent)
-	var mu sync.Mutex
-
-	sub, err := deps.Subscribe(inbox, func(msg *nats.Msg) {
-		var resp core.DowntimeResponse
-		if err := json.Unmarshal(msg.Data, &resp); err != nil {
-			log.Log(log.Error, "[NATS] RequestAllMonitorsDowntime: unmarshal error: %v", err)
-			return
-		}
+	log.LogCtx(ctx, log.Debug, "[NATS] RequestAllMonitorsDowntime: requesting from %d active monitors",
+		max(len(opts.Nodes), opts.Expected))
 
-		mu.Lock()
-		if _, exists := responseMap[resp.NodeID]; !exists {
-			responseMap[resp.NodeID] = resp.Events
-			log.Log(log.Debug, "[NATS] RequestAllMonitorsDowntime: received %d events from %s",
-				len(resp.Events), resp.NodeID)
-		} else {
-			log.Log(log.Warn, "[NATS] RequestAllMonitorsDowntime: duplicate response from %s ignored", resp.NodeID)
-		}
-		mu.Unlock()
-	})
+	res, err := fanout.RequestWith(ctx, transport(deps), subject, req, opts)
 	if err != nil {
-		return nil, fmt.Errorf("subscribe error: %w", err)
-	}
-	defer sub.Unsubscribe()
-
-	if err := deps.PublishMsgWithReply(subject, inbox, payload); err != nil {
-		return nil, fmt.Errorf("publish downtime request error: %w", err)
-	}
-
-	timer := time.NewTimer(timeout)
-	defer timer.Stop()
-
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-timer.C:
-			mu.Lock()
-			receivedCount := len(responseMap)
-			mu.Unlock()
-			log.Log(log.Warn,
-				"[NATS] RequestAllMonitorsDowntime: timeout after receiving %d/%d responses",
-				receivedCount, monitorCount)
-			goto done
-		case <-ticker.C:
-			mu.Lock()
-			if len(responseMap) >= monitorCount {
-				mu.Unlock()
-				log.Log(log.Debug, "[NATS] RequestAllMonitorsDowntime: received all %d responses", monitorCount)
-				goto done
-			}
-			mu.Unlock()
-		}
+		span.RecordError(err)
+		return Report{}, err
 	}
 
-done:
-	mu.Lock()
-	defer mu.Unlock()
-
-	aggregated := make([]core.DowntimeEvent, 0)
-	for nodeID, events := range responseMap {
-		log.Log(log.Debug, "[NATS] RequestAllMonitorsDowntime: aggregating %d events from %s",
-			len(events), nodeID)
-		aggregated = append(aggregated, events...)
+	report := Report{
+		Events:   make([]core.DowntimeEvent, 0),
+		Nodes:    res.Statuses(),
+		Complete: res.Complete,
+	}
+	for _, resp := range res.Values() {
+		log.LogCtx(ctx, log.Debug, "[NATS] RequestAllMonitorsDowntime: aggregating %d events from %s",
+			len(resp.Events), resp.NodeID)
+		report.Events = append(report.Events, resp.Events...)
+	}
+	for _, st := range res.Failed() {
+		log.LogCtx(ctx, log.Warn, "[NATS] RequestAllMonitorsDowntime: node %s failed: %s", st.NodeID, st.Error)
 	}
 
-	log.Log(log.Debug,
+	log.LogCtx(ctx, log.Debug,
 		"[NATS] RequestAllMonitorsDowntime: completed with %d total events from %d nodes",
-		len(aggregated), len(responseMap))
+		len(report.Events), len(res.Responses))
 
-	return aggregated, nil
+	return report, nil
 }
 
 func retrieveLocalDowntimeEvents(memberName string, start, end time.Time) ([]core.DowntimeEvent, error) {
@@ -207,6 +207,8 @@ func retrieveLocalDowntimeEvents(memberName string, start, end time.Time) ([]cor
 				ErrorText:  e.ErrorText,
 				Data:       e.Data,
 				IsIPv6:     e.IsIPv6,
+				Votes:      e.Votes,
+				LatencyMs:  float64(dat.LatencyFromData(e.Data)) / float64(time.Millisecond),
 			})
 		}
 	}
@@ -217,3 +219,14 @@ func retrieveLocalDowntimeEvents(memberName string, start, end time.Time) ([]cor
 
 	return results, nil
 }
+
+// transport adapts deps to the fan-out helper.
+func transport(deps Dependencies) fanout.Transport {
+	return fanout.Transport{
+		NodeID:    deps.State.NodeID,
+		Subscribe: deps.Subscribe,
+		Publish: func(ctx context.Context, subject, reply string, data []byte) error {
+			return core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, subject, reply, data)
+		},
+	}
+}
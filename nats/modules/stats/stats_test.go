@@ -1,8 +1,11 @@
 package stats
 
 import (
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
 	"github.com/ibp-network/ibp-geodns-libs/nats/core"
 )
 
@@ -33,3 +36,14 @@ func TestHandleRequestRequiresReplyInbox(t *testing.T) {
 		t.Fatal("expected missing-reply request not to send a reply")
 	}
 }
+
+func TestRequestAllDetailedRequiresActiveMonitors(t *testing.T) {
+	deps := Dependencies{
+		State:               &core.NodeState{NodeID: "collator-a"},
+		CountActiveMonitors: func() int { return 0 },
+	}
+	_, err := RequestAllDetailed(deps, core.DowntimeRequest{}, time.Second, 0, "stats.downtime")
+	if !errors.Is(err, errdefs.ErrNoActiveNodes) {
+		t.Fatalf("expected ErrNoActiveNodes, got %v", err)
+	}
+}
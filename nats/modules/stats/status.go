@@ -0,0 +1,179 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core/fanout"
+	"github.com/ibp-network/ibp-geodns-libs/tracing"
+)
+
+// -----------------------------------------------------------------------------
+// CURRENT STATUS
+// -----------------------------------------------------------------------------
+//
+// Downtime requests return history; a "current health" view would have to
+// replay it. A status request returns each monitor's official results as
+// they stand instead, one entry per member check, and the requester keeps
+// for every check the entry its monitors confirmed last.
+
+// officialResults is replaceable for tests.
+var officialResults = dat.GetOfficialResults
+
+// HandleStatusRequestContext answers a status request with this monitor's
+// official results.
+func HandleStatusRequestContext(ctx context.Context, deps Dependencies, reply string, data []byte) {
+	ctx, span := tracing.Start(core.EnsureCorrelationID(ctx), "stats.status.serve", tracing.KindServer)
+	defer span.End()
+
+	if reply == "" {
+		log.LogCtx(ctx, log.Warn, "[NATS] handleMonitorStatusRequest: missing reply inbox; refusing to broadcast status")
+		return
+	}
+
+	resp := core.StatusResponse{NodeID: deps.State.NodeID, Statuses: []core.MemberCheckStatus{}}
+	var req core.StatusRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		log.LogCtx(ctx, log.Error, "[NATS] handleMonitorStatusRequest: unmarshal error: %v", err)
+		resp.Error = fmt.Sprintf("unmarshal error: %v", err)
+	} else {
+		resp.Statuses = localStatuses(req.MemberName)
+	}
+
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.LogCtx(ctx, log.Error, "[NATS] handleMonitorStatusRequest: marshal error: %v", err)
+		return
+	}
+	log.LogCtx(ctx, log.Debug, "[NATS] handleMonitorStatusRequest: replying to %s with %d statuses",
+		reply, len(resp.Statuses))
+	_ = core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, reply, "", payload)
+}
+
+// localStatuses flattens the official results, of member when set.
+func localStatuses(member string) []core.MemberCheckStatus {
+	sites, domains, endpoints := officialResults()
+
+	out := make([]core.MemberCheckStatus, 0)
+	add := func(checkType, checkName, domain, endpoint string, isIPv6 bool, results []dat.Result) {
+		for _, r := range results {
+			name := r.Member.Details.Name
+			if member != "" && name != member {
+				continue
+			}
+			out = append(out, core.MemberCheckStatus{
+				MemberName: name,
+				CheckType:  checkType,
+				CheckName:  checkName,
+				DomainName: domain,
+				Endpoint:   endpoint,
+				IsIPv6:     isIPv6 || r.IsIPv6,
+				Status:     r.Status,
+				Checked:    r.Checktime,
+				ErrorText:  r.ErrorText,
+				Stale:      r.Stale,
+			})
+		}
+	}
+	for _, sr := range sites {
+		add("site", sr.Check.Name, "", "", sr.IsIPv6, sr.Results)
+	}
+	for _, dr := range domains {
+		add("domain", dr.Check.Name, dr.Domain, "", dr.IsIPv6, dr.Results)
+	}
+	for _, er := range endpoints {
+		add("endpoint", er.Check.Name, er.Domain, er.RpcUrl, er.IsIPv6, er.Results)
+	}
+	return out
+}
+
+// StatusReport is the outcome of a status fan-out: the current status of
+// every member check and how each monitor answered.
+type StatusReport struct {
+	Statuses []core.MemberCheckStatus `json:"statuses"`
+	Nodes    []fanout.NodeStatus      `json:"nodes"`
+	Complete bool                     `json:"complete"`
+}
+
+// RequestAllStatus asks every active monitor for its current official
+// results and merges them.
+func RequestAllStatus(deps Dependencies, req core.StatusRequest, timeout, grace time.Duration, subject string) (StatusReport, error) {
+	ctx, span := tracing.Start(core.EnsureCorrelationID(context.Background()), "stats.status.request", tracing.KindClient)
+	defer span.End()
+
+	opts := fanout.Options[core.StatusResponse]{
+		Timeout:   timeout,
+		Grace:     grace,
+		Responder: func(resp core.StatusResponse) string { return resp.NodeID },
+		Failure:   func(resp core.StatusResponse) string { return resp.Error },
+	}
+	if deps.ActiveMonitorNodes != nil {
+		opts.Nodes = deps.ActiveMonitorNodes()
+	} else {
+		opts.Expected = deps.CountActiveMonitors()
+	}
+	if len(opts.Nodes) == 0 && opts.Expected == 0 {
+		return StatusReport{}, fmt.Errorf("%w of role %s", errdefs.ErrNoActiveNodes, core.RoleMonitor)
+	}
+
+	res, err := fanout.RequestWith(ctx, transport(deps), subject, req, opts)
+	if err != nil {
+		span.RecordError(err)
+		return StatusReport{}, err
+	}
+	for _, st := range res.Failed() {
+		log.LogCtx(ctx, log.Warn, "[NATS] RequestAllMonitorsStatus: node %s failed: %s", st.NodeID, st.Error)
+	}
+	return StatusReport{
+		Statuses: mergeStatuses(res.Values()),
+		Nodes:    res.Statuses(),
+		Complete: res.Complete,
+	}, nil
+}
+
+// mergeStatuses keeps, for every member check, the most recently confirmed
+// status among the replies, sorted by member and check.
+func mergeStatuses(resps []core.StatusResponse) []core.MemberCheckStatus {
+	type key struct {
+		member, checkType, checkName, domain, endpoint string
+		ipv6                                           bool
+	}
+	latest := make(map[key]core.MemberCheckStatus)
+	for _, resp := range resps {
+		for _, s := range resp.Statuses {
+			k := key{s.MemberName, s.CheckType, s.CheckName, s.DomainName, s.Endpoint, s.IsIPv6}
+			if cur, ok := latest[k]; !ok || s.Checked.After(cur.Checked) {
+				latest[k] = s
+			}
+		}
+	}
+
+	out := make([]core.MemberCheckStatus, 0, len(latest))
+	for _, s := range latest {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.MemberName != b.MemberName:
+			return a.MemberName < b.MemberName
+		case a.CheckType != b.CheckType:
+			return a.CheckType < b.CheckType
+		case a.CheckName != b.CheckName:
+			return a.CheckName < b.CheckName
+		case a.DomainName != b.DomainName:
+			return a.DomainName < b.DomainName
+		case a.Endpoint != b.Endpoint:
+			return a.Endpoint < b.Endpoint
+		}
+		return !a.IsIPv6 && b.IsIPv6
+	})
+	return out
+}
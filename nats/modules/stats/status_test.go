@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+)
+
+func TestHandleStatusRequestRepliesWithMemberResults(t *testing.T) {
+	prev := officialResults
+	defer func() { officialResults = prev }()
+
+	checked := time.Date(2026, 4, 20, 12, 0, 0, 0, time.UTC)
+	member := func(name string) cfg.Member {
+		var m cfg.Member
+		m.Details.Name = name
+		return m
+	}
+	officialResults = func() ([]dat.SiteResult, []dat.DomainResult, []dat.EndpointResult) {
+		return []dat.SiteResult{{
+				Check:   cfg.Check{Name: "ping"},
+				Results: []dat.Result{{Member: member("a"), Status: true, Checktime: checked}, {Member: member("b")}},
+			}},
+			[]dat.DomainResult{{
+				Check:   cfg.Check{Name: "ssl"},
+				Domain:  "rpc.example",
+				Results: []dat.Result{{Member: member("a"), ErrorText: "expired", Checktime: checked}},
+			}},
+			nil
+	}
+
+	var reply []byte
+	deps := Dependencies{
+		State: &core.NodeState{NodeID: "monitor-a"},
+		PublishMsgWithReply: func(subject, _ string, data []byte) error {
+			if subject != "_INBOX.x" {
+				t.Fatalf("reply on %s", subject)
+			}
+			reply = data
+			return nil
+		},
+	}
+	HandleStatusRequestContext(t.Context(), deps, "_INBOX.x", []byte(`{"memberName":"a"}`))
+
+	var resp core.StatusResponse
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.NodeID != "monitor-a" || len(resp.Statuses) != 2 {
+		t.Fatalf("response %+v", resp)
+	}
+	if s := resp.Statuses[1]; s.CheckType != "domain" || s.DomainName != "rpc.example" || s.Status || s.ErrorText != "expired" {
+		t.Fatalf("domain status %+v", s)
+	}
+}
+
+func TestMergeStatusesKeepsLatestConfirmation(t *testing.T) {
+	t0 := time.Date(2026, 4, 20, 12, 0, 0, 0, time.UTC)
+	merged := mergeStatuses([]core.StatusResponse{
+		{NodeID: "m1", Statuses: []core.MemberCheckStatus{
+			{MemberName: "b", CheckType: "site", CheckName: "ping", Status: true, Checked: t0},
+			{MemberName: "a", CheckType: "site", CheckName: "ping", Status: true, Checked: t0},
+		}},
+		{NodeID: "m2", Statuses: []core.MemberCheckStatus{
+			{MemberName: "a", CheckType: "site", CheckName: "ping", Status: false, Checked: t0.Add(time.Minute)},
+		}},
+	})
+	if len(merged) != 2 || merged[0].MemberName != "a" || merged[0].Status || merged[1].MemberName != "b" {
+		t.Fatalf("merged %+v", merged)
+	}
+}
@@ -1,33 +1,55 @@
 package usage
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
-	"sync"
 	"time"
 
 	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
 	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core/fanout"
+	"github.com/ibp-network/ibp-geodns-libs/tracing"
 
 	"github.com/nats-io/nats.go"
 )
 
+// DefaultChunkSize is the chunk size RequestAllDetailed asks DNS nodes for,
+// and the most records a node puts in one chunk. At a few hundred bytes a
+// record a chunk stays well under the 1 MB NATS payload limit.
+const DefaultChunkSize = 2000
+
+// forEachUsageRow reads the local usage rows; tests replace it.
+var forEachUsageRow = dat.ForEachUsageRow
+
 type Dependencies struct {
 	State               *core.NodeState
 	Publish             func(subject string, data []byte) error
 	PublishMsgWithReply func(subject, reply string, data []byte) error
+	PublishMsg          func(msg *nats.Msg) error // optional; carries trace and correlation headers
 	Subscribe           func(subject string, cb func(*nats.Msg)) (*nats.Subscription, error)
 	CountActiveDns      func() int
+	ActiveDnsNodes      func() []string // optional; lets RequestAll report silent nodes
 	MarkNodeHeard       func(string)
 	UsageDataSubject    string
 }
 
 func HandleRequest(deps Dependencies, reply string, data []byte) {
+	HandleRequestContext(context.Background(), deps, reply, data)
+}
+
+// HandleRequestContext serves a request whose trace context, if any, has
+// already been extracted into ctx.
+func HandleRequestContext(ctx context.Context, deps Dependencies, reply string, data []byte) {
+	ctx, span := tracing.Start(core.EnsureCorrelationID(ctx), "usage.records.serve", tracing.KindServer)
+	defer span.End()
+
 	var req core.UsageRequest
 	if err := json.Unmarshal(data, &req); err != nil {
-		log.Log(log.Error, "[NATS] handleDnsUsageRequest: unmarshal error: %v", err)
+		log.LogCtx(ctx, log.Error, "[NATS] handleDnsUsageRequest: unmarshal error: %v", err)
 		if reply != "" {
 			errResp := core.UsageResponse{
 				NodeID:       deps.State.NodeID,
@@ -35,18 +57,18 @@ func HandleRequest(deps Dependencies, reply string, data []byte) {
 				Error:        fmt.Sprintf("unmarshal error: %v", err),
 			}
 			if payload, err := json.Marshal(errResp); err == nil {
-				_ = deps.PublishMsgWithReply(reply, "", payload)
+				_ = core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, reply, "", payload)
 			}
 		}
 		return
 	}
 
-	log.Log(log.Debug,
+	log.LogCtx(ctx, log.Debug,
 		"[NATS] handleDnsUsageRequest: StartDate=%s EndDate=%s Domain=%s MemberName=%s Country=%s",
 		req.StartDate, req.EndDate, req.Domain, req.MemberName, req.Country)
 
 	if req.StartDate > req.EndDate {
-		log.Log(log.Error, "[NATS] handleDnsUsageRequest: StartDate after EndDate")
+		log.LogCtx(ctx, log.Error, "[NATS] handleDnsUsageRequest: StartDate after EndDate")
 		if reply != "" {
 			errResp := core.UsageResponse{
 				NodeID:       deps.State.NodeID,
@@ -54,15 +76,20 @@ func HandleRequest(deps Dependencies, reply string, data []byte) {
 				Error:        "StartDate must be before or equal to EndDate",
 			}
 			if payload, err := json.Marshal(errResp); err == nil {
-				_ = deps.PublishMsgWithReply(reply, "", payload)
+				_ = core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, reply, "", payload)
 			}
 		}
 		return
 	}
 
+	if req.ChunkSize > 0 && reply != "" {
+		serveChunked(ctx, deps, req, reply)
+		return
+	}
+
 	records, err := retrieveLocalUsageRecords(req.StartDate, req.EndDate, req.Domain, req.MemberName, req.Country)
 	if err != nil {
-		log.Log(log.Error,
+		log.LogCtx(ctx, log.Error,
 			"[NATS] handleDnsUsageRequest: retrieveLocalUsageRecords error: %v",
 			err)
 		records = []core.UsageRecord{}
@@ -72,20 +99,28 @@ func HandleRequest(deps Dependencies, reply string, data []byte) {
 		NodeID:       deps.State.NodeID,
 		UsageRecords: records,
 	}
+	if req.UniqueClients {
+		uniques, err := retrieveLocalUniqueClients(deps.State.NodeID, req.StartDate, req.EndDate, req.Domain, req.MemberName)
+		if err != nil {
+			log.LogCtx(ctx, log.Error,
+				"[NATS] handleDnsUsageRequest: retrieveLocalUniqueClients error: %v", err)
+		}
+		resp.UniqueClients = uniques
+	}
 	payload, err := json.Marshal(resp)
 	if err != nil {
-		log.Log(log.Error, "[NATS] handleDnsUsageRequest: marshal error: %v", err)
+		log.LogCtx(ctx, log.Error, "[NATS] handleDnsUsageRequest: marshal error: %v", err)
 		return
 	}
 
 	if reply != "" {
-		log.Log(log.Debug,
+		log.LogCtx(ctx, log.Debug,
 			"[NATS] handleDnsUsageRequest: replying to %s with %d usage records",
 			reply, len(records))
-		_ = deps.PublishMsgWithReply(reply, "", payload)
+		_ = core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, reply, "", payload)
 	} else {
 		if deps.UsageDataSubject != "" {
-			log.Log(log.Debug,
+			log.LogCtx(ctx, log.Debug,
 				"[NATS] handleDnsUsageRequest: publishing usageData with %d usage records",
 				len(records))
 			_ = deps.Publish(deps.UsageDataSubject, payload)
@@ -93,198 +128,230 @@ func HandleRequest(deps Dependencies, reply string, data []byte) {
 	}
 }
 
+// serveChunked streams the requested rows to reply in chunks of at most
+// req.ChunkSize records, so the node holds one chunk at a time however long
+// the range. Chunks are numbered in Part and every chunk but the last has
+// More set; the last one carries the unique clients and, when reading the
+// rows failed part way, the error.
+func serveChunked(ctx context.Context, deps Dependencies, req core.UsageRequest, reply string) {
+	size := min(req.ChunkSize, DefaultChunkSize)
+	chunk := make([]core.UsageRecord, 0, size)
+	chunks, total := 0, 0
+
+	send := func(resp core.UsageResponse) error {
+		resp.Part = chunks
+		payload, err := json.Marshal(resp)
+		if err != nil {
+			return fmt.Errorf("marshal chunk: %w", err)
+		}
+		chunks++
+		total += len(resp.UsageRecords)
+		return core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, reply, "", payload)
+	}
+
+	err := streamLocalUsageRecords(req.StartDate, req.EndDate, req.Domain, req.MemberName, req.Country,
+		func(r core.UsageRecord) error {
+			chunk = append(chunk, r)
+			if len(chunk) < size {
+				return nil
+			}
+			if err := send(core.UsageResponse{NodeID: deps.State.NodeID, UsageRecords: chunk, More: true}); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+			return nil
+		})
+
+	last := core.UsageResponse{NodeID: deps.State.NodeID, UsageRecords: chunk}
+	if err != nil {
+		log.LogCtx(ctx, log.Error, "[NATS] handleDnsUsageRequest: streaming usage records: %v", err)
+		last.Error = err.Error()
+	}
+	if req.UniqueClients {
+		uniques, err := retrieveLocalUniqueClients(deps.State.NodeID, req.StartDate, req.EndDate, req.Domain, req.MemberName)
+		if err != nil {
+			log.LogCtx(ctx, log.Error,
+				"[NATS] handleDnsUsageRequest: retrieveLocalUniqueClients error: %v", err)
+		}
+		last.UniqueClients = uniques
+	}
+	if err := send(last); err != nil {
+		log.LogCtx(ctx, log.Error, "[NATS] handleDnsUsageRequest: sending last chunk: %v", err)
+		return
+	}
+	log.LogCtx(ctx, log.Debug,
+		"[NATS] handleDnsUsageRequest: replied to %s with %d usage records in %d chunks",
+		reply, total, chunks)
+}
+
+// mergeUsage folds a chunk into the chunks of its node before it.
+func mergeUsage(acc, part core.UsageResponse) core.UsageResponse {
+	part.UsageRecords = append(acc.UsageRecords, part.UsageRecords...)
+	part.UniqueClients = append(acc.UniqueClients, part.UniqueClients...)
+	if part.Error == "" {
+		part.Error = acc.Error
+	}
+	return part
+}
+
 func HandleData(deps Dependencies, data []byte) {
+	HandleDataContext(context.Background(), deps, data)
+}
+
+// HandleDataContext is HandleData for a message whose correlation ID has been
+// extracted into ctx.
+func HandleDataContext(ctx context.Context, deps Dependencies, data []byte) {
 	var resp core.UsageResponse
 	if err := json.Unmarshal(data, &resp); err != nil {
-		log.Log(log.Error, "[NATS] handleDnsUsageData: unmarshal error: %v", err)
+		log.LogCtx(ctx, log.Error, "[NATS] handleDnsUsageData: unmarshal error: %v", err)
 		return
 	}
 	if deps.MarkNodeHeard != nil {
 		deps.MarkNodeHeard(resp.NodeID)
 	}
 
-	log.Log(log.Debug, "[NATS] handleDnsUsageData: got %d usage records from node=%s",
+	log.LogCtx(ctx, log.Debug, "[NATS] handleDnsUsageData: got %d usage records from node=%s",
 		len(resp.UsageRecords), resp.NodeID)
 }
 
-func RequestAll(deps Dependencies, req core.UsageRequest, timeout time.Duration, subject string) ([]core.UsageRecord, error) {
-	dnsCount := deps.CountActiveDns()
-	if dnsCount == 0 {
-		return nil, fmt.Errorf("no active IBPDns nodes found")
-	}
-
-	log.Log(log.Debug, "[NATS] RequestAllDnsUsage: requesting from %d active DNS nodes", dnsCount)
+// Report is the outcome of a usage fan-out: the concatenated records and how
+// each DNS node answered.
+type Report struct {
+	Records       []core.UsageRecord        `json:"records"`
+	UniqueClients []core.UniqueClientRecord `json:"uniqueClients,omitempty"`
+	Nodes         []fanout.NodeStatus       `json:"nodes"`
+	Complete      bool                      `json:"complete"`
+}
 
-	data, err := json.Marshal(req)
+func RequestAll(deps Dependencies, req core.UsageRequest, timeout time.Duration, subject string) ([]core.UsageRecord, error) {
+	report, err := RequestAllDetailed(deps, req, timeout, 0, subject)
 	if err != nil {
-		return nil, fmt.Errorf("usage request marshal error: %w", err)
+		return nil, err
 	}
+	return report.Records, nil
+}
 
-	inbox := fmt.Sprintf("_INBOX.%s.usageReply.%d", deps.State.NodeID, time.Now().UnixNano())
-	responseMap := make(map[string][]core.UsageRecord)
-	var mu sync.Mutex
-
-	sub, err := deps.Subscribe(inbox, func(msg *nats.Msg) {
-		var resp core.UsageResponse
-		if err := json.Unmarshal(msg.Data, &resp); err != nil {
-			log.Log(log.Error, "[NATS] RequestAllDnsUsage: unmarshal error: %v", err)
-			return
-		}
-
-		mu.Lock()
-		if _, exists := responseMap[resp.NodeID]; !exists {
-			responseMap[resp.NodeID] = resp.UsageRecords
-			log.Log(log.Debug, "[NATS] RequestAllDnsUsage: received %d records from %s",
-				len(resp.UsageRecords), resp.NodeID)
-		} else {
-			log.Log(log.Warn, "[NATS] RequestAllDnsUsage: duplicate response from %s ignored", resp.NodeID)
-		}
-		mu.Unlock()
-	})
-	if err != nil {
-		return nil, fmt.Errorf("subscribe error: %w", err)
+// RequestAllDetailed asks every active DNS node for usage records. It returns
+// as soon as the last node replies; nodes still missing at timeout get grace
+// more time before they are reported as failed. Unless req says otherwise,
+// nodes answer in chunks of DefaultChunkSize records; nodes that predate
+// chunking answer in one reply.
+func RequestAllDetailed(deps Dependencies, req core.UsageRequest, timeout, grace time.Duration, subject string) (Report, error) {
+	ctx, span := tracing.Start(core.EnsureCorrelationID(context.Background()), "usage.records.request", tracing.KindClient)
+	defer span.End()
+
+	if req.ChunkSize == 0 {
+		req.ChunkSize = DefaultChunkSize
 	}
-	defer sub.Unsubscribe()
-
-	if err := deps.PublishMsgWithReply(subject, inbox, data); err != nil {
-		return nil, fmt.Errorf("publish usage request error: %w", err)
+	opts := fanout.Options[core.UsageResponse]{
+		Timeout:   timeout,
+		Grace:     grace,
+		Responder: func(resp core.UsageResponse) string { return resp.NodeID },
+		Failure:   func(resp core.UsageResponse) string { return resp.Error },
+		Part:      func(resp core.UsageResponse) (int, bool) { return resp.Part, !resp.More },
+		Merge:     mergeUsage,
+	}
+	if deps.ActiveDnsNodes != nil {
+		opts.Nodes = deps.ActiveDnsNodes()
+	} else {
+		opts.Expected = deps.CountActiveDns()
+	}
+	if len(opts.Nodes) == 0 && opts.Expected == 0 {
+		return Report{}, fmt.Errorf("%w of role %s", errdefs.ErrNoActiveNodes, core.RoleDns)
 	}
 
-	timer := time.NewTimer(timeout)
-	defer timer.Stop()
-
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-timer.C:
-			mu.Lock()
-			receivedCount := len(responseMap)
-			mu.Unlock()
-			log.Log(log.Warn,
-				"[NATS] RequestAllDnsUsage: timeout after receiving %d/%d responses",
-				receivedCount, dnsCount)
-			goto done
+	log.LogCtx(ctx, log.Debug, "[NATS] RequestAllDnsUsage: requesting from %d active DNS nodes",
+		max(len(opts.Nodes), opts.Expected))
 
-		case <-ticker.C:
-			mu.Lock()
-			if len(responseMap) >= dnsCount {
-				mu.Unlock()
-				log.Log(log.Debug, "[NATS] RequestAllDnsUsage: received all %d responses", dnsCount)
-				goto done
-			}
-			mu.Unlock()
-		}
+	res, err := fanout.RequestWith(ctx, transport(deps), subject, req, opts)
+	if err != nil {
+		span.RecordError(err)
+		return Report{}, err
 	}
 
-done:
-	mu.Lock()
-	defer mu.Unlock()
-
 	// Do not merge IPv4/IPv6 or nodes; return concatenated records to preserve fidelity.
-	aggregated := make([]core.UsageRecord, 0)
-	for nodeID, records := range responseMap {
-		log.Log(log.Debug, "[NATS] RequestAllDnsUsage: aggregating %d records from %s",
-			len(records), nodeID)
-		aggregated = append(aggregated, records...)
+	report := Report{
+		Records:  make([]core.UsageRecord, 0),
+		Nodes:    res.Statuses(),
+		Complete: res.Complete,
+	}
+	for _, resp := range res.Values() {
+		log.LogCtx(ctx, log.Debug, "[NATS] RequestAllDnsUsage: aggregating %d records from %s",
+			len(resp.UsageRecords), resp.NodeID)
+		report.Records = append(report.Records, resp.UsageRecords...)
+		report.UniqueClients = append(report.UniqueClients, resp.UniqueClients...)
+	}
+	for _, st := range res.Failed() {
+		log.LogCtx(ctx, log.Warn, "[NATS] RequestAllDnsUsage: node %s failed: %s", st.NodeID, st.Error)
 	}
 
-	log.Log(log.Debug,
+	log.LogCtx(ctx, log.Debug,
 		"[NATS] RequestAllDnsUsage: completed with %d records from %d nodes",
-		len(aggregated), len(responseMap))
+		len(report.Records), len(res.Responses))
 
-	return aggregated, nil
+	return report, nil
 }
 
-func retrieveLocalUsageRecords(
-	startDate, endDate, domain, member, country string,
-) ([]core.UsageRecord, error) {
-	log.Log(log.Debug,
-		"[NATS] retrieveLocalUsageRecords: start=%s end=%s domain=%s member=%s country=%s",
-		startDate, endDate, domain, member, country)
-
+func parseUsageDates(startDate, endDate string) (time.Time, time.Time, error) {
 	sd := strings.TrimSpace(startDate)
 	ed := strings.TrimSpace(endDate)
 	if len(sd) != 10 || len(ed) != 10 {
-		return nil, fmt.Errorf("invalid date format, expected YYYY-MM-DD")
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: expected YYYY-MM-DD", errdefs.ErrInvalidDateRange)
 	}
 
 	sTime, err := time.Parse("2006-01-02", sd)
 	if err != nil {
-		return nil, fmt.Errorf("invalid start date: %w", err)
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: start date: %w", errdefs.ErrInvalidDateRange, err)
 	}
 	eTime, err := time.Parse("2006-01-02", ed)
 	if err != nil {
-		return nil, fmt.Errorf("invalid end date: %w", err)
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: end date: %w", errdefs.ErrInvalidDateRange, err)
+	}
+	if err := errdefs.CheckRange(sTime, eTime); err != nil {
+		return time.Time{}, time.Time{}, err
 	}
+	return sTime, eTime, nil
+}
 
-	var results []core.UsageRecord
+// retrieveLocalUniqueClients returns this node's unique-client sketches for
+// the request.
+func retrieveLocalUniqueClients(nodeID, startDate, endDate, domain, member string) ([]core.UniqueClientRecord, error) {
+	sTime, eTime, err := parseUsageDates(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	sketches, err := dat.GetUniqueClientSketches(domain, member, sTime, eTime)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]core.UniqueClientRecord, 0, len(sketches))
+	for _, s := range sketches {
+		out = append(out, core.UniqueClientRecord{
+			NodeID:       nodeID,
+			Date:         s.Date,
+			Domain:       s.Domain,
+			MemberName:   s.MemberName,
+			IPSketch:     s.IPSketch,
+			PrefixSketch: s.PrefixSketch,
+		})
+	}
+	return out, nil
+}
 
-	if domain != "" && member != "" {
-		recs, err := dat.GetUsageByMember(domain, member, sTime, eTime)
-		if err != nil {
-			return nil, err
-		}
-		for _, r := range recs {
-			if country == "" || strings.EqualFold(country, r.CountryCode) {
-				results = append(results, core.UsageRecord{
-					Date:        r.Date,
-					Domain:      r.Domain,
-					MemberName:  r.MemberName,
-					CountryCode: r.CountryCode,
-					Asn:         r.Asn,
-					NetworkName: r.NetworkName,
-					CountryName: r.CountryName,
-					Hits:        r.Hits,
-					IsIPv6:      r.IsIPv6,
-				})
-			}
-		}
-	} else if domain != "" {
-		recs, err := dat.GetUsageByDomain(domain, sTime, eTime)
-		if err != nil {
-			return nil, err
-		}
-		for _, r := range recs {
-			if country == "" || strings.EqualFold(country, r.CountryCode) {
-				results = append(results, core.UsageRecord{
-					Date:        r.Date,
-					Domain:      r.Domain,
-					MemberName:  r.MemberName,
-					CountryCode: r.CountryCode,
-					Asn:         r.Asn,
-					NetworkName: r.NetworkName,
-					CountryName: r.CountryName,
-					Hits:        r.Hits,
-					IsIPv6:      r.IsIPv6,
-				})
-			}
-		}
-	} else {
-		recs, err := dat.GetUsageByCountry(sTime, eTime)
-		if err != nil {
-			return nil, err
-		}
-		for _, r := range recs {
-			if member != "" && r.MemberName != member {
-				continue
-			}
-			if country != "" && !strings.EqualFold(country, r.CountryCode) {
-				continue
-			}
-			results = append(results, core.UsageRecord{
-				Date:        r.Date,
-				Domain:      r.Domain,
-				MemberName:  r.MemberName,
-				CountryCode: r.CountryCode,
-				Asn:         r.Asn,
-				NetworkName: r.NetworkName,
-				CountryName: r.CountryName,
-				Hits:        r.Hits,
-				IsIPv6:      r.IsIPv6,
-			})
-		}
+func retrieveLocalUsageRecords(
+	startDate, endDate, domain, member, country string,
+) ([]core.UsageRecord, error) {
+	log.Log(log.Debug,
+		"[NATS] retrieveLocalUsageRecords: start=%s end=%s domain=%s member=%s country=%s",
+		startDate, endDate, domain, member, country)
+
+	var results []core.UsageRecord
+	err := streamLocalUsageRecords(startDate, endDate, domain, member, country, func(r core.UsageRecord) error {
+		results = append(results, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	log.Log(log.Debug,
@@ -292,3 +359,42 @@ func retrieveLocalUsageRecords(
 		len(results))
 	return results, nil
 }
+
+// streamLocalUsageRecords calls fn for each local usage row of the request
+// as it is read.
+func streamLocalUsageRecords(
+	startDate, endDate, domain, member, country string, fn func(core.UsageRecord) error,
+) error {
+	sTime, eTime, err := parseUsageDates(startDate, endDate)
+	if err != nil {
+		return err
+	}
+	filter := dat.UsageFilter{Domain: domain, Member: member, Country: country, Start: sTime, End: eTime}
+	return forEachUsageRow(filter, func(r dat.UsageRecord) error {
+		return fn(core.UsageRecord{
+			Date:        r.Date,
+			Hourly:      r.Hourly,
+			Hour:        r.Hour,
+			Domain:      r.Domain,
+			Service:     r.Service,
+			MemberName:  r.MemberName,
+			CountryCode: r.CountryCode,
+			Asn:         r.Asn,
+			NetworkName: r.NetworkName,
+			CountryName: r.CountryName,
+			Hits:        r.Hits,
+			IsIPv6:      r.IsIPv6,
+		})
+	})
+}
+
+// transport adapts deps to the fan-out helper.
+func transport(deps Dependencies) fanout.Transport {
+	return fanout.Transport{
+		NodeID:    deps.State.NodeID,
+		Subscribe: deps.Subscribe,
+		Publish: func(ctx context.Context, subject, reply string, data []byte) error {
+			return core.PublishCtx(ctx, deps.PublishMsg, deps.PublishMsgWithReply, subject, reply, data)
+		},
+	}
+}
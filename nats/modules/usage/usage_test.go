@@ -0,0 +1,85 @@
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/internal/errdefs"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+)
+
+func TestParseUsageDates(t *testing.T) {
+	start, end, err := parseUsageDates(" 2025-01-01", "2025-01-31 ")
+	if err != nil {
+		t.Fatalf("parseUsageDates: %v", err)
+	}
+	if start.Day() != 1 || end.Day() != 31 {
+		t.Fatalf("unexpected range %s - %s", start, end)
+	}
+
+	for _, tc := range [][2]string{
+		{"2025-1-1", "2025-01-31"},
+		{"2025-13-01", "2025-01-31"},
+		{"2025-01-01", "2025-02-30"},
+		{"2025-02-01", "2025-01-31"},
+	} {
+		if _, _, err := parseUsageDates(tc[0], tc[1]); !errors.Is(err, errdefs.ErrInvalidDateRange) {
+			t.Errorf("parseUsageDates(%q, %q): expected ErrInvalidDateRange, got %v", tc[0], tc[1], err)
+		}
+	}
+}
+
+func TestHandleRequestStreamsChunks(t *testing.T) {
+	orig := forEachUsageRow
+	t.Cleanup(func() { forEachUsageRow = orig })
+	var filter dat.UsageFilter
+	forEachUsageRow = func(f dat.UsageFilter, fn func(dat.UsageRecord) error) error {
+		filter = f
+		for i := 0; i < 5; i++ {
+			if err := fn(dat.UsageRecord{Date: "2025-01-01", Domain: "rpc.example", Hits: i}); err != nil {
+				return err
+			}
+		}
+		return errors.New("connection lost")
+	}
+
+	var replies []core.UsageResponse
+	deps := Dependencies{
+		State: &core.NodeState{NodeID: "dns-a"},
+		PublishMsgWithReply: func(subject, reply string, data []byte) error {
+			var resp core.UsageResponse
+			if err := json.Unmarshal(data, &resp); err != nil {
+				t.Fatalf("unmarshal reply: %v", err)
+			}
+			replies = append(replies, resp)
+			return nil
+		},
+	}
+	req, _ := json.Marshal(core.UsageRequest{StartDate: "2025-01-01", EndDate: "2025-01-02", Country: "de", ChunkSize: 2})
+	HandleRequest(deps, "_INBOX.reply", req)
+
+	if filter.Country != "de" || filter.Start.Day() != 1 || filter.End.Day() != 2 {
+		t.Fatalf("unexpected filter %+v", filter)
+	}
+	if len(replies) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(replies))
+	}
+	for i, r := range replies[:2] {
+		if !r.More || r.Part != i || len(r.UsageRecords) != 2 || r.Error != "" {
+			t.Fatalf("chunk %d: unexpected %+v", i, r)
+		}
+	}
+	if last := replies[2]; last.More || last.Part != 2 || len(last.UsageRecords) != 1 || last.Error != "connection lost" {
+		t.Fatalf("unexpected last chunk %+v", last)
+	}
+
+	merged := replies[0]
+	for _, r := range replies[1:] {
+		merged = mergeUsage(merged, r)
+	}
+	if len(merged.UsageRecords) != 5 || merged.UsageRecords[4].Hits != 4 || merged.More || merged.Error == "" {
+		t.Fatalf("unexpected merged reply %+v", merged)
+	}
+}
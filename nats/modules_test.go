@@ -0,0 +1,93 @@
+package nats
+
+import (
+	"testing"
+
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+)
+
+func TestRoleSubscriptionsAreExplicit(t *testing.T) {
+	State.Mu.Lock()
+	State.SubjectPropose = "consensus.propose"
+	State.SubjectVote = "consensus.vote"
+	State.SubjectFinalize = "consensus.finalize"
+	State.SubjectCluster = "consensus.cluster"
+	State.Mu.Unlock()
+
+	want := map[string]map[string]string{
+		"IBPMonitor": {
+			"consensus.cluster":           "",
+			subjects.ClusterNodeStatus:    "",
+			"consensus.propose":           "",
+			"consensus.vote":              "",
+			"consensus.finalize":          "",
+			subjects.MonitorStatsRequest:  "",
+			subjects.MonitorStatusRequest: "",
+			subjects.MonitorOfficialSync:  "",
+		},
+		"IBPDns": {
+			"consensus.cluster":              "",
+			subjects.ClusterNodeStatus:       "",
+			subjects.DnsUsageRequest:         "",
+			subjects.MonitorLatency:          "",
+			subjects.MonitorOfficialSnapshot: "",
+		},
+		"IBPCollator": {
+			"consensus.cluster":              "",
+			subjects.ClusterNodeStatus:       "",
+			"consensus.propose":              "",
+			"consensus.vote":                 "",
+			"consensus.finalize":             "",
+			subjects.DnsUsageData:            subjects.CollatorQueue,
+			subjects.CollatorProposalHistory: subjects.CollatorQueue,
+			subjects.MonitorLatency:          subjects.CollatorQueue,
+			subjects.CollatorEventAction:     subjects.CollatorQueue,
+			subjects.CollatorMaintenance:     subjects.CollatorQueue,
+		},
+	}
+
+	for role, expected := range want {
+		got := map[string]string{}
+		for _, sub := range roleSubscriptions(role) {
+			if sub.Subject == ">" {
+				t.Fatalf("%s: wildcard subscription is not allowed", role)
+			}
+			if _, dup := got[sub.Subject]; dup {
+				t.Fatalf("%s: duplicate subscription to %s", role, sub.Subject)
+			}
+			got[sub.Subject] = sub.Queue
+		}
+		if len(got) != len(expected) {
+			t.Fatalf("%s: expected %v, got %v", role, expected, got)
+		}
+		for subject, queue := range expected {
+			if q, ok := got[subject]; !ok || q != queue {
+				t.Fatalf("%s: expected %s (queue %q), got %v", role, subject, queue, got)
+			}
+		}
+	}
+}
+
+func TestRoleSubscriptionsUseClusterPrefix(t *testing.T) {
+	subjects.SetPrefix("staging")
+	defer subjects.SetPrefix("")
+
+	State.Mu.Lock()
+	State.SubjectCluster = subjects.With(subjects.ConsensusCluster)
+	State.Mu.Unlock()
+	defer func() {
+		State.Mu.Lock()
+		State.SubjectCluster = subjects.ConsensusCluster
+		State.Mu.Unlock()
+	}()
+
+	got := map[string]bool{}
+	for _, sub := range roleSubscriptions("IBPDns") {
+		got[sub.Subject] = true
+	}
+	if !got["staging.consensus.cluster"] || !got["staging.cluster.nodeStatus"] ||
+		!got["staging.dns.usage.getUsage"] || !got["staging.monitor.latency"] ||
+		!got["staging.monitor.official.snapshot"] || len(got) != 5 {
+		t.Fatalf("expected prefixed DNS subscriptions, got %v", got)
+	}
+}
@@ -0,0 +1,99 @@
+package nats
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	"github.com/ibp-network/ibp-geodns-libs/internal/stmtcache"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	modnodestatus "github.com/ibp-network/ibp-geodns-libs/nats/modules/nodestatus"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+// processStart is reported as the node's start time.
+var processStart = time.Now().UTC()
+
+// checkQueueDepth reports the application's pending check count; the
+// library has no check queue of its own.
+var checkQueueDepth atomic.Pointer[func() int]
+
+// SetCheckQueueDepthFunc registers how the node status reply reads the
+// application's check queue depth.
+func SetCheckQueueDepthFunc(fn func() int) {
+	if fn == nil {
+		checkQueueDepth.Store(nil)
+		return
+	}
+	checkQueueDepth.Store(&fn)
+}
+
+func nodeStatusDeps() modnodestatus.Dependencies {
+	return modnodestatus.Dependencies{
+		State:               &State,
+		PublishMsgWithReply: PublishMsgWithReply,
+		PublishMsg:          PublishMsg,
+		Subscribe:           Subscribe,
+		ActiveNodes:         func() []string { return activeNodeIDs("") },
+		Collect:             collectNodeStatus,
+	}
+}
+
+// collectNodeStatus snapshots this node's health for cluster.nodeStatus.
+func collectNodeStatus() core.NodeStatusResponse {
+	State.Mu.RLock()
+	status := core.NodeStatusResponse{
+		NodeID:      State.NodeID,
+		NodeRole:    State.ThisNode.NodeRole,
+		ClusterName: State.ThisNode.ClusterName,
+	}
+	State.Mu.RUnlock()
+
+	now := time.Now().UTC()
+	status.Version = cfg.GetVersion()
+	status.StartedAt = processStart
+	status.UptimeSeconds = int64(now.Sub(processStart) / time.Second)
+	status.LastMysqlWrite = mysql.LastWrite()
+	usage := dat.UsageFlushStats()
+	status.PendingUsage = usage.Pending
+	status.SpilledUsage = usage.SpillRecords
+	stmts := stmtcache.Snapshot()
+	status.MysqlPrepares, status.MysqlStmtExecs = stmts.Prepares, stmts.Executions
+	status.SequenceGaps = SequenceGaps()
+	if skew := maxPeerClockSkew(); skew != 0 {
+		status.MaxClockSkew = skew.String()
+	}
+
+	if fn := checkQueueDepth.Load(); fn != nil {
+		status.CheckQueueDepth = (*fn)()
+	}
+	for _, q := range HandlerStats() {
+		status.HandlerQueueDepth += q.Depth
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	status.MemoryAllocBytes = mem.Alloc
+	status.MemorySysBytes = mem.Sys
+	status.Goroutines = runtime.NumGoroutine()
+
+	if conn := currentConnection(); conn != nil {
+		status.Subscriptions = conn.NumSubscriptions()
+	}
+	return status
+}
+
+func handleNodeStatusRequest(m *nats.Msg) {
+	modnodestatus.HandleRequestContext(core.ContextFromMsg(m), nodeStatusDeps(), m.Reply)
+}
+
+// RequestAllNodeStatus asks every active node of the cluster for its uptime,
+// version, queue depths, last MySQL write, memory use and subscription count.
+func RequestAllNodeStatus(timeout time.Duration) (NodeStatusReport, error) {
+	return modnodestatus.RequestAll(nodeStatusDeps(), timeout, subjects.With(subjects.ClusterNodeStatus))
+}
@@ -0,0 +1,52 @@
+package nats
+
+import (
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+const pruneReloadHook = "nats.prune"
+
+// pruneRemovedProposals drops in-flight proposals for members or domains that
+// a config reload removed, so they cannot finalize and resurrect results that
+// data.PruneRemoved just deleted.
+func pruneRemovedProposals() {
+	c := cfg.GetConfig()
+	checkMembers, checkDomains := len(c.Members) > 0, len(c.Services) > 0
+	if !checkMembers && !checkDomains {
+		return
+	}
+
+	State.Mu.Lock()
+	defer State.Mu.Unlock()
+
+	pruned := 0
+	for id, pt := range State.Proposals {
+		prop := pt.Proposal
+		removed := false
+		if checkMembers {
+			if _, ok := findMemberByName(prop.MemberName); !ok {
+				removed = true
+			}
+		}
+		if !removed && checkDomains && prop.DomainName != "" {
+			if _, ok := findServiceForDomain(prop.DomainName); !ok {
+				removed = true
+			}
+		}
+		if !removed {
+			continue
+		}
+		if pt.Timer != nil {
+			pt.Timer.Stop()
+		}
+		delete(State.Proposals, id)
+		delete(State.PendingVotes, id)
+		delete(State.PendingVoteTouched, id)
+		pruned++
+	}
+
+	if pruned > 0 {
+		log.Log(log.Info, "[NATS] pruned %d proposals for members or domains removed from config", pruned)
+	}
+}
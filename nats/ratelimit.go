@@ -0,0 +1,102 @@
+package nats
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/router"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+// -----------------------------------------------------------------------------
+// INBOUND RATE LIMITS
+// -----------------------------------------------------------------------------
+//
+// Request subjects that end in MySQL queries are limited per sender, so one
+// misbehaving peer cannot exhaust the database. Rejected requests are answered
+// with {"nodeID": ..., "error": ...}, which every response type of these
+// subjects decodes, so the requester records a failed node instead of waiting
+// for the timeout.
+
+const (
+	rateLimitReloadHook   = "nats.ratelimits"
+	rateLimitLogInterval  = time.Minute
+	rateLimitErrorMessage = "rate limited"
+)
+
+var defaultRateLimits = map[string]cfg.RateLimitConfig{
+	subjects.DnsUsageRequest:         {PerSecond: 1, Burst: 10},
+	subjects.MonitorStatsRequest:     {PerSecond: 1, Burst: 10},
+	subjects.CollatorProposalHistory: {PerSecond: 2, Burst: 20},
+}
+
+var (
+	rateLimited     atomic.Uint64
+	rateLimitLogged sync.Map // subject + sender → time of the last WARN
+)
+
+// RateLimited returns how many inbound messages were rejected by rate limits
+// since start-up.
+func RateLimited() uint64 {
+	return rateLimited.Load()
+}
+
+// rateLimits merges the configured limits over the defaults, keyed by the
+// prefixed subject.
+func rateLimits(c cfg.NatsConfig) map[string]router.Limit {
+	merged := make(map[string]cfg.RateLimitConfig, len(defaultRateLimits)+len(c.RateLimits))
+	for subject, l := range defaultRateLimits {
+		merged[subject] = l
+	}
+	for subject, l := range c.RateLimits {
+		merged[subject] = l
+	}
+	out := make(map[string]router.Limit, len(merged))
+	for subject, l := range merged {
+		if l.PerSecond <= 0 {
+			continue
+		}
+		out[subjects.With(subject)] = router.Limit{PerSecond: l.PerSecond, Burst: l.Burst}
+	}
+	return out
+}
+
+func applyRateLimits() {
+	messageRouter.SetLimiter(router.NewLimiter(rateLimits(cfg.GetConfig().Local.Nats)), rejectRateLimited)
+}
+
+func registerRateLimits() {
+	applyRateLimits()
+	cfg.RegisterReloadHook(rateLimitReloadHook, applyRateLimits)
+}
+
+func rejectRateLimited(msg *nats.Msg, sender string) {
+	rateLimited.Add(1)
+
+	key := msg.Subject + "|" + sender
+	now := time.Now()
+	if last, ok := rateLimitLogged.Load(key); !ok || now.Sub(last.(time.Time)) >= rateLimitLogInterval {
+		rateLimitLogged.Store(key, now)
+		log.LogCtx(core.ContextFromMsg(msg), log.Warn, "[NATS] rate limit exceeded on %s by %s; rejecting", msg.Subject, sender)
+	}
+
+	if msg.Reply == "" {
+		return
+	}
+	data, _ := json.Marshal(struct {
+		NodeID string `json:"nodeID"`
+		Error  string `json:"error"`
+	}{NodeID: cfg.GetConfig().Local.Nats.NodeID, Error: rateLimitErrorMessage})
+	reply := &nats.Msg{Subject: msg.Reply, Data: data, Header: nats.Header{}}
+	core.InjectHeaders(core.ContextFromMsg(msg), reply.Header)
+	if err := PublishMsg(reply); err != nil {
+		log.Log(log.Debug, "[NATS] rate limit reply to %s failed: %v", sender, err)
+	}
+}
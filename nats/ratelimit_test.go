@@ -0,0 +1,32 @@
+package nats
+
+import (
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+)
+
+func TestRateLimitsMergeConfigOverDefaults(t *testing.T) {
+	subjects.SetPrefix("prod")
+	defer subjects.SetPrefix("")
+
+	got := rateLimits(cfg.NatsConfig{RateLimits: map[string]cfg.RateLimitConfig{
+		subjects.DnsUsageRequest:     {PerSecond: 5, Burst: 50},
+		subjects.MonitorStatsRequest: {PerSecond: -1},
+		subjects.MonitorLatency:      {PerSecond: 10, Burst: 100},
+	}})
+
+	if l := got["prod.dns.usage.getUsage"]; l.PerSecond != 5 || l.Burst != 50 {
+		t.Fatalf("expected the configured usage limit, got %+v", l)
+	}
+	if _, ok := got["prod.monitor.stats.getDowntime"]; ok {
+		t.Fatal("expected a negative rate to disable the default limit")
+	}
+	if l := got["prod.collator.proposals.history"]; l.PerSecond != 2 || l.Burst != 20 {
+		t.Fatalf("expected the default history limit, got %+v", l)
+	}
+	if _, ok := got["prod.monitor.latency"]; !ok || len(got) != 3 {
+		t.Fatalf("expected three limits including monitor.latency, got %+v", got)
+	}
+}
@@ -0,0 +1,182 @@
+package nats
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// SERVICE REDUNDANCY WATCH
+// -----------------------------------------------------------------------------
+//
+// Per-member outage alerts say nothing about whether a network is still
+// served. Monitors evaluate the Alerts.Redundancy rules against the service
+// health of their official results and raise a service alert in the
+// internal room when a service or region has fewer healthy providers than a
+// rule requires, and again when it recovers. Every monitor evaluates, so
+// a new publisher takes over with the same state; only the snapshot
+// publisher (the first active monitor) dispatches.
+
+const (
+	redundancyInterval = 30 * time.Second
+
+	// redundancyWarmup skips alerts while official results are still
+	// syncing after start-up.
+	redundancyWarmup = 3 * time.Minute
+)
+
+// redundancyTarget is the healthy count of one service, or one region of it.
+type redundancyTarget struct {
+	service, region string
+	healthy, min    int
+}
+
+func (t redundancyTarget) key() string { return t.service + "|" + t.region }
+
+// redundancyTargets applies rules to health. When several rules cover the
+// same service and region the highest MinHealthy applies.
+func redundancyTargets(rules []cfg.RedundancyRule, health []dat.ServiceHealth) []redundancyTarget {
+	var out []redundancyTarget
+	index := make(map[string]int)
+	add := func(t redundancyTarget) {
+		if i, ok := index[t.key()]; ok {
+			if t.min > out[i].min {
+				out[i].min = t.min
+			}
+			return
+		}
+		index[t.key()] = len(out)
+		out = append(out, t)
+	}
+	for _, r := range rules {
+		if r.MinHealthy <= 0 {
+			continue
+		}
+		for _, h := range health {
+			if r.Service != "" && r.Service != h.Service {
+				continue
+			}
+			switch r.Region {
+			case "":
+				add(redundancyTarget{service: h.Service, healthy: h.Healthy, min: r.MinHealthy})
+			case "*":
+				for _, rh := range h.Regions {
+					add(redundancyTarget{service: h.Service, region: rh.Region, healthy: rh.Healthy, min: r.MinHealthy})
+				}
+			default:
+				t := redundancyTarget{service: h.Service, region: r.Region, min: r.MinHealthy}
+				for _, rh := range h.Regions {
+					if rh.Region == r.Region {
+						t.healthy = rh.Healthy
+					}
+				}
+				add(t)
+			}
+		}
+	}
+	return out
+}
+
+// redundancyWatch turns healthy counts into redundancy transitions. Like
+// the quorum watchdog it needs watchdogConfirmSamples agreeing samples
+// before reporting, so a single flapping check does not page.
+type redundancyWatch struct {
+	below  map[string]bool // last reported state per target
+	streak map[string]int
+}
+
+type redundancyAlert struct {
+	kind            alerts.Kind
+	service, region string
+	message         string
+}
+
+// observe records one evaluation and returns the transitions it causes.
+// Targets no longer evaluated (a removed rule or service) are forgotten
+// without an alert.
+func (w *redundancyWatch) observe(targets []redundancyTarget) []redundancyAlert {
+	if w.below == nil {
+		w.below, w.streak = make(map[string]bool), make(map[string]int)
+	}
+	seen := make(map[string]bool, len(targets))
+	var out []redundancyAlert
+	for _, t := range targets {
+		k := t.key()
+		seen[k] = true
+		below := t.healthy < t.min
+		if below == w.below[k] {
+			w.streak[k] = 0
+			continue
+		}
+		w.streak[k]++
+		if w.streak[k] < watchdogConfirmSamples {
+			continue
+		}
+		w.below[k], w.streak[k] = below, 0
+		scope := t.service
+		if t.region != "" {
+			scope += " in " + t.region
+		}
+		if below {
+			out = append(out, redundancyAlert{alerts.KindRedundancyLost, t.service, t.region,
+				fmt.Sprintf("%d healthy providers of %s, %d required", t.healthy, scope, t.min)})
+		} else {
+			out = append(out, redundancyAlert{alerts.KindRedundancyRestored, t.service, t.region,
+				fmt.Sprintf("%d healthy providers of %s, redundancy of %d restored", t.healthy, scope, t.min)})
+		}
+	}
+	for k := range w.below {
+		if !seen[k] {
+			delete(w.below, k)
+			delete(w.streak, k)
+		}
+	}
+	return out
+}
+
+var (
+	redundancyOnce  sync.Once
+	redundancyState redundancyWatch
+
+	allServiceHealth          = dat.GetAllServiceHealth
+	dispatchServiceRedundancy = alerts.ServiceRedundancy
+	isRedundancyReporter      = isSnapshotPublisher
+)
+
+// startRedundancyWatch begins evaluating the redundancy rules.
+func startRedundancyWatch() {
+	redundancyOnce.Do(func() {
+		started := time.Now()
+		go func() {
+			t := time.NewTicker(redundancyInterval)
+			defer t.Stop()
+			for range t.C {
+				if time.Since(started) < redundancyWarmup {
+					continue
+				}
+				runRedundancyWatch()
+			}
+		}()
+	})
+}
+
+func runRedundancyWatch() {
+	rules := cfg.GetConfig().Alerts.Redundancy
+	if len(rules) == 0 {
+		return
+	}
+	transitions := redundancyState.observe(redundancyTargets(rules, allServiceHealth()))
+	if len(transitions) == 0 || !isRedundancyReporter() {
+		return
+	}
+	for _, a := range transitions {
+		log.Log(log.Warn, "[NATS] service redundancy: %s: %s", a.kind, a.message)
+		dispatchServiceRedundancy(a.kind, a.service, a.region, a.message)
+	}
+}
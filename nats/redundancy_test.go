@@ -0,0 +1,104 @@
+package nats
+
+import (
+	"testing"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+)
+
+func TestRedundancyTargetsApplyRules(t *testing.T) {
+	health := []dat.ServiceHealth{
+		{Service: "polkadot", Healthy: 3, Regions: []dat.RegionHealth{{Region: "eu", Healthy: 2}, {Region: "us", Healthy: 1}}},
+		{Service: "kusama", Healthy: 1, Regions: []dat.RegionHealth{{Region: "eu", Healthy: 1}}},
+	}
+	rules := []cfg.RedundancyRule{
+		{MinHealthy: 2},
+		{Service: "polkadot", MinHealthy: 4},
+		{Service: "polkadot", Region: "*", MinHealthy: 1},
+		{Service: "kusama", Region: "as", MinHealthy: 1},
+		{Service: "kusama", MinHealthy: 0}, // ignored
+	}
+	got := map[string]redundancyTarget{}
+	for _, tgt := range redundancyTargets(rules, health) {
+		got[tgt.key()] = tgt
+	}
+	want := map[string][2]int{ // healthy, min
+		"polkadot|":   {3, 4},
+		"kusama|":     {1, 2},
+		"polkadot|eu": {2, 1},
+		"polkadot|us": {1, 1},
+		"kusama|as":   {0, 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d targets, got %+v", len(want), got)
+	}
+	for k, w := range want {
+		if tgt, ok := got[k]; !ok || tgt.healthy != w[0] || tgt.min != w[1] {
+			t.Fatalf("%s: expected healthy %d of %d, got %+v", k, w[0], w[1], tgt)
+		}
+	}
+}
+
+func TestRedundancyWatchConfirmsTransitions(t *testing.T) {
+	var w redundancyWatch
+	target := func(healthy int) []redundancyTarget {
+		return []redundancyTarget{{service: "polkadot", region: "eu", healthy: healthy, min: 2}}
+	}
+
+	if got := w.observe(target(1)); len(got) != 0 {
+		t.Fatalf("expected a single low sample to be ignored, got %+v", got)
+	}
+	got := w.observe(target(1))
+	if len(got) != 1 || got[0].kind != alerts.KindRedundancyLost || got[0].region != "eu" {
+		t.Fatalf("expected redundancy lost after confirmation, got %+v", got)
+	}
+	if got := w.observe(target(0)); len(got) != 0 {
+		t.Fatalf("expected lost redundancy to be reported once, got %+v", got)
+	}
+	w.observe(target(2))
+	got = w.observe(target(3))
+	if len(got) != 1 || got[0].kind != alerts.KindRedundancyRestored {
+		t.Fatalf("expected redundancy restored, got %+v", got)
+	}
+
+	// A target that is no longer evaluated is forgotten silently.
+	w.observe(target(0))
+	w.observe(target(0))
+	if got := w.observe(nil); len(got) != 0 || len(w.below) != 0 {
+		t.Fatalf("expected removed target dropped without alert, got %+v %v", got, w.below)
+	}
+}
+
+func TestRunRedundancyWatchOnlyReporterDispatches(t *testing.T) {
+	prevHealth, prevDispatch, prevReporter, prevState := allServiceHealth, dispatchServiceRedundancy, isRedundancyReporter, redundancyState
+	prevCfg := cfg.SetConfig(cfg.Config{Alerts: cfg.AlertsConfig{Redundancy: []cfg.RedundancyRule{{MinHealthy: 2}}}})
+	defer func() {
+		allServiceHealth, dispatchServiceRedundancy, isRedundancyReporter, redundancyState = prevHealth, prevDispatch, prevReporter, prevState
+		cfg.SetConfig(prevCfg)
+	}()
+
+	redundancyState = redundancyWatch{}
+	allServiceHealth = func() []dat.ServiceHealth { return []dat.ServiceHealth{{Service: "polkadot", Healthy: 1}} }
+	var sent []string
+	dispatchServiceRedundancy = func(kind alerts.Kind, service, region, _ string) {
+		sent = append(sent, string(kind)+" "+service)
+	}
+
+	reporter := false
+	isRedundancyReporter = func() bool { return reporter }
+	runRedundancyWatch()
+	runRedundancyWatch()
+	if len(sent) != 0 {
+		t.Fatalf("expected a non-reporter to stay quiet, got %v", sent)
+	}
+
+	reporter = true
+	allServiceHealth = func() []dat.ServiceHealth { return []dat.ServiceHealth{{Service: "polkadot", Healthy: 2}} }
+	runRedundancyWatch()
+	runRedundancyWatch()
+	if len(sent) != 1 || sent[0] != "redundancy_restored polkadot" {
+		t.Fatalf("expected the reporter to dispatch the restore, got %v", sent)
+	}
+}
@@ -4,11 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
 
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
 	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/router"
 	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
 
 	"github.com/nats-io/nats.go"
@@ -29,14 +33,9 @@ var (
 
 var lastJoin int64 // unix‑nano timestamp of our last JOIN
 
-type subjectHandler struct {
-	subject string
-	handler func(*nats.Msg)
-}
-
-func EnableMonitorRole() error  { return enableRoleInternal("IBPMonitor") }
-func EnableDnsRole() error      { return enableRoleInternal("IBPDns") }
-func EnableCollatorRole() error { return enableRoleInternal("IBPCollator") }
+func EnableMonitorRole() error  { return enableRoleInternal(RoleMonitor) }
+func EnableDnsRole() error      { return enableRoleInternal(RoleDns) }
+func EnableCollatorRole() error { return enableRoleInternal(RoleCollator) }
 
 func enableRoleInternal(role string) error {
 	if strings.TrimSpace(State.NodeID) == "" {
@@ -44,10 +43,10 @@ func enableRoleInternal(role string) error {
 	}
 
 	State.Mu.Lock()
-	State.SubjectPropose = "consensus.propose"
-	State.SubjectVote = "consensus.vote"
-	State.SubjectFinalize = "consensus.finalize"
-	State.SubjectCluster = "consensus.cluster"
+	State.SubjectPropose = subjects.With(subjects.ConsensusPropose)
+	State.SubjectVote = subjects.With(subjects.ConsensusVote)
+	State.SubjectFinalize = subjects.With(subjects.ConsensusFinalize)
+	State.SubjectCluster = subjects.With(subjects.ConsensusCluster)
 	State.ProposalTimeout = 30 * time.Second
 
 	if State.Proposals == nil {
@@ -64,10 +63,17 @@ func enableRoleInternal(role string) error {
 	}
 
 	State.ThisNode.NodeRole = role
+	State.ThisNode.ClusterName = strings.TrimSpace(cfg.GetConfig().Local.Nats.ClusterName)
+	State.ThisNode.Region = strings.TrimSpace(cfg.GetConfig().Local.Nats.Region)
 	State.ThisNode.LastHeard = time.Now().UTC()
 	State.ClusterNodes[State.NodeID] = State.ThisNode
 	State.Mu.Unlock()
 
+	if role == RoleMonitor || role == RoleCollator {
+		initAppliedLedger()
+		cfg.RegisterReloadHook(pruneReloadHook, pruneRemovedProposals)
+	}
+
 	// Be more resilient to transient NATS unavailability.
 	var err error
 	for i := 0; i < 5; i++ {
@@ -81,9 +87,26 @@ func enableRoleInternal(role string) error {
 		return err
 	}
 
-	if role == "IBPMonitor" || role == "IBPCollator" {
+	if role == RoleMonitor || role == RoleCollator {
 		StartGarbageCollection()
+		startQuorumWatchdog()
+	}
+	if role == RoleMonitor {
+		registerProposalLanes()
+		registerProposalTimeouts()
+		startLatencyPublisher()
+		startOfficialSnapshotPublisher()
+		startRedundancyWatch()
+	}
+	if role == RoleDns {
+		startOfficialSync()
+		startLiveUsagePublisher()
+	}
+	if role == RoleCollator {
+		startMaxmindPublisher()
+		startOutageEventStream()
 	}
+	startMaxmindSync()
 	startHeartbeat()
 
 	log.Log(log.Info, "[NATS] %s role enabled for node=%s", role, State.NodeID)
@@ -101,48 +124,35 @@ func enableRoleInternal(role string) error {
 func subscribeRoleSubjects(role string) error {
 	subs := make([]*nats.Subscription, 0)
 	for _, sub := range roleSubscriptions(role) {
-		if sub.subject == "" || sub.handler == nil {
-			continue
+		var (
+			createdSub *nats.Subscription
+			err        error
+		)
+		if sub.Queue != "" {
+			createdSub, err = QueueSubscribe(sub.Subject, sub.Queue, sub.Handler)
+		} else {
+			createdSub, err = Subscribe(sub.Subject, sub.Handler)
 		}
-		createdSub, err := Subscribe(sub.subject, sub.handler)
 		if err != nil {
 			for _, existingSub := range subs {
 				_ = existingSub.Unsubscribe()
 			}
-			return fmt.Errorf("subscribe %s for %s: %w", sub.subject, role, err)
+			return fmt.Errorf("subscribe %s for %s: %w", sub.Subject, role, err)
 		}
 		subs = append(subs, createdSub)
 	}
 	return nil
 }
 
-func roleSubscriptions(role string) []subjectHandler {
-	base := []subjectHandler{
-		{subject: State.SubjectCluster, handler: handleClusterMessage},
-	}
-
-	switch role {
-	case "IBPMonitor":
-		return append(base,
-			subjectHandler{subject: State.SubjectPropose, handler: handleProposal},
-			subjectHandler{subject: State.SubjectVote, handler: handleVote},
-			subjectHandler{subject: State.SubjectFinalize, handler: handleFinalize},
-			subjectHandler{subject: subjects.MonitorStatsRequest, handler: handleMonitorStatsRequest},
-		)
-	case "IBPCollator":
-		return append(base,
-			subjectHandler{subject: State.SubjectPropose, handler: cacheCollatorProposal},
-			subjectHandler{subject: State.SubjectVote, handler: cacheCollatorVote},
-			subjectHandler{subject: State.SubjectFinalize, handler: handleFinalize},
-			subjectHandler{subject: subjects.DnsUsageData, handler: handleUsageData},
-		)
-	case "IBPDns":
-		return append(base,
-			subjectHandler{subject: subjects.DnsUsageRequest, handler: handleDnsUsageRequest},
-		)
-	default:
-		return base
+// roleSubscriptions returns the cluster and node status subscriptions every
+// node needs plus the subscriptions planned from the patterns declared by the
+// role's modules.
+func roleSubscriptions(role string) []router.Subscription {
+	base := []router.Subscription{
+		{Subject: State.SubjectCluster, Handler: handleClusterMessage},
+		{Subject: subjects.With(subjects.ClusterNodeStatus), Handler: handleNodeStatusRequest},
 	}
+	return append(base, messageRouter.Plan(role)...)
 }
 
 func startHeartbeat() {
@@ -178,8 +188,10 @@ func broadcastClusterJoin(force bool) {
 	State.Mu.Unlock()
 
 	msg := ClusterMessage{
-		Type:   "join",
-		Sender: sender,
+		Type:        "join",
+		ClusterName: sender.ClusterName,
+		Sender:      sender,
+		SentAt:      now,
 	}
 	data, err := json.Marshal(msg)
 	if err != nil {
@@ -191,37 +203,33 @@ func broadcastClusterJoin(force bool) {
 	}
 }
 
-func handleAllMessages(m *nats.Msg) {
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Log(log.Error, "[NATS] message handler panic for %s: %v", m.Subject, r)
-			}
-		}()
-
-		subj := m.Subject
-		if subj == State.SubjectCluster {
-			handleClusterMessage(m)
-			return
-		}
-
-		if !messageRouter.Dispatch(State.ThisNode.NodeRole, m) && strings.HasPrefix(subj, "consensus.") {
-			log.Log(log.Debug, "[NATS] unhandled consensus subject %s for role=%s", subj, State.ThisNode.NodeRole)
-		}
-	}()
-}
-
 func handleClusterMessage(m *nats.Msg) {
+	ctx := core.ContextFromMsg(m)
 	var msg ClusterMessage
 	if err := json.Unmarshal(m.Data, &msg); err != nil {
-		log.Log(log.Error, "[NATS] handleClusterMessage: unmarshal error: %v", err)
+		log.LogCtx(ctx, log.Error, "[NATS] handleClusterMessage: unmarshal error: %v", err)
 		return
 	}
 	if msg.Sender.NodeID == "" {
 		return
 	}
+	if msg.ClusterName == "" {
+		msg.ClusterName = msg.Sender.ClusterName
+	}
+	if !State.SameCluster(msg.ClusterName) {
+		log.LogCtx(ctx, log.Debug, "[NATS] ignoring %s from node %s in cluster %q", msg.Type, msg.Sender.NodeID, msg.ClusterName)
+		return
+	}
+	msg.Sender.ClusterName = msg.ClusterName
 
 	wasNew := markNodeHeardWithState(msg.Sender.NodeID)
+	if msg.Sender.NodeID != State.NodeID {
+		sentAt := msg.SentAt
+		if sentAt.IsZero() {
+			sentAt = msg.Sender.LastHeard
+		}
+		observeClockSkew(msg.Sender.NodeID, sentAt, time.Now().UTC())
+	}
 
 	if msg.Type == "join" {
 		updated := addNode(msg.Sender)
@@ -245,6 +253,14 @@ func addNode(n NodeInfo) bool {
 	}
 
 	updated := false
+	if cur.ClusterName != n.ClusterName {
+		cur.ClusterName = n.ClusterName
+		updated = true
+	}
+	if cur.Region != n.Region {
+		cur.Region = n.Region
+		updated = true
+	}
 	if cur.NodeRole == "" && n.NodeRole != "" {
 		cur.NodeRole = n.NodeRole
 		updated = true
@@ -293,49 +309,110 @@ func markNodeHeardWithState(id string) bool {
 func guessRoleFromID(id string) string {
 	switch {
 	case reMonitor.MatchString(id):
-		return "IBPMonitor"
+		return RoleMonitor
 	case reDns.MatchString(id):
-		return "IBPDns"
+		return RoleDns
 	default:
 		return ""
 	}
 }
 
+// -----------------------------------------------------------------------------
+// NODE LISTING
+// -----------------------------------------------------------------------------
+//
+// These are the supported way for binaries to see the cluster. Every call
+// takes its own snapshot of State under its read lock, so callers must not
+// hold State.Mu; the results are copies and safe to keep.
+
+// Node roles as carried in NodeInfo.NodeRole.
+const (
+	RoleMonitor  = core.RoleMonitor
+	RoleDns      = core.RoleDns
+	RoleCollator = core.RoleCollator
+)
+
+// ActiveNodeWindow is how recently a node must have been heard from to count
+// as active.
+const ActiveNodeWindow = activeNodeWindow
+
+// IsNodeActive reports whether n has an ID and was heard from within
+// ActiveNodeWindow. It does not look at the cluster; see InCluster.
 func IsNodeActive(n NodeInfo) bool {
 	return n.NodeID != "" && !n.LastHeard.IsZero() && time.Since(n.LastHeard) < activeNodeWindow
 }
 
-func CountActiveMonitors() int {
+// InCluster reports whether n belongs to this node's cluster
+// (Nats.ClusterName). Nodes of other clusters never count towards quorum.
+func InCluster(n NodeInfo) bool {
 	State.Mu.RLock()
 	defer State.Mu.RUnlock()
-	n := 0
+	return State.InClusterLocked(n)
+}
+
+// ListNodes returns the known nodes of this cluster with role, sorted by
+// node ID; an empty role matches every node. With activeOnly only nodes
+// passing IsNodeActive are returned. This node is included once it is in
+// the cluster view.
+func ListNodes(role string, activeOnly bool) []NodeInfo {
+	State.Mu.RLock()
+	defer State.Mu.RUnlock()
+	return listNodesLocked(role, activeOnly)
+}
+
+func listNodesLocked(role string, activeOnly bool) []NodeInfo {
+	var out []NodeInfo
 	for _, node := range State.ClusterNodes {
-		if node.NodeRole == "IBPMonitor" && IsNodeActive(node) {
-			n++
+		if role != "" && node.NodeRole != role {
+			continue
 		}
+		if !State.InClusterLocked(node) || (activeOnly && !IsNodeActive(node)) {
+			continue
+		}
+		out = append(out, node)
 	}
-	return n
+	sort.Slice(out, func(i, j int) bool { return out[i].NodeID < out[j].NodeID })
+	return out
 }
 
-func CountActiveDns() int {
+// CountActiveNodes returns len(ListNodes(role, true)).
+func CountActiveNodes(role string) int {
 	State.Mu.RLock()
 	defer State.Mu.RUnlock()
-	n := 0
-	for _, node := range State.ClusterNodes {
-		if node.NodeRole == "IBPDns" && IsNodeActive(node) {
-			n++
-		}
+	return len(listNodesLocked(role, true))
+}
+
+// CountActiveMonitors returns the number of active monitors of this
+// cluster, the count consensus majorities are based on.
+func CountActiveMonitors() int { return CountActiveNodes(RoleMonitor) }
+
+// CountActiveDns returns the number of active DNS nodes of this cluster.
+func CountActiveDns() int { return CountActiveNodes(RoleDns) }
+
+// ActiveNodeIDs lists the active nodes of role in this cluster, sorted. An
+// empty role matches every node.
+func ActiveNodeIDs(role string) []string {
+	var ids []string
+	for _, n := range ListNodes(role, true) {
+		ids = append(ids, n.NodeID)
 	}
-	return n
+	return ids
 }
 
 func StartGarbageCollection() {
 	go func() {
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
-		for range ticker.C {
-			cleanOldProposals()
-			cleanStaleNodes()
+		persist := time.NewTicker(time.Minute)
+		defer persist.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cleanOldProposals()
+				cleanStaleNodes()
+			case <-persist.C:
+				saveAppliedLedgerIfDirty()
+			}
 		}
 	}()
 }
@@ -418,5 +495,6 @@ func cleanStaleNodes() {
 var (
 	countActiveMonitors = CountActiveMonitors
 	countActiveDns      = CountActiveDns
+	activeNodeIDs       = ActiveNodeIDs
 	isNodeActive        = IsNodeActive
 )
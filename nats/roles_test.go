@@ -2,6 +2,7 @@ package nats
 
 import (
 	"encoding/json"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -402,3 +403,47 @@ func TestCleanStaleNodesPurgesVotesForRemovedPeers(t *testing.T) {
 		t.Fatal("expected stale node vote timestamp to be removed when bucket empties")
 	}
 }
+
+func TestListNodesFiltersRoleClusterAndActivity(t *testing.T) {
+	now := time.Now().UTC()
+	State = NodeState{
+		NodeID:   "monitor-b",
+		ThisNode: NodeInfo{NodeID: "monitor-b", NodeRole: RoleMonitor, ClusterName: "prod"},
+		ClusterNodes: map[string]NodeInfo{
+			"monitor-b": {NodeID: "monitor-b", NodeRole: RoleMonitor, ClusterName: "prod", LastHeard: now},
+			"monitor-a": {NodeID: "monitor-a", NodeRole: RoleMonitor, ClusterName: "prod", LastHeard: now},
+			"monitor-c": {NodeID: "monitor-c", NodeRole: RoleMonitor, ClusterName: "prod", LastHeard: now.Add(-ActiveNodeWindow - time.Minute)},
+			"monitor-x": {NodeID: "monitor-x", NodeRole: RoleMonitor, ClusterName: "staging", LastHeard: now},
+			"dns-1":     {NodeID: "dns-1", NodeRole: RoleDns, ClusterName: "prod", LastHeard: now},
+		},
+	}
+
+	ids := func(nodes []NodeInfo) string {
+		var out []string
+		for _, n := range nodes {
+			out = append(out, n.NodeID)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := ids(ListNodes(RoleMonitor, true)); got != "monitor-a,monitor-b" {
+		t.Fatalf("active monitors = %q", got)
+	}
+	if got := ids(ListNodes(RoleMonitor, false)); got != "monitor-a,monitor-b,monitor-c" {
+		t.Fatalf("all monitors = %q", got)
+	}
+	if got := ids(ListNodes("", true)); got != "dns-1,monitor-a,monitor-b" {
+		t.Fatalf("all active nodes = %q", got)
+	}
+	if got := CountActiveMonitors(); got != 2 {
+		t.Fatalf("CountActiveMonitors() = %d, want 2", got)
+	}
+	if got := CountActiveDns(); got != 1 {
+		t.Fatalf("CountActiveDns() = %d, want 1", got)
+	}
+	if InCluster(State.ClusterNodes["monitor-x"]) {
+		t.Fatal("node of another cluster reported in cluster")
+	}
+	if ActiveNodeIDs(RoleCollator) != nil {
+		t.Fatal("expected no collators")
+	}
+}
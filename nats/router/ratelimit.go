@@ -0,0 +1,137 @@
+package router
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+
+	"github.com/nats-io/nats.go"
+)
+
+// -----------------------------------------------------------------------------
+// RATE LIMITING
+// -----------------------------------------------------------------------------
+//
+// A Limiter keeps one token bucket per subscription pattern and sender, so a
+// peer flooding a request subject is cut off without affecting the other
+// peers or subjects. Buckets that have refilled are dropped after a while to
+// keep the table bounded.
+
+// Limit is a token bucket: Burst messages at once, refilled at PerSecond.
+type Limit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// RejectFunc is called for every message a Limiter turns away.
+type RejectFunc func(msg *nats.Msg, sender string)
+
+const limiterSweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type bucketKey struct {
+	pattern string
+	sender  string
+}
+
+// Limiter applies per-sender limits to subscription patterns.
+type Limiter struct {
+	mu        sync.Mutex
+	limits    map[string]Limit
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewLimiter returns a limiter for the given subscription patterns. Patterns
+// without a positive rate are not limited.
+func NewLimiter(limits map[string]Limit) *Limiter {
+	l := &Limiter{
+		limits:  make(map[string]Limit, len(limits)),
+		buckets: make(map[bucketKey]*bucket),
+		now:     time.Now,
+	}
+	for pattern, lim := range limits {
+		if lim.PerSecond <= 0 {
+			continue
+		}
+		if lim.Burst < 1 {
+			lim.Burst = 1
+		}
+		l.limits[pattern] = lim
+	}
+	return l
+}
+
+// Allow takes a token from the bucket of pattern and sender and reports
+// whether one was available.
+func (l *Limiter) Allow(pattern, sender string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lim, ok := l.limits[pattern]
+	if !ok {
+		return true
+	}
+	now := l.now()
+	l.sweep(now)
+
+	k := bucketKey{pattern: pattern, sender: sender}
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &bucket{tokens: float64(lim.Burst), last: now}
+		l.buckets[k] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(float64(lim.Burst), b.tokens+elapsed*lim.PerSecond)
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep drops buckets that have been idle long enough to be full again.
+// Callers hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < limiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for k, b := range l.buckets {
+		lim := l.limits[k.pattern]
+		full := time.Duration(float64(lim.Burst) / lim.PerSecond * float64(time.Second))
+		if now.Sub(b.last) > full {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// Sender identifies the node a message came from: its core.SenderHeader,
+// else the reply inbox without its last token (the requesting connection),
+// else "unknown".
+func Sender(msg *nats.Msg) string {
+	if msg.Header != nil {
+		if s := msg.Header.Get(core.SenderHeader); s != "" {
+			return s
+		}
+	}
+	if i := strings.LastIndexByte(msg.Reply, '.'); i > 0 {
+		return msg.Reply[:i]
+	}
+	if msg.Reply != "" {
+		return msg.Reply
+	}
+	return "unknown"
+}
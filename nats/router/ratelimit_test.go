@@ -0,0 +1,90 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestLimiterBucketsPerSender(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewLimiter(map[string]Limit{"dns.usage.getUsage": {PerSecond: 2, Burst: 3}})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("dns.usage.getUsage", "a") {
+			t.Fatalf("expected request %d within the burst to pass", i+1)
+		}
+	}
+	if l.Allow("dns.usage.getUsage", "a") {
+		t.Fatal("expected the fourth request to be limited")
+	}
+	if !l.Allow("dns.usage.getUsage", "b") {
+		t.Fatal("expected another sender to have its own bucket")
+	}
+	if !l.Allow("monitor.latency", "a") {
+		t.Fatal("expected subjects without a limit to pass")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !l.Allow("dns.usage.getUsage", "a") || l.Allow("dns.usage.getUsage", "a") {
+		t.Fatal("expected one token to be refilled after half a second")
+	}
+
+	now = now.Add(2 * time.Minute)
+	l.Allow("dns.usage.getUsage", "c") // sweeps before adding its bucket
+	if len(l.buckets) != 1 {
+		t.Fatalf("expected idle buckets to be swept, got %d", len(l.buckets))
+	}
+
+	if !(*Limiter)(nil).Allow("dns.usage.getUsage", "a") {
+		t.Fatal("expected a nil limiter to allow everything")
+	}
+}
+
+func TestDispatchRejectsOverLimit(t *testing.T) {
+	handled, rejected := 0, 0
+	var rejectedBy string
+	reg := New()
+	reg.Register("A", stubModule{name: "a", subs: []Subscription{
+		{Subject: "dns.usage.*", Handler: func(*nats.Msg) { handled++ }},
+	}})
+	reg.SetLimiter(NewLimiter(map[string]Limit{"dns.usage.*": {PerSecond: 0.001, Burst: 1}}), func(_ *nats.Msg, sender string) {
+		rejected++
+		rejectedBy = sender
+	})
+
+	msg := &nats.Msg{Subject: "dns.usage.getUsage", Header: nats.Header{core.SenderHeader: []string{"collator-1"}}}
+	reg.Dispatch("A", msg)
+	if !reg.Dispatch("A", msg) {
+		t.Fatal("expected a rejected message to count as routed")
+	}
+	if handled != 1 || rejected != 1 || rejectedBy != "collator-1" {
+		t.Fatalf("expected one handled and one rejected message from collator-1, got %d/%d from %q", handled, rejected, rejectedBy)
+	}
+
+	reg.SetLimiter(nil, nil)
+	reg.Dispatch("A", msg)
+	if handled != 2 {
+		t.Fatalf("expected removing the limiter to lift the limit, got %d handled", handled)
+	}
+}
+
+func TestSender(t *testing.T) {
+	for _, tc := range []struct {
+		msg  *nats.Msg
+		want string
+	}{
+		{&nats.Msg{Header: nats.Header{core.SenderHeader: []string{"dns-1"}}, Reply: "_INBOX.abc.1"}, "dns-1"},
+		{&nats.Msg{Reply: "_INBOX.abc.1"}, "_INBOX.abc"},
+		{&nats.Msg{Reply: "inbox"}, "inbox"},
+		{&nats.Msg{}, "unknown"},
+	} {
+		if got := Sender(tc.msg); got != tc.want {
+			t.Fatalf("expected sender %q, got %q", tc.want, got)
+		}
+	}
+}
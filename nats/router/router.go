@@ -1,15 +1,29 @@
 package router
 
 import (
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/nats-io/nats.go"
 )
 
-// Module represents a pluggable message handler bound to one or more roles.
+// Subscription binds a subject pattern to a handler. Subject may use NATS
+// wildcards: "*" matches one token and a trailing ">" matches one or more. When
+// Queue is set the subscription joins that NATS queue group, so each message
+// is delivered to only one member of the group.
+type Subscription struct {
+	Subject string
+	Queue   string
+	Handler func(*nats.Msg)
+}
+
+// Module represents a pluggable set of subscriptions bound to one or more
+// roles.
 type Module interface {
 	Name() string
-	Handle(msg *nats.Msg) bool
+	Subscriptions() []Subscription
 }
 
 // Registry stores the mapping between roles and their module stacks.
@@ -17,6 +31,9 @@ type Registry struct {
 	mu          sync.RWMutex
 	roleModules map[string][]Module
 	global      []Module
+	routes      map[string][]Subscription // role → subscriptions by specificity
+	limiter     *Limiter
+	onReject    RejectFunc
 }
 
 // New creates an empty Registry.
@@ -27,11 +44,12 @@ func New() *Registry {
 }
 
 // Register attaches a module to a role. An empty role value registers the
-// module globally (receives all messages regardless of role).
+// module globally (subscribed regardless of role).
 func (r *Registry) Register(role string, mod Module) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	r.routes = nil
 	if role == "" {
 		r.global = append(r.global, mod)
 		return
@@ -40,24 +58,232 @@ func (r *Registry) Register(role string, mod Module) {
 	r.roleModules[role] = append(r.roleModules[role], mod)
 }
 
-// Dispatch emits the message to the registered role modules.
-// It returns true when a module reports handling the message.
-func (r *Registry) Dispatch(role string, msg *nats.Msg) bool {
+// SetLimiter rate-limits Dispatch with l, whose limits are keyed by
+// subscription pattern; onReject is called for every message turned away.
+// A nil l removes rate limiting.
+func (r *Registry) SetLimiter(l *Limiter, onReject RejectFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limiter, r.onReject = l, onReject
+}
+
+// Subscriptions returns the subscriptions of the global modules followed by
+// those of the role's modules. Entries without a subject or handler are
+// skipped.
+func (r *Registry) Subscriptions(role string) []Subscription {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
+	return r.subscriptionsLocked(role)
+}
+
+func (r *Registry) subscriptionsLocked(role string) []Subscription {
+	var out []Subscription
+	collect := func(mods []Module) {
+		for _, mod := range mods {
+			for _, sub := range mod.Subscriptions() {
+				if sub.Subject == "" || sub.Handler == nil {
+					continue
+				}
+				out = append(out, sub)
+			}
+		}
+	}
+	collect(r.global)
+	collect(r.roleModules[role])
+	return out
+}
+
+// Dispatch hands msg to the most specific subscription of role whose pattern
+// matches its subject: exact subjects beat "*" patterns, which beat ">"
+// patterns; ties go to the earliest registration. Messages over the
+// sender's rate limit go to the reject function instead. It reports whether
+// a handler was found.
+func (r *Registry) Dispatch(role string, msg *nats.Msg) bool {
+	if msg == nil {
+		return false
+	}
+	return r.dispatch(r.routesFor(role), msg)
+}
 
-	for _, mod := range r.global {
-		if mod.Handle(msg) {
+// dispatch hands msg to the first route matching its subject; routes are
+// sorted by specificity.
+func (r *Registry) dispatch(routes []Subscription, msg *nats.Msg) bool {
+	var best *Subscription
+	for i := range routes {
+		if Match(routes[i].Subject, msg.Subject) {
+			best = &routes[i]
+			break
+		}
+	}
+	if best == nil {
+		return false
+	}
+	r.mu.RLock()
+	limiter, onReject := r.limiter, r.onReject
+	r.mu.RUnlock()
+	if limiter != nil {
+		if sender := Sender(msg); !limiter.Allow(best.Subject, sender) {
+			if onReject != nil {
+				onReject(msg, sender)
+			}
 			return true
 		}
 	}
+	best.Handler(msg)
+	return true
+}
+
+// routesFor returns the subscriptions of role sorted by specificity, built
+// once per role after each Register.
+func (r *Registry) routesFor(role string) []Subscription {
+	r.mu.RLock()
+	routes, ok := r.routes[role]
+	r.mu.RUnlock()
+	if ok {
+		return routes
+	}
 
-	if mods, ok := r.roleModules[role]; ok {
-		for _, mod := range mods {
-			if mod.Handle(msg) {
-				return true
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if routes, ok := r.routes[role]; ok {
+		return routes
+	}
+	routes = sortRoutes(r.subscriptionsLocked(role))
+	if r.routes == nil {
+		r.routes = make(map[string][]Subscription)
+	}
+	r.routes[role] = routes
+	return routes
+}
+
+// sortRoutes orders subs from the most to the least specific pattern; ties
+// keep registration order.
+func sortRoutes(subs []Subscription) []Subscription {
+	sort.SliceStable(subs, func(i, j int) bool {
+		return specificity(subs[i].Subject) < specificity(subs[j].Subject)
+	})
+	return subs
+}
+
+// Plan returns the NATS subscriptions needed for role. Patterns already
+// covered by a broader pattern in the same queue group are dropped, and each
+// handler dispatches among the subscriptions of its own queue group. A
+// message is therefore handled exactly once per queue group it matches: NATS
+// delivers it once to every group (and once to the ungrouped subscriptions),
+// and each delivery reaches the most specific handler of that group.
+func (r *Registry) Plan(role string) []Subscription {
+	subs := r.Subscriptions(role)
+	byQueue := make(map[string][]Subscription)
+	for _, sub := range subs {
+		byQueue[sub.Queue] = append(byQueue[sub.Queue], sub)
+	}
+	for queue, group := range byQueue {
+		byQueue[queue] = sortRoutes(group)
+	}
+
+	out := make([]Subscription, 0, len(subs))
+	for i, sub := range subs {
+		redundant := false
+		for j, other := range subs {
+			if i == j || other.Queue != sub.Queue || !Covers(other.Subject, sub.Subject) {
+				continue
+			}
+			// Identical patterns keep the first; otherwise the broader wins.
+			if other.Subject != sub.Subject || j < i {
+				redundant = true
+				break
 			}
 		}
+		if redundant {
+			continue
+		}
+		routes := byQueue[sub.Queue]
+		out = append(out, Subscription{
+			Subject: sub.Subject,
+			Queue:   sub.Queue,
+			Handler: func(m *nats.Msg) {
+				if m != nil {
+					r.dispatch(routes, m)
+				}
+			},
+		})
+	}
+	return out
+}
+
+// PanicFunc receives a panic recovered from a handler together with the
+// stack of the panicking goroutine.
+type PanicFunc func(msg *nats.Msg, recovered interface{}, stack []byte)
+
+// Recover wraps handler so a panic, e.g. on a malformed message, is passed to
+// onPanic instead of ending the process. It reports whether handler returned
+// normally.
+func Recover(handler func(*nats.Msg), onPanic PanicFunc) func(*nats.Msg) bool {
+	return func(msg *nats.Msg) (ok bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				ok = false
+				if onPanic != nil {
+					onPanic(msg, r, debug.Stack())
+				}
+			}
+		}()
+		handler(msg)
+		return true
+	}
+}
+
+// -----------------------------------------------------------------------------
+// SUBJECT PATTERNS
+// -----------------------------------------------------------------------------
+
+// Match reports whether subject matches the NATS-style pattern.
+func Match(pattern, subject string) bool {
+	p := strings.Split(pattern, ".")
+	s := strings.Split(subject, ".")
+	for i, tok := range p {
+		if tok == ">" {
+			return i == len(p)-1 && len(s) > i
+		}
+		if i >= len(s) {
+			return false
+		}
+		if tok != "*" && tok != s[i] {
+			return false
+		}
+	}
+	return len(p) == len(s)
+}
+
+// Covers reports whether every subject matched by narrow is also matched by
+// broad.
+func Covers(broad, narrow string) bool {
+	b := strings.Split(broad, ".")
+	n := strings.Split(narrow, ".")
+	for i, tok := range b {
+		if tok == ">" {
+			return i == len(b)-1 && len(n) > i
+		}
+		if i >= len(n) || n[i] == ">" {
+			return false
+		}
+		if tok != "*" && (n[i] == "*" || tok != n[i]) {
+			return false
+		}
+	}
+	return len(b) == len(n)
+}
+
+// specificity ranks a pattern; lower is more specific.
+func specificity(pattern string) int {
+	score := 0
+	for _, tok := range strings.Split(pattern, ".") {
+		switch tok {
+		case ">":
+			score += 1000
+		case "*":
+			score++
+		}
 	}
-	return false
+	return score
 }
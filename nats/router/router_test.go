@@ -0,0 +1,210 @@
+package router
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+type stubModule struct {
+	name string
+	subs []Subscription
+}
+
+func (m stubModule) Name() string                  { return m.name }
+func (m stubModule) Subscriptions() []Subscription { return m.subs }
+
+func TestSubscriptionsCombinesGlobalAndRoleModules(t *testing.T) {
+	noop := func(*nats.Msg) {}
+	reg := New()
+	reg.Register("", stubModule{name: "global", subs: []Subscription{{Subject: "g", Handler: noop}}})
+	reg.Register("A", stubModule{name: "a", subs: []Subscription{
+		{Subject: "a.req", Handler: noop},
+		{Subject: "a.work", Queue: "workers", Handler: noop},
+		{Subject: "", Handler: noop},
+		{Subject: "a.nohandler"},
+	}})
+	reg.Register("B", stubModule{name: "b", subs: []Subscription{{Subject: "b", Handler: noop}}})
+
+	subs := reg.Subscriptions("A")
+	if len(subs) != 3 {
+		t.Fatalf("expected 3 subscriptions, got %+v", subs)
+	}
+	if subs[0].Subject != "g" || subs[1].Subject != "a.req" || subs[2].Subject != "a.work" {
+		t.Fatalf("unexpected order %+v", subs)
+	}
+	if subs[2].Queue != "workers" {
+		t.Fatalf("expected queue group to be preserved, got %q", subs[2].Queue)
+	}
+
+	if got := reg.Subscriptions("unknown"); len(got) != 1 || got[0].Subject != "g" {
+		t.Fatalf("expected only global subscriptions for unknown role, got %+v", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, subject string
+		want             bool
+	}{
+		{"dns.usage.getUsage", "dns.usage.getUsage", true},
+		{"dns.usage.*", "dns.usage.usageData", true},
+		{"dns.usage.*", "dns.usage", false},
+		{"dns.usage.*", "dns.usage.a.b", false},
+		{"_INBOX.*.usageReply.*", "_INBOX.dns-1.usageReply.1700000000", true},
+		{"_INBOX.*.usageReply.*", "_INBOX.mon-1.downtimeReply.1", false},
+		{"dns.>", "dns.usage.getUsage", true},
+		{"dns.>", "dns", false},
+		{">", "anything.at.all", true},
+	}
+	for _, c := range cases {
+		if got := Match(c.pattern, c.subject); got != c.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", c.pattern, c.subject, got, c.want)
+		}
+	}
+}
+
+func TestCovers(t *testing.T) {
+	cases := []struct {
+		broad, narrow string
+		want          bool
+	}{
+		{"dns.usage.*", "dns.usage.getUsage", true},
+		{"dns.>", "dns.usage.*", true},
+		{"dns.*", "dns.>", false},
+		{"dns.usage.getUsage", "dns.usage.*", false},
+		{"dns.usage.*", "dns.usage.*", true},
+	}
+	for _, c := range cases {
+		if got := Covers(c.broad, c.narrow); got != c.want {
+			t.Errorf("Covers(%q, %q) = %v, want %v", c.broad, c.narrow, got, c.want)
+		}
+	}
+}
+
+func TestDispatchPrefersMostSpecificPattern(t *testing.T) {
+	var hit string
+	route := func(name string) func(*nats.Msg) {
+		return func(*nats.Msg) { hit = name }
+	}
+	reg := New()
+	reg.Register("IBPDns", stubModule{name: "dns", subs: []Subscription{
+		{Subject: "dns.>", Handler: route("tail")},
+		{Subject: "dns.usage.*", Handler: route("usage")},
+		{Subject: "dns.usage.getUsage", Handler: route("exact")},
+	}})
+
+	for subject, want := range map[string]string{
+		"dns.usage.getUsage": "exact",
+		"dns.usage.other":    "usage",
+		"dns.health.ping":    "tail",
+	} {
+		hit = ""
+		if !reg.Dispatch("IBPDns", &nats.Msg{Subject: subject}) {
+			t.Fatalf("expected %s to be dispatched", subject)
+		}
+		if hit != want {
+			t.Fatalf("%s: expected %s handler, got %q", subject, want, hit)
+		}
+	}
+
+	if reg.Dispatch("IBPDns", &nats.Msg{Subject: "monitor.stats.getDowntime"}) {
+		t.Fatal("expected unmatched subject not to be dispatched")
+	}
+}
+
+func TestDispatchSeesLaterRegistrations(t *testing.T) {
+	var hit string
+	reg := New()
+	reg.Register("A", stubModule{name: "tail", subs: []Subscription{
+		{Subject: "dns.>", Handler: func(*nats.Msg) { hit = "tail" }},
+	}})
+	reg.Dispatch("A", &nats.Msg{Subject: "dns.usage.getUsage"})
+	reg.Register("", stubModule{name: "exact", subs: []Subscription{
+		{Subject: "dns.usage.getUsage", Handler: func(*nats.Msg) { hit = "exact" }},
+	}})
+	reg.Dispatch("A", &nats.Msg{Subject: "dns.usage.getUsage"})
+	if hit != "exact" {
+		t.Fatalf("expected the routes to be rebuilt after Register, got %q", hit)
+	}
+}
+
+func TestPlanHandlesOncePerQueueGroup(t *testing.T) {
+	hits := map[string]int{}
+	route := func(name string) func(*nats.Msg) {
+		return func(*nats.Msg) { hits[name]++ }
+	}
+	reg := New()
+	reg.Register("A", stubModule{name: "m", subs: []Subscription{
+		{Subject: "dns.usage.*", Queue: "workers", Handler: route("workers")},
+		{Subject: "dns.usage.getUsage", Handler: route("exact")},
+		{Subject: "dns.>", Handler: route("tail")},
+	}})
+
+	// NATS delivers the message once to every planned subscription it matches.
+	msg := &nats.Msg{Subject: "dns.usage.getUsage"}
+	for _, sub := range reg.Plan("A") {
+		if Match(sub.Subject, msg.Subject) {
+			sub.Handler(msg)
+		}
+	}
+	if hits["workers"] != 1 || hits["exact"] != 1 || hits["tail"] != 0 {
+		t.Fatalf("expected one handler per queue group, got %v", hits)
+	}
+}
+
+func TestPlanDropsCoveredPatterns(t *testing.T) {
+	noop := func(*nats.Msg) {}
+	reg := New()
+	reg.Register("IBPCollator", stubModule{name: "c", subs: []Subscription{
+		{Subject: "dns.usage.usageData", Handler: noop},
+		{Subject: "dns.usage.*", Handler: noop},
+		{Subject: "dns.usage.usageData", Queue: "q", Handler: noop},
+		{Subject: "consensus.vote", Handler: noop},
+		{Subject: "consensus.vote", Handler: noop},
+	}})
+
+	plan := reg.Plan("IBPCollator")
+	got := map[string]bool{}
+	for _, sub := range plan {
+		got[sub.Subject+"|"+sub.Queue] = true
+	}
+	want := []string{"dns.usage.*|", "dns.usage.usageData|q", "consensus.vote|"}
+	if len(plan) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for _, w := range want {
+		if !got[w] {
+			t.Fatalf("expected %s in plan, got %v", w, got)
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var (
+		gotMsg   *nats.Msg
+		gotValue interface{}
+		gotStack []byte
+	)
+	onPanic := func(msg *nats.Msg, r interface{}, stack []byte) {
+		gotMsg, gotValue, gotStack = msg, r, stack
+	}
+
+	msg := &nats.Msg{Subject: "consensus.propose"}
+	h := Recover(func(m *nats.Msg) {
+		var proposals map[string]int
+		proposals[m.Subject]++ // nil map write
+	}, onPanic)
+	if h(msg) {
+		t.Fatal("expected a panicking handler to report failure")
+	}
+	if gotMsg != msg || gotValue == nil || !strings.Contains(string(gotStack), "TestRecover") {
+		t.Fatalf("expected the message, value and stack of the panic, got %v %v", gotMsg, gotValue)
+	}
+
+	called := false
+	if !Recover(func(*nats.Msg) { called = true }, nil)(msg) || !called {
+		t.Fatal("expected a normal handler to run and report success")
+	}
+}
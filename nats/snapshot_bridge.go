@@ -0,0 +1,176 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	modsnapshot "github.com/ibp-network/ibp-geodns-libs/nats/modules/snapshot"
+	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	officialSnapshotInterval = 30 * time.Second
+
+	// officialSyncTimeout bounds one sync request of a starting DNS node;
+	// it retries every officialSyncRetryDelay until a monitor answers or
+	// officialSyncAttempts are used up, after which the periodic broadcast
+	// takes over.
+	officialSyncTimeout    = 3 * time.Second
+	officialSyncRetryDelay = 2 * time.Second
+	officialSyncAttempts   = 10
+
+	// officialResyncInterval spaces the syncs a monitor requests after
+	// missing finalize messages.
+	officialResyncInterval = 30 * time.Second
+)
+
+var (
+	officialSequencer = core.NewSequencer()
+	officialTracker   = core.NewSeqTracker()
+	finalizeSequencer = core.NewSequencer()
+	finalizeTracker   = core.NewSeqTracker()
+
+	sequenceGaps atomic.Uint64
+	lastResync   atomic.Int64 // Unix nanoseconds
+)
+
+// SequenceGaps returns how many finalize messages and official snapshots
+// from other nodes were missed since start-up, judged by their sequence
+// numbers.
+func SequenceGaps() uint64 {
+	return sequenceGaps.Load()
+}
+
+// snapshotDeps is built per call so the subject follows the configured
+// cluster prefix.
+func snapshotDeps() modsnapshot.Dependencies {
+	return modsnapshot.Dependencies{
+		State:               &State,
+		Publish:             Publish,
+		PublishMsg:          PublishMsg,
+		PublishMsgWithReply: PublishMsgWithReply,
+		MarkNodeHeard:       markNodeHeard,
+		Subject:             subjects.With(subjects.MonitorOfficialSnapshot),
+		Sequencer:           officialSequencer,
+		Snapshot:            func() dat.Snapshot { return dat.BuildSnapshot(dat.GetOfficialResults()) },
+		Tracker:             officialTracker,
+		Apply:               dat.ReplaceOfficialResults,
+		OnGap:               func(_ string, missed uint64) { sequenceGaps.Add(missed) },
+	}
+}
+
+func handleOfficialSyncRequest(m *nats.Msg) {
+	modsnapshot.HandleSyncRequest(core.ContextFromMsg(m), snapshotDeps(), m.Data, m.Reply)
+}
+
+func handleOfficialSnapshot(m *nats.Msg) {
+	ctx := core.ContextFromMsg(m)
+	if _, err := modsnapshot.Handle(ctx, snapshotDeps(), m.Data); err != nil {
+		log.LogCtx(ctx, log.Warn, "[NATS] official snapshot: %v", err)
+	}
+}
+
+// RequestOfficialSync asks the monitors for the official results and
+// applies the first answer. It reports whether a snapshot was applied; a
+// stale answer is not an error.
+func RequestOfficialSync(timeout time.Duration) (bool, error) {
+	State.Mu.RLock()
+	payload, err := json.Marshal(modsnapshot.SyncRequest{NodeID: State.NodeID})
+	State.Mu.RUnlock()
+	if err != nil {
+		return false, fmt.Errorf("official sync: %w", err)
+	}
+	msg, err := Request(subjects.With(subjects.MonitorOfficialSync), payload, timeout)
+	if err != nil {
+		return false, fmt.Errorf("official sync: %w", err)
+	}
+	return modsnapshot.Handle(core.ContextFromMsg(msg), snapshotDeps(), msg.Data)
+}
+
+// isSnapshotPublisher reports whether this monitor broadcasts the official
+// snapshot: the first active monitor by node ID.
+func isSnapshotPublisher() bool {
+	ids := activeNodeIDs(RoleMonitor)
+	State.Mu.RLock()
+	self := State.NodeID
+	State.Mu.RUnlock()
+	return len(ids) > 0 && ids[0] == self
+}
+
+var officialPublisherOnce sync.Once
+
+// startOfficialSnapshotPublisher broadcasts the official results every
+// officialSnapshotInterval while this monitor is the publisher.
+func startOfficialSnapshotPublisher() {
+	officialPublisherOnce.Do(func() {
+		go func() {
+			t := time.NewTicker(officialSnapshotInterval)
+			defer t.Stop()
+			for range t.C {
+				if !isSnapshotPublisher() {
+					continue
+				}
+				if _, err := modsnapshot.Publish(snapshotDeps()); err != nil {
+					log.Log(log.Warn, "[NATS] official snapshot publish failed: %v", err)
+				}
+			}
+		}()
+	})
+}
+
+var officialSyncOnce sync.Once
+
+// startOfficialSync fetches the official results once when a DNS node
+// starts, so it does not wait for the next broadcast or finalize.
+func startOfficialSync() {
+	officialSyncOnce.Do(func() {
+		go func() {
+			for i := 0; i < officialSyncAttempts; i++ {
+				applied, err := RequestOfficialSync(officialSyncTimeout)
+				if err == nil {
+					log.Log(log.Info, "[NATS] official results synced from monitors (applied=%v)", applied)
+					return
+				}
+				log.Log(log.Debug, "[NATS] official sync attempt %d/%d: %v", i+1, officialSyncAttempts, err)
+				time.Sleep(officialSyncRetryDelay)
+			}
+			log.Log(log.Warn, "[NATS] official sync gave up after %d attempts; waiting for broadcasts", officialSyncAttempts)
+		}()
+	})
+}
+
+// onFinalizeGap counts missed finalize messages. A monitor that missed some
+// may hold stale official results, so it resyncs them from the other
+// monitors, at most once per officialResyncInterval. Collators only count:
+// the events of missed finalize messages cannot be rebuilt from a snapshot.
+func onFinalizeGap(sender string, missed uint64) {
+	sequenceGaps.Add(missed)
+	State.Mu.RLock()
+	role := State.ThisNode.NodeRole
+	State.Mu.RUnlock()
+	if role != RoleMonitor {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	last := lastResync.Load()
+	if now-last < int64(officialResyncInterval) || !lastResync.CompareAndSwap(last, now) {
+		return
+	}
+	go func() {
+		applied, err := RequestOfficialSync(officialSyncTimeout)
+		if err != nil {
+			log.Log(log.Warn, "[NATS] resync after missed finalize from %s: %v", sender, err)
+			return
+		}
+		log.Log(log.Info, "[NATS] resynced official results after missed finalize from %s (applied=%v)", sender, applied)
+	}()
+}
@@ -0,0 +1,26 @@
+package nats
+
+import "testing"
+
+func TestOnFinalizeGapCountsAndResyncsOnlyMonitors(t *testing.T) {
+	State.Mu.Lock()
+	prevRole := State.ThisNode.NodeRole
+	State.ThisNode.NodeRole = "IBPCollator"
+	State.Mu.Unlock()
+	defer func() {
+		State.Mu.Lock()
+		State.ThisNode.NodeRole = prevRole
+		State.Mu.Unlock()
+	}()
+	prevResync := lastResync.Load()
+	defer lastResync.Store(prevResync)
+
+	before := SequenceGaps()
+	onFinalizeGap("monitor-b", 3)
+	if got := SequenceGaps() - before; got != 3 {
+		t.Fatalf("expected 3 gaps counted, got %d", got)
+	}
+	if lastResync.Load() != prevResync {
+		t.Fatal("expected a collator not to request a resync")
+	}
+}
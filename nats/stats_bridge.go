@@ -3,30 +3,54 @@ package nats
 import (
 	"time"
 
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
 	modstats "github.com/ibp-network/ibp-geodns-libs/nats/modules/stats"
 	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
 
 	"github.com/nats-io/nats.go"
 )
 
-var statsDeps = modstats.Dependencies{
-	State:               &State,
-	Publish:             Publish,
-	PublishMsgWithReply: PublishMsgWithReply,
-	Subscribe:           Subscribe,
-	CountActiveMonitors: countActiveMonitors,
-	MarkNodeHeard:       markNodeHeard,
-	StatsDataSubject:    subjects.MonitorStatsData,
+// statsDeps is built per call so the data subject follows the configured
+// cluster prefix.
+func statsDeps() modstats.Dependencies {
+	return modstats.Dependencies{
+		State:               &State,
+		Publish:             Publish,
+		PublishMsgWithReply: PublishMsgWithReply,
+		PublishMsg:          PublishMsg,
+		Subscribe:           Subscribe,
+		CountActiveMonitors: countActiveMonitors,
+		ActiveMonitorNodes:  func() []string { return activeNodeIDs(RoleMonitor) },
+		MarkNodeHeard:       markNodeHeard,
+		StatsDataSubject:    subjects.With(subjects.MonitorStatsData),
+	}
 }
 
 func handleMonitorStatsRequest(m *nats.Msg) {
-	modstats.HandleRequest(statsDeps, m.Reply, m.Data)
+	modstats.HandleRequestContext(core.ContextFromMsg(m), statsDeps(), m.Reply, m.Data)
 }
 
 func handleMonitorStatsData(m *nats.Msg) {
-	modstats.HandleData(statsDeps, m.Data)
+	modstats.HandleDataContext(core.ContextFromMsg(m), statsDeps(), m.Data)
 }
 
 func RequestAllMonitorsDowntime(req DowntimeRequest, timeout time.Duration) ([]DowntimeEvent, error) {
-	return modstats.RequestAll(statsDeps, req, timeout, subjects.MonitorStatsRequest)
+	return modstats.RequestAll(statsDeps(), req, timeout, subjects.With(subjects.MonitorStatsRequest))
+}
+
+// RequestAllMonitorsDowntimeDetailed is RequestAllMonitorsDowntime with per-node reply status.
+// Nodes still missing at timeout get grace more time to answer.
+func RequestAllMonitorsDowntimeDetailed(req DowntimeRequest, timeout, grace time.Duration) (DowntimeReport, error) {
+	return modstats.RequestAllDetailed(statsDeps(), req, timeout, grace, subjects.With(subjects.MonitorStatsRequest))
+}
+
+func handleMonitorStatusRequest(m *nats.Msg) {
+	modstats.HandleStatusRequestContext(core.ContextFromMsg(m), statsDeps(), m.Reply, m.Data)
+}
+
+// RequestAllMonitorsStatus asks every active monitor for the current official
+// status of each member check, of req.MemberName when set. Nodes still
+// missing at timeout get grace more time to answer.
+func RequestAllMonitorsStatus(req StatusRequest, timeout, grace time.Duration) (StatusReport, error) {
+	return modstats.RequestAllStatus(statsDeps(), req, timeout, grace, subjects.With(subjects.MonitorStatusRequest))
 }
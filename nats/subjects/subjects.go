@@ -1,9 +1,97 @@
 package subjects
 
+import (
+	"strings"
+	"sync"
+)
+
+// Consensus subjects shared by monitors and collators.
+const (
+	ConsensusPropose  = "consensus.propose"
+	ConsensusVote     = "consensus.vote"
+	ConsensusFinalize = "consensus.finalize"
+	ConsensusCluster  = "consensus.cluster"
+)
+
+// Data collection subjects.
 const (
 	MonitorStatsRequest = "monitor.stats.getDowntime"
 	MonitorStatsData    = "monitor.stats.downtimeData"
+	// MonitorStatusRequest asks monitors for the current official status
+	// of every member check.
+	MonitorStatusRequest = "monitor.stats.getStatus"
+
+	// MonitorLatency carries monitors' response time measurements to
+	// collators and DNS nodes.
+	MonitorLatency = "monitor.latency"
+
+	// MonitorOfficialSnapshot carries the official results from monitors to
+	// DNS nodes; MonitorOfficialSync requests them on demand.
+	MonitorOfficialSnapshot = "monitor.official.snapshot"
+	MonitorOfficialSync     = "monitor.official.sync"
 
 	DnsUsageRequest = "dns.usage.getUsage"
 	DnsUsageData    = "dns.usage.usageData"
+	// DnsUsageLive carries DNS nodes' per-minute hit counts to dashboards.
+	DnsUsageLive = "dns.usage.live"
+
+	// ClusterNodeStatus is answered by every node regardless of role.
+	ClusterNodeStatus = "cluster.nodeStatus"
+
+	// CollatorProposalHistory queries the proposal history of a collator.
+	CollatorProposalHistory = "collator.proposals.history"
+	// CollatorEventAction closes, annotates or reclassifies a stored event.
+	CollatorEventAction = "collator.events.action"
+	// CollatorMaintenance declares a member maintenance window.
+	CollatorMaintenance = "collator.maintenance.declare"
+
+	// MonitorEventsStream carries the outages collators open and close, for
+	// external consumers.
+	MonitorEventsStream = "monitor.events.stream"
 )
+
+// Queue groups for subjects whose messages are work items handled by any one
+// node of a role.
+const (
+	CollatorQueue = "ibp.collator"
+)
+
+// -----------------------------------------------------------------------------
+// CLUSTER PREFIX
+// -----------------------------------------------------------------------------
+//
+// The constants above are logical names. Every subject that goes on the wire
+// is passed through With, which prepends the configured cluster prefix so
+// several environments (e.g. "prod" and "staging") can share one NATS server
+// without seeing each other's traffic.
+
+var (
+	prefixMu sync.RWMutex
+	prefix   string
+)
+
+// SetPrefix sets the cluster prefix. Surrounding dots and whitespace are
+// ignored; an empty prefix leaves subjects unchanged.
+func SetPrefix(p string) {
+	p = strings.Trim(strings.TrimSpace(p), ".")
+	prefixMu.Lock()
+	prefix = p
+	prefixMu.Unlock()
+}
+
+// Prefix returns the configured cluster prefix.
+func Prefix() string {
+	prefixMu.RLock()
+	defer prefixMu.RUnlock()
+	return prefix
+}
+
+// With returns subject qualified with the cluster prefix, e.g.
+// "prod.consensus.propose".
+func With(subject string) string {
+	p := Prefix()
+	if p == "" || subject == "" {
+		return subject
+	}
+	return p + "." + subject
+}
@@ -0,0 +1,22 @@
+package subjects
+
+import "testing"
+
+func TestWithPrefix(t *testing.T) {
+	defer SetPrefix("")
+
+	if got := With(ConsensusPropose); got != "consensus.propose" {
+		t.Fatalf("expected unprefixed subject, got %q", got)
+	}
+
+	SetPrefix(" .prod. ")
+	if Prefix() != "prod" {
+		t.Fatalf("expected trimmed prefix, got %q", Prefix())
+	}
+	if got := With(ConsensusPropose); got != "prod.consensus.propose" {
+		t.Fatalf("expected prefixed subject, got %q", got)
+	}
+	if got := With(""); got != "" {
+		t.Fatalf("expected empty subject to stay empty, got %q", got)
+	}
+}
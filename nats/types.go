@@ -2,6 +2,11 @@ package nats
 
 import (
 	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core/fanout"
+	modconsensus "github.com/ibp-network/ibp-geodns-libs/nats/modules/consensus"
+	modnodestatus "github.com/ibp-network/ibp-geodns-libs/nats/modules/nodestatus"
+	modstats "github.com/ibp-network/ibp-geodns-libs/nats/modules/stats"
+	modusage "github.com/ibp-network/ibp-geodns-libs/nats/modules/usage"
 )
 
 type UsageRequest = core.UsageRequest
@@ -19,5 +24,19 @@ type DowntimeRequest = core.DowntimeRequest
 type DowntimeEvent = core.DowntimeEvent
 type DowntimeResponse = core.DowntimeResponse
 type ClusterMessage = core.ClusterMessage
+type NodeReplyStatus = fanout.NodeStatus
+type DnsUsageReport = modusage.Report
+type DowntimeReport = modstats.Report
+type StatusRequest = core.StatusRequest
+type MemberCheckStatus = core.MemberCheckStatus
+type StatusResponse = core.StatusResponse
+type StatusReport = modstats.StatusReport
+type NodeStatusResponse = core.NodeStatusResponse
+type LiveUsageReport = core.LiveUsageReport
+type LiveUsageCount = core.LiveUsageCount
+type OutageEvent = core.OutageEvent
+type NodeStatusReport = modnodestatus.Report
+type LaneStats = modconsensus.LaneStats
+type TimeoutStats = modconsensus.TimeoutStats
 
 var State NodeState
@@ -0,0 +1,144 @@
+package nats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// USAGE ANOMALY DETECTION
+// -----------------------------------------------------------------------------
+//
+// Daily counts hide a flood that lasts an hour. After every collection the
+// collator compares the last complete hour's hits per ASN and per country
+// with the value's average hour over the trailing Alerts.UsageAnomaly
+// baseline. A value at Factor times its baseline, and at least MinHits, is
+// stored in usage_anomalies and alerted once; a value with no baseline
+// counts as one hit per hour, so a new source needs MinHits to alert.
+
+const (
+	defaultAnomalyBaselineDays = 7
+	defaultAnomalyFactor       = 5
+	defaultAnomalyMinHits      = 1000
+)
+
+var (
+	usageHitsBy          = data2.UsageHitsBy
+	recordUsageAnomaly   = data2.RecordUsageAnomaly
+	dispatchUsageAnomaly = alerts.UsageAnomaly
+)
+
+// anomalySettings returns c with its defaults filled in.
+func anomalySettings(c cfg.UsageAnomalyConfig) cfg.UsageAnomalyConfig {
+	if c.BaselineDays <= 0 {
+		c.BaselineDays = defaultAnomalyBaselineDays
+	}
+	if c.Factor <= 1 {
+		c.Factor = defaultAnomalyFactor
+	}
+	if c.MinHits <= 0 {
+		c.MinHits = defaultAnomalyMinHits
+	}
+	var dims []string
+	for _, d := range c.Dimensions {
+		if d = strings.ToLower(strings.TrimSpace(d)); d == data2.AnomalyASN || d == data2.AnomalyCountry {
+			dims = append(dims, d)
+		}
+	}
+	if len(dims) == 0 {
+		dims = []string{data2.AnomalyASN, data2.AnomalyCountry}
+	}
+	c.Dimensions = dims
+	return c
+}
+
+// findUsageAnomalies compares the hits of hour with baseline, the total
+// hits of each value over baselineHours, and returns the spikes, highest
+// ratio first.
+func findUsageAnomalies(c cfg.UsageAnomalyConfig, dimension string, hour time.Time,
+	hits, baseline map[string]int64, baselineHours int) []data2.UsageAnomaly {
+	var out []data2.UsageAnomaly
+	for value, n := range hits {
+		if n < c.MinHits || value == "" {
+			continue
+		}
+		avg := float64(baseline[value]) / float64(baselineHours)
+		ratio := float64(n) / max(avg, 1)
+		if ratio < c.Factor {
+			continue
+		}
+		out = append(out, data2.UsageAnomaly{
+			Hour:      hour,
+			Dimension: dimension,
+			Value:     value,
+			Hits:      n,
+			Baseline:  avg,
+			Ratio:     ratio,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Ratio != out[j].Ratio {
+			return out[i].Ratio > out[j].Ratio
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
+
+// DetectUsageAnomalies checks hour against the trailing baseline, stores
+// new anomalies and alerts them. It returns the anomalies found, stored
+// before or not.
+func DetectUsageAnomalies(hour time.Time) ([]data2.UsageAnomaly, error) {
+	c := cfg.GetConfig().Alerts.UsageAnomaly
+	if !c.Enabled {
+		return nil, nil
+	}
+	c = anomalySettings(c)
+	hour = hour.UTC().Truncate(time.Hour)
+	baselineHours := c.BaselineDays * 24
+	now := time.Now().UTC()
+
+	var found []data2.UsageAnomaly
+	for _, dim := range c.Dimensions {
+		hits, err := usageHitsBy(dim, hour, hour.Add(time.Hour))
+		if err != nil {
+			return found, err
+		}
+		baseline, err := usageHitsBy(dim, hour.Add(-time.Duration(baselineHours)*time.Hour), hour)
+		if err != nil {
+			return found, err
+		}
+		for _, a := range findUsageAnomalies(c, dim, hour, hits, baseline, baselineHours) {
+			a.DetectedAt = now
+			found = append(found, a)
+			fresh, err := recordUsageAnomaly(a)
+			if err != nil {
+				return found, err
+			}
+			if !fresh {
+				continue
+			}
+			msg := fmt.Sprintf("%d hits from %s %s in %s, %.1f× the %d-day hourly average of %.0f",
+				a.Hits, dim, a.Value, hour.Format("2006-01-02 15:00 UTC"), a.Ratio, c.BaselineDays, a.Baseline)
+			log.Log(log.Warn, "[collator] usage anomaly: %s", msg)
+			dispatchUsageAnomaly(dim, a.Value, hour, msg)
+		}
+	}
+	return found, nil
+}
+
+// detectLastHourAnomalies runs DetectUsageAnomalies on the last complete
+// hour.
+func detectLastHourAnomalies() {
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+	if _, err := DetectUsageAnomalies(hour); err != nil {
+		log.Log(log.Error, "[collator] usage anomaly detection for %s: %v", hour.Format(time.RFC3339), err)
+	}
+}
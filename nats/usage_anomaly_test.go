@@ -0,0 +1,62 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+)
+
+func TestDetectUsageAnomaliesStoresAndAlertsSpikesOnce(t *testing.T) {
+	prevHits, prevRecord, prevDispatch := usageHitsBy, recordUsageAnomaly, dispatchUsageAnomaly
+	prevCfg := cfg.SetConfig(cfg.Config{Alerts: cfg.AlertsConfig{UsageAnomaly: cfg.UsageAnomalyConfig{
+		Enabled: true, BaselineDays: 1, Factor: 4, MinHits: 100, Dimensions: []string{"ASN"},
+	}}})
+	defer func() {
+		usageHitsBy, recordUsageAnomaly, dispatchUsageAnomaly = prevHits, prevRecord, prevDispatch
+		cfg.SetConfig(prevCfg)
+	}()
+
+	hour := time.Date(2025, 3, 1, 14, 0, 0, 0, time.UTC)
+	usageHitsBy = func(dim string, from, to time.Time) (map[string]int64, error) {
+		if dim != data2.AnomalyASN {
+			t.Fatalf("unexpected dimension %q", dim)
+		}
+		if from.Equal(hour) {
+			// AS1 spikes, AS2 is steady, AS3 is new but small, AS4 is new and large.
+			return map[string]int64{"AS1": 2000, "AS2": 500, "AS3": 50, "AS4": 300}, nil
+		}
+		if !from.Equal(hour.Add(-24*time.Hour)) || !to.Equal(hour) {
+			t.Fatalf("unexpected baseline window %s - %s", from, to)
+		}
+		return map[string]int64{"AS1": 24 * 100, "AS2": 24 * 400}, nil
+	}
+	stored := map[string]bool{}
+	recordUsageAnomaly = func(a data2.UsageAnomaly) (bool, error) {
+		fresh := !stored[a.Value]
+		stored[a.Value] = true
+		return fresh, nil
+	}
+	var alerted []string
+	dispatchUsageAnomaly = func(dim, value string, h time.Time, _ string) {
+		if !h.Equal(hour) {
+			t.Fatalf("alert for hour %s", h)
+		}
+		alerted = append(alerted, dim+" "+value)
+	}
+
+	found, err := DetectUsageAnomalies(hour.Add(30 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].Value != "AS4" || found[1].Value != "AS1" || found[1].Ratio != 20 {
+		t.Fatalf("found = %+v", found)
+	}
+	if _, err := DetectUsageAnomalies(hour); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerted) != 2 || alerted[0] != "asn AS4" || alerted[1] != "asn AS1" {
+		t.Fatalf("expected one alert per anomaly, got %v", alerted)
+	}
+}
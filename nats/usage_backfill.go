@@ -0,0 +1,162 @@
+package nats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/store"
+)
+
+// -----------------------------------------------------------------------------
+// USAGE BACKFILL
+// -----------------------------------------------------------------------------
+//
+// The hourly collector only asks for the current day, so days the collator
+// was down stay missing. Backfill re-requests past days from every DNS
+// node and stores them with the usage store's Replace, which overwrites a
+// row's hits rather than adding to them: a day can be backfilled any number
+// of times, and days already collected come out unchanged.
+
+// maxBackfillDays bounds one backfill; DNS nodes answer a day at a time.
+const maxBackfillDays = 62
+
+// ErrBackfillRunning is returned while another backfill is in progress.
+var ErrBackfillRunning = errors.New("usage backfill already running")
+
+// BackfillDay is the outcome of one backfilled day.
+type BackfillDay struct {
+	Date        string   `json:"date"`
+	Records     int      `json:"records"`
+	Hits        int64    `json:"hits"`
+	Nodes       int      `json:"nodes"`
+	Unreachable []string `json:"unreachable,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// BackfillReport is the outcome of a backfill, one entry per day.
+type BackfillReport struct {
+	Start string        `json:"start"`
+	End   string        `json:"end"`
+	Days  []BackfillDay `json:"days"`
+}
+
+var (
+	backfillMu    sync.Mutex
+	storeBackfill = func(recs []data2.UsageRecord) error { return store.Default().Usage.Replace(recs) }
+)
+
+// Backfill re-collects the usage of every day from start to end from the
+// DNS nodes and stores it. A failed day is reported and the next one
+// tried; the error is for a range that cannot be run at all.
+func Backfill(start, end time.Time) (BackfillReport, error) {
+	start, end = start.UTC().Truncate(24*time.Hour), end.UTC().Truncate(24*time.Hour)
+	rep := BackfillReport{Start: start.Format("2006-01-02"), End: end.Format("2006-01-02")}
+	switch {
+	case end.Before(start):
+		return rep, fmt.Errorf("backfill end %s is before start %s", rep.End, rep.Start)
+	case end.After(time.Now().UTC()):
+		return rep, fmt.Errorf("backfill end %s is in the future", rep.End)
+	case end.Sub(start) >= maxBackfillDays*24*time.Hour:
+		return rep, fmt.Errorf("backfill of more than %d days", maxBackfillDays)
+	}
+	if !backfillMu.TryLock() {
+		return rep, ErrBackfillRunning
+	}
+	defer backfillMu.Unlock()
+
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		d := backfillDay(day)
+		if d.Error != "" {
+			log.Log(log.Error, "[collator] usage backfill %s: %s", d.Date, d.Error)
+		} else {
+			log.Log(log.Info, "[collator] usage backfill %s: %d records, %d hits from %d nodes (%d unreachable)",
+				d.Date, d.Records, d.Hits, d.Nodes, len(d.Unreachable))
+		}
+		rep.Days = append(rep.Days, d)
+	}
+	return rep, nil
+}
+
+func backfillDay(day time.Time) BackfillDay {
+	d := BackfillDay{Date: day.Format("2006-01-02")}
+	report, err := requestDayUsage(data2.UsageRequest{StartDate: d.Date, EndDate: d.Date}, 30*time.Second, 15*time.Second)
+	if err != nil {
+		d.Error = fmt.Sprintf("request usage: %v", err)
+		return d
+	}
+	for _, st := range report.Nodes {
+		d.Nodes++
+		if !st.OK() {
+			d.Unreachable = append(d.Unreachable, st.NodeID)
+		}
+	}
+
+	records := make([]data2.UsageRecord, 0, len(report.Records))
+	for _, r := range report.Records {
+		rec, err := buildUsageRecord(r.NodeID, r)
+		if err != nil || rec.Date.Format("2006-01-02") != d.Date {
+			continue
+		}
+		records = append(records, rec)
+		d.Hits += int64(rec.Hits)
+	}
+	d.Records = len(records)
+	if len(records) == 0 {
+		return d
+	}
+	if err := storeBackfill(records); err != nil {
+		d.Error = fmt.Sprintf("store usage: %v", err)
+	}
+	return d
+}
+
+// BackfillHandler runs a backfill for the management API: POST
+// {"start":"2006-01-02","end":"2006-01-02"} returns the BackfillReport once
+// every day is done, 409 while another backfill runs. Authentication is left
+// to the API that mounts the handler.
+func BackfillHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Start string `json:"start"`
+			End   string `json:"end"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		start, err := parseDateFlexible(req.Start)
+		if err != nil {
+			http.Error(w, "invalid start: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		end := start
+		if req.End != "" {
+			if end, err = parseDateFlexible(req.End); err != nil {
+				http.Error(w, "invalid end: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		rep, err := Backfill(start, end)
+		switch {
+		case errors.Is(err, ErrBackfillRunning):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rep)
+	})
+}
@@ -0,0 +1,60 @@
+package nats
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core/fanout"
+)
+
+func TestBackfillReplacesEveryDayInRange(t *testing.T) {
+	prevRequest, prevStore := requestDayUsage, storeBackfill
+	defer func() { requestDayUsage, storeBackfill = prevRequest, prevStore }()
+
+	requestDayUsage = func(req UsageRequest, _, _ time.Duration) (DnsUsageReport, error) {
+		if req.StartDate != req.EndDate {
+			t.Fatalf("expected one day per request, got %+v", req)
+		}
+		if req.StartDate == "2025-01-05" {
+			return DnsUsageReport{}, errors.New("no responders")
+		}
+		return DnsUsageReport{
+			Records: []UsageRecord{
+				{NodeID: "dns-1", Date: req.StartDate, Domain: "rpc.example", Hits: 7},
+				{NodeID: "dns-2", Date: req.StartDate, Domain: "rpc.example", Hits: 3},
+				{NodeID: "dns-2", Date: "2025-01-01", Domain: "rpc.example", Hits: 99}, // another day
+			},
+			Nodes: []fanout.NodeStatus{{NodeID: "dns-1", Replied: true}, {NodeID: "dns-2", Replied: true}, {NodeID: "dns-3", Error: "timeout"}},
+		}, nil
+	}
+	stored := map[string]int{}
+	storeBackfill = func(recs []data2.UsageRecord) error {
+		for _, r := range recs {
+			stored[r.Date.Format("2006-01-02")] += r.Hits
+		}
+		return nil
+	}
+
+	rep, err := Backfill(time.Date(2025, 1, 4, 12, 0, 0, 0, time.UTC), time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Days) != 3 {
+		t.Fatalf("days = %+v", rep.Days)
+	}
+	if d := rep.Days[0]; d.Date != "2025-01-04" || d.Records != 2 || d.Hits != 10 || d.Nodes != 3 || len(d.Unreachable) != 1 {
+		t.Fatalf("first day = %+v", d)
+	}
+	if rep.Days[1].Error == "" {
+		t.Fatalf("expected the failed day to be reported, got %+v", rep.Days[1])
+	}
+	if stored["2025-01-04"] != 10 || stored["2025-01-06"] != 10 || stored["2025-01-01"] != 0 {
+		t.Fatalf("stored = %v", stored)
+	}
+
+	if _, err := Backfill(time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 4, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatal("expected a reversed range to fail")
+	}
+}
@@ -3,30 +3,43 @@ package nats
 import (
 	"time"
 
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
 	modusage "github.com/ibp-network/ibp-geodns-libs/nats/modules/usage"
 	"github.com/ibp-network/ibp-geodns-libs/nats/subjects"
 
 	"github.com/nats-io/nats.go"
 )
 
-var usageDeps = modusage.Dependencies{
-	State:               &State,
-	Publish:             Publish,
-	PublishMsgWithReply: PublishMsgWithReply,
-	Subscribe:           Subscribe,
-	CountActiveDns:      countActiveDns,
-	MarkNodeHeard:       markNodeHeard,
-	UsageDataSubject:    subjects.DnsUsageData,
+// usageDeps is built per call so the data subject follows the configured
+// cluster prefix.
+func usageDeps() modusage.Dependencies {
+	return modusage.Dependencies{
+		State:               &State,
+		Publish:             Publish,
+		PublishMsgWithReply: PublishMsgWithReply,
+		PublishMsg:          PublishMsg,
+		Subscribe:           Subscribe,
+		CountActiveDns:      countActiveDns,
+		ActiveDnsNodes:      func() []string { return activeNodeIDs(RoleDns) },
+		MarkNodeHeard:       markNodeHeard,
+		UsageDataSubject:    subjects.With(subjects.DnsUsageData),
+	}
 }
 
 func handleDnsUsageRequest(m *nats.Msg) {
-	modusage.HandleRequest(usageDeps, m.Reply, m.Data)
+	modusage.HandleRequestContext(core.ContextFromMsg(m), usageDeps(), m.Reply, m.Data)
 }
 
 func handleDnsUsageData(m *nats.Msg) {
-	modusage.HandleData(usageDeps, m.Data)
+	modusage.HandleDataContext(core.ContextFromMsg(m), usageDeps(), m.Data)
 }
 
 func RequestAllDnsUsage(req UsageRequest, timeout time.Duration) ([]UsageRecord, error) {
-	return modusage.RequestAll(usageDeps, req, timeout, subjects.DnsUsageRequest)
+	return modusage.RequestAll(usageDeps(), req, timeout, subjects.With(subjects.DnsUsageRequest))
+}
+
+// RequestAllDnsUsageDetailed is RequestAllDnsUsage with per-node reply status.
+// Nodes still missing at timeout get grace more time to answer.
+func RequestAllDnsUsageDetailed(req UsageRequest, timeout, grace time.Duration) (DnsUsageReport, error) {
+	return modusage.RequestAllDetailed(usageDeps(), req, timeout, grace, subjects.With(subjects.DnsUsageRequest))
 }
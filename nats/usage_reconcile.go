@@ -0,0 +1,129 @@
+package nats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// USAGE RECONCILIATION
+// -----------------------------------------------------------------------------
+//
+// The hourly collector stores what the DNS nodes answer at that moment; a
+// node that was unreachable, or hits flushed after the last collection of a
+// day, leave the stored rows short of the node's own table. Once a night
+// the collator re-requests the previous day from every DNS node, compares
+// each node's total with the stored rows of that node_id and, where they
+// differ, replaces the node's rows of the day with what it reported. Nodes
+// that do not answer, or answer with no rows, are reported and left alone.
+
+// usageReconcileHour is the UTC hour of the nightly run, leaving DNS nodes
+// time to flush the last hour of the previous day.
+const usageReconcileHour = 1
+
+const (
+	ReconcileOK          = "ok"
+	ReconcileFixed       = "fixed"
+	ReconcileFailed      = "failed"
+	ReconcileUnreachable = "unreachable"
+	ReconcileEmpty       = "empty"
+)
+
+// NodeReconciliation compares one DNS node's reported day with the stored
+// rows.
+type NodeReconciliation struct {
+	NodeID   string `json:"nodeID"`
+	Reported int64  `json:"reported"`
+	Stored   int64  `json:"stored"`
+	Rows     int    `json:"rows"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// UsageReconciliation is the report of one reconciliation run.
+type UsageReconciliation struct {
+	Date  string               `json:"date"`
+	Nodes []NodeReconciliation `json:"nodes"`
+	Fixed int                  `json:"fixed"`
+}
+
+var (
+	requestDayUsage  = RequestAllDnsUsageDetailed
+	storedUsageTotal = data2.UsageNodeTotals
+	replaceNodeUsage = data2.ReplaceNodeUsage
+)
+
+// ReconcileUsage reconciles the stored usage of date with the DNS nodes.
+func ReconcileUsage(date time.Time) (UsageReconciliation, error) {
+	date = date.UTC().Truncate(24 * time.Hour)
+	day := date.Format("2006-01-02")
+	rep := UsageReconciliation{Date: day}
+
+	report, err := requestDayUsage(data2.UsageRequest{StartDate: day, EndDate: day}, 30*time.Second, 15*time.Second)
+	if err != nil {
+		return rep, fmt.Errorf("request usage of %s: %w", day, err)
+	}
+	stored, err := storedUsageTotal(date)
+	if err != nil {
+		return rep, err
+	}
+
+	byNode := make(map[string][]data2.UsageRecord)
+	for _, r := range report.Records {
+		rec, err := buildUsageRecord(r.NodeID, r)
+		if err != nil || rec.Date.Format("2006-01-02") != day {
+			continue
+		}
+		byNode[rec.NodeID] = append(byNode[rec.NodeID], rec)
+	}
+
+	for _, st := range report.Nodes {
+		n := NodeReconciliation{NodeID: st.NodeID, Stored: stored[st.NodeID], Rows: len(byNode[st.NodeID])}
+		for _, r := range byNode[st.NodeID] {
+			n.Reported += int64(r.Hits)
+		}
+		switch {
+		case !st.OK():
+			n.Status, n.Error = ReconcileUnreachable, st.Error
+		case n.Rows == 0:
+			n.Status = ReconcileEmpty
+		case n.Reported == n.Stored:
+			n.Status = ReconcileOK
+		default:
+			if err := replaceNodeUsage(date, st.NodeID, byNode[st.NodeID]); err != nil {
+				n.Status, n.Error = ReconcileFailed, err.Error()
+				break
+			}
+			n.Status = ReconcileFixed
+			rep.Fixed++
+		}
+		rep.Nodes = append(rep.Nodes, n)
+	}
+	sort.Slice(rep.Nodes, func(i, j int) bool { return rep.Nodes[i].NodeID < rep.Nodes[j].NodeID })
+	logUsageReconciliation(rep)
+	return rep, nil
+}
+
+func logUsageReconciliation(rep UsageReconciliation) {
+	for _, n := range rep.Nodes {
+		switch n.Status {
+		case ReconcileOK:
+			continue
+		case ReconcileFixed:
+			log.Log(log.Warn, "[collator] usage reconciliation %s: node %s stored %d hits, reported %d; replaced with %d rows",
+				rep.Date, n.NodeID, n.Stored, n.Reported, n.Rows)
+		case ReconcileEmpty:
+			log.Log(log.Warn, "[collator] usage reconciliation %s: node %s reported no rows (%d stored); left unchanged",
+				rep.Date, n.NodeID, n.Stored)
+		default:
+			log.Log(log.Error, "[collator] usage reconciliation %s: node %s %s: %s",
+				rep.Date, n.NodeID, n.Status, n.Error)
+		}
+	}
+	log.Log(log.Info, "[collator] usage reconciliation %s: %d nodes checked, %d fixed",
+		rep.Date, len(rep.Nodes), rep.Fixed)
+}
@@ -0,0 +1,72 @@
+package nats
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core/fanout"
+)
+
+func TestReconcileUsageFixesDivergentNodesOnly(t *testing.T) {
+	prevRequest, prevStored, prevReplace := requestDayUsage, storedUsageTotal, replaceNodeUsage
+	defer func() { requestDayUsage, storedUsageTotal, replaceNodeUsage = prevRequest, prevStored, prevReplace }()
+
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	rec := func(node string, hour, hits int) UsageRecord {
+		return UsageRecord{NodeID: node, Date: "2025-01-01", Hourly: true, Hour: hour, Domain: "rpc.example", Hits: hits}
+	}
+	requestDayUsage = func(req UsageRequest, _, _ time.Duration) (DnsUsageReport, error) {
+		if req.StartDate != "2025-01-01" || req.EndDate != "2025-01-01" {
+			t.Fatalf("unexpected request %+v", req)
+		}
+		return DnsUsageReport{
+			Records: []UsageRecord{rec("dns-1", 0, 10), rec("dns-1", 1, 5), rec("dns-2", 0, 8), rec("dns-3", 23, 4)},
+			Nodes: []fanout.NodeStatus{
+				{NodeID: "dns-1", Replied: true},
+				{NodeID: "dns-2", Replied: true},
+				{NodeID: "dns-3", Replied: true},
+				{NodeID: "dns-4", Replied: true},
+				{NodeID: "dns-5", Error: "timeout"},
+			},
+		}, nil
+	}
+	storedUsageTotal = func(time.Time) (map[string]int64, error) {
+		return map[string]int64{"dns-1": 15, "dns-2": 6, "dns-3": 1, "dns-4": 9, "dns-5": 3}, nil
+	}
+	replaced := map[string]int{}
+	replaceNodeUsage = func(date time.Time, nodeID string, recs []data2.UsageRecord) error {
+		if !date.Equal(day) {
+			t.Fatalf("unexpected replace date %s", date)
+		}
+		replaced[nodeID] = len(recs)
+		if nodeID == "dns-3" {
+			return errors.New("deadlock")
+		}
+		return nil
+	}
+
+	rep, err := ReconcileUsage(day.Add(13 * time.Hour))
+	if err != nil {
+		t.Fatalf("ReconcileUsage: %v", err)
+	}
+	want := map[string]string{
+		"dns-1": ReconcileOK,
+		"dns-2": ReconcileFixed,
+		"dns-3": ReconcileFailed,
+		"dns-4": ReconcileEmpty,
+		"dns-5": ReconcileUnreachable,
+	}
+	if rep.Date != "2025-01-01" || rep.Fixed != 1 || len(rep.Nodes) != len(want) {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+	for _, n := range rep.Nodes {
+		if n.Status != want[n.NodeID] {
+			t.Errorf("%s: expected %s, got %+v", n.NodeID, want[n.NodeID], n)
+		}
+	}
+	if len(replaced) != 2 || replaced["dns-2"] != 1 || replaced["dns-3"] != 1 {
+		t.Fatalf("expected only dns-2 and dns-3 replaced, got %v", replaced)
+	}
+}
@@ -0,0 +1,156 @@
+package nats
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// -----------------------------------------------------------------------------
+// MONITOR QUORUM WATCHDOG
+// -----------------------------------------------------------------------------
+//
+// Consensus needs a minimum number of active monitors; when monitors die
+// quietly, proposals simply stop finalizing. The watchdog samples the active
+// monitor count and raises a cluster health alert when it stays below
+// Nats.MonitorQuorum, when it recovers, and when it moves by at least
+// Nats.MonitorChangePercent (negative disables) from the last reported
+// count. Every monitor and collator runs it, but only the reporter (the first
+// active collator by node ID, or the first monitor when there is no
+// collator) dispatches, so one alert is raised per cluster.
+
+const (
+	watchdogInterval = 30 * time.Second
+
+	// watchdogWarmup skips alerts while heartbeats from the rest of the
+	// cluster are still arriving after start-up.
+	watchdogWarmup = 3 * time.Minute
+
+	// watchdogConfirmSamples is how many consecutive samples must agree
+	// before quorum is reported lost or restored.
+	watchdogConfirmSamples = 2
+
+	defaultMonitorQuorum        = 2
+	defaultMonitorChangePercent = 30
+
+	quorumCheckName = "monitor-quorum"
+	changeCheckName = "monitor-count"
+)
+
+// quorumWatchdog turns monitor count samples into health transitions.
+type quorumWatchdog struct {
+	started  bool
+	below    bool // last reported quorum state
+	baseline int  // monitor count at the last report
+	streak   int  // consecutive samples disagreeing with below
+}
+
+// watchdogAlert is one transition produced by observe.
+type watchdogAlert struct {
+	kind    alerts.Kind
+	check   string
+	message string
+}
+
+// observe records one sample and returns the transitions it causes.
+func (w *quorumWatchdog) observe(count, quorum, changePct int) []watchdogAlert {
+	if !w.started {
+		w.started = true
+		w.baseline = count
+	}
+
+	var out []watchdogAlert
+	if below := count < quorum; below != w.below {
+		w.streak++
+		if w.streak >= watchdogConfirmSamples {
+			w.below, w.streak = below, 0
+			if below {
+				out = append(out, watchdogAlert{alerts.KindQuorumLost, quorumCheckName,
+					fmt.Sprintf("%d active monitors, quorum requires %d; consensus is stalled", count, quorum)})
+			} else {
+				out = append(out, watchdogAlert{alerts.KindQuorumRestored, quorumCheckName,
+					fmt.Sprintf("%d active monitors, quorum of %d restored", count, quorum)})
+			}
+			w.baseline = count
+			return out
+		}
+	} else {
+		w.streak = 0
+	}
+
+	if changePct > 0 && w.baseline > 0 && count != w.baseline {
+		delta := count - w.baseline
+		if delta < 0 {
+			delta = -delta
+		}
+		if delta*100 >= changePct*w.baseline {
+			out = append(out, watchdogAlert{alerts.KindClusterChanged, changeCheckName,
+				fmt.Sprintf("active monitors changed from %d to %d", w.baseline, count)})
+			w.baseline = count
+		}
+	}
+	return out
+}
+
+var (
+	watchdogOnce  sync.Once
+	watchdogState quorumWatchdog
+
+	dispatchClusterHealth = alerts.ClusterHealth
+)
+
+// startQuorumWatchdog begins sampling the active monitor count.
+func startQuorumWatchdog() {
+	watchdogOnce.Do(func() {
+		started := time.Now()
+		go func() {
+			t := time.NewTicker(watchdogInterval)
+			defer t.Stop()
+			for range t.C {
+				if time.Since(started) < watchdogWarmup {
+					continue
+				}
+				runQuorumWatchdog()
+			}
+		}()
+	})
+}
+
+func runQuorumWatchdog() {
+	nc := cfg.GetConfig().Local.Nats
+	quorum := nc.MonitorQuorum
+	if quorum <= 0 {
+		quorum = defaultMonitorQuorum
+	}
+	changePct := nc.MonitorChangePercent
+	if changePct == 0 {
+		changePct = defaultMonitorChangePercent
+	}
+
+	count := countActiveMonitors()
+	transitions := watchdogState.observe(count, quorum, changePct)
+	if len(transitions) == 0 || !isWatchdogReporter() {
+		return
+	}
+	for _, a := range transitions {
+		log.Log(log.Warn, "[NATS] cluster health: %s: %s", a.kind, a.message)
+		dispatchClusterHealth(a.kind, nc.ClusterName, a.check, a.message)
+	}
+}
+
+// isWatchdogReporter reports whether this node raises the cluster's health
+// alerts.
+func isWatchdogReporter() bool {
+	ids := activeNodeIDs(RoleCollator)
+	if len(ids) == 0 {
+		ids = activeNodeIDs(RoleMonitor)
+	}
+	State.Mu.RLock()
+	self := State.NodeID
+	State.Mu.RUnlock()
+	return len(ids) > 0 && ids[0] == self
+}
@@ -0,0 +1,103 @@
+package nats
+
+import (
+	"testing"
+
+	"github.com/ibp-network/ibp-geodns-libs/alerts"
+)
+
+func TestQuorumWatchdogConfirmsLossAndRecovery(t *testing.T) {
+	var w quorumWatchdog
+
+	if got := w.observe(3, 2, -1); len(got) != 0 {
+		t.Fatalf("expected no alert with quorum, got %+v", got)
+	}
+	if got := w.observe(1, 2, -1); len(got) != 0 {
+		t.Fatalf("expected a single low sample to be ignored, got %+v", got)
+	}
+	got := w.observe(1, 2, -1)
+	if len(got) != 1 || got[0].kind != alerts.KindQuorumLost {
+		t.Fatalf("expected quorum lost after confirmation, got %+v", got)
+	}
+	if got := w.observe(1, 2, -1); len(got) != 0 {
+		t.Fatalf("expected lost quorum to be reported once, got %+v", got)
+	}
+
+	w.observe(2, 2, -1)
+	got = w.observe(2, 2, -1)
+	if len(got) != 1 || got[0].kind != alerts.KindQuorumRestored {
+		t.Fatalf("expected quorum restored, got %+v", got)
+	}
+}
+
+func TestQuorumWatchdogFlapDoesNotAlert(t *testing.T) {
+	var w quorumWatchdog
+	for _, n := range []int{3, 1, 3, 1, 3} {
+		if got := w.observe(n, 2, -1); len(got) != 0 {
+			t.Fatalf("expected flapping count not to alert, got %+v at %d", got, n)
+		}
+	}
+}
+
+func TestQuorumWatchdogReportsMaterialChange(t *testing.T) {
+	var w quorumWatchdog
+	w.observe(10, 2, 30)
+
+	if got := w.observe(8, 2, 30); len(got) != 0 {
+		t.Fatalf("expected 20%% drop to stay quiet, got %+v", got)
+	}
+	got := w.observe(7, 2, 30)
+	if len(got) != 1 || got[0].kind != alerts.KindClusterChanged || got[0].check != changeCheckName {
+		t.Fatalf("expected cluster change at 30%%, got %+v", got)
+	}
+	if got := w.observe(7, 2, 30); len(got) != 0 {
+		t.Fatalf("expected baseline to move to the reported count, got %+v", got)
+	}
+}
+
+func TestRunQuorumWatchdogOnlyReporterDispatches(t *testing.T) {
+	prevCount, prevIDs, prevDispatch, prevState := countActiveMonitors, activeNodeIDs, dispatchClusterHealth, watchdogState
+	defer func() {
+		countActiveMonitors, activeNodeIDs, dispatchClusterHealth, watchdogState = prevCount, prevIDs, prevDispatch, prevState
+	}()
+
+	State.Mu.Lock()
+	prevNode := State.NodeID
+	State.NodeID = "collator-b"
+	State.Mu.Unlock()
+	defer func() {
+		State.Mu.Lock()
+		State.NodeID = prevNode
+		State.Mu.Unlock()
+	}()
+
+	countActiveMonitors = func() int { return 0 }
+	collators := []string{"collator-a", "collator-b"}
+	activeNodeIDs = func(role string) []string {
+		if role == "IBPCollator" {
+			return collators
+		}
+		return nil
+	}
+	var sent []alerts.Kind
+	dispatchClusterHealth = func(kind alerts.Kind, cluster, check, message string) {
+		sent = append(sent, kind)
+	}
+
+	watchdogState = quorumWatchdog{}
+	for i := 0; i < watchdogConfirmSamples+1; i++ {
+		runQuorumWatchdog()
+	}
+	if len(sent) != 0 {
+		t.Fatalf("expected non-reporter to stay quiet, got %v", sent)
+	}
+
+	collators = []string{"collator-b"}
+	watchdogState = quorumWatchdog{}
+	for i := 0; i < watchdogConfirmSamples+1; i++ {
+		runQuorumWatchdog()
+	}
+	if len(sent) != 1 || sent[0] != alerts.KindQuorumLost {
+		t.Fatalf("expected reporter to raise quorum lost, got %v", sent)
+	}
+}
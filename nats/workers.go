@@ -0,0 +1,297 @@
+package nats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-libs/crashreport"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/nats/router"
+
+	"github.com/nats-io/nats.go"
+)
+
+// -----------------------------------------------------------------------------
+// HANDLER WORKER POOL
+// -----------------------------------------------------------------------------
+//
+// Incoming messages are queued per subscribed subject and handled by a fixed
+// set of workers, so a burst never turns into one goroutine per message. When
+// a subject's queue is full the overflow policy decides whether the NATS
+// delivery goroutine blocks (pushing back on the server) or a message is
+// dropped.
+
+const (
+	defaultHandlerWorkers   = 256
+	defaultHandlerQueueSize = 1024
+	dropReportInterval      = time.Minute
+)
+
+// Overflow policies for full subject queues.
+const (
+	OverflowBlock      = "block"
+	OverflowDropNewest = "drop_newest"
+	OverflowDropOldest = "drop_oldest"
+)
+
+// HandlerQueueStats describes one subject queue of the handler pool.
+type HandlerQueueStats struct {
+	Subject  string
+	Depth    int
+	Capacity int
+	Handled  uint64
+	Dropped  uint64
+	Panics   uint64
+}
+
+type handlerJob struct {
+	cb  func(*nats.Msg)
+	msg *nats.Msg
+}
+
+type subjectQueue struct {
+	subject  string
+	jobs     chan handlerJob
+	evictMu  sync.Mutex // serialises drop_oldest eviction with insertion
+	handled  atomic.Uint64
+	dropped  atomic.Uint64
+	panics   atomic.Uint64
+	reported atomic.Uint64
+}
+
+type workerPool struct {
+	workers   int
+	queueSize int
+	policy    string
+	ready     chan *subjectQueue
+
+	mu     sync.Mutex
+	queues map[string]*subjectQueue
+}
+
+var (
+	poolMu       sync.Mutex
+	handlerPool  *workerPool
+	poolSettings = cfg.NatsConfig{}
+
+	// handlerPanics counts panics recovered from handlers since start-up.
+	handlerPanics atomic.Uint64
+)
+
+// configureHandlerPool records the pool settings from the NATS config. The
+// pool is built on first subscription; later changes need a restart.
+func configureHandlerPool(c cfg.NatsConfig) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	if handlerPool != nil {
+		if c.HandlerWorkers != poolSettings.HandlerWorkers ||
+			c.HandlerQueueSize != poolSettings.HandlerQueueSize ||
+			c.OverflowPolicy != poolSettings.OverflowPolicy {
+			log.Log(log.Warn, "[NATS] handler pool settings changed; restart to apply")
+		}
+		return
+	}
+	poolSettings = c
+}
+
+func currentPool() *workerPool {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	if handlerPool == nil {
+		handlerPool = newWorkerPool(poolSettings.HandlerWorkers, poolSettings.HandlerQueueSize, poolSettings.OverflowPolicy)
+		go handlerPool.reportDrops()
+	}
+	return handlerPool
+}
+
+func newWorkerPool(workers, queueSize int, policy string) *workerPool {
+	if workers <= 0 {
+		workers = defaultHandlerWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultHandlerQueueSize
+	}
+	policy = normalizeOverflowPolicy(policy)
+
+	p := &workerPool{
+		workers:   workers,
+		queueSize: queueSize,
+		policy:    policy,
+		// One token per queued job; past this many jobs across all
+		// subjects enqueueing blocks regardless of policy.
+		ready:  make(chan *subjectQueue, workers*queueSize),
+		queues: make(map[string]*subjectQueue),
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func normalizeOverflowPolicy(policy string) string {
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case OverflowDropNewest:
+		return OverflowDropNewest
+	case OverflowDropOldest:
+		return OverflowDropOldest
+	case "", OverflowBlock:
+		return OverflowBlock
+	default:
+		log.Log(log.Warn, "[NATS] unknown overflow policy %q; using %s", policy, OverflowBlock)
+		return OverflowBlock
+	}
+}
+
+func (p *workerPool) queue(subject string) *subjectQueue {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	q, ok := p.queues[subject]
+	if !ok {
+		q = &subjectQueue{subject: subject, jobs: make(chan handlerJob, p.queueSize)}
+		p.queues[subject] = q
+	}
+	return q
+}
+
+// enqueue adds a job to q according to the overflow policy.
+func (p *workerPool) enqueue(q *subjectQueue, job handlerJob) {
+	switch p.policy {
+	case OverflowDropNewest:
+		select {
+		case q.jobs <- job:
+		default:
+			q.dropped.Add(1)
+			return
+		}
+	case OverflowDropOldest:
+		q.evictMu.Lock()
+		for {
+			select {
+			case q.jobs <- job:
+				q.evictMu.Unlock()
+				p.ready <- q
+				return
+			default:
+			}
+			select {
+			case <-q.jobs:
+				// The evicted job's token stays in ready and is
+				// consumed by the job inserted next.
+				q.dropped.Add(1)
+				select {
+				case q.jobs <- job:
+				default:
+					continue
+				}
+				q.evictMu.Unlock()
+				return
+			default:
+			}
+		}
+	default:
+		q.jobs <- job
+	}
+	p.ready <- q
+}
+
+func (p *workerPool) work() {
+	for q := range p.ready {
+		// Tokens never outnumber queued jobs, so this only waits for a
+		// drop_oldest replacement that is already in progress.
+		job := <-q.jobs
+		p.run(q, job)
+	}
+}
+
+func (p *workerPool) run(q *subjectQueue, job handlerJob) {
+	handler := router.Recover(job.cb, func(msg *nats.Msg, r interface{}, stack []byte) {
+		q.panics.Add(1)
+		reportHandlerPanic(msg, r, stack)
+	})
+	if handler(job.msg) {
+		q.handled.Add(1)
+	}
+}
+
+// reportHandlerPanic logs a recovered handler panic with its stack, counts
+// it and sends it to Sentry when crash reporting is configured.
+func reportHandlerPanic(msg *nats.Msg, r interface{}, stack []byte) {
+	handlerPanics.Add(1)
+	log.LogCtx(core.ContextFromMsg(msg), log.Error, "[NATS] callback panic for %s: %v\n%s", msg.Subject, r, stack)
+
+	tags := map[string]string{"subject": msg.Subject}
+	if node := cfg.GetConfig().Local.Nats.NodeID; node != "" {
+		tags["node"] = node
+	}
+	if id := msg.Header.Get(core.CorrelationHeader); id != "" {
+		tags["correlation_id"] = id
+	}
+	crashreport.Send(crashreport.Report{
+		Message: fmt.Sprintf("panic in NATS handler for %s: %v", msg.Subject, r),
+		Stack:   stack,
+		Tags:    tags,
+	})
+}
+
+func (p *workerPool) stats() []HandlerQueueStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]HandlerQueueStats, 0, len(p.queues))
+	for _, q := range p.queues {
+		out = append(out, HandlerQueueStats{
+			Subject:  q.subject,
+			Depth:    len(q.jobs),
+			Capacity: cap(q.jobs),
+			Handled:  q.handled.Load(),
+			Dropped:  q.dropped.Load(),
+			Panics:   q.panics.Load(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Subject < out[j].Subject })
+	return out
+}
+
+func (p *workerPool) reportDrops() {
+	t := time.NewTicker(dropReportInterval)
+	defer t.Stop()
+	for range t.C {
+		for _, line := range p.dropReport() {
+			log.Log(log.Warn, "[NATS] %s", line)
+		}
+	}
+}
+
+// dropReport returns one line per subject that dropped messages since the
+// previous report.
+func (p *workerPool) dropReport() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var lines []string
+	for _, q := range p.queues {
+		total := q.dropped.Load()
+		prev := q.reported.Swap(total)
+		if total > prev {
+			lines = append(lines, fmt.Sprintf("handler queue for %s full (%s): dropped %d message(s)", q.subject, p.policy, total-prev))
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// HandlerPanics returns how many handler panics were recovered since
+// start-up.
+func HandlerPanics() uint64 {
+	return handlerPanics.Load()
+}
+
+// HandlerStats reports depth, throughput, overflow and panic counts per
+// subscribed subject.
+func HandlerStats() []HandlerQueueStats {
+	return currentPool().stats()
+}
@@ -0,0 +1,152 @@
+package nats
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	natsio "github.com/nats-io/nats.go"
+)
+
+// blockedPool returns a one-worker pool whose worker is parked on a gate
+// message, so later jobs stay queued until release is called.
+func blockedPool(t *testing.T, size int, policy string) (p *workerPool, q *subjectQueue, release func()) {
+	t.Helper()
+	p = newWorkerPool(1, size, policy)
+	q = p.queue("test.subject")
+
+	started := make(chan struct{})
+	gate := make(chan struct{})
+	p.enqueue(q, handlerJob{cb: func(*natsio.Msg) {
+		close(started)
+		<-gate
+	}, msg: &natsio.Msg{Subject: "test.subject"}})
+
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker did not pick up the gate job")
+	}
+	var once sync.Once
+	return p, q, func() { once.Do(func() { close(gate) }) }
+}
+
+func recordJobs(p *workerPool, q *subjectQueue, n int, seen *[]string, mu *sync.Mutex, wg *sync.WaitGroup) {
+	for i := 0; i < n; i++ {
+		data := fmt.Sprintf("m%d", i)
+		wg.Add(1)
+		p.enqueue(q, handlerJob{cb: func(m *natsio.Msg) {
+			defer wg.Done()
+			mu.Lock()
+			*seen = append(*seen, string(m.Data))
+			mu.Unlock()
+		}, msg: &natsio.Msg{Subject: "test.subject", Data: []byte(data)}})
+	}
+}
+
+func TestWorkerPoolDropNewestKeepsOldest(t *testing.T) {
+	p, q, release := blockedPool(t, 2, OverflowDropNewest)
+	defer release()
+
+	var (
+		mu   sync.Mutex
+		seen []string
+		wg   sync.WaitGroup
+	)
+	recordJobs(p, q, 2, &seen, &mu, &wg)
+	// Queue is full; this one must be dropped without blocking.
+	p.enqueue(q, handlerJob{cb: func(*natsio.Msg) { t.Error("dropped job ran") }, msg: &natsio.Msg{}})
+
+	release()
+	wg.Wait()
+
+	if got := q.dropped.Load(); got != 1 {
+		t.Fatalf("expected 1 dropped message, got %d", got)
+	}
+	if len(seen) != 2 || seen[0] != "m0" || seen[1] != "m1" {
+		t.Fatalf("expected oldest messages to be handled, got %v", seen)
+	}
+}
+
+func TestWorkerPoolDropOldestKeepsNewest(t *testing.T) {
+	p, q, release := blockedPool(t, 2, OverflowDropOldest)
+	defer release()
+
+	var (
+		mu   sync.Mutex
+		seen []string
+		wg   sync.WaitGroup
+	)
+	// m0 and m1 are evicted by m2 and m3; their WaitGroup slots are
+	// released manually below.
+	recordJobs(p, q, 4, &seen, &mu, &wg)
+	wg.Add(-2)
+
+	release()
+	wg.Wait()
+
+	if got := q.dropped.Load(); got != 2 {
+		t.Fatalf("expected 2 dropped messages, got %d", got)
+	}
+	if len(seen) != 2 || seen[0] != "m2" || seen[1] != "m3" {
+		t.Fatalf("expected newest messages to be handled, got %v", seen)
+	}
+}
+
+func TestWorkerPoolRecoversFromPanics(t *testing.T) {
+	p := newWorkerPool(1, 4, OverflowBlock)
+	q := p.queue("panic.subject")
+
+	before := HandlerPanics()
+	done := make(chan struct{})
+	p.enqueue(q, handlerJob{cb: func(*natsio.Msg) { panic("boom") }, msg: &natsio.Msg{Subject: "panic.subject"}})
+	p.enqueue(q, handlerJob{cb: func(*natsio.Msg) { close(done) }, msg: &natsio.Msg{Subject: "panic.subject"}})
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker did not survive a panicking handler")
+	}
+
+	stats := p.stats()
+	if len(stats) != 1 || stats[0].Panics != 1 || stats[0].Handled != 1 {
+		t.Fatalf("expected one panic and one handled message, got %+v", stats)
+	}
+	if got := HandlerPanics(); got != before+1 {
+		t.Fatalf("expected the panic counter to be %d, got %d", before+1, got)
+	}
+}
+
+func TestWorkerPoolStatsAndDropReport(t *testing.T) {
+	p, q, release := blockedPool(t, 1, OverflowDropNewest)
+	defer release()
+
+	p.enqueue(q, handlerJob{cb: func(*natsio.Msg) {}, msg: &natsio.Msg{}})
+	p.enqueue(q, handlerJob{cb: func(*natsio.Msg) {}, msg: &natsio.Msg{}})
+
+	stats := p.stats()
+	if len(stats) != 1 || stats[0].Subject != "test.subject" || stats[0].Depth != 1 || stats[0].Capacity != 1 || stats[0].Dropped != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if lines := p.dropReport(); len(lines) != 1 {
+		t.Fatalf("expected one drop report line, got %v", lines)
+	}
+	if lines := p.dropReport(); len(lines) != 0 {
+		t.Fatalf("expected drops to be reported once, got %v", lines)
+	}
+}
+
+func TestNormalizeOverflowPolicy(t *testing.T) {
+	for in, want := range map[string]string{
+		"":            OverflowBlock,
+		"BLOCK":       OverflowBlock,
+		"drop_oldest": OverflowDropOldest,
+		"drop_newest": OverflowDropNewest,
+		"bogus":       OverflowBlock,
+	} {
+		if got := normalizeOverflowPolicy(in); got != want {
+			t.Fatalf("normalizeOverflowPolicy(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
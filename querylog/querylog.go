@@ -0,0 +1,322 @@
+// Package querylog writes a sampled log of raw DNS queries for abuse
+// investigation. It is separate from usage aggregation, which only keeps
+// daily counts, and is off unless configured.
+package querylog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/internal/clientprefix"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+)
+
+// Sinks.
+const (
+	SinkFile       = "file"
+	SinkClickHouse = "clickhouse"
+)
+
+// Config controls the query log. Nothing is logged unless Enabled is set
+// and SampleRate, the fraction of queries logged, is above zero. The file
+// sink appends JSON lines to Path, rotated like file log outputs; the
+// ClickHouse sink inserts batches through the HTTP interface at
+// ClickHouseURL into ClickHouseTable. Client addresses are truncated to
+// ClientPrefixV4 and ClientPrefixV6 bits (default 24 and 48).
+type Config struct {
+	Enabled    bool
+	SampleRate float64
+	Sink       string
+
+	Path        string
+	MaxSizeMB   int
+	RotateEvery time.Duration
+	MaxBackups  int
+
+	ClickHouseURL      string
+	ClickHouseTable    string
+	ClickHouseUser     string
+	ClickHousePassword string
+
+	ClientPrefixV4 int
+	ClientPrefixV6 int
+}
+
+// Entry is one logged query.
+type Entry struct {
+	Time         time.Time `json:"ts"`
+	QName        string    `json:"qname"`
+	ClientPrefix string    `json:"client_prefix"`
+	Member       string    `json:"member"`
+	RCode        int       `json:"rcode"`
+}
+
+const (
+	defaultTable      = "dns_queries"
+	writeBatchSize    = 512
+	writeQueueSize    = 8192
+	writeInterval     = 5 * time.Second
+	clickHouseTimeout = 10 * time.Second
+)
+
+// sink stores batches of entries.
+type sink interface {
+	write([]Entry) error
+	close() error
+}
+
+type writer struct {
+	cfg   Config
+	sink  sink
+	queue chan Entry
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+var (
+	writerMu sync.RWMutex
+	active   *writer
+	dropped  atomic.Uint64
+)
+
+// Configure installs (or, when disabled, removes) the query log writer.
+// Pending entries of a previous writer are written first. On error the
+// query log is left disabled.
+func Configure(c Config) error {
+	var next *writer
+	var err error
+	if c.Enabled && c.SampleRate > 0 {
+		next, err = newWriter(c)
+	}
+
+	writerMu.Lock()
+	prev := active
+	active = next
+	writerMu.Unlock()
+
+	if prev != nil {
+		prev.shutdown()
+	}
+	if next != nil {
+		log.Log(log.Info, "[querylog] logging %.4g of queries to %s", next.cfg.SampleRate, next.cfg.Sink)
+	}
+	return err
+}
+
+// Shutdown writes pending entries and disables the query log.
+func Shutdown() {
+	_ = Configure(Config{})
+}
+
+// Enabled reports whether queries are being logged.
+func Enabled() bool {
+	writerMu.RLock()
+	defer writerMu.RUnlock()
+	return active != nil
+}
+
+// Dropped returns the number of sampled entries dropped because the write
+// queue was full.
+func Dropped() uint64 {
+	return dropped.Load()
+}
+
+// Record samples a query for the log. clientIP is truncated to its prefix
+// before it is queued.
+func Record(qname, clientIP, member string, rcode int) {
+	writerMu.RLock()
+	w := active
+	writerMu.RUnlock()
+	if w == nil || (w.cfg.SampleRate < 1 && rand.Float64() >= w.cfg.SampleRate) {
+		return
+	}
+	e := Entry{
+		Time:         time.Now().UTC(),
+		QName:        strings.TrimSuffix(strings.ToLower(qname), "."),
+		ClientPrefix: clientprefix.String(clientIP, w.cfg.ClientPrefixV4, w.cfg.ClientPrefixV6),
+		Member:       member,
+		RCode:        rcode,
+	}
+	select {
+	case w.queue <- e:
+	default:
+		dropped.Add(1)
+	}
+}
+
+func newWriter(c Config) (*writer, error) {
+	if c.SampleRate > 1 {
+		c.SampleRate = 1
+	}
+	c.Sink = strings.ToLower(strings.TrimSpace(c.Sink))
+	if c.Sink == "" {
+		c.Sink = SinkFile
+	}
+	var s sink
+	switch c.Sink {
+	case SinkFile:
+		if c.Path == "" {
+			return nil, errors.New("file query log requires a path")
+		}
+		f, err := log.NewRotatingFile(c.Path, int64(c.MaxSizeMB)*1024*1024, c.RotateEvery, c.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		s = &fileSink{out: f}
+	case SinkClickHouse:
+		if c.ClickHouseURL == "" {
+			return nil, errors.New("clickhouse query log requires a URL")
+		}
+		if c.ClickHouseTable == "" {
+			c.ClickHouseTable = defaultTable
+		}
+		s = &clickHouseSink{cfg: c, client: &http.Client{Timeout: clickHouseTimeout}}
+	default:
+		return nil, fmt.Errorf("unknown query log sink %q", c.Sink)
+	}
+	w := &writer{
+		cfg:   c,
+		sink:  s,
+		queue: make(chan Entry, writeQueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *writer) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(writeInterval)
+	defer ticker.Stop()
+
+	batch := make([]Entry, 0, writeBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.sink.write(batch); err != nil {
+			log.Log(log.Warn, "[querylog] writing %d entries failed: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case e := <-w.queue:
+			batch = append(batch, e)
+			if len(batch) >= writeBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-w.stop:
+			for {
+				select {
+				case e := <-w.queue:
+					batch = append(batch, e)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *writer) shutdown() {
+	close(w.stop)
+	<-w.done
+	if err := w.sink.close(); err != nil {
+		log.Log(log.Warn, "[querylog] closing %s sink: %v", w.cfg.Sink, err)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// SINKS
+// -----------------------------------------------------------------------------
+
+// encodeLines writes entries as JSON lines.
+func encodeLines(entries []Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+type fileSink struct {
+	out io.WriteCloser
+}
+
+func (s *fileSink) write(entries []Entry) error {
+	lines, err := encodeLines(entries)
+	if err != nil {
+		return fmt.Errorf("encode entries: %w", err)
+	}
+	_, err = s.out.Write(lines)
+	return err
+}
+
+func (s *fileSink) close() error {
+	return s.out.Close()
+}
+
+type clickHouseSink struct {
+	cfg    Config
+	client *http.Client
+}
+
+func (s *clickHouseSink) write(entries []Entry) error {
+	body, err := encodeLines(entries)
+	if err != nil {
+		return fmt.Errorf("encode entries: %w", err)
+	}
+	u, err := url.Parse(s.cfg.ClickHouseURL)
+	if err != nil {
+		return fmt.Errorf("parse clickhouse URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("query", "INSERT INTO "+s.cfg.ClickHouseTable+" FORMAT JSONEachRow")
+	q.Set("date_time_input_format", "best_effort")
+	u.RawQuery = q.Encode()
+
+	ctx, cancel := context.WithTimeout(context.Background(), clickHouseTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build insert request: %w", err)
+	}
+	if s.cfg.ClickHouseUser != "" {
+		req.SetBasicAuth(s.cfg.ClickHouseUser, s.cfg.ClickHousePassword)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("clickhouse returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (s *clickHouseSink) close() error {
+	return nil
+}
@@ -0,0 +1,91 @@
+package querylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSinkWritesTruncatedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	if err := Configure(Config{Enabled: true, SampleRate: 1, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	Record("RPC.Example.org.", "203.0.113.77", "member1", 0)
+	Record("rpc.example.org", "2001:db8:1:2::5", "member2", 3)
+	Shutdown()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []Entry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, want 2", len(got))
+	}
+	if got[0].QName != "rpc.example.org" || got[0].ClientPrefix != "203.0.113.0/24" || got[0].Member != "member1" {
+		t.Fatalf("first entry = %+v", got[0])
+	}
+	if got[1].ClientPrefix != "2001:db8:1::/48" || got[1].RCode != 3 || got[1].Time.IsZero() {
+		t.Fatalf("second entry = %+v", got[1])
+	}
+}
+
+func TestDisabledWithoutSampleRate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	if err := Configure(Config{Enabled: true, Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	defer Shutdown()
+	if Enabled() {
+		t.Fatal("expected a zero sample rate to leave the query log off")
+	}
+	Record("rpc.example.org", "203.0.113.1", "m", 0)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no file, stat error %v", err)
+	}
+	if err := Configure(Config{Enabled: true, SampleRate: 1, Sink: "kafka"}); err == nil || Enabled() {
+		t.Fatal("expected an unknown sink to fail and stay off")
+	}
+}
+
+func TestClickHouseSinkInsertsJSONEachRow(t *testing.T) {
+	var query, user, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("query")
+		user, _, _ = r.BasicAuth()
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer srv.Close()
+
+	err := Configure(Config{Enabled: true, SampleRate: 1, Sink: SinkClickHouse,
+		ClickHouseURL: srv.URL, ClickHouseUser: "writer", ClickHousePassword: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Record("rpc.example.org", "198.51.100.9", "m", 5)
+	Shutdown()
+
+	if query != "INSERT INTO dns_queries FORMAT JSONEachRow" || user != "writer" {
+		t.Fatalf("query %q user %q", query, user)
+	}
+	if !strings.Contains(body, `"client_prefix":"198.51.100.0/24"`) || !strings.Contains(body, `"rcode":5`) {
+		t.Fatalf("body = %s", body)
+	}
+}
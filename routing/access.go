@@ -0,0 +1,198 @@
+// Package routing holds the policy decisions of the GeoDNS serving path:
+// which clients a service may be served to and which members answer them.
+package routing
+
+import (
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+)
+
+// -----------------------------------------------------------------------------
+// ACCESS POLICY
+// -----------------------------------------------------------------------------
+//
+// Services may carry allow and deny lists of countries, ASNs and prefixes
+// (Configuration.Access). Check evaluates them for a client and returns a
+// Decision; the DNS layer answers a denied client with Decision.Action
+// instead of member records. Deny wins over Allow, and a non-empty Allow
+// admits only the clients it matches. The lists are compiled once per
+// config load.
+
+const accessReloadHook = "routing.access"
+
+// Deny actions.
+const (
+	ActionRefuse   = "refuse"
+	ActionNXDomain = "nxdomain"
+)
+
+// Client is the querying client. Country and ASN are filled by ClientFor;
+// empty ones match no list entry.
+type Client struct {
+	IP      netip.Addr
+	Country string
+	ASN     string
+}
+
+// ClientFor looks up the country and ASN of ip.
+func ClientFor(ip string) Client {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return Client{}
+	}
+	asn, _ := max.GetAsnAndNetwork(addr.String())
+	return Client{IP: addr.Unmap(), Country: max.GetCountryCode(addr.String()), ASN: asn}
+}
+
+// Decision is the outcome of an access check. Rule names the list entry
+// that decided, e.g. "deny country KP" or "allow (no match)".
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Action  string `json:"action,omitempty"`
+	Service string `json:"service,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+}
+
+type accessList struct {
+	countries map[string]bool
+	asns      map[string]bool
+	prefixes  []netip.Prefix
+}
+
+type accessPolicy struct {
+	allow, deny accessList
+	action      string
+}
+
+var (
+	policies   atomic.Pointer[map[string]*accessPolicy]
+	accessOnce sync.Once
+)
+
+func compileList(service string, l cfg.AccessList) accessList {
+	out := accessList{countries: make(map[string]bool), asns: make(map[string]bool)}
+	for _, c := range l.Countries {
+		if c = strings.ToUpper(strings.TrimSpace(c)); c != "" {
+			out.countries[c] = true
+		}
+	}
+	for _, a := range l.ASNs {
+		if a = NormalizeASN(a); a != "" {
+			out.asns[a] = true
+		}
+	}
+	for _, raw := range l.CIDRs {
+		p, err := netip.ParsePrefix(strings.TrimSpace(raw))
+		if err != nil {
+			log.Log(log.Warn, "[routing] service %s: ignoring access prefix %q: %v", service, raw, err)
+			continue
+		}
+		out.prefixes = append(out.prefixes, p.Masked())
+	}
+	return out
+}
+
+func (l accessList) empty() bool {
+	return len(l.countries)+len(l.asns)+len(l.prefixes) == 0
+}
+
+// match returns the entry of l matching c, or "".
+func (l accessList) match(c Client) string {
+	if c.Country != "" && l.countries[strings.ToUpper(c.Country)] {
+		return "country " + strings.ToUpper(c.Country)
+	}
+	if a := NormalizeASN(c.ASN); a != "" && l.asns[a] {
+		return "asn " + a
+	}
+	if c.IP.IsValid() {
+		for _, p := range l.prefixes {
+			if p.Contains(c.IP) {
+				return "cidr " + p.String()
+			}
+		}
+	}
+	return ""
+}
+
+func compilePolicy(service string, p cfg.AccessPolicy) *accessPolicy {
+	action := strings.ToLower(strings.TrimSpace(p.DenyAction))
+	if action != ActionNXDomain {
+		action = ActionRefuse
+	}
+	return &accessPolicy{allow: compileList(service, p.Allow), deny: compileList(service, p.Deny), action: action}
+}
+
+func (p *accessPolicy) evaluate(c Client) Decision {
+	if rule := p.deny.match(c); rule != "" {
+		return Decision{Action: p.action, Rule: "deny " + rule}
+	}
+	if p.allow.empty() {
+		return Decision{Allowed: true}
+	}
+	if rule := p.allow.match(c); rule != "" {
+		return Decision{Allowed: true, Rule: "allow " + rule}
+	}
+	return Decision{Action: p.action, Rule: "allow (no match)"}
+}
+
+// Evaluate checks c against p.
+func Evaluate(p cfg.AccessPolicy, c Client) Decision {
+	return compilePolicy("", p).evaluate(c)
+}
+
+// Check decides whether c may be served domain. Domains of no service, and
+// services without lists, are allowed.
+func Check(domain string, c Client) Decision {
+	accessOnce.Do(func() {
+		rebuildPolicies()
+		cfg.RegisterReloadHook(accessReloadHook, rebuildPolicies)
+	})
+	service, _, ok := cfg.GetServiceForDomain(domain)
+	if !ok {
+		return Decision{Allowed: true}
+	}
+	p := (*policies.Load())[service]
+	if p == nil {
+		return Decision{Allowed: true, Service: service}
+	}
+	d := p.evaluate(c)
+	d.Service = service
+	if !d.Allowed {
+		log.Log(log.Debug, "[routing] %s (%s): %s denied by %s", c.IP, domain, service, d.Rule)
+	}
+	return d
+}
+
+func rebuildPolicies() {
+	m := make(map[string]*accessPolicy)
+	for name, svc := range cfg.GetConfig().Services {
+		a := svc.Configuration.Access
+		if len(a.Allow.Countries)+len(a.Allow.ASNs)+len(a.Allow.CIDRs)+
+			len(a.Deny.Countries)+len(a.Deny.ASNs)+len(a.Deny.CIDRs) == 0 {
+			continue
+		}
+		m[name] = compilePolicy(name, a)
+	}
+	policies.Store(&m)
+}
+
+// NormalizeASN returns asn as "AS<number>", or "" when it is not one.
+func NormalizeASN(asn string) string {
+	asn = strings.ToUpper(strings.TrimSpace(asn))
+	num := strings.TrimPrefix(asn, "AS")
+	if num == "" {
+		return ""
+	}
+	for _, r := range num {
+		if r < '0' || r > '9' {
+			return ""
+		}
+	}
+	return "AS" + num
+}
@@ -0,0 +1,71 @@
+package routing
+
+import (
+	"net/netip"
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func TestEvaluateDenyWinsAndAllowRestricts(t *testing.T) {
+	p := cfg.AccessPolicy{
+		Allow: cfg.AccessList{Countries: []string{"de", "FR"}, CIDRs: []string{"198.51.100.0/24"}},
+		Deny:  cfg.AccessList{ASNs: []string{"64500"}, CIDRs: []string{"2001:db8::/32"}},
+	}
+	cases := []struct {
+		name    string
+		client  Client
+		allowed bool
+		rule    string
+	}{
+		{"allowed country", Client{Country: "DE", ASN: "AS64501"}, true, "allow country DE"},
+		{"denied asn", Client{Country: "DE", ASN: "AS64500"}, false, "deny asn AS64500"},
+		{"denied prefix", Client{IP: netip.MustParseAddr("2001:db8::1"), Country: "FR"}, false, "deny cidr 2001:db8::/32"},
+		{"allowed prefix", Client{IP: netip.MustParseAddr("198.51.100.7"), Country: "US"}, true, "allow cidr 198.51.100.0/24"},
+		{"outside allow", Client{Country: "US"}, false, "allow (no match)"},
+		{"unknown client", Client{}, false, "allow (no match)"},
+	}
+	for _, tc := range cases {
+		d := Evaluate(p, tc.client)
+		if d.Allowed != tc.allowed || d.Rule != tc.rule {
+			t.Errorf("%s: got %+v", tc.name, d)
+		}
+		if !d.Allowed && d.Action != ActionRefuse {
+			t.Errorf("%s: expected the default refuse action, got %q", tc.name, d.Action)
+		}
+	}
+	if d := Evaluate(cfg.AccessPolicy{}, Client{Country: "US"}); !d.Allowed {
+		t.Fatalf("expected an empty policy to allow, got %+v", d)
+	}
+}
+
+func TestCheckUsesServicePolicyOfDomain(t *testing.T) {
+	prev := cfg.SetConfig(cfg.Config{
+		Services: map[string]cfg.Service{
+			"polkadot": {
+				Configuration: cfg.ServiceConfiguration{Access: cfg.AccessPolicy{
+					Deny:       cfg.AccessList{Countries: []string{"KP"}},
+					DenyAction: "NXDOMAIN",
+				}},
+				Providers: map[string]cfg.ServiceProvider{"alpha": {RpcUrls: []string{"wss://rpc.example.org/polkadot"}}},
+			},
+		},
+	})
+	t.Cleanup(func() {
+		cfg.SetConfig(prev)
+		rebuildPolicies()
+	})
+	Check("warm.up", Client{})
+	rebuildPolicies()
+
+	d := Check("RPC.example.org.", Client{Country: "kp"})
+	if d.Allowed || d.Action != ActionNXDomain || d.Service != "polkadot" {
+		t.Fatalf("expected an nxdomain denial, got %+v", d)
+	}
+	if d := Check("rpc.example.org", Client{Country: "DE"}); !d.Allowed {
+		t.Fatalf("expected DE to be allowed, got %+v", d)
+	}
+	if d := Check("other.example.net", Client{Country: "KP"}); !d.Allowed || d.Service != "" {
+		t.Fatalf("expected a domain of no service to be allowed, got %+v", d)
+	}
+}
@@ -0,0 +1,145 @@
+package routing
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/dnsrecords"
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+)
+
+// -----------------------------------------------------------------------------
+// LATENCY PREFERENCE
+// -----------------------------------------------------------------------------
+//
+// Distance is a poor proxy for latency: a member next door behind a slow
+// transit can lose to one further away. Monitors measure members from their
+// regions; PreferByLatency ranks candidates by a blend of the latency
+// measured from the client's region and their distance to the client, in
+// the proportion of the service's LatencyWeight.
+
+const (
+	regionReloadHook = "routing.regions"
+
+	defaultLatencyWeight = 0.5
+)
+
+// Candidate is a member that can answer a client. Latency and Score are
+// filled by PreferByLatency, a zero Latency meaning no recent measurement,
+// and Weight by Distribute.
+type Candidate struct {
+	Member   string
+	Domain   string
+	IPv6     bool
+	Distance float64 // km from the client
+	Latency  time.Duration
+	Score    float64 // lower is better
+	Weight   float64
+}
+
+var (
+	countryRegions atomic.Pointer[map[string]string]
+	regionOnce     sync.Once
+)
+
+// CandidatesFor turns generated member records into candidates for a client
+// at lat, lon.
+func CandidatesFor(records []dnsrecords.MemberRecord, lat, lon float64) []Candidate {
+	out := make([]Candidate, 0, len(records))
+	for _, r := range records {
+		out = append(out, Candidate{
+			Member:   r.Member,
+			Domain:   r.QName,
+			IPv6:     r.QType == "AAAA",
+			Distance: max.Distance(lat, lon, r.Location.Latitude, r.Location.Longitude),
+		})
+	}
+	return out
+}
+
+// ClientRegion returns the region System.Routing.RegionCountries assigns
+// the client's country, or "".
+func ClientRegion(c Client) string {
+	regionOnce.Do(func() {
+		rebuildRegions()
+		cfg.RegisterReloadHook(regionReloadHook, rebuildRegions)
+	})
+	return (*countryRegions.Load())[strings.ToUpper(c.Country)]
+}
+
+func rebuildRegions() {
+	m := make(map[string]string)
+	for region, countries := range cfg.GetConfig().Local.System.Routing.RegionCountries {
+		for _, c := range countries {
+			m[strings.ToUpper(strings.TrimSpace(c))] = strings.ToLower(strings.TrimSpace(region))
+		}
+	}
+	countryRegions.Store(&m)
+}
+
+// latencyWeight returns the LatencyWeight of the service of domain.
+func latencyWeight(domain string) float64 {
+	if _, svc, ok := cfg.GetServiceForDomain(domain); ok {
+		if w := svc.Configuration.Routing.LatencyWeight; w != nil && *w >= 0 && *w <= 1 {
+			return *w
+		}
+	}
+	return defaultLatencyWeight
+}
+
+// PreferByLatency returns candidates best first. Latencies and distances
+// are scaled to the largest among the candidates; a candidate without a
+// recent measurement counts as the slowest, and without any measurement
+// the ranking is by distance alone. Ties keep the nearer, then the lower
+// named member first.
+func PreferByLatency(clientRegion string, candidates []Candidate) []Candidate {
+	out := append([]Candidate(nil), candidates...)
+	var maxLat time.Duration
+	var maxDist float64
+	for i := range out {
+		c := &out[i]
+		c.Latency, _ = dat.MemberRegionLatency(clientRegion, c.Member, c.Domain, c.IPv6)
+		if c.Latency > maxLat {
+			maxLat = c.Latency
+		}
+		if c.Distance > maxDist {
+			maxDist = c.Distance
+		}
+	}
+
+	weights := make(map[string]float64)
+	for i := range out {
+		c := &out[i]
+		w, ok := weights[c.Domain]
+		if !ok {
+			w = latencyWeight(c.Domain)
+			weights[c.Domain] = w
+		}
+		lat, dist := 1.0, 0.0
+		if maxLat == 0 {
+			w = 0
+		} else if c.Latency > 0 {
+			lat = float64(c.Latency) / float64(maxLat)
+		}
+		if maxDist > 0 {
+			dist = c.Distance / maxDist
+		}
+		c.Score = w*lat + (1-w)*dist
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Score != b.Score {
+			return a.Score < b.Score
+		}
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		return a.Member < b.Member
+	})
+	return out
+}
@@ -0,0 +1,67 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+)
+
+func TestPreferByLatencyBlendsWithDistance(t *testing.T) {
+	weight := 0.8
+	prev := cfg.SetConfig(cfg.Config{
+		Services: map[string]cfg.Service{
+			"kusama": {
+				Configuration: cfg.ServiceConfiguration{Routing: cfg.RoutingPolicy{LatencyWeight: &weight}},
+				Providers:     map[string]cfg.ServiceProvider{"near": {RpcUrls: []string{"wss://latency.example.org"}}},
+			},
+		},
+	})
+	t.Cleanup(func() { cfg.SetConfig(prev) })
+
+	now := time.Now().UTC()
+	dat.RecordRegionLatency("eu-west", "lat-near", "latency.example.org", false, 200*time.Millisecond, now)
+	dat.RecordRegionLatency("eu-west", "lat-far", "latency.example.org", false, 20*time.Millisecond, now)
+
+	candidates := []Candidate{
+		{Member: "lat-near", Domain: "latency.example.org", Distance: 100},
+		{Member: "lat-far", Domain: "latency.example.org", Distance: 1000},
+		{Member: "lat-unmeasured", Domain: "latency.example.org", Distance: 50},
+	}
+	got := PreferByLatency("eu-west", candidates)
+	order := []string{got[0].Member, got[1].Member, got[2].Member}
+	if order[0] != "lat-far" || order[1] != "lat-unmeasured" || order[2] != "lat-near" {
+		t.Fatalf("expected the fast member first, got %v", order)
+	}
+
+	weight = 0
+	c := cfg.GetConfig()
+	svc := c.Services["kusama"]
+	svc.Configuration.Routing.LatencyWeight = &weight
+	c.Services["kusama"] = svc
+	cfg.SetConfig(c)
+	got = PreferByLatency("eu-west", candidates)
+	if got[0].Member != "lat-unmeasured" || got[2].Member != "lat-far" {
+		t.Fatalf("expected distance order with weight 0, got %+v", got)
+	}
+}
+
+func TestClientRegionFromCountries(t *testing.T) {
+	var c cfg.Config
+	c.Local.System.Routing.RegionCountries = map[string][]string{"EU-West": {"de", "FR"}}
+	prev := cfg.SetConfig(c)
+	t.Cleanup(func() {
+		cfg.SetConfig(prev)
+		rebuildRegions()
+	})
+	ClientRegion(Client{})
+	rebuildRegions()
+
+	if r := ClientRegion(Client{Country: "DE"}); r != "eu-west" {
+		t.Fatalf("expected eu-west, got %q", r)
+	}
+	if r := ClientRegion(Client{Country: "US"}); r != "" {
+		t.Fatalf("expected no region, got %q", r)
+	}
+}
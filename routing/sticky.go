@@ -0,0 +1,79 @@
+package routing
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	max "github.com/ibp-network/ibp-geodns-libs/maxmind"
+)
+
+// -----------------------------------------------------------------------------
+// STICKY ROUTING
+// -----------------------------------------------------------------------------
+//
+// WSS clients that reconnect keep their session state when they land on the
+// same member. Services in the "sticky" mode key each client by its /24 or
+// /48 and order the healthy members by rendezvous hashing of that key:
+// a member leaving moves only its own clients, a member joining takes only
+// its share from the others, and weights set the share of each.
+
+// ModeSticky is the RoutingPolicy.Mode of sticky routing.
+const ModeSticky = "sticky"
+
+// StickyKey returns the client prefix sticky routing of domain keys c on,
+// or "" when the service of domain is not in the sticky mode.
+func StickyKey(domain string, c Client) string {
+	_, svc, ok := cfg.GetServiceForDomain(domain)
+	if !ok || !c.IP.IsValid() {
+		return ""
+	}
+	rp := svc.Configuration.Routing
+	if !strings.EqualFold(strings.TrimSpace(rp.Mode), ModeSticky) {
+		return ""
+	}
+	return max.GetClientPrefix(c.IP.String(), rp.StickyPrefixV4, rp.StickyPrefixV6)
+}
+
+// StickyOrder returns candidates ordered for key, the member key maps to
+// first. Candidates with a Weight above 0 get a proportional share of the
+// keys, others weigh 1. The order depends only on key and the candidate
+// set, so it is the same on every DNS node.
+func StickyOrder(key string, candidates []Candidate) []Candidate {
+	out := append([]Candidate(nil), candidates...)
+	scores := make(map[string]float64, len(out))
+	for _, c := range out {
+		w := c.Weight
+		if w <= 0 {
+			w = 1
+		}
+		scores[c.Member] = rendezvousScore(key, c.Member, w)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := scores[out[i].Member], scores[out[j].Member]
+		if a != b {
+			return a > b
+		}
+		return out[i].Member < out[j].Member
+	})
+	return out
+}
+
+// rendezvousScore is the weighted rendezvous hash -w/ln(u) of key and
+// member, with u uniform in (0, 1).
+func rendezvousScore(key, member string, w float64) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(member))
+	// FNV alone spreads similar keys poorly; finish with the splitmix64
+	// mixer.
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	u := (float64(x>>11) + 0.5) / (1 << 53)
+	return -w / math.Log(u)
+}
@@ -0,0 +1,56 @@
+package routing
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+func TestStickyOrderMovesOnlyAffectedClients(t *testing.T) {
+	all := []Candidate{{Member: "a"}, {Member: "b"}, {Member: "c"}, {Member: "d"}}
+	without := []Candidate{{Member: "a"}, {Member: "b"}, {Member: "d"}}
+
+	counts := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprintf("10.%d.%d.0/24", i/256, i%256)
+		before := StickyOrder(key, all)[0].Member
+		after := StickyOrder(key, without)[0].Member
+		counts[before]++
+		if before != "c" && after != before {
+			t.Fatalf("%s moved from %s to %s though %s stayed", key, before, after, before)
+		}
+		if again := StickyOrder(key, []Candidate{all[3], all[2], all[1], all[0]})[0].Member; again != before {
+			t.Fatalf("%s maps to %s or %s depending on candidate order", key, before, again)
+		}
+	}
+	for _, m := range []string{"a", "b", "c", "d"} {
+		if counts[m] < 400 || counts[m] > 600 {
+			t.Errorf("member %s got %d of 2000 keys", m, counts[m])
+		}
+	}
+}
+
+func TestStickyKeyFollowsServiceMode(t *testing.T) {
+	prev := cfg.SetConfig(cfg.Config{Services: map[string]cfg.Service{
+		"sticky": {
+			Configuration: cfg.ServiceConfiguration{Routing: cfg.RoutingPolicy{Mode: "sticky", StickyPrefixV6: 56}},
+			Providers:     map[string]cfg.ServiceProvider{"a": {RpcUrls: []string{"wss://sticky.example.org"}}},
+		},
+		"plain": {Providers: map[string]cfg.ServiceProvider{"a": {RpcUrls: []string{"wss://plain.example.org"}}}},
+	}})
+	t.Cleanup(func() { cfg.SetConfig(prev) })
+
+	v4 := Client{IP: netip.MustParseAddr("192.0.2.77")}
+	v6 := Client{IP: netip.MustParseAddr("2001:db8:1:2ff::1")}
+	if k := StickyKey("sticky.example.org", v4); k != "192.0.2.0/24" {
+		t.Fatalf("expected the /24, got %q", k)
+	}
+	if k := StickyKey("sticky.example.org", v6); k != "2001:db8:1:200::/56" {
+		t.Fatalf("expected the configured /56, got %q", k)
+	}
+	if k := StickyKey("plain.example.org", v4); k != "" {
+		t.Fatalf("expected no key outside the sticky mode, got %q", k)
+	}
+}
@@ -0,0 +1,139 @@
+package routing
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+)
+
+// -----------------------------------------------------------------------------
+// WEIGHTED DISTRIBUTION
+// -----------------------------------------------------------------------------
+//
+// Members at higher levels commit more Resources to a service, so with the
+// "level" weighting (the default) they get a matching share of its traffic:
+// a member weighs its Service.Weight when set, else its membership level.
+// Distribute orders candidates so each comes first in proportion to its
+// weight; CompareShares checks the split against the recorded usage.
+
+const (
+	WeightingLevel = "level"
+	WeightingEqual = "equal"
+)
+
+// MemberWeight returns the weight of m among the members of svc.
+func MemberWeight(m cfg.Member, svc cfg.Service) float64 {
+	if strings.EqualFold(strings.TrimSpace(svc.Configuration.Routing.Weighting), WeightingEqual) {
+		return 1
+	}
+	if m.Service.Weight > 0 {
+		return m.Service.Weight
+	}
+	return float64(max(m.Membership.Level, 1))
+}
+
+// Weights returns the weight of every member assigned service, by member
+// name.
+func Weights(service string) map[string]float64 {
+	svc := cfg.GetConfig().Services[service]
+	out := make(map[string]float64)
+	for _, m := range cfg.GetMembersForService(service) {
+		out[m.Details.Name] = MemberWeight(m, svc)
+	}
+	return out
+}
+
+// Distribute returns candidates in a weighted random order: each is first
+// with a probability proportional to its weight, which Distribute fills
+// from the weights of the service of its domain (1 for unknown members).
+// A nil rnd uses the global source.
+func Distribute(candidates []Candidate, rnd *rand.Rand) []Candidate {
+	float := rand.Float64
+	if rnd != nil {
+		float = rnd.Float64
+	}
+	weights := make(map[string]map[string]float64)
+	out := append([]Candidate(nil), candidates...)
+	keys := make([]float64, len(out))
+	for i := range out {
+		c := &out[i]
+		w, ok := weights[c.Domain]
+		if !ok {
+			if service, _, found := cfg.GetServiceForDomain(c.Domain); found {
+				w = Weights(service)
+			}
+			weights[c.Domain] = w
+		}
+		c.Weight = 1
+		if v, ok := w[c.Member]; ok {
+			c.Weight = v
+		}
+		// Efraimidis-Spirakis: ordering by u^(1/w) draws without
+		// replacement in proportion to the weights.
+		keys[i] = math.Pow(float(), 1/c.Weight)
+	}
+	idx := make([]int, len(out))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return keys[idx[a]] > keys[idx[b]] })
+	sorted := make([]Candidate, len(out))
+	for i, j := range idx {
+		sorted[i] = out[j]
+	}
+	return sorted
+}
+
+// MemberShare compares the traffic share a member should get with the one
+// it got.
+type MemberShare struct {
+	Member   string  `json:"member"`
+	Weight   float64 `json:"weight"`
+	Expected float64 `json:"expected"` // 0 to 1
+	Actual   float64 `json:"actual"`   // 0 to 1
+	Hits     int     `json:"hits"`
+}
+
+// CompareShares sets the expected shares of weights against the hits per
+// member of usage, by member name. Usage of members without a weight is
+// counted in the total but not listed.
+func CompareShares(weights map[string]float64, usage []dat.UsageRecord) []MemberShare {
+	hits := make(map[string]int)
+	total := 0
+	for _, r := range usage {
+		hits[r.MemberName] += r.Hits
+		total += r.Hits
+	}
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	out := make([]MemberShare, 0, len(weights))
+	for member, w := range weights {
+		s := MemberShare{Member: member, Weight: w, Hits: hits[member]}
+		if sum > 0 {
+			s.Expected = w / sum
+		}
+		if total > 0 {
+			s.Actual = float64(s.Hits) / float64(total)
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Member < out[j].Member })
+	return out
+}
+
+// VerifyShares compares the weights of service with its recorded usage
+// between start and end.
+func VerifyShares(service string, start, end time.Time) ([]MemberShare, error) {
+	usage, err := dat.GetUsageByService(service, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return CompareShares(Weights(service), usage), nil
+}
@@ -0,0 +1,69 @@
+package routing
+
+import (
+	"math/rand"
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	dat "github.com/ibp-network/ibp-geodns-libs/data"
+)
+
+func TestDistributeSplitsByWeight(t *testing.T) {
+	member := func(name string, level int, weight float64) cfg.Member {
+		return cfg.Member{
+			Details:            cfg.MemberDetails{Name: name},
+			Membership:         cfg.Membership{Level: level},
+			Service:            cfg.ServiceInfo{Active: 1, Weight: weight},
+			ServiceAssignments: map[string][]string{"westend": {"weights.example.org"}},
+		}
+	}
+	prev := cfg.SetConfig(cfg.Config{
+		Members: map[string]cfg.Member{
+			"small": member("small", 1, 0),
+			"large": member("large", 3, 0),
+			"fixed": member("fixed", 5, 4),
+		},
+		Services: map[string]cfg.Service{
+			"westend": {Providers: map[string]cfg.ServiceProvider{"small": {RpcUrls: []string{"wss://weights.example.org"}}}},
+		},
+	})
+	t.Cleanup(func() { cfg.SetConfig(prev) })
+
+	weights := Weights("westend")
+	if weights["small"] != 1 || weights["large"] != 3 || weights["fixed"] != 4 {
+		t.Fatalf("unexpected weights %v", weights)
+	}
+
+	candidates := []Candidate{
+		{Member: "small", Domain: "weights.example.org"},
+		{Member: "large", Domain: "weights.example.org"},
+		{Member: "fixed", Domain: "weights.example.org"},
+	}
+	rnd := rand.New(rand.NewSource(1))
+	first := make(map[string]int)
+	const rounds = 8000
+	for i := 0; i < rounds; i++ {
+		first[Distribute(candidates, rnd)[0].Member]++
+	}
+	for member, want := range map[string]float64{"small": 1.0 / 8, "large": 3.0 / 8, "fixed": 4.0 / 8} {
+		got := float64(first[member]) / rounds
+		if got < want-0.03 || got > want+0.03 {
+			t.Errorf("%s first in %.3f of answers, want about %.3f", member, got, want)
+		}
+	}
+
+	shares := CompareShares(weights, []dat.UsageRecord{
+		{MemberName: "small", Hits: 100}, {MemberName: "large", Hits: 300}, {MemberName: "fixed", Hits: 600},
+	})
+	if len(shares) != 3 || shares[0].Member != "fixed" || shares[0].Expected != 0.5 || shares[0].Actual != 0.6 {
+		t.Fatalf("unexpected shares %+v", shares)
+	}
+}
+
+func TestMemberWeightEqualWeighting(t *testing.T) {
+	svc := cfg.Service{Configuration: cfg.ServiceConfiguration{Routing: cfg.RoutingPolicy{Weighting: "Equal"}}}
+	m := cfg.Member{Membership: cfg.Membership{Level: 5}, Service: cfg.ServiceInfo{Weight: 7}}
+	if w := MemberWeight(m, svc); w != 1 {
+		t.Fatalf("expected equal weighting to ignore levels and weights, got %v", w)
+	}
+}
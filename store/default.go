@@ -0,0 +1,131 @@
+package store
+
+import (
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/data2"
+)
+
+// -----------------------------------------------------------------------------
+// DEFAULT IMPLEMENTATIONS
+// -----------------------------------------------------------------------------
+
+type dataEvents struct{}
+
+func (dataEvents) Record(checkType, checkName, member, domain, endpoint string, status bool,
+	errorText string, extra map[string]interface{}, isIPv6 bool) {
+	data.RecordEvent(checkType, checkName, member, domain, endpoint, status, errorText, extra, isIPv6)
+}
+
+func (dataEvents) Member(member, domain string, start, end time.Time) ([]EventRecord, error) {
+	return data.GetMemberEvents(member, domain, start, end)
+}
+
+type data2NetStatus struct{}
+
+func (data2NetStatus) Hold(rec NetStatusRecord)         { data2.HoldNetStatus(rec) }
+func (data2NetStatus) Insert(rec NetStatusRecord) error { return data2.InsertNetStatus(rec) }
+func (data2NetStatus) Close(rec NetStatusRecord) error  { return data2.CloseOpenEvent(rec) }
+
+// mysqlUsage increments through data and replaces through data2; both write
+// the same requests table.
+type mysqlUsage struct{}
+
+func (mysqlUsage) Add(rec UsageRecord) error {
+	return data.UpsertUsageRecord(fromCanonicalUsage(rec))
+}
+
+func (mysqlUsage) Replace(recs []UsageRecord) error {
+	return data2.StoreUsageRecords(recs)
+}
+
+func (mysqlUsage) ByDomain(domain string, start, end time.Time) ([]UsageRecord, error) {
+	return toCanonicalUsage(data.GetUsageByDomain(domain, start, end))
+}
+
+func (mysqlUsage) ByMember(domain, member string, start, end time.Time) ([]UsageRecord, error) {
+	return toCanonicalUsage(data.GetUsageByMember(domain, member, start, end))
+}
+
+func (mysqlUsage) ByCountry(start, end time.Time) ([]UsageRecord, error) {
+	return toCanonicalUsage(data.GetUsageByCountry(start, end))
+}
+
+func (mysqlUsage) ByService(service string, start, end time.Time) ([]UsageRecord, error) {
+	return toCanonicalUsage(data.GetUsageByService(service, start, end))
+}
+
+type data2Proposals struct{}
+
+func (data2Proposals) Cache(p Proposal)               { data2.CacheProposal(p) }
+func (data2Proposals) Pop(id string) (Proposal, bool) { return data2.PopProposal(id) }
+func (data2Proposals) ExpireStale()                   { data2.ExpireStaleProposals() }
+
+func (data2Proposals) RecordVote(id, nodeID string, agree bool) int {
+	return data2.RecordProposalVote(id, nodeID, agree)
+}
+
+func (data2Proposals) RecordOutcome(p Proposal, passed bool, decidedAt time.Time, votes map[string]bool) {
+	data2.RecordProposalOutcome(p, passed, decidedAt, votes)
+}
+
+func (data2Proposals) History(f ProposalFilter) []ProposalHistoryEntry {
+	return data2.GetProposalHistory(f)
+}
+
+// -----------------------------------------------------------------------------
+// USAGE CONVERSION
+// -----------------------------------------------------------------------------
+
+const usageDateLayout = "2006-01-02"
+
+func fromCanonicalUsage(r UsageRecord) data.UsageRecord {
+	return data.UsageRecord{
+		Date:        r.Date.UTC().Format(usageDateLayout),
+		Hourly:      r.Hourly,
+		Hour:        r.Hour,
+		NodeID:      r.NodeID,
+		Domain:      r.Domain,
+		Service:     r.Service,
+		MemberName:  r.MemberName,
+		CountryCode: r.CountryCode,
+		Asn:         r.Asn,
+		NetworkName: r.NetworkName,
+		CountryName: r.CountryName,
+		Hits:        r.Hits,
+		IsIPv6:      r.IsIPv6,
+	}
+}
+
+// toCanonicalUsage converts rows read through data. The driver may render
+// the DATE column with a time part, so only the leading date is parsed; rows
+// with an unparsable date keep the zero time.
+func toCanonicalUsage(recs []data.UsageRecord, err error) ([]UsageRecord, error) {
+	if err != nil {
+		return nil, err
+	}
+	out := make([]UsageRecord, 0, len(recs))
+	for _, r := range recs {
+		var date time.Time
+		if len(r.Date) >= len(usageDateLayout) {
+			date, _ = time.Parse(usageDateLayout, r.Date[:len(usageDateLayout)])
+		}
+		out = append(out, UsageRecord{
+			Date:        date,
+			Hourly:      r.Hourly,
+			Hour:        r.Hour,
+			NodeID:      r.NodeID,
+			Domain:      r.Domain,
+			Service:     r.Service,
+			MemberName:  r.MemberName,
+			CountryCode: r.CountryCode,
+			Asn:         r.Asn,
+			NetworkName: r.NetworkName,
+			CountryName: r.CountryName,
+			Hits:        r.Hits,
+			IsIPv6:      r.IsIPv6,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,91 @@
+// Package store is the single storage facade over the data and data2
+// packages. data holds the monitor and DNS-node side (local events, usage
+// counters) and data2 the collator side (consensus events, imported usage,
+// proposals); both grew overlapping types, so consumers had to know which
+// one to import. Store groups the operations by concern behind interfaces,
+// with the existing implementations as the default, so binaries can move to
+// it one call site at a time and tests can swap a concern for a fake.
+package store
+
+import (
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/data2"
+)
+
+// Canonical record types. Usage dates are time.Time; the data package's
+// string-dated UsageRecord is converted at the boundary.
+type (
+	EventRecord          = data.EventRecord
+	NetStatusRecord      = data2.NetStatusRecord
+	UsageRecord          = data2.UsageRecord
+	Proposal             = data2.Proposal
+	ProposalFilter       = data2.ProposalFilter
+	ProposalHistoryEntry = data2.ProposalHistoryEntry
+)
+
+// Events records and reads the monitor-side member events.
+type Events interface {
+	// Record applies one check result: an offline result opens an event once
+	// it outlasts the minimum offline time, an online result closes it.
+	Record(checkType, checkName, member, domain, endpoint string, status bool,
+		errorText string, data map[string]interface{}, isIPv6 bool)
+	// Member returns member's events that started within [start, end],
+	// optionally limited to one domain.
+	Member(member, domain string, start, end time.Time) ([]EventRecord, error)
+}
+
+// NetStatus writes the consensus-finalized outages of the collator.
+type NetStatus interface {
+	// Hold inserts rec once the outage outlasts the minimum offline time.
+	Hold(rec NetStatusRecord)
+	Insert(rec NetStatusRecord) error
+	Close(rec NetStatusRecord) error
+}
+
+// Usage stores and reads per-node request counters.
+type Usage interface {
+	// Add increments the stored hits by rec.Hits; DNS nodes use it to flush
+	// their in-memory counters.
+	Add(rec UsageRecord) error
+	// Replace overwrites the stored hits with each record's total, so the
+	// collator can import the same period more than once.
+	Replace(recs []UsageRecord) error
+	ByDomain(domain string, start, end time.Time) ([]UsageRecord, error)
+	ByMember(domain, member string, start, end time.Time) ([]UsageRecord, error)
+	ByCountry(start, end time.Time) ([]UsageRecord, error)
+	ByService(service string, start, end time.Time) ([]UsageRecord, error)
+}
+
+// Proposals tracks consensus proposals seen by a collator.
+type Proposals interface {
+	Cache(p Proposal)
+	Pop(id string) (Proposal, bool)
+	// RecordVote stores a vote and returns the number of votes recorded.
+	RecordVote(id, nodeID string, agree bool) int
+	RecordOutcome(p Proposal, passed bool, decidedAt time.Time, votes map[string]bool)
+	History(f ProposalFilter) []ProposalHistoryEntry
+	ExpireStale()
+}
+
+// Store groups the storage concerns.
+type Store struct {
+	Events    Events
+	NetStatus NetStatus
+	Usage     Usage
+	Proposals Proposals
+}
+
+var defaultStore = &Store{
+	Events:    dataEvents{},
+	NetStatus: data2NetStatus{},
+	Usage:     mysqlUsage{},
+	Proposals: data2Proposals{},
+}
+
+// Default returns the store backed by the data and data2 packages. Their
+// Init functions must have run before it is used.
+func Default() *Store {
+	return defaultStore
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/data"
+)
+
+func TestDefaultWiresEveryConcern(t *testing.T) {
+	s := Default()
+	if s.Events == nil || s.NetStatus == nil || s.Usage == nil || s.Proposals == nil {
+		t.Fatalf("expected every concern wired, got %+v", s)
+	}
+}
+
+func TestUsageConversionRoundTrips(t *testing.T) {
+	in := UsageRecord{
+		Date:        time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC),
+		NodeID:      "dns-1",
+		Domain:      "rpc.example",
+		MemberName:  "provider1",
+		CountryCode: "DE",
+		Asn:         "AS3320",
+		NetworkName: "DTAG",
+		CountryName: "Germany",
+		Hits:        42,
+		IsIPv6:      true,
+	}
+	legacy := fromCanonicalUsage(in)
+	if legacy.Date != "2025-03-04" {
+		t.Fatalf("expected date-only string, got %q", legacy.Date)
+	}
+
+	out, err := toCanonicalUsage([]data.UsageRecord{legacy}, nil)
+	if err != nil || len(out) != 1 || out[0] != in {
+		t.Fatalf("expected round trip, got %+v %v", out, err)
+	}
+}
+
+func TestToCanonicalUsageAcceptsDriverTimestamps(t *testing.T) {
+	out, _ := toCanonicalUsage([]data.UsageRecord{{Date: "2025-03-04T00:00:00Z"}, {Date: "bad"}}, nil)
+	if !out[0].Date.Equal(time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected timestamp date parsed, got %v", out[0].Date)
+	}
+	if !out[1].Date.IsZero() {
+		t.Fatalf("expected unparsable date left zero, got %v", out[1].Date)
+	}
+}
+
+func TestToCanonicalUsagePassesErrors(t *testing.T) {
+	want := errors.New("boom")
+	if _, err := toCanonicalUsage(nil, want); !errors.Is(err, want) {
+		t.Fatalf("expected error passed through, got %v", err)
+	}
+}
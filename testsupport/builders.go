@@ -0,0 +1,322 @@
+package testsupport
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+	"github.com/ibp-network/ibp-geodns-libs/store"
+)
+
+// -----------------------------------------------------------------------------
+// BUILDERS
+// -----------------------------------------------------------------------------
+//
+// Builders start from a valid record (an offline site check of member-1 by
+// monitor-1) so a test only states the fields it cares about:
+//
+//	p := testsupport.Proposal().Endpoint("rpc.example", "wss://rpc.example").Offline("timeout").Build()
+
+// Epoch is the default time of built records.
+var Epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var proposalSeq atomic.Uint64
+
+// ProposalBuilder builds a core.Proposal.
+type ProposalBuilder struct {
+	p core.Proposal
+}
+
+// Proposal starts a proposal with a unique ID.
+func Proposal() *ProposalBuilder {
+	return &ProposalBuilder{p: core.Proposal{
+		ID:           core.ProposalID(fmt.Sprintf("proposal-%d", proposalSeq.Add(1))),
+		SenderNodeID: "monitor-1",
+		CheckType:    "site",
+		CheckName:    "ping",
+		MemberName:   "member-1",
+		Timestamp:    Epoch,
+	}}
+}
+
+func (b *ProposalBuilder) ID(id string) *ProposalBuilder {
+	b.p.ID = core.ProposalID(id)
+	return b
+}
+
+func (b *ProposalBuilder) From(nodeID string) *ProposalBuilder {
+	b.p.SenderNodeID = nodeID
+	return b
+}
+
+func (b *ProposalBuilder) Member(name string) *ProposalBuilder {
+	b.p.MemberName = name
+	return b
+}
+
+// Check sets the check name, keeping the check type.
+func (b *ProposalBuilder) Check(name string) *ProposalBuilder {
+	b.p.CheckName = name
+	return b
+}
+
+// Site makes it a site check.
+func (b *ProposalBuilder) Site() *ProposalBuilder {
+	b.p.CheckType, b.p.DomainName, b.p.Endpoint = "site", "", ""
+	return b
+}
+
+// Domain makes it a domain check of domain.
+func (b *ProposalBuilder) Domain(domain string) *ProposalBuilder {
+	b.p.CheckType, b.p.DomainName, b.p.Endpoint = "domain", domain, ""
+	return b
+}
+
+// Endpoint makes it an endpoint check of endpoint on domain.
+func (b *ProposalBuilder) Endpoint(domain, endpoint string) *ProposalBuilder {
+	b.p.CheckType, b.p.DomainName, b.p.Endpoint = "endpoint", domain, endpoint
+	return b
+}
+
+// Online proposes the target is up.
+func (b *ProposalBuilder) Online() *ProposalBuilder {
+	b.p.ProposedStatus, b.p.ErrorText = true, ""
+	return b
+}
+
+// Offline proposes the target is down with errorText.
+func (b *ProposalBuilder) Offline(errorText string) *ProposalBuilder {
+	b.p.ProposedStatus, b.p.ErrorText = false, errorText
+	return b
+}
+
+func (b *ProposalBuilder) IPv6() *ProposalBuilder {
+	b.p.IsIPv6 = true
+	return b
+}
+
+func (b *ProposalBuilder) Shadow() *ProposalBuilder {
+	b.p.Shadow = true
+	return b
+}
+
+func (b *ProposalBuilder) Cluster(name string) *ProposalBuilder {
+	b.p.ClusterName = name
+	return b
+}
+
+// Data sets one entry of the proposal's data.
+func (b *ProposalBuilder) Data(key string, value interface{}) *ProposalBuilder {
+	if b.p.Data == nil {
+		b.p.Data = make(map[string]interface{})
+	}
+	b.p.Data[key] = value
+	return b
+}
+
+func (b *ProposalBuilder) At(t time.Time) *ProposalBuilder {
+	b.p.Timestamp = t.UTC()
+	return b
+}
+
+func (b *ProposalBuilder) Build() core.Proposal {
+	p := b.p
+	if b.p.Data != nil {
+		p.Data = make(map[string]interface{}, len(b.p.Data))
+		for k, v := range b.p.Data {
+			p.Data[k] = v
+		}
+	}
+	return p
+}
+
+// Finalize returns the finalize message of the proposal with votes, decided
+// a minute after the proposal.
+func (b *ProposalBuilder) Finalize(passed bool, votes map[string]bool) core.FinalizeMessage {
+	p := b.Build()
+	return core.FinalizeMessage{
+		Proposal:     p,
+		SenderNodeID: p.SenderNodeID,
+		Passed:       passed,
+		DecidedAt:    p.Timestamp.Add(time.Minute),
+		Votes:        votes,
+	}
+}
+
+// UsageRecordBuilder builds usage counters.
+type UsageRecordBuilder struct {
+	r store.UsageRecord
+}
+
+// UsageRecord starts a daily record of one hit on Epoch.
+func UsageRecord() *UsageRecordBuilder {
+	return &UsageRecordBuilder{r: store.UsageRecord{
+		Date:        Epoch,
+		NodeID:      "dns-1",
+		Domain:      "rpc.example",
+		MemberName:  "member-1",
+		CountryCode: "DE",
+		CountryName: "Germany",
+		Asn:         "AS64500",
+		NetworkName: "Example Net",
+		Hits:        1,
+	}}
+}
+
+func (b *UsageRecordBuilder) Node(nodeID string) *UsageRecordBuilder {
+	b.r.NodeID = nodeID
+	return b
+}
+
+func (b *UsageRecordBuilder) Date(t time.Time) *UsageRecordBuilder {
+	b.r.Date = t.UTC()
+	return b
+}
+
+// Hour makes it an hourly record of hour h.
+func (b *UsageRecordBuilder) Hour(h int) *UsageRecordBuilder {
+	b.r.Hourly, b.r.Hour = true, h
+	return b
+}
+
+func (b *UsageRecordBuilder) Domain(domain, service string) *UsageRecordBuilder {
+	b.r.Domain, b.r.Service = domain, service
+	return b
+}
+
+func (b *UsageRecordBuilder) Member(name string) *UsageRecordBuilder {
+	b.r.MemberName = name
+	return b
+}
+
+func (b *UsageRecordBuilder) Country(code, name string) *UsageRecordBuilder {
+	b.r.CountryCode, b.r.CountryName = code, name
+	return b
+}
+
+func (b *UsageRecordBuilder) Network(asn, name string) *UsageRecordBuilder {
+	b.r.Asn, b.r.NetworkName = asn, name
+	return b
+}
+
+func (b *UsageRecordBuilder) IPv6() *UsageRecordBuilder {
+	b.r.IsIPv6 = true
+	return b
+}
+
+func (b *UsageRecordBuilder) Hits(n int) *UsageRecordBuilder {
+	b.r.Hits = n
+	return b
+}
+
+// Build returns the canonical record used by store and data2.
+func (b *UsageRecordBuilder) Build() store.UsageRecord {
+	return b.r
+}
+
+// Wire returns the record as DNS nodes send it over NATS.
+func (b *UsageRecordBuilder) Wire() core.UsageRecord {
+	return core.UsageRecord{
+		NodeID:      b.r.NodeID,
+		Date:        b.r.Date.Format("2006-01-02"),
+		Hourly:      b.r.Hourly,
+		Hour:        b.r.Hour,
+		Domain:      b.r.Domain,
+		Service:     b.r.Service,
+		MemberName:  b.r.MemberName,
+		CountryCode: b.r.CountryCode,
+		Asn:         b.r.Asn,
+		NetworkName: b.r.NetworkName,
+		CountryName: b.r.CountryName,
+		Hits:        b.r.Hits,
+		IsIPv6:      b.r.IsIPv6,
+	}
+}
+
+// EventRecordBuilder builds a data.EventRecord.
+type EventRecordBuilder struct {
+	e data.EventRecord
+}
+
+// EventRecord starts an open offline event of a site check beginning at
+// Epoch.
+func EventRecord() *EventRecordBuilder {
+	return &EventRecordBuilder{e: data.EventRecord{
+		CheckType:  "site",
+		CheckName:  "ping",
+		MemberName: "member-1",
+		StartTime:  Epoch,
+	}}
+}
+
+func (b *EventRecordBuilder) ID(id int64) *EventRecordBuilder {
+	b.e.ID = id
+	return b
+}
+
+func (b *EventRecordBuilder) Member(name string) *EventRecordBuilder {
+	b.e.MemberName = name
+	return b
+}
+
+func (b *EventRecordBuilder) Check(checkType, name string) *EventRecordBuilder {
+	b.e.CheckType, b.e.CheckName = checkType, name
+	return b
+}
+
+func (b *EventRecordBuilder) Domain(domain string) *EventRecordBuilder {
+	b.e.DomainName = domain
+	return b
+}
+
+func (b *EventRecordBuilder) Endpoint(endpoint string) *EventRecordBuilder {
+	b.e.Endpoint = endpoint
+	return b
+}
+
+func (b *EventRecordBuilder) Error(text string) *EventRecordBuilder {
+	b.e.ErrorText = text
+	return b
+}
+
+func (b *EventRecordBuilder) IPv6() *EventRecordBuilder {
+	b.e.IsIPv6 = true
+	return b
+}
+
+// Vote records a monitor's vote on the event.
+func (b *EventRecordBuilder) Vote(nodeID string, agree bool) *EventRecordBuilder {
+	if b.e.Votes == nil {
+		b.e.Votes = make(map[string]bool)
+	}
+	b.e.Votes[nodeID] = agree
+	return b
+}
+
+// Between sets the start and end; a zero end leaves the event open.
+func (b *EventRecordBuilder) Between(start, end time.Time) *EventRecordBuilder {
+	b.e.StartTime, b.e.EndTime = start.UTC(), end
+	if !end.IsZero() {
+		b.e.EndTime = end.UTC()
+	}
+	return b
+}
+
+// Build fills StartDate and EndDate from the times.
+func (b *EventRecordBuilder) Build() data.EventRecord {
+	e := b.e
+	e.StartDate = e.StartTime.Format("2006-01-02")
+	e.EndDate = ""
+	if !e.EndTime.IsZero() {
+		e.EndDate = e.EndTime.Format("2006-01-02")
+	}
+	if b.e.Votes != nil {
+		e.Votes = make(map[string]bool, len(b.e.Votes))
+		for k, v := range b.e.Votes {
+			e.Votes[k] = v
+		}
+	}
+	return e
+}
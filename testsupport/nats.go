@@ -0,0 +1,72 @@
+package testsupport
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	ibpnats "github.com/ibp-network/ibp-geodns-libs/nats"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSServer is an in-process NATS server on a random loopback port.
+type NATSServer struct {
+	*natsserver.Server
+	URL string
+}
+
+// StartNATS starts an embedded NATS server that is shut down on cleanup.
+func StartNATS(t testing.TB) *NATSServer {
+	t.Helper()
+	srv, err := natsserver.NewServer(&natsserver.Options{
+		Host:   "127.0.0.1",
+		Port:   -1,
+		NoLog:  true,
+		NoSigs: true,
+	})
+	if err != nil {
+		t.Fatalf("testsupport: new NATS server: %v", err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(10 * time.Second) {
+		srv.Shutdown()
+		t.Fatal("testsupport: NATS server did not become ready")
+	}
+	t.Cleanup(func() {
+		srv.Shutdown()
+		srv.WaitForShutdown()
+	})
+	return &NATSServer{Server: srv, URL: srv.ClientURL()}
+}
+
+// Conn returns a plain client connection to s, for publishing requests and
+// observing what the code under test sends. It is closed on cleanup.
+func (s *NATSServer) Conn(t testing.TB) *nats.Conn {
+	t.Helper()
+	nc, err := nats.Connect(s.URL)
+	if err != nil {
+		t.Fatalf("testsupport: connect to %s: %v", s.URL, err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+// UseNATS starts an embedded server, points Nats.Url of the configuration at
+// it with nodeID as Nats.NodeID and connects the nats package. The package
+// is disconnected on cleanup.
+func UseNATS(t testing.TB, nodeID string) *NATSServer {
+	t.Helper()
+	s := StartNATS(t)
+	UpdateConfig(t, func(c *cfg.Config) {
+		c.Local.Nats.Url = s.URL
+		c.Local.Nats.NodeID = nodeID
+	})
+	ibpnats.Disconnect()
+	if err := ibpnats.Connect(); err != nil {
+		t.Fatalf("testsupport: nats.Connect: %v", err)
+	}
+	t.Cleanup(ibpnats.Disconnect)
+	return s
+}
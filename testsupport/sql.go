@@ -0,0 +1,60 @@
+package testsupport
+
+import (
+	"database/sql"
+	"testing"
+
+	mysql "github.com/ibp-network/ibp-geodns-libs/data/mysql"
+	data2 "github.com/ibp-network/ibp-geodns-libs/data2"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// -----------------------------------------------------------------------------
+// SCRIPTED SQL
+// -----------------------------------------------------------------------------
+//
+// MockDB is a go-sqlmock connection: statements are checked against the
+// expectations in order, each matching the statement text with a regular
+// expression (whitespace collapsed). NewMockDB only adds what every test of
+// this library repeats: unmet expectations fail the test on cleanup.
+//
+// Statements run in a transaction through internal/stmtcache are prepared
+// on the transaction first, so they are expected with
+// ExpectPrepare(pattern).ExpectQuery() or .ExpectExec().
+
+// MockDB is a *sql.DB and the sqlmock script it is checked against.
+type MockDB struct {
+	*sql.DB
+	sqlmock.Sqlmock
+}
+
+// NewMockDB returns a scripted connection, closed and checked for unmet
+// expectations on cleanup.
+func NewMockDB(t testing.TB) *MockDB {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("testsupport: open mock DB: %v", err)
+	}
+	// One connection keeps statements in the order the test issues them;
+	// the background prepares of the statement cache wait for it and fail
+	// harmlessly once the script is done.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		_ = db.Close()
+	})
+	return &MockDB{DB: db, Sqlmock: mock}
+}
+
+// UseDB makes db the connection of the data/mysql and data2 packages for the
+// rest of the test.
+func UseDB(t testing.TB, db *sql.DB) {
+	t.Helper()
+	prevData, prevData2 := mysql.DB, data2.DB
+	mysql.DB, data2.DB = db, db
+	t.Cleanup(func() { mysql.DB, data2.DB = prevData, prevData2 })
+}
@@ -0,0 +1,29 @@
+// Package testsupport lets binaries built on this library test code paths
+// that normally need a running NATS server and MySQL: an embedded NATS
+// server wired into the nats package, a scripted database/sql fixture
+// swapped in for the data and data2 connections, and builders for the
+// records that flow between them. It is for _test.go files only.
+package testsupport
+
+import (
+	"testing"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+)
+
+// UseConfig installs c as the library configuration for the rest of the
+// test and restores the previous one on cleanup.
+func UseConfig(t testing.TB, c cfg.Config) {
+	t.Helper()
+	prev := cfg.SetConfig(c)
+	t.Cleanup(func() { cfg.SetConfig(prev) })
+}
+
+// UpdateConfig applies fn to a copy of the current configuration and
+// installs it like UseConfig.
+func UpdateConfig(t testing.TB, fn func(c *cfg.Config)) {
+	t.Helper()
+	c := cfg.GetConfig()
+	fn(&c)
+	UseConfig(t, c)
+}
@@ -0,0 +1,118 @@
+package testsupport
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	cfg "github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-libs/data"
+	"github.com/ibp-network/ibp-geodns-libs/data/eventstore"
+	ibpnats "github.com/ibp-network/ibp-geodns-libs/nats"
+	"github.com/ibp-network/ibp-geodns-libs/nats/core"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nats-io/nats.go"
+)
+
+var eventColumns = []string{"id", "check_type", "check_name", "member_name", "domain_name", "endpoint",
+	"status", "is_ipv6", "start_time", "end_time", "error", "vote_data", "additional_data"}
+
+func TestMockDBDrivesEventStore(t *testing.T) {
+	m := NewMockDB(t)
+	UseDB(t, m.DB)
+
+	m.ExpectBegin()
+	m.ExpectPrepare(`FROM member_events WHERE id = \? FOR UPDATE`).ExpectQuery().
+		WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows(eventColumns).
+			AddRow(int64(7), "site", "ping", "member-1", "", "", false, false, Epoch, nil, "timeout", `{"monitor-1":true}`, nil))
+	m.ExpectPrepare(`UPDATE member_events SET end_time = \?, additional_data = \?`).ExpectExec().
+		WithArgs(nil, sqlmock.AnyArg(), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	m.ExpectCommit()
+
+	ev, err := data.AnnotateEvent(7, "ops", "upstream maintenance")
+	if err != nil {
+		t.Fatalf("AnnotateEvent: %v", err)
+	}
+	if ev.ID != 7 || !ev.Votes["monitor-1"] || ev.Data["annotations"] == nil {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+}
+
+func TestMockDBReturnsScriptedErrors(t *testing.T) {
+	m := NewMockDB(t)
+	UseDB(t, m.DB)
+
+	m.ExpectQuery(`FROM member_events WHERE id = \?`).WillReturnRows(sqlmock.NewRows(eventColumns))
+	if _, err := eventstore.New(m.DB, nil).Get(1); !errors.Is(err, eventstore.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for no rows, got %v", err)
+	}
+
+	boom := errors.New("boom")
+	m.ExpectExec(`UPDATE member_events`).WillReturnError(boom)
+	if _, err := m.DB.Exec(`UPDATE member_events SET end_time = NULL`); !errors.Is(err, boom) {
+		t.Fatalf("expected scripted error, got %v", err)
+	}
+}
+
+func TestUseNATSConnectsPackage(t *testing.T) {
+	UseConfig(t, cfg.Config{})
+	s := UseNATS(t, "test-node")
+
+	received := make(chan string, 1)
+	sub, err := s.Conn(t).Subscribe("testsupport.ping", func(m *nats.Msg) {
+		received <- m.Header.Get(core.SenderHeader)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	s.Conn(t).Flush()
+
+	if err := ibpnats.Publish("testsupport.ping", []byte("hi")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	select {
+	case sender := <-received:
+		if sender != "test-node" {
+			t.Fatalf("expected sender test-node, got %q", sender)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+}
+
+func TestBuilders(t *testing.T) {
+	a, b := Proposal().Build(), Proposal().Build()
+	if a.ID == b.ID {
+		t.Fatal("expected unique proposal IDs")
+	}
+
+	p := Proposal().Endpoint("rpc.example", "wss://rpc.example").Offline("timeout").Data("latency", 12).Shadow().Build()
+	if p.CheckType != "endpoint" || p.DomainName != "rpc.example" || p.ProposedStatus || p.ErrorText != "timeout" ||
+		p.Data["latency"] != 12 || !p.Shadow {
+		t.Fatalf("unexpected proposal %+v", p)
+	}
+	fm := Proposal().Online().Finalize(true, map[string]bool{"monitor-1": true})
+	if !fm.Passed || !fm.Proposal.ProposedStatus || !fm.DecidedAt.After(fm.Proposal.Timestamp) {
+		t.Fatalf("unexpected finalize %+v", fm)
+	}
+
+	u := UsageRecord().Hour(13).Hits(5)
+	if r := u.Build(); !r.Hourly || r.Hour != 13 || r.Hits != 5 {
+		t.Fatalf("unexpected usage record %+v", r)
+	}
+	if w := u.Wire(); w.Date != "2025-01-01" || w.Hits != 5 {
+		t.Fatalf("unexpected wire record %+v", w)
+	}
+
+	e := EventRecord().Vote("monitor-1", true).Between(Epoch, Epoch.Add(48*time.Hour)).Build()
+	if e.StartDate != "2025-01-01" || e.EndDate != "2025-01-03" || !e.Votes["monitor-1"] {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if open := EventRecord().Build(); open.EndDate != "" {
+		t.Fatalf("expected open event, got %+v", open)
+	}
+}
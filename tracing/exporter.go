@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/ibp-network/ibp-geodns-libs/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config controls span export. Spans are sent with the OpenTelemetry OTLP/HTTP
+// exporter to Endpoint (e.g. http://collector:4318/v1/traces).
+type Config struct {
+	Enabled     bool
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
+	Headers     map[string]string
+}
+
+const (
+	exportBatchSize   = 256
+	exportQueueSize   = 4096
+	exportInterval    = 5 * time.Second
+	exportHTTPTimeout = 10 * time.Second
+	instrumentation   = "github.com/ibp-network/ibp-geodns-libs"
+)
+
+var (
+	providerMu sync.RWMutex
+	// provider starts every span. Without export it samples nothing, but
+	// still assigns identifiers so traces propagate through this node.
+	provider = newProvider(sdktrace.NeverSample())
+)
+
+func init() {
+	otel.SetTextMapPropagator(propagator)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Log(log.Warn, "[tracing] %v", err)
+	}))
+}
+
+func newProvider(root sdktrace.Sampler, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	opts = append(opts, sdktrace.WithSampler(sdktrace.ParentBased(root)))
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+func tracer() trace.Tracer {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	return provider.Tracer(instrumentation)
+}
+
+// Configure installs (or, when disabled, removes) the span exporter. Pending
+// spans of a previous exporter are flushed first.
+func Configure(c Config) error {
+	next := newProvider(sdktrace.NeverSample())
+	if c.Enabled {
+		if c.Endpoint == "" {
+			return fmt.Errorf("tracing enabled without an OTLP endpoint")
+		}
+		if c.SampleRatio <= 0 || c.SampleRatio > 1 {
+			c.SampleRatio = 1
+		}
+		if c.ServiceName == "" {
+			c.ServiceName = "ibp-geodns"
+		}
+		exp, err := otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(c.Endpoint),
+			otlptracehttp.WithHeaders(c.Headers),
+			otlptracehttp.WithTimeout(exportHTTPTimeout),
+		)
+		if err != nil {
+			return fmt.Errorf("create OTLP exporter: %w", err)
+		}
+		next = newProvider(sdktrace.TraceIDRatioBased(c.SampleRatio),
+			sdktrace.WithResource(newResource(c.ServiceName)),
+			sdktrace.WithBatcher(exp,
+				sdktrace.WithMaxExportBatchSize(exportBatchSize),
+				sdktrace.WithMaxQueueSize(exportQueueSize),
+				sdktrace.WithBatchTimeout(exportInterval),
+				sdktrace.WithExportTimeout(exportHTTPTimeout),
+			),
+		)
+	}
+
+	providerMu.Lock()
+	prev := provider
+	provider = next
+	providerMu.Unlock()
+	otel.SetTracerProvider(next)
+
+	if err := prev.Shutdown(context.Background()); err != nil {
+		log.Log(log.Warn, "[tracing] flush of previous exporter failed: %v", err)
+	}
+	if c.Enabled {
+		log.Log(log.Info, "[tracing] exporting spans to %s (sample ratio %.2f)", c.Endpoint, c.SampleRatio)
+	}
+	return nil
+}
+
+// Shutdown flushes pending spans and disables export.
+func Shutdown() {
+	_ = Configure(Config{})
+}
+
+func newResource(service string) *resource.Resource {
+	attrs := []attribute.KeyValue{attribute.String("service.name", service)}
+	if host, _ := os.Hostname(); host != "" {
+		attrs = append(attrs, attribute.String("host.name", host))
+	}
+	return resource.NewSchemaless(attrs...)
+}
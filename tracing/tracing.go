@@ -0,0 +1,175 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceParentHeader is the W3C Trace Context header used to propagate span
+// context between nodes.
+const TraceParentHeader = "traceparent"
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext = trace.SpanContext
+
+// propagator reads and writes the W3C traceparent and tracestate headers.
+var propagator = propagation.TraceContext{}
+
+// ParseTraceParent decodes a W3C traceparent value.
+func ParseTraceParent(v string) (SpanContext, error) {
+	sc := trace.SpanContextFromContext(propagator.Extract(context.Background(), traceParentCarrier(v)))
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("malformed traceparent %q", v)
+	}
+	return sc, nil
+}
+
+// TraceParent returns the W3C traceparent value of the span context held in
+// ctx, or "" when there is none.
+func TraceParent(ctx context.Context) string {
+	c := propagation.MapCarrier{}
+	propagator.Inject(ctx, c)
+	return c[TraceParentHeader]
+}
+
+func traceParentCarrier(v string) propagation.MapCarrier {
+	return propagation.MapCarrier{TraceParentHeader: v}
+}
+
+// -----------------------------------------------------------------------------
+// SPANS
+// -----------------------------------------------------------------------------
+
+// SpanKind is the OpenTelemetry span kind.
+type SpanKind = trace.SpanKind
+
+const (
+	KindInternal = trace.SpanKindInternal
+	KindServer   = trace.SpanKindServer
+	KindClient   = trace.SpanKindClient
+	KindProducer = trace.SpanKindProducer
+	KindConsumer = trace.SpanKindConsumer
+)
+
+// Span records a timed operation. A nil *Span is valid and ignores all calls,
+// so callers never need to check whether tracing is enabled.
+type Span struct {
+	span trace.Span
+}
+
+// Start begins a span as a child of the span (or remote span context) held in
+// ctx. When the span is not sampled, e.g. because export is disabled, the
+// returned span is nil.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// Unsampled spans still get identifiers, so downstream nodes stay on
+	// the same trace even if this node does not export.
+	ctx, span := tracer().Start(ctx, name, trace.WithSpanKind(kind))
+	if !span.IsRecording() {
+		return ctx, nil
+	}
+	return ctx, &Span{span: span}
+}
+
+// SpanContextFromContext returns the active span context in ctx, if any.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	return trace.SpanContextFromContext(ctx)
+}
+
+// ContextWithRemote returns ctx carrying sc as the parent for new spans.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// SetAttr attaches a string attribute to the span.
+func (s *Span) SetAttr(key, value string) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+// RecordError marks the span as failed.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End finishes the span and queues it for export. Calling End twice is a
+// no-op.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// SpanContext returns the identifiers of s.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.span.SpanContext()
+}
+
+// -----------------------------------------------------------------------------
+// PROPAGATION
+// -----------------------------------------------------------------------------
+
+// Carrier is satisfied by nats.Header and http.Header.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// textMapCarrier adapts a Carrier to the propagation API. The W3C
+// propagator only reads the keys it knows, so Keys is never needed.
+type textMapCarrier struct{ Carrier }
+
+func (textMapCarrier) Keys() []string { return nil }
+
+// Inject writes the span context held in ctx into carrier.
+func Inject(ctx context.Context, carrier Carrier) {
+	if ctx == nil || carrier == nil {
+		return
+	}
+	propagator.Inject(ctx, textMapCarrier{carrier})
+}
+
+// Extract returns ctx with the remote span context found in carrier, if any.
+func Extract(ctx context.Context, carrier Carrier) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if carrier == nil {
+		return ctx
+	}
+	return propagator.Extract(ctx, textMapCarrier{carrier})
+}
+
+// FromTraceParent returns a context parented on a stored traceparent value.
+func FromTraceParent(ctx context.Context, traceParent string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if traceParent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, traceParentCarrier(traceParent))
+}
@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	Shutdown()
+	ctx, _ := Start(context.Background(), "op", KindInternal)
+	tp := TraceParent(ctx)
+	got, err := ParseTraceParent(tp)
+	if err != nil {
+		t.Fatalf("parse %q: %v", tp, err)
+	}
+	if want := SpanContextFromContext(ctx); got.TraceID() != want.TraceID() || got.SpanID() != want.SpanID() {
+		t.Fatalf("round trip mismatch: got %v want %v", got, want)
+	}
+}
+
+func TestParseTraceParentRejectsMalformed(t *testing.T) {
+	for _, v := range []string{
+		"",
+		"00-abc-def-01",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-zzad6b7169203331-01",
+	} {
+		if _, err := ParseTraceParent(v); err == nil {
+			t.Errorf("expected %q to be rejected", v)
+		}
+	}
+}
+
+func TestInjectExtractThroughNatsHeader(t *testing.T) {
+	Shutdown()
+
+	ctx, span := Start(context.Background(), "producer", KindProducer)
+	if span != nil {
+		t.Fatal("expected nil span while export is disabled")
+	}
+	want := SpanContextFromContext(ctx)
+
+	hdr := nats.Header{}
+	Inject(ctx, hdr)
+	if hdr.Get(TraceParentHeader) == "" {
+		t.Fatal("expected traceparent header to be set even when not exporting")
+	}
+
+	got := SpanContextFromContext(Extract(context.Background(), hdr))
+	if got.TraceID() != want.TraceID() || got.SpanID() != want.SpanID() {
+		t.Fatalf("extracted %v, want %v", got, want)
+	}
+
+	child, _ := Start(Extract(context.Background(), hdr), "consumer", KindConsumer)
+	if SpanContextFromContext(child).TraceID() != want.TraceID() {
+		t.Fatal("expected consumer to stay on the producer's trace")
+	}
+}
+
+func TestExtractWithoutHeaderReturnsContext(t *testing.T) {
+	ctx := Extract(context.Background(), http.Header{})
+	if SpanContextFromContext(ctx).IsValid() {
+		t.Fatal("expected no span context without a traceparent header")
+	}
+}
+
+func TestNilSpanIsSafe(t *testing.T) {
+	var s *Span
+	s.SetAttr("k", "v")
+	s.RecordError(errors.New("boom"))
+	s.End()
+	if s.SpanContext().IsValid() {
+		t.Fatal("expected empty span context for nil span")
+	}
+}
+
+func TestConfigureRequiresEndpoint(t *testing.T) {
+	if err := Configure(Config{Enabled: true}); err == nil {
+		t.Fatal("expected error when endpoint is missing")
+	}
+}
+
+func TestExporterPostsOTLP(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		reqs []*coltracepb.ExportTraceServiceRequest
+		auth string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := &coltracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Errorf("decode export body: %v", err)
+		}
+		mu.Lock()
+		reqs = append(reqs, req)
+		auth = r.Header.Get("Authorization")
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	if err := Configure(Config{
+		Enabled:     true,
+		Endpoint:    srv.URL + "/v1/traces",
+		ServiceName: "test-node",
+		Headers:     map[string]string{"Authorization": "Bearer x"},
+	}); err != nil {
+		t.Fatalf("configure: %v", err)
+	}
+
+	ctx, parent := Start(context.Background(), "consensus.propose", KindProducer)
+	parent.SetAttr("proposal.id", "p1")
+	_, child := Start(ctx, "consensus.vote", KindProducer)
+	child.RecordError(errors.New("publish failed"))
+	child.End()
+	parent.End()
+
+	Shutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reqs) != 1 {
+		t.Fatalf("expected one export request, got %d", len(reqs))
+	}
+	if auth != "Bearer x" {
+		t.Fatalf("expected configured header, got %q", auth)
+	}
+	rs := reqs[0].ResourceSpans[0]
+	var service string
+	for _, kv := range rs.Resource.Attributes {
+		if kv.Key == "service.name" {
+			service = kv.Value.GetStringValue()
+		}
+	}
+	if service != "test-node" {
+		t.Fatalf("unexpected service name %q", service)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	vote, propose := spans[0], spans[1]
+	if string(vote.TraceId) != string(propose.TraceId) || string(vote.ParentSpanId) != string(propose.SpanId) {
+		t.Fatalf("expected vote to be a child of propose: %v / %v", vote, propose)
+	}
+	if vote.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR {
+		t.Fatalf("expected error status on vote span, got %v", vote.Status)
+	}
+	if len(propose.Attributes) != 1 || propose.Attributes[0].Key != "proposal.id" {
+		t.Fatalf("unexpected attributes %v", propose.Attributes)
+	}
+}
+
+func TestSampledParentIsFollowedAcrossNodes(t *testing.T) {
+	Shutdown()
+	const sampled = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	ctx, _ := Start(FromTraceParent(context.Background(), sampled), "vote", KindProducer)
+	sc := SpanContextFromContext(ctx)
+	if sc.TraceID().String() != "0af7651916cd43dd8448eb211c80319c" || !sc.IsSampled() {
+		t.Fatalf("expected the sampled parent's trace, got %v", sc)
+	}
+}